@@ -1,7 +1,7 @@
 /*
 Healthcheck is a simple program that sends an HTTP request to the local host (self) to a configured port number.
 It's used in environment where you need a simple probe for health checks (e.g., an empty container in docker).
-The probe URL is http://localhost:3000/liveness . Only the port can be changed.
+The probe URL is http://localhost:3000/healthz . Only the port can be changed.
 
 Usage:
 
@@ -34,7 +34,7 @@ func main() {
 
 	flag.Parse()
 
-	res, err := http.Get(fmt.Sprintf("http://localhost:%d/liveness", *port))
+	res, err := http.Get(fmt.Sprintf("http://localhost:%d/healthz", *port))
 	if err != nil {
 		_, _ = fmt.Fprintln(os.Stderr, err.Error())
 		os.Exit(1)
@@ -17,15 +17,198 @@ type WebAPIConfiguration struct {
 		Path string `conf:"default:/conf/config.yml"`
 	}
 	Web struct {
-		APIHost         string        `conf:"default:0.0.0.0:3000"`
-		DebugHost       string        `conf:"default:0.0.0.0:4000"`
+		APIHost         string `conf:"default:0.0.0.0:3000"`
+		DebugHost       string
+		PublicURL       string        `conf:"default:http://localhost:3000"`
 		ReadTimeout     time.Duration `conf:"default:5s"`
 		WriteTimeout    time.Duration `conf:"default:5s"`
+		IdleTimeout     time.Duration `conf:"default:120s"`
+		MaxBodySize     int64         `conf:"default:65536"`
+		UploadTimeout   time.Duration `conf:"default:5m"`
 		ShutdownTimeout time.Duration `conf:"default:5s"`
+		APIDocs         bool
+		DebugProfiling  bool
+		LegacySunset    string `conf:"default:2027-04-17"`
+		Compress        bool   `conf:"default:true"`
+		TLS             struct {
+			Cert            string
+			Key             string
+			AutocertDomains []string
+			AutocertCache   string `conf:"default:/tmp/decaf-autocert"`
+			AutocertEmail   string
+			RedirectHost    string
+		}
 	}
 	Debug bool
+	Seed  int
 	DB    struct {
-		Filename string `conf:"default:/tmp/decaf.db"`
+		Driver          string `conf:"default:sqlite3"`
+		Filename        string `conf:"default:/tmp/decaf.db"`
+		URL             string
+		Replicas        []string
+		JournalMode     string        `conf:"default:WAL"`
+		BusyTimeout     time.Duration `conf:"default:5s"`
+		Synchronous     string        `conf:"default:NORMAL"`
+		RebuildCounters bool
+		RebuildHashtags bool
+		Backup          string
+	}
+	Storage struct {
+		Backend string `conf:"default:disk"`
+		Root    string `conf:"default:/tmp/decaf-photos"`
+		Bucket  struct {
+			Endpoint  string
+			Region    string `conf:"default:us-east-1"`
+			Name      string
+			Prefix    string
+			AccessKey string
+			SecretKey string `conf:"mask"`
+			PublicURL string
+		}
+	}
+	Photos struct {
+		MaxSize           int64         `conf:"default:10485760"`
+		MaxDimension      int           `conf:"default:8192"`
+		Duplicates        string        `conf:"default:warn"`
+		DuplicateDistance int           `conf:"default:5"`
+		MaxPinned         int           `conf:"default:3"`
+		PublishInterval   time.Duration `conf:"default:1m"`
+		Unsafe            string        `conf:"default:flag"`
+		MaxImportSize     int64         `conf:"default:1073741824"`
+		Classifier        struct {
+			URL       string
+			Token     string  `conf:"mask"`
+			Threshold float64 `conf:"default:0.8"`
+		}
+	}
+	Videos struct {
+		MaxSize     int64         `conf:"default:52428800"`
+		MaxDuration time.Duration `conf:"default:1m"`
+		Ffmpeg      string        `conf:"default:ffmpeg"`
+	}
+	Comments struct {
+		BlockedWords    []string
+		BlockedPatterns []string
+		Blocked         string `conf:"default:reject"`
+		Spam            struct {
+			Duplicates      string        `conf:"default:hold"`
+			DuplicateWindow time.Duration `conf:"default:10m"`
+			Links           string        `conf:"default:hold"`
+			MaxLinks        int           `conf:"default:3"`
+			Rate            string        `conf:"default:throttle"`
+			MaxRate         int           `conf:"default:5"`
+			RateWindow      time.Duration `conf:"default:1m"`
+		}
+	}
+	Stories struct {
+		Lifetime        time.Duration `conf:"default:24h"`
+		CleanupInterval time.Duration `conf:"default:10m"`
+	}
+	Bans struct {
+		CleanupInterval time.Duration `conf:"default:1m"`
+	}
+	Erasure struct {
+		Interval time.Duration `conf:"default:1m"`
+	}
+	Explore struct {
+		Window time.Duration `conf:"default:48h"`
+	}
+	Notifications struct {
+		PollInterval time.Duration `conf:"default:2s"`
+	}
+	Push struct {
+		Interval time.Duration `conf:"default:5s"`
+		FCM      struct {
+			Credentials string
+			ProjectID   string
+			Endpoint    string
+		}
+		APNS struct {
+			Key      string
+			KeyID    string
+			TeamID   string
+			Topic    string
+			Sandbox  bool
+			Endpoint string
+		}
+	}
+	Mail struct {
+		Backend string
+		From    string
+		SMTP    struct {
+			Host     string
+			Port     int `conf:"default:587"`
+			Username string
+			Password string `conf:"mask"`
+		}
+	}
+	Cache struct {
+		Backend    string
+		RedisURL   string        `conf:"mask"`
+		Prefix     string        `conf:"default:wasaphoto:"`
+		ProfileTTL time.Duration `conf:"default:1m"`
+		PhotoTTL   time.Duration `conf:"default:1m"`
+	}
+	Tracing struct {
+		Endpoint    string
+		Headers     []string      `conf:"mask"`
+		ServiceName string        `conf:"default:wasaphoto"`
+		SampleRatio float64       `conf:"default:1"`
+		Interval    time.Duration `conf:"default:5s"`
+	}
+	Digest struct {
+		Period        time.Duration `conf:"default:168h"`
+		CheckInterval time.Duration `conf:"default:1h"`
+	}
+	Webhooks struct {
+		Interval    time.Duration `conf:"default:5s"`
+		Timeout     time.Duration `conf:"default:10s"`
+		MaxAttempts int           `conf:"default:8"`
+		Retention   time.Duration `conf:"default:720h"`
+	}
+	Idempotency struct {
+		Lifetime        time.Duration `conf:"default:24h"`
+		CleanupInterval time.Duration `conf:"default:10m"`
+	}
+	Auth struct {
+		TokenSecret          string        `conf:"mask"`
+		TokenLifetime        time.Duration `conf:"default:15m"`
+		RefreshTokenLifetime time.Duration `conf:"default:720h"`
+		OIDC                 struct {
+			Issuer       string
+			ClientID     string
+			ClientSecret string `conf:"mask"`
+			RedirectURL  string
+		}
+		Github struct {
+			ClientID     string
+			ClientSecret string `conf:"mask"`
+			RedirectURL  string
+			Endpoint     string
+			APIEndpoint  string
+		}
+		APIKeys struct {
+			RateLimit    int `conf:"default:60"`
+			MaxRateLimit int `conf:"default:600"`
+		}
+	}
+	Users struct {
+		ReactivationWindow   time.Duration `conf:"default:720h"`
+		RenameGracePeriod    time.Duration `conf:"default:720h"`
+		RequireVerifiedEmail bool
+		Usernames            struct {
+			Pattern         string `conf:"default:^[\\p{L}\\p{N}_.]+$"`
+			MinLength       int    `conf:"default:3"`
+			MaxLength       int    `conf:"default:16"`
+			CaseInsensitive bool
+			Normalization   string   `conf:"default:NFKC"`
+			Reserved        []string `conf:"default:admin;administrator;root;system;api;self;session;settings;support;help;static;assets;deleted;batch;graphql"`
+			Blocked         []string
+		}
+	}
+	Admin struct {
+		Token     string `conf:"mask"`
+		BackupDir string `conf:"default:/tmp"`
 	}
 }
 
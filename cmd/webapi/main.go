@@ -1,8 +1,9 @@
 /*
 Webapi is the executable for the main web server.
 It builds a web server around APIs from `service/api`.
-Webapi connects to external resources needed (database) and starts two web servers: the API web server, and the debug.
-Everything is served via the API web server, except debug variables (/debug/vars) and profiler infos (pprof).
+Webapi connects to external resources needed (database) and starts the API web server, and the debug one if its host is
+set. Everything is served via the API web server, except debug variables (/debug/vars) and profiler infos (pprof).
+When the API web server terminates TLS, a third one may redirect the requests over plain HTTP to HTTPS.
 
 Usage:
 
@@ -27,18 +28,34 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"expvar"
 	"fmt"
 	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/api"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/auth"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/cache"
 	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/database"
 	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/globaltime"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/mail"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/moderation"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/push"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/storage"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/tracing"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/usernames"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/video"
 	"github.com/ardanlabs/conf"
+	_ "github.com/lib/pq"
 	_ "github.com/mattn/go-sqlite3"
 	"github.com/sirupsen/logrus"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 	"math/rand"
 	"net/http"
 	"os"
 	"os/signal"
+	"runtime"
+	"strings"
 	"syscall"
+	"time"
 )
 
 // main is the program entry point. The only purpose of this function is to call run() and set the exit code if there is
@@ -82,21 +99,87 @@ func run() error {
 
 	// Start Database
 	logger.Println("initializing database support")
-	dbconn, err := sql.Open("sqlite3", cfg.DB.Filename)
+	db, dbconns, err := openDatabase(cfg)
 	if err != nil {
-		logger.WithError(err).Error("error opening SQLite DB")
-		return fmt.Errorf("opening SQLite: %w", err)
+		logger.WithError(err).Error("error creating AppDatabase")
+		return fmt.Errorf("creating AppDatabase: %w", err)
 	}
 	defer func() {
 		logger.Debug("database stopping")
-		_ = dbconn.Close()
+		closeDatabase(dbconns)
 	}()
-	db, err := database.New(dbconn)
+
+	// Recompute the like and comment counters of the photos if requested
+	if cfg.DB.RebuildCounters {
+		logger.Info("rebuilding photo counters")
+		err = db.RebuildPhotoCounters(context.Background())
+		if err != nil {
+			logger.WithError(err).Error("error rebuilding photo counters")
+			return fmt.Errorf("rebuilding photo counters: %w", err)
+		}
+	}
+
+	// Tag the photos again from all the comments if requested
+	if cfg.DB.RebuildHashtags {
+		logger.Info("rebuilding hashtags")
+		err = db.RebuildHashtags(context.Background())
+		if err != nil {
+			logger.WithError(err).Error("error rebuilding hashtags")
+			return fmt.Errorf("rebuilding hashtags: %w", err)
+		}
+	}
+
+	// Save a snapshot of the database and exit if requested, the database can be in use by another instance
+	if cfg.DB.Backup != "" {
+		logger.Infof("saving database backup to %s", cfg.DB.Backup)
+		err = db.Backup(context.Background(), cfg.DB.Backup)
+		if err != nil {
+			logger.WithError(err).Error("error saving database backup")
+			return fmt.Errorf("saving database backup: %w", err)
+		}
+		return nil
+	}
+
+	// Fill the database with development data and exit if requested
+	if cfg.Seed > 0 {
+		logger.Infof("seeding database with %d users", cfg.Seed)
+		err = seedDatabase(context.Background(), db, cfg.Seed, logger)
+		if err != nil {
+			logger.WithError(err).Error("error seeding database")
+			return fmt.Errorf("seeding database: %w", err)
+		}
+		return nil
+	}
+
+	// Keep the counters of the profiles and the photos in the cache, if one is configured
+	cacheStore, err := openCache(cfg)
 	if err != nil {
-		logger.WithError(err).Error("error creating AppDatabase")
-		return fmt.Errorf("creating AppDatabase: %w", err)
+		logger.WithError(err).Error("error creating the cache")
+		return fmt.Errorf("creating the cache: %w", err)
+	}
+	if cacheStore != nil {
+		defer func() {
+			_ = cacheStore.Close()
+		}()
+		db.UseCache(cacheStore, database.CacheTTL{
+			Profile: cfg.Cache.ProfileTTL,
+			Photo:   cfg.Cache.PhotoTTL,
+		})
+		expvar.Publish("cache", expvar.Func(func() interface{} {
+			return cacheStore.Stats()
+		}))
 	}
 
+	// Export the query metrics of the database as debug variables
+	expvar.Publish("database", expvar.Func(func() interface{} {
+		return db.QueryStats()
+	}))
+
+	// Export the number of goroutines, next to the memory statistics exported by expvar itself
+	expvar.Publish("goroutines", expvar.Func(func() interface{} {
+		return runtime.NumGoroutine()
+	}))
+
 	// Start (main) API server
 	logger.Info("initializing API server")
 
@@ -109,10 +192,134 @@ func run() error {
 	// buffered channel so the goroutine can exit if we don't collect this error.
 	serverErrors := make(chan error, 1)
 
+	// Create the storage of the photos
+	photos, err := openStorage(cfg)
+	if err != nil {
+		logger.WithError(err).Error("error creating the photo storage")
+		return fmt.Errorf("creating the photo storage: %w", err)
+	}
+
+	// Create the push services delivering the notifications
+	pushers, err := openPushers(cfg)
+	if err != nil {
+		logger.WithError(err).Error("error creating the push services")
+		return fmt.Errorf("creating the push services: %w", err)
+	}
+
+	// Create the classifier of the uploaded photos, if one is configured
+	classifier, err := openClassifier(cfg)
+	if err != nil {
+		logger.WithError(err).Error("error creating the photo classifier")
+		return fmt.Errorf("creating the photo classifier: %w", err)
+	}
+
+	// Create the extractor of the posters of the uploaded videos, if ffmpeg is available
+	framer := openFramer(cfg, logger)
+
+	// Create the mailer delivering the digests
+	mailer, err := openMailer(cfg, logger)
+	if err != nil {
+		logger.WithError(err).Error("error creating the mailer")
+		return fmt.Errorf("creating the mailer: %w", err)
+	}
+
+	// Create the tracer of the requests, if a collector is configured
+	tracer, err := openTracer(cfg, logger)
+	if err != nil {
+		logger.WithError(err).Error("error creating the tracer")
+		return fmt.Errorf("creating the tracer: %w", err)
+	}
+	if tracer != nil {
+		defer func() {
+			_ = tracer.Close()
+		}()
+	}
+
+	// Create the identity providers the users sign in through
+	providers, err := openAuthProviders(cfg)
+	if err != nil {
+		logger.WithError(err).Error("error creating the identity providers")
+		return fmt.Errorf("creating the identity providers: %w", err)
+	}
+
+	// The policy of the usernames the users choose
+	usernamePolicy, err := usernames.New(cfg.Users.Usernames.Pattern, cfg.Users.Usernames.MinLength, cfg.Users.Usernames.MaxLength, cfg.Users.Usernames.CaseInsensitive, cfg.Users.Usernames.Normalization)
+	if err != nil {
+		logger.WithError(err).Error("error creating the username policy")
+		return fmt.Errorf("creating the username policy: %w", err)
+	}
+
+	// The date when the routes without the prefix of a version stop being served
+	legacySunset, err := time.Parse("2006-01-02", cfg.Web.LegacySunset)
+	if err != nil {
+		logger.WithError(err).Error("error parsing the sunset of the legacy routes")
+		return fmt.Errorf("parsing the sunset of the legacy routes: %w", err)
+	}
+
 	// Create the API router
 	apirouter, err := api.New(api.Config{
-		Logger:   logger,
-		Database: db,
+		Logger:                     logger,
+		Database:                   db,
+		Photos:                     photos,
+		TokenSecret:                cfg.Auth.TokenSecret,
+		TokenLifetime:              cfg.Auth.TokenLifetime,
+		RefreshTokenLifetime:       cfg.Auth.RefreshTokenLifetime,
+		AuthProviders:              providers,
+		APIKeyRateLimit:            cfg.Auth.APIKeys.RateLimit,
+		MaxAPIKeyRateLimit:         cfg.Auth.APIKeys.MaxRateLimit,
+		ReactivationWindow:         cfg.Users.ReactivationWindow,
+		RenameGracePeriod:          cfg.Users.RenameGracePeriod,
+		UsernamePolicy:             usernamePolicy,
+		ReservedUsernames:          cfg.Users.Usernames.Reserved,
+		BlockedUsernameTerms:       cfg.Users.Usernames.Blocked,
+		MaxBodySize:                cfg.Web.MaxBodySize,
+		UploadTimeout:              cfg.Web.UploadTimeout,
+		LegacySunset:               legacySunset,
+		Compress:                   cfg.Web.Compress,
+		Tracer:                     tracer,
+		AdminToken:                 cfg.Admin.Token,
+		BackupDir:                  cfg.Admin.BackupDir,
+		MaxPhotoSize:               cfg.Photos.MaxSize,
+		MaxPhotoDimension:          cfg.Photos.MaxDimension,
+		MaxVideoSize:               cfg.Videos.MaxSize,
+		MaxVideoDuration:           cfg.Videos.MaxDuration,
+		VideoFramer:                framer,
+		DuplicatePhotos:            cfg.Photos.Duplicates,
+		DuplicateDistance:          cfg.Photos.DuplicateDistance,
+		MaxPinnedPhotos:            cfg.Photos.MaxPinned,
+		PublishInterval:            cfg.Photos.PublishInterval,
+		Classifier:                 classifier,
+		UnsafePhotos:               cfg.Photos.Unsafe,
+		MaxImportSize:              cfg.Photos.MaxImportSize,
+		BlockedWords:               cfg.Comments.BlockedWords,
+		BlockedPatterns:            cfg.Comments.BlockedPatterns,
+		BlockedComments:            cfg.Comments.Blocked,
+		SpamDuplicates:             cfg.Comments.Spam.Duplicates,
+		SpamDuplicateWindow:        cfg.Comments.Spam.DuplicateWindow,
+		SpamLinks:                  cfg.Comments.Spam.Links,
+		SpamMaxLinks:               cfg.Comments.Spam.MaxLinks,
+		SpamRate:                   cfg.Comments.Spam.Rate,
+		SpamMaxRate:                cfg.Comments.Spam.MaxRate,
+		SpamRateWindow:             cfg.Comments.Spam.RateWindow,
+		StoryLifetime:              cfg.Stories.Lifetime,
+		StoryCleanupInterval:       cfg.Stories.CleanupInterval,
+		BanCleanupInterval:         cfg.Bans.CleanupInterval,
+		ErasureInterval:            cfg.Erasure.Interval,
+		ExploreWindow:              cfg.Explore.Window,
+		NotificationPollInterval:   cfg.Notifications.PollInterval,
+		Pushers:                    pushers,
+		PushInterval:               cfg.Push.Interval,
+		Mailer:                     mailer,
+		PublicURL:                  cfg.Web.PublicURL,
+		RequireVerifiedEmail:       cfg.Users.RequireVerifiedEmail,
+		DigestPeriod:               cfg.Digest.Period,
+		DigestCheckInterval:        cfg.Digest.CheckInterval,
+		WebhookInterval:            cfg.Webhooks.Interval,
+		WebhookTimeout:             cfg.Webhooks.Timeout,
+		WebhookMaxAttempts:         cfg.Webhooks.MaxAttempts,
+		WebhookRetention:           cfg.Webhooks.Retention,
+		IdempotencyKeyLifetime:     cfg.Idempotency.Lifetime,
+		IdempotencyCleanupInterval: cfg.Idempotency.CleanupInterval,
 	})
 	if err != nil {
 		logger.WithError(err).Error("error creating the API server instance")
@@ -120,15 +327,32 @@ func run() error {
 	}
 	router := apirouter.Handler()
 
+	// Export the counters of the spam checks of the comments as debug variables
+	expvar.Publish("spam", expvar.Func(func() interface{} {
+		return apirouter.SpamStats()
+	}))
+
 	router, err = registerWebUI(router)
 	if err != nil {
 		logger.WithError(err).Error("error registering web UI handler")
 		return fmt.Errorf("registering web UI handler: %w", err)
 	}
 
+	// Serve the OpenAPI specification and its explorer, if enabled
+	if cfg.Web.APIDocs {
+		router, err = registerAPIDocs(router)
+		if err != nil {
+			logger.WithError(err).Error("error registering API docs handler")
+			return fmt.Errorf("registering API docs handler: %w", err)
+		}
+	}
+
 	// Apply CORS policy
 	router = applyCORSHandler(router)
 
+	// Serve HTTP/2 without TLS as well, to the clients knowing it beforehand, since the gRPC clients require it
+	router = h2c.NewHandler(router, &http2.Server{})
+
 	// Create the API server
 	apiserver := http.Server{
 		Addr:              cfg.Web.APIHost,
@@ -136,15 +360,90 @@ func run() error {
 		ReadTimeout:       cfg.Web.ReadTimeout,
 		ReadHeaderTimeout: cfg.Web.ReadTimeout,
 		WriteTimeout:      cfg.Web.WriteTimeout,
+		IdleTimeout:       cfg.Web.IdleTimeout,
+	}
+
+	// Terminate TLS in the API server, if configured, serving HTTP/2 as well
+	tlsConfig, acmeHandler, err := tlsConfiguration(cfg)
+	if err != nil {
+		logger.WithError(err).Error("error configuring TLS")
+		return fmt.Errorf("configuring TLS: %w", err)
 	}
+	apiserver.TLSConfig = tlsConfig
 
 	// Start the service listening for requests in a separate goroutine
 	go func() {
-		logger.Infof("API listening on %s", apiserver.Addr)
-		serverErrors <- apiserver.ListenAndServe()
+		if apiserver.TLSConfig != nil {
+			logger.Infof("API listening on %s (TLS)", apiserver.Addr)
+			serverErrors <- apiserver.ListenAndServeTLS("", "")
+		} else {
+			logger.Infof("API listening on %s", apiserver.Addr)
+			serverErrors <- apiserver.ListenAndServe()
+		}
 		logger.Infof("stopping API server")
 	}()
 
+	// Start the server redirecting the requests over plain HTTP to HTTPS, if enabled, which answers the ACME
+	// challenges as well when the certificates are obtained from Let's Encrypt
+	if apiserver.TLSConfig != nil && cfg.Web.TLS.RedirectHost != "" {
+		redirect := redirectToHTTPS(cfg.Web.APIHost)
+		if acmeHandler != nil {
+			redirect = acmeHandler(redirect)
+		}
+
+		redirectserver := http.Server{
+			Addr:              cfg.Web.TLS.RedirectHost,
+			Handler:           redirect,
+			ReadTimeout:       cfg.Web.ReadTimeout,
+			ReadHeaderTimeout: cfg.Web.ReadTimeout,
+			WriteTimeout:      cfg.Web.WriteTimeout,
+		}
+
+		go func() {
+			logger.Infof("HTTPS redirect listening on %s", redirectserver.Addr)
+			serverErrors <- redirectserver.ListenAndServe()
+			logger.Infof("stopping HTTPS redirect server")
+		}()
+		defer func() {
+			_ = redirectserver.Close()
+		}()
+	}
+
+	// Start the debug server, if enabled, serving the debug variables to the administrators only
+	if cfg.Web.DebugHost != "" {
+		debugmux := http.NewServeMux()
+
+		err = registerDebugVars(debugmux, cfg.Admin.Token)
+		if err != nil {
+			logger.WithError(err).Error("error registering the debug variables")
+			return fmt.Errorf("registering the debug variables: %w", err)
+		}
+
+		// Serve the profiles of the runtime, if enabled, to the administrators only
+		if cfg.Web.DebugProfiling {
+			err = registerProfiler(debugmux, cfg.Admin.Token)
+			if err != nil {
+				logger.WithError(err).Error("error registering the profiler")
+				return fmt.Errorf("registering the profiler: %w", err)
+			}
+		}
+
+		debugserver := http.Server{
+			Addr:              cfg.Web.DebugHost,
+			Handler:           debugmux,
+			ReadHeaderTimeout: cfg.Web.ReadTimeout,
+		}
+
+		go func() {
+			logger.Infof("debug listening on %s", debugserver.Addr)
+			serverErrors <- debugserver.ListenAndServe()
+			logger.Infof("stopping debug server")
+		}()
+		defer func() {
+			_ = debugserver.Close()
+		}()
+	}
+
 	// Waiting for shutdown signal or POSIX signals
 	select {
 	case err := <-serverErrors:
@@ -182,3 +481,274 @@ func run() error {
 
 	return nil
 }
+
+// openDatabase connects to the database selected by the configuration (SQLite or PostgreSQL) and to its read-only
+// replicas, and returns the AppDatabase built on them, together with the underlying connections that must be closed on
+// shutdown. The replicas are files kept in sync with the primary one for SQLite, and the URLs of the standby servers for
+// PostgreSQL.
+func openDatabase(cfg WebAPIConfiguration) (database.AppDatabase, []*sql.DB, error) {
+	var dbconns []*sql.DB
+
+	switch cfg.DB.Driver {
+	case "sqlite3":
+		sqliteCfg := database.SQLiteConfig{
+			JournalMode: cfg.DB.JournalMode,
+			BusyTimeout: cfg.DB.BusyTimeout,
+			Synchronous: cfg.DB.Synchronous,
+		}
+		dbconn, err := sql.Open("sqlite3", sqliteCfg.DataSourceName(cfg.DB.Filename))
+		if err != nil {
+			return nil, nil, fmt.Errorf("opening SQLite: %w", err)
+		}
+		dbconns = append(dbconns, dbconn)
+
+		// the journal mode is a property of the file, which
+		// is set through the primary connection only
+		replicaCfg := database.SQLiteConfig{
+			BusyTimeout: cfg.DB.BusyTimeout,
+			QueryOnly:   true,
+		}
+		for _, filename := range cfg.DB.Replicas {
+			dbconn, err = sql.Open("sqlite3", replicaCfg.DataSourceName(filename))
+			if err != nil {
+				closeDatabase(dbconns)
+				return nil, nil, fmt.Errorf("opening SQLite replica %s: %w", filename, err)
+			}
+			dbconns = append(dbconns, dbconn)
+		}
+
+		db, err := database.New(dbconns[0], dbconns[1:]...)
+		if err != nil {
+			closeDatabase(dbconns)
+			return nil, nil, err
+		}
+		return db, dbconns, nil
+	case "postgres":
+		for _, url := range append([]string{cfg.DB.URL}, cfg.DB.Replicas...) {
+			dbconn, err := sql.Open("postgres", url)
+			if err != nil {
+				closeDatabase(dbconns)
+				return nil, nil, fmt.Errorf("opening PostgreSQL: %w", err)
+			}
+			dbconns = append(dbconns, dbconn)
+		}
+
+		db, err := database.NewPostgres(dbconns[0], dbconns[1:]...)
+		if err != nil {
+			closeDatabase(dbconns)
+			return nil, nil, err
+		}
+		return db, dbconns, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown database driver %q", cfg.DB.Driver)
+	}
+}
+
+// openStorage creates the storage of the photos selected by the configuration (the local disk or an S3 compatible
+// object storage).
+func openStorage(cfg WebAPIConfiguration) (storage.BlobStorage, error) {
+	switch cfg.Storage.Backend {
+	case "disk":
+		return storage.NewDisk(cfg.Storage.Root, api.PhotoUrlPrefix)
+	case "s3":
+		return storage.NewS3(storage.S3Config{
+			Endpoint:  cfg.Storage.Bucket.Endpoint,
+			Region:    cfg.Storage.Bucket.Region,
+			Bucket:    cfg.Storage.Bucket.Name,
+			Prefix:    cfg.Storage.Bucket.Prefix,
+			AccessKey: cfg.Storage.Bucket.AccessKey,
+			SecretKey: cfg.Storage.Bucket.SecretKey,
+			PublicURL: cfg.Storage.Bucket.PublicURL,
+		}, api.PhotoUrlPrefix, &http.Client{Timeout: 30 * time.Second})
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", cfg.Storage.Backend)
+	}
+}
+
+// openPushers creates the push services enabled by the configuration, by the platform of the devices they reach:
+// Firebase Cloud Messaging if the key of a service account is given, and the Apple Push Notification service if a
+// signing key is given. The keys are read from their files.
+func openPushers(cfg WebAPIConfiguration) (map[string]push.Pusher, error) {
+	pushers := make(map[string]push.Pusher)
+	client := &http.Client{Timeout: 30 * time.Second}
+
+	if cfg.Push.FCM.Credentials != "" {
+		credentials, err := os.ReadFile(cfg.Push.FCM.Credentials)
+		if err != nil {
+			return nil, fmt.Errorf("reading the FCM credentials: %w", err)
+		}
+		pushers[push.PlatformFCM], err = push.NewFCM(push.FCMConfig{
+			Credentials: credentials,
+			ProjectID:   cfg.Push.FCM.ProjectID,
+			Endpoint:    cfg.Push.FCM.Endpoint,
+		}, client)
+		if err != nil {
+			return nil, fmt.Errorf("creating the FCM pusher: %w", err)
+		}
+	}
+
+	if cfg.Push.APNS.Key != "" {
+		key, err := os.ReadFile(cfg.Push.APNS.Key)
+		if err != nil {
+			return nil, fmt.Errorf("reading the APNs signing key: %w", err)
+		}
+		pushers[push.PlatformAPNs], err = push.NewAPNs(push.APNsConfig{
+			Key:      key,
+			KeyID:    cfg.Push.APNS.KeyID,
+			TeamID:   cfg.Push.APNS.TeamID,
+			Topic:    cfg.Push.APNS.Topic,
+			Sandbox:  cfg.Push.APNS.Sandbox,
+			Endpoint: cfg.Push.APNS.Endpoint,
+		}, client)
+		if err != nil {
+			return nil, fmt.Errorf("creating the APNs pusher: %w", err)
+		}
+	}
+
+	return pushers, nil
+}
+
+// openClassifier creates the classifier telling whether the uploaded photos are unsafe, posting them to the external
+// service at the configured url. If no url is configured, nil is returned and the photos are not checked.
+func openClassifier(cfg WebAPIConfiguration) (moderation.Classifier, error) {
+	if cfg.Photos.Classifier.URL == "" {
+		return nil, nil
+	}
+
+	classifier, err := moderation.NewHTTP(moderation.HTTPConfig{
+		Endpoint:  cfg.Photos.Classifier.URL,
+		Token:     cfg.Photos.Classifier.Token,
+		Threshold: cfg.Photos.Classifier.Threshold,
+	}, &http.Client{Timeout: 30 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	return classifier, nil
+}
+
+// openFramer creates the extractor of the posters of the uploaded videos, running the configured ffmpeg executable. If
+// no executable is configured, or it cannot be found, nil is returned and the videos have no poster.
+func openFramer(cfg WebAPIConfiguration, logger logrus.FieldLogger) video.Framer {
+	if cfg.Videos.Ffmpeg == "" {
+		return nil
+	}
+
+	framer, err := video.NewFFmpeg(cfg.Videos.Ffmpeg)
+	if err != nil {
+		logger.WithError(err).Warn("ffmpeg not found, the uploaded videos have no poster")
+		return nil
+	}
+
+	return framer
+}
+
+// openAuthProviders creates the identity providers enabled by the configuration, by the name under which their users
+// are linked: an OpenID Connect provider if its issuer is given, whose discovery document is read right away, and
+// GitHub if the client id of an OAuth app is given.
+func openAuthProviders(cfg WebAPIConfiguration) (map[string]auth.Provider, error) {
+	providers := make(map[string]auth.Provider)
+	client := &http.Client{Timeout: 30 * time.Second}
+
+	if cfg.Auth.OIDC.Issuer != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		var err error
+		providers[auth.ProviderOIDC], err = auth.NewOIDC(ctx, auth.OIDCConfig{
+			Issuer:       cfg.Auth.OIDC.Issuer,
+			ClientID:     cfg.Auth.OIDC.ClientID,
+			ClientSecret: cfg.Auth.OIDC.ClientSecret,
+			RedirectURL:  cfg.Auth.OIDC.RedirectURL,
+		}, client)
+		if err != nil {
+			return nil, fmt.Errorf("creating the OIDC provider: %w", err)
+		}
+	}
+
+	if cfg.Auth.Github.ClientID != "" {
+		var err error
+		providers[auth.ProviderGitHub], err = auth.NewGitHub(auth.GitHubConfig{
+			ClientID:     cfg.Auth.Github.ClientID,
+			ClientSecret: cfg.Auth.Github.ClientSecret,
+			RedirectURL:  cfg.Auth.Github.RedirectURL,
+			Endpoint:     cfg.Auth.Github.Endpoint,
+			APIEndpoint:  cfg.Auth.Github.APIEndpoint,
+		}, client)
+		if err != nil {
+			return nil, fmt.Errorf("creating the GitHub provider: %w", err)
+		}
+	}
+
+	return providers, nil
+}
+
+// openMailer creates the mailer selected by the configuration: none (the digests are not sent), an SMTP server, or the
+// logger, which writes the emails to the log instead of sending them.
+func openMailer(cfg WebAPIConfiguration, logger logrus.FieldLogger) (mail.Mailer, error) {
+	switch cfg.Mail.Backend {
+	case "":
+		return nil, nil
+	case "smtp":
+		return mail.NewSMTP(mail.SMTPConfig{
+			Host:     cfg.Mail.SMTP.Host,
+			Port:     cfg.Mail.SMTP.Port,
+			Username: cfg.Mail.SMTP.Username,
+			Password: cfg.Mail.SMTP.Password,
+			From:     cfg.Mail.From,
+		})
+	case "log":
+		return mail.NewLog(logger.WithField("component", "mail")), nil
+	default:
+		return nil, fmt.Errorf("unknown mail backend %q", cfg.Mail.Backend)
+	}
+}
+
+// openCache creates the cache selected by the configuration: none (the counters are always read from the database), or
+// a Redis server.
+func openCache(cfg WebAPIConfiguration) (*cache.Redis, error) {
+	switch cfg.Cache.Backend {
+	case "":
+		return nil, nil
+	case "redis":
+		if cfg.Cache.RedisURL == "" {
+			return nil, errors.New("the url of the redis server is required")
+		}
+		return cache.NewRedis(cfg.Cache.RedisURL, cfg.Cache.Prefix)
+	default:
+		return nil, fmt.Errorf("unknown cache backend %q", cfg.Cache.Backend)
+	}
+}
+
+// openTracer creates the tracer exporting the traces of the requests to the collector of the configuration, or returns
+// nil if there is none. The headers sent to the collector are given as `Name=Value`.
+func openTracer(cfg WebAPIConfiguration, logger logrus.FieldLogger) (*tracing.Tracer, error) {
+	if cfg.Tracing.Endpoint == "" {
+		return nil, nil
+	}
+
+	headers := make(map[string]string, len(cfg.Tracing.Headers))
+	for _, header := range cfg.Tracing.Headers {
+		name, value, ok := strings.Cut(header, "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid header %q, expected Name=Value", header)
+		}
+		headers[name] = value
+	}
+
+	return tracing.New(tracing.Config{
+		Endpoint:    cfg.Tracing.Endpoint,
+		Headers:     headers,
+		ServiceName: cfg.Tracing.ServiceName,
+		SampleRatio: cfg.Tracing.SampleRatio,
+		Interval:    cfg.Tracing.Interval,
+		Logger:      logger.WithField("component", "tracing"),
+	})
+}
+
+// closeDatabase closes the connections returned by openDatabase
+func closeDatabase(dbconns []*sql.DB) {
+	for _, dbconn := range dbconns {
+		_ = dbconn.Close()
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/doc"
+	"gopkg.in/yaml.v2"
+	"io/fs"
+	"net/http"
+	"strings"
+)
+
+// registerAPIDocs serves the OpenAPI specification of the API, in YAML at /openapi.yaml and in JSON at
+// /openapi.json, and the page exploring it under /docs/, leaving the other requests to `hdl`.
+func registerAPIDocs(hdl http.Handler) (http.Handler, error) {
+	var spec interface{}
+	err := yaml.Unmarshal(doc.OpenAPI, &spec)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing the OpenAPI specification: %w", err)
+	}
+
+	specJSON, err := json.Marshal(jsonValue(spec))
+	if err != nil {
+		return nil, fmt.Errorf("error converting the OpenAPI specification to JSON: %w", err)
+	}
+
+	explorerDirectory, err := fs.Sub(doc.Explorer, "explorer")
+	if err != nil {
+		return nil, fmt.Errorf("error embedding the API explorer: %w", err)
+	}
+	explorer := http.StripPrefix("/docs/", http.FileServer(http.FS(explorerDirectory)))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			hdl.ServeHTTP(w, r)
+			return
+		}
+
+		switch {
+		case r.URL.Path == "/openapi.yaml":
+			w.Header().Set("Content-Type", "application/yaml")
+			_, _ = w.Write(doc.OpenAPI)
+		case r.URL.Path == "/openapi.json":
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write(specJSON)
+		case r.URL.Path == "/docs":
+			http.Redirect(w, r, "/docs/", http.StatusMovedPermanently)
+		case strings.HasPrefix(r.URL.Path, "/docs/"):
+			explorer.ServeHTTP(w, r)
+		default:
+			hdl.ServeHTTP(w, r)
+		}
+	}), nil
+}
+
+// jsonValue converts the maps decoded from YAML, whose keys may be of any type, into maps with string keys, which can
+// be encoded in JSON.
+func jsonValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			m[fmt.Sprint(key)] = jsonValue(value)
+		}
+		return m
+	case []interface{}:
+		for i, value := range v {
+			v[i] = jsonValue(value)
+		}
+		return v
+	default:
+		return v
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"errors"
+	"expvar"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/api"
+	"net/http"
+	"net/http/pprof"
+)
+
+// registerDebugVars serves the debug variables (expvar: the memory statistics, the command line and the ones of the
+// backend) at /debug/vars on the debug server, to the requests carrying the token of the administrators only, since the
+// command line may hold the secrets passed as flags. The debug server cannot be enabled without the token.
+func registerDebugVars(mux *http.ServeMux, adminToken string) error {
+	if adminToken == "" {
+		return errors.New("the debug variables require the admin token")
+	}
+
+	mux.Handle("/debug/vars", adminGuard(adminToken, expvar.Handler()))
+
+	return nil
+}
+
+// registerProfiler serves the profiles of the runtime (pprof: CPU, heap, allocations, goroutines, ...) under
+// /debug/pprof/ on the debug server, to the requests carrying the token of the administrators only, since they expose
+// the memory of the process. The profiler cannot be enabled without the token.
+func registerProfiler(mux *http.ServeMux, adminToken string) error {
+	if adminToken == "" {
+		return errors.New("the profiler requires the admin token")
+	}
+
+	// the index serves the named profiles as well (eg. /debug/pprof/heap)
+	mux.Handle("/debug/pprof/", adminGuard(adminToken, http.HandlerFunc(pprof.Index)))
+	mux.Handle("/debug/pprof/cmdline", adminGuard(adminToken, http.HandlerFunc(pprof.Cmdline)))
+	mux.Handle("/debug/pprof/profile", adminGuard(adminToken, http.HandlerFunc(pprof.Profile)))
+	mux.Handle("/debug/pprof/symbol", adminGuard(adminToken, http.HandlerFunc(pprof.Symbol)))
+	mux.Handle("/debug/pprof/trace", adminGuard(adminToken, http.HandlerFunc(pprof.Trace)))
+
+	return nil
+}
+
+// adminGuard serves the requests with `h` if they carry the token of the administrators, refusing the others with 401
+func adminGuard(adminToken string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if api.CheckAdminAuthorization(adminToken, r.Header.Get("Authorization")) != nil {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "the request is not authorized to read the debug information", http.StatusUnauthorized)
+			return
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/database"
+	"github.com/sirupsen/logrus"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+// seedWords are the words the comments of the seed data are made of
+var seedWords = []string{
+	"nice", "photo", "love", "this", "amazing", "view", "sunset", "beach", "what", "a", "great", "shot", "colors",
+	"wow", "where", "is", "it", "so", "cool", "miss", "you", "city", "mountain", "dog", "cat", "food", "friends",
+}
+
+// seedDatabase fills the database with `users` users, together with their photos, follows, likes and comments, all made
+// through the AppDatabase methods used by the API. The data are the same on every run, and running it again on the same
+// database reuses the users while adding new photos, likes and comments. It is meant for development and load tests
+// only.
+func seedDatabase(ctx context.Context, db database.AppDatabase, users int, logger logrus.FieldLogger) error {
+	r := rand.New(rand.NewSource(int64(users)))
+	now := time.Now().UTC().Truncate(time.Second)
+
+	dbUsers := make([]database.DatabaseUser, users)
+
+	for i := range dbUsers {
+		dbUsers[i] = database.DatabaseUserDefault()
+		dbUsers[i].Username = fmt.Sprintf("seed%05d", i)
+
+		err := db.InsertUser(ctx, &dbUsers[i])
+		if err != nil {
+			return fmt.Errorf("inserting user %s: %w", dbUsers[i].Username, err)
+		}
+	}
+
+	// every user follows up to 20 other users
+	for i, dbUser := range dbUsers {
+		for _, j := range seedSample(r, users, 20) {
+			if j == i {
+				continue
+			}
+
+			err := db.InsertFollow(ctx, dbUser, dbUsers[j])
+			if err != nil {
+				return fmt.Errorf("inserting follow: %w", err)
+			}
+		}
+	}
+
+	photos, likes, comments := 0, 0, 0
+
+	// every user uploads up to 5 photos during the last 30 days, each
+	// one liked by up to 10 users and commented up to 3 times
+	for _, dbUser := range dbUsers {
+		for n := r.Intn(6); n > 0; n-- {
+			dbPhoto := database.DatabasePhotoDefault()
+			dbPhoto.User = dbUser
+			dbPhoto.Url = seedPhotoUrl(r)
+			dbPhoto.Date = now.Add(-time.Duration(r.Int63n(int64(30 * 24 * time.Hour)))).Truncate(time.Second)
+
+			err := db.InsertPhoto(ctx, &dbPhoto)
+			if err != nil {
+				return fmt.Errorf("inserting photo: %w", err)
+			}
+			photos++
+
+			for _, j := range seedSample(r, users, 10) {
+				err = db.InsertLike(ctx, dbUsers[j], dbPhoto, database.ReactionLike)
+				if err != nil {
+					return fmt.Errorf("inserting like: %w", err)
+				}
+				likes++
+			}
+
+			for c := r.Intn(4); c > 0; c-- {
+				words := make([]string, 2+r.Intn(6))
+				for k := range words {
+					words[k] = seedWords[r.Intn(len(seedWords))]
+				}
+
+				dbComment := database.DatabaseCommentDefault()
+				dbComment.User = dbUsers[r.Intn(users)]
+				dbComment.Photo = dbPhoto
+				dbComment.Date = dbPhoto.Date.Add(time.Duration(r.Int63n(int64(now.Sub(dbPhoto.Date)) + 1))).Truncate(time.Second)
+				dbComment.CommentBody = strings.Join(words, " ")
+
+				err = db.InsertComment(ctx, &dbComment)
+				if err != nil {
+					return fmt.Errorf("inserting comment: %w", err)
+				}
+				comments++
+			}
+		}
+	}
+
+	logger.Infof("seeded %d users, %d photos, %d likes and %d comments", users, photos, likes, comments)
+
+	return nil
+}
+
+// seedSample returns up to `limit` distinct random numbers in [0, n)
+func seedSample(r *rand.Rand, n int, limit int) []int {
+	if n < limit {
+		limit = n
+	}
+
+	return r.Perm(n)[:r.Intn(limit+1)]
+}
+
+// seedPhotoUrl returns a data URL of a square SVG image filled with a random color, which the web UI shows like an
+// uploaded photo
+func seedPhotoUrl(r *rand.Rand) string {
+	svg := fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" width="600" height="600"><rect width="600" height="600" fill="#%06x"/></svg>`, r.Intn(0x1000000))
+
+	return "data:image/svg+xml;base64," + base64.StdEncoding.EncodeToString([]byte(svg))
+}
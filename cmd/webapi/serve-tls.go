@@ -0,0 +1,71 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/acme/autocert"
+	"net"
+	"net/http"
+)
+
+// tlsConfiguration returns the TLS configuration of the API server, with the certificate and the key read from the
+// files of the configuration, or obtained from Let's Encrypt for the domains of the configuration, together with the
+// handler answering the ACME challenges over HTTP, if any. It returns nil if the API is served over plain HTTP (eg.
+// behind a reverse proxy terminating TLS).
+func tlsConfiguration(cfg WebAPIConfiguration) (*tls.Config, func(http.Handler) http.Handler, error) {
+	files := cfg.Web.TLS.Cert != "" || cfg.Web.TLS.Key != ""
+	domains := len(cfg.Web.TLS.AutocertDomains) > 0
+
+	switch {
+	case files && domains:
+		return nil, nil, errors.New("the certificate files and the autocert domains are mutually exclusive")
+	case files:
+		if cfg.Web.TLS.Cert == "" || cfg.Web.TLS.Key == "" {
+			return nil, nil, errors.New("both the certificate and the key files are required")
+		}
+
+		certificate, err := tls.LoadX509KeyPair(cfg.Web.TLS.Cert, cfg.Web.TLS.Key)
+		if err != nil {
+			return nil, nil, fmt.Errorf("loading the certificate: %w", err)
+		}
+
+		return &tls.Config{
+			MinVersion:   tls.VersionTLS12,
+			Certificates: []tls.Certificate{certificate},
+		}, nil, nil
+	case domains:
+		manager := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(cfg.Web.TLS.AutocertDomains...),
+			Cache:      autocert.DirCache(cfg.Web.TLS.AutocertCache),
+			Email:      cfg.Web.TLS.AutocertEmail,
+		}
+
+		tlsConfig := manager.TLSConfig()
+		tlsConfig.MinVersion = tls.VersionTLS12
+
+		return tlsConfig, manager.HTTPHandler, nil
+	default:
+		return nil, nil, nil
+	}
+}
+
+// redirectToHTTPS returns the handler redirecting the requests over plain HTTP to the same url over HTTPS, on the port
+// the API server listens on (`apiHost`).
+func redirectToHTTPS(apiHost string) http.Handler {
+	_, port, _ := net.SplitHostPort(apiHost)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = r.Host
+		}
+
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	})
+}
@@ -0,0 +1,14 @@
+// Package doc contains the OpenAPI specification of the API and the page exploring it, for embedding
+package doc
+
+import "embed"
+
+// OpenAPI is the OpenAPI specification of the API, in YAML
+//
+//go:embed "api.yaml"
+var OpenAPI []byte
+
+// Explorer contains the page rendering the OpenAPI specification, where the requests to the API can be tried out
+//
+//go:embed "explorer/*"
+var Explorer embed.FS
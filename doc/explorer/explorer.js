@@ -0,0 +1,248 @@
+// The explorer renders the OpenAPI specification served by the backend, grouping the operations by tag, and sends
+// the requests tried out to the backend serving it
+
+const methods = ["get", "post", "put", "patch", "delete"];
+
+// el creates an element with the given attributes and children, where the strings are added as text
+function el(tag, attrs, ...children) {
+	const node = document.createElement(tag);
+	for (const [name, value] of Object.entries(attrs || {})) {
+		node.setAttribute(name, value);
+	}
+	for (const child of children) {
+		if (child !== null && child !== undefined) {
+			node.append(child);
+		}
+	}
+	return node;
+}
+
+// resolve follows the reference of an object of the specification, if it has one
+function resolve(spec, obj) {
+	while (obj && obj.$ref) {
+		obj = obj.$ref.replace(/^#\//, "").split("/").reduce((o, key) => o && o[key], spec);
+	}
+	return obj;
+}
+
+// example builds an example value of the schema, from the examples of its properties
+function example(spec, schema, depth) {
+	schema = resolve(spec, schema);
+	if (!schema || depth > 5) {
+		return null;
+	}
+	if (schema.example !== undefined) {
+		return schema.example;
+	}
+	if (schema.type === "array") {
+		const item = example(spec, schema.items, depth + 1);
+		return item === null ? [] : [item];
+	}
+	if (schema.type === "object" || schema.properties) {
+		const obj = {};
+		for (const [name, property] of Object.entries(schema.properties || {})) {
+			obj[name] = example(spec, property, depth + 1);
+		}
+		return obj;
+	}
+	if (schema.enum) {
+		return schema.enum[0];
+	}
+	return {string: "", integer: 0, number: 0, boolean: false}[schema.type] ?? null;
+}
+
+// parametersTable lists the parameters of the operation, with the inputs to fill them when trying it out
+function parametersTable(parameters, inputs) {
+	const table = el("table", {}, el("tr", {}, el("th", {}, "Name"), el("th", {}, "In"), el("th", {}, "Description"), el("th", {}, "Value")));
+	for (const parameter of parameters) {
+		const input = el("input", {type: "text", placeholder: parameter.required ? "required" : ""});
+		inputs.push({parameter, input});
+		table.append(el("tr", {},
+			el("td", {}, el("code", {}, parameter.name)),
+			el("td", {}, parameter.in),
+			el("td", {class: "description"}, parameter.description || ""),
+			el("td", {}, input),
+		));
+	}
+	return table;
+}
+
+// bodyEditor returns the inputs of the body of the request, and a function reading them into the body to send
+function bodyEditor(spec, requestBody) {
+	const content = requestBody.content || {};
+	if (content["application/json"]) {
+		const textarea = el("textarea", {spellcheck: "false"});
+		textarea.value = JSON.stringify(example(spec, content["application/json"].schema, 0), null, 2);
+		return {
+			node: textarea,
+			read: () => ({body: textarea.value, type: "application/json"}),
+		};
+	}
+	if (content["multipart/form-data"]) {
+		const schema = resolve(spec, content["multipart/form-data"].schema);
+		const fields = [];
+		const node = el("div", {});
+		for (const [name, property] of Object.entries(schema.properties || {})) {
+			const input = el("input", {type: property.format === "binary" ? "file" : "text"});
+			fields.push({name, input});
+			node.append(el("label", {}, el("code", {}, name), " ", input), el("br", {}));
+		}
+		return {
+			node,
+			read: () => {
+				const form = new FormData();
+				for (const {name, input} of fields) {
+					if (input.type === "file" && input.files.length > 0) {
+						form.append(name, input.files[0]);
+					} else if (input.type !== "file" && input.value !== "") {
+						form.append(name, input.value);
+					}
+				}
+				return {body: form};
+			},
+		};
+	}
+	return null;
+}
+
+// send tries out the operation, with the values given in the inputs
+async function send(base, path, method, inputs, editor, output) {
+	const query = new URLSearchParams();
+	const headers = {};
+	for (const {parameter, input} of inputs) {
+		if (input.value === "") {
+			continue;
+		}
+		if (parameter.in === "path") {
+			path = path.replace("{" + parameter.name + "}", encodeURIComponent(input.value));
+		} else if (parameter.in === "query") {
+			query.append(parameter.name, input.value);
+		} else if (parameter.in === "header") {
+			headers[parameter.name] = input.value;
+		}
+	}
+
+	const token = document.getElementById("token").value;
+	if (token !== "") {
+		headers["Authorization"] = "Bearer " + token;
+	}
+
+	const init = {method: method.toUpperCase(), headers};
+	if (editor) {
+		const {body, type} = editor.read();
+		init.body = body;
+		if (type) {
+			headers["Content-Type"] = type;
+		}
+	}
+
+	const url = ".." + base + path + (query.toString() === "" ? "" : "?" + query.toString());
+	output.textContent = "Sending " + init.method + " " + path + "...";
+
+	try {
+		const response = await fetch(url, init);
+		let text = await response.text();
+		try {
+			text = JSON.stringify(JSON.parse(text), null, 2);
+		} catch (e) {
+			// not a JSON body, shown as it is
+		}
+		output.textContent = response.status + " " + response.statusText + "\n" +
+			"X-Request-ID: " + (response.headers.get("X-Request-ID") || "") + "\n\n" + text;
+	} catch (e) {
+		output.textContent = "The request failed: " + e;
+	}
+}
+
+// operation renders an operation of the specification, with the form trying it out
+function operation(spec, path, item, method, op) {
+	const parameters = [...(item.parameters || []), ...(op.parameters || [])].map((p) => resolve(spec, p));
+	const inputs = [];
+	const body = el("div", {});
+
+	if (op.description) {
+		body.append(el("p", {class: "description"}, op.description));
+	}
+	if (parameters.length > 0) {
+		body.append(el("h4", {}, "Parameters"), parametersTable(parameters, inputs));
+	}
+
+	let editor = null;
+	if (op.requestBody) {
+		const requestBody = resolve(spec, op.requestBody);
+		editor = bodyEditor(spec, requestBody);
+		body.append(el("h4", {}, "Request body"), el("p", {class: "description"}, requestBody.description || ""));
+		if (editor) {
+			body.append(editor.node);
+		}
+	}
+
+	const responses = el("table", {}, el("tr", {}, el("th", {}, "Status"), el("th", {}, "Description")));
+	for (const [status, response] of Object.entries(op.responses || {})) {
+		responses.append(el("tr", {},
+			el("td", {}, status),
+			el("td", {class: "description"}, (resolve(spec, response) || {}).description || ""),
+		));
+	}
+	body.append(el("h4", {}, "Responses"), responses);
+
+	const output = el("pre", {class: "response"});
+	const button = el("button", {type: "button"}, "Try it out");
+	const servers = item.servers || spec.servers || [];
+	const base = servers.length > 0 ? servers[0].url.replace(/\/$/, "") : "";
+	button.addEventListener("click", () => send(base, path, method, inputs, editor, output));
+	body.append(button, output);
+
+	return el("details", {class: "operation" + (op.deprecated ? " deprecated" : "")},
+		el("summary", {},
+			el("span", {class: "method " + method}, method),
+			el("span", {class: "path"}, path),
+			" ", op.summary || "",
+		),
+		body,
+	);
+}
+
+// render renders the whole specification, an operation after the other under the first of their tags
+function render(spec) {
+	const main = document.getElementById("spec");
+	main.textContent = "";
+
+	document.getElementById("title").textContent = spec.info.title + " " + spec.info.version;
+	document.title = spec.info.title + " API";
+	main.append(el("p", {class: "description"}, spec.info.description || ""));
+
+	const sections = new Map();
+	for (const tag of spec.tags || []) {
+		sections.set(tag.name, el("section", {}, el("h2", {}, tag.name), el("p", {}, tag.description || "")));
+	}
+
+	for (const [path, item] of Object.entries(spec.paths || {})) {
+		for (const method of methods) {
+			const op = item[method];
+			if (!op) {
+				continue;
+			}
+			const tag = (op.tags || ["Other"])[0];
+			if (!sections.has(tag)) {
+				sections.set(tag, el("section", {}, el("h2", {}, tag)));
+			}
+			sections.get(tag).append(operation(spec, path, item, method, op));
+		}
+	}
+
+	for (const section of sections.values()) {
+		main.append(section);
+	}
+}
+
+const token = document.getElementById("token");
+token.value = sessionStorage.getItem("token") || "";
+token.addEventListener("change", () => sessionStorage.setItem("token", token.value));
+
+fetch("../openapi.json")
+	.then((response) => response.json())
+	.then(render)
+	.catch((e) => {
+		document.getElementById("spec").textContent = "Can't load the specification: " + e;
+	});
@@ -0,0 +1,77 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/api/reqcontext"
+	"github.com/gofrs/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// requestIdHeader is the header carrying the id of the request, which a client (or a proxy in front of the server)
+// may send to find its requests in the logs, and which is sent back in every response
+const requestIdHeader = "X-Request-ID"
+
+// requestId returns the id sent by the client with the request, if it is a valid UUID, or a new one otherwise
+func requestId(r *http.Request) (uuid.UUID, error) {
+	id, err := uuid.FromString(r.Header.Get(requestIdHeader))
+
+	if err == nil && id != uuid.Nil {
+		return id, nil
+	}
+
+	return uuid.NewV4()
+}
+
+// statusRecorder records the status and the size of the response written through it, for the access log
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	size   int
+}
+
+func (rec *statusRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *statusRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+
+	n, err := rec.ResponseWriter.Write(b)
+	rec.size += n
+
+	return n, err
+}
+
+// Unwrap returns the underlying http.ResponseWriter, so that http.ResponseController can still flush the event
+// streams and change their deadlines
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// logRequest writes the entry of the access log of the request, started at `start`, once it has been served; it must
+// be deferred before calling the handler, with the context that the request fills as it is authenticated
+func (rt *_router) logRequest(rec *statusRecorder, r *http.Request, ctx *reqcontext.RequestContext, start time.Time) {
+	status := rec.status
+
+	// a handler which wrote nothing replied with 200
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	ctx.Logger.WithFields(logrus.Fields{
+		"method":  r.Method,
+		"path":    r.URL.Path,
+		"status":  status,
+		"bytes":   rec.size,
+		"latency": time.Since(start).String(),
+		"user":    ctx.UserId,
+	}).Info("request served")
+}
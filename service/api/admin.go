@@ -0,0 +1,361 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/api/reqcontext"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/database"
+	"github.com/julienschmidt/httprouter"
+)
+
+func (rt *_router) backupDatabase(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// authenticate the administrator performing the action
+	err := CheckAdminAuthorization(rt.adminToken, r.Header.Get("Authorization"))
+
+	if err != nil {
+		writeError(w, err, http.StatusUnauthorized)
+		return
+	}
+
+	backup := BackupDefault()
+
+	backup.Date = time.Now().UTC().Truncate(time.Second)
+
+	// the request id keeps apart the backups made in the same second
+	backup.Path = filepath.Join(rt.backupDir, "wasaphoto-"+backup.Date.Format("20060102-150405")+"-"+ctx.ReqUUID.String()+".db")
+
+	// save a snapshot of the database while it keeps serving the other requests
+	err = rt.db.Backup(ctx.Context, backup.Path)
+
+	if errors.Is(err, database.ErrBackupUnsupported) {
+		writeError(w, ErrBackupUnsupported, http.StatusNotImplemented)
+		return
+	}
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	ctx.Logger.WithField("path", backup.Path).Info("database backup saved")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated) // 201
+
+	// return the newly created backup
+	_ = json.NewEncoder(w).Encode(backup)
+}
+
+func (rt *_router) getAuditLog(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// authenticate the administrator performing the action
+	err := CheckAdminAuthorization(rt.adminToken, r.Header.Get("Authorization"))
+
+	if err != nil {
+		writeError(w, err, http.StatusUnauthorized)
+		return
+	}
+
+	// get the user whose actions are requested from the query, if any
+	actor, code, err := GetCursorFromQuery("actor", r)
+
+	if err != nil {
+		writeError(w, ErrInvalidActor, code)
+		return
+	}
+
+	// get the action requested from the query, if any
+	action := r.URL.Query().Get("action")
+
+	switch action {
+	case "", database.AuditDeletePhoto, database.AuditDeleteComment, database.AuditBan, database.AuditUnban,
+		database.AuditUnfollow, database.AuditChangeUsername, database.AuditDeleteUser, database.AuditAdminDeletePhoto,
+		database.AuditAdminDeleteComment, database.AuditSuspendUser, database.AuditUnsuspendUser, database.AuditBlockTerm,
+		database.AuditUnblockTerm, database.AuditApproveComment, database.AuditRejectComment, database.AuditUnflagPhoto,
+		database.AuditShadowBanUser, database.AuditUnshadowBanUser, database.AuditEraseUser, database.AuditReserveName,
+		database.AuditUnreserveName:
+	default:
+		writeError(w, ErrInvalidAction, http.StatusBadRequest)
+		return
+	}
+
+	// get the pagination parameters from the query
+	limit, _, code, err := GetPageFromQuery(r)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	before, code, err := GetCursorFromQuery("before", r)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	// get the page of the audit log from the database
+	dbAuditLog, err := rt.db.GetAuditLog(ctx.Context, actor, action, limit, before)
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	auditLog := AuditLogFromDatabaseAuditLog(dbAuditLog)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK) // 200
+
+	// return the audit log
+	_ = json.NewEncoder(w).Encode(auditLog)
+}
+
+func (rt *_router) getAdminUsers(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// authenticate the administrator performing the action
+	err := CheckAdminAuthorization(rt.adminToken, r.Header.Get("Authorization"))
+
+	if err != nil {
+		writeError(w, err, http.StatusUnauthorized)
+		return
+	}
+
+	// get the pagination parameters from the query
+	limit, after, code, err := GetPageFromQuery(r)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	// get the page of the users whose username contains the
+	// query from the database, deactivated and suspended ones
+	// included
+	dbAdminUserList, err := rt.db.GetAdminUserList(ctx.Context, r.URL.Query().Get("q"), limit, after)
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK) // 200
+
+	// return the page of the users
+	_ = json.NewEncoder(w).Encode(AdminUserListFromDatabaseAdminUserList(dbAdminUserList))
+}
+
+func (rt *_router) suspendUser(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// authenticate the administrator performing the action
+	err := CheckAdminAuthorization(rt.adminToken, r.Header.Get("Authorization"))
+
+	if err != nil {
+		writeError(w, err, http.StatusUnauthorized)
+		return
+	}
+
+	// get the user to be suspended from the resource parameter
+	dbUser, code, err := rt.getAdminUserFromParameter(ctx, "user_id", ps)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	// suspend the user, who is hidden and signed
+	// out until the administrators restore them
+	err = rt.db.SuspendUser(ctx.Context, dbUser, time.Now())
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	ctx.Logger.WithField("target", dbUser.Id).Info("user suspended by the administrators")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusNoContent) // 204
+}
+
+func (rt *_router) unsuspendUser(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// authenticate the administrator performing the action
+	err := CheckAdminAuthorization(rt.adminToken, r.Header.Get("Authorization"))
+
+	if err != nil {
+		writeError(w, err, http.StatusUnauthorized)
+		return
+	}
+
+	// get the suspended user from the resource parameter
+	dbUser, code, err := rt.getAdminUserFromParameter(ctx, "user_id", ps)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	// restore the account of the user
+	err = rt.db.UnsuspendUser(ctx.Context, dbUser)
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	ctx.Logger.WithField("target", dbUser.Id).Info("user restored by the administrators")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusNoContent) // 204
+}
+
+func (rt *_router) shadowBanUser(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// authenticate the administrator performing the action
+	err := CheckAdminAuthorization(rt.adminToken, r.Header.Get("Authorization"))
+
+	if err != nil {
+		writeError(w, err, http.StatusUnauthorized)
+		return
+	}
+
+	// get the user to be shadow banned from the resource parameter
+	dbUser, code, err := rt.getAdminUserFromParameter(ctx, "user_id", ps)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	// shadow ban the user, whose photos and comments are
+	// hidden to everyone else without them knowing it
+	err = rt.db.ShadowBanUser(ctx.Context, dbUser)
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	ctx.Logger.WithField("target", dbUser.Id).Info("user shadow banned by the administrators")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusNoContent) // 204
+}
+
+func (rt *_router) unshadowBanUser(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// authenticate the administrator performing the action
+	err := CheckAdminAuthorization(rt.adminToken, r.Header.Get("Authorization"))
+
+	if err != nil {
+		writeError(w, err, http.StatusUnauthorized)
+		return
+	}
+
+	// get the shadow banned user from the resource parameter
+	dbUser, code, err := rt.getAdminUserFromParameter(ctx, "user_id", ps)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	// show the photos and the comments of the user again
+	err = rt.db.UnshadowBanUser(ctx.Context, dbUser)
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	ctx.Logger.WithField("target", dbUser.Id).Info("user shadow ban lifted by the administrators")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusNoContent) // 204
+}
+
+func (rt *_router) forceDeletePhoto(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// authenticate the administrator performing the action
+	err := CheckAdminAuthorization(rt.adminToken, r.Header.Get("Authorization"))
+
+	if err != nil {
+		writeError(w, err, http.StatusUnauthorized)
+		return
+	}
+
+	// get the photo to be deleted from the resource parameter
+	photoId, err := strconv.ParseUint(ps.ByName("photo_id"), 10, 32)
+
+	if err != nil {
+		writeError(w, ErrPageNotFound, http.StatusNotFound)
+		return
+	}
+
+	// remove the photo from the database, whoever owns it
+	dbPhoto, err := rt.db.ForceDeletePhoto(ctx.Context, uint32(photoId))
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	// remove the file of the photo, the poster of a video and the original
+	// of an edited photo, if they were uploaded to the storage; the photo
+	// is already gone, so a failure is only logged
+	rt.deletePhotoFiles(ctx, dbPhoto)
+
+	ctx.Logger.WithField("photo", dbPhoto.Id).Info("photo deleted by the administrators")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusNoContent) // 204
+}
+
+func (rt *_router) forceDeleteComment(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// authenticate the administrator performing the action
+	err := CheckAdminAuthorization(rt.adminToken, r.Header.Get("Authorization"))
+
+	if err != nil {
+		writeError(w, err, http.StatusUnauthorized)
+		return
+	}
+
+	// get the comment to be deleted from the resource parameter
+	commentId, err := strconv.ParseUint(ps.ByName("comment_id"), 10, 32)
+
+	if err != nil {
+		writeError(w, ErrPageNotFound, http.StatusNotFound)
+		return
+	}
+
+	// remove the comment from the database, whoever wrote it
+	err = rt.db.ForceDeleteComment(ctx.Context, uint32(commentId))
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	ctx.Logger.WithField("comment", commentId).Info("comment deleted by the administrators")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusNoContent) // 204
+}
+
+// getAdminUserFromParameter returns the user whose id is the given resource parameter, whether they are active,
+// deactivated or suspended; the user is not found (404) if the parameter is not a valid id
+func (rt *_router) getAdminUserFromParameter(ctx reqcontext.RequestContext, parameter string, ps httprouter.Params) (database.DatabaseUser, int, error) {
+	userId, err := strconv.ParseUint(ps.ByName(parameter), 10, 32)
+
+	if err != nil || userId == 0 {
+		return database.DatabaseUserDefault(), http.StatusNotFound, ErrPageNotFound
+	}
+
+	dbUser, err := rt.db.GetDatabaseUser(ctx.Context, uint32(userId))
+
+	if err != nil {
+		return dbUser, http.StatusInternalServerError, err
+	}
+
+	return dbUser, -1, nil
+}
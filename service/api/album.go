@@ -0,0 +1,374 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/api/reqcontext"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/database"
+	"github.com/julienschmidt/httprouter"
+)
+
+// maxAlbumNameLength is the maximum number of characters of the name of an album
+const maxAlbumNameLength = 64
+
+// validAlbumName returns the name of the album without the surrounding
+// spaces, and whether it is neither empty nor too long
+func validAlbumName(name string) (string, bool) {
+	name = strings.TrimSpace(name)
+	length := utf8.RuneCountInString(name)
+
+	return name, length > 0 && length <= maxAlbumNameLength
+}
+
+func (rt *_router) getAlbums(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// get the user authenticated by the bearer token
+	userId, err := GetAuthenticatedUserId(ctx)
+
+	if err != nil {
+		writeError(w, err, http.StatusUnauthorized)
+		return
+	}
+
+	// get the user performing the action
+	dbUser, err := rt.db.GetDatabaseUser(ctx.Context, userId)
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	// get the owner of the albums from the resource parameter
+	profileUser, code, err := rt.GetUserFromParameter(ctx, "uname", r, ps)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	// check whether the owner of the albums
+	// has banned the user performing the action
+	checkBan, err := rt.db.CheckBan(ctx.Context, profileUser.UserIntoDatabaseUser(), dbUser)
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	if checkBan {
+		writeError(w, ErrBannedUser, http.StatusUnauthorized)
+		return
+	}
+
+	// get the album list from the database
+	dbAlbumList, err := rt.db.GetAlbums(ctx.Context, profileUser.UserIntoDatabaseUser(), dbUser)
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	albumList := AlbumListFromDatabaseAlbumList(dbAlbumList)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK) // 200
+
+	// return the album list
+	_ = json.NewEncoder(w).Encode(albumList)
+}
+
+func (rt *_router) getAlbum(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// get the user authenticated by the bearer token
+	userId, err := GetAuthenticatedUserId(ctx)
+
+	if err != nil {
+		writeError(w, err, http.StatusUnauthorized)
+		return
+	}
+
+	// get the user performing the action
+	dbUser, err := rt.db.GetDatabaseUser(ctx.Context, userId)
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	// get the owner of the album from the resource parameter
+	albumUser, code, err := rt.GetUserFromParameter(ctx, "uname", r, ps)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	// check whether the owner of the album
+	// has banned the user performing the action
+	checkBan, err := rt.db.CheckBan(ctx.Context, albumUser.UserIntoDatabaseUser(), dbUser)
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	if checkBan {
+		writeError(w, ErrBannedUser, http.StatusUnauthorized)
+		return
+	}
+
+	// get the album from the resource parameter
+	album, code, err := rt.GetAlbumFromParameter(ctx, "album_id", UserFromDatabaseUser(dbUser), r, ps)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	// check if the resource is consistent
+	if album.User.Id != albumUser.Id {
+		writeError(w, ErrPageNotFound, http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK) // 200
+
+	// return the album with its photos
+	_ = json.NewEncoder(w).Encode(album)
+}
+
+func (rt *_router) createAlbum(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// authenticate the user performing the action
+	user, code, err := rt.AuthenticateUserFromParameter(ctx, "uname", r, ps)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	album := AlbumDefault()
+
+	// get the name of the album from the request body
+	code, err = decodeJSON(r, &album)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	name, ok := validAlbumName(album.Name)
+
+	if !ok {
+		writeError(w, ErrInvalidAlbumName, http.StatusBadRequest)
+		return
+	}
+
+	// the album starts empty, its photos are set afterwards
+	album = AlbumDefault()
+	album.User = user
+	album.Name = name
+	album.Date = time.Now().UTC().Truncate(time.Second)
+
+	dbAlbum := album.AlbumIntoDatabaseAlbum()
+
+	// insert the album into the database
+	err = rt.db.InsertAlbum(ctx.Context, &dbAlbum)
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	album.Id = dbAlbum.Id
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated) // 201
+
+	// return the new album
+	_ = json.NewEncoder(w).Encode(album)
+}
+
+func (rt *_router) renameAlbum(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// authenticate the user performing the action
+	user, code, err := rt.AuthenticateUserFromParameter(ctx, "uname", r, ps)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	// get the album to be renamed from the resource parameter
+	album, code, err := rt.GetAlbumFromParameter(ctx, "album_id", user, r, ps)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	// check if the resource is consistent
+	if album.User.Id != user.Id {
+		writeError(w, ErrPageNotFound, http.StatusNotFound)
+		return
+	}
+
+	newAlbum := AlbumDefault()
+
+	// get the new name of the album from the request body
+	code, err = decodeJSON(r, &newAlbum)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	name, ok := validAlbumName(newAlbum.Name)
+
+	if !ok {
+		writeError(w, ErrInvalidAlbumName, http.StatusBadRequest)
+		return
+	}
+
+	album.Name = name
+
+	// rename the album
+	err = rt.db.UpdateAlbum(ctx.Context, album.AlbumIntoDatabaseAlbum())
+
+	if errors.Is(err, database.ErrAlbumDoesNotExist) {
+		writeError(w, err, http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK) // 200
+
+	// return the renamed album
+	_ = json.NewEncoder(w).Encode(album)
+}
+
+func (rt *_router) deleteAlbum(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// authenticate the user performing the action
+	user, code, err := rt.AuthenticateUserFromParameter(ctx, "uname", r, ps)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	// get the album to be deleted from the resource parameter
+	album, code, err := rt.GetAlbumFromParameter(ctx, "album_id", user, r, ps)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	// check if the resource is consistent
+	if album.User.Id != user.Id {
+		writeError(w, ErrPageNotFound, http.StatusNotFound)
+		return
+	}
+
+	// remove the album from the database,
+	// leaving its photos untouched
+	err = rt.db.DeleteAlbum(ctx.Context, album.AlbumIntoDatabaseAlbum())
+
+	if errors.Is(err, database.ErrAlbumDoesNotExist) {
+		writeError(w, err, http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent) // 204
+}
+
+func (rt *_router) setAlbumPhotos(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// authenticate the user performing the action
+	user, code, err := rt.AuthenticateUserFromParameter(ctx, "uname", r, ps)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	// get the album from the resource parameter
+	album, code, err := rt.GetAlbumFromParameter(ctx, "album_id", user, r, ps)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	// check if the resource is consistent
+	if album.User.Id != user.Id {
+		writeError(w, ErrPageNotFound, http.StatusNotFound)
+		return
+	}
+
+	albumPhotos := AlbumPhotosDefault()
+
+	// get the ordered photos of the album from the request body
+	code, err = decodeJSON(r, &albumPhotos)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	// a photo can appear only once in an album
+	seen := make(map[uint32]bool)
+
+	for _, photoId := range albumPhotos.Photos {
+		if seen[photoId] {
+			writeError(w, ErrInvalidAlbumPhotos, http.StatusBadRequest)
+			return
+		}
+
+		seen[photoId] = true
+	}
+
+	// replace the photos of the album, which
+	// must all be photos of the owner
+	err = rt.db.SetAlbumPhotos(ctx.Context, album.AlbumIntoDatabaseAlbum(), albumPhotos.Photos)
+
+	if errors.Is(err, database.ErrPhotoDoesNotExist) {
+		writeError(w, ErrInvalidAlbumPhotos, http.StatusBadRequest)
+		return
+	}
+
+	if errors.Is(err, database.ErrAlbumDoesNotExist) {
+		writeError(w, err, http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	// get the album again with its new photos
+	album, code, err = rt.GetAlbumFromParameter(ctx, "album_id", user, r, ps)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK) // 200
+
+	// return the album with its new photos
+	_ = json.NewEncoder(w).Encode(album)
+}
@@ -1,28 +1,89 @@
 package api
 
 import (
+	"errors"
 	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/api/reqcontext"
-	"github.com/gofrs/uuid"
 	"github.com/julienschmidt/httprouter"
 	"github.com/sirupsen/logrus"
 	"net/http"
+	"strings"
+	"time"
 )
 
 // httpRouterHandler is the signature for functions that accepts a reqcontext.RequestContext in addition to those
 // required by the httprouter package.
 type httpRouterHandler func(http.ResponseWriter, *http.Request, httprouter.Params, reqcontext.RequestContext)
 
-// wrap parses the request and adds a reqcontext.RequestContext instance related to the request.
+// wrap parses the request and adds a reqcontext.RequestContext instance related to the request, whose body is limited
+// to the maximum size of the JSON bodies.
 func (rt *_router) wrap(fn httpRouterHandler) func(http.ResponseWriter, *http.Request, httprouter.Params) {
-	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
-		reqUUID, err := uuid.NewV4()
+	return rt.wrapLimit(fn, rt.maxBodySize)
+}
+
+// wrapFallback is like wrap, for the handlers answering the requests which match no route.
+func (rt *_router) wrapFallback(fn httpRouterHandler) http.Handler {
+	handle := rt.wrap(fn)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handle(w, r, nil)
+	})
+}
+
+// uploadProcessingTime is how long the server has to process an upload and answer it once received, or to refuse it
+// with 408 once the upload timeout expired
+const uploadProcessingTime = time.Minute
+
+// wrapUpload is like wrapLimit, for the uploads of the files: their deadlines to be received and answered are extended
+// past the upload timeout, since a large file on a slow connection outlasts the read and write timeouts of the server.
+func (rt *_router) wrapUpload(fn httpRouterHandler, maxBodySize int64) func(http.ResponseWriter, *http.Request, httprouter.Params) {
+	return rt.wrapLimit(func(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+		deadline := time.Now().Add(rt.uploadTimeout)
+
+		// the connections not supporting the deadlines
+		// keep the timeouts of the server
+		rc := http.NewResponseController(w)
+		_ = rc.SetReadDeadline(deadline)
+		_ = rc.SetWriteDeadline(deadline.Add(uploadProcessingTime))
+
+		fn(w, r, ps, ctx)
+	}, maxBodySize)
+}
+
+// wrapLimit is like wrap, limiting the body of the request to `maxBodySize` bytes instead, for the routes receiving
+// larger bodies than JSON (eg. the uploads).
+func (rt *_router) wrapLimit(fn httpRouterHandler, maxBodySize int64) func(http.ResponseWriter, *http.Request, httprouter.Params) {
+	return func(rw http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		start := time.Now()
+
+		// Record the status of the response for the access log
+		rec := &statusRecorder{ResponseWriter: rw}
+
+		var w http.ResponseWriter = rec
+
+		// Compress the JSON responses, if the client accepts it
+		if rt.compress {
+			w = &compressWriter{ResponseWriter: rec, encoding: acceptedEncoding(r)}
+		}
+
+		// Stop reading the body once it exceeds the limit of the route, instead of receiving it whole
+		r.Body = http.MaxBytesReader(w, r.Body, maxBodySize)
+
+		// Take the id of the request from the client, or generate a new one, and send it back with the response
+		reqUUID, err := requestId(r)
 		if err != nil {
 			rt.baseLogger.WithError(err).Error("can't generate a request UUID")
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
+		w.Header().Set(requestIdHeader, reqUUID.String())
+
+		// Trace the request, continuing the trace of the client if any, so that the queries to the database are
+		// traced within it
+		r, span := rt.startRequestSpan(r)
+
 		var ctx = reqcontext.RequestContext{
 			ReqUUID: reqUUID,
+			Context: r.Context(),
 		}
 
 		// Create a request-specific logger
@@ -31,6 +92,71 @@ func (rt *_router) wrap(fn httpRouterHandler) func(http.ResponseWriter, *http.Re
 			"remote-ip": r.RemoteAddr,
 		})
 
+		if span != nil {
+			ctx.Logger = ctx.Logger.WithField("trace-id", span.TraceID())
+		}
+
+		// Write the access log entry of the request once it has been served, whatever the outcome
+		defer rt.logRequest(rec, r, &ctx, start)
+
+		// End the span of the request once it has been served, before logging it
+		defer endRequestSpan(span, rec, &ctx)
+
+		// End the compressed response once the handler returns, before logging it
+		if cw, ok := w.(*compressWriter); ok {
+			defer cw.Close()
+		}
+
+		// Recover from the panics of the handler, so that they are logged together with the request and answered with
+		// a 500, instead of dropping the connection
+		defer rt.recoverPanic(w, &ctx)
+
+		token, bearer := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+		// Authenticate the user from the bearer token, rejecting the tokens which were tampered with, expired or
+		// revoked. The API keys are checked apart, and the other bearer tokens (like the one of the administrators) are
+		// left to the handlers
+		if bearer && strings.HasPrefix(token, tokenHeader+".") {
+			dbSession, err := rt.authenticate(r.Context(), token, time.Now())
+			if errors.Is(err, ErrInvalidToken) {
+				writeError(w, err, http.StatusUnauthorized)
+				return
+			}
+			if err != nil {
+				ctx.Logger.WithError(err).Error("can't authenticate the user")
+				writeError(w, err, http.StatusInternalServerError)
+				return
+			}
+
+			ctx.UserId = dbSession.User.Id
+			ctx.SessionId = dbSession.Id
+			ctx.Logger = ctx.Logger.WithField("user", ctx.UserId)
+		} else if bearer && strings.HasPrefix(token, apiKeyPrefix) {
+			now := time.Now()
+
+			// Authenticate the user from their API key, which is then held to its scope and its rate limit
+			dbAPIKey, err := rt.authenticateAPIKey(r.Context(), token, now)
+			if errors.Is(err, ErrInvalidAPIKey) {
+				writeError(w, err, http.StatusUnauthorized)
+				return
+			}
+			if err != nil {
+				ctx.Logger.WithError(err).Error("can't authenticate the API key")
+				writeError(w, err, http.StatusInternalServerError)
+				return
+			}
+
+			ctx.UserId = dbAPIKey.User.Id
+			ctx.APIKeyId = dbAPIKey.Id
+			ctx.Logger = ctx.Logger.WithFields(logrus.Fields{"user": ctx.UserId, "api-key": ctx.APIKeyId})
+
+			code, err := rt.checkAPIKeyScope(w, r, dbAPIKey, now)
+			if err != nil {
+				writeError(w, err, code)
+				return
+			}
+		}
+
 		// Call the next handler in chain (usually, the handler function for the path)
 		fn(w, r, ps, ctx)
 	}
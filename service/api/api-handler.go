@@ -6,43 +6,220 @@ import (
 
 // Handler returns an instance of httprouter.Router that handle APIs registered here
 func (rt *_router) Handler() http.Handler {
+	// The routes of the first version of the API, served under /v1
+	v1 := newAPIVersion("/v1")
+
 	// Login
-	rt.router.POST("/session", rt.wrap(rt.session)) // DONE
+	v1.POST("/session", rt.wrap(rt.session)) // DONE
+
+	// Session
+	v1.POST("/session/refresh", rt.wrap(rt.refreshSession))        // DONE
+	v1.POST("/session/logout", rt.wrap(rt.logout))                 // DONE
+	v1.DELETE("/user/:uname/sessions", rt.wrap(rt.revokeSessions)) // DONE
+
+	// Provider
+	v1.GET("/session/providers", rt.wrap(rt.getProviders))                 // DONE
+	v1.GET("/session/providers/:provider", rt.wrap(rt.startProviderLogin)) // DONE
+	v1.POST("/session/providers/:provider", rt.wrap(rt.providerLogin))     // DONE
+
+	// API key
+	v1.GET("/user/:uname/keys", rt.wrap(rt.getAPIKeys))              // DONE
+	v1.POST("/user/:uname/keys", rt.wrap(rt.createAPIKey))           // DONE
+	v1.DELETE("/user/:uname/keys/:key_id", rt.wrap(rt.deleteAPIKey)) // DONE
 
 	// Ban
-	rt.router.PUT("/user/:uname/ban/:banned_uname", rt.wrap(rt.banUser))      // DONE
-	rt.router.DELETE("/user/:uname/ban/:banned_uname", rt.wrap(rt.unbanUser)) // DONE
+	v1.GET("/user/:uname/ban", rt.wrap(rt.getBannedUsers))             // DONE
+	v1.PUT("/user/:uname/ban/:banned_uname", rt.wrap(rt.banUser))      // DONE
+	v1.DELETE("/user/:uname/ban/:banned_uname", rt.wrap(rt.unbanUser)) // DONE
+
+	// Mute
+	v1.GET("/user/:uname/mute", rt.wrap(rt.getMutedUsers))              // DONE
+	v1.PUT("/user/:uname/mute/:muted_uname", rt.wrap(rt.muteUser))      // DONE
+	v1.DELETE("/user/:uname/mute/:muted_uname", rt.wrap(rt.unmuteUser)) // DONE
+
+	// Close friend
+	v1.GET("/user/:uname/close-friends", rt.wrap(rt.getCloseFriends))                    // DONE
+	v1.PUT("/user/:uname/close-friends/:friend_uname", rt.wrap(rt.addCloseFriend))       // DONE
+	v1.DELETE("/user/:uname/close-friends/:friend_uname", rt.wrap(rt.removeCloseFriend)) // DONE
 
 	// Follow
-	rt.router.PUT("/user/:uname/follow/:followed_uname", rt.wrap(rt.followUser))      // DONE
-	rt.router.DELETE("/user/:uname/follow/:followed_uname", rt.wrap(rt.unfollowUser)) // DONE
-	rt.router.GET("/user/:uname/followers", rt.wrap(rt.getFollowers))                 // DONE
-	rt.router.GET("/user/:uname/following", rt.wrap(rt.getFollowing))                 // DONE
+	v1.PUT("/user/:uname/follow/:followed_uname", rt.wrap(rt.idempotent(rt.followUser))) // DONE
+	v1.DELETE("/user/:uname/follow/:followed_uname", rt.wrap(rt.unfollowUser))           // DONE
+	v1.GET("/user/:uname/followers", rt.wrap(rt.getFollowers))                           // DONE
+	v1.GET("/user/:uname/following", rt.wrap(rt.getFollowing))                           // DONE
+
+	// Follow request
+	v1.GET("/user/:uname/follow-requests", rt.wrap(rt.getFollowRequests))                       // DONE
+	v1.PUT("/user/:uname/follow-requests/:requester_uname", rt.wrap(rt.approveFollowRequest))   // DONE
+	v1.DELETE("/user/:uname/follow-requests/:requester_uname", rt.wrap(rt.rejectFollowRequest)) // DONE
 
 	// Photo
-	rt.router.POST("/user/:uname/upload", rt.wrap(rt.uploadPhoto))             // DONE
-	rt.router.DELETE("/user/:uname/photos/:photo_id", rt.wrap(rt.deletePhoto)) // DONE
+	v1.POST("/user/:uname/upload", rt.wrapUpload(rt.idempotent(rt.uploadPhoto), rt.maxUploadSize()+multipartOverhead)) // DONE
+	v1.GET("/user/:uname/photos/:photo_id", rt.wrap(rt.getPhoto))                                                      // DONE
+	v1.DELETE("/user/:uname/photos/:photo_id", rt.wrap(rt.deletePhoto))                                                // DONE
+	v1.POST("/user/:uname/photos/:photo_id/edit", rt.wrap(rt.editPhoto))                                               // DONE
+	v1.PUT("/user/:uname/photos/:photo_id/archive", rt.wrap(rt.archivePhoto))                                          // DONE
+	v1.DELETE("/user/:uname/photos/:photo_id/archive", rt.wrap(rt.unarchivePhoto))                                     // DONE
+	v1.PUT("/user/:uname/photos/:photo_id/pin", rt.wrap(rt.pinPhoto))                                                  // DONE
+	v1.DELETE("/user/:uname/photos/:photo_id/pin", rt.wrap(rt.unpinPhoto))                                             // DONE
+	v1.PUT("/user/:uname/photos/:photo_id/alt-text", rt.wrap(rt.setPhotoAltText))                                      // DONE
+
+	// Album
+	v1.GET("/user/:uname/albums", rt.wrap(rt.getAlbums))                       // DONE
+	v1.POST("/user/:uname/albums", rt.wrap(rt.createAlbum))                    // DONE
+	v1.GET("/user/:uname/albums/:album_id", rt.wrap(rt.getAlbum))              // DONE
+	v1.PUT("/user/:uname/albums/:album_id", rt.wrap(rt.renameAlbum))           // DONE
+	v1.DELETE("/user/:uname/albums/:album_id", rt.wrap(rt.deleteAlbum))        // DONE
+	v1.PUT("/user/:uname/albums/:album_id/photos", rt.wrap(rt.setAlbumPhotos)) // DONE
+
+	// Avatar
+	v1.PUT("/user/:uname/avatar", rt.wrapUpload(rt.setMyAvatar, rt.maxPhotoSize+multipartOverhead)) // DONE
+	v1.DELETE("/user/:uname/avatar", rt.wrap(rt.deleteMyAvatar))                                    // DONE
+
+	// Story
+	v1.POST("/user/:uname/stories", rt.wrapUpload(rt.uploadStory, rt.maxPhotoSize+multipartOverhead)) // DONE
+	v1.GET("/user/:uname/stories", rt.wrap(rt.getStories))                                            // DONE
+	v1.DELETE("/user/:uname/stories/:story_id", rt.wrap(rt.deleteStory))                              // DONE
+	v1.GET("/user/:uname/stream/stories", rt.wrap(rt.getStoryTray))                                   // DONE
 
 	// Like
-	rt.router.GET("/user/:uname/photos/:photo_id/likes", rt.wrap(rt.getPhotoLikes))              // DONE
-	rt.router.PUT("/user/:uname/photos/:photo_id/likes/:like_uname", rt.wrap(rt.likePhoto))      // DONE
-	rt.router.DELETE("/user/:uname/photos/:photo_id/likes/:like_uname", rt.wrap(rt.unlikePhoto)) // DONE
+	v1.GET("/user/:uname/photos/:photo_id/likes", rt.wrap(rt.getPhotoLikes))                        // DONE
+	v1.PUT("/user/:uname/photos/:photo_id/likes/:like_uname", rt.wrap(rt.idempotent(rt.likePhoto))) // DONE
+	v1.DELETE("/user/:uname/photos/:photo_id/likes/:like_uname", rt.wrap(rt.unlikePhoto))           // DONE
+
+	// Reaction
+	v1.GET("/user/:uname/photos/:photo_id/reactions", rt.wrap(rt.getPhotoReactions))               // DONE
+	v1.PUT("/user/:uname/photos/:photo_id/reactions/:reaction_uname", rt.wrap(rt.reactPhoto))      // DONE
+	v1.DELETE("/user/:uname/photos/:photo_id/reactions/:reaction_uname", rt.wrap(rt.unreactPhoto)) // DONE
 
 	// Comment
-	rt.router.GET("/user/:uname/photos/:photo_id/comments", rt.wrap(rt.getPhotoComments))              // DONE
-	rt.router.POST("/user/:uname/photos/:photo_id/comment", rt.wrap(rt.commentPhoto))                  // DONE
-	rt.router.DELETE("/user/:uname/photos/:photo_id/comments/:comment_id", rt.wrap(rt.uncommentPhoto)) // DONE
+	v1.GET("/user/:uname/photos/:photo_id/comments", rt.wrap(rt.getPhotoComments))              // DONE
+	v1.POST("/user/:uname/photos/:photo_id/comment", rt.wrap(rt.idempotent(rt.commentPhoto)))   // DONE
+	v1.DELETE("/user/:uname/photos/:photo_id/comments/:comment_id", rt.wrap(rt.uncommentPhoto)) // DONE
 
 	// User
-	rt.router.GET("/user/:uname", rt.wrap(rt.getUserProfile))            // DONE
-	rt.router.PUT("/user/:uname/setusername", rt.wrap(rt.setMyUserName)) // DONE
-	rt.router.GET("/user/:uname/users", rt.wrap(rt.getUsers))            // DONE
+	v1.GET("/user/:uname", rt.wrap(rt.getUserProfile))            // DONE
+	v1.DELETE("/user/:uname", rt.wrap(rt.deleteUser))             // DONE
+	v1.PUT("/user/:uname/deactivate", rt.wrap(rt.deactivateUser)) // DONE
+	v1.PUT("/user/:uname/erase", rt.wrap(rt.eraseUser))           // DONE
+	v1.PUT("/user/:uname/setusername", rt.wrap(rt.setMyUserName)) // DONE
+	v1.PUT("/user/:uname/profile", rt.wrap(rt.setMyProfile))      // DONE
+	v1.GET("/user/:uname/users", rt.wrap(rt.getUsers))            // DONE
+	v1.GET("/user/:uname/settings", rt.wrap(rt.getUserSettings))  // DONE
+	v1.PUT("/user/:uname/settings", rt.wrap(rt.setUserSettings))  // DONE
+
+	// Export
+	v1.GET("/user/:uname/export", rt.wrap(rt.exportAccount))                          // DONE
+	v1.POST("/user/:uname/import", rt.wrapUpload(rt.importAccount, rt.maxImportSize)) // DONE
+
+	// Feed
+	v1.GET("/user/:uname/feed.atom", rt.wrap(rt.getUserFeed)) // DONE
+
+	// GraphQL
+	v1.POST(graphqlPath, rt.wrap(rt.serveGraphQL))          // DONE
+	v1.GET("/graphql/schema", rt.wrap(rt.getGraphQLSchema)) // DONE
+
+	// Batch
+	v1.POST(batchPath, rt.wrap(rt.batch)) // DONE
+
+	// Email
+	v1.POST("/user/:uname/settings/verify-email", rt.wrap(rt.resendVerification)) // DONE
+	v1.GET("/verify-email", rt.wrap(rt.verifyEmail))                              // DONE
 
 	// Stream
-	rt.router.GET("/user/:uname/stream", rt.wrap(rt.getMyStream)) // DONE
+	v1.GET("/user/:uname/stream", rt.wrap(rt.getMyStream))              // DONE
+	v1.PUT("/user/:uname/stream/seen", rt.wrap(rt.setStreamSeen))       // DONE
+	v1.GET("/user/:uname/stream/updates", rt.wrap(rt.getStreamUpdates)) // DONE
+
+	// Notification
+	v1.GET("/user/:uname/notifications", rt.wrap(rt.getNotifications))                    // DONE
+	v1.GET("/user/:uname/notifications/unread", rt.wrap(rt.getUnreadNotifications))       // DONE
+	v1.GET("/user/:uname/notifications/events", rt.wrap(rt.streamNotifications))          // DONE
+	v1.PUT("/user/:uname/notifications/read", rt.wrap(rt.readNotifications))              // DONE
+	v1.GET("/user/:uname/notifications/mentions", rt.wrap(rt.getMentions))                // DONE
+	v1.GET("/user/:uname/settings/notifications", rt.wrap(rt.getNotificationPreferences)) // DONE
+	v1.PUT("/user/:uname/settings/notifications", rt.wrap(rt.setNotificationPreferences)) // DONE
+
+	// Device
+	v1.POST("/user/:uname/devices", rt.wrap(rt.registerDevice))            // DONE
+	v1.DELETE("/user/:uname/devices/:device_id", rt.wrap(rt.deleteDevice)) // DONE
+
+	// Explore
+	v1.GET("/explore", rt.wrap(rt.getExplorePhotos)) // DONE
+
+	// Trending
+	v1.GET("/trending", rt.wrap(rt.getTrending)) // DONE
+
+	// Hashtag
+	v1.GET("/hashtags/:tag/photos", rt.wrap(rt.getHashtagPhotos)) // DONE
+
+	// Place
+	v1.GET("/places/:place/photos", rt.wrap(rt.getPlacePhotos)) // DONE
+
+	// Search
+	v1.GET("/search", rt.wrap(rt.search))                  // DONE
+	v1.GET("/search/comments", rt.wrap(rt.searchComments)) // DONE
+	v1.GET("/users", rt.wrap(rt.searchUsers))              // DONE
+
+	// Admin
+	v1.POST("/admin/backup", rt.wrap(rt.backupDatabase))                               // DONE
+	v1.GET("/admin/audit", rt.wrap(rt.getAuditLog))                                    // DONE
+	v1.GET("/admin/users", rt.wrap(rt.getAdminUsers))                                  // DONE
+	v1.PUT("/admin/users/:user_id/suspend", rt.wrap(rt.suspendUser))                   // DONE
+	v1.DELETE("/admin/users/:user_id/suspend", rt.wrap(rt.unsuspendUser))              // DONE
+	v1.PUT("/admin/users/:user_id/shadow-ban", rt.wrap(rt.shadowBanUser))              // DONE
+	v1.DELETE("/admin/users/:user_id/shadow-ban", rt.wrap(rt.unshadowBanUser))         // DONE
+	v1.GET("/admin/erasures", rt.wrap(rt.getErasures))                                 // DONE
+	v1.DELETE("/admin/photos/:photo_id", rt.wrap(rt.forceDeletePhoto))                 // DONE
+	v1.DELETE("/admin/comments/:comment_id", rt.wrap(rt.forceDeleteComment))           // DONE
+	v1.GET("/admin/blocklist", rt.wrap(rt.getBlocklist))                               // DONE
+	v1.POST("/admin/blocklist", rt.wrap(rt.blockTerm))                                 // DONE
+	v1.DELETE("/admin/blocklist/:term_id", rt.wrap(rt.unblockTerm))                    // DONE
+	v1.GET("/admin/reserved-names", rt.wrap(rt.getReservedNames))                      // DONE
+	v1.POST("/admin/reserved-names", rt.wrap(rt.reserveName))                          // DONE
+	v1.DELETE("/admin/reserved-names/:name_id", rt.wrap(rt.unreserveName))             // DONE
+	v1.GET("/admin/held-comments", rt.wrap(rt.getHeldComments))                        // DONE
+	v1.POST("/admin/held-comments/:held_id/approve", rt.wrap(rt.approveHeldComment))   // DONE
+	v1.DELETE("/admin/held-comments/:held_id", rt.wrap(rt.rejectHeldComment))          // DONE
+	v1.GET("/admin/flagged-photos", rt.wrap(rt.getFlaggedPhotos))                      // DONE
+	v1.DELETE("/admin/photos/:photo_id/flag", rt.wrap(rt.unflagPhoto))                 // DONE
+	v1.GET("/admin/webhooks", rt.wrap(rt.getWebhooks))                                 // DONE
+	v1.POST("/admin/webhooks", rt.wrap(rt.registerWebhook))                            // DONE
+	v1.DELETE("/admin/webhooks/:webhook_id", rt.wrap(rt.deleteWebhook))                // DONE
+	v1.GET("/admin/webhooks/:webhook_id/deliveries", rt.wrap(rt.getWebhookDeliveries)) // DONE
+
+	// The routes of the second version of the API, served under /v2, where every list is paginated the same way
+	v2 := v1.next("/v2")
+
+	// List
+	v2.GET("/user/:uname/stream", rt.wrap(rt.enveloped(rt.getMyStream)))                         // DONE
+	v2.GET("/user/:uname/photos/:photo_id/comments", rt.wrap(rt.enveloped(rt.getPhotoComments))) // DONE
+	v2.GET("/user/:uname/followers", rt.wrap(rt.enveloped(rt.getFollowers)))                     // DONE
+	v2.GET("/user/:uname/following", rt.wrap(rt.enveloped(rt.getFollowing)))                     // DONE
+	v2.GET("/user/:uname/photos/:photo_id/likes", rt.wrap(rt.enveloped(rt.getPhotoLikes)))       // DONE
+	v2.GET("/search/comments", rt.wrap(rt.enveloped(rt.searchComments)))                         // DONE
+	v2.GET("/users", rt.wrap(rt.enveloped(rt.searchUsers)))                                      // DONE
+
+	rt.mount(v1)
+	rt.mount(v2)
+
+	// The routes served before the versions of the API, deprecated in favour of the ones of /v1
+	rt.mountLegacy(v1, rt.legacySunset)
+
+	// The files of the photos, whose urls are stored together with them, are served outside of the versions
+	rt.router.GET(PhotoUrlPrefix+":name", withRoute(rt.wrap(rt.getPhotoFile), PhotoUrlPrefix+":name")) // DONE
+
+	// The methods of the gRPC service, whose paths are given by the name of the service instead of the versions
+	rt.router.POST("/"+GRPCService+"/:method", withRoute(rt.wrap(rt.serveGRPC), "/"+GRPCService+"/:method")) // DONE
+
+	// Health probes, the liveness of the process and the readiness of its dependencies
+	rt.router.GET("/healthz", rt.healthz)  // DONE
+	rt.router.GET("/readyz", rt.readyz)    // DONE
+	rt.router.GET("/liveness", rt.healthz) // DONE
 
-	// Liveness
-	rt.router.GET("/liveness", rt.liveness) // DONE
+	// Unknown resources and methods, reported like the errors of the handlers
+	rt.router.NotFound = rt.wrapFallback(rt.notFound)
+	rt.router.MethodNotAllowed = rt.wrapFallback(rt.methodNotAllowed)
 
 	return rt.router
 }
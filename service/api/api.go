@@ -37,11 +37,28 @@ See the `main.go` file inside the `cmd/webapi` for a full usage example.
 package api
 
 import (
+	"context"
+	"crypto/rand"
 	"errors"
+	"fmt"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/auth"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/blocklist"
 	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/database"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/graphql"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/mail"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/moderation"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/push"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/storage"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/tracing"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/usernames"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/video"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/webhook"
 	"github.com/julienschmidt/httprouter"
 	"github.com/sirupsen/logrus"
 	"net/http"
+	"strings"
+	"sync"
+	"time"
 )
 
 // Config is used to provide dependencies and configuration to the New function.
@@ -51,13 +68,404 @@ type Config struct {
 
 	// Database is the instance of database.AppDatabase where data are saved
 	Database database.AppDatabase
+
+	// Photos is the storage where the files of the uploaded photos are saved
+	Photos storage.BlobStorage
+
+	// TokenSecret is the key signing the tokens which authenticate the users. If empty, a random key is generated, hence
+	// the users have to log in again whenever the server restarts.
+	TokenSecret string
+
+	// TokenLifetime is how long an access token authenticates its user, who then exchanges their refresh token for a
+	// new one. If zero, DefaultTokenLifetime is used.
+	TokenLifetime time.Duration
+
+	// RefreshTokenLifetime is how long a refresh token can be exchanged, hence how long a session lasts without being
+	// used. If zero, DefaultRefreshTokenLifetime is used.
+	RefreshTokenLifetime time.Duration
+
+	// AuthProviders are the external identity providers the users can sign in through, by their name (eg.
+	// auth.ProviderOIDC or auth.ProviderGitHub). If there is none, the users sign in with their username only;
+	// otherwise the users who linked an identity must sign in through its provider.
+	AuthProviders map[string]auth.Provider
+
+	// ReactivationWindow is how long a deactivated account can be restored by logging in again. After that, its data
+	// are removed on the next login. If zero, DefaultReactivationWindow is used.
+	ReactivationWindow time.Duration
+
+	// RenameGracePeriod is how long the old username of a user who renamed is kept reserved to them, and the requests
+	// to it are redirected to the new one. If zero, DefaultRenameGracePeriod is used.
+	RenameGracePeriod time.Duration
+
+	// UsernamePolicy tells which usernames the users may choose at the registration and when they rename, and which
+	// usernames name the same user; the database is set to look the users up by its keys. If nil, the default policy
+	// of the usernames package is used.
+	UsernamePolicy *usernames.Policy
+
+	// ReservedUsernames are the usernames no user may choose, matched as a whole, once normalized and ignoring the
+	// case, besides the ones the administrators reserve through the API.
+	ReservedUsernames []string
+
+	// BlockedUsernameTerms are the terms no username may contain, matched once normalized and ignoring the case,
+	// besides the ones the administrators reserve through the API.
+	BlockedUsernameTerms []string
+
+	// APIKeyRateLimit is how many requests per minute an API key may send when its user does not choose. If zero,
+	// DefaultAPIKeyRateLimit is used.
+	APIKeyRateLimit int
+
+	// MaxAPIKeyRateLimit is the highest rate limit, in requests per minute, a user may choose for an API key. If zero,
+	// DefaultMaxAPIKeyRateLimit is used.
+	MaxAPIKeyRateLimit int
+
+	// AdminToken is the bearer token authenticating the administrators. If empty, the administrative endpoints reject
+	// every request.
+	AdminToken string
+
+	// BackupDir is the directory where the backups of the database are saved. If empty, DefaultBackupDir is used.
+	BackupDir string
+
+	// MaxBodySize is the maximum size in bytes of the body of a request, except for the uploads of the photos and the
+	// stories, which are limited by MaxPhotoSize instead. If zero, DefaultMaxBodySize is used.
+	MaxBodySize int64
+
+	// UploadTimeout is how long the clients have to send an upload of a photo, a story or an avatar, and the server to
+	// answer it, instead of the read and write timeouts of the server, which are too short for a large file on a slow
+	// connection. If zero, DefaultUploadTimeout is used.
+	UploadTimeout time.Duration
+
+	// LegacySunset is when the routes without the prefix of a version of the API, deprecated in favour of the ones of
+	// /v1, stop being served: until then they answer like the ones of /v1, announcing the date in the Sunset header,
+	// and afterwards with 410. If zero, DefaultLegacySunset is used.
+	LegacySunset time.Time
+
+	// MaxPhotoSize is the maximum size in bytes of an uploaded photo. If zero, DefaultMaxPhotoSize is used.
+	MaxPhotoSize int64
+
+	// MaxPhotoDimension is the maximum width and height in pixels of an uploaded photo. If zero,
+	// DefaultMaxPhotoDimension is used.
+	MaxPhotoDimension int
+
+	// MaxVideoSize is the maximum size in bytes of an uploaded video. If zero, DefaultMaxVideoSize is used.
+	MaxVideoSize int64
+
+	// MaxVideoDuration is the maximum duration of an uploaded video. If zero, DefaultMaxVideoDuration is used.
+	MaxVideoDuration time.Duration
+
+	// MaxImportSize is the maximum size in bytes of an export archive sent to be imported into an account. If zero,
+	// DefaultMaxImportSize is used.
+	MaxImportSize int64
+
+	// VideoFramer extracts the frames of the uploaded videos shown as their posters, which are checked by the
+	// Classifier in place of the videos. If nil, the videos have no poster.
+	VideoFramer video.Framer
+
+	// DuplicatePhotos tells what to do when a user uploads a photo looking like one of their own photos: DuplicatesWarn
+	// marks the new photo as a duplicate, DuplicatesReject rejects it and DuplicatesAllow does nothing. If empty,
+	// DuplicatesWarn is used.
+	DuplicatePhotos string
+
+	// DuplicateDistance is the maximum number of bits in which the perceptual hashes of two photos looking alike
+	// differ. If zero, DefaultDuplicateDistance is used.
+	DuplicateDistance int
+
+	// Classifier tells whether the uploaded photos are unsafe, before they are shown to the other users. If nil, the
+	// photos are not checked.
+	Classifier moderation.Classifier
+
+	// UnsafePhotos tells what to do with a photo the Classifier finds unsafe: UnsafeFlag flags it, hiding it to the
+	// other users until the administrators review it, UnsafeReject rejects it and UnsafeAllow does nothing. If empty,
+	// UnsafeFlag is used.
+	UnsafePhotos string
+
+	// BlockedWords are the words the comments must not contain, matched ignoring the case and only as whole words,
+	// besides the ones the administrators block through the API.
+	BlockedWords []string
+
+	// BlockedPatterns are the regular expressions the comments must not match, besides the ones the administrators
+	// block through the API.
+	BlockedPatterns []string
+
+	// BlockedComments tells what to do with a comment containing a blocked word or pattern: BlockedReject rejects it
+	// and BlockedHold holds it back until the administrators approve or reject it. If empty, BlockedReject is used.
+	BlockedComments string
+
+	// SpamDuplicates tells what to do with a comment whose body the same user already posted in the last
+	// SpamDuplicateWindow: SpamHold holds it back until the administrators approve or reject it, SpamThrottle refuses
+	// it until the window is over and SpamAllow does nothing. If empty, SpamHold is used.
+	SpamDuplicates string
+
+	// SpamDuplicateWindow is how long a comment counts as a duplicate of an older one with the same body. If zero,
+	// DefaultSpamDuplicateWindow is used.
+	SpamDuplicateWindow time.Duration
+
+	// SpamLinks tells what to do with a comment holding more than SpamMaxLinks links: SpamHold holds it back,
+	// SpamThrottle refuses it and SpamAllow does nothing. If empty, SpamHold is used.
+	SpamLinks string
+
+	// SpamMaxLinks is the maximum number of links in a comment. If zero, DefaultSpamMaxLinks is used.
+	SpamMaxLinks int
+
+	// SpamRate tells what to do with a comment of a user who already posted SpamMaxRate comments in the last
+	// SpamRateWindow: SpamThrottle refuses it until the oldest of them is out of the window, SpamHold holds it back and
+	// SpamAllow does nothing. If empty, SpamThrottle is used.
+	SpamRate string
+
+	// SpamMaxRate is the maximum number of comments a user may post in SpamRateWindow. If zero, DefaultSpamMaxRate is
+	// used.
+	SpamMaxRate int
+
+	// SpamRateWindow is the window SpamMaxRate is counted in. If zero, DefaultSpamRateWindow is used.
+	SpamRateWindow time.Duration
+
+	// MaxPinnedPhotos is the maximum number of photos a user can pin to the top of their profile. If zero,
+	// DefaultMaxPinnedPhotos is used.
+	MaxPinnedPhotos int
+
+	// PublishInterval is how often the scheduled photos whose date has come are published. If zero,
+	// DefaultPublishInterval is used.
+	PublishInterval time.Duration
+
+	// StoryLifetime is how long a story is shown after it is posted. If zero, DefaultStoryLifetime is used.
+	StoryLifetime time.Duration
+
+	// StoryCleanupInterval is how often the expired stories and their files are removed. If zero,
+	// DefaultStoryCleanupInterval is used.
+	StoryCleanupInterval time.Duration
+
+	// BanCleanupInterval is how often the expired bans are lifted. If zero, DefaultBanCleanupInterval is used.
+	BanCleanupInterval time.Duration
+
+	// ErasureInterval is how often the accounts whose erasure was requested are erased. If zero,
+	// DefaultErasureInterval is used.
+	ErasureInterval time.Duration
+
+	// ExploreWindow is how far back the reactions and comments ranking the photos of the explore feed are counted. If
+	// zero, DefaultExploreWindow is used.
+	ExploreWindow time.Duration
+
+	// NotificationPollInterval is how often the event streams look for new notifications. If zero,
+	// DefaultNotificationPollInterval is used.
+	NotificationPollInterval time.Duration
+
+	// Pushers are the push services delivering the notifications to the devices of the users, by the platform of the
+	// devices (push.PlatformFCM or push.PlatformAPNs). Only the devices of these platforms can be registered, and if
+	// there is none the notifications are not pushed.
+	Pushers map[string]push.Pusher
+
+	// PushInterval is how often the new notifications are pushed. If zero, DefaultPushInterval is used.
+	PushInterval time.Duration
+
+	// Mailer delivers the digests of what the users missed and the links verifying their email addresses. If nil, no
+	// email is sent.
+	Mailer mail.Mailer
+
+	// PublicURL is the url the users reach the API at, which the links sent to them point to. If empty,
+	// DefaultPublicURL is used.
+	PublicURL string
+
+	// Compress is whether the JSON responses are compressed, with gzip or deflate as the clients accept in their
+	// Accept-Encoding header.
+	Compress bool
+
+	// Tracer records the traces of the requests, exporting them to an OpenTelemetry collector. If nil, the requests
+	// are not traced.
+	Tracer *tracing.Tracer
+
+	// RequireVerifiedEmail is whether the users must verify their email address before posting photos and stories,
+	// which requires a mailer to send the verification links.
+	RequireVerifiedEmail bool
+
+	// DigestPeriod is how often a user receives a digest, which covers at most this period. If zero,
+	// DefaultDigestPeriod is used.
+	DigestPeriod time.Duration
+
+	// DigestCheckInterval is how often the users due for a digest are looked for. If zero,
+	// DefaultDigestCheckInterval is used.
+	DigestCheckInterval time.Duration
+
+	// WebhookInterval is how often the events due are delivered to the webhooks. If zero, DefaultWebhookInterval is
+	// used.
+	WebhookInterval time.Duration
+
+	// WebhookTimeout is how long a webhook can take to answer a delivery before it fails. If zero,
+	// DefaultWebhookTimeout is used.
+	WebhookTimeout time.Duration
+
+	// WebhookMaxAttempts is how many times the delivery of an event is attempted before it is given up, waiting twice
+	// as long after every failure. If zero, DefaultWebhookMaxAttempts is used.
+	WebhookMaxAttempts int
+
+	// WebhookRetention is how long the deliveries are kept in the log of their webhook once they ended. If zero,
+	// DefaultWebhookRetention is used.
+	WebhookRetention time.Duration
+
+	// IdempotencyKeyLifetime is how long the response to a request sent with an idempotency key is replayed to the
+	// retries of the request. If zero, DefaultIdempotencyKeyLifetime is used.
+	IdempotencyKeyLifetime time.Duration
+
+	// IdempotencyCleanupInterval is how often the expired idempotency keys are removed. If zero,
+	// DefaultIdempotencyCleanupInterval is used.
+	IdempotencyCleanupInterval time.Duration
 }
 
+// DefaultTokenLifetime is the lifetime of the access tokens used when none is provided in Config
+const DefaultTokenLifetime = 15 * time.Minute
+
+// DefaultRefreshTokenLifetime is the lifetime of the refresh tokens used when none is provided in Config
+const DefaultRefreshTokenLifetime = 30 * 24 * time.Hour
+
+// DefaultPublicURL is the public url of the API used when none is provided in Config
+const DefaultPublicURL = "http://localhost:3000"
+
+// DefaultAPIKeyRateLimit is the rate limit of the API keys used when none is provided in Config
+const DefaultAPIKeyRateLimit = 60
+
+// DefaultMaxAPIKeyRateLimit is the highest rate limit of the API keys used when none is provided in Config
+const DefaultMaxAPIKeyRateLimit = 600
+
+// DefaultReactivationWindow is the reactivation window used when none is provided in Config
+const DefaultReactivationWindow = 30 * 24 * time.Hour
+
+// DefaultRenameGracePeriod is the grace period of the old usernames used when none is provided in Config
+const DefaultRenameGracePeriod = 30 * 24 * time.Hour
+
+// DefaultBackupDir is the backup directory used when none is provided in Config
+const DefaultBackupDir = "/tmp"
+
+// DefaultMaxBodySize is the maximum size of the body of a request used when none is provided in Config
+const DefaultMaxBodySize = 64 << 10
+
+// DefaultUploadTimeout is how long the uploads may take when none is provided in Config
+const DefaultUploadTimeout = 5 * time.Minute
+
+// DefaultLegacySunset is when the routes without the prefix of a version stop being served if none is provided in
+// Config, six months after they were deprecated
+var DefaultLegacySunset = legacyDeprecation.AddDate(0, 6, 0)
+
+// DefaultMaxPhotoSize is the maximum size of a photo used when none is provided in Config
+const DefaultMaxPhotoSize = 10 << 20
+
+// DefaultMaxPhotoDimension is the maximum width and height of a photo used when none is provided in Config
+const DefaultMaxPhotoDimension = 8192
+
+// DefaultMaxVideoSize is the maximum size of a video used when none is provided in Config
+const DefaultMaxVideoSize = 50 << 20
+
+// DefaultMaxVideoDuration is the maximum duration of a video used when none is provided in Config
+const DefaultMaxVideoDuration = time.Minute
+
+// DefaultMaxImportSize is the maximum size of an export archive used when none is provided in Config
+const DefaultMaxImportSize = 1 << 30
+
+// the values of Config.DuplicatePhotos
+const (
+	DuplicatesAllow  = "allow"
+	DuplicatesWarn   = "warn"
+	DuplicatesReject = "reject"
+)
+
+// DefaultDuplicateDistance is the distance between the hashes of two photos looking alike used when none is provided
+// in Config
+const DefaultDuplicateDistance = 5
+
+// the values of Config.UnsafePhotos
+const (
+	UnsafeAllow  = "allow"
+	UnsafeFlag   = "flag"
+	UnsafeReject = "reject"
+)
+
+// the values of Config.BlockedComments
+const (
+	BlockedReject = "reject"
+	BlockedHold   = "hold"
+)
+
+// the values of Config.SpamDuplicates, Config.SpamLinks and Config.SpamRate
+const (
+	SpamAllow    = "allow"
+	SpamThrottle = "throttle"
+	SpamHold     = "hold"
+)
+
+// the thresholds of the spam checks used when none is provided in Config
+const (
+	DefaultSpamDuplicateWindow = 10 * time.Minute
+	DefaultSpamMaxLinks        = 3
+	DefaultSpamMaxRate         = 5
+	DefaultSpamRateWindow      = time.Minute
+)
+
+// DefaultMaxPinnedPhotos is the maximum number of pinned photos used when none is provided in Config
+const DefaultMaxPinnedPhotos = 3
+
+// DefaultPublishInterval is the interval between two publications of the scheduled photos used when none is provided
+// in Config
+const DefaultPublishInterval = time.Minute
+
+// DefaultStoryLifetime is the lifetime of a story used when none is provided in Config
+const DefaultStoryLifetime = 24 * time.Hour
+
+// DefaultStoryCleanupInterval is the interval between two removals of the expired stories used when none is provided
+// in Config
+const DefaultStoryCleanupInterval = 10 * time.Minute
+
+// DefaultBanCleanupInterval is the interval between two removals of the expired bans used when none is provided in
+// Config
+const DefaultBanCleanupInterval = time.Minute
+
+// DefaultErasureInterval is the interval between two runs of the erasure of the accounts used when none is provided in
+// Config
+const DefaultErasureInterval = time.Minute
+
+// DefaultExploreWindow is the period of the activity ranking the explore feed used when none is provided in Config
+const DefaultExploreWindow = 48 * time.Hour
+
+// DefaultNotificationPollInterval is the interval between two lookups of the new notifications of an event stream
+// used when none is provided in Config
+const DefaultNotificationPollInterval = 2 * time.Second
+
+// DefaultPushInterval is the interval between two deliveries of the new notifications to the devices used when none
+// is provided in Config
+const DefaultPushInterval = 5 * time.Second
+
+// DefaultDigestPeriod is the interval between two digests of a user used when none is provided in Config
+const DefaultDigestPeriod = 7 * 24 * time.Hour
+
+// DefaultDigestCheckInterval is the interval between two lookups of the users due for a digest used when none is
+// provided in Config
+const DefaultDigestCheckInterval = time.Hour
+
+// DefaultWebhookInterval is the interval between two deliveries of the events to the webhooks used when none is
+// provided in Config
+const DefaultWebhookInterval = 5 * time.Second
+
+// DefaultWebhookTimeout is how long a webhook can take to answer used when none is provided in Config
+const DefaultWebhookTimeout = 10 * time.Second
+
+// DefaultWebhookMaxAttempts is the number of attempts of a delivery used when none is provided in Config
+const DefaultWebhookMaxAttempts = 8
+
+// DefaultWebhookRetention is how long the ended deliveries are kept used when none is provided in Config
+const DefaultWebhookRetention = 30 * 24 * time.Hour
+
+// DefaultIdempotencyKeyLifetime is how long the responses are replayed to the retries used when none is provided in
+// Config
+const DefaultIdempotencyKeyLifetime = 24 * time.Hour
+
+// DefaultIdempotencyCleanupInterval is the interval between two removals of the expired idempotency keys used when
+// none is provided in Config
+const DefaultIdempotencyCleanupInterval = 10 * time.Minute
+
 // Router is the package API interface representing an API handler builder
 type Router interface {
 	// Handler returns an HTTP handler for APIs provided in this package
 	Handler() http.Handler
 
+	// SpamStats returns the counters of the spam checks of the comments since the router was created
+	SpamStats() SpamStats
+
 	// Close terminates any resource used in the package
 	Close() error
 }
@@ -71,6 +479,54 @@ func New(cfg Config) (Router, error) {
 	if cfg.Database == nil {
 		return nil, errors.New("database is required")
 	}
+	if cfg.Photos == nil {
+		return nil, errors.New("photo storage is required")
+	}
+	switch cfg.DuplicatePhotos {
+	case "":
+		cfg.DuplicatePhotos = DuplicatesWarn
+	case DuplicatesAllow, DuplicatesWarn, DuplicatesReject:
+	default:
+		return nil, fmt.Errorf("unknown duplicate photos policy %q", cfg.DuplicatePhotos)
+	}
+	switch cfg.UnsafePhotos {
+	case "":
+		cfg.UnsafePhotos = UnsafeFlag
+	case UnsafeAllow, UnsafeFlag, UnsafeReject:
+	default:
+		return nil, fmt.Errorf("unknown unsafe photos policy %q", cfg.UnsafePhotos)
+	}
+	switch cfg.BlockedComments {
+	case "":
+		cfg.BlockedComments = BlockedReject
+	case BlockedReject, BlockedHold:
+	default:
+		return nil, fmt.Errorf("unknown blocked comments policy %q", cfg.BlockedComments)
+	}
+	if _, err := blocklist.New(cfg.BlockedWords, cfg.BlockedPatterns); err != nil {
+		return nil, err
+	}
+	switch cfg.SpamDuplicates {
+	case "":
+		cfg.SpamDuplicates = SpamHold
+	case SpamAllow, SpamThrottle, SpamHold:
+	default:
+		return nil, fmt.Errorf("unknown duplicate comments policy %q", cfg.SpamDuplicates)
+	}
+	switch cfg.SpamLinks {
+	case "":
+		cfg.SpamLinks = SpamHold
+	case SpamAllow, SpamThrottle, SpamHold:
+	default:
+		return nil, fmt.Errorf("unknown comment links policy %q", cfg.SpamLinks)
+	}
+	switch cfg.SpamRate {
+	case "":
+		cfg.SpamRate = SpamThrottle
+	case SpamAllow, SpamThrottle, SpamHold:
+	default:
+		return nil, fmt.Errorf("unknown comment rate policy %q", cfg.SpamRate)
+	}
 
 	// Create a new router where we will register HTTP endpoints. The server will pass requests to this router to be
 	// handled.
@@ -78,11 +534,298 @@ func New(cfg Config) (Router, error) {
 	router.RedirectTrailingSlash = false
 	router.RedirectFixedPath = false
 
-	return &_router{
-		router:     router,
-		baseLogger: cfg.Logger,
-		db:         cfg.Database,
-	}, nil
+	tokenSecret := []byte(cfg.TokenSecret)
+
+	if len(tokenSecret) == 0 {
+		cfg.Logger.Warn("no token secret configured, using a random one: the tokens will not survive a restart")
+
+		tokenSecret = make([]byte, 32)
+
+		_, err := rand.Read(tokenSecret)
+		if err != nil {
+			return nil, fmt.Errorf("generating the token secret: %w", err)
+		}
+	}
+
+	if cfg.TokenLifetime == 0 {
+		cfg.TokenLifetime = DefaultTokenLifetime
+	}
+
+	if cfg.RefreshTokenLifetime == 0 {
+		cfg.RefreshTokenLifetime = DefaultRefreshTokenLifetime
+	}
+
+	if cfg.ReactivationWindow == 0 {
+		cfg.ReactivationWindow = DefaultReactivationWindow
+	}
+
+	if cfg.RenameGracePeriod == 0 {
+		cfg.RenameGracePeriod = DefaultRenameGracePeriod
+	}
+
+	if cfg.UsernamePolicy == nil {
+		cfg.UsernamePolicy = usernames.Default()
+	}
+
+	// the users are looked up by the keys of the policy
+	if err := cfg.Database.UseUsernameKey(context.Background(), cfg.UsernamePolicy.Key); err != nil {
+		return nil, fmt.Errorf("applying the username policy: %w", err)
+	}
+
+	if cfg.APIKeyRateLimit == 0 {
+		cfg.APIKeyRateLimit = DefaultAPIKeyRateLimit
+	}
+
+	if cfg.MaxAPIKeyRateLimit == 0 {
+		cfg.MaxAPIKeyRateLimit = DefaultMaxAPIKeyRateLimit
+	}
+
+	if cfg.APIKeyRateLimit > cfg.MaxAPIKeyRateLimit {
+		return nil, errors.New("the rate limit of the API keys exceeds their highest rate limit")
+	}
+
+	if cfg.PublicURL == "" {
+		cfg.PublicURL = DefaultPublicURL
+	}
+
+	if cfg.RequireVerifiedEmail && cfg.Mailer == nil {
+		return nil, errors.New("a mailer is required to verify the email addresses")
+	}
+
+	if cfg.BackupDir == "" {
+		cfg.BackupDir = DefaultBackupDir
+	}
+
+	if cfg.MaxBodySize == 0 {
+		cfg.MaxBodySize = DefaultMaxBodySize
+	}
+
+	if cfg.UploadTimeout == 0 {
+		cfg.UploadTimeout = DefaultUploadTimeout
+	}
+
+	if cfg.LegacySunset.IsZero() {
+		cfg.LegacySunset = DefaultLegacySunset
+	}
+
+	if cfg.MaxPhotoSize == 0 {
+		cfg.MaxPhotoSize = DefaultMaxPhotoSize
+	}
+
+	if cfg.MaxPhotoDimension == 0 {
+		cfg.MaxPhotoDimension = DefaultMaxPhotoDimension
+	}
+
+	if cfg.MaxVideoSize == 0 {
+		cfg.MaxVideoSize = DefaultMaxVideoSize
+	}
+
+	if cfg.MaxVideoDuration == 0 {
+		cfg.MaxVideoDuration = DefaultMaxVideoDuration
+	}
+
+	if cfg.MaxImportSize == 0 {
+		cfg.MaxImportSize = DefaultMaxImportSize
+	}
+
+	if cfg.DuplicateDistance == 0 {
+		cfg.DuplicateDistance = DefaultDuplicateDistance
+	}
+
+	if cfg.MaxPinnedPhotos == 0 {
+		cfg.MaxPinnedPhotos = DefaultMaxPinnedPhotos
+	}
+
+	if cfg.PublishInterval == 0 {
+		cfg.PublishInterval = DefaultPublishInterval
+	}
+
+	if cfg.SpamDuplicateWindow == 0 {
+		cfg.SpamDuplicateWindow = DefaultSpamDuplicateWindow
+	}
+
+	if cfg.SpamMaxLinks == 0 {
+		cfg.SpamMaxLinks = DefaultSpamMaxLinks
+	}
+
+	if cfg.SpamMaxRate == 0 {
+		cfg.SpamMaxRate = DefaultSpamMaxRate
+	}
+
+	if cfg.SpamRateWindow == 0 {
+		cfg.SpamRateWindow = DefaultSpamRateWindow
+	}
+
+	if cfg.StoryLifetime == 0 {
+		cfg.StoryLifetime = DefaultStoryLifetime
+	}
+
+	if cfg.StoryCleanupInterval == 0 {
+		cfg.StoryCleanupInterval = DefaultStoryCleanupInterval
+	}
+
+	if cfg.BanCleanupInterval == 0 {
+		cfg.BanCleanupInterval = DefaultBanCleanupInterval
+	}
+
+	if cfg.ErasureInterval == 0 {
+		cfg.ErasureInterval = DefaultErasureInterval
+	}
+
+	if cfg.ExploreWindow == 0 {
+		cfg.ExploreWindow = DefaultExploreWindow
+	}
+
+	if cfg.NotificationPollInterval == 0 {
+		cfg.NotificationPollInterval = DefaultNotificationPollInterval
+	}
+
+	if cfg.PushInterval == 0 {
+		cfg.PushInterval = DefaultPushInterval
+	}
+
+	if cfg.DigestPeriod == 0 {
+		cfg.DigestPeriod = DefaultDigestPeriod
+	}
+
+	if cfg.DigestCheckInterval == 0 {
+		cfg.DigestCheckInterval = DefaultDigestCheckInterval
+	}
+
+	if cfg.WebhookInterval == 0 {
+		cfg.WebhookInterval = DefaultWebhookInterval
+	}
+
+	if cfg.WebhookTimeout == 0 {
+		cfg.WebhookTimeout = DefaultWebhookTimeout
+	}
+
+	if cfg.WebhookMaxAttempts == 0 {
+		cfg.WebhookMaxAttempts = DefaultWebhookMaxAttempts
+	}
+
+	if cfg.WebhookRetention == 0 {
+		cfg.WebhookRetention = DefaultWebhookRetention
+	}
+
+	if cfg.IdempotencyKeyLifetime == 0 {
+		cfg.IdempotencyKeyLifetime = DefaultIdempotencyKeyLifetime
+	}
+
+	if cfg.IdempotencyCleanupInterval == 0 {
+		cfg.IdempotencyCleanupInterval = DefaultIdempotencyCleanupInterval
+	}
+
+	rt := &_router{
+		router:              router,
+		baseLogger:          cfg.Logger,
+		db:                  cfg.Database,
+		photos:              cfg.Photos,
+		fileLocks:           newFileLocks(),
+		tokenSecret:         tokenSecret,
+		tokenLifetime:       cfg.TokenLifetime,
+		refreshLifetime:     cfg.RefreshTokenLifetime,
+		authProviders:       cfg.AuthProviders,
+		apiKeyRateLimit:     cfg.APIKeyRateLimit,
+		maxAPIKeyRateLimit:  cfg.MaxAPIKeyRateLimit,
+		apiKeyLimiter:       newRateLimiter(),
+		reactivationWindow:  cfg.ReactivationWindow,
+		renameGracePeriod:   cfg.RenameGracePeriod,
+		usernames:           cfg.UsernamePolicy,
+		reservedUsernames:   cfg.ReservedUsernames,
+		blockedUsernames:    cfg.BlockedUsernameTerms,
+		adminToken:          cfg.AdminToken,
+		backupDir:           cfg.BackupDir,
+		maxBodySize:         cfg.MaxBodySize,
+		uploadTimeout:       cfg.UploadTimeout,
+		legacySunset:        cfg.LegacySunset,
+		compress:            cfg.Compress,
+		tracer:              cfg.Tracer,
+		maxPhotoSize:        cfg.MaxPhotoSize,
+		maxPhotoDimension:   cfg.MaxPhotoDimension,
+		maxVideoSize:        cfg.MaxVideoSize,
+		maxVideoDuration:    cfg.MaxVideoDuration,
+		maxImportSize:       cfg.MaxImportSize,
+		framer:              cfg.VideoFramer,
+		duplicatePhotos:     cfg.DuplicatePhotos,
+		duplicateDistance:   cfg.DuplicateDistance,
+		classifier:          cfg.Classifier,
+		unsafePhotos:        cfg.UnsafePhotos,
+		blockedWords:        cfg.BlockedWords,
+		blockedPatterns:     cfg.BlockedPatterns,
+		blockedComments:     cfg.BlockedComments,
+		spamDuplicates:      cfg.SpamDuplicates,
+		spamDuplicateWindow: cfg.SpamDuplicateWindow,
+		spamLinks:           cfg.SpamLinks,
+		spamMaxLinks:        cfg.SpamMaxLinks,
+		spamRate:            cfg.SpamRate,
+		spamMaxRate:         cfg.SpamMaxRate,
+		spamRateWindow:      cfg.SpamRateWindow,
+		maxPinnedPhotos:     cfg.MaxPinnedPhotos,
+		storyLifetime:       cfg.StoryLifetime,
+		exploreWindow:       cfg.ExploreWindow,
+		notificationPoll:    cfg.NotificationPollInterval,
+		pushers:             cfg.Pushers,
+		mailer:              cfg.Mailer,
+		publicURL:           strings.TrimSuffix(cfg.PublicURL, "/"),
+		requireVerified:     cfg.RequireVerifiedEmail,
+		digestPeriod:        cfg.DigestPeriod,
+		webhooks:            webhook.NewSender(cfg.WebhookTimeout),
+		webhookTimeout:      cfg.WebhookTimeout,
+		webhookMaxAttempts:  cfg.WebhookMaxAttempts,
+		webhookRetention:    cfg.WebhookRetention,
+		idempotencyLifetime: cfg.IdempotencyKeyLifetime,
+		closing:             make(chan struct{}),
+		publishDone:         make(chan struct{}),
+		storyCleanupDone:    make(chan struct{}),
+		banCleanupDone:      make(chan struct{}),
+		erasureDone:         make(chan struct{}),
+		pushDone:            make(chan struct{}),
+		digestDone:          make(chan struct{}),
+		webhookDone:         make(chan struct{}),
+		idempotencyDone:     make(chan struct{}),
+	}
+
+	var err error
+
+	rt.graphqlSchema, err = rt.newGraphQLSchema()
+	if err != nil {
+		return nil, fmt.Errorf("building the GraphQL schema: %w", err)
+	}
+
+	// Publish the scheduled photos in the background until the router is closed
+	go rt.publishPhotos(cfg.PublishInterval)
+
+	// Remove the expired stories in the background until the router is closed
+	go rt.cleanupStories(cfg.StoryCleanupInterval)
+
+	// Lift the expired bans in the background until the router is closed
+	go rt.cleanupBans(cfg.BanCleanupInterval)
+
+	// Remove the expired idempotency keys in the background until the router is closed
+	go rt.cleanupIdempotencyKeys(cfg.IdempotencyCleanupInterval)
+
+	// Erase the accounts whose erasure was requested in the background until the router is closed
+	go rt.eraseUsers(cfg.ErasureInterval)
+
+	// Deliver the events to the webhooks in the background until the router is closed
+	go rt.deliverWebhooks(cfg.WebhookInterval)
+
+	// Push the new notifications in the background, if there is any push service
+	if len(rt.pushers) > 0 {
+		go rt.pushNotifications(cfg.PushInterval)
+	} else {
+		close(rt.pushDone)
+	}
+
+	// Send the digests in the background, if there is a mailer
+	if rt.mailer != nil {
+		go rt.sendDigests(cfg.DigestCheckInterval)
+	} else {
+		close(rt.digestDone)
+	}
+
+	return rt, nil
 }
 
 type _router struct {
@@ -93,4 +836,196 @@ type _router struct {
 	baseLogger logrus.FieldLogger
 
 	db database.AppDatabase
+
+	// photos is the storage where the files of the uploaded photos are saved
+	photos storage.BlobStorage
+
+	// fileLocks serialises the saving and the removal of the files of the storage
+	fileLocks *fileLocks
+
+	// tokenSecret is the key signing the tokens which authenticate the users
+	tokenSecret []byte
+
+	// tokenLifetime is how long an access token authenticates its user
+	tokenLifetime time.Duration
+
+	// refreshLifetime is how long a refresh token can be exchanged
+	refreshLifetime time.Duration
+
+	// authProviders are the external identity providers, by their name
+	authProviders map[string]auth.Provider
+
+	// apiKeyRateLimit is the rate limit of the API keys whose user does not choose one
+	apiKeyRateLimit int
+
+	// maxAPIKeyRateLimit is the highest rate limit a user may choose for an API key
+	maxAPIKeyRateLimit int
+
+	// apiKeyLimiter holds the API keys to their rate limit
+	apiKeyLimiter *rateLimiter
+
+	// reactivationWindow is how long a deactivated account can be restored
+	reactivationWindow time.Duration
+
+	// renameGracePeriod is how long the old usernames are reserved and redirected
+	renameGracePeriod time.Duration
+
+	// usernames is the policy of the usernames
+	usernames *usernames.Policy
+
+	// reservedUsernames and blockedUsernames are the usernames and the terms of the configuration no user may choose,
+	// merged into reservation with the ones reserved in the database
+	reservedUsernames []string
+	blockedUsernames  []string
+
+	// reservationMu guards reservation and reservationLoaded, when it was built; it is rebuilt once it is older than
+	// reservationRefresh, or is nil
+	reservationMu     sync.Mutex
+	reservation       *usernames.Reservation
+	reservationLoaded time.Time
+
+	// adminToken is the bearer token authenticating the administrators
+	adminToken string
+
+	// backupDir is the directory where the backups of the database are saved
+	backupDir string
+
+	// maxBodySize is the maximum size in bytes of the body of a request, except for the uploads
+	maxBodySize int64
+
+	// uploadTimeout is how long the uploads may take to be received and answered
+	uploadTimeout time.Duration
+
+	// legacySunset is when the routes without the prefix of a version stop being served
+	legacySunset time.Time
+
+	// compress is whether the JSON responses are compressed
+	compress bool
+
+	// tracer records the traces of the requests, nil if they are not traced
+	tracer *tracing.Tracer
+
+	// maxPhotoSize is the maximum size in bytes of an uploaded photo
+	maxPhotoSize int64
+
+	// maxPhotoDimension is the maximum width and height in pixels of an uploaded photo
+	maxPhotoDimension int
+
+	// maxVideoSize is the maximum size in bytes of an uploaded video
+	maxVideoSize int64
+
+	// maxVideoDuration is the maximum duration of an uploaded video
+	maxVideoDuration time.Duration
+
+	// maxImportSize is the maximum size in bytes of an export archive to be imported
+	maxImportSize int64
+
+	// framer extracts the posters of the uploaded videos, and is nil if the videos have none
+	framer video.Framer
+
+	// duplicatePhotos tells what to do with the photos looking like one of the photos of the same user
+	duplicatePhotos string
+
+	// duplicateDistance is the maximum distance between the hashes of two photos looking alike
+	duplicateDistance int
+
+	// classifier tells whether the uploaded photos are unsafe, and is nil if they are not checked
+	classifier moderation.Classifier
+
+	// unsafePhotos tells what to do with the photos the classifier finds unsafe
+	unsafePhotos string
+
+	// blockedWords and blockedPatterns are the words and the regular expressions of the configuration the comments
+	// must not contain, merged into blocklist with the ones blocked in the database
+	blockedWords    []string
+	blockedPatterns []string
+
+	// blockedComments tells what to do with the comments containing a blocked word or pattern
+	blockedComments string
+
+	// blocklistMu guards blocklist and blocklistLoaded, when it was built; it is rebuilt once it is older than
+	// blocklistRefresh, or is nil
+	blocklistMu     sync.Mutex
+	blocklist       *blocklist.Blocklist
+	blocklistLoaded time.Time
+
+	// spamDuplicates, spamLinks and spamRate tell what to do with the comments failing each spam check, with
+	// the thresholds of the checks
+	spamDuplicates      string
+	spamDuplicateWindow time.Duration
+	spamLinks           string
+	spamMaxLinks        int
+	spamRate            string
+	spamMaxRate         int
+	spamRateWindow      time.Duration
+
+	// spamStats counts the comments checked and the ones found to be spam
+	spamStats spamCounters
+
+	// maxPinnedPhotos is the maximum number of photos a user can pin to the top of their profile
+	maxPinnedPhotos int
+
+	// storyLifetime is how long a story is shown after it is posted
+	storyLifetime time.Duration
+
+	// exploreWindow is how far back the activity ranking the explore feed is counted
+	exploreWindow time.Duration
+
+	// notificationPoll is how often the event streams look for new notifications
+	notificationPoll time.Duration
+
+	// pushers are the push services delivering the notifications, by the platform of the devices
+	pushers map[string]push.Pusher
+
+	// mailer delivers the digests and the verification links, if not nil
+	mailer mail.Mailer
+
+	// publicURL is the url the users reach the API at, without the trailing slash
+	publicURL string
+
+	// requireVerified is whether posting requires a verified email address
+	requireVerified bool
+
+	// digestPeriod is how often a user receives a digest
+	digestPeriod time.Duration
+
+	// webhooks sends the events to the webhooks, each one given webhookTimeout to answer and webhookMaxAttempts
+	// attempts; the ended deliveries are kept for webhookRetention
+	webhooks           *webhook.Sender
+	webhookTimeout     time.Duration
+	webhookMaxAttempts int
+	webhookRetention   time.Duration
+
+	// idempotencyLifetime is how long the responses to the requests sent with an idempotency key are replayed
+	idempotencyLifetime time.Duration
+
+	// graphqlSchema is the schema of the GraphQL API, served at /v1/graphql
+	graphqlSchema *graphql.Schema
+
+	// closing is closed when the router is closed, to stop the background goroutines and the event streams
+	closing chan struct{}
+
+	// publishDone is closed once the publication of the scheduled photos has stopped
+	publishDone chan struct{}
+
+	// storyCleanupDone is closed once the removal of the expired stories has stopped
+	storyCleanupDone chan struct{}
+
+	// banCleanupDone is closed once the removal of the expired bans has stopped
+	banCleanupDone chan struct{}
+
+	// idempotencyDone is closed once the removal of the expired idempotency keys has stopped
+	idempotencyDone chan struct{}
+
+	// erasureDone is closed once the erasure of the accounts has stopped
+	erasureDone chan struct{}
+
+	// pushDone is closed once the delivery of the notifications to the devices has stopped
+	pushDone chan struct{}
+
+	// digestDone is closed once the delivery of the digests has stopped
+	digestDone chan struct{}
+
+	// webhookDone is closed once the delivery of the events to the webhooks has stopped
+	webhookDone chan struct{}
 }
@@ -0,0 +1,258 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/api/reqcontext"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/database"
+	"github.com/julienschmidt/httprouter"
+)
+
+// apiKeyPrefix starts every API key, telling them apart from the access tokens
+const apiKeyPrefix = "wasa_"
+
+// the scopes of the API keys: a read key may only send GET and HEAD requests, while a full key may do anything its
+// user may do, except for managing their sessions and keys
+const (
+	APIKeyScopeRead = "read"
+	APIKeyScopeFull = "full"
+)
+
+// maxAPIKeys is the maximum number of API keys of a user
+const maxAPIKeys = 20
+
+// maxAPIKeyNameLength is the maximum number of characters of the name of an API key
+const maxAPIKeyNameLength = 64
+
+// newAPIKey returns a random API key
+func newAPIKey() (string, error) {
+	key := make([]byte, 32)
+
+	_, err := rand.Read(key)
+
+	if err != nil {
+		return "", err
+	}
+
+	return apiKeyPrefix + base64.RawURLEncoding.EncodeToString(key), nil
+}
+
+// authenticateAPIKey returns the API key at `now`, which must not have been revoked; its last use is then recorded,
+// at most once a minute. The keys which are not accepted are rejected with ErrInvalidAPIKey.
+func (rt *_router) authenticateAPIKey(ctx context.Context, key string, now time.Time) (database.DatabaseAPIKey, error) {
+	dbAPIKey, err := rt.db.GetDatabaseAPIKey(ctx, hashToken(key))
+
+	if errors.Is(err, database.ErrAPIKeyDoesNotExist) {
+		return dbAPIKey, ErrInvalidAPIKey
+	}
+
+	if err != nil {
+		return dbAPIKey, err
+	}
+
+	if dbAPIKey.LastUsedAt == nil || now.Sub(*dbAPIKey.LastUsedAt) >= sessionTouchInterval {
+		err = rt.db.TouchAPIKey(ctx, dbAPIKey, now)
+	}
+
+	return dbAPIKey, err
+}
+
+// checkAPIKeyScope rejects the requests which the API key may not send: the read keys may only read (the GET requests
+// and the calls of the gRPC service, which only reads, while the GraphQL mutations and the requests of a batch are
+// checked as the REST requests they are sent as), and every key is held to its rate limit, the exceeding requests
+// being told when to retry in Retry-After
+func (rt *_router) checkAPIKeyScope(w http.ResponseWriter, r *http.Request, dbAPIKey database.DatabaseAPIKey, now time.Time) (int, error) {
+	if dbAPIKey.Scope == APIKeyScopeRead && r.Method != http.MethodGet && r.Method != http.MethodHead && !isGRPCCall(r) && !isGraphQLRequest(r) && !isBatchRequest(r) {
+		return http.StatusForbidden, ErrAPIKeyScope
+	}
+
+	allowed, retryAfter := rt.apiKeyLimiter.allow(dbAPIKey.Id, dbAPIKey.RateLimit, now)
+
+	if !allowed {
+		w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())+1))
+		return http.StatusTooManyRequests, ErrRateLimited
+	}
+
+	return http.StatusOK, nil
+}
+
+// rejectAPIKey rejects the requests authenticated by an API key, for the actions which require the user to log in
+func rejectAPIKey(ctx reqcontext.RequestContext) (int, error) {
+	if ctx.APIKeyId != 0 {
+		return http.StatusForbidden, ErrAPIKeyUnauthorized
+	}
+
+	return http.StatusOK, nil
+}
+
+func (rt *_router) getAPIKeys(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// the keys are managed by the user alone
+	code, err := rejectAPIKey(ctx)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	// authenticate the user performing the action
+	user, code, err := rt.AuthenticateUserFromParameter(ctx, "uname", r, ps)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	dbAPIKeys, err := rt.db.GetAPIKeys(ctx.Context, user.UserIntoDatabaseUser())
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK) // 200
+
+	// return the keys of the user, without the keys themselves
+	_ = json.NewEncoder(w).Encode(APIKeyListFromDatabaseAPIKeys(dbAPIKeys))
+}
+
+func (rt *_router) createAPIKey(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// the keys are managed by the user alone
+	code, err := rejectAPIKey(ctx)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	// authenticate the user performing the action
+	user, code, err := rt.AuthenticateUserFromParameter(ctx, "uname", r, ps)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	apiKey := APIKeyDefault()
+
+	// get the name, the scope and the rate limit of the key from the request body
+	code, err = decodeJSON(r, &apiKey)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	apiKey.Name = strings.TrimSpace(apiKey.Name)
+
+	if length := utf8.RuneCountInString(apiKey.Name); length == 0 || length > maxAPIKeyNameLength {
+		writeError(w, ErrInvalidAPIKeyName, http.StatusBadRequest)
+		return
+	}
+
+	if apiKey.Scope != APIKeyScopeRead && apiKey.Scope != APIKeyScopeFull {
+		writeError(w, ErrInvalidAPIKeyScope, http.StatusBadRequest)
+		return
+	}
+
+	if apiKey.RateLimit == 0 {
+		apiKey.RateLimit = rt.apiKeyRateLimit
+	}
+
+	if apiKey.RateLimit < 0 || apiKey.RateLimit > rt.maxAPIKeyRateLimit {
+		writeError(w, ErrInvalidRateLimit, http.StatusBadRequest)
+		return
+	}
+
+	apiKey.Key, err = newAPIKey()
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	apiKey.CreatedAt = time.Now().UTC().Truncate(time.Second)
+
+	dbAPIKey := database.DatabaseAPIKeyDefault()
+	dbAPIKey.User = user.UserIntoDatabaseUser()
+	dbAPIKey.Name = apiKey.Name
+	dbAPIKey.KeyHash = hashToken(apiKey.Key)
+	dbAPIKey.Scope = apiKey.Scope
+	dbAPIKey.RateLimit = apiKey.RateLimit
+	dbAPIKey.CreatedAt = apiKey.CreatedAt
+
+	// insert the key into the database, unless the user has too many
+	err = rt.db.InsertAPIKey(ctx.Context, &dbAPIKey, maxAPIKeys)
+
+	if errors.Is(err, database.ErrTooManyAPIKeys) {
+		writeError(w, ErrTooManyAPIKeys, http.StatusConflict)
+		return
+	}
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	apiKey.Id = dbAPIKey.Id
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated) // 201
+
+	// return the minted key, which is never shown again
+	_ = json.NewEncoder(w).Encode(apiKey)
+}
+
+func (rt *_router) deleteAPIKey(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// the keys are managed by the user alone
+	code, err := rejectAPIKey(ctx)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	// authenticate the user performing the action
+	user, code, err := rt.AuthenticateUserFromParameter(ctx, "uname", r, ps)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	// get the key to be revoked from the resource parameter
+	keyId, err := strconv.ParseUint(ps.ByName("key_id"), 10, 32)
+
+	if err != nil {
+		writeError(w, ErrPageNotFound, http.StatusNotFound)
+		return
+	}
+
+	dbAPIKey := database.DatabaseAPIKeyDefault()
+	dbAPIKey.Id = uint32(keyId)
+	dbAPIKey.User = user.UserIntoDatabaseUser()
+
+	// revoke the key, which must belong to the user
+	err = rt.db.DeleteAPIKey(ctx.Context, dbAPIKey)
+
+	if errors.Is(err, database.ErrAPIKeyDoesNotExist) {
+		writeError(w, err, http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent) // 204
+}
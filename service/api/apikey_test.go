@@ -0,0 +1,143 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/database"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/storage"
+	"github.com/sirupsen/logrus"
+)
+
+// newTestHandler returns the handler of a router over the memory database, storing the photos in a temporary directory
+func newTestHandler(t *testing.T) http.Handler {
+	t.Helper()
+
+	photos, err := storage.NewDisk(t.TempDir(), PhotoUrlPrefix)
+
+	if err != nil {
+		t.Fatalf("creating the photo storage: %v", err)
+	}
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	router, err := New(Config{
+		Logger:   logger,
+		Database: database.NewMemory(),
+		Photos:   photos,
+	})
+
+	if err != nil {
+		t.Fatalf("creating the router: %v", err)
+	}
+
+	t.Cleanup(func() { _ = router.Close() })
+
+	return router.Handler()
+}
+
+// serve sends the request to the handler with the bearer token `token`, decoding the JSON response into `v` if not nil
+func serve(t *testing.T, handler http.Handler, method string, path string, token string, body string, v interface{}) int {
+	t.Helper()
+
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+
+	if body != "" {
+		r.Header.Set("Content-Type", "application/json")
+	}
+
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	if v != nil {
+		err := json.NewDecoder(w.Body).Decode(v)
+
+		if err != nil {
+			t.Fatalf("decoding the response to %s %s: %v", method, path, err)
+		}
+	}
+
+	return w.Code
+}
+
+// readAPIKey logs the user `username` in, returning an API key of theirs which can only read
+func readAPIKey(t *testing.T, handler http.Handler, username string) string {
+	t.Helper()
+
+	var session struct {
+		Token string `json:"token"`
+	}
+
+	code := serve(t, handler, http.MethodPost, "/v1/session", "", `{"username":"`+username+`"}`, &session)
+
+	if code != http.StatusOK && code != http.StatusCreated {
+		t.Fatalf("got %d logging %s in", code, username)
+	}
+
+	var key struct {
+		Key string `json:"key"`
+	}
+
+	code = serve(t, handler, http.MethodPost, "/v1/user/"+username+"/keys", session.Token, `{"name":"reader","scope":"read"}`, &key)
+
+	if code != http.StatusCreated {
+		t.Fatalf("got %d creating the API key", code)
+	}
+
+	return key.Key
+}
+
+func TestReadAPIKeyScope(t *testing.T) {
+	handler := newTestHandler(t)
+	key := readAPIKey(t, handler, "alice")
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		want   int
+	}{
+		// the routes ending with a username are not exempt, whatever the username
+		{"following batch", http.MethodPut, "/v1/user/alice/follow/batch", "", http.StatusForbidden},
+		{"following graphql", http.MethodPut, "/v1/user/alice/follow/graphql", "", http.StatusForbidden},
+		{"banning batch", http.MethodPut, "/v1/user/alice/ban/batch", "", http.StatusForbidden},
+		{"muting graphql", http.MethodPut, "/v1/user/alice/mute/graphql", "", http.StatusForbidden},
+		{"unfollowing graphql", http.MethodDelete, "/v1/user/alice/follow/graphql", "", http.StatusForbidden},
+		{"following batch by the legacy route", http.MethodPut, "/user/alice/follow/batch", "", http.StatusForbidden},
+
+		// the batches and the GraphQL queries check their requests one by one
+		{"batch", http.MethodPost, "/v1/batch", `[{"method":"GET","path":"/v1/user/alice"}]`, http.StatusOK},
+		{"GraphQL query", http.MethodPost, "/v1/graphql", `{"query":"{ me { username } }"}`, http.StatusOK},
+
+		{"reading", http.MethodGet, "/v1/user/alice", "", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code := serve(t, handler, tt.method, tt.path, key, tt.body, nil); code != tt.want {
+				t.Errorf("got %d, want %d", code, tt.want)
+			}
+		})
+	}
+
+	// a write sent within a batch is held to the scope as well
+	var responses []struct {
+		Status int `json:"status"`
+	}
+
+	code := serve(t, handler, http.MethodPost, "/v1/batch", key, `[{"method":"PUT","path":"/v1/user/alice/follow/batch"}]`, &responses)
+
+	if code != http.StatusOK || len(responses) != 1 || responses[0].Status != http.StatusForbidden {
+		t.Errorf("got %d and the responses %v, want the write within the batch refused with 403", code, responses)
+	}
+}
@@ -0,0 +1,139 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/api/reqcontext"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/imaging"
+	"github.com/julienschmidt/httprouter"
+)
+
+// avatarSize is the side in pixels of the avatars, which are cropped to a square and scaled down to it
+const avatarSize = 256
+
+func (rt *_router) setMyAvatar(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// authenticate the user performing the action
+	user, code, err := rt.AuthenticateUserFromParameter(ctx, "uname", r, ps)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	// read the image of the avatar from the multipart
+	// form, with the same checks as the photos
+	content, contentType, code, err := rt.readUploadedPhoto(r)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	// the avatar is shown next to the user everywhere, hence
+	// an unsafe one is rejected rather than being flagged
+	flagged, err := rt.classifyPhoto(ctx, content, contentType)
+
+	if err == nil && flagged {
+		err = ErrUnsafePhoto
+	}
+
+	if err != nil {
+		writeError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	// crop the image to a square and scale it down
+	content, err = imaging.Square(content, contentType, avatarSize)
+
+	if errors.Is(err, imaging.ErrUnsupportedFormat) {
+		writeError(w, ErrUnsupportedPhoto, http.StatusUnsupportedMediaType)
+		return
+	}
+
+	if err != nil {
+		writeError(w, ErrInvalidPhoto, http.StatusBadRequest)
+		return
+	}
+
+	// the hash of the content names the file, as for the photos
+	name := photoContentName(content, imaging.JPEG)
+
+	// hold the file until the avatar is set, so that no other
+	// request removes it as unused in between
+	unlock := rt.fileLocks.lock(name)
+
+	// save the avatar in the storage
+	err = rt.photos.Put(ctx.Context, name, bytes.NewReader(content), imaging.JPEG)
+
+	if err != nil {
+		unlock()
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	user.Avatar = rt.photos.URL(name)
+
+	oldAvatar, err := rt.db.SetUserAvatar(ctx.Context, user.UserIntoDatabaseUser(), user.Avatar)
+
+	if err != nil {
+		// the file of an avatar which was not saved is never
+		// served, unless a photo or another avatar has it
+		_ = rt.removePhotoFile(ctx.Context, name)
+		unlock()
+
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	// the old avatar may be the same image, whose file is locked
+	unlock()
+
+	rt.deleteAvatarFile(ctx, oldAvatar)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK) // 200
+
+	// return the user with their new avatar
+	_ = json.NewEncoder(w).Encode(user)
+}
+
+func (rt *_router) deleteMyAvatar(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// authenticate the user performing the action
+	user, code, err := rt.AuthenticateUserFromParameter(ctx, "uname", r, ps)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	oldAvatar, err := rt.db.SetUserAvatar(ctx.Context, user.UserIntoDatabaseUser(), "")
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	rt.deleteAvatarFile(ctx, oldAvatar)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusNoContent) // 204
+}
+
+// deleteAvatarFile removes the file of the avatar served at `url` from the storage, unless it is still used; the avatar
+// is already replaced, so a failure is only logged
+func (rt *_router) deleteAvatarFile(ctx reqcontext.RequestContext, url string) {
+	name, ok := rt.photoFileName(url)
+
+	if url == "" || !ok {
+		return
+	}
+
+	err := rt.deletePhotoFile(ctx.Context, name)
+
+	if err != nil {
+		ctx.Logger.WithError(err).WithField("file", name).Warn("cannot remove the file of the avatar")
+	}
+}
@@ -1,42 +1,100 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
+	"time"
+	"unicode/utf8"
 
 	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/api/reqcontext"
 	"github.com/julienschmidt/httprouter"
 )
 
+// maxBanReasonLength is the maximum number of characters of the reason of a ban
+const maxBanReasonLength = 256
+
+func (rt *_router) getBannedUsers(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// authenticate the user performing the action,
+	// as only they can see whom they banned
+	user, code, err := rt.AuthenticateUserFromParameter(ctx, "uname", r, ps)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	// get the ban list from the database
+	dbBanList, err := rt.db.GetBanList(ctx.Context, user.UserIntoDatabaseUser())
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK) // 200
+
+	// return the ban list
+	_ = json.NewEncoder(w).Encode(BanListFromDatabaseBanList(dbBanList))
+}
+
 func (rt *_router) banUser(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
 	// authenticate the user performing the action
-	user, code, err := rt.AuthenticateUserFromParameter("uname", r, ps)
+	user, code, err := rt.AuthenticateUserFromParameter(ctx, "uname", r, ps)
 
 	if err != nil {
-		http.Error(w, err.Error(), code)
+		writeError(w, err, code)
 		return
 	}
 
 	// get the user to be banned from the resource parameter
-	bannedUser, code, err := rt.GetUserFromParameter("banned_uname", r, ps)
+	bannedUser, code, err := rt.GetUserFromParameter(ctx, "banned_uname", r, ps)
 
 	if err != nil {
-		http.Error(w, err.Error(), code)
+		writeError(w, err, code)
 		return
 	}
 
 	// check whether the user performing the ban and the user
 	// to be banned are the same
 	if user.Id == bannedUser.Id {
-		http.Error(w, ErrSelfBan.Error(), http.StatusBadRequest)
+		writeError(w, ErrSelfBan, http.StatusBadRequest)
 		return
 	}
 
-	// insert the ban into the database
-	err = rt.db.InsertBan(user.UserIntoDatabaseUser(), bannedUser.UserIntoDatabaseUser())
+	ban := BanDefault()
+
+	// get the reason and the expiry of the ban from the
+	// request body, which can be left empty for a ban
+	// without a reason which never expires
+	code, err = decodeJSON(r, &ban)
+
+	if err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, err, code)
+		return
+	}
+
+	if utf8.RuneCountInString(ban.Reason) > maxBanReasonLength {
+		writeError(w, ErrInvalidBanReason, http.StatusBadRequest)
+		return
+	}
+
+	if ban.ExpiresAt != nil && !ban.ExpiresAt.After(time.Now()) {
+		writeError(w, ErrInvalidBanExpiry, http.StatusBadRequest)
+		return
+	}
+
+	ban.User = bannedUser
+
+	// insert the ban into the database, or replace
+	// the reason and the expiry of the existing one
+	err = rt.db.InsertBan(ctx.Context, user.UserIntoDatabaseUser(), ban.BanIntoDatabaseBan())
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err, http.StatusInternalServerError)
 		return
 	}
 
@@ -49,29 +107,60 @@ func (rt *_router) banUser(w http.ResponseWriter, r *http.Request, ps httprouter
 
 func (rt *_router) unbanUser(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
 	// authenticate the user performing the action
-	user, code, err := rt.AuthenticateUserFromParameter("uname", r, ps)
+	user, code, err := rt.AuthenticateUserFromParameter(ctx, "uname", r, ps)
 
 	if err != nil {
-		http.Error(w, err.Error(), code)
+		writeError(w, err, code)
 		return
 	}
 
 	// get the banned user from the resource parameter
-	bannedUser, code, err := rt.GetUserFromParameter("banned_uname", r, ps)
+	bannedUser, code, err := rt.GetUserFromParameter(ctx, "banned_uname", r, ps)
 
 	if err != nil {
-		http.Error(w, err.Error(), code)
+		writeError(w, err, code)
 		return
 	}
 
 	// remove the ban from the database
-	err = rt.db.DeleteBan(user.UserIntoDatabaseUser(), bannedUser.UserIntoDatabaseUser())
+	err = rt.db.DeleteBan(ctx.Context, user.UserIntoDatabaseUser(), bannedUser.UserIntoDatabaseUser())
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err, http.StatusInternalServerError)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusNoContent) // 204
 }
+
+// cleanupBans lifts the expired bans every `interval`, until the router is closed
+func (rt *_router) cleanupBans(interval time.Duration) {
+	defer close(rt.banCleanupDone)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-rt.closing:
+			return
+		case <-ticker.C:
+			rt.deleteExpiredBans()
+		}
+	}
+}
+
+// deleteExpiredBans lifts the bans which have expired
+func (rt *_router) deleteExpiredBans() {
+	deleted, err := rt.db.DeleteExpiredBans(context.Background(), time.Now())
+
+	if err != nil {
+		rt.baseLogger.WithError(err).Error("cannot lift the expired bans")
+		return
+	}
+
+	if deleted > 0 {
+		rt.baseLogger.WithField("bans", deleted).Debug("expired bans lifted")
+	}
+}
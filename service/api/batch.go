@@ -0,0 +1,142 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/api/reqcontext"
+	"github.com/julienschmidt/httprouter"
+)
+
+// maxBatchRequests is the maximum number of requests of a batch
+const maxBatchRequests = 20
+
+// batchMethods are the methods of the requests of a batch
+var batchMethods = map[string]bool{
+	http.MethodGet:    true,
+	http.MethodPost:   true,
+	http.MethodPut:    true,
+	http.MethodDelete: true,
+}
+
+// batchPath is the path of the batches, under the prefix of every version of the API
+const batchPath = "/batch"
+
+// isBatchRequest reports whether the request is a batch, whose requests are held to the scope of the API key one by
+// one. The path must be the one of the batches exactly, since the other routes may end with a username.
+func isBatchRequest(r *http.Request) bool {
+	return r.Method == http.MethodPost && unversionedPath(r.URL.Path) == batchPath
+}
+
+func (rt *_router) batch(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	var requests []BatchRequest
+
+	// get the requests of the batch from the request body
+	code, err := decodeJSON(r, &requests)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	if len(requests) == 0 || len(requests) > maxBatchRequests {
+		writeErrorDetails(w, ErrInvalidBatch, http.StatusBadRequest, map[string]int{"max_requests": maxBatchRequests})
+		return
+	}
+
+	// check every request before sending any, so that
+	// a batch is either rejected or sent as a whole
+	for i, request := range requests {
+		if !validBatchRequest(request) {
+			writeErrorDetails(w, ErrInvalidBatchRequest, http.StatusBadRequest, map[string]int{"index": i})
+			return
+		}
+	}
+
+	responses := make([]BatchResponse, len(requests))
+
+	// send the requests one after the other, in their order, with the
+	// credentials of the batch, so that every request is checked and
+	// answered as if the client sent it on its own
+	for i, request := range requests {
+		header := make(http.Header)
+
+		for name, value := range request.Headers {
+			header.Set(name, value)
+		}
+
+		var body interface{}
+
+		if len(request.Body) > 0 {
+			body = request.Body
+		}
+
+		res, err := rt.subrequest(ctx, r, request.Method, request.Path, header, body)
+
+		if err != nil {
+			writeError(w, err, http.StatusInternalServerError)
+			return
+		}
+
+		responses[i] = batchResponse(res)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK) // 200
+
+	// return the responses, in the order of the requests
+	_ = json.NewEncoder(w).Encode(responses)
+}
+
+// validBatchRequest reports whether the request of a batch is sent to a route of the API, which is not a batch itself
+func validBatchRequest(request BatchRequest) bool {
+	if !batchMethods[request.Method] {
+		return false
+	}
+
+	u, err := url.Parse(request.Path)
+
+	if err != nil || u.Scheme != "" || u.Host != "" || !versionedPath(u.Path) {
+		return false
+	}
+
+	return unversionedPath(path.Clean(u.Path)) != batchPath
+}
+
+// batchResponse returns the response to a request of a batch
+func batchResponse(res *subresponse) BatchResponse {
+	response := BatchResponse{
+		Status:  res.status,
+		Headers: make(map[string]string, len(res.header)),
+	}
+
+	// the handlers writing nothing answered with 200
+	if response.Status == 0 {
+		response.Status = http.StatusOK
+	}
+
+	for name, values := range res.header {
+		response.Headers[name] = strings.Join(values, ", ")
+	}
+
+	body := res.body.Bytes()
+
+	if len(body) == 0 {
+		return response
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(res.header.Get("Content-Type"))
+
+	if mediaType == "application/json" {
+		response.Body = bytes.TrimSpace(body)
+	} else {
+		response.Body, _ = json.Marshal(string(body))
+	}
+
+	return response
+}
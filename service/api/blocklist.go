@@ -0,0 +1,291 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/api/reqcontext"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/blocklist"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/webhook"
+	"github.com/julienschmidt/httprouter"
+)
+
+// blocklistRefresh is how long the blocklist is kept before it is built again, so that the terms blocked through
+// another instance of the backend are picked up
+const blocklistRefresh = time.Minute
+
+// maxBlockedTermLength is the maximum length of a blocked word or pattern
+const maxBlockedTermLength = 256
+
+// currentBlocklist returns the blocklist merging the words and the patterns of the configuration with the ones
+// blocked in the database, building it again if it is older than blocklistRefresh
+func (rt *_router) currentBlocklist(ctx context.Context) (*blocklist.Blocklist, error) {
+	rt.blocklistMu.Lock()
+	current, loaded := rt.blocklist, rt.blocklistLoaded
+	rt.blocklistMu.Unlock()
+
+	if current != nil && time.Since(loaded) < blocklistRefresh {
+		return current, nil
+	}
+
+	dbBlockedTerms, err := rt.db.GetBlockedTerms(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	words := append([]string{}, rt.blockedWords...)
+	patterns := append([]string{}, rt.blockedPatterns...)
+
+	for _, dbBlockedTerm := range dbBlockedTerms {
+		if dbBlockedTerm.Pattern {
+			patterns = append(patterns, dbBlockedTerm.Term)
+		} else {
+			words = append(words, dbBlockedTerm.Term)
+		}
+	}
+
+	current, err = blocklist.New(words, patterns)
+
+	if err != nil {
+		return nil, err
+	}
+
+	rt.blocklistMu.Lock()
+	rt.blocklist, rt.blocklistLoaded = current, time.Now()
+	rt.blocklistMu.Unlock()
+
+	return current, nil
+}
+
+// resetBlocklist drops the blocklist, which is built again the next time it is needed
+func (rt *_router) resetBlocklist() {
+	rt.blocklistMu.Lock()
+	rt.blocklist = nil
+	rt.blocklistMu.Unlock()
+}
+
+func (rt *_router) getBlocklist(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// authenticate the administrator performing the action
+	err := CheckAdminAuthorization(rt.adminToken, r.Header.Get("Authorization"))
+
+	if err != nil {
+		writeError(w, err, http.StatusUnauthorized)
+		return
+	}
+
+	// get the terms blocked in the database; the ones of
+	// the configuration cannot be changed, hence are not listed
+	dbBlockedTerms, err := rt.db.GetBlockedTerms(ctx.Context)
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK) // 200
+
+	// return the blocked terms
+	_ = json.NewEncoder(w).Encode(BlockedTermListFromDatabaseBlockedTermArray(dbBlockedTerms))
+}
+
+func (rt *_router) blockTerm(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// authenticate the administrator performing the action
+	err := CheckAdminAuthorization(rt.adminToken, r.Header.Get("Authorization"))
+
+	if err != nil {
+		writeError(w, err, http.StatusUnauthorized)
+		return
+	}
+
+	blockedTerm := BlockedTermDefault()
+
+	// get the term to be blocked from the request body
+	code, err := decodeJSON(r, &blockedTerm)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	blockedTerm.Term = strings.TrimSpace(blockedTerm.Term)
+
+	// check that the term is valid, compiling it as the blocklist would
+	if len(blockedTerm.Term) == 0 || len(blockedTerm.Term) > maxBlockedTermLength {
+		writeError(w, ErrInvalidBlockedTerm, http.StatusBadRequest)
+		return
+	}
+
+	if blockedTerm.Pattern {
+		_, err = blocklist.New(nil, []string{blockedTerm.Term})
+	} else {
+		_, err = blocklist.New([]string{blockedTerm.Term}, nil)
+	}
+
+	if err != nil {
+		writeError(w, ErrInvalidBlockedTerm, http.StatusBadRequest)
+		return
+	}
+
+	dbBlockedTerm := blockedTerm.BlockedTermIntoDatabaseBlockedTerm()
+
+	// insert the term into the database
+	err = rt.db.InsertBlockedTerm(ctx.Context, &dbBlockedTerm)
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	rt.resetBlocklist()
+
+	ctx.Logger.WithField("term", dbBlockedTerm.Id).Info("term blocked by the administrators")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated) // 201
+
+	// return the newly blocked term
+	_ = json.NewEncoder(w).Encode(BlockedTermFromDatabaseBlockedTerm(dbBlockedTerm))
+}
+
+func (rt *_router) unblockTerm(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// authenticate the administrator performing the action
+	err := CheckAdminAuthorization(rt.adminToken, r.Header.Get("Authorization"))
+
+	if err != nil {
+		writeError(w, err, http.StatusUnauthorized)
+		return
+	}
+
+	// get the term to be unblocked from the resource parameter
+	termId, err := strconv.ParseUint(ps.ByName("term_id"), 10, 32)
+
+	if err != nil {
+		writeError(w, ErrPageNotFound, http.StatusNotFound)
+		return
+	}
+
+	// remove the term from the database
+	err = rt.db.DeleteBlockedTerm(ctx.Context, uint32(termId))
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	rt.resetBlocklist()
+
+	ctx.Logger.WithField("term", termId).Info("term unblocked by the administrators")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusNoContent) // 204
+}
+
+func (rt *_router) getHeldComments(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// authenticate the administrator performing the action
+	err := CheckAdminAuthorization(rt.adminToken, r.Header.Get("Authorization"))
+
+	if err != nil {
+		writeError(w, err, http.StatusUnauthorized)
+		return
+	}
+
+	// get the pagination parameters from the query
+	limit, after, code, err := GetPageFromQuery(r)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	// get the page of the comments waiting for a review
+	dbHeldCommentList, err := rt.db.GetHeldCommentList(ctx.Context, limit, after)
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK) // 200
+
+	// return the page of the held comments
+	_ = json.NewEncoder(w).Encode(HeldCommentListFromDatabaseHeldCommentList(dbHeldCommentList))
+}
+
+func (rt *_router) approveHeldComment(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// authenticate the administrator performing the action
+	err := CheckAdminAuthorization(rt.adminToken, r.Header.Get("Authorization"))
+
+	if err != nil {
+		writeError(w, err, http.StatusUnauthorized)
+		return
+	}
+
+	// get the held comment from the resource parameter
+	heldId, err := strconv.ParseUint(ps.ByName("held_id"), 10, 32)
+
+	if err != nil {
+		writeError(w, ErrPageNotFound, http.StatusNotFound)
+		return
+	}
+
+	// publish the comment under its photo
+	dbComment, err := rt.db.ReleaseHeldComment(ctx.Context, uint32(heldId))
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	ctx.Logger.WithField("comment", dbComment.Id).Info("held comment approved by the administrators")
+
+	// announce the comment to the webhooks as if it had
+	// been written now, as seen by its author
+	dbComment, err = rt.db.GetDatabaseComment(ctx.Context, dbComment.Id, dbComment.User)
+
+	if err != nil {
+		ctx.Logger.WithError(err).Error("cannot get the approved comment for the webhooks")
+	} else {
+		rt.emitEvent(ctx, webhook.EventCommentCreated, dbComment.User.Id, CommentFromDatabaseComment(dbComment))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusNoContent) // 204
+}
+
+func (rt *_router) rejectHeldComment(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// authenticate the administrator performing the action
+	err := CheckAdminAuthorization(rt.adminToken, r.Header.Get("Authorization"))
+
+	if err != nil {
+		writeError(w, err, http.StatusUnauthorized)
+		return
+	}
+
+	// get the held comment from the resource parameter
+	heldId, err := strconv.ParseUint(ps.ByName("held_id"), 10, 32)
+
+	if err != nil {
+		writeError(w, ErrPageNotFound, http.StatusNotFound)
+		return
+	}
+
+	// discard the comment
+	err = rt.db.DeleteHeldComment(ctx.Context, uint32(heldId))
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	ctx.Logger.WithField("held_comment", heldId).Info("held comment rejected by the administrators")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusNoContent) // 204
+}
@@ -0,0 +1,41 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+)
+
+// decodeJSON decodes the JSON body of the request into `v`, returning the status code and the error to be returned if
+// it cannot: the bodies exceeding the limit of the route are rejected with 413 and the ones the client did not finish
+// sending in time with 408, while the malformed ones are a bad request
+func decodeJSON(r *http.Request, v interface{}) (int, error) {
+	err := json.NewDecoder(r.Body).Decode(v)
+
+	if err != nil {
+		return requestBodyError(err)
+	}
+
+	return http.StatusOK, nil
+}
+
+// requestBodyError returns the status code and the error to be returned when reading the body of the request failed
+// with `err`
+func requestBodyError(err error) (int, error) {
+	var tooLarge *http.MaxBytesError
+
+	if errors.As(err, &tooLarge) {
+		return http.StatusRequestEntityTooLarge, ErrRequestTooLarge
+	}
+
+	var netErr net.Error
+
+	// the read timeout of the server expired
+	// while the body was still being received
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return http.StatusRequestTimeout, ErrRequestTimeout
+	}
+
+	return http.StatusBadRequest, err
+}
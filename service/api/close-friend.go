@@ -0,0 +1,103 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/api/reqcontext"
+	"github.com/julienschmidt/httprouter"
+)
+
+func (rt *_router) getCloseFriends(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// authenticate the user performing the action,
+	// as only they can see their close friends
+	user, code, err := rt.AuthenticateUserFromParameter(ctx, "uname", r, ps)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	// get the close friends list from the database
+	dbCloseFriendsList, err := rt.db.GetCloseFriendsList(ctx.Context, user.UserIntoDatabaseUser())
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK) // 200
+
+	// return the close friends list
+	_ = json.NewEncoder(w).Encode(UserListFromDatabaseUserList(dbCloseFriendsList))
+}
+
+func (rt *_router) addCloseFriend(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// authenticate the user performing the action
+	user, code, err := rt.AuthenticateUserFromParameter(ctx, "uname", r, ps)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	// get the close friend to be added from the resource parameter
+	friendUser, code, err := rt.GetUserFromParameter(ctx, "friend_uname", r, ps)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	// check whether the user performing the action and
+	// the close friend to be added are the same
+	if user.Id == friendUser.Id {
+		writeError(w, ErrSelfCloseFriend, http.StatusBadRequest)
+		return
+	}
+
+	// insert the close friend into the database, which
+	// fails if the friend does not follow the user
+	err = rt.db.InsertCloseFriend(ctx.Context, user.UserIntoDatabaseUser(), friendUser.UserIntoDatabaseUser())
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK) // 200
+
+	// return the close friend
+	_ = json.NewEncoder(w).Encode(friendUser)
+}
+
+func (rt *_router) removeCloseFriend(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// authenticate the user performing the action
+	user, code, err := rt.AuthenticateUserFromParameter(ctx, "uname", r, ps)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	// get the close friend from the resource parameter
+	friendUser, code, err := rt.GetUserFromParameter(ctx, "friend_uname", r, ps)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	// remove the close friend from the database
+	err = rt.db.DeleteCloseFriend(ctx.Context, user.UserIntoDatabaseUser(), friendUser.UserIntoDatabaseUser())
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusNoContent) // 204
+}
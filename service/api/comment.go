@@ -4,90 +4,112 @@ import (
 	"encoding/json"
 	"net/http"
 	"strconv"
+	"sync/atomic"
 	"time"
 
 	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/api/reqcontext"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/database"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/webhook"
 	"github.com/julienschmidt/httprouter"
 )
 
 func (rt *_router) getPhotoComments(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
-	// get the bearer token
-	token, err := GetBearerToken(r.Header.Get("Authorization"))
+	// get the user authenticated by the bearer token
+	userId, err := GetAuthenticatedUserId(ctx)
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusUnauthorized)
+		writeError(w, err, http.StatusUnauthorized)
 		return
 	}
 
 	// get the user performing the action
-	dbUser, err := rt.db.GetDatabaseUser(uint32(token))
+	dbUser, err := rt.db.GetDatabaseUser(ctx.Context, userId)
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err, http.StatusInternalServerError)
 		return
 	}
 
 	// get the user of the photo from the resource parameter
-	photoUser, code, err := rt.GetUserFromParameter("uname", r, ps)
+	photoUser, code, err := rt.GetUserFromParameter(ctx, "uname", r, ps)
 
 	if err != nil {
-		http.Error(w, err.Error(), code)
+		writeError(w, err, code)
 		return
 	}
 
 	// check whether the user of the photo
 	// has banned the user performing the action
-	checkBan, err := rt.db.CheckBan(photoUser.UserIntoDatabaseUser(), dbUser)
+	checkBan, err := rt.db.CheckBan(ctx.Context, photoUser.UserIntoDatabaseUser(), dbUser)
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err, http.StatusInternalServerError)
 		return
 	}
 
 	if checkBan {
-		http.Error(w, ErrBannedUser.Error(), http.StatusUnauthorized)
+		writeError(w, ErrBannedUser, http.StatusUnauthorized)
 		return
 	}
 
 	// get the photo from the resource parameter
-	photo, code, err := rt.GetPhotoFromParameter("photo_id", UserFromDatabaseUser(dbUser), r, ps)
+	photo, code, err := rt.GetPhotoFromParameter(ctx, "photo_id", UserFromDatabaseUser(dbUser), r, ps)
 
 	if err != nil {
-		http.Error(w, err.Error(), code)
+		writeError(w, err, code)
 		return
 	}
 
 	// check if the resource is consistent
 	if photo.User.Id != photoUser.Id {
-		http.Error(w, ErrPageNotFound.Error(), http.StatusNotFound)
+		writeError(w, ErrPageNotFound, http.StatusNotFound)
 		return
 	}
 
-	// get the comment list from the database
-	dbCommentList, err := rt.db.GetCommentList(photo.PhotoIntoDatabasePhoto(), dbUser)
+	// get the pagination parameters from the query
+	limit, after, code, err := GetPageFromQuery(r)
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err, code)
+		return
+	}
+
+	// get the order of the comments from the query
+	sort, code, err := GetCommentSortFromQuery(r)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	// get the page of the comment list from the database
+	dbCommentList, err := rt.db.GetCommentList(ctx.Context, photo.PhotoIntoDatabasePhoto(), dbUser, sort, limit, after)
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
 		return
 	}
 
 	commentList := CommentListFromDatabaseCommentList(dbCommentList)
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK) // 200
+	list := ItemList{Items: commentList.Comments, Total: &photo.CommentCount}
+
+	if len(commentList.Comments) > 0 {
+		list.NextCursor = nextCursor(len(commentList.Comments), limit, commentList.Comments[len(commentList.Comments)-1].Id)
+	}
 
 	// return the comment list
-	_ = json.NewEncoder(w).Encode(commentList)
+	writeList(w, r, commentList, list, "after")
 }
 
 func (rt *_router) commentPhoto(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
 	comment := CommentDefault()
 
 	// get the comment information from the request body
-	err := json.NewDecoder(r.Body).Decode(&comment)
+	code, err := decodeJSON(r, &comment)
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err, code)
 		return
 	}
 
@@ -96,62 +118,119 @@ func (rt *_router) commentPhoto(w http.ResponseWriter, r *http.Request, ps httpr
 	commentLogin.Username = comment.User.Username
 
 	// get the user performing the action from the database
-	commentUser, err := rt.GetUserFromLogin(commentLogin)
+	commentUser, err := rt.GetUserFromLogin(ctx, commentLogin)
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err, http.StatusInternalServerError)
 		return
 	}
 
 	// check whether the user id specified
 	// in the request body matches the real user id
 	if comment.User.Id != commentUser.Id {
-		http.Error(w, ErrUserDoesNotExist.Error(), http.StatusUnauthorized)
+		writeError(w, ErrUserDoesNotExist, http.StatusUnauthorized)
 		return
 	}
 
 	// check if the bearer token matches the
 	// user specified in the request body
-	err = CheckAuthorization(comment.User, r.Header.Get("Authorization"))
+	err = CheckAuthorization(comment.User, ctx)
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusUnauthorized)
+		writeError(w, err, http.StatusUnauthorized)
 		return
 	}
 
 	// get the user of the photo from the resource parameter
-	user, code, err := rt.GetUserFromParameter("uname", r, ps)
+	user, code, err := rt.GetUserFromParameter(ctx, "uname", r, ps)
 
 	if err != nil {
-		http.Error(w, err.Error(), code)
+		writeError(w, err, code)
 		return
 	}
 
 	// get the photo from the resource parameter
-	photo, code, err := rt.GetPhotoFromParameter("photo_id", commentUser, r, ps)
+	photo, code, err := rt.GetPhotoFromParameter(ctx, "photo_id", commentUser, r, ps)
 
 	if err != nil {
-		http.Error(w, err.Error(), code)
+		writeError(w, err, code)
 		return
 	}
 
 	// check if the resource is consistent
 	if photo.User.Id != user.Id {
-		http.Error(w, ErrPageNotFound.Error(), http.StatusNotFound)
+		writeError(w, ErrPageNotFound, http.StatusNotFound)
+		return
+	}
+
+	// check whether the owner of the photo lets the user comment it
+	code, err = rt.checkCommentPolicy(ctx, user, commentUser)
+
+	if err != nil {
+		writeError(w, err, code)
 		return
 	}
 
 	comment.Photo = photo
 
-	comment.Date = time.Now().Format("2006-01-02 15:04:05")
+	// the author is returned as read from the database,
+	// with their profile, rather than as given in the body
+	comment.User = commentUser
+
+	comment.Date = time.Now().UTC().Truncate(time.Second)
+
+	// check the comment against the blocklist
+	blocked, err := rt.currentBlocklist(ctx.Context)
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	if term, ok := blocked.Match(comment.CommentBody); ok {
+		if rt.blockedComments == BlockedReject {
+			writeError(w, ErrBlockedComment, http.StatusBadRequest)
+			return
+		}
+
+		rt.holdComment(w, ctx, comment, term)
+		return
+	}
+
+	// check whether the comment looks like spam
+	spam, err := rt.checkSpam(ctx.Context, comment)
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	switch spam.policy {
+	case SpamThrottle:
+		atomic.AddUint64(&rt.spamStats.throttled, 1)
+
+		ctx.Logger.WithField("reason", spam.reason).Info("comment refused as suspected spam")
+
+		if spam.retryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(spam.retryAfter.Seconds())+1))
+		}
+
+		writeError(w, ErrSuspectedSpam, http.StatusTooManyRequests)
+		return
+	case SpamHold:
+		atomic.AddUint64(&rt.spamStats.held, 1)
+
+		rt.holdComment(w, ctx, comment, spam.reason)
+		return
+	}
 
 	dbComment := comment.CommentIntoDatabaseComment()
 
 	// insert the comment into the database
-	err = rt.db.InsertComment(&dbComment)
+	err = rt.db.InsertComment(ctx.Context, &dbComment)
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err, http.StatusInternalServerError)
 		return
 	}
 
@@ -161,15 +240,17 @@ func (rt *_router) commentPhoto(w http.ResponseWriter, r *http.Request, ps httpr
 	dbPhoto := photo.PhotoIntoDatabasePhoto()
 
 	// update the number of comments under the photo
-	err = rt.db.GetPhotoCommentCount(&dbPhoto, commentUser.UserIntoDatabaseUser())
+	err = rt.db.GetPhotoCommentCount(ctx.Context, &dbPhoto, commentUser.UserIntoDatabaseUser())
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err, http.StatusInternalServerError)
 		return
 	}
 
 	comment.Photo = PhotoFromDatabasePhoto(dbPhoto)
 
+	rt.emitEvent(ctx, webhook.EventCommentCreated, commentUser.Id, comment)
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated) // 201
 
@@ -177,84 +258,118 @@ func (rt *_router) commentPhoto(w http.ResponseWriter, r *http.Request, ps httpr
 	_ = json.NewEncoder(w).Encode(comment)
 }
 
+// holdComment holds the comment back until the administrators review it, since it matched the blocked term `term`,
+// replying that it was accepted but not published yet
+func (rt *_router) holdComment(w http.ResponseWriter, ctx reqcontext.RequestContext, comment Comment, term string) {
+	dbHeldComment := database.DatabaseHeldCommentDefault()
+
+	dbHeldComment.User = comment.User.UserIntoDatabaseUser()
+	dbHeldComment.Photo = comment.Photo.PhotoIntoDatabasePhoto()
+	dbHeldComment.Date = comment.Date
+	dbHeldComment.CommentBody = comment.CommentBody
+	dbHeldComment.Term = term
+
+	// insert the held comment into the database
+	err := rt.db.InsertHeldComment(ctx.Context, &dbHeldComment)
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	ctx.Logger.WithField("held_comment", dbHeldComment.Id).WithField("term", term).Info("comment held back for a review")
+
+	heldComment := HeldCommentFromDatabaseHeldComment(dbHeldComment)
+
+	// the blocked term, or the spam check the comment
+	// failed, is only told to the administrators
+	heldComment.Term = ""
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted) // 202
+
+	// return the comment waiting for a review
+	_ = json.NewEncoder(w).Encode(heldComment)
+}
+
 func (rt *_router) uncommentPhoto(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
 	// get the comment id from the resource parameter
 	commentIdString := ps.ByName("comment_id")
 	commentId, err := strconv.ParseUint(commentIdString, 10, 64)
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err, http.StatusInternalServerError)
 		return
 	}
 
-	// get the bearer token
-	token, err := GetBearerToken(r.Header.Get("Authorization"))
+	// get the user authenticated by the bearer token
+	userId, err := GetAuthenticatedUserId(ctx)
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusUnauthorized)
+		writeError(w, err, http.StatusUnauthorized)
 		return
 	}
 
 	// get the user performing the action
-	dbUser, err := rt.db.GetDatabaseUser(uint32(token))
+	dbUser, err := rt.db.GetDatabaseUser(ctx.Context, userId)
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err, http.StatusInternalServerError)
 		return
 	}
 
 	// get the comment from the database
-	comment, err := rt.GetCommentFromCommentId(uint32(commentId), UserFromDatabaseUser(dbUser))
+	comment, err := rt.GetCommentFromCommentId(ctx, uint32(commentId), UserFromDatabaseUser(dbUser))
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err, http.StatusInternalServerError)
 		return
 	}
 
 	// check if the user in the bearer token
 	// matches the comment user
-	if token != int(comment.User.Id) {
-		http.Error(w, ErrUserUnauthorized.Error(), http.StatusUnauthorized)
+	if userId != comment.User.Id {
+		writeError(w, ErrUserUnauthorized, http.StatusUnauthorized)
 		return
 	}
 
 	// get the user of the photo from the resource parameter
-	user, code, err := rt.GetUserFromParameter("uname", r, ps)
+	user, code, err := rt.GetUserFromParameter(ctx, "uname", r, ps)
 
 	if err != nil {
-		http.Error(w, err.Error(), code)
+		writeError(w, err, code)
 		return
 	}
 
 	// get the photo from the resource parameter
-	photo, code, err := rt.GetPhotoFromParameter("photo_id", UserFromDatabaseUser(dbUser), r, ps)
+	photo, code, err := rt.GetPhotoFromParameter(ctx, "photo_id", UserFromDatabaseUser(dbUser), r, ps)
 
 	if err != nil {
-		http.Error(w, err.Error(), code)
+		writeError(w, err, code)
 		return
 	}
 
 	// check if the resource is consistent
 	if photo.User.Id != user.Id || photo.Id != comment.Photo.Id {
-		http.Error(w, ErrPageNotFound.Error(), http.StatusNotFound)
+		writeError(w, ErrPageNotFound, http.StatusNotFound)
 		return
 	}
 
 	// remove the comment from the database
-	err = rt.db.DeleteComment(comment.CommentIntoDatabaseComment())
+	err = rt.db.DeleteComment(ctx.Context, comment.CommentIntoDatabaseComment())
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err, http.StatusInternalServerError)
 		return
 	}
 
 	dbPhoto := photo.PhotoIntoDatabasePhoto()
 
 	// update the number of comments under the photo
-	err = rt.db.GetPhotoCommentCount(&dbPhoto, dbUser)
+	err = rt.db.GetPhotoCommentCount(ctx.Context, &dbPhoto, dbUser)
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err, http.StatusInternalServerError)
 		return
 	}
 
@@ -266,3 +381,34 @@ func (rt *_router) uncommentPhoto(w http.ResponseWriter, r *http.Request, ps htt
 	// return the removed comment
 	_ = json.NewEncoder(w).Encode(comment)
 }
+
+// checkCommentPolicy checks whether the user `commentUser` can comment the photos of the user `user`, as told by the
+// comment policy of the latter, who can always comment their own photos
+func (rt *_router) checkCommentPolicy(ctx reqcontext.RequestContext, user User, commentUser User) (int, error) {
+	if user.Id == commentUser.Id {
+		return -1, nil
+	}
+
+	dbSettings, err := rt.db.GetUserSettings(ctx.Context, user.UserIntoDatabaseUser())
+
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	switch dbSettings.CommentPolicy {
+	case database.PolicyNobody:
+		return http.StatusForbidden, ErrCommentsRestricted
+	case database.PolicyFollowers:
+		followed, err := rt.db.GetFollowStatus(ctx.Context, commentUser.UserIntoDatabaseUser(), user.UserIntoDatabaseUser())
+
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+
+		if !followed {
+			return http.StatusForbidden, ErrCommentsRestricted
+		}
+	}
+
+	return -1, nil
+}
@@ -0,0 +1,162 @@
+package api
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// the compressors are reused across the responses, since each one allocates its buffers
+var gzipWriters = sync.Pool{New: func() interface{} { return gzip.NewWriter(io.Discard) }}
+var zlibWriters = sync.Pool{New: func() interface{} { return zlib.NewWriter(io.Discard) }}
+
+// acceptedEncoding returns the encoding of the response preferred by the client among gzip and deflate, according to
+// the Accept-Encoding header of the request, or "" if the response is not to be compressed
+func acceptedEncoding(r *http.Request) string {
+	best := ""
+	bestQ := 0.0
+
+	for _, item := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(item), ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+
+		q := 1.0
+
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+
+			if err != nil {
+				continue
+			}
+
+			q = parsed
+		}
+
+		// gzip is preferred to deflate when the client weighs them the same
+		if (coding == "gzip" || coding == "deflate") && (q > bestQ || q == bestQ && coding == "gzip") {
+			best, bestQ = coding, q
+		}
+	}
+
+	if bestQ == 0 {
+		return ""
+	}
+
+	return best
+}
+
+// compressible tells whether a response with the content type is compressed, which is the case only for JSON: the
+// images are compressed already, and the event streams are flushed one event at a time
+func compressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+
+	return err == nil && (mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"))
+}
+
+// compressWriter compresses the response written through it with `encoding`, if the client accepts it and the
+// response is compressible, deciding once the handler starts the response. It must be closed once the handler returns.
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+
+	started    bool
+	compressor io.WriteCloser
+}
+
+func (cw *compressWriter) WriteHeader(status int) {
+	if !cw.started {
+		cw.start(status)
+	}
+
+	cw.ResponseWriter.WriteHeader(status)
+}
+
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	if !cw.started {
+		cw.WriteHeader(http.StatusOK)
+	}
+
+	if cw.compressor != nil {
+		return cw.compressor.Write(b)
+	}
+
+	return cw.ResponseWriter.Write(b)
+}
+
+// start chooses whether the response with the status and the headers set by the handler is compressed
+func (cw *compressWriter) start(status int) {
+	cw.started = true
+
+	header := cw.Header()
+
+	if !compressible(header.Get("Content-Type")) || header.Get("Content-Encoding") != "" {
+		return
+	}
+
+	// the caches must store the compressed responses apart
+	header.Add("Vary", "Accept-Encoding")
+
+	if cw.encoding == "" || status < http.StatusOK || status == http.StatusNoContent {
+		return
+	}
+
+	// the compressed body is not the same byte for byte as the one
+	// tagged by the handler, hence the tag is weakened
+	if etag := header.Get("ETag"); strings.HasPrefix(etag, `"`) {
+		header.Set("ETag", "W/"+etag)
+	}
+
+	if status == http.StatusNotModified {
+		return
+	}
+
+	header.Set("Content-Encoding", cw.encoding)
+	header.Del("Content-Length")
+
+	switch cw.encoding {
+	case "gzip":
+		gz := gzipWriters.Get().(*gzip.Writer)
+		gz.Reset(cw.ResponseWriter)
+		cw.compressor = gz
+	case "deflate":
+		zw := zlibWriters.Get().(*zlib.Writer)
+		zw.Reset(cw.ResponseWriter)
+		cw.compressor = zw
+	}
+}
+
+// Flush sends to the client what was compressed so far
+func (cw *compressWriter) Flush() {
+	if gz, ok := cw.compressor.(*gzip.Writer); ok {
+		_ = gz.Flush()
+	} else if zw, ok := cw.compressor.(*zlib.Writer); ok {
+		_ = zw.Flush()
+	}
+
+	_ = http.NewResponseController(cw.ResponseWriter).Flush()
+}
+
+// Unwrap returns the underlying http.ResponseWriter, so that http.ResponseController can still change the deadlines
+// of the response
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// Close ends the compressed response, if it was compressed, putting the compressor back in its pool
+func (cw *compressWriter) Close() {
+	switch compressor := cw.compressor.(type) {
+	case *gzip.Writer:
+		_ = compressor.Close()
+		gzipWriters.Put(compressor)
+	case *zlib.Writer:
+		_ = compressor.Close()
+		zlibWriters.Put(compressor)
+	}
+
+	cw.compressor = nil
+}
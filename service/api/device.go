@@ -0,0 +1,237 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/api/reqcontext"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/database"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/push"
+	"github.com/julienschmidt/httprouter"
+)
+
+// maxDeviceTokenLength is the maximum length of the token of a device, well above the ones of the push services
+const maxDeviceTokenLength = 4096
+
+// pushBatch is the maximum number of notifications taken at once to be pushed
+const pushBatch = 100
+
+func (rt *_router) registerDevice(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// authenticate the user performing the action
+	user, code, err := rt.AuthenticateUserFromParameter(ctx, "uname", r, ps)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	device := DeviceDefault()
+
+	// get the platform and the token of the device from the request body
+	code, err = decodeJSON(r, &device)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	// only the devices which can be reached are registered
+	if rt.pushers[device.Platform] == nil {
+		writeError(w, ErrUnsupportedPlatform, http.StatusBadRequest)
+		return
+	}
+
+	if device.Token == "" || len(device.Token) > maxDeviceTokenLength {
+		writeError(w, ErrInvalidDeviceToken, http.StatusBadRequest)
+		return
+	}
+
+	device.User = user
+	device.Date = time.Now().UTC().Truncate(time.Second)
+
+	dbDevice := device.DeviceIntoDatabaseDevice()
+
+	// insert the device into the database
+	err = rt.db.InsertDevice(ctx.Context, &dbDevice)
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	device.Id = dbDevice.Id
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated) // 201
+
+	// return the registered device
+	_ = json.NewEncoder(w).Encode(device)
+}
+
+func (rt *_router) deleteDevice(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// authenticate the user performing the action
+	user, code, err := rt.AuthenticateUserFromParameter(ctx, "uname", r, ps)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	// get the device to be removed from the resource parameter
+	deviceId, err := strconv.ParseUint(ps.ByName("device_id"), 10, 32)
+
+	if err != nil {
+		writeError(w, ErrPageNotFound, http.StatusNotFound)
+		return
+	}
+
+	dbDevice, err := rt.db.GetDatabaseDevice(ctx.Context, uint32(deviceId))
+
+	if errors.Is(err, database.ErrDeviceDoesNotExist) {
+		writeError(w, err, http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	// check if the resource is consistent
+	if dbDevice.User.Id != user.Id {
+		writeError(w, ErrPageNotFound, http.StatusNotFound)
+		return
+	}
+
+	// remove the device from the database
+	err = rt.db.DeleteDevice(ctx.Context, dbDevice)
+
+	if errors.Is(err, database.ErrDeviceDoesNotExist) {
+		writeError(w, err, http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent) // 204
+}
+
+// pushNotifications pushes the new notifications to the devices of their users every `interval`, until the router is
+// closed; the pushes still being sent are then cancelled
+func (rt *_router) pushNotifications(interval time.Duration) {
+	defer close(rt.pushDone)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		<-rt.closing
+		cancel()
+	}()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-rt.closing:
+			return
+		case <-ticker.C:
+			rt.pushNewNotifications(ctx)
+		}
+	}
+}
+
+// pushNewNotifications takes the notifications which were not pushed yet and sends them to every device of their
+// users. A notification is taken once, hence it is not sent again if its push fails after the retries of the push
+// service; the devices whose token is no longer valid are removed.
+func (rt *_router) pushNewNotifications(ctx context.Context) {
+	for ctx.Err() == nil {
+		dbNotifications, err := rt.db.TakeNotificationsToPush(ctx, pushBatch)
+
+		if err != nil {
+			rt.baseLogger.WithError(err).Error("cannot get the notifications to be pushed")
+			return
+		}
+
+		for _, dbNotification := range dbNotifications {
+			dbDevices, err := rt.db.GetDevices(ctx, dbNotification.User)
+
+			if err != nil {
+				rt.baseLogger.WithError(err).Error("cannot get the devices of the user")
+				continue
+			}
+
+			msg := pushMessage(NotificationFromDatabaseNotification(dbNotification))
+
+			for _, dbDevice := range dbDevices {
+				pusher := rt.pushers[dbDevice.Platform]
+
+				// the platform may have been disabled since
+				// the device was registered
+				if pusher == nil {
+					continue
+				}
+
+				err = pusher.Push(ctx, dbDevice.Token, msg)
+
+				if errors.Is(err, push.ErrInvalidToken) {
+					rt.baseLogger.WithField("device", dbDevice.Id).Debug("removing the device with an invalid token")
+
+					err = rt.db.DeleteDevice(ctx, dbDevice)
+				}
+
+				if err != nil && !errors.Is(err, database.ErrDeviceDoesNotExist) {
+					rt.baseLogger.WithError(err).WithField("device", dbDevice.Id).Warn("cannot push the notification")
+				}
+			}
+		}
+
+		// the notifications are taken until there are no more of them
+		if len(dbNotifications) < pushBatch {
+			return
+		}
+	}
+}
+
+// pushMessage describes the notification as it is shown on the devices, passing its id, type and the photo it is
+// about to the app
+func pushMessage(notification Notification) push.Message {
+	msg := push.Message{
+		Data: map[string]string{
+			"notification_id": strconv.FormatUint(uint64(notification.Id), 10),
+			"type":            notification.Type,
+			"actor":           notification.Actor.Username,
+		},
+	}
+
+	switch notification.Type {
+	case database.NotificationLike:
+		msg.Title = fmt.Sprintf("%s liked your photo", notification.Actor.Username)
+	case database.NotificationComment:
+		msg.Title = fmt.Sprintf("%s commented on your photo", notification.Actor.Username)
+	case database.NotificationMention:
+		msg.Title = fmt.Sprintf("%s mentioned you in a comment", notification.Actor.Username)
+	case database.NotificationFollow:
+		msg.Title = fmt.Sprintf("%s started following you", notification.Actor.Username)
+	}
+
+	if notification.Comment != nil {
+		msg.Body = notification.Comment.CommentBody
+		msg.Data["photo_id"] = strconv.FormatUint(uint64(notification.Comment.Photo.Id), 10)
+	}
+
+	if notification.Photo != nil {
+		msg.Data["photo_id"] = strconv.FormatUint(uint64(notification.Photo.Id), 10)
+	}
+
+	return msg
+}
@@ -0,0 +1,172 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/mail"
+	"strings"
+	"time"
+
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/database"
+	mailer "git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/mail"
+)
+
+// maxEmailLength is the maximum length of an email address, as allowed by the SMTP paths
+const maxEmailLength = 254
+
+// digestBatch is the maximum number of users taken at once to receive their digests
+const digestBatch = 100
+
+// digestItems is the maximum number of new followers and of top photos written in a digest
+const digestItems = 5
+
+// validEmail returns whether the email address is a single plain
+// address, without the name of its owner, of an acceptable length
+func validEmail(email string) bool {
+	if len(email) > maxEmailLength {
+		return false
+	}
+
+	address, err := mail.ParseAddress(email)
+
+	return err == nil && address.Name == "" && address.Address == email
+}
+
+// sendDigests sends the digests to the users who are due for one every `interval`, until the router is closed; the
+// digests still being sent are then cancelled
+func (rt *_router) sendDigests(interval time.Duration) {
+	defer close(rt.digestDone)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		<-rt.closing
+		cancel()
+	}()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-rt.closing:
+			return
+		case <-ticker.C:
+			rt.sendDueDigests(ctx)
+		}
+	}
+}
+
+// sendDueDigests sends a digest to every user with an email address whose last digest is older than the digest
+// period. A digest covers at most the last period, and a user who missed nothing is not written to; a digest which
+// cannot be delivered is tried again on the next lookup.
+func (rt *_router) sendDueDigests(ctx context.Context) {
+	now := time.Now().UTC().Truncate(time.Second)
+	periodStart := now.Add(-rt.digestPeriod)
+
+	var after uint32
+
+	for ctx.Err() == nil {
+		dbDigests, err := rt.db.GetDigestRecipients(ctx, periodStart, after, digestBatch)
+
+		if err != nil {
+			rt.baseLogger.WithError(err).Error("cannot get the users due for a digest")
+			return
+		}
+
+		for _, dbDigest := range dbDigests {
+			after = dbDigest.User.Id
+
+			if dbDigest.Since.Before(periodStart) {
+				dbDigest.Since = periodStart
+			}
+
+			err = rt.db.GetDigest(ctx, &dbDigest, digestItems)
+
+			if err != nil {
+				rt.baseLogger.WithError(err).WithField("user", dbDigest.User.Id).Error("cannot get the digest of the user")
+				continue
+			}
+
+			if len(dbDigest.NewFollowers) > 0 || len(dbDigest.TopPhotos) > 0 || len(dbDigest.Activity) > 0 {
+				err = rt.mailer.Send(ctx, digestMessage(dbDigest))
+
+				if err != nil {
+					rt.baseLogger.WithError(err).WithField("user", dbDigest.User.Id).Warn("cannot send the digest")
+					continue
+				}
+			}
+
+			err = rt.db.SetDigestSent(ctx, dbDigest.User, now)
+
+			if err != nil {
+				rt.baseLogger.WithError(err).WithField("user", dbDigest.User.Id).Error("cannot record the digest as sent")
+			}
+		}
+
+		// the users are taken until there are no more of them
+		if len(dbDigests) < digestBatch {
+			return
+		}
+	}
+}
+
+// digestMessage writes the digest as the plain text email sent to the user
+func digestMessage(dbDigest database.DatabaseDigest) mailer.Message {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "Hi %s,\n\nhere is what you missed on WASAPhoto since %s.\n", dbDigest.User.Username, dbDigest.Since.Format("January 2, 2006"))
+
+	if len(dbDigest.NewFollowers) > 0 {
+		b.WriteString("\nNew followers:\n")
+
+		for _, follower := range dbDigest.NewFollowers {
+			fmt.Fprintf(&b, "- %s\n", follower.Username)
+		}
+	}
+
+	if len(dbDigest.Activity) > 0 {
+		b.WriteString("\nYour activity:\n")
+
+		// the types are written in a fixed order, the
+		// follows being already listed as new followers
+		for _, notificationType := range []string{database.NotificationLike, database.NotificationComment, database.NotificationMention} {
+			count, ok := dbDigest.Activity[notificationType]
+
+			if !ok {
+				continue
+			}
+
+			noun := notificationType + "s"
+
+			if count == 1 {
+				noun = notificationType
+			}
+
+			fmt.Fprintf(&b, "- %d new %s\n", count, noun)
+		}
+	}
+
+	if len(dbDigest.TopPhotos) > 0 {
+		b.WriteString("\nTop photos from the people you follow:\n")
+
+		for _, photo := range dbDigest.TopPhotos {
+			likes := "likes"
+
+			if photo.LikeCount == 1 {
+				likes = "like"
+			}
+
+			fmt.Fprintf(&b, "- a photo by %s, posted on %s, with %d %s\n", photo.User.Username, photo.Date.Format("January 2"), photo.LikeCount, likes)
+		}
+	}
+
+	b.WriteString("\nYou receive this email because you added your address in your settings; remove it to stop the digests.\n")
+
+	return mailer.Message{
+		To:      dbDigest.Email,
+		Subject: "What you missed on WASAPhoto",
+		Text:    b.String(),
+	}
+}
@@ -0,0 +1,164 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/api/reqcontext"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/database"
+	mailer "git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/mail"
+	"github.com/julienschmidt/httprouter"
+	"github.com/sirupsen/logrus"
+)
+
+// verificationLifetime is how long the link verifying an email address can be followed
+const verificationLifetime = 48 * time.Hour
+
+// verificationSendTimeout is how long sending a verification link may take, since it is sent in the background
+const verificationSendTimeout = 30 * time.Second
+
+// verificationClaims are the claims of the link verifying an email address: the id of the user, the address and when
+// the link expires as seconds since the epoch
+type verificationClaims struct {
+	Subject   uint32 `json:"sub"`
+	Email     string `json:"email"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// sendVerification sends to `email` the link verifying it as the address of the user, valid from `now`. The link is
+// sent in the background, so that the request does not wait for the mailer, and the failures are only logged; without
+// a mailer nothing is sent and the address stays unverified.
+func (rt *_router) sendVerification(logger logrus.FieldLogger, dbUser database.DatabaseUser, email string, now time.Time) {
+	if rt.mailer == nil {
+		return
+	}
+
+	token, err := rt.signClaims("email", verificationClaims{
+		Subject:   dbUser.Id,
+		Email:     email,
+		ExpiresAt: now.Add(verificationLifetime).Unix(),
+	})
+
+	if err != nil {
+		logger.WithError(err).Error("can't sign the verification link")
+		return
+	}
+
+	msg := verificationMessage(dbUser, email, rt.publicURL+"/v1/verify-email?"+url.Values{"token": {token}}.Encode())
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), verificationSendTimeout)
+		defer cancel()
+
+		err := rt.mailer.Send(ctx, msg)
+
+		if err != nil {
+			logger.WithError(err).Warn("can't send the verification link")
+		}
+	}()
+}
+
+// verificationMessage writes the plain text email carrying the link verifying the address of the user
+func verificationMessage(dbUser database.DatabaseUser, email string, link string) mailer.Message {
+	return mailer.Message{
+		To:      email,
+		Subject: "Verify your email address on WASAPhoto",
+		Text: fmt.Sprintf("Hi %s,\n\nfollow this link within %d hours to verify your email address:\n\n%s\n\n"+
+			"If you did not add this address on WASAPhoto, ignore this email.\n", dbUser.Username, int(verificationLifetime.Hours()), link),
+	}
+}
+
+// checkVerifiedEmail rejects with ErrEmailNotVerified the user if they must verify their email address before posting
+func (rt *_router) checkVerifiedEmail(ctx reqcontext.RequestContext, user User) (int, error) {
+	if !rt.requireVerified {
+		return http.StatusOK, nil
+	}
+
+	dbSettings, err := rt.db.GetUserSettings(ctx.Context, user.UserIntoDatabaseUser())
+
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	if !dbSettings.EmailVerified {
+		return http.StatusForbidden, ErrEmailNotVerified
+	}
+
+	return http.StatusOK, nil
+}
+
+func (rt *_router) verifyEmail(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	var claims verificationClaims
+
+	// the link must have been signed by the backend and not expired
+	if !rt.verifyClaims("email", r.URL.Query().Get("token"), &claims) || time.Now().Unix() >= claims.ExpiresAt {
+		writeError(w, ErrInvalidVerification, http.StatusBadRequest)
+		return
+	}
+
+	dbUser := database.DatabaseUserDefault()
+	dbUser.Id = claims.Subject
+
+	// verify the address, unless the user changed it since
+	err := rt.db.VerifyUserEmail(ctx.Context, dbUser, claims.Email)
+
+	if errors.Is(err, database.ErrEmailChanged) {
+		writeError(w, ErrInvalidVerification, http.StatusBadRequest)
+		return
+	}
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	verification := EmailVerification{
+		Email:         claims.Email,
+		EmailVerified: true,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK) // 200
+
+	// return the verified address
+	_ = json.NewEncoder(w).Encode(verification)
+}
+
+func (rt *_router) resendVerification(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// authenticate the user performing the action
+	user, code, err := rt.AuthenticateUserFromParameter(ctx, "uname", r, ps)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	if rt.mailer == nil {
+		writeError(w, ErrVerificationUnsupported, http.StatusNotImplemented)
+		return
+	}
+
+	dbSettings, err := rt.db.GetUserSettings(ctx.Context, user.UserIntoDatabaseUser())
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	if dbSettings.Email == "" {
+		writeError(w, ErrNoEmail, http.StatusBadRequest)
+		return
+	}
+
+	// send a new link, unless the address is already verified
+	if !dbSettings.EmailVerified {
+		rt.sendVerification(ctx.Logger, user.UserIntoDatabaseUser(), dbSettings.Email, time.Now())
+	}
+
+	w.WriteHeader(http.StatusNoContent) // 204
+}
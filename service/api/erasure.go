@@ -0,0 +1,135 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/api/reqcontext"
+	"github.com/julienschmidt/httprouter"
+	"github.com/sirupsen/logrus"
+)
+
+// erasureBatch is the maximum number of accounts erased by a single run of the background job
+const erasureBatch = 10
+
+func (rt *_router) eraseUser(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// authenticate the user performing the action
+	user, code, err := rt.AuthenticateUserFromParameter(ctx, "uname", r, ps)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	// hide the user and sign them out, leaving the
+	// erasure of their data to the background job
+	dbErasure, err := rt.db.RequestErasure(ctx.Context, user.UserIntoDatabaseUser(), time.Now())
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	ctx.Logger.WithField("erasure", dbErasure.Id).Info("erasure of the account requested")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted) // 202
+
+	// return the pending erasure
+	_ = json.NewEncoder(w).Encode(ErasureFromDatabaseErasure(dbErasure))
+}
+
+func (rt *_router) getErasures(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// authenticate the administrator performing the action
+	err := CheckAdminAuthorization(rt.adminToken, r.Header.Get("Authorization"))
+
+	if err != nil {
+		writeError(w, err, http.StatusUnauthorized)
+		return
+	}
+
+	// get the pagination parameters from the query
+	limit, after, code, err := GetPageFromQuery(r)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	// get the page of the erasures, pending and completed
+	dbErasureList, err := rt.db.GetErasures(ctx.Context, limit, after)
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK) // 200
+
+	// return the page of the erasures
+	_ = json.NewEncoder(w).Encode(ErasureListFromDatabaseErasureList(dbErasureList))
+}
+
+// eraseUsers erases the accounts whose erasure was requested every `interval`, until the router is closed
+func (rt *_router) eraseUsers(interval time.Duration) {
+	defer close(rt.erasureDone)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-rt.closing:
+			return
+		case <-ticker.C:
+			rt.runErasures()
+		}
+	}
+}
+
+// runErasures erases a batch of the accounts whose erasure was requested, and then the files of their photos and
+// stories; the files which cannot be removed are only logged, as their photos and stories are already gone
+func (rt *_router) runErasures() {
+	ctx := context.Background()
+
+	dbErasures, err := rt.db.GetPendingErasures(ctx, erasureBatch)
+
+	if err != nil {
+		rt.baseLogger.WithError(err).Error("cannot get the pending erasures")
+		return
+	}
+
+	for _, dbErasure := range dbErasures {
+		urls, err := rt.db.EraseUser(ctx, dbErasure, time.Now())
+
+		if err != nil {
+			rt.baseLogger.WithError(err).WithField("erasure", dbErasure.Id).Error("cannot erase the account")
+			continue
+		}
+
+		rt.deleteAccountFiles(ctx, rt.baseLogger, urls)
+
+		rt.baseLogger.WithField("erasure", dbErasure.Id).Info("account erased")
+	}
+}
+
+// deleteAccountFiles removes the files of a removed account from the storage, unless another photo uses them; the
+// files which cannot be removed are only logged, as the account is already gone
+func (rt *_router) deleteAccountFiles(ctx context.Context, logger logrus.FieldLogger, urls []string) {
+	for _, url := range urls {
+		name, ok := rt.photoFileName(url)
+
+		if !ok {
+			continue
+		}
+
+		err := rt.deletePhotoFile(ctx, name)
+
+		if err != nil {
+			logger.WithError(err).WithField("file", name).Warn("cannot remove the file of the removed account")
+		}
+	}
+}
@@ -1,19 +1,432 @@
 package api
 
 import (
+	"encoding/json"
 	"errors"
+	"net/http"
+	"strings"
+
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/api/reqcontext"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/database"
+	"github.com/julienschmidt/httprouter"
 )
 
 // User
 var ErrUserDoesNotExist = errors.New("the requested user does not exist")
 var ErrUserUnauthorized = errors.New("the requested user is not authorized to perform this action")
+var ErrInvalidToken = errors.New("the bearer token is not valid or has expired, refresh it or log in again")
+var ErrInvalidRefreshToken = errors.New("the refresh token is not valid or has expired, log in again")
+var ErrExternalLogin = errors.New("the user signs in through an external provider")
+var ErrProviderDoesNotExist = errors.New("the requested identity provider does not exist")
+var ErrInvalidState = errors.New("the state is not valid or has expired, sign in again")
+var ErrInvalidCode = errors.New("the authorization code was not accepted by the provider, sign in again")
+var ErrIdentityAlreadyLinked = errors.New("the identity is already linked to another user")
+var ErrUserConflict = errors.New("the requested user was modified by another request, retry with its current state")
+var ErrInvalidEmail = errors.New("the email address must be a plain address of at most 254 characters, or empty")
+var ErrInvalidVerification = errors.New("the verification link is not valid or has expired, ask for a new one")
+var ErrNoEmail = errors.New("the user has no email address to be verified")
+var ErrEmailNotVerified = errors.New("the user must verify their email address before posting")
+var ErrVerificationUnsupported = errors.New("the email addresses cannot be verified, since no mailer is configured")
+var ErrInvalidPolicy = errors.New("the comment and the mention policies must be one of everyone, followers and nobody")
+var ErrInvalidDisplayName = errors.New("the display name must be at most 50 characters long, without control characters")
+var ErrInvalidBio = errors.New("the bio must be at most 160 characters long, without control characters other than new lines")
+var ErrInvalidWebsite = errors.New("the website must be an absolute http or https URL of at most 200 characters, or empty")
+var ErrPrivateAccount = errors.New("the followers and the followings of a private account can only be seen by its followers")
+var ErrInvalidUsername = errors.New("the username does not comply with the username policy, see the details")
+var ErrReservedUsername = errors.New("the username is reserved and cannot be chosen")
+var ErrUserMoved = errors.New("the requested user changed their username, see the Location header for the new one")
+
+// API key
+var ErrInvalidAPIKey = errors.New("the API key is not valid or has been revoked")
+var ErrAPIKeyScope = errors.New("the API key can only read, it cannot perform this action")
+var ErrAPIKeyUnauthorized = errors.New("this action requires logging in, it cannot be performed with an API key")
+var ErrRateLimited = errors.New("the API key has sent too many requests, retry later")
+var ErrInvalidAPIKeyName = errors.New("the API key name must be between 1 and 64 characters long")
+var ErrInvalidAPIKeyScope = errors.New("the API key scope is not one of read and full")
+var ErrInvalidRateLimit = errors.New("the API key rate limit must be a positive integer not above the maximum")
+var ErrTooManyAPIKeys = errors.New("the user has already minted the maximum number of API keys")
 
 // Ban
 var ErrBannedUser = errors.New("the requested user has banned the user performing the action")
 var ErrSelfBan = errors.New("the user performing the ban and the user to be banned are the same user")
+var ErrInvalidBanReason = errors.New("the reason of the ban must be at most 256 characters long")
+var ErrInvalidBanExpiry = errors.New("the ban must expire in the future")
+
+// Mute
+var ErrSelfMute = errors.New("the user performing the mute and the user to be muted are the same user")
+
+// Close friend
+var ErrSelfCloseFriend = errors.New("the user performing the action and the close friend to be added are the same user")
+
+// Photo
+var ErrInvalidPhoto = errors.New("the uploaded photo is missing or damaged")
+var ErrUnsupportedPhoto = errors.New("the uploaded photo is not a JPEG, PNG or WebP image")
+var ErrPhotoTooLarge = errors.New("the uploaded photo exceeds the maximum file size")
+var ErrPhotoTooBig = errors.New("the uploaded photo exceeds the maximum width or height")
+var ErrDuplicatePhoto = errors.New("the uploaded photo looks like a photo already uploaded by the user")
+var ErrInvalidLocation = errors.New("the latitude must be between -90 and 90 and the longitude between -180 and 180, both given together")
+var ErrInvalidPlace = errors.New("the place must be between 1 and 100 characters long")
+var ErrTooManyPinnedPhotos = errors.New("the user has already pinned the maximum number of photos")
+var ErrPinArchivedPhoto = errors.New("an archived photo cannot be pinned")
+var ErrUnsafePhoto = errors.New("the uploaded photo was found unsafe")
+var ErrInvalidPublishAt = errors.New("the publication date must be an RFC 3339 timestamp in the future")
+var ErrInvalidPhotoEdit = errors.New("the crop rectangle must be inside the photo and the rotation one of 0, 90, 180 and 270 degrees")
+var ErrUneditablePhoto = errors.New("only the JPEG and PNG photos can be edited")
+var ErrInvalidAltText = errors.New("the alt text must be at most 1000 characters long, without control characters other than new lines")
+
+// Video
+var ErrInvalidVideo = errors.New("the uploaded video is damaged, or has no video track or no duration")
+var ErrUnsupportedVideo = errors.New("the uploaded video is not a MP4 or WebM video")
+var ErrVideoTooLarge = errors.New("the uploaded video exceeds the maximum file size")
+var ErrVideoTooBig = errors.New("the uploaded video exceeds the maximum width or height")
+var ErrVideoTooLong = errors.New("the uploaded video exceeds the maximum duration")
+
+// Album
+var ErrInvalidAlbumName = errors.New("the album name must be between 1 and 64 characters long")
+var ErrInvalidAlbumPhotos = errors.New("the photos of an album must be distinct photos of its owner")
+
+// Story
+var ErrStoryUnauthorized = errors.New("the stories of a user can only be seen by their followers")
+
+// Export
+var ErrInvalidArchive = errors.New("the body is not an export archive of version 1 naming the exported account")
+
+// Comment
+var ErrBlockedComment = errors.New("the comment contains a word or a pattern blocked by the administrators")
+var ErrCommentsRestricted = errors.New("the owner of the photo does not let the user comment their photos")
+var ErrSuspectedSpam = errors.New("the comment was refused as suspected spam")
+var ErrInvalidCommentSort = errors.New("the requested sort is not one of oldest and newest, top being reserved until comments can be liked")
+
+// Like
+var ErrInvalidReaction = errors.New("the requested reaction is not one of like, love, laugh, wow, sad and angry")
 
 // Follow
 var ErrSelfFollow = errors.New("the user performing the following and the user to be followed are the same user")
 
+// Pagination
+var ErrInvalidLimit = errors.New("the requested page limit is not a positive integer")
+var ErrInvalidCursor = errors.New("the requested page cursor is not a valid id")
+var ErrInvalidOffset = errors.New("the requested page offset is not a non-negative integer")
+
+// gRPC
+var ErrGRPCContentType = errors.New("the request is not a gRPC call, sent over HTTP/2 as application/grpc")
+var ErrInvalidGRPCCall = errors.New("the request is not a valid call of the gRPC service")
+
+// GraphQL
+var ErrInvalidGraphQLRequest = errors.New("the request is not a GraphQL request, holding its document in the query")
+
+// Batch
+var ErrInvalidBatch = errors.New("the batch must hold between 1 and 20 requests")
+var ErrInvalidBatchRequest = errors.New("a request of the batch is not a GET, POST, PUT or DELETE to a route of /v1 other than /v1/batch")
+
+// Idempotency
+var ErrInvalidIdempotencyKey = errors.New("the idempotency key must be between 1 and 255 printable ASCII characters long")
+var ErrIdempotencyKeyInProgress = errors.New("a request with the same idempotency key is still in progress")
+var ErrIdempotencyKeyReused = errors.New("the idempotency key was already used for a different request")
+
+// Stream
+var ErrInvalidDate = errors.New("the requested date is not an RFC 3339 timestamp")
+var ErrInvalidUnseenFilter = errors.New("the requested unseen filter is not true or false")
+var ErrInvalidAuthors = errors.New("the requested authors are not a comma-separated list of 1 to 50 usernames")
+
+// Notification
+var ErrInvalidUnreadFilter = errors.New("the requested unread filter is not true or false")
+var ErrInvalidNotificationType = errors.New("the notification preferences must be given for like, comment, mention and follow only")
+
+// Device
+var ErrUnsupportedPlatform = errors.New("the requested platform is not one of the platforms receiving push notifications")
+var ErrInvalidDeviceToken = errors.New("the device token must be between 1 and 4096 characters long")
+
+// Trending
+var ErrInvalidWindow = errors.New("the requested window is not one of 24h and 7d")
+
+// Search
+var ErrInvalidSearch = errors.New("the text to be searched is missing")
+var ErrInvalidCategoryLimit = errors.New("the requested limit of a search category is not a non-negative integer")
+
+// Hashtag
+var ErrInvalidHashtag = errors.New("the requested hashtag is not made of letters, digits and underscores")
+
+// Admin
+var ErrAdminUnauthorized = errors.New("the request is not authorized to perform administrative actions")
+var ErrBackupUnsupported = errors.New("the database does not support backups")
+var ErrInvalidActor = errors.New("the requested actor is not a valid user id")
+var ErrInvalidAction = errors.New("the requested action is not recorded in the audit log")
+var ErrInvalidBlockedTerm = errors.New("the blocked term must be between 1 and 256 characters long, and a valid regular expression if it is a pattern")
+var ErrInvalidReservedName = errors.New("the reserved name must be between 1 and 64 characters long")
+var ErrInvalidWebhookUrl = errors.New("the url of the webhook must be an absolute http or https url of at most 2048 characters")
+var ErrInvalidWebhookSecret = errors.New("the secret of the webhook must be between 16 and 256 characters long")
+var ErrInvalidWebhookEvents = errors.New("the webhook must subscribe to one or more of the events photo.created, user.followed and comment.created")
+
+// Request
+var ErrRequestTooLarge = errors.New("the request body exceeds the maximum size")
+var ErrRequestTimeout = errors.New("the request body was not received in time")
+
 // Others
+var ErrInternal = errors.New("the server encountered an internal error, report the request id")
 var ErrPageNotFound = errors.New("the requested resource does not exist")
+var ErrMethodNotAllowed = errors.New("the requested resource does not support the method of the request")
+var ErrRouteRemoved = errors.New("the requested route was removed, see the Link header for the one replacing it")
+
+// userMovedError is ErrUserMoved carrying the URL the request is redirected to; it is not in errorResponses, since it
+// is reported with 301 or 308 depending on the method of the request
+type userMovedError struct {
+	location string
+}
+
+func (e *userMovedError) Error() string {
+	return ErrUserMoved.Error()
+}
+
+func (e *userMovedError) Unwrap() error {
+	return ErrUserMoved
+}
+
+// errorResponse is the status code and the machine-readable code of the response reporting an error
+type errorResponse struct {
+	status int
+	code   string
+}
+
+// errorResponses maps the errors of the API and of the database to the response reporting them, so that the same
+// error is reported in the same way by every handler
+var errorResponses = map[error]errorResponse{
+	// User
+	ErrUserDoesNotExist:        {http.StatusUnauthorized, "user_not_found"},
+	ErrUserUnauthorized:        {http.StatusUnauthorized, "unauthorized"},
+	ErrInvalidToken:            {http.StatusUnauthorized, "invalid_token"},
+	ErrInvalidRefreshToken:     {http.StatusUnauthorized, "invalid_refresh_token"},
+	ErrExternalLogin:           {http.StatusUnauthorized, "external_login"},
+	ErrProviderDoesNotExist:    {http.StatusNotFound, "provider_not_found"},
+	ErrInvalidState:            {http.StatusUnauthorized, "invalid_state"},
+	ErrInvalidCode:             {http.StatusUnauthorized, "invalid_code"},
+	ErrIdentityAlreadyLinked:   {http.StatusConflict, "identity_already_linked"},
+	ErrUserConflict:            {http.StatusConflict, "user_conflict"},
+	ErrInvalidEmail:            {http.StatusBadRequest, "invalid_email"},
+	ErrInvalidVerification:     {http.StatusBadRequest, "invalid_verification"},
+	ErrNoEmail:                 {http.StatusBadRequest, "no_email"},
+	ErrEmailNotVerified:        {http.StatusForbidden, "email_not_verified"},
+	ErrVerificationUnsupported: {http.StatusNotImplemented, "verification_unsupported"},
+	ErrInvalidPolicy:           {http.StatusBadRequest, "invalid_policy"},
+	ErrInvalidDisplayName:      {http.StatusBadRequest, "invalid_display_name"},
+	ErrInvalidBio:              {http.StatusBadRequest, "invalid_bio"},
+	ErrInvalidWebsite:          {http.StatusBadRequest, "invalid_website"},
+	ErrPrivateAccount:          {http.StatusForbidden, "private_account"},
+	ErrInvalidUsername:         {http.StatusBadRequest, "invalid_username"},
+	ErrReservedUsername:        {http.StatusConflict, "username_reserved"},
+
+	// API key
+	ErrInvalidAPIKey:      {http.StatusUnauthorized, "invalid_api_key"},
+	ErrAPIKeyScope:        {http.StatusForbidden, "api_key_scope"},
+	ErrAPIKeyUnauthorized: {http.StatusForbidden, "api_key_unauthorized"},
+	ErrRateLimited:        {http.StatusTooManyRequests, "rate_limited"},
+	ErrInvalidAPIKeyName:  {http.StatusBadRequest, "invalid_api_key_name"},
+	ErrInvalidAPIKeyScope: {http.StatusBadRequest, "invalid_api_key_scope"},
+	ErrInvalidRateLimit:   {http.StatusBadRequest, "invalid_rate_limit"},
+	ErrTooManyAPIKeys:     {http.StatusConflict, "too_many_api_keys"},
+
+	// Ban
+	ErrBannedUser:       {http.StatusUnauthorized, "banned"},
+	ErrSelfBan:          {http.StatusBadRequest, "self_ban"},
+	ErrInvalidBanReason: {http.StatusBadRequest, "invalid_ban_reason"},
+	ErrInvalidBanExpiry: {http.StatusBadRequest, "invalid_ban_expiry"},
+
+	// Mute
+	ErrSelfMute: {http.StatusBadRequest, "self_mute"},
+
+	// Close friend
+	ErrSelfCloseFriend: {http.StatusBadRequest, "self_close_friend"},
+
+	// Photo
+	ErrInvalidPhoto:        {http.StatusBadRequest, "invalid_photo"},
+	ErrUnsupportedPhoto:    {http.StatusUnsupportedMediaType, "unsupported_photo"},
+	ErrPhotoTooLarge:       {http.StatusRequestEntityTooLarge, "photo_too_large"},
+	ErrPhotoTooBig:         {http.StatusRequestEntityTooLarge, "photo_too_big"},
+	ErrDuplicatePhoto:      {http.StatusConflict, "duplicate_photo"},
+	ErrInvalidLocation:     {http.StatusBadRequest, "invalid_location"},
+	ErrInvalidPlace:        {http.StatusBadRequest, "invalid_place"},
+	ErrTooManyPinnedPhotos: {http.StatusConflict, "too_many_pinned_photos"},
+	ErrPinArchivedPhoto:    {http.StatusConflict, "pin_archived_photo"},
+	ErrUnsafePhoto:         {http.StatusBadRequest, "unsafe_photo"},
+	ErrInvalidPublishAt:    {http.StatusBadRequest, "invalid_publish_at"},
+	ErrInvalidPhotoEdit:    {http.StatusBadRequest, "invalid_photo_edit"},
+	ErrUneditablePhoto:     {http.StatusConflict, "uneditable_photo"},
+	ErrInvalidAltText:      {http.StatusBadRequest, "invalid_alt_text"},
+
+	// Video
+	ErrInvalidVideo:     {http.StatusBadRequest, "invalid_video"},
+	ErrUnsupportedVideo: {http.StatusUnsupportedMediaType, "unsupported_video"},
+	ErrVideoTooLarge:    {http.StatusRequestEntityTooLarge, "video_too_large"},
+	ErrVideoTooBig:      {http.StatusRequestEntityTooLarge, "video_too_big"},
+	ErrVideoTooLong:     {http.StatusBadRequest, "video_too_long"},
+
+	// Album
+	ErrInvalidAlbumName:   {http.StatusBadRequest, "invalid_album_name"},
+	ErrInvalidAlbumPhotos: {http.StatusBadRequest, "invalid_album_photos"},
+
+	// Story
+	ErrStoryUnauthorized: {http.StatusUnauthorized, "story_unauthorized"},
+
+	// Export
+	ErrInvalidArchive: {http.StatusBadRequest, "invalid_archive"},
+
+	// Comment
+	ErrBlockedComment:     {http.StatusBadRequest, "blocked_comment"},
+	ErrSuspectedSpam:      {http.StatusTooManyRequests, "suspected_spam"},
+	ErrCommentsRestricted: {http.StatusForbidden, "comments_restricted"},
+	ErrInvalidCommentSort: {http.StatusBadRequest, "invalid_comment_sort"},
+
+	// Like
+	ErrInvalidReaction: {http.StatusBadRequest, "invalid_reaction"},
+
+	// Follow
+	ErrSelfFollow: {http.StatusBadRequest, "self_follow"},
+
+	// Pagination
+	ErrInvalidLimit:  {http.StatusBadRequest, "invalid_limit"},
+	ErrInvalidCursor: {http.StatusBadRequest, "invalid_cursor"},
+	ErrInvalidOffset: {http.StatusBadRequest, "invalid_offset"},
+
+	// gRPC
+	ErrGRPCContentType: {http.StatusUnsupportedMediaType, "grpc_content_type"},
+	ErrInvalidGRPCCall: {http.StatusBadRequest, "invalid_grpc_call"},
+
+	// GraphQL
+	ErrInvalidGraphQLRequest: {http.StatusBadRequest, "invalid_graphql_request"},
+
+	// Batch
+	ErrInvalidBatch:        {http.StatusBadRequest, "invalid_batch"},
+	ErrInvalidBatchRequest: {http.StatusBadRequest, "invalid_batch_request"},
+
+	// Idempotency
+	ErrInvalidIdempotencyKey:    {http.StatusBadRequest, "invalid_idempotency_key"},
+	ErrIdempotencyKeyInProgress: {http.StatusConflict, "idempotency_key_in_progress"},
+	ErrIdempotencyKeyReused:     {http.StatusUnprocessableEntity, "idempotency_key_reused"},
+
+	// Stream
+	ErrInvalidDate:         {http.StatusBadRequest, "invalid_date"},
+	ErrInvalidUnseenFilter: {http.StatusBadRequest, "invalid_unseen_filter"},
+	ErrInvalidAuthors:      {http.StatusBadRequest, "invalid_authors"},
+
+	// Notification
+	ErrInvalidUnreadFilter:     {http.StatusBadRequest, "invalid_unread_filter"},
+	ErrInvalidNotificationType: {http.StatusBadRequest, "invalid_notification_type"},
+
+	// Device
+	ErrUnsupportedPlatform: {http.StatusBadRequest, "unsupported_platform"},
+	ErrInvalidDeviceToken:  {http.StatusBadRequest, "invalid_device_token"},
+
+	// Trending
+	ErrInvalidWindow: {http.StatusBadRequest, "invalid_window"},
+
+	// Search
+	ErrInvalidSearch:        {http.StatusBadRequest, "invalid_search"},
+	ErrInvalidCategoryLimit: {http.StatusBadRequest, "invalid_category_limit"},
+
+	// Hashtag
+	ErrInvalidHashtag: {http.StatusBadRequest, "invalid_hashtag"},
+
+	// Admin
+	ErrAdminUnauthorized:    {http.StatusUnauthorized, "admin_unauthorized"},
+	ErrBackupUnsupported:    {http.StatusNotImplemented, "backup_unsupported"},
+	ErrInvalidActor:         {http.StatusBadRequest, "invalid_actor"},
+	ErrInvalidAction:        {http.StatusBadRequest, "invalid_action"},
+	ErrInvalidBlockedTerm:   {http.StatusBadRequest, "invalid_blocked_term"},
+	ErrInvalidReservedName:  {http.StatusBadRequest, "invalid_reserved_name"},
+	ErrInvalidWebhookUrl:    {http.StatusBadRequest, "invalid_webhook_url"},
+	ErrInvalidWebhookSecret: {http.StatusBadRequest, "invalid_webhook_secret"},
+	ErrInvalidWebhookEvents: {http.StatusBadRequest, "invalid_webhook_events"},
+
+	// Request
+	ErrRequestTooLarge: {http.StatusRequestEntityTooLarge, "request_too_large"},
+	ErrRequestTimeout:  {http.StatusRequestTimeout, "request_timeout"},
+
+	// Others
+	ErrInternal:         {http.StatusInternalServerError, "internal_server_error"},
+	ErrPageNotFound:     {http.StatusNotFound, "not_found"},
+	ErrMethodNotAllowed: {http.StatusMethodNotAllowed, "method_not_allowed"},
+	ErrRouteRemoved:     {http.StatusGone, "route_removed"},
+
+	// Database
+	database.ErrUserDoesNotExist:          {http.StatusNotFound, "user_not_found"},
+	database.ErrUsernameAlreadyTaken:      {http.StatusConflict, "username_taken"},
+	database.ErrUserNotFollowed:           {http.StatusNotFound, "user_not_followed"},
+	database.ErrUserNotBanned:             {http.StatusNotFound, "user_not_banned"},
+	database.ErrUserNotMuted:              {http.StatusNotFound, "user_not_muted"},
+	database.ErrUserSuspended:             {http.StatusForbidden, "user_suspended"},
+	database.ErrUserNotSuspended:          {http.StatusNotFound, "user_not_suspended"},
+	database.ErrUserNotShadowBanned:       {http.StatusNotFound, "user_not_shadow_banned"},
+	database.ErrErasurePending:            {http.StatusConflict, "erasure_pending"},
+	database.ErrUserNotCloseFriend:        {http.StatusNotFound, "user_not_close_friend"},
+	database.ErrNotFollower:               {http.StatusConflict, "not_follower"},
+	database.ErrPhotoDoesNotExist:         {http.StatusNotFound, "photo_not_found"},
+	database.ErrPhotoNotLiked:             {http.StatusNotFound, "photo_not_liked"},
+	database.ErrCommentDoesNotExist:       {http.StatusNotFound, "comment_not_found"},
+	database.ErrPhotoNotCommented:         {http.StatusNotFound, "comment_not_found"},
+	database.ErrAlbumDoesNotExist:         {http.StatusNotFound, "album_not_found"},
+	database.ErrStoryDoesNotExist:         {http.StatusNotFound, "story_not_found"},
+	database.ErrDeviceDoesNotExist:        {http.StatusNotFound, "device_not_found"},
+	database.ErrAPIKeyDoesNotExist:        {http.StatusNotFound, "api_key_not_found"},
+	database.ErrBackupUnsupported:         {http.StatusNotImplemented, "backup_unsupported"},
+	database.ErrTooManyPinnedPhotos:       {http.StatusConflict, "too_many_pinned_photos"},
+	database.ErrPhotoNotFlagged:           {http.StatusNotFound, "photo_not_flagged"},
+	database.ErrTooManyAPIKeys:            {http.StatusConflict, "too_many_api_keys"},
+	database.ErrIdentityAlreadyLinked:     {http.StatusConflict, "identity_already_linked"},
+	database.ErrBlockedTermDoesNotExist:   {http.StatusNotFound, "blocked_term_not_found"},
+	database.ErrBlockedTermAlreadyExists:  {http.StatusConflict, "term_already_blocked"},
+	database.ErrReservedNameDoesNotExist:  {http.StatusNotFound, "reserved_name_not_found"},
+	database.ErrReservedNameAlreadyExists: {http.StatusConflict, "name_already_reserved"},
+	database.ErrHeldCommentDoesNotExist:   {http.StatusNotFound, "held_comment_not_found"},
+	database.ErrWebhookDoesNotExist:       {http.StatusNotFound, "webhook_not_found"},
+	database.ErrFollowRequestDoesNotExist: {http.StatusNotFound, "follow_request_not_found"},
+}
+
+// writeError replies to the request with the error as an ErrorResponse. The errors found in errorResponses, even if
+// wrapped, are given their own status and code; any other error is reported with `status` and the code naming it.
+func writeError(w http.ResponseWriter, err error, status int) {
+	writeErrorDetails(w, err, status, nil)
+}
+
+// writeErrorDetails is like writeError, adding the details telling the client more about the error
+func writeErrorDetails(w http.ResponseWriter, err error, status int, details interface{}) {
+	status, code := errorStatus(err, status)
+
+	response := ErrorResponse{
+		Code:      code,
+		Message:   err.Error(),
+		RequestId: w.Header().Get(requestIdHeader),
+		Details:   details,
+	}
+
+	var moved *userMovedError
+
+	if errors.As(err, &moved) {
+		w.Header().Set("Location", moved.location)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+// errorStatus returns the status and the code reporting the error, as given by errorResponses if the error, even if
+// wrapped, is found there, or else `status` and the code naming it
+func errorStatus(err error, status int) (int, string) {
+	for wrapped := err; wrapped != nil; wrapped = errors.Unwrap(wrapped) {
+		if response, ok := errorResponses[wrapped]; ok {
+			return response.status, response.code
+		}
+	}
+
+	return status, strings.ReplaceAll(strings.ToLower(http.StatusText(status)), " ", "_")
+}
+
+func (rt *_router) notFound(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	writeError(w, ErrPageNotFound, http.StatusNotFound)
+}
+
+func (rt *_router) methodNotAllowed(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	writeError(w, ErrMethodNotAllowed, http.StatusMethodNotAllowed)
+}
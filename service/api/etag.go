@@ -0,0 +1,59 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// contentETag returns the strong entity tag of a response, the hash of its body
+func contentETag(body []byte) string {
+	hash := sha256.Sum256(body)
+
+	return `"` + hex.EncodeToString(hash[:16]) + `"`
+}
+
+// etagMatches tells whether the If-None-Match header of the request matches `etag`, comparing the tags weakly as
+// required for the conditional GETs, so that the tags weakened by the compression of the responses still match
+func etagMatches(r *http.Request, etag string) bool {
+	ifNoneMatch := strings.TrimSpace(r.Header.Get("If-None-Match"))
+
+	if ifNoneMatch == "*" {
+		return true
+	}
+
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(candidate), "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// writeJSONETag writes `v` as the JSON body of the response with status 200, tagged with the hash of the body, or
+// replies with 304 and no body if the client already holds it, telling so in If-None-Match
+func writeJSONETag(w http.ResponseWriter, r *http.Request, v interface{}) {
+	body, err := json.Marshal(v)
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	etag := contentETag(body)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", etag)
+
+	if etagMatches(r, etag) {
+		w.WriteHeader(http.StatusNotModified) // 304
+		return
+	}
+
+	w.WriteHeader(http.StatusOK) // 200
+
+	_, _ = w.Write(append(body, '\n'))
+}
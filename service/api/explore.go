@@ -0,0 +1,61 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/api/reqcontext"
+	"github.com/julienschmidt/httprouter"
+)
+
+func (rt *_router) getExplorePhotos(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// get the user authenticated by the bearer token
+	userId, err := GetAuthenticatedUserId(ctx)
+
+	if err != nil {
+		writeError(w, err, http.StatusUnauthorized)
+		return
+	}
+
+	// get the user performing the action
+	dbUser, err := rt.db.GetDatabaseUser(ctx.Context, userId)
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	// get the pagination parameters from the query; the
+	// feed is ranked, hence its pages are taken by position
+	limit, _, code, err := GetPageFromQuery(r)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	offset, code, err := GetOffsetFromQuery(r)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	// get the page of the photos of the users who are not followed,
+	// ranked by their recent activity, from the database
+	dbFeed, err := rt.db.GetExplorePhotos(ctx.Context, dbUser, time.Now().Add(-rt.exploreWindow), limit, offset)
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	feed := ExploreFeedFromDatabaseExploreFeed(dbFeed)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK) // 200
+
+	// return the explore feed
+	_ = json.NewEncoder(w).Encode(feed)
+}
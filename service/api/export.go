@@ -0,0 +1,322 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/api/reqcontext"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/database"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/imaging"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/storage"
+	"github.com/julienschmidt/httprouter"
+)
+
+// archiveVersion is the version of the format of the export archives, written by the export and required by the import
+const archiveVersion = 1
+
+func (rt *_router) exportAccount(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// authenticate the user performing the action
+	user, code, err := rt.AuthenticateUserFromParameter(ctx, "uname", r, ps)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	// get the photos of the user with their comments
+	dbExport, err := rt.db.GetExport(ctx.Context, user.UserIntoDatabaseUser())
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	archive := ArchiveDefault()
+
+	archive.Username = user.Username
+	archive.ExportedAt = time.Now().UTC().Truncate(time.Second)
+
+	for _, dbExportPhoto := range dbExport.Photos {
+		// add the image of each photo to the archive, leaving
+		// out the photos whose file went missing from the storage
+		content, contentType, err := rt.photoContent(ctx.Context, dbExportPhoto.Photo.Url)
+
+		if errors.Is(err, storage.ErrNotFound) {
+			ctx.Logger.WithField("photo", dbExportPhoto.Photo.Id).Warn("file of the photo missing from the export")
+			continue
+		}
+
+		if err != nil {
+			writeError(w, err, http.StatusInternalServerError)
+			return
+		}
+
+		archive.Photos = append(archive.Photos, ArchivePhotoFromDatabaseExportPhoto(dbExportPhoto, content, contentType))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": user.Username + ".json"}))
+	w.WriteHeader(http.StatusOK) // 200
+
+	// return the archive
+	_ = json.NewEncoder(w).Encode(archive)
+}
+
+// photoContent returns the image of the photo served at `url` and its type, read from the storage, or decoded from the
+// url itself for the older photos holding the whole image
+func (rt *_router) photoContent(ctx context.Context, url string) ([]byte, string, error) {
+	if data, ok := strings.CutPrefix(url, "data:"); ok {
+		mediaType, encoded, ok := strings.Cut(data, ";base64,")
+
+		if !ok {
+			return nil, "", storage.ErrNotFound
+		}
+
+		content, err := base64.StdEncoding.DecodeString(encoded)
+
+		return content, mediaType, err
+	}
+
+	name, ok := rt.photoFileName(url)
+
+	if !ok {
+		return nil, "", storage.ErrNotFound
+	}
+
+	blob, err := rt.photos.Get(ctx, name)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	defer blob.Close()
+
+	content, err := io.ReadAll(blob)
+
+	return content, blob.ContentType, err
+}
+
+func (rt *_router) importAccount(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// authenticate the user performing the action
+	user, code, err := rt.AuthenticateUserFromParameter(ctx, "uname", r, ps)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	// the user may have to verify their email address first,
+	// as the import uploads their photos
+	code, err = rt.checkVerifiedEmail(ctx, user)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	archive := ArchiveDefault()
+
+	// get the archive from the request body
+	code, err = decodeJSON(r, &archive)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	if archive.Version != archiveVersion || archive.Username == "" {
+		writeError(w, ErrInvalidArchive, http.StatusBadRequest)
+		return
+	}
+
+	// the photos imported by an earlier attempt are skipped,
+	// so that a failed import is resumed by sending the
+	// archive again
+	imported, err := rt.db.GetImportedPhotos(ctx.Context, user.UserIntoDatabaseUser(), archive.Username)
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	// the blocked comments are left out, without holding them back
+	blocked, err := rt.currentBlocklist(ctx.Context)
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	var result ImportResult
+
+	for _, archivePhoto := range archive.Photos {
+		if _, ok := imported[archivePhoto.Id]; ok {
+			result.AlreadyImported++
+			continue
+		}
+
+		// check the photo like an uploaded one
+		dbImport, content, contentType, err := rt.importedPhoto(ctx, user, archive.Username, archivePhoto)
+
+		if err != nil {
+			ctx.Logger.WithError(err).WithField("photo", archivePhoto.Id).Info("photo of the archive rejected")
+
+			result.Rejected++
+			continue
+		}
+
+		// only the comments written by the exported account are imported, as
+		// comments of the user, since the archive cannot prove who wrote the
+		// others; the blocked comments are left out as well
+		for _, comment := range archivePhoto.Comments {
+			if comment.Author != archive.Username {
+				continue
+			}
+
+			if _, ok := blocked.Match(comment.CommentBody); ok {
+				continue
+			}
+
+			dbImport.Comments = append(dbImport.Comments, comment.ArchiveCommentIntoDatabaseComment())
+		}
+
+		// save the photo in the storage, under
+		// the name made of the hash of its content
+		name := photoContentName(content, contentType)
+
+		// hold the file until the photo is inserted, so that no
+		// other request removes it as unused in between
+		unlock := rt.fileLocks.lock(name)
+
+		err = rt.photos.Put(ctx.Context, name, bytes.NewReader(content), contentType)
+
+		if err != nil {
+			unlock()
+			writeError(w, err, http.StatusInternalServerError)
+			return
+		}
+
+		dbImport.Photo.Url = rt.photos.URL(name)
+
+		// insert the photo with its comments into the database
+		err = rt.db.ImportPhoto(ctx.Context, &dbImport)
+
+		if errors.Is(err, database.ErrPhotoAlreadyImported) {
+			// a concurrent attempt imported it first
+			_ = rt.removePhotoFile(ctx.Context, name)
+			unlock()
+
+			result.AlreadyImported++
+			continue
+		}
+
+		if err != nil {
+			// the file of a photo which was not saved is never
+			// served, unless another photo holds the same image
+			_ = rt.removePhotoFile(ctx.Context, name)
+			unlock()
+
+			writeError(w, err, http.StatusInternalServerError)
+			return
+		}
+
+		unlock()
+
+		result.Imported++
+		result.Comments += len(dbImport.Comments)
+		result.SkippedComments += len(archivePhoto.Comments) - len(dbImport.Comments)
+	}
+
+	ctx.Logger.WithField("imported", result.Imported).WithField("source", archive.Username).Info("account data imported")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK) // 200
+
+	// return what was imported
+	_ = json.NewEncoder(w).Encode(result)
+}
+
+// importedPhoto checks the photo of an export archive like an uploaded photo, returning the photo to be imported
+// without its comments, together with its cleaned image and its type
+func (rt *_router) importedPhoto(ctx reqcontext.RequestContext, user User, source string, archivePhoto ArchivePhoto) (database.DatabaseImport, []byte, string, error) {
+	dbImport := database.DatabaseImportDefault()
+
+	if int64(len(archivePhoto.Content)) > rt.maxPhotoSize {
+		return dbImport, nil, "", ErrPhotoTooLarge
+	}
+
+	content, contentType, _, err := rt.checkPhoto(archivePhoto.Content)
+
+	if err != nil {
+		return dbImport, nil, "", err
+	}
+
+	if archivePhoto.Date.IsZero() {
+		return dbImport, nil, "", ErrInvalidArchive
+	}
+
+	// the latitude and the longitude are either both given or
+	// both missing; the negated comparisons also reject NaN
+	if (archivePhoto.Latitude == nil) != (archivePhoto.Longitude == nil) {
+		return dbImport, nil, "", ErrInvalidLocation
+	}
+
+	if archivePhoto.Latitude != nil && (!(*archivePhoto.Latitude >= -90 && *archivePhoto.Latitude <= 90) || !(*archivePhoto.Longitude >= -180 && *archivePhoto.Longitude <= 180)) {
+		return dbImport, nil, "", ErrInvalidLocation
+	}
+
+	place := ""
+
+	if strings.TrimSpace(archivePhoto.Place) != "" {
+		var ok bool
+
+		place, ok = database.NormalizePlace(archivePhoto.Place)
+
+		if !ok {
+			return dbImport, nil, "", ErrInvalidPlace
+		}
+	}
+
+	if !validProfileText(archivePhoto.AltText, maxAltTextLength, "\n") {
+		return dbImport, nil, "", ErrInvalidAltText
+	}
+
+	// the photo is checked again with the classifier,
+	// which the exporting server may not have used
+	flagged, err := rt.classifyPhoto(ctx, content, contentType)
+
+	if err != nil {
+		return dbImport, nil, "", err
+	}
+
+	dbImport.Source = source
+	dbImport.SourceId = archivePhoto.Id
+
+	dbImport.Photo.User = user.UserIntoDatabaseUser()
+	dbImport.Photo.Date = archivePhoto.Date.UTC().Truncate(time.Second)
+	dbImport.Photo.Archived = archivePhoto.Archived
+	dbImport.Photo.CloseFriends = archivePhoto.CloseFriends
+	dbImport.Photo.Flagged = flagged
+	dbImport.Photo.Latitude = archivePhoto.Latitude
+	dbImport.Photo.Longitude = archivePhoto.Longitude
+	dbImport.Photo.Place = place
+	dbImport.Photo.AltText = archivePhoto.AltText
+
+	// the perceptual hash lets the later uploads
+	// be compared with the imported photo
+	hash, err := imaging.DifferenceHash(content, contentType)
+
+	if err == nil {
+		dbImport.Photo.Hash = &hash
+	}
+
+	return dbImport, content, contentType, nil
+}
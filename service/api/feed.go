@@ -0,0 +1,226 @@
+package api
+
+import (
+	"encoding/xml"
+	"mime"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/api/reqcontext"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/database"
+	"github.com/julienschmidt/httprouter"
+)
+
+// feedEntries is the number of the most recent photos of a user written in their feed
+const feedEntries = 20
+
+// atomNamespace is the XML namespace of the Atom feeds
+const atomNamespace = "http://www.w3.org/2005/Atom"
+
+// atomFeed is an Atom feed (RFC 4287) of the photos of a user
+type atomFeed struct {
+	XMLName xml.Name    `xml:"feed"`
+	Xmlns   string      `xml:"xmlns,attr"`
+	Id      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Author  atomAuthor  `xml:"author"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomLink struct {
+	Rel  string `xml:"rel,attr"`
+	Type string `xml:"type,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+type atomEntry struct {
+	Id        string      `xml:"id"`
+	Title     string      `xml:"title"`
+	Published string      `xml:"published"`
+	Updated   string      `xml:"updated"`
+	Links     []atomLink  `xml:"link"`
+	Content   atomContent `xml:"content"`
+}
+
+type atomContent struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+// getUserFeed replies with the Atom feed of the most recent photos of the user, so that they can be followed from the
+// feed readers; the feed readers are usually anonymous, and then the feed only has the photos everyone can see,
+// while the users authenticated see the same photos as in the profile
+func (rt *_router) getUserFeed(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// get the user reading the feed, if any
+	dbUser := database.DatabaseUserDefault()
+
+	if ctx.UserId != 0 {
+		var err error
+
+		dbUser, err = rt.db.GetDatabaseUser(ctx.Context, ctx.UserId)
+
+		if err != nil {
+			writeError(w, err, http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// get the user of the feed from the resource parameter
+	feedUser, code, err := rt.GetUserFromParameter(ctx, "uname", r, ps)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	// check whether the user of the feed
+	// has banned the user reading it
+	if dbUser.Id != 0 {
+		checkBan, err := rt.db.CheckBan(ctx.Context, feedUser.UserIntoDatabaseUser(), dbUser)
+
+		if err != nil {
+			writeError(w, err, http.StatusInternalServerError)
+			return
+		}
+
+		if checkBan {
+			writeError(w, ErrBannedUser, http.StatusUnauthorized)
+			return
+		}
+	}
+
+	// get the most recent photos which are not archived
+	profile := ProfileDefault()
+
+	profile.User = feedUser
+
+	dbProfile := profile.ProfileIntoDatabaseProfile()
+
+	err = rt.db.GetPhotos(ctx.Context, &dbProfile, dbUser, false, feedEntries, 0)
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	photos := PhotoArrayFromDatabasePhotoArray(dbProfile.Photos)
+
+	// the pinned photos come first in the profile,
+	// while the feed is from the newest to the oldest
+	sort.SliceStable(photos, func(i, j int) bool {
+		return photos[i].Date.After(photos[j].Date)
+	})
+
+	if len(photos) > feedEntries {
+		photos = photos[:feedEntries]
+	}
+
+	body, err := xml.MarshalIndent(rt.userFeed(feedUser, photos), "", "  ")
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	body = append([]byte(xml.Header), body...)
+
+	// the feed readers poll the feed, hence
+	// they are told when it did not change
+	etag := contentETag(body)
+
+	w.Header().Set("Content-Type", "application/atom+xml")
+	w.Header().Set("ETag", etag)
+
+	if etagMatches(r, etag) {
+		w.WriteHeader(http.StatusNotModified) // 304
+		return
+	}
+
+	w.WriteHeader(http.StatusOK) // 200
+
+	_, _ = w.Write(append(body, '\n'))
+}
+
+// userFeed builds the Atom feed of the photos of the user, sorted from the newest
+func (rt *_router) userFeed(user User, photos []Photo) atomFeed {
+	self := rt.publicURL + "/v1/user/" + user.Username + "/feed.atom"
+
+	feed := atomFeed{
+		Xmlns:   atomNamespace,
+		Id:      self,
+		Title:   user.Username + " on WASAPhoto",
+		Updated: atomDate(time.Unix(0, 0)),
+		Links:   []atomLink{{Rel: "self", Type: "application/atom+xml", Href: self}},
+		Author:  atomAuthor{Name: user.Username},
+		Entries: make([]atomEntry, 0, len(photos)),
+	}
+
+	// the feed was last updated with its newest photo
+	if len(photos) > 0 {
+		feed.Updated = atomDate(photos[0].Date)
+	}
+
+	for _, photo := range photos {
+		url := rt.absoluteURL(photo.Url)
+
+		feed.Entries = append(feed.Entries, atomEntry{
+			Id:        self + "#photo-" + strconv.FormatUint(uint64(photo.Id), 10),
+			Title:     photoTitle(photo),
+			Published: atomDate(photo.Date),
+			Updated:   atomDate(photo.Date),
+			Links: []atomLink{
+				{Rel: "alternate", Href: url},
+				{Rel: "enclosure", Type: mime.TypeByExtension(path.Ext(url)), Href: url},
+			},
+			Content: atomContent{Type: "html", Body: `<img src="` + xmlEscape(url) + `">`},
+		})
+	}
+
+	return feed
+}
+
+// photoTitle returns the title of the photo in the feed; the photos have no caption, hence it is
+// made of the author of the photo and of the place it was taken at, if any
+func photoTitle(photo Photo) string {
+	title := "Photo by " + photo.User.Username
+
+	if photo.Place != "" {
+		title += " in " + photo.Place
+	}
+
+	return title
+}
+
+// absoluteURL returns the url resolved against the public url of the API, so that the photos saved on the disk,
+// whose urls are just paths, are reached from outside
+func (rt *_router) absoluteURL(url string) string {
+	if strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "https://") {
+		return url
+	}
+
+	return rt.publicURL + url
+}
+
+// atomDate formats the date as required by Atom
+func atomDate(date time.Time) string {
+	return date.UTC().Format(time.RFC3339)
+}
+
+// xmlEscape escapes the text to be written in the HTML of the content of an entry
+func xmlEscape(text string) string {
+	var b strings.Builder
+
+	_ = xml.EscapeText(&b, []byte(text))
+
+	return b.String()
+}
@@ -0,0 +1,83 @@
+package api
+
+import (
+	"sort"
+	"sync"
+)
+
+// fileLocks serialises the work on the files of the storage by their name: the files are named after the hash of their
+// content and shared between the photos, the stories and the avatars holding the same image, so a file must not be
+// removed as unused while another request saves it and inserts its row; the locks are kept in memory, hence each
+// instance of the backend serialises the requests it serves on its own
+type fileLocks struct {
+	mu    sync.Mutex
+	files map[string]*fileLock
+}
+
+type fileLock struct {
+	mu sync.Mutex
+	// holders counts the requests holding or waiting for the lock, which is dropped once none is left
+	holders int
+}
+
+func newFileLocks() *fileLocks {
+	return &fileLocks{
+		files: make(map[string]*fileLock),
+	}
+}
+
+// lock locks the files `names`, skipping the empty ones, and returns the function unlocking them. The names are locked
+// in order, so that two requests locking some of the same files cannot wait for each other forever.
+func (l *fileLocks) lock(names ...string) func() {
+	sorted := make([]string, 0, len(names))
+
+	for _, name := range names {
+		if name != "" {
+			sorted = append(sorted, name)
+		}
+	}
+
+	sort.Strings(sorted)
+
+	locked := make([]string, 0, len(sorted))
+
+	for i, name := range sorted {
+		if i > 0 && name == sorted[i-1] {
+			continue
+		}
+
+		l.mu.Lock()
+
+		file := l.files[name]
+
+		if file == nil {
+			file = &fileLock{}
+			l.files[name] = file
+		}
+
+		file.holders++
+
+		l.mu.Unlock()
+
+		file.mu.Lock()
+
+		locked = append(locked, name)
+	}
+
+	return func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+
+		for _, name := range locked {
+			file := l.files[name]
+
+			file.mu.Unlock()
+
+			file.holders--
+
+			if file.holders == 0 {
+				delete(l.files, name)
+			}
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/api/reqcontext"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/webhook"
+	"github.com/julienschmidt/httprouter"
+)
+
+// requestFollow sends the private account `followedUser` a request to be followed by `user`, answering with the
+// followed user as the following does, but with 202 as the following is pending until the account approves it
+func (rt *_router) requestFollow(w http.ResponseWriter, user User, followedUser User, ctx reqcontext.RequestContext) {
+	err := rt.db.InsertFollowRequest(ctx.Context, user.UserIntoDatabaseUser(), followedUser.UserIntoDatabaseUser(), time.Now())
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted) // 202
+
+	// return the user to be followed
+	_ = json.NewEncoder(w).Encode(followedUser)
+}
+
+func (rt *_router) getFollowRequests(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// authenticate the user performing the action,
+	// as only they can see who requested to follow them
+	user, code, err := rt.AuthenticateUserFromParameter(ctx, "uname", r, ps)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	// get the requesters from the database
+	dbRequestersList, err := rt.db.GetFollowRequests(ctx.Context, user.UserIntoDatabaseUser())
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK) // 200
+
+	// return the requesters list
+	_ = json.NewEncoder(w).Encode(UserListFromDatabaseUserList(dbRequestersList))
+}
+
+func (rt *_router) approveFollowRequest(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// authenticate the user performing the action
+	user, code, err := rt.AuthenticateUserFromParameter(ctx, "uname", r, ps)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	// get the requester from the resource parameter
+	requesterUser, code, err := rt.GetUserFromParameter(ctx, "requester_uname", r, ps)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	// the requester follows the user from now on
+	err = rt.db.ApproveFollowRequest(ctx.Context, user.UserIntoDatabaseUser(), requesterUser.UserIntoDatabaseUser())
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	rt.emitEvent(ctx, webhook.EventUserFollowed, requesterUser.Id, followPayload{User: requesterUser, Followed: user})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK) // 200
+
+	// return the new follower
+	_ = json.NewEncoder(w).Encode(requesterUser)
+}
+
+func (rt *_router) rejectFollowRequest(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// authenticate the user performing the action
+	user, code, err := rt.AuthenticateUserFromParameter(ctx, "uname", r, ps)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	// get the requester from the resource parameter
+	requesterUser, code, err := rt.GetUserFromParameter(ctx, "requester_uname", r, ps)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	// remove the request from the database
+	err = rt.db.DeleteFollowRequest(ctx.Context, requesterUser.UserIntoDatabaseUser(), user.UserIntoDatabaseUser())
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusNoContent) // 204
+}
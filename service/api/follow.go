@@ -2,44 +2,76 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 
 	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/api/reqcontext"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/database"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/webhook"
 	"github.com/julienschmidt/httprouter"
 )
 
 func (rt *_router) followUser(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
 	// authenticate the user performing the action
-	user, code, err := rt.AuthenticateUserFromParameter("uname", r, ps)
+	user, code, err := rt.AuthenticateUserFromParameter(ctx, "uname", r, ps)
 
 	if err != nil {
-		http.Error(w, err.Error(), code)
+		writeError(w, err, code)
 		return
 	}
 
 	// get the user to be followed from the resource parameter
-	followedUser, code, err := rt.GetUserFromParameter("followed_uname", r, ps)
+	followedUser, code, err := rt.GetUserFromParameter(ctx, "followed_uname", r, ps)
 
 	if err != nil {
-		http.Error(w, err.Error(), code)
+		writeError(w, err, code)
 		return
 	}
 
 	// check whether the user performing the following and the user
 	// to be followed are the same
 	if user.Id == followedUser.Id {
-		http.Error(w, ErrSelfFollow.Error(), http.StatusBadRequest)
+		writeError(w, ErrSelfFollow, http.StatusBadRequest)
 		return
 	}
 
+	// check whether the user is already followed, so
+	// that following them again is not announced
+	followed, err := rt.db.GetFollowStatus(ctx.Context, user.UserIntoDatabaseUser(), followedUser.UserIntoDatabaseUser())
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	// a private account has to approve its new followers,
+	// so it is sent a request to follow it instead
+	if !followed {
+		dbSettings, err := rt.db.GetUserSettings(ctx.Context, followedUser.UserIntoDatabaseUser())
+
+		if err != nil {
+			writeError(w, err, http.StatusInternalServerError)
+			return
+		}
+
+		if dbSettings.Private {
+			rt.requestFollow(w, user, followedUser, ctx)
+			return
+		}
+	}
+
 	// insert the following into the database
-	err = rt.db.InsertFollow(user.UserIntoDatabaseUser(), followedUser.UserIntoDatabaseUser())
+	err = rt.db.InsertFollow(ctx.Context, user.UserIntoDatabaseUser(), followedUser.UserIntoDatabaseUser())
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err, http.StatusInternalServerError)
 		return
 	}
 
+	if !followed {
+		rt.emitEvent(ctx, webhook.EventUserFollowed, user.Id, followPayload{User: user, Followed: followedUser})
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK) // 200
 
@@ -49,26 +81,36 @@ func (rt *_router) followUser(w http.ResponseWriter, r *http.Request, ps httprou
 
 func (rt *_router) unfollowUser(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
 	// authenticate the user performing the action
-	user, code, err := rt.AuthenticateUserFromParameter("uname", r, ps)
+	user, code, err := rt.AuthenticateUserFromParameter(ctx, "uname", r, ps)
 
 	if err != nil {
-		http.Error(w, err.Error(), code)
+		writeError(w, err, code)
 		return
 	}
 
 	// get the followed user from the resource parameter
-	followedUser, code, err := rt.GetUserFromParameter("followed_uname", r, ps)
+	followedUser, code, err := rt.GetUserFromParameter(ctx, "followed_uname", r, ps)
 
 	if err != nil {
-		http.Error(w, err.Error(), code)
+		writeError(w, err, code)
 		return
 	}
 
 	// remove the following from the database
-	err = rt.db.DeleteFollow(user.UserIntoDatabaseUser(), followedUser.UserIntoDatabaseUser())
+	err = rt.db.DeleteFollow(ctx.Context, user.UserIntoDatabaseUser(), followedUser.UserIntoDatabaseUser())
+
+	// if the user was not followed yet, the request
+	// to follow them is withdrawn instead, if any
+	if errors.Is(err, database.ErrUserNotFollowed) {
+		err = rt.db.DeleteFollowRequest(ctx.Context, user.UserIntoDatabaseUser(), followedUser.UserIntoDatabaseUser())
+
+		if errors.Is(err, database.ErrFollowRequestDoesNotExist) {
+			err = database.ErrUserNotFollowed
+		}
+	}
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err, http.StatusInternalServerError)
 		return
 	}
 
@@ -77,113 +119,161 @@ func (rt *_router) unfollowUser(w http.ResponseWriter, r *http.Request, ps httpr
 }
 
 func (rt *_router) getFollowers(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
-	// get the bearer token
-	token, err := GetBearerToken(r.Header.Get("Authorization"))
+	// get the user authenticated by the bearer token
+	userId, err := GetAuthenticatedUserId(ctx)
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusUnauthorized)
+		writeError(w, err, http.StatusUnauthorized)
 		return
 	}
 
 	// authenticate the user performing the action
-	dbUser, err := rt.db.GetDatabaseUser(uint32(token))
+	dbUser, err := rt.db.GetDatabaseUser(ctx.Context, userId)
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err, http.StatusInternalServerError)
 		return
 	}
 
 	// get the user of the list from the resource parameter
-	followersUser, code, err := rt.GetUserFromParameter("uname", r, ps)
+	followersUser, code, err := rt.GetUserFromParameter(ctx, "uname", r, ps)
 
 	if err != nil {
-		http.Error(w, err.Error(), code)
+		writeError(w, err, code)
 		return
 	}
 
 	// check whether the user of the list
 	// has banned the user performing the action
-	checkBan, err := rt.db.CheckBan(followersUser.UserIntoDatabaseUser(), dbUser)
+	checkBan, err := rt.db.CheckBan(ctx.Context, followersUser.UserIntoDatabaseUser(), dbUser)
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err, http.StatusInternalServerError)
 		return
 	}
 
 	if checkBan {
-		http.Error(w, ErrBannedUser.Error(), http.StatusUnauthorized)
+		writeError(w, ErrBannedUser, http.StatusUnauthorized)
+		return
+	}
+
+	// the lists of a private account are only
+	// seen by the account and its followers
+	code, err = rt.checkPrivateAccount(ctx, followersUser, dbUser)
+
+	if err != nil {
+		writeError(w, err, code)
 		return
 	}
 
 	// get the followers list from the database
-	dbFollowersList, err := rt.db.GetFollowersList(followersUser.UserIntoDatabaseUser(), dbUser)
+	dbFollowersList, err := rt.db.GetFollowersList(ctx.Context, followersUser.UserIntoDatabaseUser(), dbUser)
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err, http.StatusInternalServerError)
 		return
 	}
 
 	followersList := UserListFromDatabaseUserList(dbFollowersList)
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK) // 200
+	// the list is not paginated, so it has no next page
+	total := len(followersList.Users)
 
 	// return the followers list
-	_ = json.NewEncoder(w).Encode(followersList)
+	writeList(w, r, followersList, ItemList{Items: followersList.Users, Total: &total}, "after")
 }
 
 func (rt *_router) getFollowing(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
-	// get the bearer token
-	token, err := GetBearerToken(r.Header.Get("Authorization"))
+	// get the user authenticated by the bearer token
+	userId, err := GetAuthenticatedUserId(ctx)
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusUnauthorized)
+		writeError(w, err, http.StatusUnauthorized)
 		return
 	}
 
 	// authenticate the user performing the action
-	dbUser, err := rt.db.GetDatabaseUser(uint32(token))
+	dbUser, err := rt.db.GetDatabaseUser(ctx.Context, userId)
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err, http.StatusInternalServerError)
 		return
 	}
 
 	// get the user of the list from the resource parameter
-	followingUser, code, err := rt.GetUserFromParameter("uname", r, ps)
+	followingUser, code, err := rt.GetUserFromParameter(ctx, "uname", r, ps)
 
 	if err != nil {
-		http.Error(w, err.Error(), code)
+		writeError(w, err, code)
 		return
 	}
 
 	// check whether the user of the list
 	// has banned the user performing the action
-	checkBan, err := rt.db.CheckBan(followingUser.UserIntoDatabaseUser(), dbUser)
+	checkBan, err := rt.db.CheckBan(ctx.Context, followingUser.UserIntoDatabaseUser(), dbUser)
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err, http.StatusInternalServerError)
 		return
 	}
 
 	if checkBan {
-		http.Error(w, ErrBannedUser.Error(), http.StatusUnauthorized)
+		writeError(w, ErrBannedUser, http.StatusUnauthorized)
+		return
+	}
+
+	// the lists of a private account are only
+	// seen by the account and its followers
+	code, err = rt.checkPrivateAccount(ctx, followingUser, dbUser)
+
+	if err != nil {
+		writeError(w, err, code)
 		return
 	}
 
 	// get the following list from the database
-	dbFollowingList, err := rt.db.GetFollowingList(followingUser.UserIntoDatabaseUser(), dbUser)
+	dbFollowingList, err := rt.db.GetFollowingList(ctx.Context, followingUser.UserIntoDatabaseUser(), dbUser)
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err, http.StatusInternalServerError)
 		return
 	}
 
 	followingList := UserListFromDatabaseUserList(dbFollowingList)
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK) // 200
+	// the list is not paginated, so it has no next page
+	total := len(followingList.Users)
 
 	// return the following list
-	_ = json.NewEncoder(w).Encode(followingList)
+	writeList(w, r, followingList, ItemList{Items: followingList.Users, Total: &total}, "after")
+}
+
+// checkPrivateAccount checks whether the user `dbUser` can see the followers and the followings of the user `listUser`,
+// which is always the case unless the latter is a private account not followed by the former
+func (rt *_router) checkPrivateAccount(ctx reqcontext.RequestContext, listUser User, dbUser database.DatabaseUser) (int, error) {
+	if listUser.Id == dbUser.Id {
+		return -1, nil
+	}
+
+	dbSettings, err := rt.db.GetUserSettings(ctx.Context, listUser.UserIntoDatabaseUser())
+
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	if !dbSettings.Private {
+		return -1, nil
+	}
+
+	followed, err := rt.db.GetFollowStatus(ctx.Context, dbUser, listUser.UserIntoDatabaseUser())
+
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	if !followed {
+		return http.StatusForbidden, ErrPrivateAccount
+	}
+
+	return -1, nil
 }
@@ -0,0 +1,798 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/api/reqcontext"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/database"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/graphql"
+	"github.com/julienschmidt/httprouter"
+)
+
+// graphqlViewerKey is the key of the context of the resolvers holding the graphqlViewer
+type graphqlViewerKey struct{}
+
+// graphqlViewer is the user performing a GraphQL request, with the request itself, on whose behalf the mutations are
+// sent to the REST API
+type graphqlViewer struct {
+	ctx    reqcontext.RequestContext
+	r      *http.Request
+	dbUser database.DatabaseUser
+}
+
+func viewerFromContext(ctx context.Context) *graphqlViewer {
+	return ctx.Value(graphqlViewerKey{}).(*graphqlViewer)
+}
+
+// graphqlError is an error of a field, reported with the code the REST API reports it with
+type graphqlError struct {
+	err  error
+	code string
+}
+
+func (e graphqlError) Error() string {
+	return e.err.Error()
+}
+
+func (e graphqlError) Unwrap() error {
+	return e.err
+}
+
+func (e graphqlError) Code() string {
+	return e.code
+}
+
+// graphqlFail returns the error failing a field, as the REST API would report it with `status`
+func graphqlFail(err error, status int) error {
+	_, code := errorStatus(err, status)
+
+	return graphqlError{err: err, code: code}
+}
+
+// graphqlProfile is a profile, whose fields are loaded only when selected
+type graphqlProfile struct {
+	user User
+}
+
+// graphqlPhotoPage is a page of the photos of a profile
+type graphqlPhotoPage struct {
+	photos     []Photo
+	nextCursor uint32
+}
+
+// graphqlReaction is the number of the reactions of a kind to a photo
+type graphqlReaction struct {
+	reaction string
+	count    int
+}
+
+// graphqlCommentResult is the outcome of a comment, which is nil if the comment was held back for a review
+type graphqlCommentResult struct {
+	comment interface{}
+	held    bool
+}
+
+// graphqlPath is the path of the GraphQL API, under the prefix of every version of the API
+const graphqlPath = "/graphql"
+
+// isGraphQLRequest reports whether the request is sent to the GraphQL API, whose mutations are held to the scope of
+// the API key one by one. The path must be the one of the API exactly, since the other routes may end with a username.
+func isGraphQLRequest(r *http.Request) bool {
+	return r.Method == http.MethodPost && unversionedPath(r.URL.Path) == graphqlPath
+}
+
+func (rt *_router) serveGraphQL(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// get the user authenticated by the bearer token
+	userId, err := GetAuthenticatedUserId(ctx)
+
+	if err != nil {
+		writeError(w, err, http.StatusUnauthorized)
+		return
+	}
+
+	// get the user performing the request
+	dbUser, err := rt.db.GetDatabaseUser(ctx.Context, userId)
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	var req graphql.Request
+
+	// get the document, the operation and the variables from the request body
+	code, err := decodeJSON(r, &req)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	if req.Query == "" {
+		writeError(w, ErrInvalidGraphQLRequest, http.StatusBadRequest)
+		return
+	}
+
+	viewer := &graphqlViewer{ctx: ctx, r: r, dbUser: dbUser}
+
+	// the errors of the request are reported in the response,
+	// which is a success as far as HTTP is concerned
+	response := rt.graphqlSchema.Execute(context.WithValue(ctx.Context, graphqlViewerKey{}, viewer), req)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK) // 200
+
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+func (rt *_router) getGraphQLSchema(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK) // 200
+
+	_, _ = w.Write([]byte(rt.graphqlSchema.String()))
+}
+
+// newGraphQLSchema builds the schema of the GraphQL API. The queries read the database as the REST API does, loading
+// the comments and the likes of all the photos of a list at once, while the mutations are sent to the REST API itself,
+// hence they are checked exactly as the REST requests.
+func (rt *_router) newGraphQLSchema() (*graphql.Schema, error) {
+	user := &graphql.Object{
+		Name: "User",
+		Fields: []*graphql.FieldDef{
+			{Name: "id", Type: "ID!", Resolve: userField(func(user User) interface{} { return user.Id })},
+			{Name: "username", Type: "String!", Resolve: userField(func(user User) interface{} { return user.Username })},
+		},
+	}
+
+	profile := &graphql.Object{
+		Name:        "Profile",
+		Description: "The profile of a user, as seen by the user performing the request",
+		Fields: []*graphql.FieldDef{
+			{Name: "user", Type: "User!", Resolve: profileField(func(profile graphqlProfile) interface{} { return profile.user })},
+			{
+				Name:        "photos",
+				Description: "A page of the photos of the user, starting with the pinned ones; only the user sees their archived photos",
+				Type:        "PhotoPage!",
+				Args:        []graphql.ArgDef{{Name: "limit", Type: "Int"}, {Name: "before", Type: "ID"}, {Name: "archived", Type: "Boolean"}},
+				Resolve:     graphql.Each(rt.graphqlProfilePhotos),
+			},
+			{Name: "photoCount", Type: "Int!", Resolve: rt.profileStat(rt.db.GetPhotoCount)},
+			{Name: "followersCount", Type: "Int!", Resolve: rt.profileStat(rt.db.GetFollowersCount)},
+			{Name: "followingCount", Type: "Int!", Resolve: rt.profileStat(rt.db.GetFollowingCount)},
+			{Name: "followStatus", Type: "Boolean!", Resolve: rt.profileStatus(rt.db.GetFollowStatus)},
+			{Name: "banStatus", Type: "Boolean!", Resolve: rt.profileStatus(rt.db.CheckBan)},
+			{Name: "muteStatus", Type: "Boolean!", Resolve: rt.profileStatus(rt.db.CheckMute)},
+			{Name: "closeFriendStatus", Type: "Boolean!", Resolve: rt.profileStatus(rt.db.CheckCloseFriend)},
+		},
+	}
+
+	photoPage := &graphql.Object{
+		Name: "PhotoPage",
+		Fields: []*graphql.FieldDef{
+			{Name: "photos", Type: "[Photo!]!", Resolve: graphql.Each(func(ctx context.Context, parent interface{}, args map[string]interface{}) (interface{}, error) {
+				return parent.(graphqlPhotoPage).photos, nil
+			})},
+			{Name: "nextCursor", Type: "ID", Description: "The cursor of the next page, passed as `before`, or null if this is the last one", Resolve: graphql.Each(func(ctx context.Context, parent interface{}, args map[string]interface{}) (interface{}, error) {
+				if cursor := parent.(graphqlPhotoPage).nextCursor; cursor != 0 {
+					return cursor, nil
+				}
+
+				return nil, nil
+			})},
+		},
+	}
+
+	photo := &graphql.Object{
+		Name: "Photo",
+		Fields: []*graphql.FieldDef{
+			{Name: "id", Type: "ID!", Resolve: photoField(func(photo Photo) interface{} { return photo.Id })},
+			{Name: "user", Type: "User!", Resolve: photoField(func(photo Photo) interface{} { return photo.User })},
+			{Name: "url", Type: "String!", Resolve: photoField(func(photo Photo) interface{} { return photo.Url })},
+			{Name: "date", Type: "String!", Resolve: photoField(func(photo Photo) interface{} { return photo.Date.Format(time.RFC3339Nano) })},
+			{Name: "likeCount", Type: "Int!", Resolve: photoField(func(photo Photo) interface{} { return photo.LikeCount })},
+			{Name: "commentCount", Type: "Int!", Resolve: photoField(func(photo Photo) interface{} { return photo.CommentCount })},
+			{Name: "likeStatus", Type: "Boolean!", Resolve: photoField(func(photo Photo) interface{} { return photo.LikeStatus })},
+			{Name: "reaction", Type: "String", Description: "The reaction of the user performing the request, if any", Resolve: photoField(func(photo Photo) interface{} { return optionalString(photo.Reaction) })},
+			{Name: "reactions", Type: "[ReactionCount!]!", Resolve: photoField(func(photo Photo) interface{} { return graphqlReactions(photo) })},
+			{Name: "archived", Type: "Boolean!", Resolve: photoField(func(photo Photo) interface{} { return photo.Archived })},
+			{Name: "duplicateOf", Type: "ID", Resolve: photoField(func(photo Photo) interface{} { return optionalId(photo.DuplicateOf) })},
+			{Name: "latitude", Type: "Float", Resolve: photoField(func(photo Photo) interface{} { return photo.Latitude })},
+			{Name: "longitude", Type: "Float", Resolve: photoField(func(photo Photo) interface{} { return photo.Longitude })},
+			{Name: "place", Type: "String", Resolve: photoField(func(photo Photo) interface{} { return optionalString(photo.Place) })},
+			{Name: "pinned", Type: "Boolean!", Resolve: photoField(func(photo Photo) interface{} { return photo.Pinned })},
+			{Name: "closeFriends", Type: "Boolean!", Resolve: photoField(func(photo Photo) interface{} { return photo.CloseFriends })},
+			{Name: "flagged", Type: "Boolean!", Resolve: photoField(func(photo Photo) interface{} { return photo.Flagged })},
+			{Name: "scheduled", Type: "Boolean!", Description: "Whether only the owner sees the photo until its date, when it is published", Resolve: photoField(func(photo Photo) interface{} { return photo.Scheduled })},
+			{Name: "mediaType", Type: "String!", Description: "Either image or video", Resolve: photoField(func(photo Photo) interface{} { return photo.MediaType })},
+			{Name: "posterUrl", Type: "String", Description: "The url of the poster of a video, if any", Resolve: photoField(func(photo Photo) interface{} { return optionalString(photo.PosterUrl) })},
+			{Name: "duration", Type: "Float", Description: "The duration of a video in seconds", Resolve: photoField(func(photo Photo) interface{} { return optionalDuration(photo.Duration) })},
+			{Name: "originalUrl", Type: "String", Description: "The url of the original image of an edited photo, only given to its owner", Resolve: photoField(func(photo Photo) interface{} { return optionalString(photo.OriginalUrl) })},
+			{Name: "altText", Type: "String!", Description: "The text describing the photo to the users who cannot see it, empty if it is not given", Resolve: photoField(func(photo Photo) interface{} { return photo.AltText })},
+			{
+				Name:        "comments",
+				Description: "A page of the comments of the photo, from the oldest; the next page starts `after` the id of the last comment",
+				Type:        "[Comment!]!",
+				Args:        []graphql.ArgDef{{Name: "limit", Type: "Int"}, {Name: "after", Type: "ID"}},
+				Resolve:     rt.graphqlPhotoComments,
+			},
+			{
+				Name:        "likes",
+				Description: "A page of the users who liked the photo, by id; the next page starts `after` the id of the last user",
+				Type:        "[User!]!",
+				Args:        []graphql.ArgDef{{Name: "limit", Type: "Int"}, {Name: "after", Type: "ID"}},
+				Resolve:     rt.graphqlPhotoLikes,
+			},
+		},
+	}
+
+	reaction := &graphql.Object{
+		Name: "ReactionCount",
+		Fields: []*graphql.FieldDef{
+			{Name: "reaction", Type: "String!", Resolve: graphql.Each(func(ctx context.Context, parent interface{}, args map[string]interface{}) (interface{}, error) {
+				return parent.(graphqlReaction).reaction, nil
+			})},
+			{Name: "count", Type: "Int!", Resolve: graphql.Each(func(ctx context.Context, parent interface{}, args map[string]interface{}) (interface{}, error) {
+				return parent.(graphqlReaction).count, nil
+			})},
+		},
+	}
+
+	comment := &graphql.Object{
+		Name: "Comment",
+		Fields: []*graphql.FieldDef{
+			{Name: "id", Type: "ID!", Resolve: commentField(func(comment Comment) interface{} { return comment.Id })},
+			{Name: "user", Type: "User!", Resolve: commentField(func(comment Comment) interface{} { return comment.User })},
+			{Name: "photoId", Type: "ID!", Resolve: commentField(func(comment Comment) interface{} { return comment.Photo.Id })},
+			{Name: "date", Type: "String!", Resolve: commentField(func(comment Comment) interface{} { return comment.Date.Format(time.RFC3339Nano) })},
+			{Name: "body", Type: "String!", Resolve: commentField(func(comment Comment) interface{} { return comment.CommentBody })},
+		},
+	}
+
+	commentResult := &graphql.Object{
+		Name:        "CommentResult",
+		Description: "The outcome of a comment: the comment posted, or null if it was held back for the administrators to review",
+		Fields: []*graphql.FieldDef{
+			{Name: "comment", Type: "Comment", Resolve: graphql.Each(func(ctx context.Context, parent interface{}, args map[string]interface{}) (interface{}, error) {
+				return parent.(graphqlCommentResult).comment, nil
+			})},
+			{Name: "held", Type: "Boolean!", Resolve: graphql.Each(func(ctx context.Context, parent interface{}, args map[string]interface{}) (interface{}, error) {
+				return parent.(graphqlCommentResult).held, nil
+			})},
+		},
+	}
+
+	query := &graphql.Object{
+		Name: "Query",
+		Fields: []*graphql.FieldDef{
+			{Name: "me", Type: "User!", Description: "The user performing the request", Resolve: graphql.Each(func(ctx context.Context, parent interface{}, args map[string]interface{}) (interface{}, error) {
+				return UserFromDatabaseUser(viewerFromContext(ctx).dbUser), nil
+			})},
+			{
+				Name:        "user",
+				Description: "The profile of a user, or null if there is no such user",
+				Type:        "Profile",
+				Args:        []graphql.ArgDef{{Name: "username", Type: "String!"}},
+				Resolve: graphql.Each(func(ctx context.Context, parent interface{}, args map[string]interface{}) (interface{}, error) {
+					return rt.graphqlProfile(ctx, args["username"].(string), true)
+				}),
+			},
+			{
+				Name:        "stream",
+				Description: "A page of the stream of the user performing the request, from the newest photo; the next page is `before` the id of the last photo",
+				Type:        "[Photo!]!",
+				Args:        []graphql.ArgDef{{Name: "limit", Type: "Int"}, {Name: "before", Type: "ID"}, {Name: "after", Type: "ID"}},
+				Resolve:     graphql.Each(rt.graphqlStream),
+			},
+			{
+				Name:        "photo",
+				Description: "A photo, or null if there is no such photo",
+				Type:        "Photo",
+				Args:        []graphql.ArgDef{{Name: "id", Type: "ID!"}},
+				Resolve: graphql.Each(func(ctx context.Context, parent interface{}, args map[string]interface{}) (interface{}, error) {
+					return rt.graphqlPhoto(ctx, args["id"].(string), true)
+				}),
+			},
+		},
+	}
+
+	usernameArg := []graphql.ArgDef{{Name: "username", Type: "String!"}}
+	photoArg := []graphql.ArgDef{{Name: "photoId", Type: "ID!"}}
+
+	mutation := &graphql.Object{
+		Name:        "Mutation",
+		Description: "The actions of the user performing the request, which are checked and fail exactly as the ones of the REST API",
+		Fields: []*graphql.FieldDef{
+			{Name: "follow", Type: "Profile!", Args: usernameArg, Resolve: rt.graphqlUserAction(http.MethodPut, "follow")},
+			{Name: "unfollow", Type: "Profile!", Args: usernameArg, Resolve: rt.graphqlUserAction(http.MethodDelete, "follow")},
+			{Name: "ban", Type: "Profile!", Args: usernameArg, Resolve: rt.graphqlUserAction(http.MethodPut, "ban")},
+			{Name: "unban", Type: "Profile!", Args: usernameArg, Resolve: rt.graphqlUserAction(http.MethodDelete, "ban")},
+			{Name: "like", Type: "Photo!", Args: photoArg, Resolve: rt.graphqlLikeAction(http.MethodPut)},
+			{Name: "unlike", Type: "Photo!", Args: photoArg, Resolve: rt.graphqlLikeAction(http.MethodDelete)},
+			{
+				Name:    "comment",
+				Type:    "CommentResult!",
+				Args:    []graphql.ArgDef{{Name: "photoId", Type: "ID!"}, {Name: "body", Type: "String!"}},
+				Resolve: graphql.Each(rt.graphqlComment),
+			},
+			{
+				Name:    "uncomment",
+				Type:    "Photo!",
+				Args:    []graphql.ArgDef{{Name: "commentId", Type: "ID!"}},
+				Resolve: graphql.Each(rt.graphqlUncomment),
+			},
+		},
+	}
+
+	return graphql.NewSchema(query, mutation, user, profile, photoPage, photo, reaction, comment, commentResult)
+}
+
+func userField(field func(User) interface{}) graphql.Resolver {
+	return graphql.Each(func(ctx context.Context, parent interface{}, args map[string]interface{}) (interface{}, error) {
+		return field(parent.(User)), nil
+	})
+}
+
+func profileField(field func(graphqlProfile) interface{}) graphql.Resolver {
+	return graphql.Each(func(ctx context.Context, parent interface{}, args map[string]interface{}) (interface{}, error) {
+		return field(parent.(graphqlProfile)), nil
+	})
+}
+
+func photoField(field func(Photo) interface{}) graphql.Resolver {
+	return graphql.Each(func(ctx context.Context, parent interface{}, args map[string]interface{}) (interface{}, error) {
+		return field(parent.(Photo)), nil
+	})
+}
+
+func commentField(field func(Comment) interface{}) graphql.Resolver {
+	return graphql.Each(func(ctx context.Context, parent interface{}, args map[string]interface{}) (interface{}, error) {
+		return field(parent.(Comment)), nil
+	})
+}
+
+// optionalString returns nil for the empty strings, which the REST API leaves out
+func optionalString(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+
+	return s
+}
+
+// optionalDuration returns nil for the zero durations of the images, which the REST API leaves out
+func optionalDuration(duration float64) interface{} {
+	if duration == 0 {
+		return nil
+	}
+
+	return duration
+}
+
+// optionalId returns nil for the zero ids, which the REST API leaves out
+func optionalId(id uint32) interface{} {
+	if id == 0 {
+		return nil
+	}
+
+	return id
+}
+
+// graphqlReactions returns the number of the reactions of each kind to the photo, sorted by kind
+func graphqlReactions(photo Photo) []graphqlReaction {
+	reactions := make([]graphqlReaction, 0, len(photo.Reactions))
+
+	for reaction, count := range photo.Reactions {
+		reactions = append(reactions, graphqlReaction{reaction: reaction, count: count})
+	}
+
+	sort.Slice(reactions, func(i, j int) bool {
+		return reactions[i].reaction < reactions[j].reaction
+	})
+
+	return reactions
+}
+
+// profileStat resolves a counter of the profile, as seen by the user performing the request
+func (rt *_router) profileStat(stat func(ctx context.Context, profileDbUser database.DatabaseUser, dbUser database.DatabaseUser) (int, error)) graphql.Resolver {
+	return graphql.Each(func(ctx context.Context, parent interface{}, args map[string]interface{}) (interface{}, error) {
+		profileUser := parent.(graphqlProfile).user
+
+		count, err := stat(ctx, profileUser.UserIntoDatabaseUser(), viewerFromContext(ctx).dbUser)
+
+		if err != nil {
+			return nil, graphqlFail(err, http.StatusInternalServerError)
+		}
+
+		return count, nil
+	})
+}
+
+// profileStatus resolves a relation between the user performing the request and the user of the profile
+func (rt *_router) profileStatus(status func(ctx context.Context, dbUser database.DatabaseUser, profileDbUser database.DatabaseUser) (bool, error)) graphql.Resolver {
+	return graphql.Each(func(ctx context.Context, parent interface{}, args map[string]interface{}) (interface{}, error) {
+		profileUser := parent.(graphqlProfile).user
+
+		ok, err := status(ctx, viewerFromContext(ctx).dbUser, profileUser.UserIntoDatabaseUser())
+
+		if err != nil {
+			return nil, graphqlFail(err, http.StatusInternalServerError)
+		}
+
+		return ok, nil
+	})
+}
+
+// graphqlPageLimit returns the size of a page requested by the `limit` argument, or the default one
+func graphqlPageLimit(args map[string]interface{}) (int, error) {
+	limit, ok := args["limit"].(int)
+
+	if !ok {
+		return defaultPageLimit, nil
+	}
+
+	if limit <= 0 {
+		return 0, graphqlFail(ErrInvalidLimit, http.StatusBadRequest)
+	}
+
+	if limit > maxPageLimit {
+		return maxPageLimit, nil
+	}
+
+	return limit, nil
+}
+
+// graphqlId returns the id given by an argument, or 0 if it is missing, failing with `invalid` if it is not an id
+func graphqlId(args map[string]interface{}, name string, invalid error) (uint32, error) {
+	s, ok := args[name].(string)
+
+	if !ok {
+		return 0, nil
+	}
+
+	id, err := strconv.ParseUint(s, 10, 32)
+
+	if err != nil {
+		return 0, invalid
+	}
+
+	return uint32(id), nil
+}
+
+// graphqlProfile returns the profile of the user, failing if they banned the user performing the request; if the user
+// does not exist, the profile is null when `optional` and else the request fails
+func (rt *_router) graphqlProfile(ctx context.Context, username string, optional bool) (interface{}, error) {
+	viewer := viewerFromContext(ctx)
+
+	user, err := rt.GetUserFromLogin(viewer.ctx, LoginFromUsername(username))
+
+	if optional && errors.Is(err, database.ErrUserDoesNotExist) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, graphqlFail(err, http.StatusInternalServerError)
+	}
+
+	checkBan, err := rt.db.CheckBan(ctx, user.UserIntoDatabaseUser(), viewer.dbUser)
+
+	if err != nil {
+		return nil, graphqlFail(err, http.StatusInternalServerError)
+	}
+
+	if checkBan {
+		return nil, graphqlFail(ErrBannedUser, http.StatusUnauthorized)
+	}
+
+	return graphqlProfile{user: user}, nil
+}
+
+// graphqlPhoto returns the photo whose id is given, failing if its owner banned the user performing the request; if
+// the photo does not exist (or cannot be seen), it is null when `optional` and else the request fails
+func (rt *_router) graphqlPhoto(ctx context.Context, id string, optional bool) (interface{}, error) {
+	viewer := viewerFromContext(ctx)
+
+	photoId, err := graphqlId(map[string]interface{}{"id": id}, "id", database.ErrPhotoDoesNotExist)
+
+	if err == nil {
+		var photo Photo
+
+		photo, err = rt.GetPhotoFromPhotoId(viewer.ctx, photoId, UserFromDatabaseUser(viewer.dbUser))
+
+		if err == nil {
+			return rt.graphqlCheckPhoto(ctx, photo)
+		}
+	}
+
+	if optional && errors.Is(err, database.ErrPhotoDoesNotExist) {
+		return nil, nil
+	}
+
+	return nil, graphqlFail(err, http.StatusInternalServerError)
+}
+
+// graphqlCheckPhoto fails if the owner of the photo banned the user performing the request
+func (rt *_router) graphqlCheckPhoto(ctx context.Context, photo Photo) (interface{}, error) {
+	checkBan, err := rt.db.CheckBan(ctx, photo.User.UserIntoDatabaseUser(), viewerFromContext(ctx).dbUser)
+
+	if err != nil {
+		return nil, graphqlFail(err, http.StatusInternalServerError)
+	}
+
+	if checkBan {
+		return nil, graphqlFail(ErrBannedUser, http.StatusUnauthorized)
+	}
+
+	return photo, nil
+}
+
+func (rt *_router) graphqlProfilePhotos(ctx context.Context, parent interface{}, args map[string]interface{}) (interface{}, error) {
+	viewer := viewerFromContext(ctx)
+	profileUser := parent.(graphqlProfile).user
+
+	limit, err := graphqlPageLimit(args)
+
+	if err != nil {
+		return nil, err
+	}
+
+	before, err := graphqlId(args, "before", graphqlFail(ErrInvalidCursor, http.StatusBadRequest))
+
+	if err != nil {
+		return nil, err
+	}
+
+	archived, _ := args["archived"].(bool)
+
+	// only the owner of the profile can see the archived photos
+	if archived && profileUser.Id != viewer.dbUser.Id {
+		return nil, graphqlFail(ErrUserUnauthorized, http.StatusUnauthorized)
+	}
+
+	profile := ProfileDefault()
+
+	profile.User = profileUser
+
+	dbProfile := profile.ProfileIntoDatabaseProfile()
+
+	err = rt.db.GetPhotos(ctx, &dbProfile, viewer.dbUser, archived, limit, before)
+
+	if err != nil {
+		return nil, graphqlFail(err, http.StatusInternalServerError)
+	}
+
+	profile = ProfileFromDatabaseProfile(dbProfile)
+
+	return graphqlPhotoPage{photos: profile.Photos, nextCursor: profile.NextCursor}, nil
+}
+
+func (rt *_router) graphqlStream(ctx context.Context, parent interface{}, args map[string]interface{}) (interface{}, error) {
+	viewer := viewerFromContext(ctx)
+
+	limit, err := graphqlPageLimit(args)
+
+	if err != nil {
+		return nil, err
+	}
+
+	before, err := graphqlId(args, "before", graphqlFail(ErrInvalidCursor, http.StatusBadRequest))
+
+	if err != nil {
+		return nil, err
+	}
+
+	after, err := graphqlId(args, "after", graphqlFail(ErrInvalidCursor, http.StatusBadRequest))
+
+	if err != nil {
+		return nil, err
+	}
+
+	dbStream, err := rt.db.GetDatabaseStream(ctx, viewer.dbUser, database.DatabaseStreamFilterDefault(), limit, before, after)
+
+	if err != nil {
+		return nil, graphqlFail(err, http.StatusInternalServerError)
+	}
+
+	dbStream.User = viewer.dbUser
+
+	return StreamFromDatabaseStream(dbStream).Photos, nil
+}
+
+// graphqlPhotoComments resolves the comments of all the photos at once
+func (rt *_router) graphqlPhotoComments(ctx context.Context, parents []interface{}, args map[string]interface{}) ([]interface{}, error) {
+	limit, err := graphqlPageLimit(args)
+
+	if err != nil {
+		return nil, err
+	}
+
+	after, err := graphqlId(args, "after", graphqlFail(ErrInvalidCursor, http.StatusBadRequest))
+
+	if err != nil {
+		return nil, err
+	}
+
+	photoIds := make([]uint32, len(parents))
+
+	for i, parent := range parents {
+		photoIds[i] = parent.(Photo).Id
+	}
+
+	dbComments, err := rt.db.GetPhotosComments(ctx, photoIds, viewerFromContext(ctx).dbUser, limit, after)
+
+	if err != nil {
+		return nil, graphqlFail(err, http.StatusInternalServerError)
+	}
+
+	values := make([]interface{}, len(parents))
+
+	for i, photoId := range photoIds {
+		comments := make([]Comment, 0, len(dbComments[photoId]))
+
+		for _, dbComment := range dbComments[photoId] {
+			comments = append(comments, CommentFromDatabaseComment(dbComment))
+		}
+
+		values[i] = comments
+	}
+
+	return values, nil
+}
+
+// graphqlPhotoLikes resolves the users who liked each photo, for all the photos at once
+func (rt *_router) graphqlPhotoLikes(ctx context.Context, parents []interface{}, args map[string]interface{}) ([]interface{}, error) {
+	limit, err := graphqlPageLimit(args)
+
+	if err != nil {
+		return nil, err
+	}
+
+	after, err := graphqlId(args, "after", graphqlFail(ErrInvalidCursor, http.StatusBadRequest))
+
+	if err != nil {
+		return nil, err
+	}
+
+	photoIds := make([]uint32, len(parents))
+
+	for i, parent := range parents {
+		photoIds[i] = parent.(Photo).Id
+	}
+
+	dbUsers, err := rt.db.GetPhotosLikes(ctx, photoIds, viewerFromContext(ctx).dbUser, limit, after)
+
+	if err != nil {
+		return nil, graphqlFail(err, http.StatusInternalServerError)
+	}
+
+	values := make([]interface{}, len(parents))
+
+	for i, photoId := range photoIds {
+		values[i] = UserArrayFromDatabaseUserArray(dbUsers[photoId])
+	}
+
+	return values, nil
+}
+
+// graphqlMutate sends the request of a mutation to the REST API, failing as the request did
+func (rt *_router) graphqlMutate(ctx context.Context, method string, path string, body interface{}) (*subresponse, error) {
+	viewer := viewerFromContext(ctx)
+
+	res, err := rt.subrequest(viewer.ctx, viewer.r, method, path, nil, body)
+
+	if err != nil {
+		return nil, graphqlFail(err, http.StatusInternalServerError)
+	}
+
+	if !res.ok() {
+		response := res.error()
+
+		return nil, graphqlError{err: errors.New(response.Message), code: response.Code}
+	}
+
+	return res, nil
+}
+
+// graphqlUserAction resolves the mutations acting on another user, as /user/{me}/{action}/{username}, returning their
+// profile afterwards
+func (rt *_router) graphqlUserAction(method string, action string) graphql.Resolver {
+	return graphql.Each(func(ctx context.Context, parent interface{}, args map[string]interface{}) (interface{}, error) {
+		username := args["username"].(string)
+
+		_, err := rt.graphqlMutate(ctx, method, "/v1/user/"+url.PathEscape(viewerFromContext(ctx).dbUser.Username)+"/"+action+"/"+url.PathEscape(username), nil)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return rt.graphqlProfile(ctx, username, false)
+	})
+}
+
+// graphqlLikeAction resolves the mutations liking and unliking a photo, returning the photo afterwards
+func (rt *_router) graphqlLikeAction(method string) graphql.Resolver {
+	return graphql.Each(func(ctx context.Context, parent interface{}, args map[string]interface{}) (interface{}, error) {
+		value, err := rt.graphqlPhoto(ctx, args["photoId"].(string), false)
+
+		if err != nil {
+			return nil, err
+		}
+
+		photo := value.(Photo)
+
+		_, err = rt.graphqlMutate(ctx, method, photoPath(photo)+"/likes/"+url.PathEscape(viewerFromContext(ctx).dbUser.Username), nil)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return rt.graphqlPhoto(ctx, args["photoId"].(string), false)
+	})
+}
+
+func (rt *_router) graphqlComment(ctx context.Context, parent interface{}, args map[string]interface{}) (interface{}, error) {
+	value, err := rt.graphqlPhoto(ctx, args["photoId"].(string), false)
+
+	if err != nil {
+		return nil, err
+	}
+
+	comment := CommentDefault()
+
+	comment.User = UserFromDatabaseUser(viewerFromContext(ctx).dbUser)
+	comment.CommentBody = args["body"].(string)
+
+	res, err := rt.graphqlMutate(ctx, http.MethodPost, photoPath(value.(Photo))+"/comment", comment)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// the comment was held back for a review
+	if res.status == http.StatusAccepted {
+		return graphqlCommentResult{held: true}, nil
+	}
+
+	err = json.Unmarshal(res.body.Bytes(), &comment)
+
+	if err != nil {
+		return nil, graphqlFail(err, http.StatusInternalServerError)
+	}
+
+	return graphqlCommentResult{comment: comment}, nil
+}
+
+func (rt *_router) graphqlUncomment(ctx context.Context, parent interface{}, args map[string]interface{}) (interface{}, error) {
+	viewer := viewerFromContext(ctx)
+
+	commentId, err := graphqlId(args, "commentId", database.ErrCommentDoesNotExist)
+
+	if err != nil {
+		return nil, graphqlFail(err, http.StatusInternalServerError)
+	}
+
+	comment, err := rt.GetCommentFromCommentId(viewer.ctx, commentId, UserFromDatabaseUser(viewer.dbUser))
+
+	if err != nil {
+		return nil, graphqlFail(err, http.StatusInternalServerError)
+	}
+
+	_, err = rt.graphqlMutate(ctx, http.MethodDelete, photoPath(comment.Photo)+"/comments/"+strconv.FormatUint(uint64(comment.Id), 10), nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return rt.graphqlPhoto(ctx, strconv.FormatUint(uint64(comment.Photo.Id), 10), false)
+}
+
+// photoPath returns the path of the photo in the REST API
+func photoPath(photo Photo) string {
+	return "/v1/user/" + url.PathEscape(photo.User.Username) + "/photos/" + strconv.FormatUint(uint64(photo.Id), 10)
+}
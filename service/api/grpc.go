@@ -0,0 +1,590 @@
+package api
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/api/reqcontext"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/database"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/protowire"
+	"github.com/julienschmidt/httprouter"
+)
+
+// GRPCService is the full name of the gRPC service declared in doc/wasaphoto.proto, whose methods are served under
+// /GRPCService/
+const GRPCService = "wasaphoto.v1.WASAPhoto"
+
+// the status codes of gRPC used by the service
+const (
+	grpcOK                = 0
+	grpcUnknown           = 2
+	grpcInvalidArgument   = 3
+	grpcDeadlineExceeded  = 4
+	grpcNotFound          = 5
+	grpcAlreadyExists     = 6
+	grpcPermissionDenied  = 7
+	grpcResourceExhausted = 8
+	grpcUnimplemented     = 12
+	grpcInternal          = 13
+	grpcUnavailable       = 14
+	grpcUnauthenticated   = 16
+)
+
+// grpcMethod serves a call of a method of the gRPC service, decoding its request message from `req` and returning
+// its encoded response message; on failure, it returns the HTTP status the REST API would reply with instead
+type grpcMethod func(rt *_router, ctx reqcontext.RequestContext, req []byte) ([]byte, int, error)
+
+// grpcMethods maps the names of the methods of the gRPC service to their implementation
+var grpcMethods = map[string]grpcMethod{
+	"GetProfile":  (*_router).grpcGetProfile,
+	"GetStream":   (*_router).grpcGetStream,
+	"GetComments": (*_router).grpcGetComments,
+}
+
+// isGRPCCall tells whether the request is a call of the gRPC service, which only reads like the GET requests
+func isGRPCCall(r *http.Request) bool {
+	return strings.HasPrefix(r.URL.Path, "/"+GRPCService+"/")
+}
+
+// serveGRPC serves the unary calls of the gRPC service over HTTP/2, with the messages encoded by Protocol Buffers: the
+// request holds a single length-prefixed message, and the response holds the response message followed by the status
+// of the call in the trailers
+func (rt *_router) serveGRPC(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	if r.ProtoMajor != 2 || err != nil || (mediaType != "application/grpc" && mediaType != "application/grpc+proto") {
+		writeError(w, ErrGRPCContentType, http.StatusUnsupportedMediaType)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/grpc+proto")
+	w.WriteHeader(http.StatusOK) // 200
+
+	method, ok := grpcMethods[ps.ByName("method")]
+
+	if !ok {
+		writeGRPCStatus(w, grpcUnimplemented, "unknown method "+ps.ByName("method"))
+		return
+	}
+
+	// the messages sent compressed are refused, telling
+	// the client to send them as they are instead
+	if encoding := r.Header.Get("Grpc-Encoding"); encoding != "" && encoding != "identity" {
+		w.Header().Set("Grpc-Accept-Encoding", "identity")
+		writeGRPCStatus(w, grpcUnimplemented, "compressed messages are not supported")
+		return
+	}
+
+	req, code, err := readGRPCMessage(r.Body)
+
+	if err != nil {
+		writeGRPCError(w, err, code)
+		return
+	}
+
+	resp, code, err := method(rt, ctx, req)
+
+	if err != nil {
+		writeGRPCError(w, err, code)
+		return
+	}
+
+	err = writeGRPCMessage(w, resp)
+
+	if err != nil {
+		ctx.Logger.WithError(err).Debug("can't write the gRPC response")
+		return
+	}
+
+	writeGRPCStatus(w, grpcOK, "")
+}
+
+// readGRPCMessage reads the only message of a unary call from the body of the request, returning the status code and
+// the error to be returned if it cannot
+func readGRPCMessage(body io.Reader) ([]byte, int, error) {
+	var prefix [5]byte
+
+	_, err := io.ReadFull(body, prefix[:])
+
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, http.StatusBadRequest, ErrInvalidGRPCCall
+	}
+
+	if err != nil {
+		code, err := requestBodyError(err)
+		return nil, code, err
+	}
+
+	// the messages are never compressed,
+	// as the encoding of the call tells
+	if prefix[0] != 0 {
+		return nil, http.StatusBadRequest, ErrInvalidGRPCCall
+	}
+
+	// the body of the request is limited already,
+	// hence the message is read up to its length
+	length := int64(binary.BigEndian.Uint32(prefix[1:]))
+
+	msg, err := io.ReadAll(io.LimitReader(body, length))
+
+	if err != nil {
+		code, err := requestBodyError(err)
+		return nil, code, err
+	}
+
+	if int64(len(msg)) < length {
+		return nil, http.StatusBadRequest, ErrInvalidGRPCCall
+	}
+
+	return msg, -1, nil
+}
+
+// writeGRPCMessage writes the message to the body of the response, prefixed by its length and not compressed
+func writeGRPCMessage(w http.ResponseWriter, msg []byte) error {
+	frame := make([]byte, 5, 5+len(msg))
+
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(msg)))
+
+	_, err := w.Write(append(frame, msg...))
+
+	return err
+}
+
+// writeGRPCError ends the call with the status of gRPC matching the error, as the REST API would report it
+func writeGRPCError(w http.ResponseWriter, err error, status int) {
+	status, _ = errorStatus(err, status)
+
+	writeGRPCStatus(w, grpcCode(status), err.Error())
+}
+
+// writeGRPCStatus ends the call with the status code of gRPC and its message, sent as trailers
+func writeGRPCStatus(w http.ResponseWriter, code int, message string) {
+	w.Header().Set(http.TrailerPrefix+"Grpc-Status", strconv.Itoa(code))
+
+	if message != "" {
+		w.Header().Set(http.TrailerPrefix+"Grpc-Message", grpcEscape(message))
+	}
+}
+
+// grpcCode returns the status code of gRPC matching the HTTP status, following the mapping of the gRPC gateways
+func grpcCode(status int) int {
+	switch status {
+	case http.StatusBadRequest:
+		return grpcInvalidArgument
+	case http.StatusUnauthorized:
+		return grpcUnauthenticated
+	case http.StatusForbidden:
+		return grpcPermissionDenied
+	case http.StatusNotFound:
+		return grpcNotFound
+	case http.StatusRequestTimeout:
+		return grpcDeadlineExceeded
+	case http.StatusConflict:
+		return grpcAlreadyExists
+	case http.StatusRequestEntityTooLarge, http.StatusTooManyRequests:
+		return grpcResourceExhausted
+	case http.StatusNotImplemented:
+		return grpcUnimplemented
+	case http.StatusServiceUnavailable:
+		return grpcUnavailable
+	}
+
+	if status >= 500 {
+		return grpcInternal
+	}
+
+	return grpcUnknown
+}
+
+// grpcEscape percent-encodes the message of a status, as required by gRPC for the bytes which are not printable ASCII
+func grpcEscape(message string) string {
+	var b strings.Builder
+
+	for i := 0; i < len(message); i++ {
+		c := message[i]
+
+		if c < 0x20 || c > 0x7e || c == '%' {
+			fmt.Fprintf(&b, "%%%02X", c)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+
+	return b.String()
+}
+
+// grpcPageLimit returns the size of a page requested by a call, where 0 stands for the default one
+func grpcPageLimit(limit uint64) int {
+	if limit == 0 {
+		return defaultPageLimit
+	}
+
+	if limit > maxPageLimit {
+		return maxPageLimit
+	}
+
+	return int(limit)
+}
+
+// grpcCursor returns the value of a field holding the id of a resource, which fits in 32 bits
+func grpcCursor(v uint64) (uint32, error) {
+	if v > 1<<32-1 {
+		return 0, ErrInvalidGRPCCall
+	}
+
+	return uint32(v), nil
+}
+
+// grpcRequest decodes the fields of a request message, passing the ones holding a string or an integer to `field`,
+// and skipping the other ones
+func grpcRequest(req []byte, field func(number int, s string, v uint64) error) error {
+	dec := protowire.NewDecoder(req)
+
+	for dec.More() {
+		number, typ, err := dec.Next()
+
+		if err != nil {
+			return ErrInvalidGRPCCall
+		}
+
+		switch typ {
+		case protowire.Varint:
+			v, err := dec.Uint()
+
+			if err != nil {
+				return ErrInvalidGRPCCall
+			}
+
+			err = field(number, "", v)
+
+			if err != nil {
+				return err
+			}
+		case protowire.Bytes:
+			s, err := dec.String()
+
+			if err != nil {
+				return ErrInvalidGRPCCall
+			}
+
+			err = field(number, s, 0)
+
+			if err != nil {
+				return err
+			}
+		default:
+			if dec.Skip(typ) != nil {
+				return ErrInvalidGRPCCall
+			}
+		}
+	}
+
+	return nil
+}
+
+// grpcUser returns the user performing the call
+func (rt *_router) grpcUser(ctx reqcontext.RequestContext) (database.DatabaseUser, int, error) {
+	userId, err := GetAuthenticatedUserId(ctx)
+
+	if err != nil {
+		return database.DatabaseUserDefault(), http.StatusUnauthorized, err
+	}
+
+	dbUser, err := rt.db.GetDatabaseUser(ctx.Context, userId)
+
+	if err != nil {
+		return dbUser, http.StatusInternalServerError, err
+	}
+
+	return dbUser, -1, nil
+}
+
+// grpcOwner returns the user whose username is given by the call, unless they banned the user performing the call
+func (rt *_router) grpcOwner(ctx reqcontext.RequestContext, dbUser database.DatabaseUser, username string) (User, int, error) {
+	owner, err := rt.GetUserFromLogin(ctx, LoginFromUsername(username))
+
+	if err != nil {
+		return owner, http.StatusInternalServerError, err
+	}
+
+	checkBan, err := rt.db.CheckBan(ctx.Context, owner.UserIntoDatabaseUser(), dbUser)
+
+	if err != nil {
+		return owner, http.StatusInternalServerError, err
+	}
+
+	if checkBan {
+		return owner, http.StatusUnauthorized, ErrBannedUser
+	}
+
+	return owner, -1, nil
+}
+
+func (rt *_router) grpcGetProfile(ctx reqcontext.RequestContext, req []byte) ([]byte, int, error) {
+	var username string
+	var limit uint64
+	var before uint32
+	var archived bool
+
+	err := grpcRequest(req, func(number int, s string, v uint64) (err error) {
+		switch number {
+		case 1:
+			username = s
+		case 2:
+			limit = v
+		case 3:
+			before, err = grpcCursor(v)
+		case 4:
+			archived = v != 0
+		}
+
+		return err
+	})
+
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	dbUser, code, err := rt.grpcUser(ctx)
+
+	if err != nil {
+		return nil, code, err
+	}
+
+	profileUser, code, err := rt.grpcOwner(ctx, dbUser, username)
+
+	if err != nil {
+		return nil, code, err
+	}
+
+	// only the owner of the profile can see the archived photos
+	if archived && profileUser.Id != dbUser.Id {
+		return nil, http.StatusUnauthorized, ErrUserUnauthorized
+	}
+
+	profile, err := rt.buildProfile(ctx, dbUser, profileUser, archived, grpcPageLimit(limit), before)
+
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	enc := protowire.NewEncoder()
+
+	enc.Message(1, encodeGRPCUser(profile.User))
+
+	for _, photo := range profile.Photos {
+		enc.Message(2, encodeGRPCPhoto(photo))
+	}
+
+	enc.Uint(3, uint64(profile.PhotoCount))
+	enc.Uint(4, uint64(profile.FollowersCount))
+	enc.Uint(5, uint64(profile.FollowingCount))
+	enc.Bool(6, profile.FollowStatus)
+	enc.Bool(7, profile.BanStatus)
+	enc.Bool(8, profile.MuteStatus)
+	enc.Bool(9, profile.CloseFriend)
+	enc.Uint(10, uint64(profile.NextCursor))
+
+	return enc.Bytes(), -1, nil
+}
+
+func (rt *_router) grpcGetStream(ctx reqcontext.RequestContext, req []byte) ([]byte, int, error) {
+	var limit uint64
+	var before, after uint32
+
+	err := grpcRequest(req, func(number int, s string, v uint64) (err error) {
+		switch number {
+		case 1:
+			limit = v
+		case 2:
+			before, err = grpcCursor(v)
+		case 3:
+			after, err = grpcCursor(v)
+		}
+
+		return err
+	})
+
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	dbUser, code, err := rt.grpcUser(ctx)
+
+	if err != nil {
+		return nil, code, err
+	}
+
+	dbStream, err := rt.db.GetDatabaseStream(ctx.Context, dbUser, database.DatabaseStreamFilterDefault(), grpcPageLimit(limit), before, after)
+
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	dbStream.User = dbUser
+
+	stream := StreamFromDatabaseStream(dbStream)
+
+	enc := protowire.NewEncoder()
+
+	enc.Message(1, encodeGRPCUser(stream.User))
+
+	for _, photo := range stream.Photos {
+		enc.Message(2, encodeGRPCPhoto(photo))
+	}
+
+	return enc.Bytes(), -1, nil
+}
+
+func (rt *_router) grpcGetComments(ctx reqcontext.RequestContext, req []byte) ([]byte, int, error) {
+	var username string
+	var photoId, after uint32
+	var limit uint64
+
+	err := grpcRequest(req, func(number int, s string, v uint64) (err error) {
+		switch number {
+		case 1:
+			username = s
+		case 2:
+			photoId, err = grpcCursor(v)
+		case 3:
+			limit = v
+		case 4:
+			after, err = grpcCursor(v)
+		}
+
+		return err
+	})
+
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	dbUser, code, err := rt.grpcUser(ctx)
+
+	if err != nil {
+		return nil, code, err
+	}
+
+	photoUser, code, err := rt.grpcOwner(ctx, dbUser, username)
+
+	if err != nil {
+		return nil, code, err
+	}
+
+	photo, err := rt.GetPhotoFromPhotoId(ctx, photoId, UserFromDatabaseUser(dbUser))
+
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	// check if the photo belongs to the user
+	if photo.User.Id != photoUser.Id {
+		return nil, http.StatusNotFound, ErrPageNotFound
+	}
+
+	dbCommentList, err := rt.db.GetCommentList(ctx.Context, photo.PhotoIntoDatabasePhoto(), dbUser, database.CommentSortOldest, grpcPageLimit(limit), after)
+
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	enc := protowire.NewEncoder()
+
+	for _, comment := range CommentListFromDatabaseCommentList(dbCommentList).Comments {
+		enc.Message(1, encodeGRPCComment(comment))
+	}
+
+	return enc.Bytes(), -1, nil
+}
+
+func encodeGRPCUser(user User) func(*protowire.Encoder) {
+	return func(enc *protowire.Encoder) {
+		enc.Uint(1, uint64(user.Id))
+		enc.String(2, user.Username)
+	}
+}
+
+// encodeGRPCTimestamp encodes the date as a google.protobuf.Timestamp
+func encodeGRPCTimestamp(date time.Time) func(*protowire.Encoder) {
+	return func(enc *protowire.Encoder) {
+		enc.Int(1, date.Unix())
+		enc.Int(2, int64(date.Nanosecond()))
+	}
+}
+
+func encodeGRPCPhoto(photo Photo) func(*protowire.Encoder) {
+	return func(enc *protowire.Encoder) {
+		enc.Uint(1, uint64(photo.Id))
+		enc.Message(2, encodeGRPCUser(photo.User))
+		enc.String(3, photo.Url)
+		enc.Message(4, encodeGRPCTimestamp(photo.Date))
+		enc.Uint(5, uint64(photo.LikeCount))
+		enc.Uint(6, uint64(photo.CommentCount))
+		enc.Bool(7, photo.LikeStatus)
+		enc.String(8, photo.Reaction)
+
+		// the entries of the map, sorted so that
+		// the same photo is always encoded the same
+		reactions := make([]string, 0, len(photo.Reactions))
+
+		for reaction := range photo.Reactions {
+			reactions = append(reactions, reaction)
+		}
+
+		sort.Strings(reactions)
+
+		for _, reaction := range reactions {
+			count := photo.Reactions[reaction]
+
+			enc.Message(9, func(entry *protowire.Encoder) {
+				entry.String(1, reaction)
+				entry.Uint(2, uint64(count))
+			})
+		}
+
+		enc.Bool(10, photo.Archived)
+		enc.Uint(11, uint64(photo.DuplicateOf))
+
+		if photo.Latitude != nil {
+			enc.Double(12, *photo.Latitude)
+		}
+
+		if photo.Longitude != nil {
+			enc.Double(13, *photo.Longitude)
+		}
+
+		enc.String(14, photo.Place)
+		enc.Bool(15, photo.Pinned)
+		enc.Bool(16, photo.CloseFriends)
+		enc.Bool(17, photo.Flagged)
+		enc.String(18, photo.MediaType)
+		enc.String(19, photo.PosterUrl)
+
+		if photo.Duration != 0 {
+			enc.Double(20, photo.Duration)
+		}
+
+		enc.Bool(21, photo.Scheduled)
+		enc.String(22, photo.OriginalUrl)
+		enc.String(23, photo.AltText)
+	}
+}
+
+func encodeGRPCComment(comment Comment) func(*protowire.Encoder) {
+	return func(enc *protowire.Encoder) {
+		enc.Uint(1, uint64(comment.Id))
+		enc.Message(2, encodeGRPCUser(comment.User))
+		enc.Uint(3, uint64(comment.Photo.Id))
+		enc.Message(4, encodeGRPCTimestamp(comment.Date))
+		enc.String(5, comment.CommentBody)
+	}
+}
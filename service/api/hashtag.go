@@ -0,0 +1,67 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/api/reqcontext"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/database"
+	"github.com/julienschmidt/httprouter"
+)
+
+func (rt *_router) getHashtagPhotos(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// get the user authenticated by the bearer token
+	userId, err := GetAuthenticatedUserId(ctx)
+
+	if err != nil {
+		writeError(w, err, http.StatusUnauthorized)
+		return
+	}
+
+	// get the user performing the action
+	dbUser, err := rt.db.GetDatabaseUser(ctx.Context, userId)
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	// get the hashtag from the path, with or without the leading #
+	hashtag, ok := database.NormalizeHashtag(ps.ByName("tag"))
+
+	if !ok {
+		writeError(w, ErrInvalidHashtag, http.StatusBadRequest)
+		return
+	}
+
+	// get the pagination parameters from the query
+	limit, _, code, err := GetPageFromQuery(r)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	before, code, err := GetCursorFromQuery("before", r)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	// get the page of the photos tagged with the hashtag from the database
+	dbFeed, err := rt.db.GetHashtagPhotos(ctx.Context, dbUser, hashtag, limit, before)
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	feed := HashtagFeedFromDatabaseHashtagFeed(dbFeed)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK) // 200
+
+	// return the hashtag feed
+	_ = json.NewEncoder(w).Encode(feed)
+}
@@ -0,0 +1,87 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/sirupsen/logrus"
+)
+
+// readinessTimeout bounds the checks of a readiness probe, so that a dependency which hangs fails the probe in time
+const readinessTimeout = 3 * time.Second
+
+// HealthStatus is the status of the server, or of a dependency of it, reported to the probes
+type HealthStatus struct {
+	Status string `json:"status"`
+
+	// Version and Latest are the version of the structure of the database and the latest one, for the migrations
+	Version *int `json:"version,omitempty"`
+	Latest  *int `json:"latest,omitempty"`
+
+	// Checks holds the status of each dependency, for the whole server
+	Checks map[string]HealthStatus `json:"checks,omitempty"`
+}
+
+// healthz is the liveness probe: it tells that the process is up and serving requests, without looking at its
+// dependencies, so that the orchestrator does not restart the server while the database is unavailable
+func (rt *_router) healthz(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK) // 200
+
+	_ = json.NewEncoder(w).Encode(HealthStatus{Status: "ok"})
+}
+
+// readyz is the readiness probe: it replies with 200 only if the database answers, the storage of the photos can be
+// reached and the migrations of the database were all applied, and with 503 otherwise, telling the status of each
+// dependency. The errors are only logged, since the probe requires no authentication.
+func (rt *_router) readyz(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+	defer cancel()
+
+	ready := HealthStatus{Status: "ok", Checks: map[string]HealthStatus{}}
+
+	check := func(name string, err error) HealthStatus {
+		if err != nil {
+			rt.baseLogger.WithError(err).WithField("check", name).Warn("readiness check failed")
+			ready.Status = "unavailable"
+
+			return HealthStatus{Status: "unavailable"}
+		}
+
+		return HealthStatus{Status: "ok"}
+	}
+
+	ready.Checks["database"] = check("database", rt.db.Ping(ctx))
+	ready.Checks["storage"] = check("storage", rt.photos.Ping(ctx))
+
+	version, latest, err := rt.db.SchemaVersion(ctx)
+
+	migrations := check("migrations", err)
+
+	if err == nil {
+		migrations.Version, migrations.Latest = &version, &latest
+
+		if version != latest {
+			rt.baseLogger.WithFields(logrus.Fields{"version": version, "latest": latest}).Warn("readiness check failed: database not migrated")
+			migrations.Status = "unavailable"
+			ready.Status = "unavailable"
+		}
+	}
+
+	ready.Checks["migrations"] = migrations
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+
+	if ready.Status == "ok" {
+		w.WriteHeader(http.StatusOK) // 200
+	} else {
+		w.WriteHeader(http.StatusServiceUnavailable) // 503
+	}
+
+	_ = json.NewEncoder(w).Encode(ready)
+}
@@ -0,0 +1,294 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"time"
+
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/api/reqcontext"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/database"
+	"github.com/julienschmidt/httprouter"
+)
+
+// idempotencyKeyHeader is the header the clients send the idempotency key of a request with
+const idempotencyKeyHeader = "Idempotency-Key"
+
+// idempotentReplayedHeader tells the client that the response was replayed from the first request with the same key
+const idempotentReplayedHeader = "Idempotent-Replayed"
+
+// maxIdempotencyKeyLength is the maximum length of an idempotency key
+const maxIdempotencyKeyLength = 255
+
+// idempotencyKeyAbandonment is how long a key can be in progress before it is taken over, as the request it was
+// reserved for is assumed to be lost (eg. the server stopped while serving it)
+const idempotencyKeyAbandonment = 5 * time.Minute
+
+// idempotent wraps a handler creating something (a photo, a comment, a follow, a like), so that the retries of a
+// request sent with an Idempotency-Key header are answered with the response to the first one, instead of being served
+// again. The successful responses are stored for the lifetime of the keys; a request which fails stores nothing, so
+// that its retries are served anew. The requests without the header, or sent by no user, are served as usual.
+func (rt *_router) idempotent(fn httpRouterHandler) httpRouterHandler {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+		key, sent := r.Header[idempotencyKeyHeader]
+
+		if !sent || ctx.UserId == 0 {
+			fn(w, r, ps, ctx)
+			return
+		}
+
+		if len(key) != 1 || !validIdempotencyKey(key[0]) {
+			writeError(w, ErrInvalidIdempotencyKey, http.StatusBadRequest)
+			return
+		}
+
+		// read the whole body to tell the request apart from the
+		// other ones sent with the same key, and give it back
+		// to the handler afterwards
+		body, err := io.ReadAll(r.Body)
+
+		if err != nil {
+			code, err := requestBodyError(err)
+			writeError(w, err, code)
+			return
+		}
+
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		now := time.Now()
+
+		dbKey := database.DatabaseIdempotencyKeyDefault()
+		dbKey.User = ctx.UserId
+		dbKey.Key = key[0]
+		dbKey.Fingerprint = requestFingerprint(r, body)
+		dbKey.Date = now
+
+		// the key is stored and completed even if the client
+		// goes away, so that its retries find the response
+		dbCtx := context.WithoutCancel(r.Context())
+
+		err = rt.db.ReserveIdempotencyKey(dbCtx, dbKey, now.Add(-rt.idempotencyLifetime), now.Add(-idempotencyKeyAbandonment))
+
+		if errors.Is(err, database.ErrIdempotencyKeyInUse) {
+			rt.replayIdempotentResponse(w, dbCtx, dbKey, ctx)
+			return
+		}
+
+		if err != nil {
+			ctx.Logger.WithError(err).Error("can't reserve the idempotency key")
+			writeError(w, err, http.StatusInternalServerError)
+			return
+		}
+
+		rec := &responseRecorder{ResponseWriter: w}
+
+		// release the key if the request fails, or if the handler
+		// panics, so that the retries of the request are served
+		defer func() {
+			if rec.ok() {
+				return
+			}
+
+			err := rt.db.DeleteIdempotencyKey(dbCtx, dbKey.User, dbKey.Key)
+
+			if err != nil {
+				ctx.Logger.WithError(err).Error("can't release the idempotency key")
+			}
+		}()
+
+		fn(rec, r, ps, ctx)
+
+		if !rec.ok() {
+			return
+		}
+
+		dbKey.Status = rec.status
+		dbKey.ContentType = rec.Header().Get("Content-Type")
+		dbKey.Body = rec.body.Bytes()
+
+		err = rt.db.CompleteIdempotencyKey(dbCtx, dbKey)
+
+		if err != nil {
+			ctx.Logger.WithError(err).Error("can't store the response of the idempotency key")
+		}
+	}
+}
+
+// replayIdempotentResponse answers a request with the response stored with its idempotency key, unless the key was
+// used for a different request or its first request is still in progress
+func (rt *_router) replayIdempotentResponse(w http.ResponseWriter, dbCtx context.Context, dbKey database.DatabaseIdempotencyKey, ctx reqcontext.RequestContext) {
+	stored, err := rt.db.GetIdempotencyKey(dbCtx, dbKey.User, dbKey.Key)
+
+	// the key was released in the meantime, since its
+	// first request failed: the client can retry at once
+	if errors.Is(err, database.ErrIdempotencyKeyDoesNotExist) {
+		writeError(w, ErrIdempotencyKeyInProgress, http.StatusConflict)
+		return
+	}
+
+	if err != nil {
+		ctx.Logger.WithError(err).Error("can't get the idempotency key")
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	if stored.Fingerprint != dbKey.Fingerprint {
+		writeError(w, ErrIdempotencyKeyReused, http.StatusUnprocessableEntity)
+		return
+	}
+
+	if stored.Status == 0 {
+		w.Header().Set("Retry-After", "1")
+		writeError(w, ErrIdempotencyKeyInProgress, http.StatusConflict)
+		return
+	}
+
+	if stored.ContentType != "" {
+		w.Header().Set("Content-Type", stored.ContentType)
+	}
+
+	w.Header().Set(idempotentReplayedHeader, "true")
+	w.WriteHeader(stored.Status)
+
+	_, _ = w.Write(stored.Body)
+}
+
+// validIdempotencyKey reports whether the idempotency key is made of 1 to maxIdempotencyKeyLength printable ASCII
+// characters
+func validIdempotencyKey(key string) bool {
+	if len(key) == 0 || len(key) > maxIdempotencyKeyLength {
+		return false
+	}
+
+	for i := 0; i < len(key); i++ {
+		if key[i] < ' ' || key[i] > '~' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// requestFingerprint returns the hash identifying the request among the ones sent with the same idempotency key, made
+// of its method, its path and its body. The multipart bodies are hashed part by part, since their boundary is chosen
+// anew by the clients on every retry.
+func requestFingerprint(r *http.Request, body []byte) string {
+	hash := sha256.New()
+
+	_, _ = io.WriteString(hash, r.Method+" "+r.URL.Path+"\n")
+
+	mediaType, params, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	if mediaType != "multipart/form-data" || !hashParts(hash, body, params["boundary"]) {
+		_, _ = hash.Write(body)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// hashParts writes the names and the contents of the parts of the multipart body into the hash, reporting whether the
+// body could be parsed
+func hashParts(hash io.Writer, body []byte, boundary string) bool {
+	if boundary == "" {
+		return false
+	}
+
+	reader := multipart.NewReader(bytes.NewReader(body), boundary)
+
+	for {
+		part, err := reader.NextPart()
+
+		if errors.Is(err, io.EOF) {
+			return true
+		}
+
+		if err != nil {
+			return false
+		}
+
+		_, _ = io.WriteString(hash, strconv.Quote(part.FormName())+" "+strconv.Quote(part.FileName())+"\n")
+
+		content := sha256.New()
+
+		_, err = io.Copy(content, part)
+
+		if err != nil {
+			return false
+		}
+
+		_, _ = hash.Write(content.Sum(nil))
+	}
+}
+
+// responseRecorder sends the response to the client, recording it at the same time
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+
+	rec.body.Write(b)
+
+	return rec.ResponseWriter.Write(b)
+}
+
+// Unwrap returns the underlying http.ResponseWriter, for http.ResponseController
+func (rec *responseRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// ok reports whether the request succeeded
+func (rec *responseRecorder) ok() bool {
+	return rec.status >= 200 && rec.status < 300
+}
+
+// cleanupIdempotencyKeys removes the expired idempotency keys every `interval`, until the router is closed
+func (rt *_router) cleanupIdempotencyKeys(interval time.Duration) {
+	defer close(rt.idempotencyDone)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-rt.closing:
+			return
+		case <-ticker.C:
+			rt.deleteExpiredIdempotencyKeys()
+		}
+	}
+}
+
+// deleteExpiredIdempotencyKeys removes the idempotency keys whose responses are no longer replayed
+func (rt *_router) deleteExpiredIdempotencyKeys() {
+	deleted, err := rt.db.DeleteExpiredIdempotencyKeys(context.Background(), time.Now().Add(-rt.idempotencyLifetime))
+
+	if err != nil {
+		rt.baseLogger.WithError(err).Error("cannot remove the expired idempotency keys")
+		return
+	}
+
+	if deleted > 0 {
+		rt.baseLogger.WithField("keys", deleted).Debug("expired idempotency keys removed")
+	}
+}
@@ -5,140 +5,160 @@ import (
 	"net/http"
 
 	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/api/reqcontext"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/database"
 	"github.com/julienschmidt/httprouter"
 )
 
 func (rt *_router) getPhotoLikes(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
-	// get the bearer token
-	token, err := GetBearerToken(r.Header.Get("Authorization"))
+	// get the user authenticated by the bearer token
+	userId, err := GetAuthenticatedUserId(ctx)
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusUnauthorized)
+		writeError(w, err, http.StatusUnauthorized)
 		return
 	}
 
 	// authenticate the user performing the action
-	dbUser, err := rt.db.GetDatabaseUser(uint32(token))
+	dbUser, err := rt.db.GetDatabaseUser(ctx.Context, userId)
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err, http.StatusInternalServerError)
 		return
 	}
 
 	// get the user of the photo from the resource parameter
-	photoUser, code, err := rt.GetUserFromParameter("uname", r, ps)
+	photoUser, code, err := rt.GetUserFromParameter(ctx, "uname", r, ps)
 
 	if err != nil {
-		http.Error(w, err.Error(), code)
+		writeError(w, err, code)
 		return
 	}
 
 	// check whether the user of the photo
 	// has banned the user performing the action
-	checkBan, err := rt.db.CheckBan(photoUser.UserIntoDatabaseUser(), dbUser)
+	checkBan, err := rt.db.CheckBan(ctx.Context, photoUser.UserIntoDatabaseUser(), dbUser)
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err, http.StatusInternalServerError)
 		return
 	}
 
 	if checkBan {
-		http.Error(w, ErrBannedUser.Error(), http.StatusUnauthorized)
+		writeError(w, ErrBannedUser, http.StatusUnauthorized)
 		return
 	}
 
 	// get the photo from the resource parameter
-	photo, code, err := rt.GetPhotoFromParameter("photo_id", UserFromDatabaseUser(dbUser), r, ps)
+	photo, code, err := rt.GetPhotoFromParameter(ctx, "photo_id", UserFromDatabaseUser(dbUser), r, ps)
 
 	if err != nil {
-		http.Error(w, err.Error(), code)
+		writeError(w, err, code)
 		return
 	}
 
 	// check if the resource is consistent
 	if photo.User.Id != photoUser.Id {
-		http.Error(w, ErrPageNotFound.Error(), http.StatusNotFound)
+		writeError(w, ErrPageNotFound, http.StatusNotFound)
 		return
 	}
 
-	// get the like list from the database
-	dbLikeList, err := rt.db.GetLikeList(photo.PhotoIntoDatabasePhoto(), dbUser)
+	// get the pagination parameters from the query
+	limit, after, code, err := GetPageFromQuery(r)
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err, code)
 		return
 	}
 
-	likeList := UserListFromDatabaseUserList(dbLikeList)
+	// get the page of the like list from the database
+	dbLikeList, err := rt.db.GetLikeList(ctx.Context, photo.PhotoIntoDatabasePhoto(), dbUser, limit, after)
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK) // 200
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	likeList := LikeListFromDatabaseLikeList(dbLikeList)
+
+	list := ItemList{Items: likeList.Users, Total: &likeList.Total}
+
+	// the owner of the photo hid how many users liked it
+	if photo.LikesHidden {
+		likeList.Total = 0
+		list.Total = nil
+	}
+
+	if len(likeList.Users) > 0 {
+		list.NextCursor = nextCursor(len(likeList.Users), limit, likeList.Users[len(likeList.Users)-1].Id)
+	}
 
 	// return the like list
-	_ = json.NewEncoder(w).Encode(likeList)
+	writeList(w, r, likeList, list, "after")
 }
 
 func (rt *_router) likePhoto(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// a like is a reaction of type like
+	rt.reactToPhoto(w, r, ps, ctx, "like_uname", database.ReactionLike)
+}
+
+func (rt *_router) unlikePhoto(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// removing a like removes the reaction, whatever its type
+	rt.removeReaction(w, r, ps, ctx, "like_uname")
+}
+
+// reactToPhoto adds the reaction of the user given by the resource parameter `parameter` to the photo, or changes its
+// type if the user already reacted, and returns the photo
+func (rt *_router) reactToPhoto(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext, parameter string, reaction string) {
 	// authenticate the user performing the action
-	likeUser, code, err := rt.AuthenticateUserFromParameter("like_uname", r, ps)
+	likeUser, code, err := rt.AuthenticateUserFromParameter(ctx, parameter, r, ps)
 
 	if err != nil {
-		http.Error(w, err.Error(), code)
+		writeError(w, err, code)
 		return
 	}
 
 	// get the user of the photo from the resource parameter
-	user, code, err := rt.GetUserFromParameter("uname", r, ps)
+	user, code, err := rt.GetUserFromParameter(ctx, "uname", r, ps)
 
 	if err != nil {
-		http.Error(w, err.Error(), code)
+		writeError(w, err, code)
 		return
 	}
 
 	// get the photo from the resource parameter
-	photo, code, err := rt.GetPhotoFromParameter("photo_id", likeUser, r, ps)
+	photo, code, err := rt.GetPhotoFromParameter(ctx, "photo_id", likeUser, r, ps)
 
 	if err != nil {
-		http.Error(w, err.Error(), code)
+		writeError(w, err, code)
 		return
 	}
 
 	// check if the resource is consistent
 	if photo.User.Id != user.Id {
-		http.Error(w, ErrPageNotFound.Error(), http.StatusNotFound)
+		writeError(w, ErrPageNotFound, http.StatusNotFound)
 		return
 	}
 
-	// insert the like into the databse
-	err = rt.db.InsertLike(likeUser.UserIntoDatabaseUser(), photo.PhotoIntoDatabasePhoto())
+	// insert the reaction into the databse
+	err = rt.db.InsertLike(ctx.Context, likeUser.UserIntoDatabaseUser(), photo.PhotoIntoDatabasePhoto(), reaction)
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err, http.StatusInternalServerError)
 		return
 	}
 
 	dbPhoto := photo.PhotoIntoDatabasePhoto()
 
-	// update the number of likes to the photo
-	err = rt.db.GetPhotoLikeCount(&dbPhoto, likeUser.UserIntoDatabaseUser())
+	// update the reactions to the photo
+	// and the number of comments under it
+	err = rt.db.GetPhotoStats(ctx.Context, &dbPhoto, likeUser.UserIntoDatabaseUser())
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err, http.StatusInternalServerError)
 		return
 	}
 
-	photo.LikeCount = dbPhoto.LikeCount
-	photo.LikeStatus = true
-
-	// update the number of comments under the photo
-	err = rt.db.GetPhotoCommentCount(&dbPhoto, likeUser.UserIntoDatabaseUser())
-
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	photo.CommentCount = dbPhoto.CommentCount
+	photo = PhotoFromDatabasePhoto(dbPhoto)
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK) // 200
@@ -147,42 +167,43 @@ func (rt *_router) likePhoto(w http.ResponseWriter, r *http.Request, ps httprout
 	_ = json.NewEncoder(w).Encode(photo)
 }
 
-func (rt *_router) unlikePhoto(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+// removeReaction removes the reaction to the photo of the user given by the resource parameter `parameter`
+func (rt *_router) removeReaction(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext, parameter string) {
 	// authenticate the user performing the action
-	likeUser, code, err := rt.AuthenticateUserFromParameter("like_uname", r, ps)
+	likeUser, code, err := rt.AuthenticateUserFromParameter(ctx, parameter, r, ps)
 
 	if err != nil {
-		http.Error(w, err.Error(), code)
+		writeError(w, err, code)
 		return
 	}
 
 	// get the user of the photo from the resource parameter
-	user, code, err := rt.GetUserFromParameter("uname", r, ps)
+	user, code, err := rt.GetUserFromParameter(ctx, "uname", r, ps)
 
 	if err != nil {
-		http.Error(w, err.Error(), code)
+		writeError(w, err, code)
 		return
 	}
 
 	// get the photo from the resource parameter
-	photo, code, err := rt.GetPhotoFromParameter("photo_id", likeUser, r, ps)
+	photo, code, err := rt.GetPhotoFromParameter(ctx, "photo_id", likeUser, r, ps)
 
 	if err != nil {
-		http.Error(w, err.Error(), code)
+		writeError(w, err, code)
 		return
 	}
 
 	// check if the resource is consistent
 	if photo.User.Id != user.Id {
-		http.Error(w, ErrPageNotFound.Error(), http.StatusNotFound)
+		writeError(w, ErrPageNotFound, http.StatusNotFound)
 		return
 	}
 
 	// remove the like from the database
-	err = rt.db.DeleteLike(likeUser.UserIntoDatabaseUser(), photo.PhotoIntoDatabasePhoto())
+	err = rt.db.DeleteLike(ctx.Context, likeUser.UserIntoDatabaseUser(), photo.PhotoIntoDatabasePhoto())
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err, http.StatusInternalServerError)
 		return
 	}
 
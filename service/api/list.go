@@ -0,0 +1,68 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/api/reqcontext"
+	"github.com/julienschmidt/httprouter"
+)
+
+// ItemList is the envelope of the pages of every list served by /v2: the items of the page, the cursor of the next page,
+// which is 0 if there are no more items, and the number of the items of the whole list, when it is known
+type ItemList struct {
+	Items      interface{} `json:"items"`
+	NextCursor uint32      `json:"next_cursor"`
+	Total      *int        `json:"total,omitempty"`
+}
+
+// envelopeKey is the key of the context of the requests whose list is answered in an ItemList
+type envelopeKey struct{}
+
+// enveloped wraps the handler of a list, so that it answers with its page in an ItemList instead of the body of /v1
+func (rt *_router) enveloped(fn httpRouterHandler) httpRouterHandler {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+		fn(w, r.WithContext(context.WithValue(r.Context(), envelopeKey{}, true)), ps, ctx)
+	}
+}
+
+// isEnveloped reports whether the list requested by r is answered in an ItemList
+func isEnveloped(r *http.Request) bool {
+	enveloped, _ := r.Context().Value(envelopeKey{}).(bool)
+
+	return enveloped
+}
+
+// nextCursor returns the cursor of the page after the one of `count` items ending with the item `last`, which is 0 if
+// the page is not full, as there are no more items
+func nextCursor(count int, limit int, last uint32) uint32 {
+	if count == 0 || count < limit {
+		return 0
+	}
+
+	return last
+}
+
+// writeList answers with the page of a list: `body` as served by /v1, or the page `list` if the request is enveloped.
+// The next page, if any, is linked in the Link header (RFC 5988) as the request with its query parameter `cursor` set to
+// the next cursor of the page.
+func writeList(w http.ResponseWriter, r *http.Request, body interface{}, list ItemList, cursor string) {
+	if list.NextCursor != 0 {
+		query := r.URL.Query()
+		query.Set(cursor, strconv.FormatUint(uint64(list.NextCursor), 10))
+
+		// the legacy routes link their successor version in the same header
+		w.Header().Add("Link", "<"+r.URL.Path+"?"+query.Encode()+`>; rel="next"`)
+	}
+
+	if isEnveloped(r) {
+		body = list
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK) // 200
+
+	_ = json.NewEncoder(w).Encode(body)
+}
@@ -2,9 +2,12 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
+	"time"
 
 	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/api/reqcontext"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/database"
 	"github.com/julienschmidt/httprouter"
 )
 
@@ -12,10 +15,16 @@ func (rt *_router) session(w http.ResponseWriter, r *http.Request, ps httprouter
 	login := LoginDefault()
 
 	// get the new user's username
-	err := json.NewDecoder(r.Body).Decode(&login)
+	code, err := decodeJSON(r, &login)
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err, code)
+		return
+	}
+
+	// the email address given on signup is optional
+	if login.Email != "" && !validEmail(login.Email) {
+		writeError(w, ErrInvalidEmail, http.StatusBadRequest)
 		return
 	}
 
@@ -23,23 +32,123 @@ func (rt *_router) session(w http.ResponseWriter, r *http.Request, ps httprouter
 	user := UserDefault()
 	dbUser := user.UserIntoDatabaseUser()
 
-	// update the new user's username
-	dbUser.Username = login.Username
+	// update the new user's username, saved in
+	// the normalization of the username policy
+	dbUser.Username = rt.usernames.Normalize(login.Username)
+
+	// the users who linked an identity sign in through its
+	// provider, unless every provider was disabled since
+	if len(rt.authProviders) > 0 {
+		linked, err := rt.db.CheckIdentity(ctx.Context, login.LoginIntoDatabaseLogin())
+
+		if err != nil {
+			writeError(w, err, http.StatusInternalServerError)
+			return
+		}
+
+		if linked {
+			writeError(w, ErrExternalLogin, http.StatusUnauthorized)
+			return
+		}
+	}
+
+	// restore the account of the user if it was deactivated
+	// within the reactivation window, otherwise its data and
+	// its files are removed and the user is registered again
+	since := time.Now().Add(-rt.reactivationWindow)
+
+	urls, err := rt.db.ReactivateUser(ctx.Context, login.LoginIntoDatabaseLogin(), since)
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	rt.deleteAccountFiles(ctx.Context, ctx.Logger, urls)
 
-	// insert the new user into the database
-	err = rt.db.InsertUser(&dbUser)
+	reservation, err := rt.currentReservation(ctx.Context)
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err, http.StatusInternalServerError)
 		return
 	}
 
-	// get the user id from the database
-	user = UserFromDatabaseUser(dbUser)
+	_, reserved := reservation.Reserved(login.Username)
+
+	// a new user must choose a username allowed by the policy and
+	// not reserved, while the users registered before can still log in
+	if !rt.usernames.Valid(login.Username) || reserved {
+		_, err = rt.db.GetDatabaseUserFromDatabaseLogin(ctx.Context, login.LoginIntoDatabaseLogin())
+
+		if errors.Is(err, database.ErrUserDoesNotExist) {
+			if reserved {
+				writeError(w, ErrReservedUsername, http.StatusConflict)
+			} else {
+				writeErrorDetails(w, ErrInvalidUsername, http.StatusBadRequest, rt.usernamePolicyDetails())
+			}
+
+			return
+		}
+
+		if err != nil {
+			writeError(w, err, http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// insert the new user into the database, or
+	// get the user if they were already registered
+	err = rt.db.InsertUser(ctx.Context, &dbUser)
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	// a user without an email address, like a new one, gets the
+	// address of the login, which is sent the verification link
+	if login.Email != "" {
+		err = rt.setSignupEmail(ctx, dbUser, login.Email)
+
+		if err != nil {
+			writeError(w, err, http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// open the session of the user
+	session, err := rt.openSession(ctx.Context, dbUser, time.Now())
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated) // 201
 
-	// return the newly created user
-	_ = json.NewEncoder(w).Encode(user)
+	// return the logged in user with their token
+	_ = json.NewEncoder(w).Encode(session)
+}
+
+// setSignupEmail sets the email address given on signup, sending it the verification link, unless the user already
+// has an address
+func (rt *_router) setSignupEmail(ctx reqcontext.RequestContext, dbUser database.DatabaseUser, email string) error {
+	dbSettings, err := rt.db.GetUserSettings(ctx.Context, dbUser)
+
+	if err != nil || dbSettings.Email != "" {
+		return err
+	}
+
+	dbSettings.Email = email
+
+	err = rt.db.UpdateUserSettings(ctx.Context, dbUser, dbSettings)
+
+	if err != nil {
+		return err
+	}
+
+	rt.sendVerification(ctx.Logger, dbUser, email, time.Now())
+
+	return nil
 }
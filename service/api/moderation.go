@@ -0,0 +1,106 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/api/reqcontext"
+	"github.com/julienschmidt/httprouter"
+)
+
+// classifyPhoto checks an uploaded photo with the classifier, if there is one, and tells whether it has to be flagged
+// as unsafe; if it has to be rejected instead, ErrUnsafePhoto is returned. A photo the classifier could not check is
+// flagged unless the unsafe photos are allowed, so that it is reviewed by the administrators.
+func (rt *_router) classifyPhoto(ctx reqcontext.RequestContext, content []byte, contentType string) (bool, error) {
+	if rt.classifier == nil {
+		return false, nil
+	}
+
+	verdict, err := rt.classifier.Classify(ctx.Context, content, contentType)
+
+	if err != nil {
+		ctx.Logger.WithError(err).Warn("cannot classify the uploaded photo")
+
+		return rt.unsafePhotos != UnsafeAllow, nil
+	}
+
+	if !verdict.Unsafe {
+		return false, nil
+	}
+
+	ctx.Logger.WithField("labels", verdict.Labels).Info("uploaded photo classified as unsafe")
+
+	switch rt.unsafePhotos {
+	case UnsafeReject:
+		return false, ErrUnsafePhoto
+	case UnsafeFlag:
+		return true, nil
+	default:
+		return false, nil
+	}
+}
+
+func (rt *_router) getFlaggedPhotos(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// authenticate the administrator performing the action
+	err := CheckAdminAuthorization(rt.adminToken, r.Header.Get("Authorization"))
+
+	if err != nil {
+		writeError(w, err, http.StatusUnauthorized)
+		return
+	}
+
+	// get the pagination parameters from the query
+	limit, after, code, err := GetPageFromQuery(r)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	// get the page of the photos waiting for a review
+	dbFlaggedPhotoList, err := rt.db.GetFlaggedPhotos(ctx.Context, limit, after)
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK) // 200
+
+	// return the page of the flagged photos
+	_ = json.NewEncoder(w).Encode(FlaggedPhotoListFromDatabaseFlaggedPhotoList(dbFlaggedPhotoList))
+}
+
+func (rt *_router) unflagPhoto(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// authenticate the administrator performing the action
+	err := CheckAdminAuthorization(rt.adminToken, r.Header.Get("Authorization"))
+
+	if err != nil {
+		writeError(w, err, http.StatusUnauthorized)
+		return
+	}
+
+	// get the photo to be cleared from the resource parameter
+	photoId, err := strconv.ParseUint(ps.ByName("photo_id"), 10, 32)
+
+	if err != nil {
+		writeError(w, ErrPageNotFound, http.StatusNotFound)
+		return
+	}
+
+	// show the photo to the other users; an unsafe photo
+	// is deleted through forceDeletePhoto instead
+	err = rt.db.UnflagPhoto(ctx.Context, uint32(photoId))
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	ctx.Logger.WithField("photo", photoId).Info("flagged photo cleared by the administrators")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusNoContent) // 204
+}
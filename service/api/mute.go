@@ -0,0 +1,103 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/api/reqcontext"
+	"github.com/julienschmidt/httprouter"
+)
+
+func (rt *_router) getMutedUsers(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// authenticate the user performing the action,
+	// as only they can see whom they muted
+	user, code, err := rt.AuthenticateUserFromParameter(ctx, "uname", r, ps)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	// get the muted list from the database
+	dbMutedList, err := rt.db.GetMutedList(ctx.Context, user.UserIntoDatabaseUser())
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK) // 200
+
+	// return the muted list
+	_ = json.NewEncoder(w).Encode(UserListFromDatabaseUserList(dbMutedList))
+}
+
+func (rt *_router) muteUser(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// authenticate the user performing the action
+	user, code, err := rt.AuthenticateUserFromParameter(ctx, "uname", r, ps)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	// get the user to be muted from the resource parameter
+	mutedUser, code, err := rt.GetUserFromParameter(ctx, "muted_uname", r, ps)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	// check whether the user performing the mute and the user
+	// to be muted are the same
+	if user.Id == mutedUser.Id {
+		writeError(w, ErrSelfMute, http.StatusBadRequest)
+		return
+	}
+
+	// insert the mute into the database, leaving the
+	// following and the profile of the user untouched
+	err = rt.db.InsertMute(ctx.Context, user.UserIntoDatabaseUser(), mutedUser.UserIntoDatabaseUser())
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK) // 200
+
+	// return the muted user
+	_ = json.NewEncoder(w).Encode(mutedUser)
+}
+
+func (rt *_router) unmuteUser(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// authenticate the user performing the action
+	user, code, err := rt.AuthenticateUserFromParameter(ctx, "uname", r, ps)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	// get the muted user from the resource parameter
+	mutedUser, code, err := rt.GetUserFromParameter(ctx, "muted_uname", r, ps)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	// remove the mute from the database
+	err = rt.db.DeleteMute(ctx.Context, user.UserIntoDatabaseUser(), mutedUser.UserIntoDatabaseUser())
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusNoContent) // 204
+}
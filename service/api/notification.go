@@ -0,0 +1,375 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/api/reqcontext"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/database"
+	"github.com/julienschmidt/httprouter"
+)
+
+func (rt *_router) getNotifications(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// get the user performing the action from the resource parameter
+	user, code, err := rt.AuthenticateUserFromParameter(ctx, "uname", r, ps)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	// get the pagination parameters from the query
+	limit, _, code, err := GetPageFromQuery(r)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	before, code, err := GetCursorFromQuery("before", r)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	// get whether only the unread notifications are requested
+	unread := false
+
+	if unreadString := r.URL.Query().Get("unread"); unreadString != "" {
+		unread, err = strconv.ParseBool(unreadString)
+
+		if err != nil {
+			writeError(w, ErrInvalidUnreadFilter, http.StatusBadRequest)
+			return
+		}
+	}
+
+	// get the page of the notifications of the user from the database
+	dbNotificationList, err := rt.db.GetNotifications(ctx.Context, user.UserIntoDatabaseUser(), unread, limit, before)
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	notificationList := NotificationListFromDatabaseNotificationList(dbNotificationList)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK) // 200
+
+	// return the notification list
+	_ = json.NewEncoder(w).Encode(notificationList)
+}
+
+func (rt *_router) getUnreadNotifications(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// get the user performing the action from the resource parameter
+	user, code, err := rt.AuthenticateUserFromParameter(ctx, "uname", r, ps)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	// get the number of unread notifications from the database
+	unreadCount, err := rt.db.GetUnreadNotificationCount(ctx.Context, user.UserIntoDatabaseUser())
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK) // 200
+
+	// return the number of unread notifications
+	_ = json.NewEncoder(w).Encode(UnreadNotifications{UnreadCount: unreadCount})
+}
+
+func (rt *_router) readNotifications(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// get the user performing the action from the resource parameter
+	user, code, err := rt.AuthenticateUserFromParameter(ctx, "uname", r, ps)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	var readNotifications ReadNotifications
+
+	// get the notifications to be marked from the
+	// request body, which can be left empty
+	code, err = decodeJSON(r, &readNotifications)
+
+	if err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, err, code)
+		return
+	}
+
+	dbUser := user.UserIntoDatabaseUser()
+
+	// mark every notification as read if
+	// the notifications are not given
+	if readNotifications.Notifications == nil {
+		err = rt.db.MarkAllNotificationsRead(ctx.Context, dbUser)
+	} else {
+		err = rt.db.MarkNotificationsRead(ctx.Context, dbUser, readNotifications.Notifications)
+	}
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	// get the notifications which are still unread
+	unreadCount, err := rt.db.GetUnreadNotificationCount(ctx.Context, dbUser)
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK) // 200
+
+	// return the number of unread notifications
+	_ = json.NewEncoder(w).Encode(UnreadNotifications{UnreadCount: unreadCount})
+}
+
+func (rt *_router) getNotificationPreferences(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// get the user performing the action from the resource parameter
+	user, code, err := rt.AuthenticateUserFromParameter(ctx, "uname", r, ps)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	// get the channels of every type of notification
+	dbPreferences, err := rt.db.GetNotificationPreferences(ctx.Context, user.UserIntoDatabaseUser())
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK) // 200
+
+	// return the notification preferences
+	_ = json.NewEncoder(w).Encode(NotificationPreferencesFromDatabaseNotificationPreferences(dbPreferences))
+}
+
+func (rt *_router) setNotificationPreferences(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// get the user performing the action from the resource parameter
+	user, code, err := rt.AuthenticateUserFromParameter(ctx, "uname", r, ps)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	var preferences NotificationPreferences
+
+	// get the new preferences from the request body
+	code, err = decodeJSON(r, &preferences)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	for notificationType := range preferences {
+		if !validNotificationType(notificationType) {
+			writeError(w, ErrInvalidNotificationType, http.StatusBadRequest)
+			return
+		}
+	}
+
+	dbUser := user.UserIntoDatabaseUser()
+
+	// replace the preferences of the user, the missing
+	// types being received on every channel
+	err = rt.db.UpdateNotificationPreferences(ctx.Context, dbUser, preferences.NotificationPreferencesIntoDatabaseNotificationPreferences())
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	dbPreferences, err := rt.db.GetNotificationPreferences(ctx.Context, dbUser)
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK) // 200
+
+	// return the new notification preferences
+	_ = json.NewEncoder(w).Encode(NotificationPreferencesFromDatabaseNotificationPreferences(dbPreferences))
+}
+
+// validNotificationType reports whether the type is one of the types of the notifications
+func validNotificationType(notificationType string) bool {
+	for _, t := range database.NotificationTypes {
+		if t == notificationType {
+			return true
+		}
+	}
+
+	return false
+}
+
+// eventHeartbeat is how often a comment is sent on an idle event stream,
+// so that the proxies in between do not close the connection
+const eventHeartbeat = 15 * time.Second
+
+func (rt *_router) streamNotifications(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// the browsers cannot set the headers of an event stream,
+	// hence the bearer token can be given in the query instead
+	if ctx.UserId == 0 && r.URL.Query().Get("access_token") != "" {
+		dbSession, err := rt.authenticate(ctx.Context, r.URL.Query().Get("access_token"), time.Now())
+
+		if errors.Is(err, ErrInvalidToken) {
+			writeError(w, err, http.StatusUnauthorized)
+			return
+		}
+
+		if err != nil {
+			writeError(w, err, http.StatusInternalServerError)
+			return
+		}
+
+		ctx.UserId = dbSession.User.Id
+		ctx.SessionId = dbSession.Id
+	}
+
+	// get the user performing the action from the resource parameter
+	user, code, err := rt.AuthenticateUserFromParameter(ctx, "uname", r, ps)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	dbUser := user.UserIntoDatabaseUser()
+
+	// get the last notification received by the client when it
+	// reconnects, from the header sent by the browsers or from
+	// the query on the first connection
+	lastEventId := r.Header.Get("Last-Event-ID")
+
+	if lastEventId == "" {
+		lastEventId = r.URL.Query().Get("last_event_id")
+	}
+
+	var last uint32
+
+	if lastEventId != "" {
+		parsedLast, err := strconv.ParseUint(lastEventId, 10, 32)
+
+		if err != nil {
+			writeError(w, ErrInvalidCursor, http.StatusBadRequest)
+			return
+		}
+
+		last = uint32(parsedLast)
+	} else {
+		// a new client only receives the notifications
+		// created after it connected
+		dbNotificationList, err := rt.db.GetNotifications(ctx.Context, dbUser, false, 1, 0)
+
+		if err != nil {
+			writeError(w, err, http.StatusInternalServerError)
+			return
+		}
+
+		if len(dbNotificationList.Notifications) > 0 {
+			last = dbNotificationList.Notifications[0].Id
+		}
+	}
+
+	// the stream outlives the write timeout of the server
+	rc := http.NewResponseController(w)
+	_ = rc.SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK) // 200
+
+	err = rc.Flush()
+
+	if err != nil {
+		ctx.Logger.WithError(err).Error("cannot stream the notifications")
+		return
+	}
+
+	poll := time.NewTicker(rt.notificationPoll)
+	defer poll.Stop()
+
+	heartbeat := time.NewTicker(eventHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		// send the notifications newer than the last one sent,
+		// as long as there are more of them
+		for {
+			dbNotificationList, err := rt.db.GetNotificationsAfter(ctx.Context, dbUser, last, maxPageLimit)
+
+			if err != nil {
+				ctx.Logger.WithError(err).Error("cannot get the new notifications")
+				return
+			}
+
+			for _, dbNotification := range dbNotificationList.Notifications {
+				data, err := json.Marshal(NotificationFromDatabaseNotification(dbNotification))
+
+				if err != nil {
+					ctx.Logger.WithError(err).Error("cannot encode the notification")
+					return
+				}
+
+				_, err = fmt.Fprintf(w, "id: %d\nevent: notification\ndata: %s\n\n", dbNotification.Id, data)
+
+				if err != nil {
+					return
+				}
+
+				last = dbNotification.Id
+			}
+
+			if len(dbNotificationList.Notifications) > 0 {
+				heartbeat.Reset(eventHeartbeat)
+
+				if rc.Flush() != nil {
+					return
+				}
+			}
+
+			if dbNotificationList.NextCursor == 0 {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Context.Done():
+			return
+		case <-rt.closing:
+			return
+		case <-heartbeat.C:
+			_, err = fmt.Fprint(w, ": heartbeat\n\n")
+
+			if err != nil || rc.Flush() != nil {
+				return
+			}
+		case <-poll.C:
+		}
+	}
+}
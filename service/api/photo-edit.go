@@ -0,0 +1,187 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/api/reqcontext"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/database"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/imaging"
+	"github.com/julienschmidt/httprouter"
+)
+
+func (rt *_router) editPhoto(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// authenticate the user performing the action
+	user, code, err := rt.AuthenticateUserFromParameter(ctx, "uname", r, ps)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	// get the photo to be edited from the resource parameter
+	photo, code, err := rt.GetPhotoFromParameter(ctx, "photo_id", user, r, ps)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	// check if the resource is consistent
+	if photo.User.Id != user.Id {
+		writeError(w, ErrPageNotFound, http.StatusNotFound)
+		return
+	}
+
+	edit := PhotoEditDefault()
+
+	// get the crop and the rotation from the request body
+	code, err = decodeJSON(r, &edit)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	// the edits always start from the original image, so
+	// that they do not pile up and it can be restored
+	originalUrl := photo.OriginalUrl
+
+	if originalUrl == "" {
+		originalUrl = photo.Url
+	}
+
+	// the videos, and the older photos whose file is not in
+	// the storage, have no image to be edited
+	name, ok := rt.photoFileName(originalUrl)
+
+	if photo.MediaType != database.MediaImage || !ok {
+		writeError(w, ErrUneditablePhoto, http.StatusConflict)
+		return
+	}
+
+	// an edit without a crop and a rotation restores the original
+	url := originalUrl
+	editedOriginalUrl := ""
+	editedName := ""
+
+	// the derived image is held until the edit is saved, so
+	// that no other request removes it as unused in between
+	unlock := func() {}
+
+	if edit.Crop != nil || edit.Rotation != 0 {
+		content, contentType, err := rt.readPhotoFile(ctx, name)
+
+		if err != nil {
+			writeError(w, err, http.StatusInternalServerError)
+			return
+		}
+
+		var crop *imaging.Rectangle
+
+		if edit.Crop != nil {
+			crop = &imaging.Rectangle{X: edit.Crop.X, Y: edit.Crop.Y, Width: edit.Crop.Width, Height: edit.Crop.Height}
+		}
+
+		edited, err := imaging.Edit(content, contentType, crop, edit.Rotation)
+
+		switch {
+		case errors.Is(err, imaging.ErrUnsupportedFormat):
+			writeError(w, ErrUneditablePhoto, http.StatusConflict)
+			return
+		case errors.Is(err, imaging.ErrInvalidEdit):
+			writeError(w, ErrInvalidPhotoEdit, http.StatusBadRequest)
+			return
+		case err != nil:
+			writeError(w, err, http.StatusInternalServerError)
+			return
+		}
+
+		// the derived image is named after its content like the uploaded ones
+		editedName = photoContentName(edited, contentType)
+
+		unlock = rt.fileLocks.lock(editedName)
+
+		err = rt.photos.Put(ctx.Context, editedName, bytes.NewReader(edited), contentType)
+
+		if err != nil {
+			unlock()
+			writeError(w, err, http.StatusInternalServerError)
+			return
+		}
+
+		url = rt.photos.URL(editedName)
+		editedOriginalUrl = originalUrl
+	}
+
+	// serve the photo from the derived image, keeping the original
+	replaced, err := rt.db.EditPhoto(ctx.Context, photo.PhotoIntoDatabasePhoto(), url, editedOriginalUrl)
+
+	if err != nil {
+		// the derived image of an edit which was not saved is never
+		// served, unless another photo holds the same image
+		if editedName != "" {
+			_ = rt.removePhotoFile(ctx.Context, editedName)
+		}
+
+		unlock()
+
+		if errors.Is(err, database.ErrPhotoDoesNotExist) {
+			writeError(w, err, http.StatusNotFound)
+			return
+		}
+
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	unlock()
+
+	// remove the image derived by the previous edit, unless
+	// it is the original or another photo holds the same image
+	if replacedName, ok := rt.photoFileName(replaced); ok && replaced != url && replaced != originalUrl {
+		err = rt.deletePhotoFile(ctx.Context, replacedName)
+
+		if err != nil {
+			ctx.Logger.WithError(err).WithField("file", replacedName).Warn("cannot remove the file of the edited photo")
+		}
+	}
+
+	photo.Url = url
+	photo.OriginalUrl = editedOriginalUrl
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK) // 200
+
+	// return the edited photo
+	_ = json.NewEncoder(w).Encode(photo)
+}
+
+// readPhotoFile reads the file `name` of a photo from the storage, returning its content and its type, detected from
+// its first bytes
+func (rt *_router) readPhotoFile(ctx reqcontext.RequestContext, name string) ([]byte, string, error) {
+	blob, err := rt.photos.Get(ctx.Context, name)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	defer blob.Close()
+
+	content, err := io.ReadAll(blob)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	info, err := imaging.Inspect(content)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	return content, info.ContentType, nil
+}
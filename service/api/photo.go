@@ -1,49 +1,273 @@
 package api
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"path"
+	"strconv"
+	"strings"
 	"time"
 
 	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/api/reqcontext"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/database"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/imaging"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/storage"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/video"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/webhook"
 	"github.com/julienschmidt/httprouter"
 )
 
+// PhotoUrlPrefix is the path under which the uploaded photos are served, followed by the name of their file
+const PhotoUrlPrefix = "/photos/"
+
+// photoExtensions maps the accepted formats of the photos and of the videos to the extension of their files
+var photoExtensions = map[string]string{
+	imaging.JPEG: ".jpg",
+	imaging.PNG:  ".png",
+	imaging.WebP: ".webp",
+	video.MP4:    ".mp4",
+	video.WebM:   ".webm",
+}
+
+// multipartOverhead is the room left in the request for the multipart form
+// around the photo or the video (the boundaries and the headers of the parts)
+const multipartOverhead = 64 << 10
+
 func (rt *_router) uploadPhoto(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
 	// authenticate the user performing the action
-	user, code, err := rt.AuthenticateUserFromParameter("uname", r, ps)
+	user, code, err := rt.AuthenticateUserFromParameter(ctx, "uname", r, ps)
 
 	if err != nil {
-		http.Error(w, err.Error(), code)
+		writeError(w, err, code)
 		return
 	}
 
-	photo := PhotoDefault()
+	// the user may have to verify their email address first
+	code, err = rt.checkVerifiedEmail(ctx, user)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	// the form holds either a photo or a short video
+	isVideo, code, err := rt.isVideoUpload(r)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	var content []byte
+	var contentType string
+	var info video.Info
+
+	// read the photo or the video from the multipart form
+	if isVideo {
+		content, info, code, err = rt.readUploadedVideo(r)
+		contentType = info.ContentType
+	} else {
+		content, contentType, code, err = rt.readUploadedPhoto(r)
+	}
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	// get where the photo was taken from the other fields of the form
+	latitude, longitude, place, err := locationFromForm(r)
+
+	if err != nil {
+		writeError(w, err, http.StatusBadRequest)
+		return
+	}
 
-	// take the photo coded in base64 from the request body
-	err = json.NewDecoder(r.Body).Decode(&photo)
+	now := time.Now().UTC().Truncate(time.Second)
+
+	// get when the photo is published, if it is scheduled
+	publishAt, scheduled, err := publishAtFromForm(r, now)
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err, http.StatusBadRequest)
 		return
 	}
 
+	altText := r.FormValue("alt_text")
+
+	if !validProfileText(altText, maxAltTextLength, "\n") {
+		writeError(w, ErrInvalidAltText, http.StatusBadRequest)
+		return
+	}
+
+	// the location is dropped if the user strips it by
+	// default, unless they chose to keep it for this photo
+	if latitude != nil || place != "" {
+		dbSettings, err := rt.db.GetUserSettings(ctx.Context, user.UserIntoDatabaseUser())
+
+		if err != nil {
+			writeError(w, err, http.StatusInternalServerError)
+			return
+		}
+
+		if dbSettings.StripLocation && r.FormValue("keep_location") != "true" {
+			latitude, longitude, place = nil, nil, ""
+		}
+	}
+
+	photo := PhotoDefault()
+
 	photo.User = user
+	photo.Latitude = latitude
+	photo.Longitude = longitude
+	photo.Place = place
+	photo.AltText = altText
+
+	// the photo is only shown to the close friends
+	// of the user if they chose so in the form
+	photo.CloseFriends = r.FormValue("close_friends") == "true"
+
+	// compute the perceptual hash of the photo, which cannot be
+	// computed for the videos and the formats the server does
+	// not decode
+	var hash uint64
+
+	if !isVideo {
+		hash, err = imaging.DifferenceHash(content, contentType)
+	}
+
+	if err != nil && !errors.Is(err, imaging.ErrUnsupportedFormat) {
+		writeError(w, ErrInvalidPhoto, http.StatusBadRequest)
+		return
+	}
+
+	hashed := !isVideo && err == nil
+
+	// look for a photo of the user looking like the new one
+	if hashed && rt.duplicatePhotos != DuplicatesAllow {
+		dbDuplicate, err := rt.db.GetSimilarPhoto(ctx.Context, user.UserIntoDatabaseUser(), hash, rt.duplicateDistance)
+
+		switch {
+		case errors.Is(err, database.ErrPhotoDoesNotExist):
+		case err != nil:
+			writeError(w, err, http.StatusInternalServerError)
+			return
+		case rt.duplicatePhotos == DuplicatesReject:
+			writeErrorDetails(w, ErrDuplicatePhoto, http.StatusConflict, map[string]uint32{"duplicate_of": dbDuplicate.Id})
+			return
+		default:
+			photo.DuplicateOf = dbDuplicate.Id
+		}
+	}
+
+	var poster []byte
+
+	// check the photo, or the poster of the video, with the classifier
+	// before anyone can see it, hiding it until it is reviewed if it is
+	// unsafe; a video without a poster cannot be checked, as when the
+	// classifier fails
+	if isVideo {
+		photo.MediaType = database.MediaVideo
+		photo.Duration = info.Duration.Seconds()
+
+		poster = rt.videoPoster(ctx, content, info)
+	}
 
-	photo.Date = time.Now().Format("2006-01-02 15:04:05")
+	switch {
+	case !isVideo:
+		photo.Flagged, err = rt.classifyPhoto(ctx, content, contentType)
+	case poster != nil:
+		photo.Flagged, err = rt.classifyPhoto(ctx, poster, imaging.JPEG)
+	default:
+		photo.Flagged = rt.classifier != nil && rt.unsafePhotos != UnsafeAllow
+	}
+
+	if err != nil {
+		writeError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	// the hash of the content names the file, so that
+	// the same image is stored once and never changes
+	name := photoContentName(content, contentType)
+	posterName := ""
+
+	if poster != nil {
+		posterName = photoContentName(poster, imaging.JPEG)
+	}
+
+	// hold the files until the photo is inserted, so that no other
+	// request removes them as unused in between
+	unlock := rt.fileLocks.lock(name, posterName)
+	defer unlock()
+
+	if poster != nil {
+		err = rt.photos.Put(ctx.Context, posterName, bytes.NewReader(poster), imaging.JPEG)
+
+		if err != nil {
+			writeError(w, err, http.StatusInternalServerError)
+			return
+		}
+
+		photo.PosterUrl = rt.photos.URL(posterName)
+	}
+
+	// save the photo in the storage
+	err = rt.photos.Put(ctx.Context, name, bytes.NewReader(content), contentType)
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	photo.Url = rt.photos.URL(name)
+
+	// a scheduled photo takes the date it is published at,
+	// hidden to the others until the scheduler publishes it
+	photo.Date = now
+
+	if scheduled {
+		photo.Date = publishAt
+		photo.Scheduled = true
+	}
 
 	dbPhoto := photo.PhotoIntoDatabasePhoto()
 
+	if hashed {
+		dbPhoto.Hash = &hash
+	}
+
 	// insert the photo into the database
-	err = rt.db.InsertPhoto(&dbPhoto)
+	err = rt.db.InsertPhoto(ctx.Context, &dbPhoto)
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		// the file of a photo which was not saved is never
+		// served, unless another photo holds the same image
+		_ = rt.removePhotoFile(ctx.Context, name)
+
+		if posterName != "" {
+			_ = rt.removePhotoFile(ctx.Context, posterName)
+		}
+
+		writeError(w, err, http.StatusInternalServerError)
 		return
 	}
 
 	photo.Id = dbPhoto.Id
 
+	// announce the photo to the webhooks, unless it is hidden until it is reviewed,
+	// or until it is published, when the scheduler announces it
+	if !photo.Flagged && !photo.Scheduled {
+		rt.emitEvent(ctx, webhook.EventPhotoCreated, user.Id, photo)
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated) // 201
 
@@ -51,40 +275,670 @@ func (rt *_router) uploadPhoto(w http.ResponseWriter, r *http.Request, ps httpro
 	_ = json.NewEncoder(w).Encode(photo)
 }
 
+// readUploadedPhoto reads the image in the "photo" field of the multipart form of the request, checking its size, its
+// format and its dimensions, and removes the metadata of the JPEG images. It returns the content of the image and its
+// type, or the status code and the error to be returned.
+// The body of the request is limited by its route to the maximum size of a photo and the multipart form around it.
+func (rt *_router) readUploadedPhoto(r *http.Request) ([]byte, string, int, error) {
+	// take the photo from the "photo" field of the multipart form
+	file, header, err := r.FormFile("photo")
+
+	if err != nil {
+		switch code, err := requestBodyError(err); code {
+		case http.StatusRequestEntityTooLarge:
+			return nil, "", code, fmt.Errorf("%w (%d bytes)", ErrPhotoTooLarge, rt.maxPhotoSize)
+		case http.StatusRequestTimeout:
+			return nil, "", code, err
+		}
+
+		return nil, "", http.StatusBadRequest, ErrInvalidPhoto
+	}
+
+	defer file.Close()
+
+	if header.Size > rt.maxPhotoSize {
+		return nil, "", http.StatusRequestEntityTooLarge, fmt.Errorf("%w (%d bytes)", ErrPhotoTooLarge, rt.maxPhotoSize)
+	}
+
+	// read the whole photo, as it is processed before being saved
+	content, err := io.ReadAll(file)
+
+	if err != nil {
+		return nil, "", http.StatusBadRequest, ErrInvalidPhoto
+	}
+
+	return rt.checkPhoto(content)
+}
+
+// checkPhoto checks the format and the dimensions of the image `content`, read whole, and removes the metadata of the
+// JPEG images. It returns the content of the image and its type, or the status code and the error to be returned.
+func (rt *_router) checkPhoto(content []byte) ([]byte, string, int, error) {
+	// detect the format of the photo from its first bytes,
+	// regardless of the type declared by the client
+	info, err := imaging.Inspect(content)
+
+	if errors.Is(err, imaging.ErrUnsupportedFormat) {
+		return nil, "", http.StatusUnsupportedMediaType, ErrUnsupportedPhoto
+	}
+
+	if err != nil {
+		return nil, "", http.StatusBadRequest, ErrInvalidPhoto
+	}
+
+	if info.Width > rt.maxPhotoDimension || info.Height > rt.maxPhotoDimension {
+		return nil, "", http.StatusRequestEntityTooLarge, fmt.Errorf("%w (%d pixels)", ErrPhotoTooBig, rt.maxPhotoDimension)
+	}
+
+	// remove the metadata of the JPEG photos (eg. where they were
+	// taken) and turn them upright according to their orientation
+	if info.ContentType == imaging.JPEG {
+		content, err = imaging.CleanJPEG(content)
+
+		if err != nil {
+			return nil, "", http.StatusBadRequest, ErrInvalidPhoto
+		}
+	}
+
+	return content, info.ContentType, -1, nil
+}
+
+// locationFromForm returns where the photo was taken according to the fields of the upload form: the latitude and the
+// longitude are either both given or both missing, and the name of the place is optional
+func locationFromForm(r *http.Request) (*float64, *float64, string, error) {
+	var latitude, longitude *float64
+
+	if r.FormValue("latitude") != "" || r.FormValue("longitude") != "" {
+		lat, err := strconv.ParseFloat(r.FormValue("latitude"), 64)
+
+		// the negated comparisons also reject NaN
+		if err != nil || !(lat >= -90 && lat <= 90) {
+			return nil, nil, "", ErrInvalidLocation
+		}
+
+		lon, err := strconv.ParseFloat(r.FormValue("longitude"), 64)
+
+		if err != nil || !(lon >= -180 && lon <= 180) {
+			return nil, nil, "", ErrInvalidLocation
+		}
+
+		latitude, longitude = &lat, &lon
+	}
+
+	place := ""
+
+	if strings.TrimSpace(r.FormValue("place")) != "" {
+		var ok bool
+
+		place, ok = database.NormalizePlace(r.FormValue("place"))
+
+		if !ok {
+			return nil, nil, "", ErrInvalidPlace
+		}
+	}
+
+	return latitude, longitude, place, nil
+}
+
+// maxAltTextLength is the maximum number of characters of the alt text of a photo
+const maxAltTextLength = 1000
+
+// publishAtFromForm returns when the photo is published from the "publish_at" field of the multipart form, as an
+// RFC 3339 timestamp after `now`, and whether it is given; a photo without it is published right away
+func publishAtFromForm(r *http.Request, now time.Time) (time.Time, bool, error) {
+	if r.FormValue("publish_at") == "" {
+		return time.Time{}, false, nil
+	}
+
+	publishAt, err := time.Parse(time.RFC3339, r.FormValue("publish_at"))
+
+	if err != nil {
+		return time.Time{}, false, ErrInvalidPublishAt
+	}
+
+	// the dates are stored in seconds
+	publishAt = publishAt.UTC().Truncate(time.Second)
+
+	if !publishAt.After(now) {
+		return time.Time{}, false, ErrInvalidPublishAt
+	}
+
+	return publishAt, true, nil
+}
+
+func (rt *_router) getPhoto(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// get the user authenticated by the bearer token
+	userId, err := GetAuthenticatedUserId(ctx)
+
+	if err != nil {
+		writeError(w, err, http.StatusUnauthorized)
+		return
+	}
+
+	// get the user performing the action
+	dbUser, err := rt.db.GetDatabaseUser(ctx.Context, userId)
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	// get the user of the photo from the resource parameter
+	photoUser, code, err := rt.GetUserFromParameter(ctx, "uname", r, ps)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	// check whether the user of the photo
+	// has banned the user performing the action
+	checkBan, err := rt.db.CheckBan(ctx.Context, photoUser.UserIntoDatabaseUser(), dbUser)
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	if checkBan {
+		writeError(w, ErrBannedUser, http.StatusUnauthorized)
+		return
+	}
+
+	// get the photo from the resource parameter, with
+	// its stats as seen by the user performing the action
+	photo, code, err := rt.GetPhotoFromParameter(ctx, "photo_id", UserFromDatabaseUser(dbUser), r, ps)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	// check if the resource is consistent
+	if photo.User.Id != photoUser.Id {
+		writeError(w, ErrPageNotFound, http.StatusNotFound)
+		return
+	}
+
+	// get the size of the first page of comments from the query
+	limit, _, code, err := GetPageFromQuery(r)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	// get the order of the comments from the query
+	sort, code, err := GetCommentSortFromQuery(r)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	// get the first page of the comment list from the database
+	dbCommentList, err := rt.db.GetCommentList(ctx.Context, photo.PhotoIntoDatabasePhoto(), dbUser, sort, limit, 0)
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	photoDetail := PhotoDetailDefault()
+	photoDetail.Photo = photo
+	photoDetail.Comments = CommentListFromDatabaseCommentList(dbCommentList).Comments
+
+	// a full page may be followed by more comments
+	if len(photoDetail.Comments) == limit {
+		photoDetail.NextCursor = photoDetail.Comments[limit-1].Id
+	}
+
+	// return the photo, unless the client holds it already
+	writeJSONETag(w, r, photoDetail)
+}
+
 func (rt *_router) deletePhoto(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
 	// authenticate the user performing the action
-	user, code, err := rt.AuthenticateUserFromParameter("uname", r, ps)
+	user, code, err := rt.AuthenticateUserFromParameter(ctx, "uname", r, ps)
 
 	if err != nil {
-		http.Error(w, err.Error(), code)
+		writeError(w, err, code)
 		return
 	}
 
 	// get the photo to be deleted from the resource parameter
-	photo, code, err := rt.GetPhotoFromParameter("photo_id", user, r, ps)
+	photo, code, err := rt.GetPhotoFromParameter(ctx, "photo_id", user, r, ps)
 
 	if err != nil {
-		http.Error(w, err.Error(), code)
+		writeError(w, err, code)
 		return
 	}
 
 	// check if the resource is consistent
 	if photo.User.Id != user.Id {
-		http.Error(w, ErrPageNotFound.Error(), http.StatusNotFound)
+		writeError(w, ErrPageNotFound, http.StatusNotFound)
 		return
 	}
 
 	// remove the photo from the database
-	err = rt.db.DeletePhoto(photo.PhotoIntoDatabasePhoto())
+	err = rt.db.DeletePhoto(ctx.Context, photo.PhotoIntoDatabasePhoto())
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err, http.StatusInternalServerError)
 		return
 	}
 
+	// remove the file of the photo, the poster of a video and the original
+	// of an edited photo, if they were uploaded to the storage; the photo
+	// is already gone, so a failure is only logged
+	rt.deletePhotoFiles(ctx, photo.PhotoIntoDatabasePhoto())
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK) // 200
 
 	// return the removed photo
 	_ = json.NewEncoder(w).Encode(photo)
 }
+
+func (rt *_router) archivePhoto(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// authenticate the user performing the action
+	user, code, err := rt.AuthenticateUserFromParameter(ctx, "uname", r, ps)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	// get the photo to be archived from the resource parameter
+	photo, code, err := rt.GetPhotoFromParameter(ctx, "photo_id", user, r, ps)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	// check if the resource is consistent
+	if photo.User.Id != user.Id {
+		writeError(w, ErrPageNotFound, http.StatusNotFound)
+		return
+	}
+
+	// archive the photo
+	err = rt.db.ArchivePhoto(ctx.Context, photo.PhotoIntoDatabasePhoto())
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	photo.Archived = true
+	photo.Pinned = false
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK) // 200
+
+	// return the archived photo
+	_ = json.NewEncoder(w).Encode(photo)
+}
+
+func (rt *_router) unarchivePhoto(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// authenticate the user performing the action
+	user, code, err := rt.AuthenticateUserFromParameter(ctx, "uname", r, ps)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	// get the photo to be unarchived from the resource parameter
+	photo, code, err := rt.GetPhotoFromParameter(ctx, "photo_id", user, r, ps)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	// check if the resource is consistent
+	if photo.User.Id != user.Id {
+		writeError(w, ErrPageNotFound, http.StatusNotFound)
+		return
+	}
+
+	// unarchive the photo
+	err = rt.db.UnarchivePhoto(ctx.Context, photo.PhotoIntoDatabasePhoto())
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	photo.Archived = false
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK) // 200
+
+	// return the restored photo
+	_ = json.NewEncoder(w).Encode(photo)
+}
+
+func (rt *_router) setPhotoAltText(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// authenticate the user performing the action
+	user, code, err := rt.AuthenticateUserFromParameter(ctx, "uname", r, ps)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	// get the photo to be described from the resource parameter
+	photo, code, err := rt.GetPhotoFromParameter(ctx, "photo_id", user, r, ps)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	// check if the resource is consistent
+	if photo.User.Id != user.Id {
+		writeError(w, ErrPageNotFound, http.StatusNotFound)
+		return
+	}
+
+	altText := PhotoAltTextDefault()
+
+	// get the new alt text from the request body
+	code, err = decodeJSON(r, &altText)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	// an empty alt text removes it from the photo
+	if !validProfileText(altText.AltText, maxAltTextLength, "\n") {
+		writeError(w, ErrInvalidAltText, http.StatusBadRequest)
+		return
+	}
+
+	err = rt.db.SetPhotoAltText(ctx.Context, photo.PhotoIntoDatabasePhoto(), altText.AltText)
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	photo.AltText = altText.AltText
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK) // 200
+
+	// return the described photo
+	_ = json.NewEncoder(w).Encode(photo)
+}
+
+func (rt *_router) pinPhoto(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// authenticate the user performing the action
+	user, code, err := rt.AuthenticateUserFromParameter(ctx, "uname", r, ps)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	// get the photo to be pinned from the resource parameter
+	photo, code, err := rt.GetPhotoFromParameter(ctx, "photo_id", user, r, ps)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	// check if the resource is consistent
+	if photo.User.Id != user.Id {
+		writeError(w, ErrPageNotFound, http.StatusNotFound)
+		return
+	}
+
+	// the archived photos are not on the profile
+	if photo.Archived {
+		writeError(w, ErrPinArchivedPhoto, http.StatusConflict)
+		return
+	}
+
+	// pin the photo to the top of the profile
+	err = rt.db.PinPhoto(ctx.Context, photo.PhotoIntoDatabasePhoto(), rt.maxPinnedPhotos, time.Now())
+
+	if errors.Is(err, database.ErrTooManyPinnedPhotos) {
+		writeErrorDetails(w, ErrTooManyPinnedPhotos, http.StatusConflict, map[string]int{"max_pinned": rt.maxPinnedPhotos})
+		return
+	}
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	photo.Pinned = true
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK) // 200
+
+	// return the pinned photo
+	_ = json.NewEncoder(w).Encode(photo)
+}
+
+func (rt *_router) unpinPhoto(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// authenticate the user performing the action
+	user, code, err := rt.AuthenticateUserFromParameter(ctx, "uname", r, ps)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	// get the photo to be unpinned from the resource parameter
+	photo, code, err := rt.GetPhotoFromParameter(ctx, "photo_id", user, r, ps)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	// check if the resource is consistent
+	if photo.User.Id != user.Id {
+		writeError(w, ErrPageNotFound, http.StatusNotFound)
+		return
+	}
+
+	// put the photo back in its place on the profile
+	err = rt.db.UnpinPhoto(ctx.Context, photo.PhotoIntoDatabasePhoto())
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	photo.Pinned = false
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK) // 200
+
+	// return the unpinned photo
+	_ = json.NewEncoder(w).Encode(photo)
+}
+
+func (rt *_router) getPhotoFile(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// open the file of the photo from the resource parameter; the files
+	// are served without authentication, as the browsers request them
+	// from the img elements, and their names cannot be guessed
+	blob, err := rt.photos.Get(ctx.Context, ps.ByName("name"))
+
+	if errors.Is(err, storage.ErrNotFound) || errors.Is(err, storage.ErrInvalidName) {
+		writeError(w, ErrPageNotFound, http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	defer blob.Close()
+
+	w.Header().Set("Content-Type", blob.ContentType)
+
+	// tag the file with the hash of its content, so that
+	// the clients holding it already are answered with 304
+	if blob.ETag != "" {
+		w.Header().Set("ETag", blob.ETag)
+	}
+
+	// the files named after their content never change, hence they are
+	// cached for good, while the older ones may still be replaced
+	if isPhotoContentName(ps.ByName("name")) {
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	} else {
+		w.Header().Set("Cache-Control", "public, max-age=86400")
+	}
+
+	// serve the file in ranges if the storage allows it
+	if content, ok := blob.ReadCloser.(io.ReadSeeker); ok {
+		http.ServeContent(w, r, ps.ByName("name"), blob.ModTime, content)
+		return
+	}
+
+	if blob.ETag != "" && etagMatches(r, blob.ETag) {
+		w.WriteHeader(http.StatusNotModified) // 304
+		return
+	}
+
+	if blob.Size >= 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(blob.Size, 10))
+	}
+
+	if !blob.ModTime.IsZero() {
+		w.Header().Set("Last-Modified", blob.ModTime.UTC().Format(http.TimeFormat))
+	}
+
+	w.WriteHeader(http.StatusOK) // 200
+
+	_, _ = io.Copy(w, blob)
+}
+
+// deletePhotoFiles removes the files of the photo from the storage, the poster of a video and the original image of
+// an edited photo included, logging the failures since the photo is already gone
+func (rt *_router) deletePhotoFiles(ctx reqcontext.RequestContext, dbPhoto database.DatabasePhoto) {
+	for _, url := range []string{dbPhoto.Url, dbPhoto.PosterUrl, dbPhoto.OriginalUrl} {
+		if name, ok := rt.photoFileName(url); ok && url != "" {
+			err := rt.deletePhotoFile(ctx.Context, name)
+
+			if err != nil {
+				ctx.Logger.WithError(err).WithField("file", name).Warn("cannot remove the file of the photo")
+			}
+		}
+	}
+}
+
+// photoFileName returns the name in the storage of the file served at the url of a photo
+// (or a story), or false if the file was not uploaded to it (eg. the older photos, whose
+// url holds the whole image)
+func (rt *_router) photoFileName(url string) (string, bool) {
+	name := path.Base(url)
+
+	return name, rt.photos.URL(name) == url
+}
+
+// photoContentName returns the name in the storage of the file of an image, made of the hash of its content: the
+// file under a name never changes, hence the clients may cache it for good, and the same image uploaded again is
+// stored once
+func photoContentName(content []byte, contentType string) string {
+	hash := sha256.Sum256(content)
+
+	return hex.EncodeToString(hash[:16]) + photoExtensions[contentType]
+}
+
+// isPhotoContentName tells whether the file was named after the hash of its content, unlike the older files named
+// after the request uploading them
+func isPhotoContentName(name string) bool {
+	stem := strings.TrimSuffix(name, path.Ext(name))
+
+	if len(stem) != 32 {
+		return false
+	}
+
+	_, err := hex.DecodeString(stem)
+
+	return err == nil
+}
+
+// deletePhotoFile removes the file from the storage, unless a photo or a story still has it, as the files of the
+// same image are shared
+func (rt *_router) deletePhotoFile(ctx context.Context, name string) error {
+	unlock := rt.fileLocks.lock(name)
+	defer unlock()
+
+	return rt.removePhotoFile(ctx, name)
+}
+
+// removePhotoFile is deletePhotoFile for the callers already holding the lock of the file
+func (rt *_router) removePhotoFile(ctx context.Context, name string) error {
+	used, err := rt.db.IsUrlUsed(ctx, rt.photos.URL(name))
+
+	if err != nil || used {
+		return err
+	}
+
+	return rt.photos.Delete(ctx, name)
+}
+
+// publishPhotos publishes the scheduled photos whose date has come every `interval`, until the router is closed
+func (rt *_router) publishPhotos(interval time.Duration) {
+	defer close(rt.publishDone)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-rt.closing:
+			return
+		case <-ticker.C:
+			rt.publishDuePhotos()
+		}
+	}
+}
+
+// publishDuePhotos shows the scheduled photos whose date has come to the others, and then announces them to the
+// webhooks as if they were uploaded, unless they are hidden until they are reviewed
+func (rt *_router) publishDuePhotos() {
+	ctx := context.Background()
+
+	dbPhotos, err := rt.db.PublishScheduledPhotos(ctx, time.Now())
+
+	if err != nil {
+		rt.baseLogger.WithError(err).Error("cannot publish the scheduled photos")
+		return
+	}
+
+	// the events are recorded outside of any request
+	eventCtx := reqcontext.RequestContext{Context: ctx, Logger: rt.baseLogger}
+
+	for _, dbPhoto := range dbPhotos {
+		if dbPhoto.Flagged {
+			continue
+		}
+
+		// the photo is announced as its owner sees it
+		dbPublished, err := rt.db.GetDatabasePhoto(ctx, dbPhoto.Id, dbPhoto.User)
+
+		if err != nil {
+			rt.baseLogger.WithError(err).WithField("photo", dbPhoto.Id).Warn("cannot announce the published photo")
+			continue
+		}
+
+		rt.emitEvent(eventCtx, webhook.EventPhotoCreated, dbPublished.User.Id, PhotoFromDatabasePhoto(dbPublished))
+	}
+
+	if len(dbPhotos) > 0 {
+		rt.baseLogger.WithField("photos", len(dbPhotos)).Debug("scheduled photos published")
+	}
+}
@@ -0,0 +1,324 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/api/reqcontext"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/auth"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/database"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/usernames"
+	"github.com/julienschmidt/httprouter"
+)
+
+// stateLifetime is how long a user has to sign in through a provider before the state expires
+const stateLifetime = 10 * time.Minute
+
+// identityUsernameAttempts is how many usernames are tried for a new user signing in through a provider, before
+// giving up
+const identityUsernameAttempts = 10
+
+// providerState is the content of a state: the provider it was issued for, when it expires as seconds since the epoch,
+// and a random nonce, so that no two sign-ins share it
+type providerState struct {
+	Provider  string `json:"provider"`
+	ExpiresAt int64  `json:"exp"`
+	Nonce     string `json:"nonce"`
+}
+
+// issueState returns a state for signing in through `provider` from `now`, signed by the backend so that it does not
+// need to be stored: the client keeps it until the provider sends it back
+func (rt *_router) issueState(provider string, now time.Time) (string, error) {
+	nonce := make([]byte, 16)
+
+	_, err := rand.Read(nonce)
+
+	if err != nil {
+		return "", err
+	}
+
+	return rt.signClaims("state", providerState{
+		Provider:  provider,
+		ExpiresAt: now.Add(stateLifetime).Unix(),
+		Nonce:     base64.RawURLEncoding.EncodeToString(nonce),
+	})
+}
+
+// verifyState checks that the state was issued for `provider` and has not expired at `now`; any other state is
+// rejected with ErrInvalidState
+func (rt *_router) verifyState(state string, provider string, now time.Time) error {
+	var claims providerState
+
+	if !rt.verifyClaims("state", state, &claims) || claims.Provider != provider || now.Unix() >= claims.ExpiresAt {
+		return ErrInvalidState
+	}
+
+	return nil
+}
+
+// identityUsername returns the username tried at the `attempt`-th time for a new user signing in through a
+// provider: the name they go by on the provider, made of the characters a mention is made of and cut to the length
+// allowed by `policy`, followed by a random number after the first attempt; "user" takes its place if the policy
+// does not allow it or `reservation` reserves it
+func identityUsername(policy *usernames.Policy, reservation *usernames.Reservation, identity auth.Identity, attempt int) (string, error) {
+	name := policy.Normalize(strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '.' {
+			return r
+		}
+
+		return -1
+	}, identity.Username))
+
+	suffix := ""
+
+	if attempt > 0 {
+		n, err := rand.Int(rand.Reader, big.NewInt(10000))
+
+		if err != nil {
+			return "", err
+		}
+
+		suffix = strconv.FormatInt(n.Int64(), 10)
+	}
+
+	// the random number is kept whole, cutting the name instead
+	length := policy.MaxLength() - len(suffix)
+
+	for _, base := range []string{name, "user"} {
+		username := []rune(base)
+
+		if length >= 0 && len(username) > length {
+			username = username[:length]
+		}
+
+		candidate := string(username) + suffix
+
+		if _, reserved := reservation.Reserved(candidate); policy.Valid(candidate) && !reserved {
+			return candidate, nil
+		}
+	}
+
+	return "", fmt.Errorf("no username allowed by the username policy for %q", identity.Username)
+}
+
+func (rt *_router) getProviders(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	providers := ProviderList{Providers: make([]string, 0, len(rt.authProviders))}
+
+	for name := range rt.authProviders {
+		providers.Providers = append(providers.Providers, name)
+	}
+
+	sort.Strings(providers.Providers)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK) // 200
+
+	// return the providers the users sign in through
+	_ = json.NewEncoder(w).Encode(providers)
+}
+
+func (rt *_router) startProviderLogin(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	name := ps.ByName("provider")
+
+	provider, ok := rt.authProviders[name]
+
+	if !ok {
+		writeError(w, ErrProviderDoesNotExist, http.StatusNotFound)
+		return
+	}
+
+	// issue the state binding the sign-in to the client
+	state, err := rt.issueState(name, time.Now())
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	login := ProviderLogin{
+		URL:   provider.AuthCodeURL(state),
+		State: state,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK) // 200
+
+	// return the page where the user signs in
+	_ = json.NewEncoder(w).Encode(login)
+}
+
+func (rt *_router) providerLogin(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	name := ps.ByName("provider")
+
+	provider, ok := rt.authProviders[name]
+
+	if !ok {
+		writeError(w, ErrProviderDoesNotExist, http.StatusNotFound)
+		return
+	}
+
+	callback := ProviderCallbackDefault()
+
+	// get the authorization code given by the provider
+	code, err := decodeJSON(r, &callback)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	now := time.Now()
+
+	// the state must have been issued by the backend for
+	// this provider, or the code may have been injected
+	err = rt.verifyState(callback.State, name, now)
+
+	if err != nil {
+		writeError(w, err, http.StatusUnauthorized)
+		return
+	}
+
+	// exchange the code for the identity of the user
+	identity, err := provider.Exchange(ctx.Context, callback.Code, callback.State)
+
+	if errors.Is(err, auth.ErrInvalidCode) {
+		ctx.Logger.WithError(err).WithField("provider", name).Warn("authorization code rejected")
+		writeError(w, ErrInvalidCode, http.StatusUnauthorized)
+		return
+	}
+
+	if err != nil {
+		ctx.Logger.WithError(err).WithField("provider", name).Error("can't exchange the authorization code")
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	dbIdentity := database.DatabaseIdentityDefault()
+	dbIdentity.Provider = name
+	dbIdentity.Subject = identity.Subject
+	dbIdentity.Date = now
+
+	// a user who is already logged in links the identity
+	// to their account, to sign in through the provider
+	if ctx.UserId != 0 {
+		code, err := rejectAPIKey(ctx)
+
+		if err != nil {
+			writeError(w, err, code)
+			return
+		}
+
+		dbIdentity.User.Id = ctx.UserId
+
+		err = rt.db.InsertIdentity(ctx.Context, dbIdentity)
+
+		if errors.Is(err, database.ErrIdentityAlreadyLinked) {
+			writeError(w, ErrIdentityAlreadyLinked, http.StatusConflict)
+			return
+		}
+
+		if err != nil {
+			writeError(w, err, http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent) // 204
+		return
+	}
+
+	dbUser, err := rt.identityUser(ctx, identity, dbIdentity, now)
+
+	if errors.Is(err, database.ErrUsernameAlreadyTaken) {
+		writeError(w, err, http.StatusConflict)
+		return
+	}
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	// open the session of the user
+	session, err := rt.openSession(ctx.Context, dbUser, now)
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated) // 201
+
+	// return the logged in user with their token
+	_ = json.NewEncoder(w).Encode(session)
+}
+
+// identityUser returns the user linked to the identity, restoring their account if it was deactivated within the
+// reactivation window; a user signing in for the first time is registered with a free username
+func (rt *_router) identityUser(ctx reqcontext.RequestContext, identity auth.Identity, dbIdentity database.DatabaseIdentity, now time.Time) (database.DatabaseUser, error) {
+	dbUser, err := rt.db.GetIdentityUser(ctx.Context, dbIdentity.Provider, dbIdentity.Subject)
+
+	if err == nil {
+		dbLogin := database.DatabaseLoginDefault()
+		dbLogin.Username = dbUser.Username
+
+		var urls []string
+
+		// the data and the files of an account deactivated outside of the
+		// reactivation window are removed, and its identity with them
+		urls, err = rt.db.ReactivateUser(ctx.Context, dbLogin, now.Add(-rt.reactivationWindow))
+
+		if err != nil {
+			return dbUser, err
+		}
+
+		rt.deleteAccountFiles(ctx.Context, ctx.Logger, urls)
+
+		dbUser, err = rt.db.GetIdentityUser(ctx.Context, dbIdentity.Provider, dbIdentity.Subject)
+	}
+
+	if !errors.Is(err, database.ErrIdentityDoesNotExist) {
+		return dbUser, err
+	}
+
+	reservation, err := rt.currentReservation(ctx.Context)
+
+	if err != nil {
+		return dbUser, err
+	}
+
+	// register the user, with another username
+	// whenever the previous one is already taken
+	for attempt := 0; attempt < identityUsernameAttempts; attempt++ {
+		dbUser = database.DatabaseUserDefault()
+
+		dbUser.Username, err = identityUsername(rt.usernames, reservation, identity, attempt)
+
+		if err != nil {
+			return dbUser, err
+		}
+
+		err = rt.db.InsertIdentityUser(ctx.Context, &dbUser, dbIdentity)
+
+		// another request signed the user in first
+		if errors.Is(err, database.ErrIdentityAlreadyLinked) {
+			return rt.db.GetIdentityUser(ctx.Context, dbIdentity.Provider, dbIdentity.Subject)
+		}
+
+		if !errors.Is(err, database.ErrUsernameAlreadyTaken) {
+			return dbUser, err
+		}
+	}
+
+	return dbUser, err
+}
@@ -0,0 +1,78 @@
+package api
+
+import (
+	"sync"
+	"time"
+)
+
+// rateLimitSweepInterval is how often the buckets of the keys which stopped sending requests are dropped
+const rateLimitSweepInterval = 10 * time.Minute
+
+// rateLimiter keeps a token bucket for each API key, holding as many tokens as the requests the key may send in a
+// minute and refilled at the same pace; the buckets are kept in memory, hence each instance of the backend counts the
+// requests it serves on its own
+type rateLimiter struct {
+	mu        sync.Mutex
+	buckets   map[uint32]*rateBucket
+	lastSweep time.Time
+}
+
+type rateBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{
+		buckets: make(map[uint32]*rateBucket),
+	}
+}
+
+// allow takes a token from the bucket of the key `keyId`, which may send `perMinute` requests a minute, at `now`. If
+// the bucket is empty the request is refused, returning how long the key has to wait for the next token.
+func (l *rateLimiter) allow(keyId uint32, perMinute int, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastSweep) >= rateLimitSweepInterval {
+		l.sweep(now)
+	}
+
+	capacity := float64(perMinute)
+	rate := capacity / time.Minute.Seconds()
+
+	bucket := l.buckets[keyId]
+
+	if bucket == nil {
+		bucket = &rateBucket{tokens: capacity, last: now}
+		l.buckets[keyId] = bucket
+	}
+
+	// refill the bucket for the time passed since the last request,
+	// up to its capacity, which may have changed in the meantime
+	bucket.tokens += now.Sub(bucket.last).Seconds() * rate
+	bucket.last = now
+
+	if bucket.tokens > capacity {
+		bucket.tokens = capacity
+	}
+
+	if bucket.tokens < 1 {
+		return false, time.Duration((1 - bucket.tokens) / rate * float64(time.Second))
+	}
+
+	bucket.tokens--
+
+	return true, 0
+}
+
+// sweep drops the buckets which have been idle for a minute, since they are full again and would be created as such
+func (l *rateLimiter) sweep(now time.Time) {
+	for keyId, bucket := range l.buckets {
+		if now.Sub(bucket.last) >= time.Minute {
+			delete(l.buckets, keyId)
+		}
+	}
+
+	l.lastSweep = now
+}
@@ -0,0 +1,120 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/api/reqcontext"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/database"
+	"github.com/julienschmidt/httprouter"
+)
+
+func (rt *_router) getPhotoReactions(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// get the user authenticated by the bearer token
+	userId, err := GetAuthenticatedUserId(ctx)
+
+	if err != nil {
+		writeError(w, err, http.StatusUnauthorized)
+		return
+	}
+
+	// authenticate the user performing the action
+	dbUser, err := rt.db.GetDatabaseUser(ctx.Context, userId)
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	// get the user of the photo from the resource parameter
+	photoUser, code, err := rt.GetUserFromParameter(ctx, "uname", r, ps)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	// check whether the user of the photo
+	// has banned the user performing the action
+	checkBan, err := rt.db.CheckBan(ctx.Context, photoUser.UserIntoDatabaseUser(), dbUser)
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	if checkBan {
+		writeError(w, ErrBannedUser, http.StatusUnauthorized)
+		return
+	}
+
+	// get the photo from the resource parameter
+	photo, code, err := rt.GetPhotoFromParameter(ctx, "photo_id", UserFromDatabaseUser(dbUser), r, ps)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	// check if the resource is consistent
+	if photo.User.Id != photoUser.Id {
+		writeError(w, ErrPageNotFound, http.StatusNotFound)
+		return
+	}
+
+	// get the type of the reactions from the query,
+	// every type is listed if it is missing
+	reaction := r.URL.Query().Get("type")
+
+	if reaction != "" && !database.IsReaction(reaction) {
+		writeError(w, ErrInvalidReaction, http.StatusBadRequest)
+		return
+	}
+
+	// get the pagination parameters from the query
+	limit, after, code, err := GetPageFromQuery(r)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	// get the page of the reaction list from the database
+	dbReactionList, err := rt.db.GetReactionList(ctx.Context, photo.PhotoIntoDatabasePhoto(), dbUser, reaction, limit, after)
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	reactionList := ReactionListFromDatabaseReactionList(dbReactionList)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK) // 200
+
+	// return the reaction list
+	_ = json.NewEncoder(w).Encode(reactionList)
+}
+
+func (rt *_router) reactPhoto(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	reaction := ReactionDefault()
+
+	// get the type of the reaction from the request body
+	code, err := decodeJSON(r, &reaction)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	if !database.IsReaction(reaction.Type) {
+		writeError(w, ErrInvalidReaction, http.StatusBadRequest)
+		return
+	}
+
+	rt.reactToPhoto(w, r, ps, ctx, "reaction_uname", reaction.Type)
+}
+
+func (rt *_router) unreactPhoto(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	rt.removeReaction(w, r, ps, ctx, "reaction_uname")
+}
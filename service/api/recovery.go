@@ -0,0 +1,30 @@
+package api
+
+import (
+	"net/http"
+	"runtime/debug"
+
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/api/reqcontext"
+)
+
+// recoverPanic recovers the handler of the request from a panic, logging it with its stack trace and the id of the
+// request, and replies with a 500 telling the client the id to report. It must be deferred before calling the handler,
+// with the context that the request fills as it is authenticated; the panics aborting the handler on purpose
+// (http.ErrAbortHandler) are left to the server.
+func (rt *_router) recoverPanic(w http.ResponseWriter, ctx *reqcontext.RequestContext) {
+	rec := recover()
+
+	if rec == nil {
+		return
+	}
+
+	if rec == http.ErrAbortHandler {
+		panic(rec)
+	}
+
+	ctx.Logger.WithField("panic", rec).WithField("stack", string(debug.Stack())).Error("panic while handling the request")
+
+	// if the handler already started the response the status
+	// cannot be changed anymore, and the client gets it cut short
+	writeError(w, ErrInternal, http.StatusInternalServerError)
+}
@@ -7,6 +7,8 @@ Each value here should be assumed valid only per request only, with some excepti
 package reqcontext
 
 import (
+	"context"
+
 	"github.com/gofrs/uuid"
 	"github.com/sirupsen/logrus"
 )
@@ -16,6 +18,20 @@ type RequestContext struct {
 	// ReqUUID is the request unique ID
 	ReqUUID uuid.UUID
 
+	// Context is the context of the underlying HTTP request, cancelled when the client disconnects. Pass it to the
+	// database so that queries are aborted together with the request
+	Context context.Context
+
 	// Logger is a custom field logger for the request
 	Logger logrus.FieldLogger
+
+	// UserId is the id of the user authenticated by the bearer token of the request, whose signature was verified;
+	// it is 0 if the request carries no token
+	UserId uint32
+
+	// SessionId is the id of the session of the bearer token, 0 if the request carries no token
+	SessionId uint32
+
+	// APIKeyId is the id of the API key authenticating the request in place of a bearer token, 0 if there is none
+	APIKeyId uint32
 }
@@ -0,0 +1,173 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/api/reqcontext"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/usernames"
+	"github.com/julienschmidt/httprouter"
+)
+
+// reservationRefresh is how long the reservation of the usernames is kept before it is built again, so that the names
+// reserved through another instance of the backend are picked up
+const reservationRefresh = time.Minute
+
+// maxReservedNameLength is the maximum length of a reserved name or term, in characters
+const maxReservedNameLength = 64
+
+// currentReservation returns the reservation merging the usernames and the terms of the configuration with the ones
+// reserved in the database, building it again if it is older than reservationRefresh
+func (rt *_router) currentReservation(ctx context.Context) (*usernames.Reservation, error) {
+	rt.reservationMu.Lock()
+	current, loaded := rt.reservation, rt.reservationLoaded
+	rt.reservationMu.Unlock()
+
+	if current != nil && time.Since(loaded) < reservationRefresh {
+		return current, nil
+	}
+
+	dbReservedNames, err := rt.db.GetReservedNames(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	names := append([]string{}, rt.reservedUsernames...)
+	terms := append([]string{}, rt.blockedUsernames...)
+
+	for _, dbReservedName := range dbReservedNames {
+		if dbReservedName.Contained {
+			terms = append(terms, dbReservedName.Name)
+		} else {
+			names = append(names, dbReservedName.Name)
+		}
+	}
+
+	current = rt.usernames.Reserve(names, terms)
+
+	rt.reservationMu.Lock()
+	rt.reservation, rt.reservationLoaded = current, time.Now()
+	rt.reservationMu.Unlock()
+
+	return current, nil
+}
+
+// resetReservation drops the reservation, which is built again the next time it is needed
+func (rt *_router) resetReservation() {
+	rt.reservationMu.Lock()
+	rt.reservation = nil
+	rt.reservationMu.Unlock()
+}
+
+func (rt *_router) getReservedNames(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// authenticate the administrator performing the action
+	err := CheckAdminAuthorization(rt.adminToken, r.Header.Get("Authorization"))
+
+	if err != nil {
+		writeError(w, err, http.StatusUnauthorized)
+		return
+	}
+
+	// get the names reserved in the database; the ones of
+	// the configuration cannot be changed, hence are not listed
+	dbReservedNames, err := rt.db.GetReservedNames(ctx.Context)
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK) // 200
+
+	// return the reserved names
+	_ = json.NewEncoder(w).Encode(ReservedNameListFromDatabaseReservedNameArray(dbReservedNames))
+}
+
+func (rt *_router) reserveName(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// authenticate the administrator performing the action
+	err := CheckAdminAuthorization(rt.adminToken, r.Header.Get("Authorization"))
+
+	if err != nil {
+		writeError(w, err, http.StatusUnauthorized)
+		return
+	}
+
+	reservedName := ReservedNameDefault()
+
+	// get the name to be reserved from the request body
+	code, err := decodeJSON(r, &reservedName)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	// the name is saved as it is matched, so that the
+	// same name cannot be reserved twice in another case
+	reservedName.Name = strings.ToLower(rt.usernames.Normalize(strings.TrimSpace(reservedName.Name)))
+
+	if reservedName.Name == "" || utf8.RuneCountInString(reservedName.Name) > maxReservedNameLength {
+		writeError(w, ErrInvalidReservedName, http.StatusBadRequest)
+		return
+	}
+
+	dbReservedName := reservedName.ReservedNameIntoDatabaseReservedName()
+
+	// insert the name into the database
+	err = rt.db.InsertReservedName(ctx.Context, &dbReservedName)
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	rt.resetReservation()
+
+	ctx.Logger.WithField("name", dbReservedName.Id).Info("name reserved by the administrators")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated) // 201
+
+	// return the newly reserved name
+	_ = json.NewEncoder(w).Encode(ReservedNameFromDatabaseReservedName(dbReservedName))
+}
+
+func (rt *_router) unreserveName(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// authenticate the administrator performing the action
+	err := CheckAdminAuthorization(rt.adminToken, r.Header.Get("Authorization"))
+
+	if err != nil {
+		writeError(w, err, http.StatusUnauthorized)
+		return
+	}
+
+	// get the name to be released from the resource parameter
+	nameId, err := strconv.ParseUint(ps.ByName("name_id"), 10, 32)
+
+	if err != nil {
+		writeError(w, ErrPageNotFound, http.StatusNotFound)
+		return
+	}
+
+	// remove the name from the database
+	err = rt.db.DeleteReservedName(ctx.Context, uint32(nameId))
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	rt.resetReservation()
+
+	ctx.Logger.WithField("name", nameId).Info("name released by the administrators")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusNoContent) // 204
+}
@@ -0,0 +1,237 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/api/reqcontext"
+	"github.com/julienschmidt/httprouter"
+)
+
+// defaultCategoryLimit is the number of results of each category of the unified search when none is requested
+const defaultCategoryLimit = 5
+
+// getCategoryLimit returns the number of results requested for a category of the unified search through the query
+// parameter `parameter`, capped at maxPageLimit; a limit of 0 leaves the category out.
+func getCategoryLimit(parameter string, r *http.Request) (int, int, error) {
+	limitString := r.URL.Query().Get(parameter)
+
+	if limitString == "" {
+		return defaultCategoryLimit, -1, nil
+	}
+
+	limit, err := strconv.Atoi(limitString)
+
+	if err != nil || limit < 0 {
+		return 0, http.StatusBadRequest, ErrInvalidCategoryLimit
+	}
+
+	if limit > maxPageLimit {
+		limit = maxPageLimit
+	}
+
+	return limit, -1, nil
+}
+
+func (rt *_router) search(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// get the user authenticated by the bearer token
+	userId, err := GetAuthenticatedUserId(ctx)
+
+	if err != nil {
+		writeError(w, err, http.StatusUnauthorized)
+		return
+	}
+
+	// get the user performing the action
+	dbUser, err := rt.db.GetDatabaseUser(ctx.Context, userId)
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	// get the text to be searched from the query
+	text := strings.TrimSpace(r.URL.Query().Get("q"))
+
+	if text == "" {
+		writeError(w, ErrInvalidSearch, http.StatusBadRequest)
+		return
+	}
+
+	// get the number of results of each category from the query
+	limits := make(map[string]int)
+
+	for _, category := range []string{"users", "hashtags", "comments"} {
+		limit, code, err := getCategoryLimit(category+"_limit", r)
+
+		if err != nil {
+			writeError(w, err, code)
+			return
+		}
+
+		limits[category] = limit
+	}
+
+	result := SearchResultDefault()
+
+	// get the users whose username contains the text,
+	// from the exact match to the partial ones
+	if limits["users"] > 0 {
+		dbUserList, err := rt.db.SearchUsers(ctx.Context, dbUser, text, limits["users"], 0)
+
+		if err != nil {
+			writeError(w, err, http.StatusInternalServerError)
+			return
+		}
+
+		result.Users = UserArrayFromDatabaseUserArray(dbUserList.Users)
+	}
+
+	// get the hashtags containing the text, from the exact
+	// match to the partial ones, the most used ones first
+	if limits["hashtags"] > 0 {
+		dbHashtags, err := rt.db.SearchHashtags(ctx.Context, dbUser, text, limits["hashtags"])
+
+		if err != nil {
+			writeError(w, err, http.StatusInternalServerError)
+			return
+		}
+
+		result.Hashtags = HashtagCountArrayFromDatabaseHashtagCountArray(dbHashtags)
+	}
+
+	// get the newest comments matching the text, which
+	// are the text written about the photos
+	if limits["comments"] > 0 {
+		dbCommentList, err := rt.db.SearchComments(ctx.Context, dbUser, text, limits["comments"], 0)
+
+		if err != nil {
+			writeError(w, err, http.StatusInternalServerError)
+			return
+		}
+
+		result.Comments = CommentArrayFromDatabaseCommentArray(dbCommentList.Comments)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK) // 200
+
+	// return the results of every category
+	_ = json.NewEncoder(w).Encode(result)
+}
+
+func (rt *_router) searchComments(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// get the user authenticated by the bearer token
+	userId, err := GetAuthenticatedUserId(ctx)
+
+	if err != nil {
+		writeError(w, err, http.StatusUnauthorized)
+		return
+	}
+
+	// get the user performing the action
+	dbUser, err := rt.db.GetDatabaseUser(ctx.Context, userId)
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	// get the text to be searched from the query
+	text := r.URL.Query().Get("q")
+
+	if strings.TrimSpace(text) == "" {
+		writeError(w, ErrInvalidSearch, http.StatusBadRequest)
+		return
+	}
+
+	// get the pagination parameters from the query
+	limit, _, code, err := GetPageFromQuery(r)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	before, code, err := GetCursorFromQuery("before", r)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	// get the page of the comments matching the text from the database
+	dbCommentList, err := rt.db.SearchComments(ctx.Context, dbUser, text, limit, before)
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	commentList := CommentListFromDatabaseCommentList(dbCommentList)
+
+	// the next page is made of the comments older than the last one
+	list := ItemList{Items: commentList.Comments}
+
+	if len(commentList.Comments) > 0 {
+		list.NextCursor = nextCursor(len(commentList.Comments), limit, commentList.Comments[len(commentList.Comments)-1].Id)
+	}
+
+	// return the comment list
+	writeList(w, r, commentList, list, "before")
+}
+
+func (rt *_router) searchUsers(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// get the user authenticated by the bearer token
+	userId, err := GetAuthenticatedUserId(ctx)
+
+	if err != nil {
+		writeError(w, err, http.StatusUnauthorized)
+		return
+	}
+
+	// get the user performing the action
+	dbUser, err := rt.db.GetDatabaseUser(ctx.Context, userId)
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	// get the username to be searched from the query
+	query := strings.TrimSpace(r.URL.Query().Get("query"))
+
+	if query == "" {
+		writeError(w, ErrInvalidSearch, http.StatusBadRequest)
+		return
+	}
+
+	// get the pagination parameters from the query
+	limit, after, code, err := GetPageFromQuery(r)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	// get the page of the users matching the query from the database
+	dbUserList, err := rt.db.SearchUsers(ctx.Context, dbUser, query, limit, after)
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	userList := UserListFromDatabaseUserList(dbUserList)
+
+	list := ItemList{Items: userList.Users}
+
+	if len(userList.Users) > 0 {
+		list.NextCursor = nextCursor(len(userList.Users), limit, userList.Users[len(userList.Users)-1].Id)
+	}
+
+	// return the user list
+	writeList(w, r, userList, list, "after")
+}
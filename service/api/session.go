@@ -0,0 +1,285 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/api/reqcontext"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/database"
+	"github.com/julienschmidt/httprouter"
+)
+
+// sessionTouchInterval is how often the last use of a session is recorded, so that not every request writes to the
+// database
+const sessionTouchInterval = time.Minute
+
+// hashToken returns the hash of the token identifying its session, so that the database never holds the tokens
+// themselves
+func hashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+
+	return hex.EncodeToString(hash[:])
+}
+
+// newRefreshToken returns a random refresh token, which is opaque to the clients
+func newRefreshToken() (string, error) {
+	refreshToken := make([]byte, 32)
+
+	_, err := rand.Read(refreshToken)
+
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(refreshToken), nil
+}
+
+// openSession issues the access token authenticating the user from `now` and the refresh token exchanged for the next
+// ones, opening their session, which lasts until its refresh token expires or it is revoked
+func (rt *_router) openSession(ctx context.Context, dbUser database.DatabaseUser, now time.Time) (Session, error) {
+	token, expiresAt, err := rt.issueToken(dbUser.Id, now)
+
+	if err != nil {
+		return Session{}, err
+	}
+
+	refreshToken, err := newRefreshToken()
+
+	if err != nil {
+		return Session{}, err
+	}
+
+	dbRefreshToken := database.DatabaseRefreshTokenDefault()
+	dbRefreshToken.TokenHash = hashToken(refreshToken)
+	dbRefreshToken.CreatedAt = now
+	dbRefreshToken.ExpiresAt = now.Add(rt.refreshLifetime)
+
+	dbSession := database.DatabaseSessionDefault()
+	dbSession.User = dbUser
+	dbSession.TokenHash = hashToken(token)
+	dbSession.CreatedAt = now
+	dbSession.ExpiresAt = dbRefreshToken.ExpiresAt
+	dbSession.LastSeen = now
+
+	err = rt.db.InsertSession(ctx, &dbSession, &dbRefreshToken)
+
+	if err != nil {
+		return Session{}, err
+	}
+
+	return Session{
+		Id:               dbUser.Id,
+		Username:         dbUser.Username,
+		Token:            token,
+		ExpiresAt:        expiresAt.UTC(),
+		RefreshToken:     refreshToken,
+		RefreshExpiresAt: dbRefreshToken.ExpiresAt.UTC().Truncate(time.Second),
+	}, nil
+}
+
+// authenticate returns the session of the token at `now`, which must be signed by the backend and belong to a
+// session which is neither expired nor revoked; the session is then refreshed with its last use. The tokens which are
+// not accepted are rejected with ErrInvalidToken.
+func (rt *_router) authenticate(ctx context.Context, token string, now time.Time) (database.DatabaseSession, error) {
+	userId, err := rt.verifyToken(token, now)
+
+	if err != nil {
+		return database.DatabaseSessionDefault(), err
+	}
+
+	dbSession, err := rt.db.GetDatabaseSession(ctx, hashToken(token))
+
+	if errors.Is(err, database.ErrSessionDoesNotExist) {
+		return dbSession, ErrInvalidToken
+	}
+
+	if err != nil {
+		return dbSession, err
+	}
+
+	if dbSession.User.Id != userId || !now.Before(dbSession.ExpiresAt) {
+		return dbSession, ErrInvalidToken
+	}
+
+	if now.Sub(dbSession.LastSeen) >= sessionTouchInterval {
+		err = rt.db.TouchSession(ctx, dbSession, now)
+
+		// the session may have been revoked since it was read
+		if errors.Is(err, database.ErrSessionDoesNotExist) {
+			return dbSession, ErrInvalidToken
+		}
+
+		if err != nil {
+			return dbSession, err
+		}
+	}
+
+	return dbSession, nil
+}
+
+func (rt *_router) logout(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// only the session of the bearer token is closed
+	if ctx.SessionId == 0 {
+		writeError(w, ErrUserUnauthorized, http.StatusUnauthorized)
+		return
+	}
+
+	dbSession := database.DatabaseSessionDefault()
+	dbSession.Id = ctx.SessionId
+
+	// revoke the session, so that neither its access token nor its
+	// refresh token can be replayed; a session which was revoked
+	// by another request in the meantime is already closed
+	err := rt.db.DeleteSession(ctx.Context, dbSession)
+
+	if err != nil && !errors.Is(err, database.ErrSessionDoesNotExist) {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent) // 204
+}
+
+func (rt *_router) revokeSessions(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// the sessions are managed by the user alone
+	code, err := rejectAPIKey(ctx)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	// authenticate the user performing the action
+	user, code, err := rt.AuthenticateUserFromParameter(ctx, "uname", r, ps)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	// revoke every session of the user, including the current one
+	err = rt.db.DeleteUserSessions(ctx.Context, user.UserIntoDatabaseUser())
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent) // 204
+}
+
+func (rt *_router) refreshSession(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	refresh := RefreshDefault()
+
+	// get the refresh token to be exchanged
+	code, err := decodeJSON(r, &refresh)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	dbRefreshToken, err := rt.db.GetDatabaseRefreshToken(ctx.Context, hashToken(refresh.RefreshToken))
+
+	if errors.Is(err, database.ErrRefreshTokenDoesNotExist) {
+		writeError(w, ErrInvalidRefreshToken, http.StatusUnauthorized)
+		return
+	}
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	// a refresh token which was already exchanged
+	// may have been stolen, hence its whole session
+	// is revoked, both for the thief and the user
+	if dbRefreshToken.Used {
+		rt.revokeStolenSession(w, ctx, dbRefreshToken.Session)
+		return
+	}
+
+	now := time.Now()
+
+	if !now.Before(dbRefreshToken.ExpiresAt) {
+		writeError(w, ErrInvalidRefreshToken, http.StatusUnauthorized)
+		return
+	}
+
+	// issue the new access token and refresh token of the session
+	dbUser := dbRefreshToken.Session.User
+
+	token, expiresAt, err := rt.issueToken(dbUser.Id, now)
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	refreshToken, err := newRefreshToken()
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	newDbRefreshToken := database.DatabaseRefreshTokenDefault()
+	newDbRefreshToken.TokenHash = hashToken(refreshToken)
+	newDbRefreshToken.CreatedAt = now
+	newDbRefreshToken.ExpiresAt = now.Add(rt.refreshLifetime)
+
+	// exchange the refresh token, which another
+	// request may have exchanged in the meantime
+	err = rt.db.RotateRefreshToken(ctx.Context, dbRefreshToken, &newDbRefreshToken, hashToken(token))
+
+	if errors.Is(err, database.ErrRefreshTokenReused) {
+		rt.revokeStolenSession(w, ctx, dbRefreshToken.Session)
+		return
+	}
+
+	if errors.Is(err, database.ErrSessionDoesNotExist) {
+		writeError(w, ErrInvalidRefreshToken, http.StatusUnauthorized)
+		return
+	}
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	session := Session{
+		Id:               dbUser.Id,
+		Username:         dbUser.Username,
+		Token:            token,
+		ExpiresAt:        expiresAt.UTC(),
+		RefreshToken:     refreshToken,
+		RefreshExpiresAt: newDbRefreshToken.ExpiresAt.UTC().Truncate(time.Second),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK) // 200
+
+	// return the user with their new tokens
+	_ = json.NewEncoder(w).Encode(session)
+}
+
+// revokeStolenSession revokes the session whose refresh token was reused and rejects the request
+func (rt *_router) revokeStolenSession(w http.ResponseWriter, ctx reqcontext.RequestContext, dbSession database.DatabaseSession) {
+	ctx.Logger.WithField("user", dbSession.User.Id).Warn("refresh token reused, revoking its session")
+
+	err := rt.db.DeleteSession(ctx.Context, dbSession)
+
+	if err != nil && !errors.Is(err, database.ErrSessionDoesNotExist) {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	writeError(w, ErrInvalidRefreshToken, http.StatusUnauthorized)
+}
@@ -2,5 +2,21 @@ package api
 
 // Close should close everything opened in the lifecycle of the `_router`; for example, background goroutines.
 func (rt *_router) Close() error {
+	// end the event streams, stop the publication of the
+	// scheduled photos, the removal of the expired stories,
+	// bans and idempotency keys, the erasure of the accounts,
+	// the delivery of the notifications to the devices, the
+	// one of the digests and the one of the events to the
+	// webhooks, waiting for all of them but the event streams
+	close(rt.closing)
+	<-rt.publishDone
+	<-rt.storyCleanupDone
+	<-rt.banCleanupDone
+	<-rt.idempotencyDone
+	<-rt.erasureDone
+	<-rt.pushDone
+	<-rt.digestDone
+	<-rt.webhookDone
+
 	return nil
 }
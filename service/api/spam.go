@@ -0,0 +1,111 @@
+package api
+
+import (
+	"context"
+	"regexp"
+	"sync/atomic"
+	"time"
+)
+
+// linkPattern matches the links in the comments, with or without their scheme
+var linkPattern = regexp.MustCompile(`(?i)\b(?:https?://|www\.)\S+`)
+
+// the reasons a comment is suspected to be spam, recorded as the term of the held comments
+const (
+	spamReasonDuplicate = "spam:duplicate"
+	spamReasonLinks     = "spam:links"
+	spamReasonRate      = "spam:rate"
+)
+
+// SpamStats holds the counters of the spam checks of the comments.
+type SpamStats struct {
+	// Checked is the number of comments checked
+	Checked uint64
+
+	// Duplicates, Links and Rate are the number of comments failing each check
+	Duplicates uint64
+	Links      uint64
+	Rate       uint64
+
+	// Throttled and Held are the number of comments refused and held back for failing a check
+	Throttled uint64
+	Held      uint64
+}
+
+// spamCounters are the counters behind SpamStats, updated atomically
+type spamCounters struct {
+	checked    uint64
+	duplicates uint64
+	links      uint64
+	rate       uint64
+	throttled  uint64
+	held       uint64
+}
+
+// spamVerdict tells what to do with a comment: the policy of the check it failed, or SpamAllow, the reason it is
+// suspected to be spam and, when known, how long the user has to wait before posting it
+type spamVerdict struct {
+	policy     string
+	reason     string
+	retryAfter time.Duration
+}
+
+// SpamStats returns the counters of the spam checks of the comments.
+func (rt *_router) SpamStats() SpamStats {
+	return SpamStats{
+		Checked:    atomic.LoadUint64(&rt.spamStats.checked),
+		Duplicates: atomic.LoadUint64(&rt.spamStats.duplicates),
+		Links:      atomic.LoadUint64(&rt.spamStats.links),
+		Rate:       atomic.LoadUint64(&rt.spamStats.rate),
+		Throttled:  atomic.LoadUint64(&rt.spamStats.throttled),
+		Held:       atomic.LoadUint64(&rt.spamStats.held),
+	}
+}
+
+// checkSpam runs the spam checks on the comment, from the cheapest for the database to run: the rate of the comments
+// of its author, a comment with the same body posted by them shortly before and the number of links in it. The first
+// failed check which is not allowed decides what to do with the comment.
+func (rt *_router) checkSpam(ctx context.Context, comment Comment) (spamVerdict, error) {
+	atomic.AddUint64(&rt.spamStats.checked, 1)
+
+	// the recent comments of the user are only counted if needed
+	if rt.spamRate != SpamAllow || rt.spamDuplicates != SpamAllow {
+		dbActivity, err := rt.db.GetCommentActivity(ctx, comment.User.UserIntoDatabaseUser(), comment.CommentBody,
+			comment.Date.Add(-rt.spamDuplicateWindow), comment.Date.Add(-rt.spamRateWindow))
+
+		if err != nil {
+			return spamVerdict{}, err
+		}
+
+		if rt.spamRate != SpamAllow && dbActivity.Recent >= rt.spamMaxRate {
+			atomic.AddUint64(&rt.spamStats.rate, 1)
+
+			return spamVerdict{
+				policy:     rt.spamRate,
+				reason:     spamReasonRate,
+				retryAfter: dbActivity.FirstRecent.Add(rt.spamRateWindow).Sub(comment.Date),
+			}, nil
+		}
+
+		if rt.spamDuplicates != SpamAllow && dbActivity.Duplicates > 0 {
+			atomic.AddUint64(&rt.spamStats.duplicates, 1)
+
+			return spamVerdict{
+				policy:     rt.spamDuplicates,
+				reason:     spamReasonDuplicate,
+				retryAfter: dbActivity.LastDuplicate.Add(rt.spamDuplicateWindow).Sub(comment.Date),
+			}, nil
+		}
+	}
+
+	if rt.spamLinks != SpamAllow && len(linkPattern.FindAllStringIndex(comment.CommentBody, -1)) > rt.spamMaxLinks {
+		atomic.AddUint64(&rt.spamStats.links, 1)
+
+		return spamVerdict{
+			policy: rt.spamLinks,
+			reason: spamReasonLinks,
+		}, nil
+	}
+
+	return spamVerdict{policy: SpamAllow}, nil
+}
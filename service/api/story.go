@@ -0,0 +1,292 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/api/reqcontext"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/database"
+	"github.com/julienschmidt/httprouter"
+)
+
+func (rt *_router) uploadStory(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// authenticate the user performing the action
+	user, code, err := rt.AuthenticateUserFromParameter(ctx, "uname", r, ps)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	// the user may have to verify their email address first
+	code, err = rt.checkVerifiedEmail(ctx, user)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	// read the image of the story from the multipart
+	// form, with the same checks as the photos
+	content, contentType, code, err := rt.readUploadedPhoto(r)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	// the hash of the content names the file, as for the photos
+	name := photoContentName(content, contentType)
+
+	// hold the file until the story is inserted, so that no
+	// other request removes it as unused in between
+	unlock := rt.fileLocks.lock(name)
+	defer unlock()
+
+	// save the image in the storage
+	err = rt.photos.Put(ctx.Context, name, bytes.NewReader(content), contentType)
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	story := StoryDefault()
+
+	story.User = user
+	story.Url = rt.photos.URL(name)
+	story.Date = time.Now().UTC().Truncate(time.Second)
+	story.ExpiresAt = story.Date.Add(rt.storyLifetime)
+
+	dbStory := story.StoryIntoDatabaseStory()
+
+	// insert the story into the database
+	err = rt.db.InsertStory(ctx.Context, &dbStory)
+
+	if err != nil {
+		// the file of a story which was not saved is never
+		// served, unless another story or photo has the same image
+		_ = rt.removePhotoFile(ctx.Context, name)
+
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	story.Id = dbStory.Id
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated) // 201
+
+	// return the newly created story
+	_ = json.NewEncoder(w).Encode(story)
+}
+
+func (rt *_router) getStories(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// get the user authenticated by the bearer token
+	userId, err := GetAuthenticatedUserId(ctx)
+
+	if err != nil {
+		writeError(w, err, http.StatusUnauthorized)
+		return
+	}
+
+	// get the user performing the action
+	dbUser, err := rt.db.GetDatabaseUser(ctx.Context, userId)
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	// get the owner of the stories from the resource parameter
+	storyUser, code, err := rt.GetUserFromParameter(ctx, "uname", r, ps)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	// the stories can only be seen by their owner
+	// and by the followers the owner has not banned
+	if storyUser.Id != dbUser.Id {
+		checkBan, err := rt.db.CheckBan(ctx.Context, storyUser.UserIntoDatabaseUser(), dbUser)
+
+		if err != nil {
+			writeError(w, err, http.StatusInternalServerError)
+			return
+		}
+
+		if checkBan {
+			writeError(w, ErrBannedUser, http.StatusUnauthorized)
+			return
+		}
+
+		following, err := rt.db.GetFollowStatus(ctx.Context, dbUser, storyUser.UserIntoDatabaseUser())
+
+		if err != nil {
+			writeError(w, err, http.StatusInternalServerError)
+			return
+		}
+
+		if !following {
+			writeError(w, ErrStoryUnauthorized, http.StatusUnauthorized)
+			return
+		}
+	}
+
+	// get the unexpired stories from the database
+	dbStoryList, err := rt.db.GetStories(ctx.Context, storyUser.UserIntoDatabaseUser(), time.Now())
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	storyList := StoryListFromDatabaseStoryList(dbStoryList)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK) // 200
+
+	// return the story list
+	_ = json.NewEncoder(w).Encode(storyList)
+}
+
+func (rt *_router) deleteStory(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// authenticate the user performing the action
+	user, code, err := rt.AuthenticateUserFromParameter(ctx, "uname", r, ps)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	// get the story to be deleted from the resource parameter
+	storyId, err := strconv.ParseUint(ps.ByName("story_id"), 10, 32)
+
+	if err != nil {
+		writeError(w, ErrPageNotFound, http.StatusNotFound)
+		return
+	}
+
+	dbStory, err := rt.db.GetDatabaseStory(ctx.Context, uint32(storyId))
+
+	if errors.Is(err, database.ErrStoryDoesNotExist) {
+		writeError(w, err, http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	// check if the resource is consistent
+	if dbStory.User.Id != user.Id {
+		writeError(w, ErrPageNotFound, http.StatusNotFound)
+		return
+	}
+
+	// remove the story from the database
+	err = rt.db.DeleteStory(ctx.Context, dbStory)
+
+	if errors.Is(err, database.ErrStoryDoesNotExist) {
+		writeError(w, err, http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	// remove the file of the story; the story
+	// is already gone, so a failure is only logged
+	if name, ok := rt.photoFileName(dbStory.Url); ok {
+		err = rt.deletePhotoFile(ctx.Context, name)
+
+		if err != nil {
+			ctx.Logger.WithError(err).WithField("file", name).Warn("cannot remove the file of the story")
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent) // 204
+}
+
+func (rt *_router) getStoryTray(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// authenticate the user performing the action
+	user, code, err := rt.AuthenticateUserFromParameter(ctx, "uname", r, ps)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	// get the followed users having unexpired stories
+	dbStoryTray, err := rt.db.GetStoryTray(ctx.Context, user.UserIntoDatabaseUser(), time.Now())
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	storyTray := StoryTrayFromDatabaseStoryTray(dbStoryTray)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK) // 200
+
+	// return the story tray
+	_ = json.NewEncoder(w).Encode(storyTray)
+}
+
+// cleanupStories removes the expired stories and their files every `interval`, until the router is closed
+func (rt *_router) cleanupStories(interval time.Duration) {
+	defer close(rt.storyCleanupDone)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-rt.closing:
+			return
+		case <-ticker.C:
+			rt.deleteExpiredStories()
+		}
+	}
+}
+
+// deleteExpiredStories removes the stories which have expired, and then their files; the
+// files which cannot be removed are only logged, as their stories are already gone
+func (rt *_router) deleteExpiredStories() {
+	ctx := context.Background()
+
+	dbStories, err := rt.db.DeleteExpiredStories(ctx, time.Now())
+
+	if err != nil {
+		rt.baseLogger.WithError(err).Error("cannot remove the expired stories")
+		return
+	}
+
+	for _, dbStory := range dbStories {
+		name, ok := rt.photoFileName(dbStory.Url)
+
+		if !ok {
+			continue
+		}
+
+		err = rt.deletePhotoFile(ctx, name)
+
+		if err != nil {
+			rt.baseLogger.WithError(err).WithField("file", name).Warn("cannot remove the file of the story")
+		}
+	}
+
+	if len(dbStories) > 0 {
+		rt.baseLogger.WithField("stories", len(dbStories)).Debug("expired stories removed")
+	}
+}
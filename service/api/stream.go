@@ -1,39 +1,183 @@
 package api
 
 import (
-	"encoding/json"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/api/reqcontext"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/database"
 	"github.com/julienschmidt/httprouter"
 )
 
+// maxStreamAuthors is the maximum number of authors the stream can be narrowed down to
+const maxStreamAuthors = 50
+
 func (rt *_router) getMyStream(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
 	// get the user performing the action from the resource parameter
-	user, code, err := rt.AuthenticateUserFromParameter("uname", r, ps)
+	user, code, err := rt.AuthenticateUserFromParameter(ctx, "uname", r, ps)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	// get the pagination parameters from the query
+	limit, after, code, err := GetPageFromQuery(r)
 
 	if err != nil {
-		http.Error(w, err.Error(), code)
+		writeError(w, err, code)
+		return
+	}
+
+	before, code, err := GetCursorFromQuery("before", r)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	// get the filters of the stream from the query
+	filter, code, err := rt.GetStreamFilterFromQuery(ctx, r)
+
+	if err != nil {
+		writeError(w, err, code)
 		return
 	}
 
 	dbUser := user.UserIntoDatabaseUser()
 
-	// get the stream of the user performing the action
-	dbStream, err := rt.db.GetDatabaseStream(dbUser)
+	// get the page of the stream of the user performing the action
+	dbStream, err := rt.db.GetDatabaseStream(ctx.Context, dbUser, filter, limit, before, after)
 
 	dbStream.User = dbUser
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err, http.StatusInternalServerError)
 		return
 	}
 
 	stream := StreamFromDatabaseStream(dbStream)
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK) // 200
+	// the next page is made of the photos older than the last one
+	list := ItemList{Items: stream.Photos}
+
+	if len(stream.Photos) > 0 {
+		list.NextCursor = nextCursor(len(stream.Photos), limit, stream.Photos[len(stream.Photos)-1].Id)
+	}
 
 	// return the user's stream
-	_ = json.NewEncoder(w).Encode(stream)
+	writeList(w, r, stream, list, "before")
+}
+
+func (rt *_router) getStreamUpdates(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// get the user performing the action from the resource parameter
+	user, code, err := rt.AuthenticateUserFromParameter(ctx, "uname", r, ps)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	// get the newest photo held by the client from the query
+	since, code, err := GetCursorFromQuery("since", r)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	// count the photos of the stream newer than it
+	dbUpdates, err := rt.db.GetStreamUpdates(ctx.Context, user.UserIntoDatabaseUser(), since)
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	// the clients poll it, so they are answered with 304
+	// until there are new photos
+	writeJSONETag(w, r, StreamUpdatesFromDatabaseStreamUpdates(dbUpdates))
+}
+
+func (rt *_router) setStreamSeen(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// get the user performing the action from the resource parameter
+	user, code, err := rt.AuthenticateUserFromParameter(ctx, "uname", r, ps)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	// the photos posted until now are no longer unseen
+	err = rt.db.SetStreamSeen(ctx.Context, user.UserIntoDatabaseUser(), time.Now())
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent) // 204
+}
+
+// GetStreamFilterFromQuery returns the filters of the stream from the query of the request: the photos posted from
+// `since` (included) to `until` (excluded), given as RFC 3339 timestamps, the ones the user did not see yet if `unseen`
+// is true, and the ones of the comma-separated usernames in `authors` only. A missing parameter filters nothing.
+func (rt *_router) GetStreamFilterFromQuery(ctx reqcontext.RequestContext, r *http.Request) (database.DatabaseStreamFilter, int, error) {
+	filter := database.DatabaseStreamFilterDefault()
+	query := r.URL.Query()
+
+	var code int
+	var err error
+
+	filter.Since, code, err = GetDateFromQuery("since", r)
+
+	if err != nil {
+		return filter, code, err
+	}
+
+	filter.Until, code, err = GetDateFromQuery("until", r)
+
+	if err != nil {
+		return filter, code, err
+	}
+
+	if unseenString := query.Get("unseen"); unseenString != "" {
+		unseen, err := strconv.ParseBool(unseenString)
+
+		if err != nil {
+			return filter, http.StatusBadRequest, ErrInvalidUnseenFilter
+		}
+
+		filter.Unseen = unseen
+	}
+
+	if !query.Has("authors") {
+		return filter, -1, nil
+	}
+
+	usernames := strings.Split(query.Get("authors"), ",")
+
+	if len(usernames) > maxStreamAuthors {
+		return filter, http.StatusBadRequest, ErrInvalidAuthors
+	}
+
+	for _, username := range usernames {
+		if username == "" {
+			return filter, http.StatusBadRequest, ErrInvalidAuthors
+		}
+
+		// an author who does not exist is not found,
+		// as the user of any resource parameter
+		author, err := rt.GetUserFromLogin(ctx, LoginFromUsername(username))
+
+		if err != nil {
+			return filter, http.StatusInternalServerError, err
+		}
+
+		filter.Authors = append(filter.Authors, author.Id)
+	}
+
+	return filter, -1, nil
 }
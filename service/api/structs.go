@@ -1,16 +1,22 @@
 package api
 
 import (
+	"encoding/json"
+	"time"
+
 	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/database"
 )
 
 type Login struct {
 	Username string `json:"username"`
+	// Email is the email address given on signup, if any
+	Email string `json:"email"`
 }
 
 func LoginDefault() Login {
 	return Login{
 		Username: "",
+		Email:    "",
 	}
 }
 
@@ -32,29 +38,114 @@ func LoginFromUsername(username string) Login {
 	}
 }
 
+// Session is the user who logged in, together with the access token authenticating them until it expires and the
+// refresh token exchanged for the next ones
+type Session struct {
+	Id               uint32    `json:"id"`
+	Username         string    `json:"username"`
+	Token            string    `json:"token"`
+	ExpiresAt        time.Time `json:"expires_at"`
+	RefreshToken     string    `json:"refresh_token"`
+	RefreshExpiresAt time.Time `json:"refresh_expires_at"`
+}
+
+// Refresh is the refresh token exchanged for new tokens of its session
+type Refresh struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+func RefreshDefault() Refresh {
+	return Refresh{
+		RefreshToken: "",
+	}
+}
+
+// ProviderList is the external identity providers the users sign in through
+type ProviderList struct {
+	Providers []string `json:"providers"`
+}
+
+// ProviderLogin is the page of a provider where the user signs in, and the state the provider sends back with the
+// authorization code
+type ProviderLogin struct {
+	URL   string `json:"url"`
+	State string `json:"state"`
+}
+
+// ProviderCallback is the authorization code given to the client by a provider, with the state it was sent back with
+type ProviderCallback struct {
+	Code  string `json:"code"`
+	State string `json:"state"`
+}
+
+func ProviderCallbackDefault() ProviderCallback {
+	return ProviderCallback{
+		Code:  "",
+		State: "",
+	}
+}
+
 type User struct {
-	Id       uint32 `json:"id"`
-	Username string `json:"username"`
+	Id          uint32 `json:"id"`
+	Username    string `json:"username"`
+	DisplayName string `json:"display_name,omitempty"`
+	Bio         string `json:"bio,omitempty"`
+	Website     string `json:"website,omitempty"`
+	Avatar      string `json:"avatar,omitempty"`
+
+	// Version is the version of the user read from the database, checked when the user is
+	// updated; it is not part of the API
+	Version uint32 `json:"-"`
 }
 
 func UserDefault() User {
 	return User{
-		Id:       0,
-		Username: "",
+		Id:          0,
+		Username:    "",
+		DisplayName: "",
+		Bio:         "",
+		Website:     "",
+		Avatar:      "",
+		Version:     0,
 	}
 }
 
 func UserFromDatabaseUser(dbUser database.DatabaseUser) User {
 	return User{
-		Id:       dbUser.Id,
-		Username: dbUser.Username,
+		Id:          dbUser.Id,
+		Username:    dbUser.Username,
+		DisplayName: dbUser.DisplayName,
+		Bio:         dbUser.Bio,
+		Website:     dbUser.Website,
+		Avatar:      dbUser.Avatar,
+		Version:     dbUser.Version,
 	}
 }
 
 func (user *User) UserIntoDatabaseUser() database.DatabaseUser {
 	return database.DatabaseUser{
-		Id:       user.Id,
-		Username: user.Username,
+		Id:          user.Id,
+		Username:    user.Username,
+		DisplayName: user.DisplayName,
+		Bio:         user.Bio,
+		Website:     user.Website,
+		Avatar:      user.Avatar,
+		Version:     user.Version,
+	}
+}
+
+// ProfileDetails is what a user shows about themselves on their profile, besides their username
+type ProfileDetails struct {
+	DisplayName string `json:"display_name"`
+	Bio         string `json:"bio"`
+	Website     string `json:"website"`
+}
+
+func ProfileDetailsDefault() ProfileDetails {
+	return ProfileDetails{
+		DisplayName: "",
+		Bio:         "",
+		Website:     "",
 	}
 }
 
@@ -78,14 +169,83 @@ func UserArrayIntoDatabaseUserArray(array []User) []database.DatabaseUser {
 	return newArray
 }
 
+type Settings struct {
+	StripLocation  bool   `json:"strip_location"`
+	Email          string `json:"email"`
+	EmailVerified  bool   `json:"email_verified"`
+	Private        bool   `json:"private"`
+	CommentPolicy  string `json:"comment_policy"`
+	MentionPolicy  string `json:"mention_policy"`
+	HideLikeCounts bool   `json:"hide_like_counts"`
+}
+
+func SettingsDefault() Settings {
+	return Settings{
+		StripLocation:  false,
+		Email:          "",
+		EmailVerified:  false,
+		Private:        false,
+		CommentPolicy:  database.PolicyEveryone,
+		MentionPolicy:  database.PolicyEveryone,
+		HideLikeCounts: false,
+	}
+}
+
+func SettingsFromDatabaseSettings(dbSettings database.DatabaseSettings) Settings {
+	return Settings{
+		StripLocation:  dbSettings.StripLocation,
+		Email:          dbSettings.Email,
+		EmailVerified:  dbSettings.EmailVerified,
+		Private:        dbSettings.Private,
+		CommentPolicy:  dbSettings.CommentPolicy,
+		MentionPolicy:  dbSettings.MentionPolicy,
+		HideLikeCounts: dbSettings.HideLikeCounts,
+	}
+}
+
+func (settings *Settings) SettingsIntoDatabaseSettings() database.DatabaseSettings {
+	return database.DatabaseSettings{
+		StripLocation:  settings.StripLocation,
+		Email:          settings.Email,
+		EmailVerified:  settings.EmailVerified,
+		Private:        settings.Private,
+		CommentPolicy:  settings.CommentPolicy,
+		MentionPolicy:  settings.MentionPolicy,
+		HideLikeCounts: settings.HideLikeCounts,
+	}
+}
+
+// EmailVerification is the email address verified by following the link sent to it
+type EmailVerification struct {
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+}
+
 type Photo struct {
-	Id           uint32 `json:"id"`
-	User         User   `json:"user"`
-	Url          string `json:"url"`
-	Date         string `json:"date"`
-	LikeCount    int    `json:"like_count"`
-	CommentCount int    `json:"comment_count"`
-	LikeStatus   bool   `json:"like_status"`
+	Id           uint32         `json:"id"`
+	User         User           `json:"user"`
+	Url          string         `json:"url"`
+	Date         time.Time      `json:"date"`
+	LikeCount    int            `json:"like_count"`
+	CommentCount int            `json:"comment_count"`
+	LikeStatus   bool           `json:"like_status"`
+	Reaction     string         `json:"reaction,omitempty"`
+	Reactions    map[string]int `json:"reactions"`
+	Archived     bool           `json:"archived"`
+	DuplicateOf  uint32         `json:"duplicate_of,omitempty"`
+	Latitude     *float64       `json:"latitude,omitempty"`
+	Longitude    *float64       `json:"longitude,omitempty"`
+	Place        string         `json:"place,omitempty"`
+	Pinned       bool           `json:"pinned"`
+	CloseFriends bool           `json:"close_friends"`
+	Flagged      bool           `json:"flagged"`
+	Scheduled    bool           `json:"scheduled"`
+	LikesHidden  bool           `json:"likes_hidden"`
+	MediaType    string         `json:"media_type"`
+	PosterUrl    string         `json:"poster_url,omitempty"`
+	Duration     float64        `json:"duration,omitempty"`
+	OriginalUrl  string         `json:"original_url,omitempty"`
+	AltText      string         `json:"alt_text"`
 }
 
 func PhotoDefault() Photo {
@@ -93,10 +253,26 @@ func PhotoDefault() Photo {
 		Id:           0,
 		User:         UserDefault(),
 		Url:          "",
-		Date:         "",
+		Date:         time.Time{},
 		LikeCount:    0,
 		CommentCount: 0,
 		LikeStatus:   false,
+		Reaction:     "",
+		Reactions:    make(map[string]int),
+		Archived:     false,
+		Latitude:     nil,
+		Longitude:    nil,
+		Place:        "",
+		Pinned:       false,
+		CloseFriends: false,
+		Flagged:      false,
+		Scheduled:    false,
+		LikesHidden:  false,
+		MediaType:    database.MediaImage,
+		PosterUrl:    "",
+		Duration:     0,
+		OriginalUrl:  "",
+		AltText:      "",
 	}
 }
 
@@ -109,6 +285,22 @@ func PhotoFromDatabasePhoto(dbPhoto database.DatabasePhoto) Photo {
 		LikeCount:    dbPhoto.LikeCount,
 		CommentCount: dbPhoto.CommentCount,
 		LikeStatus:   dbPhoto.LikeStatus,
+		Reaction:     dbPhoto.Reaction,
+		Reactions:    dbPhoto.Reactions,
+		Archived:     dbPhoto.Archived,
+		Latitude:     dbPhoto.Latitude,
+		Longitude:    dbPhoto.Longitude,
+		Place:        dbPhoto.Place,
+		Pinned:       dbPhoto.Pinned,
+		CloseFriends: dbPhoto.CloseFriends,
+		Flagged:      dbPhoto.Flagged,
+		Scheduled:    dbPhoto.Scheduled,
+		LikesHidden:  dbPhoto.LikesHidden,
+		MediaType:    dbPhoto.MediaType,
+		PosterUrl:    dbPhoto.PosterUrl,
+		Duration:     dbPhoto.Duration.Seconds(),
+		OriginalUrl:  dbPhoto.OriginalUrl,
+		AltText:      dbPhoto.AltText,
 	}
 }
 
@@ -121,6 +313,54 @@ func (photo *Photo) PhotoIntoDatabasePhoto() database.DatabasePhoto {
 		LikeCount:    photo.LikeCount,
 		CommentCount: photo.CommentCount,
 		LikeStatus:   photo.LikeStatus,
+		Reaction:     photo.Reaction,
+		Reactions:    photo.Reactions,
+		Archived:     photo.Archived,
+		Latitude:     photo.Latitude,
+		Longitude:    photo.Longitude,
+		Place:        photo.Place,
+		Pinned:       photo.Pinned,
+		CloseFriends: photo.CloseFriends,
+		Flagged:      photo.Flagged,
+		Scheduled:    photo.Scheduled,
+		LikesHidden:  photo.LikesHidden,
+		MediaType:    photo.MediaType,
+		PosterUrl:    photo.PosterUrl,
+		Duration:     time.Duration(photo.Duration * float64(time.Second)),
+		OriginalUrl:  photo.OriginalUrl,
+		AltText:      photo.AltText,
+	}
+}
+
+// PhotoEdit is the crop and the rotation applied to the original image of a photo, the crop being given in its pixels
+// before the rotation
+type PhotoEdit struct {
+	Crop     *PhotoCrop `json:"crop"`
+	Rotation int        `json:"rotation"`
+}
+
+type PhotoCrop struct {
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+// PhotoAltText is the text describing a photo to the users who cannot see it, removed if it is empty
+type PhotoAltText struct {
+	AltText string `json:"alt_text"`
+}
+
+func PhotoAltTextDefault() PhotoAltText {
+	return PhotoAltText{
+		AltText: "",
+	}
+}
+
+func PhotoEditDefault() PhotoEdit {
+	return PhotoEdit{
+		Crop:     nil,
+		Rotation: 0,
 	}
 }
 
@@ -145,11 +385,11 @@ func PhotoArrayIntoDatabasePhotoArray(array []Photo) []database.DatabasePhoto {
 }
 
 type Comment struct {
-	Id          uint32 `json:"id"`
-	User        User   `json:"user"`
-	Photo       Photo  `json:"photo"`
-	Date        string `json:"date"`
-	CommentBody string `json:"comment_body"`
+	Id          uint32    `json:"id"`
+	User        User      `json:"user"`
+	Photo       Photo     `json:"photo"`
+	Date        time.Time `json:"date"`
+	CommentBody string    `json:"comment_body"`
 }
 
 func CommentDefault() Comment {
@@ -157,7 +397,7 @@ func CommentDefault() Comment {
 		Id:          0,
 		User:        UserDefault(),
 		Photo:       PhotoDefault(),
-		Date:        "",
+		Date:        time.Time{},
 		CommentBody: "",
 	}
 }
@@ -210,6 +450,11 @@ type Profile struct {
 	FollowingCount int     `json:"following_count"`
 	FollowStatus   bool    `json:"follow_status"`
 	BanStatus      bool    `json:"ban_status"`
+	MuteStatus     bool    `json:"mute_status"`
+	CloseFriend    bool    `json:"close_friend_status"`
+	Private        bool    `json:"private"`
+	FollowRequest  bool    `json:"follow_requested"`
+	NextCursor     uint32  `json:"next_cursor"`
 }
 
 func ProfileDefault() Profile {
@@ -223,6 +468,11 @@ func ProfileDefault() Profile {
 		FollowingCount: 0,
 		FollowStatus:   false,
 		BanStatus:      false,
+		MuteStatus:     false,
+		CloseFriend:    false,
+		Private:        false,
+		FollowRequest:  false,
+		NextCursor:     0,
 	}
 }
 
@@ -235,6 +485,11 @@ func ProfileFromDatabaseProfile(dbProfile database.DatabaseProfile) Profile {
 		FollowingCount: dbProfile.FollowingCount,
 		FollowStatus:   dbProfile.FollowStatus,
 		BanStatus:      dbProfile.BanStatus,
+		MuteStatus:     dbProfile.MuteStatus,
+		CloseFriend:    dbProfile.CloseFriend,
+		Private:        dbProfile.Private,
+		FollowRequest:  dbProfile.FollowRequest,
+		NextCursor:     dbProfile.NextCursor,
 	}
 }
 
@@ -247,6 +502,11 @@ func (profile *Profile) ProfileIntoDatabaseProfile() database.DatabaseProfile {
 		FollowingCount: profile.FollowingCount,
 		FollowStatus:   profile.FollowStatus,
 		BanStatus:      profile.BanStatus,
+		MuteStatus:     profile.MuteStatus,
+		CloseFriend:    profile.CloseFriend,
+		Private:        profile.Private,
+		FollowRequest:  profile.FollowRequest,
+		NextCursor:     profile.NextCursor,
 	}
 }
 
@@ -278,6 +538,120 @@ func (stream *Stream) CommentIntoDatabaseComment() database.DatabaseStream {
 	}
 }
 
+// StreamUpdates is the number of the photos of a stream newer than the one the client holds, and the id of the newest
+// one (0 if there are none)
+type StreamUpdates struct {
+	Count    int    `json:"count"`
+	NewestId uint32 `json:"newest_id"`
+}
+
+func StreamUpdatesFromDatabaseStreamUpdates(dbUpdates database.DatabaseStreamUpdates) StreamUpdates {
+	return StreamUpdates{
+		Count:    dbUpdates.Count,
+		NewestId: dbUpdates.NewestId,
+	}
+}
+
+type HashtagFeed struct {
+	Hashtag    string  `json:"hashtag"`
+	Photos     []Photo `json:"photos"`
+	NextCursor uint32  `json:"next_cursor"`
+}
+
+func HashtagFeedDefault() HashtagFeed {
+	emptyArray := make([]Photo, 0)
+
+	return HashtagFeed{
+		Hashtag:    "",
+		Photos:     emptyArray,
+		NextCursor: 0,
+	}
+}
+
+func HashtagFeedFromDatabaseHashtagFeed(dbFeed database.DatabaseHashtagFeed) HashtagFeed {
+	return HashtagFeed{
+		Hashtag:    dbFeed.Hashtag,
+		Photos:     PhotoArrayFromDatabasePhotoArray(dbFeed.Photos),
+		NextCursor: dbFeed.NextCursor,
+	}
+}
+
+type PlaceFeed struct {
+	Place      string  `json:"place"`
+	Photos     []Photo `json:"photos"`
+	NextCursor uint32  `json:"next_cursor"`
+}
+
+func PlaceFeedFromDatabasePlaceFeed(dbFeed database.DatabasePlaceFeed) PlaceFeed {
+	return PlaceFeed{
+		Place:      dbFeed.Place,
+		Photos:     PhotoArrayFromDatabasePhotoArray(dbFeed.Photos),
+		NextCursor: dbFeed.NextCursor,
+	}
+}
+
+type ExploreFeed struct {
+	Photos     []Photo `json:"photos"`
+	NextOffset int     `json:"next_offset"`
+}
+
+func ExploreFeedFromDatabaseExploreFeed(dbFeed database.DatabaseExploreFeed) ExploreFeed {
+	return ExploreFeed{
+		Photos:     PhotoArrayFromDatabasePhotoArray(dbFeed.Photos),
+		NextOffset: dbFeed.NextOffset,
+	}
+}
+
+type HashtagCount struct {
+	Hashtag string `json:"hashtag"`
+	Count   int    `json:"count"`
+}
+
+func HashtagCountFromDatabaseHashtagCount(dbHashtag database.DatabaseHashtagCount) HashtagCount {
+	return HashtagCount{
+		Hashtag: dbHashtag.Hashtag,
+		Count:   dbHashtag.Count,
+	}
+}
+
+func HashtagCountArrayFromDatabaseHashtagCountArray(array []database.DatabaseHashtagCount) []HashtagCount {
+	newArray := make([]HashtagCount, 0)
+
+	for _, element := range array {
+		newArray = append(newArray, HashtagCountFromDatabaseHashtagCount(element))
+	}
+
+	return newArray
+}
+
+type Trending struct {
+	Window   string         `json:"window"`
+	Photos   []Photo        `json:"photos"`
+	Hashtags []HashtagCount `json:"hashtags"`
+}
+
+func TrendingFromDatabaseTrending(dbTrending database.DatabaseTrending, window string) Trending {
+	return Trending{
+		Window:   window,
+		Photos:   PhotoArrayFromDatabasePhotoArray(dbTrending.Photos),
+		Hashtags: HashtagCountArrayFromDatabaseHashtagCountArray(dbTrending.Hashtags),
+	}
+}
+
+type SearchResult struct {
+	Users    []User         `json:"users"`
+	Hashtags []HashtagCount `json:"hashtags"`
+	Comments []Comment      `json:"comments"`
+}
+
+func SearchResultDefault() SearchResult {
+	return SearchResult{
+		Users:    make([]User, 0),
+		Hashtags: make([]HashtagCount, 0),
+		Comments: make([]Comment, 0),
+	}
+}
+
 type UserList struct {
 	Users []User `json:"users"`
 }
@@ -302,6 +676,52 @@ func (userList *UserList) UserListIntoDatabaseUserList() database.DatabaseUserLi
 	}
 }
 
+type Ban struct {
+	User      User       `json:"user"`
+	Reason    string     `json:"reason"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+func BanDefault() Ban {
+	return Ban{
+		User:      UserDefault(),
+		Reason:    "",
+		ExpiresAt: nil,
+	}
+}
+
+func BanFromDatabaseBan(dbBan database.DatabaseBan) Ban {
+	return Ban{
+		User:      UserFromDatabaseUser(dbBan.User),
+		Reason:    dbBan.Reason,
+		ExpiresAt: dbBan.ExpiresAt,
+	}
+}
+
+func (ban *Ban) BanIntoDatabaseBan() database.DatabaseBan {
+	return database.DatabaseBan{
+		User:      ban.User.UserIntoDatabaseUser(),
+		Reason:    ban.Reason,
+		ExpiresAt: ban.ExpiresAt,
+	}
+}
+
+type BanList struct {
+	Bans []Ban `json:"bans"`
+}
+
+func BanListFromDatabaseBanList(dbBanList database.DatabaseBanList) BanList {
+	bans := make([]Ban, 0)
+
+	for _, dbBan := range dbBanList.Bans {
+		bans = append(bans, BanFromDatabaseBan(dbBan))
+	}
+
+	return BanList{
+		Bans: bans,
+	}
+}
+
 type CommentList struct {
 	Comments []Comment `json:"comments"`
 }
@@ -325,3 +745,947 @@ func (commentList *CommentList) CommentListIntoDatabaseCommentList() database.Da
 		Comments: CommentArrayIntoDatabaseCommentArray(commentList.Comments),
 	}
 }
+
+// PhotoDetail is a photo together with the first page of its comments; the next page is `after` NextCursor, which is 0
+// if there are no more comments
+type PhotoDetail struct {
+	Photo      Photo     `json:"photo"`
+	Comments   []Comment `json:"comments"`
+	NextCursor uint32    `json:"next_cursor"`
+}
+
+func PhotoDetailDefault() PhotoDetail {
+	emptyArray := make([]Comment, 0)
+
+	return PhotoDetail{
+		Photo:      PhotoDefault(),
+		Comments:   emptyArray,
+		NextCursor: 0,
+	}
+}
+
+type Backup struct {
+	Path string    `json:"path"`
+	Date time.Time `json:"date"`
+}
+
+func BackupDefault() Backup {
+	return Backup{
+		Path: "",
+		Date: time.Time{},
+	}
+}
+
+type AuditEntry struct {
+	Id      uint32    `json:"id"`
+	Actor   uint32    `json:"actor"`
+	Action  string    `json:"action"`
+	Target  uint32    `json:"target"`
+	Details string    `json:"details"`
+	Date    time.Time `json:"date"`
+}
+
+func AuditEntryFromDatabaseAuditEntry(dbAuditEntry database.DatabaseAuditEntry) AuditEntry {
+	return AuditEntry{
+		Id:      dbAuditEntry.Id,
+		Actor:   dbAuditEntry.Actor,
+		Action:  dbAuditEntry.Action,
+		Target:  dbAuditEntry.Target,
+		Details: dbAuditEntry.Details,
+		Date:    dbAuditEntry.Date,
+	}
+}
+
+type AuditLog struct {
+	Entries []AuditEntry `json:"entries"`
+}
+
+func AuditEntryArrayFromDatabaseAuditEntryArray(array []database.DatabaseAuditEntry) []AuditEntry {
+	newArray := make([]AuditEntry, 0)
+
+	for _, element := range array {
+		newArray = append(newArray, AuditEntryFromDatabaseAuditEntry(element))
+	}
+
+	return newArray
+}
+
+func AuditLogFromDatabaseAuditLog(dbAuditLog database.DatabaseAuditLog) AuditLog {
+	return AuditLog{
+		Entries: AuditEntryArrayFromDatabaseAuditEntryArray(dbAuditLog.Entries),
+	}
+}
+
+type AdminUser struct {
+	User          User       `json:"user"`
+	Email         string     `json:"email,omitempty"`
+	EmailVerified bool       `json:"email_verified"`
+	DeactivatedAt *time.Time `json:"deactivated_at,omitempty"`
+	SuspendedAt   *time.Time `json:"suspended_at,omitempty"`
+	ShadowBanned  bool       `json:"shadow_banned"`
+}
+
+func AdminUserFromDatabaseAdminUser(dbAdminUser database.DatabaseAdminUser) AdminUser {
+	return AdminUser{
+		User:          UserFromDatabaseUser(dbAdminUser.User),
+		Email:         dbAdminUser.Email,
+		EmailVerified: dbAdminUser.EmailVerified,
+		DeactivatedAt: dbAdminUser.DeactivatedAt,
+		SuspendedAt:   dbAdminUser.SuspendedAt,
+		ShadowBanned:  dbAdminUser.ShadowBanned,
+	}
+}
+
+type AdminUserList struct {
+	Users      []AdminUser `json:"users"`
+	NextCursor uint32      `json:"next_cursor"`
+}
+
+func AdminUserListFromDatabaseAdminUserList(dbAdminUserList database.DatabaseAdminUserList) AdminUserList {
+	users := make([]AdminUser, 0)
+
+	for _, element := range dbAdminUserList.Users {
+		users = append(users, AdminUserFromDatabaseAdminUser(element))
+	}
+
+	return AdminUserList{
+		Users:      users,
+		NextCursor: dbAdminUserList.NextCursor,
+	}
+}
+
+type FlaggedPhotoList struct {
+	Photos     []Photo `json:"photos"`
+	NextCursor uint32  `json:"next_cursor"`
+}
+
+func FlaggedPhotoListFromDatabaseFlaggedPhotoList(dbFlaggedPhotoList database.DatabaseFlaggedPhotoList) FlaggedPhotoList {
+	return FlaggedPhotoList{
+		Photos:     PhotoArrayFromDatabasePhotoArray(dbFlaggedPhotoList.Photos),
+		NextCursor: dbFlaggedPhotoList.NextCursor,
+	}
+}
+
+type BlockedTerm struct {
+	Id      uint32 `json:"id"`
+	Term    string `json:"term"`
+	Pattern bool   `json:"pattern"`
+}
+
+func BlockedTermDefault() BlockedTerm {
+	return BlockedTerm{
+		Id:      0,
+		Term:    "",
+		Pattern: false,
+	}
+}
+
+func BlockedTermFromDatabaseBlockedTerm(dbBlockedTerm database.DatabaseBlockedTerm) BlockedTerm {
+	return BlockedTerm{
+		Id:      dbBlockedTerm.Id,
+		Term:    dbBlockedTerm.Term,
+		Pattern: dbBlockedTerm.Pattern,
+	}
+}
+
+func (blockedTerm *BlockedTerm) BlockedTermIntoDatabaseBlockedTerm() database.DatabaseBlockedTerm {
+	return database.DatabaseBlockedTerm{
+		Id:      blockedTerm.Id,
+		Term:    blockedTerm.Term,
+		Pattern: blockedTerm.Pattern,
+	}
+}
+
+type BlockedTermList struct {
+	Terms []BlockedTerm `json:"terms"`
+}
+
+func BlockedTermListFromDatabaseBlockedTermArray(array []database.DatabaseBlockedTerm) BlockedTermList {
+	terms := make([]BlockedTerm, 0)
+
+	for _, element := range array {
+		terms = append(terms, BlockedTermFromDatabaseBlockedTerm(element))
+	}
+
+	return BlockedTermList{
+		Terms: terms,
+	}
+}
+
+type ReservedName struct {
+	Id        uint32 `json:"id"`
+	Name      string `json:"name"`
+	Contained bool   `json:"contained"`
+}
+
+func ReservedNameDefault() ReservedName {
+	return ReservedName{
+		Id:        0,
+		Name:      "",
+		Contained: false,
+	}
+}
+
+func ReservedNameFromDatabaseReservedName(dbReservedName database.DatabaseReservedName) ReservedName {
+	return ReservedName{
+		Id:        dbReservedName.Id,
+		Name:      dbReservedName.Name,
+		Contained: dbReservedName.Contained,
+	}
+}
+
+func (reservedName *ReservedName) ReservedNameIntoDatabaseReservedName() database.DatabaseReservedName {
+	return database.DatabaseReservedName{
+		Id:        reservedName.Id,
+		Name:      reservedName.Name,
+		Contained: reservedName.Contained,
+	}
+}
+
+type ReservedNameList struct {
+	Names []ReservedName `json:"names"`
+}
+
+func ReservedNameListFromDatabaseReservedNameArray(array []database.DatabaseReservedName) ReservedNameList {
+	names := make([]ReservedName, 0)
+
+	for _, element := range array {
+		names = append(names, ReservedNameFromDatabaseReservedName(element))
+	}
+
+	return ReservedNameList{
+		Names: names,
+	}
+}
+
+type Erasure struct {
+	Id          uint32     `json:"id"`
+	User        uint32     `json:"user_id"`
+	RequestedAt time.Time  `json:"requested_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+}
+
+func ErasureFromDatabaseErasure(dbErasure database.DatabaseErasure) Erasure {
+	return Erasure{
+		Id:          dbErasure.Id,
+		User:        dbErasure.User,
+		RequestedAt: dbErasure.RequestedAt,
+		CompletedAt: dbErasure.CompletedAt,
+	}
+}
+
+type ErasureList struct {
+	Erasures   []Erasure `json:"erasures"`
+	NextCursor uint32    `json:"next_cursor"`
+}
+
+func ErasureListFromDatabaseErasureList(dbErasureList database.DatabaseErasureList) ErasureList {
+	erasures := make([]Erasure, 0)
+
+	for _, element := range dbErasureList.Erasures {
+		erasures = append(erasures, ErasureFromDatabaseErasure(element))
+	}
+
+	return ErasureList{
+		Erasures:   erasures,
+		NextCursor: dbErasureList.NextCursor,
+	}
+}
+
+type HeldComment struct {
+	Id          uint32    `json:"id"`
+	User        User      `json:"user"`
+	Photo       Photo     `json:"photo"`
+	Date        time.Time `json:"date"`
+	CommentBody string    `json:"comment_body"`
+	Term        string    `json:"term,omitempty"`
+}
+
+func HeldCommentFromDatabaseHeldComment(dbHeldComment database.DatabaseHeldComment) HeldComment {
+	return HeldComment{
+		Id:          dbHeldComment.Id,
+		User:        UserFromDatabaseUser(dbHeldComment.User),
+		Photo:       PhotoFromDatabasePhoto(dbHeldComment.Photo),
+		Date:        dbHeldComment.Date,
+		CommentBody: dbHeldComment.CommentBody,
+		Term:        dbHeldComment.Term,
+	}
+}
+
+type HeldCommentList struct {
+	Comments   []HeldComment `json:"comments"`
+	NextCursor uint32        `json:"next_cursor"`
+}
+
+func HeldCommentListFromDatabaseHeldCommentList(dbHeldCommentList database.DatabaseHeldCommentList) HeldCommentList {
+	comments := make([]HeldComment, 0)
+
+	for _, element := range dbHeldCommentList.Comments {
+		comments = append(comments, HeldCommentFromDatabaseHeldComment(element))
+	}
+
+	return HeldCommentList{
+		Comments:   comments,
+		NextCursor: dbHeldCommentList.NextCursor,
+	}
+}
+
+type LikeList struct {
+	Users []User `json:"users"`
+	Total int    `json:"total"`
+}
+
+func LikeListFromDatabaseLikeList(dbLikeList database.DatabaseLikeList) LikeList {
+	return LikeList{
+		Users: UserArrayFromDatabaseUserArray(dbLikeList.Users),
+		Total: dbLikeList.Total,
+	}
+}
+
+type Reaction struct {
+	User User   `json:"user"`
+	Type string `json:"type"`
+}
+
+func ReactionDefault() Reaction {
+	return Reaction{
+		User: UserDefault(),
+		Type: "",
+	}
+}
+
+func ReactionFromDatabaseReaction(dbReaction database.DatabaseReaction) Reaction {
+	return Reaction{
+		User: UserFromDatabaseUser(dbReaction.User),
+		Type: dbReaction.Type,
+	}
+}
+
+type ReactionList struct {
+	Reactions []Reaction `json:"reactions"`
+	Total     int        `json:"total"`
+}
+
+func ReactionListFromDatabaseReactionList(dbReactionList database.DatabaseReactionList) ReactionList {
+	reactions := make([]Reaction, 0)
+
+	for _, dbReaction := range dbReactionList.Reactions {
+		reactions = append(reactions, ReactionFromDatabaseReaction(dbReaction))
+	}
+
+	return ReactionList{
+		Reactions: reactions,
+		Total:     dbReactionList.Total,
+	}
+}
+
+type Album struct {
+	Id         uint32    `json:"id"`
+	User       User      `json:"user"`
+	Name       string    `json:"name"`
+	Date       time.Time `json:"date"`
+	Photos     []Photo   `json:"photos"`
+	PhotoCount int       `json:"photo_count"`
+	CoverUrl   string    `json:"cover_url"`
+}
+
+func AlbumDefault() Album {
+	emptyArray := make([]Photo, 0)
+
+	return Album{
+		Id:         0,
+		User:       UserDefault(),
+		Name:       "",
+		Date:       time.Time{},
+		Photos:     emptyArray,
+		PhotoCount: 0,
+		CoverUrl:   "",
+	}
+}
+
+func AlbumFromDatabaseAlbum(dbAlbum database.DatabaseAlbum) Album {
+	return Album{
+		Id:         dbAlbum.Id,
+		User:       UserFromDatabaseUser(dbAlbum.User),
+		Name:       dbAlbum.Name,
+		Date:       dbAlbum.Date,
+		Photos:     PhotoArrayFromDatabasePhotoArray(dbAlbum.Photos),
+		PhotoCount: dbAlbum.PhotoCount,
+		CoverUrl:   dbAlbum.CoverUrl,
+	}
+}
+
+func (album *Album) AlbumIntoDatabaseAlbum() database.DatabaseAlbum {
+	return database.DatabaseAlbum{
+		Id:         album.Id,
+		User:       album.User.UserIntoDatabaseUser(),
+		Name:       album.Name,
+		Date:       album.Date,
+		Photos:     PhotoArrayIntoDatabasePhotoArray(album.Photos),
+		PhotoCount: album.PhotoCount,
+		CoverUrl:   album.CoverUrl,
+	}
+}
+
+type AlbumList struct {
+	Albums []Album `json:"albums"`
+}
+
+func AlbumListFromDatabaseAlbumList(dbAlbumList database.DatabaseAlbumList) AlbumList {
+	albums := make([]Album, 0)
+
+	for _, dbAlbum := range dbAlbumList.Albums {
+		albums = append(albums, AlbumFromDatabaseAlbum(dbAlbum))
+	}
+
+	return AlbumList{
+		Albums: albums,
+	}
+}
+
+// AlbumPhotos is the ordered list of the ids of the photos of an album, as sent to replace them
+type AlbumPhotos struct {
+	Photos []uint32 `json:"photos"`
+}
+
+func AlbumPhotosDefault() AlbumPhotos {
+	emptyArray := make([]uint32, 0)
+
+	return AlbumPhotos{
+		Photos: emptyArray,
+	}
+}
+
+type Story struct {
+	Id        uint32    `json:"id"`
+	User      User      `json:"user"`
+	Url       string    `json:"url"`
+	Date      time.Time `json:"date"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func StoryDefault() Story {
+	return Story{
+		Id:        0,
+		User:      UserDefault(),
+		Url:       "",
+		Date:      time.Time{},
+		ExpiresAt: time.Time{},
+	}
+}
+
+func StoryFromDatabaseStory(dbStory database.DatabaseStory) Story {
+	return Story{
+		Id:        dbStory.Id,
+		User:      UserFromDatabaseUser(dbStory.User),
+		Url:       dbStory.Url,
+		Date:      dbStory.Date,
+		ExpiresAt: dbStory.ExpiresAt,
+	}
+}
+
+func (story *Story) StoryIntoDatabaseStory() database.DatabaseStory {
+	return database.DatabaseStory{
+		Id:        story.Id,
+		User:      story.User.UserIntoDatabaseUser(),
+		Url:       story.Url,
+		Date:      story.Date,
+		ExpiresAt: story.ExpiresAt,
+	}
+}
+
+type StoryList struct {
+	Stories []Story `json:"stories"`
+}
+
+func StoryListFromDatabaseStoryList(dbStoryList database.DatabaseStoryList) StoryList {
+	stories := make([]Story, 0)
+
+	for _, dbStory := range dbStoryList.Stories {
+		stories = append(stories, StoryFromDatabaseStory(dbStory))
+	}
+
+	return StoryList{
+		Stories: stories,
+	}
+}
+
+// StoryTrayEntry is a followed user having unexpired stories, with how many they are and when the latest was posted
+type StoryTrayEntry struct {
+	User       User      `json:"user"`
+	StoryCount int       `json:"story_count"`
+	LatestDate time.Time `json:"latest_date"`
+}
+
+type StoryTray struct {
+	Users []StoryTrayEntry `json:"users"`
+}
+
+func StoryTrayFromDatabaseStoryTray(dbStoryTray database.DatabaseStoryTray) StoryTray {
+	users := make([]StoryTrayEntry, 0)
+
+	for _, dbEntry := range dbStoryTray.Users {
+		users = append(users, StoryTrayEntry{
+			User:       UserFromDatabaseUser(dbEntry.User),
+			StoryCount: dbEntry.StoryCount,
+			LatestDate: dbEntry.LatestDate,
+		})
+	}
+
+	return StoryTray{
+		Users: users,
+	}
+}
+
+type Notification struct {
+	Id    uint32 `json:"id"`
+	Actor User   `json:"actor"`
+	Type  string `json:"type"`
+	// Photo is the liked photo, only set for the likes
+	Photo *Photo `json:"photo,omitempty"`
+	// Comment is the comment, together with its photo, only set for the comments and the mentions
+	Comment *Comment  `json:"comment,omitempty"`
+	Date    time.Time `json:"date"`
+	Read    bool      `json:"read"`
+}
+
+func NotificationFromDatabaseNotification(dbNotification database.DatabaseNotification) Notification {
+	notification := Notification{
+		Id:    dbNotification.Id,
+		Actor: UserFromDatabaseUser(dbNotification.Actor),
+		Type:  dbNotification.Type,
+		Date:  dbNotification.Date,
+		Read:  dbNotification.Read,
+	}
+
+	if dbNotification.Photo != nil {
+		photo := PhotoFromDatabasePhoto(*dbNotification.Photo)
+		notification.Photo = &photo
+	}
+
+	if dbNotification.Comment != nil {
+		comment := CommentFromDatabaseComment(*dbNotification.Comment)
+		notification.Comment = &comment
+	}
+
+	return notification
+}
+
+type NotificationList struct {
+	Notifications []Notification `json:"notifications"`
+	UnreadCount   int            `json:"unread_count"`
+	NextCursor    uint32         `json:"next_cursor"`
+}
+
+func NotificationListFromDatabaseNotificationList(dbNotificationList database.DatabaseNotificationList) NotificationList {
+	notifications := make([]Notification, 0)
+
+	for _, dbNotification := range dbNotificationList.Notifications {
+		notifications = append(notifications, NotificationFromDatabaseNotification(dbNotification))
+	}
+
+	return NotificationList{
+		Notifications: notifications,
+		UnreadCount:   dbNotificationList.UnreadCount,
+		NextCursor:    dbNotificationList.NextCursor,
+	}
+}
+
+// UnreadNotifications is the number of unread notifications of a user
+type UnreadNotifications struct {
+	UnreadCount int `json:"unread_count"`
+}
+
+// NotificationPreference tells on which channels a user receives the notifications of a type: in the app (the lists
+// and the event stream), as push notifications and in the email digests
+type NotificationPreference struct {
+	InApp bool `json:"in_app"`
+	Push  bool `json:"push"`
+	Email bool `json:"email"`
+}
+
+func NotificationPreferenceDefault() NotificationPreference {
+	return NotificationPreference{
+		InApp: true,
+		Push:  true,
+		Email: true,
+	}
+}
+
+// UnmarshalJSON decodes the channels of the preference, the missing ones being turned on
+func (preference *NotificationPreference) UnmarshalJSON(data []byte) error {
+	// channels has the fields of NotificationPreference, without this method
+	type channels NotificationPreference
+
+	decoded := channels(NotificationPreferenceDefault())
+
+	err := json.Unmarshal(data, &decoded)
+
+	if err != nil {
+		return err
+	}
+
+	*preference = NotificationPreference(decoded)
+
+	return nil
+}
+
+// NotificationPreferences maps each type of notification to the channels the user receives it on
+type NotificationPreferences map[string]NotificationPreference
+
+func NotificationPreferencesFromDatabaseNotificationPreferences(dbPreferences map[string]database.DatabaseNotificationPreference) NotificationPreferences {
+	preferences := make(NotificationPreferences)
+
+	for notificationType, dbPreference := range dbPreferences {
+		preferences[notificationType] = NotificationPreference{
+			InApp: dbPreference.InApp,
+			Push:  dbPreference.Push,
+			Email: dbPreference.Email,
+		}
+	}
+
+	return preferences
+}
+
+func (preferences NotificationPreferences) NotificationPreferencesIntoDatabaseNotificationPreferences() map[string]database.DatabaseNotificationPreference {
+	dbPreferences := make(map[string]database.DatabaseNotificationPreference)
+
+	for notificationType, preference := range preferences {
+		dbPreferences[notificationType] = database.DatabaseNotificationPreference{
+			InApp: preference.InApp,
+			Push:  preference.Push,
+			Email: preference.Email,
+		}
+	}
+
+	return dbPreferences
+}
+
+// ReadNotifications is the list of the ids of the notifications to be marked as read, every notification being marked
+// if it is missing
+type ReadNotifications struct {
+	Notifications []uint32 `json:"notifications"`
+}
+
+type Device struct {
+	Id       uint32    `json:"id"`
+	User     User      `json:"user"`
+	Platform string    `json:"platform"`
+	Token    string    `json:"token"`
+	Date     time.Time `json:"date"`
+}
+
+func DeviceDefault() Device {
+	return Device{
+		Id:       0,
+		User:     UserDefault(),
+		Platform: "",
+		Token:    "",
+		Date:     time.Time{},
+	}
+}
+
+func DeviceFromDatabaseDevice(dbDevice database.DatabaseDevice) Device {
+	return Device{
+		Id:       dbDevice.Id,
+		User:     UserFromDatabaseUser(dbDevice.User),
+		Platform: dbDevice.Platform,
+		Token:    dbDevice.Token,
+		Date:     dbDevice.Date,
+	}
+}
+
+func (device *Device) DeviceIntoDatabaseDevice() database.DatabaseDevice {
+	return database.DatabaseDevice{
+		Id:       device.Id,
+		User:     device.User.UserIntoDatabaseUser(),
+		Platform: device.Platform,
+		Token:    device.Token,
+		Date:     device.Date,
+	}
+}
+
+// APIKey is a key minted by a user for their integrations. The key itself is returned only when it is minted, since the
+// backend keeps its hash alone; RateLimit is how many requests per minute it may send.
+type APIKey struct {
+	Id         uint32     `json:"id"`
+	Name       string     `json:"name"`
+	Scope      string     `json:"scope"`
+	RateLimit  int        `json:"rate_limit"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	Key        string     `json:"key,omitempty"`
+}
+
+func APIKeyDefault() APIKey {
+	return APIKey{
+		Id:         0,
+		Name:       "",
+		Scope:      "",
+		RateLimit:  0,
+		CreatedAt:  time.Time{},
+		LastUsedAt: nil,
+		Key:        "",
+	}
+}
+
+func APIKeyFromDatabaseAPIKey(dbAPIKey database.DatabaseAPIKey) APIKey {
+	return APIKey{
+		Id:         dbAPIKey.Id,
+		Name:       dbAPIKey.Name,
+		Scope:      dbAPIKey.Scope,
+		RateLimit:  dbAPIKey.RateLimit,
+		CreatedAt:  dbAPIKey.CreatedAt,
+		LastUsedAt: dbAPIKey.LastUsedAt,
+		Key:        "",
+	}
+}
+
+type APIKeyList struct {
+	Keys []APIKey `json:"keys"`
+}
+
+func APIKeyListFromDatabaseAPIKeys(dbAPIKeys []database.DatabaseAPIKey) APIKeyList {
+	keys := make([]APIKey, 0)
+
+	for _, dbAPIKey := range dbAPIKeys {
+		keys = append(keys, APIKeyFromDatabaseAPIKey(dbAPIKey))
+	}
+
+	return APIKeyList{
+		Keys: keys,
+	}
+}
+
+// ErrorResponse is the body of every response reporting an error: a machine-readable code for the clients to branch
+// on, a message for the humans, the id of the request to be found in the logs and, for some errors, the details telling
+// more about them
+type ErrorResponse struct {
+	Code      string      `json:"code"`
+	Message   string      `json:"message"`
+	RequestId string      `json:"request_id,omitempty"`
+	Details   interface{} `json:"details,omitempty"`
+}
+
+type Webhook struct {
+	Id  uint32 `json:"id"`
+	Url string `json:"url"`
+	// Secret is only given when the webhook is registered, and never returned
+	Secret string    `json:"secret,omitempty"`
+	Events []string  `json:"events"`
+	Date   time.Time `json:"date"`
+}
+
+func WebhookDefault() Webhook {
+	return Webhook{
+		Id:     0,
+		Url:    "",
+		Secret: "",
+		Events: make([]string, 0),
+		Date:   time.Time{},
+	}
+}
+
+func WebhookFromDatabaseWebhook(dbWebhook database.DatabaseWebhook) Webhook {
+	return Webhook{
+		Id:     dbWebhook.Id,
+		Url:    dbWebhook.Url,
+		Events: dbWebhook.Events,
+		Date:   dbWebhook.Date,
+	}
+}
+
+func (webhook *Webhook) WebhookIntoDatabaseWebhook() database.DatabaseWebhook {
+	return database.DatabaseWebhook{
+		Id:     webhook.Id,
+		Url:    webhook.Url,
+		Secret: webhook.Secret,
+		Events: webhook.Events,
+		Date:   webhook.Date,
+	}
+}
+
+type WebhookList struct {
+	Webhooks []Webhook `json:"webhooks"`
+}
+
+func WebhookListFromDatabaseWebhookArray(array []database.DatabaseWebhook) WebhookList {
+	webhooks := make([]Webhook, 0)
+
+	for _, element := range array {
+		webhooks = append(webhooks, WebhookFromDatabaseWebhook(element))
+	}
+
+	return WebhookList{
+		Webhooks: webhooks,
+	}
+}
+
+// the states of the deliveries of the events to the webhooks
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+type WebhookDelivery struct {
+	Id      uint32          `json:"id"`
+	Event   string          `json:"event"`
+	Payload json.RawMessage `json:"payload"`
+	Date    time.Time       `json:"date"`
+	// Status is DeliveryPending until the delivery succeeds or is given up
+	Status        string     `json:"status"`
+	Attempts      int        `json:"attempts"`
+	NextAttemptAt *time.Time `json:"next_attempt_at,omitempty"`
+	DeliveredAt   *time.Time `json:"delivered_at,omitempty"`
+	// StatusCode and Error tell the outcome of the last attempt, if any
+	StatusCode int    `json:"status_code,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+func WebhookDeliveryFromDatabaseWebhookDelivery(dbDelivery database.DatabaseWebhookDelivery) WebhookDelivery {
+	status := DeliveryFailed
+
+	switch {
+	case dbDelivery.DeliveredAt != nil:
+		status = DeliveryDelivered
+	case dbDelivery.NextAttemptAt != nil:
+		status = DeliveryPending
+	}
+
+	return WebhookDelivery{
+		Id:            dbDelivery.Id,
+		Event:         dbDelivery.Event,
+		Payload:       json.RawMessage(dbDelivery.Payload),
+		Date:          dbDelivery.Date,
+		Status:        status,
+		Attempts:      dbDelivery.Attempts,
+		NextAttemptAt: dbDelivery.NextAttemptAt,
+		DeliveredAt:   dbDelivery.DeliveredAt,
+		StatusCode:    dbDelivery.StatusCode,
+		Error:         dbDelivery.Error,
+	}
+}
+
+type WebhookDeliveryList struct {
+	Deliveries []WebhookDelivery `json:"deliveries"`
+}
+
+func WebhookDeliveryListFromDatabaseWebhookDeliveryList(dbDeliveryList database.DatabaseWebhookDeliveryList) WebhookDeliveryList {
+	deliveries := make([]WebhookDelivery, 0)
+
+	for _, element := range dbDeliveryList.Deliveries {
+		deliveries = append(deliveries, WebhookDeliveryFromDatabaseWebhookDelivery(element))
+	}
+
+	return WebhookDeliveryList{
+		Deliveries: deliveries,
+	}
+}
+
+// BatchRequest is one of the requests of a batch, sent to a route of the API as if on its own
+type BatchRequest struct {
+	Method  string            `json:"method"`
+	Path    string            `json:"path"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    json.RawMessage   `json:"body,omitempty"`
+}
+
+// BatchResponse is the response to one of the requests of a batch: its body is embedded as is if it is JSON, and as a
+// string otherwise
+type BatchResponse struct {
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers"`
+	Body    json.RawMessage   `json:"body,omitempty"`
+}
+
+// Archive is the export archive of an account: its photos, from the oldest, each with its image and the comments under
+// it, which can be imported back into another account
+type Archive struct {
+	Version    int            `json:"version"`
+	Username   string         `json:"username"`
+	ExportedAt time.Time      `json:"exported_at"`
+	Photos     []ArchivePhoto `json:"photos"`
+}
+
+func ArchiveDefault() Archive {
+	return Archive{
+		Version:    archiveVersion,
+		Username:   "",
+		ExportedAt: time.Time{},
+		Photos:     make([]ArchivePhoto, 0),
+	}
+}
+
+// ArchivePhoto is a photo of an export archive, its image being encoded in base64 in Content
+type ArchivePhoto struct {
+	Id           uint32           `json:"id"`
+	Date         time.Time        `json:"date"`
+	ContentType  string           `json:"content_type"`
+	Content      []byte           `json:"content"`
+	Archived     bool             `json:"archived"`
+	CloseFriends bool             `json:"close_friends"`
+	Latitude     *float64         `json:"latitude,omitempty"`
+	Longitude    *float64         `json:"longitude,omitempty"`
+	Place        string           `json:"place,omitempty"`
+	AltText      string           `json:"alt_text"`
+	Comments     []ArchiveComment `json:"comments"`
+}
+
+func ArchivePhotoFromDatabaseExportPhoto(dbExportPhoto database.DatabaseExportPhoto, content []byte, contentType string) ArchivePhoto {
+	comments := make([]ArchiveComment, 0)
+
+	for _, element := range dbExportPhoto.Comments {
+		comments = append(comments, ArchiveCommentFromDatabaseComment(element))
+	}
+
+	return ArchivePhoto{
+		Id:           dbExportPhoto.Photo.Id,
+		Date:         dbExportPhoto.Photo.Date,
+		ContentType:  contentType,
+		Content:      content,
+		Archived:     dbExportPhoto.Photo.Archived,
+		CloseFriends: dbExportPhoto.Photo.CloseFriends,
+		Latitude:     dbExportPhoto.Photo.Latitude,
+		Longitude:    dbExportPhoto.Photo.Longitude,
+		Place:        dbExportPhoto.Photo.Place,
+		AltText:      dbExportPhoto.Photo.AltText,
+		Comments:     comments,
+	}
+}
+
+// ArchiveComment is a comment of an export archive, its author being named by their username
+type ArchiveComment struct {
+	Id          uint32    `json:"id"`
+	Author      string    `json:"author"`
+	Date        time.Time `json:"date"`
+	CommentBody string    `json:"comment_body"`
+}
+
+func ArchiveCommentFromDatabaseComment(dbComment database.DatabaseComment) ArchiveComment {
+	return ArchiveComment{
+		Id:          dbComment.Id,
+		Author:      dbComment.User.Username,
+		Date:        dbComment.Date,
+		CommentBody: dbComment.CommentBody,
+	}
+}
+
+func (comment *ArchiveComment) ArchiveCommentIntoDatabaseComment() database.DatabaseComment {
+	dbComment := database.DatabaseCommentDefault()
+
+	dbComment.Date = comment.Date.UTC().Truncate(time.Second)
+	dbComment.CommentBody = comment.CommentBody
+
+	return dbComment
+}
+
+// ImportResult counts what an import of an export archive did: the photos it imported, the ones imported by an earlier
+// attempt and the ones rejected for their image or their fields, and the comments it imported and left out
+type ImportResult struct {
+	Imported        int `json:"imported"`
+	AlreadyImported int `json:"already_imported"`
+	Rejected        int `json:"rejected"`
+	Comments        int `json:"comments"`
+	SkippedComments int `json:"skipped_comments"`
+}
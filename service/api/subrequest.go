@@ -0,0 +1,96 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/api/reqcontext"
+)
+
+// subresponse records the response to a subrequest
+type subresponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (res *subresponse) Header() http.Header {
+	return res.header
+}
+
+func (res *subresponse) WriteHeader(status int) {
+	if res.status == 0 {
+		res.status = status
+	}
+}
+
+func (res *subresponse) Write(b []byte) (int, error) {
+	res.WriteHeader(http.StatusOK)
+
+	return res.body.Write(b)
+}
+
+// ok reports whether the subrequest succeeded
+func (res *subresponse) ok() bool {
+	return res.status >= 200 && res.status < 300
+}
+
+// error returns the error the subrequest failed with, as reported by the body of its response
+func (res *subresponse) error() ErrorResponse {
+	var response ErrorResponse
+
+	if json.Unmarshal(res.body.Bytes(), &response) != nil || response.Code == "" {
+		_, response.Code = errorStatus(nil, res.status)
+		response.Message = http.StatusText(res.status)
+	}
+
+	return response
+}
+
+// subrequest serves a request to a route of the API on behalf of the client of `r`, with the same credentials and the
+// same request id, so that it is checked, answered and logged exactly as if the client sent it. The JSON body, if not
+// nil, is sent as such, together with the headers given, if any.
+func (rt *_router) subrequest(ctx reqcontext.RequestContext, r *http.Request, method string, path string, header http.Header, body interface{}) (*subresponse, error) {
+	var b []byte
+
+	if body != nil {
+		var err error
+
+		b, err = json.Marshal(body)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	req, err := http.NewRequestWithContext(r.Context(), method, path, bytes.NewReader(b))
+
+	if err != nil {
+		return nil, err
+	}
+
+	for name, values := range header {
+		req.Header[name] = values
+	}
+
+	req.RemoteAddr = r.RemoteAddr
+	req.Header.Set(requestIdHeader, ctx.ReqUUID.String())
+
+	// the credentials are always the ones of the client
+	req.Header.Del("Authorization")
+
+	if authorization := r.Header.Get("Authorization"); authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	res := &subresponse{header: make(http.Header)}
+
+	rt.router.ServeHTTP(res, req)
+
+	return res, nil
+}
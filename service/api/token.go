@@ -0,0 +1,127 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/auth"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// tokenHeader is the header of every token, signed with HMAC-SHA256
+var tokenHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+// tokenIssuer is the issuer of the tokens, checked together with their signature
+const tokenIssuer = "wasaphoto"
+
+// issueToken returns a JSON Web Token authenticating the user `userId` from `now` until it expires, together with its
+// expiration
+func (rt *_router) issueToken(userId uint32, now time.Time) (string, time.Time, error) {
+	expiresAt := now.Add(rt.tokenLifetime).Truncate(time.Second)
+
+	tokenId := make([]byte, 16)
+
+	_, err := rand.Read(tokenId)
+
+	if err != nil {
+		return "", expiresAt, err
+	}
+
+	// the claims are the id of the authenticated user as the subject, when the token was issued and
+	// expires, and a random id telling apart the tokens issued in the same second
+	claims, err := json.Marshal(auth.Claims{
+		Id:        base64.RawURLEncoding.EncodeToString(tokenId),
+		Issuer:    tokenIssuer,
+		Subject:   strconv.FormatUint(uint64(userId), 10),
+		IssuedAt:  now.Unix(),
+		ExpiresAt: expiresAt.Unix(),
+	})
+
+	if err != nil {
+		return "", expiresAt, err
+	}
+
+	signingInput := tokenHeader + "." + base64.RawURLEncoding.EncodeToString(claims)
+
+	return signingInput + "." + rt.signToken(signingInput), expiresAt, nil
+}
+
+// verifyToken checks the signature and the claims of the token at `now`, returning the id of the user it
+// authenticates; any token which was not issued by issueToken, or has expired, is rejected with ErrInvalidToken
+func (rt *_router) verifyToken(token string, now time.Time) (uint32, error) {
+	jwt, err := auth.ParseJWT(token)
+
+	// the header is fixed, hence the tokens claiming
+	// another algorithm are rejected right away
+	if err != nil || !strings.HasPrefix(token, tokenHeader+".") {
+		return 0, ErrInvalidToken
+	}
+
+	if !hmac.Equal(rt.tokenMAC(jwt.SigningInput), jwt.Signature) {
+		return 0, ErrInvalidToken
+	}
+
+	var claims auth.Claims
+
+	err = jwt.Claims(&claims)
+
+	if err != nil || claims.Verify(tokenIssuer, now, 0) != nil {
+		return 0, ErrInvalidToken
+	}
+
+	userId, err := strconv.ParseUint(claims.Subject, 10, 32)
+
+	if err != nil || userId == 0 {
+		return 0, ErrInvalidToken
+	}
+
+	return uint32(userId), nil
+}
+
+// signToken returns the encoded signature of the header and the claims of a token
+func (rt *_router) signToken(signingInput string) string {
+	return base64.RawURLEncoding.EncodeToString(rt.tokenMAC(signingInput))
+}
+
+// tokenMAC returns the signature of the header and the claims of a token
+func (rt *_router) tokenMAC(signingInput string) []byte {
+	mac := hmac.New(sha256.New, rt.tokenSecret)
+	mac.Write([]byte(signingInput))
+
+	return mac.Sum(nil)
+}
+
+// signClaims returns the claims encoded and signed by the backend for `purpose`, so that the clients can hold them
+// without the backend storing them; the purpose keeps the claims signed for one use from being accepted for another
+func (rt *_router) signClaims(purpose string, claims interface{}) (string, error) {
+	content, err := json.Marshal(claims)
+
+	if err != nil {
+		return "", err
+	}
+
+	payload := base64.RawURLEncoding.EncodeToString(content)
+
+	return payload + "." + rt.signToken(purpose+":"+payload), nil
+}
+
+// verifyClaims decodes into `claims` the claims signed by signClaims for `purpose`, returning whether they were
+func (rt *_router) verifyClaims(purpose string, signed string, claims interface{}) bool {
+	payload, signature, ok := strings.Cut(signed, ".")
+
+	if !ok || !hmac.Equal([]byte(signature), []byte(rt.signToken(purpose+":"+payload))) {
+		return false
+	}
+
+	content, err := base64.RawURLEncoding.DecodeString(payload)
+
+	if err != nil {
+		return false
+	}
+
+	return json.Unmarshal(content, claims) == nil
+}
@@ -0,0 +1,83 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/api/reqcontext"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/tracing"
+	"github.com/julienschmidt/httprouter"
+)
+
+// routeKey is the key of the route matched by a request in its context
+type routeKey struct{}
+
+// withRoute returns the handle of the route `route` (eg. `/v1/user/:uname/stream`), which tells the route to the
+// handlers through the context of the request, as the router does not
+func withRoute(handle httprouter.Handle, route string) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		handle(w, r.WithContext(context.WithValue(r.Context(), routeKey{}, route)), ps)
+	}
+}
+
+// routeOf returns the route matched by the request, or "" if it is not known
+func routeOf(r *http.Request) string {
+	route, _ := r.Context().Value(routeKey{}).(string)
+
+	return route
+}
+
+// startRequestSpan starts the span of the request, named after its method and its route, returning the request
+// carrying the span in its context, so that the spans of the queries to the database are its children
+func (rt *_router) startRequestSpan(r *http.Request) (*http.Request, *tracing.Span) {
+	route := routeOf(r)
+
+	name := r.Method
+	if route != "" {
+		name += " " + route
+	}
+
+	ctx, span := rt.tracer.StartRequest(r, name)
+
+	if span == nil {
+		return r, nil
+	}
+
+	span.SetAttribute("http.request.method", r.Method)
+	span.SetAttribute("url.path", r.URL.Path)
+
+	if route != "" {
+		span.SetAttribute("http.route", route)
+	}
+
+	return r.WithContext(ctx), span
+}
+
+// endRequestSpan ends the span of the request, once it has been served by the handler with the context `ctx`
+func endRequestSpan(span *tracing.Span, rec *statusRecorder, ctx *reqcontext.RequestContext) {
+	if span == nil {
+		return
+	}
+
+	status := rec.status
+
+	// a handler which wrote nothing replied with 200
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	span.SetAttribute("http.response.status_code", status)
+	span.SetAttribute("request.id", ctx.ReqUUID.String())
+
+	if ctx.UserId != 0 {
+		span.SetAttribute("user.id", ctx.UserId)
+	}
+
+	// the server failed only on the 5xx responses, the other errors are the client's
+	if status >= 500 {
+		span.SetError(errors.New(http.StatusText(status)))
+	}
+
+	span.End()
+}
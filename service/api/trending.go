@@ -0,0 +1,75 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/api/reqcontext"
+	"github.com/julienschmidt/httprouter"
+)
+
+// trendingWindows are the periods over which the trending photos and hashtags can be computed
+var trendingWindows = map[string]time.Duration{
+	"24h": 24 * time.Hour,
+	"7d":  7 * 24 * time.Hour,
+}
+
+// defaultTrendingWindow is the window used when none is requested
+const defaultTrendingWindow = "24h"
+
+func (rt *_router) getTrending(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// get the user authenticated by the bearer token
+	userId, err := GetAuthenticatedUserId(ctx)
+
+	if err != nil {
+		writeError(w, err, http.StatusUnauthorized)
+		return
+	}
+
+	// get the user performing the action
+	dbUser, err := rt.db.GetDatabaseUser(ctx.Context, userId)
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	// get the window from the query
+	window := r.URL.Query().Get("window")
+
+	if window == "" {
+		window = defaultTrendingWindow
+	}
+
+	period, ok := trendingWindows[window]
+
+	if !ok {
+		writeError(w, ErrInvalidWindow, http.StatusBadRequest)
+		return
+	}
+
+	// get the number of photos and hashtags from the query
+	limit, _, code, err := GetPageFromQuery(r)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	// get the most engaged photos and the most used hashtags from the database
+	dbTrending, err := rt.db.GetTrending(ctx.Context, dbUser, time.Now().Add(-period), limit)
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	trending := TrendingFromDatabaseTrending(dbTrending, window)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK) // 200
+
+	// return the trending photos and hashtags
+	_ = json.NewEncoder(w).Encode(trending)
+}
@@ -2,142 +2,239 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
+	"net/url"
 	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/api/reqcontext"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/database"
 	"github.com/julienschmidt/httprouter"
 )
 
 func (rt *_router) getUserProfile(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
-	// get the bearer token
-	token, err := GetBearerToken(r.Header.Get("Authorization"))
+	// get the user authenticated by the bearer token
+	userId, err := GetAuthenticatedUserId(ctx)
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusUnauthorized)
+		writeError(w, err, http.StatusUnauthorized)
 		return
 	}
 
 	// get the user performing the action
-	dbUser, err := rt.db.GetDatabaseUser(uint32(token))
+	dbUser, err := rt.db.GetDatabaseUser(ctx.Context, userId)
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err, http.StatusInternalServerError)
 		return
 	}
 
 	// get the user of the profile from the resource parameter
-	profileUser, code, err := rt.GetUserFromParameter("uname", r, ps)
+	profileUser, code, err := rt.GetUserFromParameter(ctx, "uname", r, ps)
 
 	if err != nil {
-		http.Error(w, err.Error(), code)
+		writeError(w, err, code)
 		return
 	}
 
 	// check whether the user of the profile
 	// has banned the user performing the action
-	checkBan, err := rt.db.CheckBan(profileUser.UserIntoDatabaseUser(), dbUser)
+	checkBan, err := rt.db.CheckBan(ctx.Context, profileUser.UserIntoDatabaseUser(), dbUser)
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err, http.StatusInternalServerError)
 		return
 	}
 
 	if checkBan {
-		http.Error(w, ErrBannedUser.Error(), http.StatusUnauthorized)
+		writeError(w, ErrBannedUser, http.StatusUnauthorized)
+		return
+	}
+
+	// get the pagination parameters of the photos from the query
+	limit, _, code, err := GetPageFromQuery(r)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	before, code, err := GetCursorFromQuery("before", r)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	// check whether the archived photos are requested,
+	// which only the owner of the profile can see
+	archived := r.URL.Query().Get("archived") == "true"
+
+	if archived && profileUser.Id != dbUser.Id {
+		writeError(w, ErrUserUnauthorized, http.StatusUnauthorized)
 		return
 	}
 
 	// build the user profile
+	profile, err := rt.buildProfile(ctx, dbUser, profileUser, archived, limit, before)
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	// return the user profile, unless the client holds it already
+	writeJSONETag(w, r, profile)
+}
+
+// buildProfile returns the profile of `profileUser` as seen by the user performing the action, with a page of at most
+// `limit` photos, either archived or not, older than the photo `before` (if it is not 0)
+func (rt *_router) buildProfile(ctx reqcontext.RequestContext, dbUser database.DatabaseUser, profileUser User, archived bool, limit int, before uint32) (Profile, error) {
 	profile := ProfileDefault()
 
 	profile.User = profileUser
 
 	dbProfile := profile.ProfileIntoDatabaseProfile()
 
-	err = rt.db.GetPhotos(&dbProfile, dbUser)
+	err := rt.db.GetPhotos(ctx.Context, &dbProfile, dbUser, archived, limit, before)
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		return ProfileDefault(), err
 	}
 
 	profile = ProfileFromDatabaseProfile(dbProfile)
 
-	profile.PhotoCount, err = rt.db.GetPhotoCount(profileUser.UserIntoDatabaseUser())
+	profile.PhotoCount, err = rt.db.GetPhotoCount(ctx.Context, profileUser.UserIntoDatabaseUser(), dbUser)
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		return ProfileDefault(), err
 	}
 
-	profile.FollowersCount, err = rt.db.GetFollowersCount(profileUser.UserIntoDatabaseUser(), dbUser)
+	profile.FollowersCount, err = rt.db.GetFollowersCount(ctx.Context, profileUser.UserIntoDatabaseUser(), dbUser)
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		return ProfileDefault(), err
 	}
 
-	profile.FollowingCount, err = rt.db.GetFollowingCount(profileUser.UserIntoDatabaseUser(), dbUser)
+	profile.FollowingCount, err = rt.db.GetFollowingCount(ctx.Context, profileUser.UserIntoDatabaseUser(), dbUser)
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		return ProfileDefault(), err
 	}
 
-	profile.FollowStatus, err = rt.db.GetFollowStatus(dbUser, profileUser.UserIntoDatabaseUser())
+	profile.FollowStatus, err = rt.db.GetFollowStatus(ctx.Context, dbUser, profileUser.UserIntoDatabaseUser())
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		return ProfileDefault(), err
 	}
 
-	profile.BanStatus, err = rt.db.CheckBan(dbUser, profileUser.UserIntoDatabaseUser())
+	profile.BanStatus, err = rt.db.CheckBan(ctx.Context, dbUser, profileUser.UserIntoDatabaseUser())
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		return ProfileDefault(), err
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK) // 200
+	profile.MuteStatus, err = rt.db.CheckMute(ctx.Context, dbUser, profileUser.UserIntoDatabaseUser())
+
+	if err != nil {
+		return ProfileDefault(), err
+	}
+
+	profile.CloseFriend, err = rt.db.CheckCloseFriend(ctx.Context, dbUser, profileUser.UserIntoDatabaseUser())
+
+	if err != nil {
+		return ProfileDefault(), err
+	}
 
-	// return the user profile
-	_ = json.NewEncoder(w).Encode(profile)
+	dbSettings, err := rt.db.GetUserSettings(ctx.Context, profileUser.UserIntoDatabaseUser())
+
+	if err != nil {
+		return ProfileDefault(), err
+	}
+
+	profile.Private = dbSettings.Private
+
+	profile.FollowRequest, err = rt.db.CheckFollowRequest(ctx.Context, dbUser, profileUser.UserIntoDatabaseUser())
+
+	if err != nil {
+		return ProfileDefault(), err
+	}
+
+	return profile, nil
+}
+
+// usernamePolicyDetails returns the details of ErrInvalidUsername, telling the client the username policy
+func (rt *_router) usernamePolicyDetails() map[string]interface{} {
+	return map[string]interface{}{
+		"pattern":    rt.usernames.Pattern(),
+		"min_length": rt.usernames.MinLength(),
+		"max_length": rt.usernames.MaxLength(),
+	}
 }
 
 func (rt *_router) setMyUserName(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
 	// get the user performint the action from the resource parameter
-	oldUser, code, err := rt.AuthenticateUserFromParameter("uname", r, ps)
+	oldUser, code, err := rt.AuthenticateUserFromParameter(ctx, "uname", r, ps)
 
 	if err != nil {
-		http.Error(w, err.Error(), code)
+		writeError(w, err, code)
 		return
 	}
 
 	newUserLogin := LoginDefault()
 
 	// get the user's new username
-	err = json.NewDecoder(r.Body).Decode(&newUserLogin)
+	code, err = decodeJSON(r, &newUserLogin)
 
-	newUser := UserDefault()
+	// the rest of the profile is kept as it is
+	newUser := oldUser
 
-	newUser.Id = oldUser.Id
-	newUser.Username = newUserLogin.Username
+	newUser.Username = rt.usernames.Normalize(newUserLogin.Username)
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err, code)
 		return
 	}
 
-	err = rt.db.UpdateUser(oldUser.UserIntoDatabaseUser(), newUser.UserIntoDatabaseUser())
+	// the new username must be allowed by the policy, while
+	// the users registered before it can keep their own
+	if newUser.Username != oldUser.Username && !rt.usernames.Valid(newUser.Username) {
+		writeErrorDetails(w, ErrInvalidUsername, http.StatusBadRequest, rt.usernamePolicyDetails())
+		return
+	}
+
+	// nor may it be reserved, unless only its case or its form changed
+	if rt.usernames.Key(newUser.Username) != rt.usernames.Key(oldUser.Username) {
+		reservation, err := rt.currentReservation(ctx.Context)
+
+		if err != nil {
+			writeError(w, err, http.StatusInternalServerError)
+			return
+		}
+
+		if _, reserved := reservation.Reserved(newUser.Username); reserved {
+			writeError(w, ErrReservedUsername, http.StatusConflict)
+			return
+		}
+	}
+
+	err = rt.db.UpdateUser(ctx.Context, oldUser.UserIntoDatabaseUser(), newUser.UserIntoDatabaseUser(), time.Now().Add(rt.renameGracePeriod))
+
+	// the user was updated by another request in the meantime
+	if errors.Is(err, database.ErrConflict) {
+		writeError(w, ErrUserConflict, http.StatusConflict)
+		return
+	}
 
 	if err != nil {
 		// check whether the new username was already taken
-		if strings.HasPrefix(err.Error(), "UNIQUE constraint failed") {
+		if errors.Is(err, database.ErrUsernameAlreadyTaken) {
 			newUser.Username = oldUser.Username
 		} else {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeError(w, err, http.StatusInternalServerError)
 			return
 		}
 	}
@@ -149,12 +246,151 @@ func (rt *_router) setMyUserName(w http.ResponseWriter, r *http.Request, ps http
 	_ = json.NewEncoder(w).Encode(newUser)
 }
 
+// The maximum lengths of the details of a profile, in characters
+const maxDisplayNameLength = 50
+const maxBioLength = 160
+const maxWebsiteLength = 200
+
+// validProfileText reports whether the text is at most `maxLength` characters long, with no control characters other
+// than the ones allowed
+func validProfileText(text string, maxLength int, allowed string) bool {
+	if utf8.RuneCountInString(text) > maxLength {
+		return false
+	}
+
+	for _, c := range text {
+		if unicode.IsControl(c) && !strings.ContainsRune(allowed, c) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// validWebsite reports whether the website is an absolute http or https URL, of at most maxWebsiteLength characters
+func validWebsite(website string) bool {
+	if utf8.RuneCountInString(website) > maxWebsiteLength {
+		return false
+	}
+
+	u, err := url.Parse(website)
+
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" && u.User == nil
+}
+
+func (rt *_router) setMyProfile(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// get the user performing the action from the resource parameter
+	oldUser, code, err := rt.AuthenticateUserFromParameter(ctx, "uname", r, ps)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	details := ProfileDetailsDefault()
+
+	// get the new details of the profile from the request body
+	code, err = decodeJSON(r, &details)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	if !validProfileText(details.DisplayName, maxDisplayNameLength, "") {
+		writeError(w, ErrInvalidDisplayName, http.StatusBadRequest)
+		return
+	}
+
+	if !validProfileText(details.Bio, maxBioLength, "\n") {
+		writeError(w, ErrInvalidBio, http.StatusBadRequest)
+		return
+	}
+
+	// an empty website removes it from the profile
+	if details.Website != "" && !validWebsite(details.Website) {
+		writeError(w, ErrInvalidWebsite, http.StatusBadRequest)
+		return
+	}
+
+	newUser := oldUser
+
+	newUser.DisplayName = details.DisplayName
+	newUser.Bio = details.Bio
+	newUser.Website = details.Website
+
+	err = rt.db.UpdateUser(ctx.Context, oldUser.UserIntoDatabaseUser(), newUser.UserIntoDatabaseUser(), time.Now().Add(rt.renameGracePeriod))
+
+	// the user was updated by another request in the meantime
+	if errors.Is(err, database.ErrConflict) {
+		writeError(w, ErrUserConflict, http.StatusConflict)
+		return
+	}
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK) // 200
+
+	// return the updated user with their new profile
+	_ = json.NewEncoder(w).Encode(newUser)
+}
+
+func (rt *_router) deleteUser(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// authenticate the user performing the action
+	user, code, err := rt.AuthenticateUserFromParameter(ctx, "uname", r, ps)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	// remove the user and all of their data from the database
+	urls, err := rt.db.DeleteUser(ctx.Context, user.UserIntoDatabaseUser())
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	// remove the files of their photos, stories and avatar from the storage
+	rt.deleteAccountFiles(ctx.Context, ctx.Logger, urls)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusNoContent) // 204
+}
+
+func (rt *_router) deactivateUser(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// authenticate the user performing the action
+	user, code, err := rt.AuthenticateUserFromParameter(ctx, "uname", r, ps)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	// deactivate the user, keeping their data until
+	// the reactivation window is over
+	err = rt.db.DeactivateUser(ctx.Context, user.UserIntoDatabaseUser(), time.Now())
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusNoContent) // 204
+}
+
 func (rt *_router) getUsers(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
 	// get the user performin the action from the resource parameter
-	user, code, err := rt.AuthenticateUserFromParameter("uname", r, ps)
+	user, code, err := rt.AuthenticateUserFromParameter(ctx, "uname", r, ps)
 
 	if err != nil {
-		http.Error(w, err.Error(), code)
+		writeError(w, err, code)
 		return
 	}
 
@@ -165,10 +401,10 @@ func (rt *_router) getUsers(w http.ResponseWriter, r *http.Request, ps httproute
 	queryLogin.Username = query
 
 	// get the users matching the query from the database
-	dbUserList, err := rt.db.GetUserList(user.UserIntoDatabaseUser(), queryLogin.LoginIntoDatabaseLogin())
+	dbUserList, err := rt.db.GetUserList(ctx.Context, user.UserIntoDatabaseUser(), queryLogin.LoginIntoDatabaseLogin())
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err, http.StatusInternalServerError)
 		return
 	}
 
@@ -180,3 +416,88 @@ func (rt *_router) getUsers(w http.ResponseWriter, r *http.Request, ps httproute
 	// return the user list
 	_ = json.NewEncoder(w).Encode(userList)
 }
+
+func (rt *_router) getUserSettings(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// authenticate the user performing the action
+	user, code, err := rt.AuthenticateUserFromParameter(ctx, "uname", r, ps)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	// get the settings of the user from the database
+	dbSettings, err := rt.db.GetUserSettings(ctx.Context, user.UserIntoDatabaseUser())
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	settings := SettingsFromDatabaseSettings(dbSettings)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK) // 200
+
+	// return the settings
+	_ = json.NewEncoder(w).Encode(settings)
+}
+
+func (rt *_router) setUserSettings(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// authenticate the user performing the action
+	user, code, err := rt.AuthenticateUserFromParameter(ctx, "uname", r, ps)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	settings := SettingsDefault()
+
+	// get the new settings from the request body
+	code, err = decodeJSON(r, &settings)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	// an empty email address stops the digests
+	if settings.Email != "" && !validEmail(settings.Email) {
+		writeError(w, ErrInvalidEmail, http.StatusBadRequest)
+		return
+	}
+
+	if !database.IsPolicy(settings.CommentPolicy) || !database.IsPolicy(settings.MentionPolicy) {
+		writeError(w, ErrInvalidPolicy, http.StatusBadRequest)
+		return
+	}
+
+	oldDbSettings, err := rt.db.GetUserSettings(ctx.Context, user.UserIntoDatabaseUser())
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	// replace the settings of the user
+	err = rt.db.UpdateUserSettings(ctx.Context, user.UserIntoDatabaseUser(), settings.SettingsIntoDatabaseSettings())
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	// a new email address has to be verified again
+	settings.EmailVerified = settings.Email == oldDbSettings.Email && oldDbSettings.EmailVerified
+
+	if settings.Email != "" && settings.Email != oldDbSettings.Email {
+		rt.sendVerification(ctx.Logger, user.UserIntoDatabaseUser(), settings.Email, time.Now())
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK) // 200
+
+	// return the new settings
+	_ = json.NewEncoder(w).Encode(settings)
+}
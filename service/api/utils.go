@@ -1,43 +1,65 @@
 package api
 
 import (
+	"crypto/subtle"
+	"errors"
 	"net/http"
-	"regexp"
+	"net/url"
 	"strconv"
+	"strings"
+	"time"
 
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/api/reqcontext"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/database"
 	"github.com/julienschmidt/httprouter"
 )
 
-func GetBearerToken(authRaw string) (int, error) {
-	re := regexp.MustCompile(`[-]?\d[\d,]*[\.]?[\d{2}]*`)
+// defaultPageLimit is the page size of the lists whose
+// limit was not specified in the request
+const defaultPageLimit = 50
 
-	tokenString := re.FindAllString(authRaw, -1)
+// maxPageLimit is the largest page size a request can ask for
+const maxPageLimit = 200
 
-	if len(tokenString) == 0 {
-		return -1, ErrUserUnauthorized
+// GetAuthenticatedUserId returns the id of the user authenticated by the bearer token of the request, which was
+// verified by the middleware, or ErrUserUnauthorized if there is none.
+func GetAuthenticatedUserId(ctx reqcontext.RequestContext) (uint32, error) {
+	if ctx.UserId == 0 {
+		return 0, ErrUserUnauthorized
 	}
 
-	token, err := strconv.Atoi(tokenString[0])
-
-	return token, err
+	return ctx.UserId, nil
 }
 
-func CheckAuthorization(user User, authRaw string) error {
-	token, err := GetBearerToken(authRaw)
+// CheckAuthorization checks that the user is the one authenticated by the bearer token of the request.
+func CheckAuthorization(user User, ctx reqcontext.RequestContext) error {
+	userId, err := GetAuthenticatedUserId(ctx)
 
 	if err != nil {
 		return err
 	}
 
-	if int(user.Id) != token {
+	if user.Id != userId {
 		return ErrUserUnauthorized
 	}
 
 	return nil
 }
 
-func (rt *_router) GetUserFromLogin(login Login) (User, error) {
-	dbUser, err := rt.db.GetDatabaseUserFromDatabaseLogin(login.LoginIntoDatabaseLogin())
+// CheckAdminAuthorization checks that the bearer token of the request is the token of the administrators, which must be
+// configured (otherwise every request is rejected).
+func CheckAdminAuthorization(adminToken string, authRaw string) error {
+	token := strings.TrimPrefix(authRaw, "Bearer ")
+
+	if adminToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) != 1 {
+		return ErrAdminUnauthorized
+	}
+
+	return nil
+}
+
+func (rt *_router) GetUserFromLogin(ctx reqcontext.RequestContext, login Login) (User, error) {
+	dbUser, err := rt.db.GetDatabaseUserFromDatabaseLogin(ctx.Context, login.LoginIntoDatabaseLogin())
 
 	if err != nil {
 		return UserDefault(), err
@@ -48,8 +70,8 @@ func (rt *_router) GetUserFromLogin(login Login) (User, error) {
 	return user, nil
 }
 
-func (rt *_router) GetPhotoFromPhotoId(photoId uint32, user User) (Photo, error) {
-	dbPhoto, err := rt.db.GetDatabasePhoto(photoId, user.UserIntoDatabaseUser())
+func (rt *_router) GetPhotoFromPhotoId(ctx reqcontext.RequestContext, photoId uint32, user User) (Photo, error) {
+	dbPhoto, err := rt.db.GetDatabasePhoto(ctx.Context, photoId, user.UserIntoDatabaseUser())
 
 	if err != nil {
 		return PhotoDefault(), err
@@ -60,8 +82,8 @@ func (rt *_router) GetPhotoFromPhotoId(photoId uint32, user User) (Photo, error)
 	return photo, nil
 }
 
-func (rt *_router) GetCommentFromCommentId(commentId uint32, user User) (Comment, error) {
-	dbComment, err := rt.db.GetDatabaseComment(commentId, user.UserIntoDatabaseUser())
+func (rt *_router) GetCommentFromCommentId(ctx reqcontext.RequestContext, commentId uint32, user User) (Comment, error) {
+	dbComment, err := rt.db.GetDatabaseComment(ctx.Context, commentId, user.UserIntoDatabaseUser())
 
 	if err != nil {
 		return CommentDefault(), err
@@ -72,11 +94,27 @@ func (rt *_router) GetCommentFromCommentId(commentId uint32, user User) (Comment
 	return comment, nil
 }
 
-func (rt *_router) GetUserFromParameter(parameter string, r *http.Request, ps httprouter.Params) (User, int, error) {
+func (rt *_router) GetUserFromParameter(ctx reqcontext.RequestContext, parameter string, r *http.Request, ps httprouter.Params) (User, int, error) {
 	userUsername := ps.ByName(parameter)
 	userLogin := LoginFromUsername(userUsername)
 
-	user, err := rt.GetUserFromLogin(userLogin)
+	user, err := rt.GetUserFromLogin(ctx, userLogin)
+
+	// the username may have been left by a user who
+	// renamed, whose requests are sent to the new one
+	if errors.Is(err, database.ErrUserDoesNotExist) {
+		location, ok := rt.renamedUserLocation(ctx, userUsername, parameter, r)
+
+		if ok {
+			code := http.StatusPermanentRedirect // 308
+
+			if r.Method == http.MethodGet || r.Method == http.MethodHead {
+				code = http.StatusMovedPermanently // 301
+			}
+
+			return user, code, &userMovedError{location}
+		}
+	}
 
 	code := -1
 
@@ -87,7 +125,44 @@ func (rt *_router) GetUserFromParameter(parameter string, r *http.Request, ps ht
 	return user, code, err
 }
 
-func (rt *_router) GetPhotoFromParameter(parameter string, user User, r *http.Request, ps httprouter.Params) (Photo, int, error) {
+// renamedUserLocation returns the URL of the request with `username`, found in `parameter`, replaced by the current
+// username of the user who left it, if it is still reserved to them
+func (rt *_router) renamedUserLocation(ctx reqcontext.RequestContext, username string, parameter string, r *http.Request) (string, bool) {
+	dbUser, err := rt.db.GetRenamedUser(ctx.Context, username)
+
+	if err != nil {
+		return "", false
+	}
+
+	// the segment of the username is found in the route
+	// matched by the request, which has as many segments
+	route := strings.Split(routeOf(r), "/")
+	path := strings.Split(r.URL.EscapedPath(), "/")
+
+	if len(route) != len(path) {
+		return "", false
+	}
+
+	for i, segment := range route {
+		if segment != ":"+parameter {
+			continue
+		}
+
+		path[i] = url.PathEscape(dbUser.Username)
+
+		location := strings.Join(path, "/")
+
+		if r.URL.RawQuery != "" {
+			location += "?" + r.URL.RawQuery
+		}
+
+		return location, true
+	}
+
+	return "", false
+}
+
+func (rt *_router) GetPhotoFromParameter(ctx reqcontext.RequestContext, parameter string, user User, r *http.Request, ps httprouter.Params) (Photo, int, error) {
 	photo := PhotoDefault()
 
 	photoIdString := ps.ByName(parameter)
@@ -97,7 +172,7 @@ func (rt *_router) GetPhotoFromParameter(parameter string, user User, r *http.Re
 		return photo, http.StatusInternalServerError, err
 	}
 
-	photo, err = rt.GetPhotoFromPhotoId(uint32(photoId), user)
+	photo, err = rt.GetPhotoFromPhotoId(ctx, uint32(photoId), user)
 
 	if err != nil {
 		return photo, http.StatusInternalServerError, err
@@ -106,14 +181,36 @@ func (rt *_router) GetPhotoFromParameter(parameter string, user User, r *http.Re
 	return photo, -1, nil
 }
 
-func (rt *_router) AuthenticateUserFromParameter(parameter string, r *http.Request, ps httprouter.Params) (User, int, error) {
-	user, code, err := rt.GetUserFromParameter(parameter, r, ps)
+// GetAlbumFromParameter returns the album whose id is the given resource parameter, as seen by the user; the album is
+// not found (404) if the parameter is not a valid id
+func (rt *_router) GetAlbumFromParameter(ctx reqcontext.RequestContext, parameter string, user User, r *http.Request, ps httprouter.Params) (Album, int, error) {
+	albumId, err := strconv.ParseUint(ps.ByName(parameter), 10, 32)
+
+	if err != nil {
+		return AlbumDefault(), http.StatusNotFound, ErrPageNotFound
+	}
+
+	dbAlbum, err := rt.db.GetDatabaseAlbum(ctx.Context, uint32(albumId), user.UserIntoDatabaseUser())
+
+	if errors.Is(err, database.ErrAlbumDoesNotExist) {
+		return AlbumDefault(), http.StatusNotFound, err
+	}
+
+	if err != nil {
+		return AlbumDefault(), http.StatusInternalServerError, err
+	}
+
+	return AlbumFromDatabaseAlbum(dbAlbum), -1, nil
+}
+
+func (rt *_router) AuthenticateUserFromParameter(ctx reqcontext.RequestContext, parameter string, r *http.Request, ps httprouter.Params) (User, int, error) {
+	user, code, err := rt.GetUserFromParameter(ctx, parameter, r, ps)
 
 	if err != nil {
 		return user, code, err
 	}
 
-	err = CheckAuthorization(user, r.Header.Get("Authorization"))
+	err = CheckAuthorization(user, ctx)
 
 	if err != nil {
 		code = http.StatusUnauthorized
@@ -121,3 +218,104 @@ func (rt *_router) AuthenticateUserFromParameter(parameter string, r *http.Reque
 
 	return user, code, err
 }
+
+// GetPageFromQuery returns the page size (`limit`) and the cursor (`after`) of a paginated list from the query of the
+// request. The limit falls back to defaultPageLimit and gets capped at maxPageLimit, and the cursor is 0 if missing.
+func GetPageFromQuery(r *http.Request) (int, uint32, int, error) {
+	limit := defaultPageLimit
+
+	limitString := r.URL.Query().Get("limit")
+
+	if limitString != "" {
+		parsedLimit, err := strconv.Atoi(limitString)
+
+		if err != nil || parsedLimit <= 0 {
+			return 0, 0, http.StatusBadRequest, ErrInvalidLimit
+		}
+
+		limit = parsedLimit
+	}
+
+	if limit > maxPageLimit {
+		limit = maxPageLimit
+	}
+
+	after, code, err := GetCursorFromQuery("after", r)
+
+	if err != nil {
+		return 0, 0, code, err
+	}
+
+	return limit, after, -1, nil
+}
+
+// GetOffsetFromQuery returns the number of items to be skipped (`offset`) of a ranked list from the query of the request,
+// or 0 if it is missing. The ranked lists are paginated by position, as their order changes over time.
+func GetOffsetFromQuery(r *http.Request) (int, int, error) {
+	offsetString := r.URL.Query().Get("offset")
+
+	if offsetString == "" {
+		return 0, -1, nil
+	}
+
+	offset, err := strconv.Atoi(offsetString)
+
+	if err != nil || offset < 0 {
+		return 0, http.StatusBadRequest, ErrInvalidOffset
+	}
+
+	return offset, -1, nil
+}
+
+// GetCursorFromQuery returns the id stored in the given query parameter of the request, or 0 if it is missing.
+func GetCursorFromQuery(parameter string, r *http.Request) (uint32, int, error) {
+	cursorString := r.URL.Query().Get(parameter)
+
+	if cursorString == "" {
+		return 0, -1, nil
+	}
+
+	cursor, err := strconv.ParseUint(cursorString, 10, 32)
+
+	if err != nil {
+		return 0, http.StatusBadRequest, ErrInvalidCursor
+	}
+
+	return uint32(cursor), -1, nil
+}
+
+// GetCommentSortFromQuery returns the order of a comment list from the query of the request, which is
+// database.CommentSortOldest if missing
+func GetCommentSortFromQuery(r *http.Request) (string, int, error) {
+	sort := r.URL.Query().Get("sort")
+
+	if sort == "" {
+		return database.CommentSortOldest, -1, nil
+	}
+
+	// `top` is reserved for sorting by the like count of the comments, and is refused as any other
+	// unknown sort until comments can be liked
+	if !database.IsCommentSort(sort) {
+		return "", http.StatusBadRequest, ErrInvalidCommentSort
+	}
+
+	return sort, -1, nil
+}
+
+// GetDateFromQuery returns the date given in the query of the request as an RFC 3339 timestamp, or the zero time if it
+// is missing
+func GetDateFromQuery(parameter string, r *http.Request) (time.Time, int, error) {
+	dateString := r.URL.Query().Get(parameter)
+
+	if dateString == "" {
+		return time.Time{}, -1, nil
+	}
+
+	date, err := time.Parse(time.RFC3339, dateString)
+
+	if err != nil {
+		return time.Time{}, http.StatusBadRequest, ErrInvalidDate
+	}
+
+	return date, -1, nil
+}
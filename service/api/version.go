@@ -0,0 +1,165 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/api/reqcontext"
+	"github.com/julienschmidt/httprouter"
+)
+
+// legacyDeprecation is when the routes without the prefix of a version were deprecated, in favour of the ones of /v1
+var legacyDeprecation = time.Date(2026, time.October, 17, 0, 0, 0, 0, time.UTC)
+
+// apiVersion collects the routes of a version of the API, served under its prefix (eg. `/v1`) by the same router as
+// the other versions. A new version starts from the routes of the previous one, replacing the ones it changes and
+// deprecating the ones it is going to remove.
+type apiVersion struct {
+	prefix string
+	routes []versionRoute
+}
+
+// versionRoute is a route of a version of the API
+type versionRoute struct {
+	method string
+	path   string
+	handle httprouter.Handle
+
+	// deprecation, if not zero, is when the route was deprecated, and sunset, if not zero, when it is removed
+	deprecation time.Time
+	sunset      time.Time
+}
+
+// apiVersionPrefixes are the prefixes of the versions of the API served by the router
+var apiVersionPrefixes = []string{"/v1", "/v2"}
+
+// versionedPath reports whether the path is under the prefix of a version of the API
+func versionedPath(path string) bool {
+	for _, prefix := range apiVersionPrefixes {
+		if strings.HasPrefix(path, prefix+"/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// unversionedPath returns the path without the prefix of its version of the API, if any, as the legacy routes are served
+func unversionedPath(path string) string {
+	for _, prefix := range apiVersionPrefixes {
+		if strings.HasPrefix(path, prefix+"/") {
+			return strings.TrimPrefix(path, prefix)
+		}
+	}
+
+	return path
+}
+
+// newAPIVersion returns a version of the API without routes, served under `prefix`
+func newAPIVersion(prefix string) *apiVersion {
+	return &apiVersion{prefix: prefix}
+}
+
+// next returns the version served under `prefix` starting from the routes of v
+func (v *apiVersion) next(prefix string) *apiVersion {
+	return &apiVersion{prefix: prefix, routes: append([]versionRoute(nil), v.routes...)}
+}
+
+// handle adds the route to the version, replacing the one with the same method and path if any
+func (v *apiVersion) handle(method string, path string, handle httprouter.Handle) {
+	for i := range v.routes {
+		if v.routes[i].method == method && v.routes[i].path == path {
+			v.routes[i] = versionRoute{method: method, path: path, handle: handle}
+			return
+		}
+	}
+
+	v.routes = append(v.routes, versionRoute{method: method, path: path, handle: handle})
+}
+
+func (v *apiVersion) GET(path string, handle httprouter.Handle) {
+	v.handle(http.MethodGet, path, handle)
+}
+
+func (v *apiVersion) POST(path string, handle httprouter.Handle) {
+	v.handle(http.MethodPost, path, handle)
+}
+
+func (v *apiVersion) PUT(path string, handle httprouter.Handle) {
+	v.handle(http.MethodPut, path, handle)
+}
+
+func (v *apiVersion) DELETE(path string, handle httprouter.Handle) {
+	v.handle(http.MethodDelete, path, handle)
+}
+
+// deprecate marks the route of the version as deprecated since `deprecation`, until it is removed at `sunset`
+func (v *apiVersion) deprecate(method string, path string, deprecation time.Time, sunset time.Time) {
+	for i := range v.routes {
+		if v.routes[i].method == method && v.routes[i].path == path {
+			v.routes[i].deprecation = deprecation
+			v.routes[i].sunset = sunset
+		}
+	}
+}
+
+// mount registers the routes of the version under its prefix
+func (rt *_router) mount(v *apiVersion) {
+	for _, route := range v.routes {
+		handle := route.handle
+
+		if !route.deprecation.IsZero() {
+			handle = rt.deprecated(handle, route.deprecation, route.sunset, "", "")
+		}
+
+		rt.router.Handle(route.method, v.prefix+route.path, withRoute(handle, v.prefix+route.path))
+	}
+}
+
+// mountLegacy registers the routes of the version without its prefix as well, as they were served before the versions
+// of the API, deprecated in favour of the ones of the version until `sunset`
+func (rt *_router) mountLegacy(v *apiVersion, sunset time.Time) {
+	for _, route := range v.routes {
+		routeSunset := sunset
+
+		if !route.sunset.IsZero() && route.sunset.Before(sunset) {
+			routeSunset = route.sunset
+		}
+
+		handle := rt.deprecated(route.handle, legacyDeprecation, routeSunset, "", v.prefix)
+
+		rt.router.Handle(route.method, route.path, withRoute(handle, route.path))
+	}
+}
+
+// deprecated tells the clients of the route that it is deprecated since `deprecation`, in the Deprecation header, and
+// when it is removed, in the Sunset header; after the sunset the route answers with 410. The route replacing it, if any,
+// is linked as the successor version, swapping the prefix `prefix` of the path of the request with `successor`.
+func (rt *_router) deprecated(handle httprouter.Handle, deprecation time.Time, sunset time.Time, prefix string, successor string) httprouter.Handle {
+	gone := rt.wrap(rt.routeRemoved)
+
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		w.Header().Set("Deprecation", "@"+strconv.FormatInt(deprecation.Unix(), 10))
+
+		if !sunset.IsZero() {
+			w.Header().Set("Sunset", sunset.UTC().Format(http.TimeFormat))
+		}
+
+		if successor != "" {
+			w.Header().Set("Link", "<"+successor+strings.TrimPrefix(r.URL.Path, prefix)+`>; rel="successor-version"`)
+		}
+
+		if !sunset.IsZero() && !time.Now().Before(sunset) {
+			gone(w, r, ps)
+			return
+		}
+
+		handle(w, r, ps)
+	}
+}
+
+func (rt *_router) routeRemoved(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	writeError(w, ErrRouteRemoved, http.StatusGone)
+}
@@ -0,0 +1,126 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/api/reqcontext"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/imaging"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/video"
+)
+
+// posterTime is when the frame shown as the poster of a video is taken, unless the video is shorter than twice as long
+// and the frame halfway through it is taken instead
+const posterTime = time.Second
+
+// maxUploadSize returns the maximum size in bytes of an uploaded photo or video, whichever is larger
+func (rt *_router) maxUploadSize() int64 {
+	if rt.maxVideoSize > rt.maxPhotoSize {
+		return rt.maxVideoSize
+	}
+
+	return rt.maxPhotoSize
+}
+
+// isVideoUpload tells whether the multipart form of the request holds a video in its "video" field, in place of a
+// photo in its "photo" field, or returns the status code and the error to be returned if the form cannot be read
+func (rt *_router) isVideoUpload(r *http.Request) (bool, int, error) {
+	_, _, err := r.FormFile("video")
+
+	if err == nil {
+		return true, -1, nil
+	}
+
+	if errors.Is(err, http.ErrMissingFile) {
+		return false, -1, nil
+	}
+
+	switch code, err := requestBodyError(err); code {
+	case http.StatusRequestEntityTooLarge, http.StatusRequestTimeout:
+		return false, code, err
+	}
+
+	return false, http.StatusBadRequest, ErrInvalidPhoto
+}
+
+// readUploadedVideo reads the video in the "video" field of the multipart form of the request, checking its size, its
+// format, its dimensions and its duration. It returns the content of the video and what was read of its container, or
+// the status code and the error to be returned.
+// The body of the request is limited by its route to the maximum size of an upload and the multipart form around it.
+func (rt *_router) readUploadedVideo(r *http.Request) ([]byte, video.Info, int, error) {
+	file, header, err := r.FormFile("video")
+
+	if err != nil {
+		return nil, video.Info{}, http.StatusBadRequest, ErrInvalidVideo
+	}
+
+	defer file.Close()
+
+	if header.Size > rt.maxVideoSize {
+		return nil, video.Info{}, http.StatusRequestEntityTooLarge, fmt.Errorf("%w (%d bytes)", ErrVideoTooLarge, rt.maxVideoSize)
+	}
+
+	// read the whole video, as its container is read before it is saved
+	content, err := io.ReadAll(file)
+
+	if err != nil {
+		return nil, video.Info{}, http.StatusBadRequest, ErrInvalidVideo
+	}
+
+	// detect the format of the video from its first bytes,
+	// regardless of the type declared by the client
+	info, err := video.Inspect(content)
+
+	if errors.Is(err, video.ErrUnsupportedFormat) {
+		return nil, info, http.StatusUnsupportedMediaType, ErrUnsupportedVideo
+	}
+
+	if err != nil {
+		return nil, info, http.StatusBadRequest, ErrInvalidVideo
+	}
+
+	if info.Width > rt.maxPhotoDimension || info.Height > rt.maxPhotoDimension {
+		return nil, info, http.StatusRequestEntityTooLarge, fmt.Errorf("%w (%d pixels)", ErrVideoTooBig, rt.maxPhotoDimension)
+	}
+
+	if info.Duration > rt.maxVideoDuration {
+		return nil, info, http.StatusBadRequest, fmt.Errorf("%w (%v)", ErrVideoTooLong, rt.maxVideoDuration)
+	}
+
+	return content, info, -1, nil
+}
+
+// videoPoster returns the poster of the video, a frame of it as a JPEG image, or nil if no framer is configured or the
+// frame cannot be extracted; the video is saved all the same, without a poster
+func (rt *_router) videoPoster(ctx reqcontext.RequestContext, content []byte, info video.Info) []byte {
+	if rt.framer == nil {
+		return nil
+	}
+
+	at := posterTime
+
+	if info.Duration < 2*posterTime {
+		at = info.Duration / 2
+	}
+
+	poster, err := rt.framer.Frame(ctx.Context, content, info.ContentType, at)
+
+	// the poster is served like the photos, hence it must be one
+	if err == nil {
+		posterInfo, inspectErr := imaging.Inspect(poster)
+
+		if inspectErr != nil || posterInfo.ContentType != imaging.JPEG {
+			err = errors.New("the poster is not a JPEG image")
+		}
+	}
+
+	if err != nil {
+		ctx.Logger.WithError(err).Warn("cannot extract the poster of the uploaded video")
+		return nil
+	}
+
+	return poster
+}
@@ -0,0 +1,422 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/api/reqcontext"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/database"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/webhook"
+	"github.com/julienschmidt/httprouter"
+)
+
+// maxWebhookUrlLength is the maximum length of the url of a webhook
+const maxWebhookUrlLength = 2048
+
+// minWebhookSecretLength and maxWebhookSecretLength bound the length of the secret of a webhook, which must be long
+// enough not to be guessed
+const (
+	minWebhookSecretLength = 16
+	maxWebhookSecretLength = 256
+)
+
+// webhookBatch is the maximum number of deliveries taken at once to be attempted
+const webhookBatch = 20
+
+// webhookBackoff is the wait before the second attempt of a delivery, which doubles after every failed attempt up to
+// maxWebhookBackoff
+const (
+	webhookBackoff    = 30 * time.Second
+	maxWebhookBackoff = 6 * time.Hour
+)
+
+// webhookPruneInterval is how often the deliveries older than the retention are removed
+const webhookPruneInterval = time.Hour
+
+// maxDeliveryErrorLength is the maximum length of the error of an attempt kept in the log of the deliveries
+const maxDeliveryErrorLength = 512
+
+// webhookPayload is the body POSTed to the webhooks for an event, whose data is the photo, the comment or the
+// following the event is about, as returned by the API
+type webhookPayload struct {
+	Event string      `json:"event"`
+	Date  time.Time   `json:"date"`
+	Data  interface{} `json:"data"`
+}
+
+// followPayload is the data of the user.followed event
+type followPayload struct {
+	User     User `json:"user"`
+	Followed User `json:"followed"`
+}
+
+// emitEvent records the event caused by the user `actor`, to be delivered to the webhooks subscribed to it by the
+// background job. The action the event tells about already happened, hence an event which cannot be recorded is only
+// logged.
+func (rt *_router) emitEvent(ctx reqcontext.RequestContext, event string, actor uint32, data interface{}) {
+	date := time.Now().UTC().Truncate(time.Second)
+
+	payload, err := json.Marshal(webhookPayload{
+		Event: event,
+		Date:  date,
+		Data:  data,
+	})
+
+	if err != nil {
+		ctx.Logger.WithError(err).WithField("event", event).Error("cannot encode the event for the webhooks")
+		return
+	}
+
+	dbEvent := database.DatabaseWebhookEventDefault()
+	dbEvent.Event = event
+	dbEvent.Actor = actor
+	dbEvent.Payload = string(payload)
+	dbEvent.Date = date
+
+	err = rt.db.InsertWebhookEvent(ctx.Context, dbEvent)
+
+	if err != nil {
+		ctx.Logger.WithError(err).WithField("event", event).Error("cannot record the event for the webhooks")
+	}
+}
+
+func (rt *_router) getWebhooks(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// authenticate the administrator performing the action
+	err := CheckAdminAuthorization(rt.adminToken, r.Header.Get("Authorization"))
+
+	if err != nil {
+		writeError(w, err, http.StatusUnauthorized)
+		return
+	}
+
+	// get the registered webhooks, without their secrets
+	dbWebhooks, err := rt.db.GetWebhooks(ctx.Context)
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK) // 200
+
+	// return the webhooks
+	_ = json.NewEncoder(w).Encode(WebhookListFromDatabaseWebhookArray(dbWebhooks))
+}
+
+func (rt *_router) registerWebhook(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// authenticate the administrator performing the action
+	err := CheckAdminAuthorization(rt.adminToken, r.Header.Get("Authorization"))
+
+	if err != nil {
+		writeError(w, err, http.StatusUnauthorized)
+		return
+	}
+
+	hook := WebhookDefault()
+
+	// get the url, the secret and the events of the webhook from the request body
+	code, err := decodeJSON(r, &hook)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	// check that the events are delivered to a server the backend can reach
+	parsedUrl, err := url.Parse(hook.Url)
+
+	if err != nil || (parsedUrl.Scheme != "http" && parsedUrl.Scheme != "https") || parsedUrl.Host == "" || len(hook.Url) > maxWebhookUrlLength {
+		writeError(w, ErrInvalidWebhookUrl, http.StatusBadRequest)
+		return
+	}
+
+	if len(hook.Secret) < minWebhookSecretLength || len(hook.Secret) > maxWebhookSecretLength {
+		writeError(w, ErrInvalidWebhookSecret, http.StatusBadRequest)
+		return
+	}
+
+	if len(hook.Events) == 0 {
+		writeError(w, ErrInvalidWebhookEvents, http.StatusBadRequest)
+		return
+	}
+
+	for _, event := range hook.Events {
+		if !webhook.IsEvent(event) {
+			writeError(w, ErrInvalidWebhookEvents, http.StatusBadRequest)
+			return
+		}
+	}
+
+	hook.Date = time.Now().UTC().Truncate(time.Second)
+
+	dbWebhook := hook.WebhookIntoDatabaseWebhook()
+
+	// insert the webhook into the database
+	err = rt.db.InsertWebhook(ctx.Context, &dbWebhook)
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	// get the webhook back, with its events sorted and without duplicates
+	dbWebhook, err = rt.db.GetWebhook(ctx.Context, dbWebhook.Id)
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	ctx.Logger.WithField("webhook", dbWebhook.Id).Info("webhook registered by the administrators")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated) // 201
+
+	// return the newly registered webhook
+	_ = json.NewEncoder(w).Encode(WebhookFromDatabaseWebhook(dbWebhook))
+}
+
+func (rt *_router) deleteWebhook(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// authenticate the administrator performing the action
+	err := CheckAdminAuthorization(rt.adminToken, r.Header.Get("Authorization"))
+
+	if err != nil {
+		writeError(w, err, http.StatusUnauthorized)
+		return
+	}
+
+	// get the webhook to be removed from the resource parameter
+	webhookId, err := strconv.ParseUint(ps.ByName("webhook_id"), 10, 32)
+
+	if err != nil {
+		writeError(w, ErrPageNotFound, http.StatusNotFound)
+		return
+	}
+
+	// remove the webhook, together with its pending deliveries
+	err = rt.db.DeleteWebhook(ctx.Context, uint32(webhookId))
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	ctx.Logger.WithField("webhook", webhookId).Info("webhook removed by the administrators")
+
+	w.WriteHeader(http.StatusNoContent) // 204
+}
+
+func (rt *_router) getWebhookDeliveries(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// authenticate the administrator performing the action
+	err := CheckAdminAuthorization(rt.adminToken, r.Header.Get("Authorization"))
+
+	if err != nil {
+		writeError(w, err, http.StatusUnauthorized)
+		return
+	}
+
+	// get the webhook from the resource parameter
+	webhookId, err := strconv.ParseUint(ps.ByName("webhook_id"), 10, 32)
+
+	if err != nil {
+		writeError(w, ErrPageNotFound, http.StatusNotFound)
+		return
+	}
+
+	_, err = rt.db.GetWebhook(ctx.Context, uint32(webhookId))
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	// get the pagination parameters from the query
+	limit, _, code, err := GetPageFromQuery(r)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	before, code, err := GetCursorFromQuery("before", r)
+
+	if err != nil {
+		writeError(w, err, code)
+		return
+	}
+
+	// get the page of the log of the deliveries, newest first
+	dbDeliveryList, err := rt.db.GetWebhookDeliveries(ctx.Context, uint32(webhookId), limit, before)
+
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK) // 200
+
+	// return the page of the deliveries
+	_ = json.NewEncoder(w).Encode(WebhookDeliveryListFromDatabaseWebhookDeliveryList(dbDeliveryList))
+}
+
+// deliverWebhooks delivers the events due to the webhooks every `interval`, and removes the deliveries older than the
+// retention every webhookPruneInterval, until the router is closed; the deliveries still being sent are then
+// cancelled, and attempted again once their lease expires
+func (rt *_router) deliverWebhooks(interval time.Duration) {
+	defer close(rt.webhookDone)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		<-rt.closing
+		cancel()
+	}()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var pruned time.Time
+
+	for {
+		select {
+		case <-rt.closing:
+			return
+		case <-ticker.C:
+			if time.Since(pruned) >= webhookPruneInterval {
+				rt.pruneWebhookDeliveries(ctx)
+				pruned = time.Now()
+			}
+
+			rt.deliverDueWebhooks(ctx)
+		}
+	}
+}
+
+// pruneWebhookDeliveries removes the ended deliveries of the events older than the retention
+func (rt *_router) pruneWebhookDeliveries(ctx context.Context) {
+	deleted, err := rt.db.DeleteOldWebhookDeliveries(ctx, time.Now().Add(-rt.webhookRetention))
+
+	if err != nil {
+		rt.baseLogger.WithError(err).Error("cannot remove the old deliveries of the webhooks")
+		return
+	}
+
+	if deleted > 0 {
+		rt.baseLogger.WithField("deliveries", deleted).Debug("old deliveries of the webhooks removed")
+	}
+}
+
+// deliverDueWebhooks takes the deliveries which are due and attempts each one. A delivery is taken for a lease long
+// enough to attempt the whole batch, so that no other instance attempts it meanwhile.
+func (rt *_router) deliverDueWebhooks(ctx context.Context) {
+	// the webhooks are looked up once per run
+	dbWebhooks := make(map[uint32]database.DatabaseWebhook)
+
+	for ctx.Err() == nil {
+		now := time.Now()
+
+		dbDeliveries, err := rt.db.TakeWebhookDeliveries(ctx, now, now.Add(rt.webhookTimeout*(webhookBatch+1)), webhookBatch)
+
+		if err != nil {
+			rt.baseLogger.WithError(err).Error("cannot get the deliveries of the webhooks")
+			return
+		}
+
+		for _, dbDelivery := range dbDeliveries {
+			dbWebhook, ok := dbWebhooks[dbDelivery.Webhook]
+
+			if !ok {
+				dbWebhook, err = rt.db.GetWebhook(ctx, dbDelivery.Webhook)
+
+				// the webhook was removed together with its deliveries
+				if errors.Is(err, database.ErrWebhookDoesNotExist) {
+					continue
+				}
+
+				if err != nil {
+					rt.baseLogger.WithError(err).WithField("webhook", dbDelivery.Webhook).Error("cannot get the webhook")
+					continue
+				}
+
+				dbWebhooks[dbWebhook.Id] = dbWebhook
+			}
+
+			rt.attemptDelivery(ctx, dbWebhook, dbDelivery)
+		}
+
+		// the deliveries are taken until there are no more of them
+		if len(dbDeliveries) < webhookBatch {
+			return
+		}
+	}
+}
+
+// attemptDelivery sends the delivery to its webhook and records how it went: a failed delivery is attempted again
+// after a backoff doubling every time, until it is given up after webhookMaxAttempts attempts
+func (rt *_router) attemptDelivery(ctx context.Context, dbWebhook database.DatabaseWebhook, dbDelivery database.DatabaseWebhookDelivery) {
+	status, err := rt.webhooks.Send(ctx, webhook.Delivery{
+		Id:      dbDelivery.Id,
+		Event:   dbDelivery.Event,
+		Url:     dbWebhook.Url,
+		Secret:  dbWebhook.Secret,
+		Payload: []byte(dbDelivery.Payload),
+	})
+
+	// the router is being closed, the delivery is
+	// attempted again once its lease expires
+	if ctx.Err() != nil {
+		return
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+
+	dbDelivery.Attempts++
+	dbDelivery.StatusCode = status
+	dbDelivery.NextAttemptAt = nil
+
+	logger := rt.baseLogger.WithField("webhook", dbWebhook.Id).WithField("delivery", dbDelivery.Id)
+
+	if err == nil {
+		dbDelivery.DeliveredAt = &now
+		dbDelivery.Error = ""
+	} else {
+		dbDelivery.Error = err.Error()
+
+		if len(dbDelivery.Error) > maxDeliveryErrorLength {
+			dbDelivery.Error = dbDelivery.Error[:maxDeliveryErrorLength]
+		}
+
+		if dbDelivery.Attempts < rt.webhookMaxAttempts {
+			backoff := webhookBackoff
+
+			for i := 1; i < dbDelivery.Attempts && backoff < maxWebhookBackoff; i++ {
+				backoff *= 2
+			}
+
+			if backoff > maxWebhookBackoff {
+				backoff = maxWebhookBackoff
+			}
+
+			next := now.Add(backoff)
+			dbDelivery.NextAttemptAt = &next
+
+			logger.WithError(err).Debug("delivery of the event failed, it will be attempted again")
+		} else {
+			logger.WithError(err).Warn("delivery of the event given up")
+		}
+	}
+
+	err = rt.db.UpdateWebhookDelivery(ctx, dbDelivery)
+
+	if err != nil {
+		logger.WithError(err).Error("cannot record the attempt of the delivery")
+	}
+}
@@ -0,0 +1,86 @@
+/*
+Package auth signs the users in through external identity providers, using the authorization code flow of OAuth 2.0:
+any OpenID Connect provider (like Google or the single sign-on of a university) and GitHub. The provider identifies each
+user with a subject, which the API links to a WASAPhoto user.
+
+Every provider implements the Provider interface, so that the API does not depend on how each one identifies the
+users. To sign in through an OpenID Connect provider, create a new instance with NewOIDC() passing its issuer, which is
+looked up through the discovery document of the provider:
+
+	// Create the provider of the university
+	oidc, err := auth.NewOIDC(ctx, auth.OIDCConfig{
+		Issuer:       "https://sso.example.edu",
+		ClientID:     "wasaphoto",
+		ClientSecret: secret,
+		RedirectURL:  "https://wasaphoto.example.edu/",
+	}, &http.Client{Timeout: 30 * time.Second})
+	if err != nil {
+		logger.WithError(err).Error("error creating the OIDC provider")
+		return fmt.Errorf("creating the OIDC provider: %w", err)
+	}
+
+See the `main.go` file inside the `cmd/webapi` for a full usage example.
+*/
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// Provider is the interface of the identity providers signing the users in.
+type Provider interface {
+	// AuthCodeURL returns the page of the provider where the user signs in, which then redirects them back to the
+	// client with an authorization code and `state`.
+	AuthCodeURL(state string) string
+
+	// Exchange trades the authorization code given to the client after the user signed in with `state` for their
+	// identity. ErrInvalidCode is returned if the provider does not accept the code.
+	Exchange(ctx context.Context, code string, state string) (Identity, error)
+}
+
+// Identity is a user as known by a provider.
+type Identity struct {
+	// Subject identifies the user within the provider, and never changes
+	Subject string
+
+	// Username is the name the user goes by on the provider, if any, which may change
+	Username string
+}
+
+// the providers, by the name under which their users are linked
+const (
+	ProviderOIDC   = "oidc"
+	ProviderGitHub = "github"
+)
+
+// ErrInvalidCode is returned when the provider does not accept the authorization code, eg. because it expired or was
+// already exchanged
+var ErrInvalidCode = errors.New("the authorization code is not valid")
+
+// maxResponseSize is the largest response read from a provider
+const maxResponseSize = 1 << 20
+
+// getJSON decodes into `v` the response to the request, which must succeed
+func getJSON(client *http.Client, req *http.Request, v interface{}) error {
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s %s: %s: %s", req.Method, req.URL.Redacted(), resp.Status, body)
+	}
+
+	return json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(v)
+}
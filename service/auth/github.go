@@ -0,0 +1,132 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// GitHubConfig is the configuration of the sign-in through GitHub.
+type GitHubConfig struct {
+	// ClientID and ClientSecret are the credentials of the OAuth app registered on GitHub
+	ClientID     string
+	ClientSecret string
+
+	// RedirectURL is where GitHub sends the users back after they signed in, as registered with the app
+	RedirectURL string
+
+	// Endpoint is the url of GitHub, https://github.com if empty
+	Endpoint string
+
+	// APIEndpoint is the url of the API of GitHub, https://api.github.com if empty
+	APIEndpoint string
+}
+
+// GitHub is the Provider signing the users in through GitHub, which is not an OpenID Connect provider: the users are
+// identified by their GitHub account, read through the API with the access token.
+type GitHub struct {
+	cfg    GitHubConfig
+	client *http.Client
+}
+
+// NewGitHub returns a GitHub provider sending the requests through `client`.
+func NewGitHub(cfg GitHubConfig, client *http.Client) (*GitHub, error) {
+	if cfg.ClientID == "" || cfg.RedirectURL == "" {
+		return nil, errors.New("the client id and the redirect url are required")
+	}
+
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = "https://github.com"
+	}
+
+	if cfg.APIEndpoint == "" {
+		cfg.APIEndpoint = "https://api.github.com"
+	}
+
+	cfg.Endpoint = strings.TrimSuffix(cfg.Endpoint, "/")
+	cfg.APIEndpoint = strings.TrimSuffix(cfg.APIEndpoint, "/")
+
+	return &GitHub{cfg: cfg, client: client}, nil
+}
+
+// AuthCodeURL asks only for the public profile of the user.
+func (g *GitHub) AuthCodeURL(state string) string {
+	return withQuery(g.cfg.Endpoint+"/login/oauth/authorize", url.Values{
+		"client_id":    {g.cfg.ClientID},
+		"redirect_uri": {g.cfg.RedirectURL},
+		"scope":        {"read:user"},
+		"state":        {state},
+	})
+}
+
+// Exchange does not use the state, which GitHub does not bind to the access token: the state is checked by the API
+// before the code is exchanged.
+func (g *GitHub) Exchange(ctx context.Context, code string, state string) (Identity, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, g.cfg.Endpoint+"/login/oauth/access_token", strings.NewReader(url.Values{
+		"client_id":     {g.cfg.ClientID},
+		"client_secret": {g.cfg.ClientSecret},
+		"code":          {code},
+		"redirect_uri":  {g.cfg.RedirectURL},
+	}.Encode()))
+
+	if err != nil {
+		return Identity{}, err
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	// GitHub tells the errors with a successful response
+	var token struct {
+		AccessToken string `json:"access_token"`
+		Error       string `json:"error"`
+	}
+
+	err = getJSON(g.client, req, &token)
+
+	if err != nil {
+		return Identity{}, fmt.Errorf("exchanging the authorization code: %w", err)
+	}
+
+	if token.Error == "bad_verification_code" {
+		return Identity{}, ErrInvalidCode
+	}
+
+	if token.Error != "" || token.AccessToken == "" {
+		return Identity{}, fmt.Errorf("exchanging the authorization code: %s", token.Error)
+	}
+
+	// read the account of the user
+	req, err = http.NewRequestWithContext(ctx, http.MethodGet, g.cfg.APIEndpoint+"/user", nil)
+
+	if err != nil {
+		return Identity{}, err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+
+	var user struct {
+		Id    int64  `json:"id"`
+		Login string `json:"login"`
+	}
+
+	err = getJSON(g.client, req, &user)
+
+	if err != nil {
+		return Identity{}, fmt.Errorf("reading the account: %w", err)
+	}
+
+	if user.Id == 0 {
+		return Identity{}, errors.New("the account lacks its id")
+	}
+
+	// the login can be changed, hence the
+	// numeric id is the subject of the user
+	return Identity{
+		Subject:  strconv.FormatInt(user.Id, 10),
+		Username: user.Login,
+	}, nil
+}
@@ -0,0 +1,240 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// the errors of the registered claims of a JSON Web Token, returned by Claims.Verify
+var (
+	ErrTokenIssuer  = errors.New("the token was issued by another issuer")
+	ErrTokenExpired = errors.New("the token expired")
+)
+
+// JWT is a JSON Web Token whose parts were decoded, and whose signature is yet to be verified.
+type JWT struct {
+	// Algorithm is the algorithm of the signature, as claimed by the header
+	Algorithm string
+
+	// KeyID is the id of the key which signed the token, if the header tells it
+	KeyID string
+
+	// SigningInput is the part of the token covered by the signature: the encoded header and payload
+	SigningInput string
+
+	// Signature is the decoded signature
+	Signature []byte
+
+	// Payload is the decoded payload, holding the claims
+	Payload []byte
+}
+
+// ParseJWT decodes the header, the payload and the signature of the JSON Web Token `token`, without verifying it.
+// The segments must be encoded canonically, so that a token has a single encoding.
+func ParseJWT(token string) (JWT, error) {
+	var jwt JWT
+
+	parts := strings.Split(token, ".")
+
+	if len(parts) != 3 {
+		return jwt, errors.New("malformed token")
+	}
+
+	encoding := base64.RawURLEncoding.Strict()
+
+	encodedHeader, err := encoding.DecodeString(parts[0])
+
+	if err != nil {
+		return jwt, fmt.Errorf("malformed header: %w", err)
+	}
+
+	var header struct {
+		Algorithm string `json:"alg"`
+		KeyID     string `json:"kid"`
+	}
+
+	err = json.Unmarshal(encodedHeader, &header)
+
+	if err != nil {
+		return jwt, fmt.Errorf("malformed header: %w", err)
+	}
+
+	jwt.Algorithm = header.Algorithm
+	jwt.KeyID = header.KeyID
+	jwt.SigningInput = parts[0] + "." + parts[1]
+
+	jwt.Payload, err = encoding.DecodeString(parts[1])
+
+	if err != nil {
+		return jwt, fmt.Errorf("malformed payload: %w", err)
+	}
+
+	jwt.Signature, err = encoding.DecodeString(parts[2])
+
+	if err != nil {
+		return jwt, fmt.Errorf("malformed signature: %w", err)
+	}
+
+	return jwt, nil
+}
+
+// Claims decodes the claims of the payload into `claims`, usually a struct embedding Claims.
+func (jwt JWT) Claims(claims interface{}) error {
+	err := json.Unmarshal(jwt.Payload, claims)
+
+	if err != nil {
+		return fmt.Errorf("malformed claims: %w", err)
+	}
+
+	return nil
+}
+
+// Claims are the registered claims of a JSON Web Token, checked by Verify.
+type Claims struct {
+	Id        string   `json:"jti,omitempty"`
+	Issuer    string   `json:"iss"`
+	Subject   string   `json:"sub"`
+	Audience  audience `json:"aud,omitempty"`
+	IssuedAt  int64    `json:"iat,omitempty"`
+	ExpiresAt int64    `json:"exp"`
+}
+
+// Verify returns ErrTokenIssuer if the token was not issued by `issuer`, and ErrTokenExpired if it has expired at `now`,
+// allowing for `leeway` between the clocks of the issuer and of the backend.
+func (c Claims) Verify(issuer string, now time.Time, leeway time.Duration) error {
+	if c.Issuer != issuer {
+		return ErrTokenIssuer
+	}
+
+	if now.Add(-leeway).Unix() >= c.ExpiresAt {
+		return ErrTokenExpired
+	}
+
+	return nil
+}
+
+// verifyJWT checks the signature of the JSON Web Token with the key returned by `key` for the id in its header,
+// returning it: RS256 is accepted for the RSA keys and ES256 for the P-256 keys, which are the algorithms of the ID
+// tokens of the common providers.
+func verifyJWT(token string, key func(kid string) (interface{}, error)) (JWT, error) {
+	jwt, err := ParseJWT(token)
+
+	if err != nil {
+		return jwt, err
+	}
+
+	verifier, err := key(jwt.KeyID)
+
+	if err != nil {
+		return jwt, err
+	}
+
+	signature := jwt.Signature
+	digest := sha256.Sum256([]byte(jwt.SigningInput))
+
+	// the algorithm must match the key, so that
+	// a token cannot pick a weaker verification
+	switch verifier := verifier.(type) {
+	case *rsa.PublicKey:
+		if jwt.Algorithm != "RS256" {
+			return jwt, fmt.Errorf("unexpected algorithm %q", jwt.Algorithm)
+		}
+
+		err = rsa.VerifyPKCS1v15(verifier, crypto.SHA256, digest[:], signature)
+	case *ecdsa.PublicKey:
+		if jwt.Algorithm != "ES256" {
+			return jwt, fmt.Errorf("unexpected algorithm %q", jwt.Algorithm)
+		}
+
+		// ES256 signatures are the two integers
+		// of the signature, each one of 32 bytes
+		if len(signature) != 64 || !ecdsa.Verify(verifier, digest[:], new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:])) {
+			err = errors.New("invalid signature")
+		}
+	default:
+		err = errors.New("unsupported signing key")
+	}
+
+	if err != nil {
+		return jwt, err
+	}
+
+	return jwt, nil
+}
+
+// jsonWebKeySet is the set of public keys published by a provider
+type jsonWebKeySet struct {
+	Keys []struct {
+		KeyType string `json:"kty"`
+		KeyID   string `json:"kid"`
+		Use     string `json:"use"`
+
+		// the modulus and the exponent of the RSA keys
+		N string `json:"n"`
+		E string `json:"e"`
+
+		// the curve and the coordinates of the EC keys
+		Curve string `json:"crv"`
+		X     string `json:"x"`
+		Y     string `json:"y"`
+	} `json:"keys"`
+}
+
+// keys returns the signing keys of the set by their id, skipping the ones which cannot be read
+func (s jsonWebKeySet) keys() map[string]interface{} {
+	keys := make(map[string]interface{})
+
+	for _, jwk := range s.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+
+		switch jwk.KeyType {
+		case "RSA":
+			n, errN := base64.RawURLEncoding.DecodeString(jwk.N)
+			e, errE := base64.RawURLEncoding.DecodeString(jwk.E)
+
+			if errN != nil || errE != nil || len(e) == 0 || len(e) > 4 {
+				continue
+			}
+
+			keys[jwk.KeyID] = &rsa.PublicKey{
+				N: new(big.Int).SetBytes(n),
+				E: int(new(big.Int).SetBytes(e).Int64()),
+			}
+		case "EC":
+			x, errX := base64.RawURLEncoding.DecodeString(jwk.X)
+			y, errY := base64.RawURLEncoding.DecodeString(jwk.Y)
+
+			if jwk.Curve != "P-256" || errX != nil || errY != nil {
+				continue
+			}
+
+			key := &ecdsa.PublicKey{
+				Curve: elliptic.P256(),
+				X:     new(big.Int).SetBytes(x),
+				Y:     new(big.Int).SetBytes(y),
+			}
+
+			// the point must be on the curve, or
+			// the verification would be unsound
+			if !key.Curve.IsOnCurve(key.X, key.Y) {
+				continue
+			}
+
+			keys[jwk.KeyID] = key
+		}
+	}
+
+	return keys
+}
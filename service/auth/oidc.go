@@ -0,0 +1,288 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OIDCConfig is the configuration of an OpenID Connect provider.
+type OIDCConfig struct {
+	// Issuer is the url identifying the provider, under which its discovery document is published
+	Issuer string
+
+	// ClientID and ClientSecret are the credentials of the client registered with the provider
+	ClientID     string
+	ClientSecret string
+
+	// RedirectURL is where the provider sends the users back after they signed in, as registered with it
+	RedirectURL string
+}
+
+// OIDC is the Provider signing the users in through an OpenID Connect provider, which identifies them in the ID
+// tokens it signs.
+type OIDC struct {
+	cfg    OIDCConfig
+	client *http.Client
+
+	// the endpoints of the provider, read from its discovery document
+	authorizationEndpoint string
+	tokenEndpoint         string
+	jwksURI               string
+
+	// keys are the keys of the provider verifying the ID tokens, by their id; they
+	// are fetched again when a token is signed by an unknown key, since the
+	// provider rotates them, but at most once every keysRefreshInterval
+	mu            sync.Mutex
+	keys          map[string]interface{}
+	keysFetchedAt time.Time
+}
+
+// keysRefreshInterval is the shortest time between two fetches of the keys of a provider
+const keysRefreshInterval = time.Minute
+
+// idTokenLeeway is the clock skew tolerated when checking the expiration of the ID tokens
+const idTokenLeeway = time.Minute
+
+// NewOIDC returns an OIDC provider reading its endpoints from the discovery document of the issuer, sending the
+// requests through `client`.
+func NewOIDC(ctx context.Context, cfg OIDCConfig, client *http.Client) (*OIDC, error) {
+	if cfg.Issuer == "" || cfg.ClientID == "" || cfg.RedirectURL == "" {
+		return nil, errors.New("the issuer, the client id and the redirect url are required")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(cfg.Issuer, "/")+"/.well-known/openid-configuration", nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var discovery struct {
+		Issuer                string `json:"issuer"`
+		AuthorizationEndpoint string `json:"authorization_endpoint"`
+		TokenEndpoint         string `json:"token_endpoint"`
+		JWKSURI               string `json:"jwks_uri"`
+	}
+
+	err = getJSON(client, req, &discovery)
+
+	if err != nil {
+		return nil, fmt.Errorf("reading the discovery document: %w", err)
+	}
+
+	// the tokens are issued by exactly the configured issuer
+	if discovery.Issuer != cfg.Issuer {
+		return nil, fmt.Errorf("the discovery document belongs to the issuer %q", discovery.Issuer)
+	}
+
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JWKSURI == "" {
+		return nil, errors.New("the discovery document lacks the endpoints of the authorization code flow")
+	}
+
+	return &OIDC{
+		cfg:                   cfg,
+		client:                client,
+		authorizationEndpoint: discovery.AuthorizationEndpoint,
+		tokenEndpoint:         discovery.TokenEndpoint,
+		jwksURI:               discovery.JWKSURI,
+		keys:                  make(map[string]interface{}),
+	}, nil
+}
+
+// AuthCodeURL asks for the profile of the user; the state is also the nonce of the ID token,
+// binding the token to the sign-in which requested it.
+func (o *OIDC) AuthCodeURL(state string) string {
+	return withQuery(o.authorizationEndpoint, url.Values{
+		"response_type": {"code"},
+		"client_id":     {o.cfg.ClientID},
+		"redirect_uri":  {o.cfg.RedirectURL},
+		"scope":         {"openid profile"},
+		"state":         {state},
+		"nonce":         {state},
+	})
+}
+
+func (o *OIDC) Exchange(ctx context.Context, code string, state string) (Identity, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, o.tokenEndpoint, strings.NewReader(url.Values{
+		"grant_type":   {"authorization_code"},
+		"code":         {code},
+		"redirect_uri": {o.cfg.RedirectURL},
+	}.Encode()))
+
+	if err != nil {
+		return Identity{}, err
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(o.cfg.ClientID), url.QueryEscape(o.cfg.ClientSecret))
+
+	resp, err := o.client.Do(req)
+
+	if err != nil {
+		return Identity{}, err
+	}
+
+	defer resp.Body.Close()
+
+	var token struct {
+		IDToken string `json:"id_token"`
+		Error   string `json:"error"`
+	}
+
+	err = json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(&token)
+
+	if resp.StatusCode == http.StatusBadRequest && token.Error == "invalid_grant" {
+		return Identity{}, ErrInvalidCode
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return Identity{}, fmt.Errorf("exchanging the authorization code: %s %s", resp.Status, token.Error)
+	}
+
+	if err != nil {
+		return Identity{}, fmt.Errorf("reading the tokens: %w", err)
+	}
+
+	claims, err := o.verifyIDToken(ctx, token.IDToken)
+
+	if err != nil {
+		return Identity{}, err
+	}
+
+	err = claims.Verify(o.cfg.Issuer, time.Now(), idTokenLeeway)
+
+	if err != nil {
+		return Identity{}, fmt.Errorf("%w: %s", ErrInvalidCode, err)
+	}
+
+	if !claims.Audience.contains(o.cfg.ClientID) || (claims.AuthorizedParty != "" && claims.AuthorizedParty != o.cfg.ClientID) {
+		return Identity{}, fmt.Errorf("%w: the ID token was issued for another client", ErrInvalidCode)
+	}
+
+	if claims.Nonce != state {
+		return Identity{}, fmt.Errorf("%w: the ID token was issued for another sign-in", ErrInvalidCode)
+	}
+
+	if claims.Subject == "" {
+		return Identity{}, errors.New("the ID token lacks the subject")
+	}
+
+	identity := Identity{
+		Subject:  claims.Subject,
+		Username: claims.PreferredUsername,
+	}
+
+	if identity.Username == "" {
+		identity.Username = claims.Name
+	}
+
+	return identity, nil
+}
+
+// idTokenClaims are the claims of an ID token read by the provider
+type idTokenClaims struct {
+	Claims
+	AuthorizedParty   string `json:"azp"`
+	Nonce             string `json:"nonce"`
+	PreferredUsername string `json:"preferred_username"`
+	Name              string `json:"name"`
+}
+
+// audience is the audience of an ID token, either a single client or a list of them
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+
+	if json.Unmarshal(data, &single) == nil {
+		*a = audience{single}
+		return nil
+	}
+
+	return json.Unmarshal(data, (*[]string)(a))
+}
+
+func (a audience) contains(clientID string) bool {
+	for _, client := range a {
+		if client == clientID {
+			return true
+		}
+	}
+
+	return false
+}
+
+// verifyIDToken checks the signature of the ID token with the keys of the provider, returning its claims
+func (o *OIDC) verifyIDToken(ctx context.Context, idToken string) (idTokenClaims, error) {
+	var claims idTokenClaims
+
+	jwt, err := verifyJWT(idToken, func(kid string) (interface{}, error) {
+		return o.key(ctx, kid)
+	})
+
+	if err != nil {
+		return claims, fmt.Errorf("%w: %s", ErrInvalidCode, err)
+	}
+
+	err = jwt.Claims(&claims)
+
+	if err != nil {
+		return claims, fmt.Errorf("reading the ID token: %w", err)
+	}
+
+	return claims, nil
+}
+
+// key returns the key of the provider with the given id, fetching the keys again if it is unknown
+func (o *OIDC) key(ctx context.Context, kid string) (interface{}, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if key, ok := o.keys[kid]; ok {
+		return key, nil
+	}
+
+	if time.Since(o.keysFetchedAt) < keysRefreshInterval {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, o.jwksURI, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var jwks jsonWebKeySet
+
+	err = getJSON(o.client, req, &jwks)
+
+	if err != nil {
+		return nil, fmt.Errorf("reading the signing keys: %w", err)
+	}
+
+	o.keys = jwks.keys()
+	o.keysFetchedAt = time.Now()
+
+	if key, ok := o.keys[kid]; ok {
+		return key, nil
+	}
+
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// withQuery adds the values to the query of the url, which may already have one
+func withQuery(endpoint string, values url.Values) string {
+	if strings.Contains(endpoint, "?") {
+		return endpoint + "&" + values.Encode()
+	}
+
+	return endpoint + "?" + values.Encode()
+}
@@ -0,0 +1,103 @@
+// Package blocklist matches the texts written by the users against a list of blocked words and regular expressions.
+package blocklist
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// Blocklist holds the blocked words and the blocked patterns. The zero value blocks nothing.
+type Blocklist struct {
+	// words are the blocked words, each one split into its lowercase tokens
+	words [][]string
+
+	// patterns are the blocked regular expressions, with the term they were compiled from
+	patterns []pattern
+}
+
+type pattern struct {
+	term string
+	re   *regexp.Regexp
+}
+
+// New returns a Blocklist blocking the given words and the given regular expressions (with the syntax of the regexp
+// package). The words are matched ignoring the case and only as whole words, a word made of several words matching
+// them in a row; the patterns are matched as they are, anywhere in the text. An error is returned if a word has no
+// letters or digits, since it would match nothing, or if a pattern does not compile.
+func New(words []string, patterns []string) (*Blocklist, error) {
+	b := &Blocklist{}
+
+	for _, word := range words {
+		tokens := tokenize(word)
+
+		if len(tokens) == 0 {
+			return nil, fmt.Errorf("invalid blocked word %q: it has no letters or digits", word)
+		}
+
+		b.words = append(b.words, tokens)
+	}
+
+	for _, term := range patterns {
+		re, err := regexp.Compile(term)
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid blocked pattern %q: %w", term, err)
+		}
+
+		b.patterns = append(b.patterns, pattern{term: term, re: re})
+	}
+
+	return b, nil
+}
+
+// Match returns the first blocked word or pattern found in the text, and whether there is any.
+func (b *Blocklist) Match(text string) (string, bool) {
+	if b == nil {
+		return "", false
+	}
+
+	tokens := tokenize(text)
+
+	for _, word := range b.words {
+		if containsRun(tokens, word) {
+			return strings.Join(word, " "), true
+		}
+	}
+
+	for _, p := range b.patterns {
+		if p.re.MatchString(text) {
+			return p.term, true
+		}
+	}
+
+	return "", false
+}
+
+// tokenize splits the text into its lowercase words, made of letters and digits
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// containsRun returns whether the tokens contain the given run of tokens, in a row
+func containsRun(tokens []string, run []string) bool {
+	for i := 0; i+len(run) <= len(tokens); i++ {
+		match := true
+
+		for j := range run {
+			if tokens[i+j] != run[j] {
+				match = false
+				break
+			}
+		}
+
+		if match {
+			return true
+		}
+	}
+
+	return false
+}
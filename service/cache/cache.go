@@ -0,0 +1,46 @@
+/*
+Package cache keeps the results of the hot reads of the database (eg. the counters of the profiles and of the photos)
+for a while, so that they are not computed again on every request.
+
+Every backend implements the Cache interface. The entries are kept in groups, each holding the entries which change
+together (eg. the followers count of a profile as seen by each user), so that a write invalidates the whole group at
+once. To keep the entries in Redis, create a new instance with NewRedis() passing the url of the server:
+
+	// Create the cache of the hot reads
+	c, err := cache.NewRedis(cfg.Cache.RedisURL, cfg.Cache.Prefix)
+	if err != nil {
+		logger.WithError(err).Error("error creating the cache")
+		return fmt.Errorf("creating the cache: %w", err)
+	}
+	defer c.Close()
+
+See the `main.go` file inside the `cmd/webapi` for a full usage example.
+*/
+package cache
+
+import (
+	"context"
+	"time"
+)
+
+// Cache is the interface of the backends keeping the entries. The values are opaque bytes, encoded by the callers.
+type Cache interface {
+	// Get returns the value of the entry `key` of the group `group`, and false if it is missing or expired.
+	Get(ctx context.Context, group string, key string) ([]byte, bool, error)
+
+	// Set saves `value` as the entry `key` of the group `group`, which expires after `ttl`.
+	Set(ctx context.Context, group string, key string, value []byte, ttl time.Duration) error
+
+	// Invalidate removes every entry of the groups.
+	Invalidate(ctx context.Context, groups ...string) error
+}
+
+// Stats holds the counters of the lookups of a cache
+type Stats struct {
+	// Hits and Misses are the number of entries found and not found
+	Hits   uint64
+	Misses uint64
+
+	// Errors is the number of operations which failed
+	Errors uint64
+}
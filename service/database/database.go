@@ -16,7 +16,7 @@ This is an example on how to migrate the DB and connect to it:
 
 	// Start Database
 	logger.Println("initializing database support")
-	db, err := sql.Open("sqlite3", "./foo.db")
+	db, err := sql.Open("sqlite3", database.SQLiteConfig{JournalMode: "WAL"}.DataSourceName("./foo.db"))
 	if err != nil {
 		logger.WithError(err).Error("error opening SQLite DB")
 		return fmt.Errorf("opening SQLite: %w", err)
@@ -26,182 +26,408 @@ This is an example on how to migrate the DB and connect to it:
 		_ = db.Close()
 	}()
 
-Then you can initialize the AppDatabase and pass it to the api package.
+Then you can initialize the AppDatabase and pass it to the api package. Use New for SQLite connections and NewPostgres
+for PostgreSQL connections: queries are written once and adapted to each engine by its dialect (see db-dialect.go).
 */
 package database
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
+	"sync/atomic"
+	"time"
+
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/cache"
 )
 
 // AppDatabase is the high level interface for the DB
 type AppDatabase interface {
 	// Ban
-	InsertBan(dbUser DatabaseUser, bannedDbUser DatabaseUser) error             // DONE
-	DeleteBan(dbUser DatabaseUser, bannedDbUser DatabaseUser) error             // DONE
-	CheckBan(firstDbUser DatabaseUser, secondDbUser DatabaseUser) (bool, error) // DONE
+	InsertBan(ctx context.Context, dbUser DatabaseUser, dbBan DatabaseBan) error                     // DONE
+	DeleteBan(ctx context.Context, dbUser DatabaseUser, bannedDbUser DatabaseUser) error             // DONE
+	CheckBan(ctx context.Context, firstDbUser DatabaseUser, secondDbUser DatabaseUser) (bool, error) // DONE
+	GetBanList(ctx context.Context, dbUser DatabaseUser) (DatabaseBanList, error)                    // DONE
+	DeleteExpiredBans(ctx context.Context, now time.Time) (int, error)                               // DONE
+
+	// Mute
+	InsertMute(ctx context.Context, dbUser DatabaseUser, mutedDbUser DatabaseUser) error              // DONE
+	DeleteMute(ctx context.Context, dbUser DatabaseUser, mutedDbUser DatabaseUser) error              // DONE
+	CheckMute(ctx context.Context, firstDbUser DatabaseUser, secondDbUser DatabaseUser) (bool, error) // DONE
+	GetMutedList(ctx context.Context, dbUser DatabaseUser) (DatabaseUserList, error)                  // DONE
+
+	// Close friend
+	InsertCloseFriend(ctx context.Context, dbUser DatabaseUser, friendDbUser DatabaseUser) error             // DONE
+	DeleteCloseFriend(ctx context.Context, dbUser DatabaseUser, friendDbUser DatabaseUser) error             // DONE
+	CheckCloseFriend(ctx context.Context, firstDbUser DatabaseUser, secondDbUser DatabaseUser) (bool, error) // DONE
+	GetCloseFriendsList(ctx context.Context, dbUser DatabaseUser) (DatabaseUserList, error)                  // DONE
 
 	// Follow
-	InsertFollow(dbUser DatabaseUser, followedDbUser DatabaseUser) error                          // DONE
-	DeleteFollow(dbUser DatabaseUser, followedDbUser DatabaseUser) error                          // DONE
-	GetFollowersCount(profileDbUser DatabaseUser, dbUser DatabaseUser) (int, error)               // DONE
-	GetFollowingCount(profileDbUser DatabaseUser, dbUser DatabaseUser) (int, error)               // DONE
-	GetFollowersList(followersDbUser DatabaseUser, dbUser DatabaseUser) (DatabaseUserList, error) // DONE
-	GetFollowingList(followingDbUser DatabaseUser, dbUser DatabaseUser) (DatabaseUserList, error) // DONE
-	GetFollowStatus(firstDbUser DatabaseUser, secondDbUser DatabaseUser) (bool, error)            // DONE
+	InsertFollow(ctx context.Context, dbUser DatabaseUser, followedDbUser DatabaseUser) error                          // DONE
+	DeleteFollow(ctx context.Context, dbUser DatabaseUser, followedDbUser DatabaseUser) error                          // DONE
+	GetFollowersCount(ctx context.Context, profileDbUser DatabaseUser, dbUser DatabaseUser) (int, error)               // DONE
+	GetFollowingCount(ctx context.Context, profileDbUser DatabaseUser, dbUser DatabaseUser) (int, error)               // DONE
+	GetFollowersList(ctx context.Context, followersDbUser DatabaseUser, dbUser DatabaseUser) (DatabaseUserList, error) // DONE
+	GetFollowingList(ctx context.Context, followingDbUser DatabaseUser, dbUser DatabaseUser) (DatabaseUserList, error) // DONE
+	GetFollowStatus(ctx context.Context, firstDbUser DatabaseUser, secondDbUser DatabaseUser) (bool, error)            // DONE
+
+	// Follow request
+	InsertFollowRequest(ctx context.Context, dbUser DatabaseUser, followedDbUser DatabaseUser, date time.Time) error // DONE
+	DeleteFollowRequest(ctx context.Context, dbUser DatabaseUser, followedDbUser DatabaseUser) error                 // DONE
+	ApproveFollowRequest(ctx context.Context, dbUser DatabaseUser, requesterDbUser DatabaseUser) error               // DONE
+	GetFollowRequests(ctx context.Context, dbUser DatabaseUser) (DatabaseUserList, error)                            // DONE
+	CheckFollowRequest(ctx context.Context, dbUser DatabaseUser, followedDbUser DatabaseUser) (bool, error)          // DONE
 
 	// Photo
-	GetDatabasePhoto(photoId uint32, dbUser DatabaseUser) (DatabasePhoto, error) // DONE
-	InsertPhoto(dbPhoto *DatabasePhoto) error                                    // DONE
-	DeletePhoto(dbPhoto DatabasePhoto) error                                     // DONE
-	GetPhotoLikeCount(dbPhoto *DatabasePhoto, dbUser DatabaseUser) error         // DONE
-	GetPhotoCommentCount(dbPhoto *DatabasePhoto, dbUser DatabaseUser) error      // DONE
-	GetPhotoLikeStatus(dbPhoto *DatabasePhoto, dbUser DatabaseUser) error        // DONE
-	GetPhotos(dbProfile *DatabaseProfile, dbUser DatabaseUser) error             // DONE
-	GetPhotoCount(dbUser DatabaseUser) (int, error)                              // DONE
+	GetDatabasePhoto(ctx context.Context, photoId uint32, dbUser DatabaseUser) (DatabasePhoto, error)                              // DONE
+	InsertPhoto(ctx context.Context, dbPhoto *DatabasePhoto) error                                                                 // DONE
+	GetSimilarPhoto(ctx context.Context, dbUser DatabaseUser, hash uint64, distance int) (DatabasePhoto, error)                    // DONE
+	DeletePhoto(ctx context.Context, dbPhoto DatabasePhoto) error                                                                  // DONE
+	IsUrlUsed(ctx context.Context, url string) (bool, error)                                                                       // DONE
+	GetPhotoLikeCount(ctx context.Context, dbPhoto *DatabasePhoto, dbUser DatabaseUser) error                                      // DONE
+	GetPhotoCommentCount(ctx context.Context, dbPhoto *DatabasePhoto, dbUser DatabaseUser) error                                   // DONE
+	GetPhotoLikeStatus(ctx context.Context, dbPhoto *DatabasePhoto, dbUser DatabaseUser) error                                     // DONE
+	GetPhotoStats(ctx context.Context, dbPhoto *DatabasePhoto, dbUser DatabaseUser) error                                          // DONE
+	GetPhotos(ctx context.Context, dbProfile *DatabaseProfile, dbUser DatabaseUser, archived bool, limit int, before uint32) error // DONE
+	GetPhotoCount(ctx context.Context, profileDbUser DatabaseUser, dbUser DatabaseUser) (int, error)                               // DONE
+	SetPhotoAltText(ctx context.Context, dbPhoto DatabasePhoto, altText string) error                                              // DONE
+	EditPhoto(ctx context.Context, dbPhoto DatabasePhoto, url string, originalUrl string) (string, error)                          // DONE
+	PublishScheduledPhotos(ctx context.Context, now time.Time) ([]DatabasePhoto, error)                                            // DONE
+	ArchivePhoto(ctx context.Context, dbPhoto DatabasePhoto) error                                                                 // DONE
+	UnarchivePhoto(ctx context.Context, dbPhoto DatabasePhoto) error                                                               // DONE
+	PinPhoto(ctx context.Context, dbPhoto DatabasePhoto, maxPinned int, date time.Time) error                                      // DONE
+	UnpinPhoto(ctx context.Context, dbPhoto DatabasePhoto) error                                                                   // DONE
+	RebuildPhotoCounters(ctx context.Context) error                                                                                // DONE
 
 	// Like
-	InsertLike(dbUser DatabaseUser, dbPhoto DatabasePhoto) error                      // DONE
-	DeleteLike(dbUser DatabaseUser, dbPhoto DatabasePhoto) error                      // DONE
-	GetLikeList(dbPhoto DatabasePhoto, dbUser DatabaseUser) (DatabaseUserList, error) // DONE
+	InsertLike(ctx context.Context, dbUser DatabaseUser, dbPhoto DatabasePhoto, reaction string) error                                                       // DONE
+	DeleteLike(ctx context.Context, dbUser DatabaseUser, dbPhoto DatabasePhoto) error                                                                        // DONE
+	GetLikeList(ctx context.Context, dbPhoto DatabasePhoto, dbUser DatabaseUser, limit int, after uint32) (DatabaseLikeList, error)                          // DONE
+	GetReactionList(ctx context.Context, dbPhoto DatabasePhoto, dbUser DatabaseUser, reaction string, limit int, after uint32) (DatabaseReactionList, error) // DONE
+	GetPhotosLikes(ctx context.Context, photoIds []uint32, dbUser DatabaseUser, limit int, after uint32) (map[uint32][]DatabaseUser, error)                  // DONE
 
 	// Comment
-	GetDatabaseComment(commentId uint32, dbUser DatabaseUser) (DatabaseComment, error)      // DONE
-	InsertComment(dbComment *DatabaseComment) error                                         // DONE
-	DeleteComment(dbComment DatabaseComment) error                                          // DONE
-	GetCommentList(dbPhoto DatabasePhoto, dbUser DatabaseUser) (DatabaseCommentList, error) // DONE
+	GetDatabaseComment(ctx context.Context, commentId uint32, dbUser DatabaseUser) (DatabaseComment, error)                                                      // DONE
+	InsertComment(ctx context.Context, dbComment *DatabaseComment) error                                                                                         // DONE
+	DeleteComment(ctx context.Context, dbComment DatabaseComment) error                                                                                          // DONE
+	GetCommentList(ctx context.Context, dbPhoto DatabasePhoto, dbUser DatabaseUser, sort string, limit int, after uint32) (DatabaseCommentList, error)           // DONE
+	GetPhotosComments(ctx context.Context, photoIds []uint32, dbUser DatabaseUser, limit int, after uint32) (map[uint32][]DatabaseComment, error)                // DONE
+	SearchComments(ctx context.Context, dbUser DatabaseUser, text string, limit int, before uint32) (DatabaseCommentList, error)                                 // DONE
+	GetCommentActivity(ctx context.Context, dbUser DatabaseUser, body string, duplicatesSince time.Time, recentSince time.Time) (DatabaseCommentActivity, error) // DONE
+
+	// Mention
+	GetMentions(ctx context.Context, dbUser DatabaseUser, limit int, before uint32) (DatabaseCommentList, error) // DONE
+
+	// Notification
+	GetNotifications(ctx context.Context, dbUser DatabaseUser, unread bool, limit int, before uint32) (DatabaseNotificationList, error)  // DONE
+	GetNotificationsAfter(ctx context.Context, dbUser DatabaseUser, after uint32, limit int) (DatabaseNotificationList, error)           // DONE
+	GetUnreadNotificationCount(ctx context.Context, dbUser DatabaseUser) (int, error)                                                    // DONE
+	MarkNotificationsRead(ctx context.Context, dbUser DatabaseUser, notificationIds []uint32) error                                      // DONE
+	MarkAllNotificationsRead(ctx context.Context, dbUser DatabaseUser) error                                                             // DONE
+	TakeNotificationsToPush(ctx context.Context, limit int) ([]DatabaseNotification, error)                                              // DONE
+	GetNotificationPreferences(ctx context.Context, dbUser DatabaseUser) (map[string]DatabaseNotificationPreference, error)              // DONE
+	UpdateNotificationPreferences(ctx context.Context, dbUser DatabaseUser, preferences map[string]DatabaseNotificationPreference) error // DONE
+
+	// Device
+	GetDatabaseDevice(ctx context.Context, deviceId uint32) (DatabaseDevice, error) // DONE
+	InsertDevice(ctx context.Context, dbDevice *DatabaseDevice) error               // DONE
+	DeleteDevice(ctx context.Context, dbDevice DatabaseDevice) error                // DONE
+	GetDevices(ctx context.Context, dbUser DatabaseUser) ([]DatabaseDevice, error)  // DONE
+
+	// Session
+	GetDatabaseSession(ctx context.Context, tokenHash string) (DatabaseSession, error)                                                                  // DONE
+	InsertSession(ctx context.Context, dbSession *DatabaseSession, dbRefreshToken *DatabaseRefreshToken) error                                          // DONE
+	TouchSession(ctx context.Context, dbSession DatabaseSession, date time.Time) error                                                                  // DONE
+	DeleteSession(ctx context.Context, dbSession DatabaseSession) error                                                                                 // DONE
+	DeleteUserSessions(ctx context.Context, dbUser DatabaseUser) error                                                                                  // DONE
+	GetDatabaseRefreshToken(ctx context.Context, tokenHash string) (DatabaseRefreshToken, error)                                                        // DONE
+	RotateRefreshToken(ctx context.Context, dbRefreshToken DatabaseRefreshToken, newDbRefreshToken *DatabaseRefreshToken, accessTokenHash string) error // DONE
+
+	// Identity
+	GetIdentityUser(ctx context.Context, provider string, subject string) (DatabaseUser, error)      // DONE
+	InsertIdentity(ctx context.Context, dbIdentity DatabaseIdentity) error                           // DONE
+	InsertIdentityUser(ctx context.Context, dbUser *DatabaseUser, dbIdentity DatabaseIdentity) error // DONE
+	CheckIdentity(ctx context.Context, dbLogin DatabaseLogin) (bool, error)                          // DONE
+
+	// API key
+	GetDatabaseAPIKey(ctx context.Context, keyHash string) (DatabaseAPIKey, error)  // DONE
+	GetAPIKeys(ctx context.Context, dbUser DatabaseUser) ([]DatabaseAPIKey, error)  // DONE
+	InsertAPIKey(ctx context.Context, dbAPIKey *DatabaseAPIKey, maxKeys int) error  // DONE
+	TouchAPIKey(ctx context.Context, dbAPIKey DatabaseAPIKey, date time.Time) error // DONE
+	DeleteAPIKey(ctx context.Context, dbAPIKey DatabaseAPIKey) error                // DONE
+
+	// Hashtag
+	GetHashtagPhotos(ctx context.Context, dbUser DatabaseUser, hashtag string, limit int, before uint32) (DatabaseHashtagFeed, error) // DONE
+	SearchHashtags(ctx context.Context, dbUser DatabaseUser, query string, limit int) ([]DatabaseHashtagCount, error)                 // DONE
+	RebuildHashtags(ctx context.Context) error                                                                                        // DONE
+
+	// Album
+	GetDatabaseAlbum(ctx context.Context, albumId uint32, dbUser DatabaseUser) (DatabaseAlbum, error)          // DONE
+	InsertAlbum(ctx context.Context, dbAlbum *DatabaseAlbum) error                                             // DONE
+	UpdateAlbum(ctx context.Context, dbAlbum DatabaseAlbum) error                                              // DONE
+	DeleteAlbum(ctx context.Context, dbAlbum DatabaseAlbum) error                                              // DONE
+	SetAlbumPhotos(ctx context.Context, dbAlbum DatabaseAlbum, photoIds []uint32) error                        // DONE
+	GetAlbums(ctx context.Context, profileDbUser DatabaseUser, dbUser DatabaseUser) (DatabaseAlbumList, error) // DONE
+
+	// Place
+	GetPlacePhotos(ctx context.Context, dbUser DatabaseUser, place string, limit int, before uint32) (DatabasePlaceFeed, error) // DONE
+
+	// Explore
+	GetExplorePhotos(ctx context.Context, dbUser DatabaseUser, since time.Time, limit int, offset int) (DatabaseExploreFeed, error) // DONE
+
+	// Trending
+	GetTrending(ctx context.Context, dbUser DatabaseUser, since time.Time, limit int) (DatabaseTrending, error) // DONE
+
+	// Story
+	GetDatabaseStory(ctx context.Context, storyId uint32) (DatabaseStory, error)                        // DONE
+	InsertStory(ctx context.Context, dbStory *DatabaseStory) error                                      // DONE
+	DeleteStory(ctx context.Context, dbStory DatabaseStory) error                                       // DONE
+	GetStories(ctx context.Context, storyDbUser DatabaseUser, now time.Time) (DatabaseStoryList, error) // DONE
+	GetStoryTray(ctx context.Context, dbUser DatabaseUser, now time.Time) (DatabaseStoryTray, error)    // DONE
+	DeleteExpiredStories(ctx context.Context, now time.Time) ([]DatabaseStory, error)                   // DONE
+
+	// Digest
+	GetDigestRecipients(ctx context.Context, sentBefore time.Time, after uint32, limit int) ([]DatabaseDigest, error) // DONE
+	GetDigest(ctx context.Context, dbDigest *DatabaseDigest, limit int) error                                         // DONE
+	SetDigestSent(ctx context.Context, dbUser DatabaseUser, date time.Time) error                                     // DONE
 
 	// Stream
-	GetDatabaseStream(dbUser DatabaseUser) (DatabaseStream, error) // DONE
+	GetDatabaseStream(ctx context.Context, dbUser DatabaseUser, filter DatabaseStreamFilter, limit int, before uint32, after uint32) (DatabaseStream, error) // DONE
+	SetStreamSeen(ctx context.Context, dbUser DatabaseUser, date time.Time) error                                                                            // DONE
+	GetStreamUpdates(ctx context.Context, dbUser DatabaseUser, since uint32) (DatabaseStreamUpdates, error)                                                  // DONE
 
 	// User
-	GetDatabaseUser(userId uint32) (DatabaseUser, error)                              // DONE
-	GetDatabaseUserFromDatabaseLogin(dbLogin DatabaseLogin) (DatabaseUser, error)     // DONE
-	InsertUser(dbUser *DatabaseUser) error                                            // DONE
-	UpdateUser(oldDbUser DatabaseUser, newDbUser DatabaseUser) error                  // DONE
-	GetUserList(dbUser DatabaseUser, dbLogin DatabaseLogin) (DatabaseUserList, error) // DONE
+	GetDatabaseUser(ctx context.Context, userId uint32) (DatabaseUser, error)                                              // DONE
+	GetDatabaseUserFromDatabaseLogin(ctx context.Context, dbLogin DatabaseLogin) (DatabaseUser, error)                     // DONE
+	InsertUser(ctx context.Context, dbUser *DatabaseUser) error                                                            // DONE
+	UpdateUser(ctx context.Context, oldDbUser DatabaseUser, newDbUser DatabaseUser, reservedUntil time.Time) error         // DONE
+	GetRenamedUser(ctx context.Context, username string) (DatabaseUser, error)                                             // DONE
+	DeleteUser(ctx context.Context, dbUser DatabaseUser) ([]string, error)                                                 // DONE
+	DeactivateUser(ctx context.Context, dbUser DatabaseUser, date time.Time) error                                         // DONE
+	ReactivateUser(ctx context.Context, dbLogin DatabaseLogin, since time.Time) ([]string, error)                          // DONE
+	GetUserList(ctx context.Context, dbUser DatabaseUser, dbLogin DatabaseLogin) (DatabaseUserList, error)                 // DONE
+	SearchUsers(ctx context.Context, dbUser DatabaseUser, query string, limit int, after uint32) (DatabaseUserList, error) // DONE
+	GetUserSettings(ctx context.Context, dbUser DatabaseUser) (DatabaseSettings, error)                                    // DONE
+	UpdateUserSettings(ctx context.Context, dbUser DatabaseUser, dbSettings DatabaseSettings) error                        // DONE
+	VerifyUserEmail(ctx context.Context, dbUser DatabaseUser, email string) error                                          // DONE
+	SetUserAvatar(ctx context.Context, dbUser DatabaseUser, avatar string) (string, error)                                 // DONE
+
+	// Erasure
+	RequestErasure(ctx context.Context, dbUser DatabaseUser, date time.Time) (DatabaseErasure, error) // DONE
+	GetPendingErasures(ctx context.Context, limit int) ([]DatabaseErasure, error)                     // DONE
+	EraseUser(ctx context.Context, dbErasure DatabaseErasure, date time.Time) ([]string, error)       // DONE
+	GetErasures(ctx context.Context, limit int, after uint32) (DatabaseErasureList, error)            // DONE
+
+	// Export
+	GetExport(ctx context.Context, dbUser DatabaseUser) (DatabaseExport, error)                           // DONE
+	GetImportedPhotos(ctx context.Context, dbUser DatabaseUser, source string) (map[uint32]uint32, error) // DONE
+	ImportPhoto(ctx context.Context, dbImport *DatabaseImport) error                                      // DONE
+
+	// Webhook
+	GetWebhooks(ctx context.Context) ([]DatabaseWebhook, error)                                                                // DONE
+	GetWebhook(ctx context.Context, webhookId uint32) (DatabaseWebhook, error)                                                 // DONE
+	InsertWebhook(ctx context.Context, dbWebhook *DatabaseWebhook) error                                                       // DONE
+	DeleteWebhook(ctx context.Context, webhookId uint32) error                                                                 // DONE
+	InsertWebhookEvent(ctx context.Context, dbEvent DatabaseWebhookEvent) error                                                // DONE
+	TakeWebhookDeliveries(ctx context.Context, now time.Time, lease time.Time, limit int) ([]DatabaseWebhookDelivery, error)   // DONE
+	UpdateWebhookDelivery(ctx context.Context, dbDelivery DatabaseWebhookDelivery) error                                       // DONE
+	GetWebhookDeliveries(ctx context.Context, webhookId uint32, limit int, before uint32) (DatabaseWebhookDeliveryList, error) // DONE
+	DeleteOldWebhookDeliveries(ctx context.Context, before time.Time) (int, error)                                             // DONE
+
+	// Idempotency key
+	ReserveIdempotencyKey(ctx context.Context, dbKey DatabaseIdempotencyKey, expired time.Time, abandoned time.Time) error // DONE
+	GetIdempotencyKey(ctx context.Context, userId uint32, key string) (DatabaseIdempotencyKey, error)                      // DONE
+	CompleteIdempotencyKey(ctx context.Context, dbKey DatabaseIdempotencyKey) error                                        // DONE
+	DeleteIdempotencyKey(ctx context.Context, userId uint32, key string) error                                             // DONE
+	DeleteExpiredIdempotencyKeys(ctx context.Context, before time.Time) (int, error)                                       // DONE
 
 	// Liveness
-	Ping() error // DONE
+	Ping(ctx context.Context) error                      // DONE
+	SchemaVersion(ctx context.Context) (int, int, error) // DONE
+
+	// Metrics
+	QueryStats() map[string]QueryStats // DONE
+
+	// Cache
+	UseCache(c cache.Cache, ttl CacheTTL) // DONE
+
+	// Usernames
+	UseUsernameKey(ctx context.Context, key func(string) string) error // DONE
+
+	// Backup
+	Backup(ctx context.Context, path string) error // DONE
+
+	// Admin
+	GetAdminUserList(ctx context.Context, query string, limit int, after uint32) (DatabaseAdminUserList, error) // DONE
+	SuspendUser(ctx context.Context, dbUser DatabaseUser, date time.Time) error                                 // DONE
+	UnsuspendUser(ctx context.Context, dbUser DatabaseUser) error                                               // DONE
+	ForceDeletePhoto(ctx context.Context, photoId uint32) (DatabasePhoto, error)                                // DONE
+	ForceDeleteComment(ctx context.Context, commentId uint32) error                                             // DONE
+	GetFlaggedPhotos(ctx context.Context, limit int, after uint32) (DatabaseFlaggedPhotoList, error)            // DONE
+	UnflagPhoto(ctx context.Context, photoId uint32) error                                                      // DONE
+	ShadowBanUser(ctx context.Context, dbUser DatabaseUser) error                                               // DONE
+	UnshadowBanUser(ctx context.Context, dbUser DatabaseUser) error                                             // DONE
+
+	// Blocklist
+	GetBlockedTerms(ctx context.Context) ([]DatabaseBlockedTerm, error)                               // DONE
+	InsertBlockedTerm(ctx context.Context, dbBlockedTerm *DatabaseBlockedTerm) error                  // DONE
+	DeleteBlockedTerm(ctx context.Context, termId uint32) error                                       // DONE
+	InsertHeldComment(ctx context.Context, dbHeldComment *DatabaseHeldComment) error                  // DONE
+	GetHeldCommentList(ctx context.Context, limit int, after uint32) (DatabaseHeldCommentList, error) // DONE
+	ReleaseHeldComment(ctx context.Context, heldId uint32) (DatabaseComment, error)                   // DONE
+	DeleteHeldComment(ctx context.Context, heldId uint32) error                                       // DONE
+
+	// Reserved names
+	GetReservedNames(ctx context.Context) ([]DatabaseReservedName, error)               // DONE
+	InsertReservedName(ctx context.Context, dbReservedName *DatabaseReservedName) error // DONE
+	DeleteReservedName(ctx context.Context, nameId uint32) error                        // DONE
+
+	// Audit
+	GetAuditLog(ctx context.Context, actor uint32, action string, limit int, before uint32) (DatabaseAuditLog, error) // DONE
 }
 
 type appdbimpl struct {
-	c *sql.DB
+	c *dbconn
+
+	// replicas are the read-only connections serving the reads which can
+	// lag behind the writes, taken in turn; empty if c serves every query
+	replicas []*dbconn
+	next     uint32
+
+	// fullText is true if the comments can be searched
+	// through the full text index of the engine
+	fullText bool
+
+	// cache keeps the counters of the profiles and the photos,
+	// for at most ttl; nil if they are always read from the database
+	cache cache.Cache
+	ttl   CacheTTL
+
+	// users keeps the users looked up by id
+	users *userCache
+
+	// usernameKey gives the key the users are looked up by to their usernames
+	usernameKey func(string) string
 }
 
 // New returns a new instance of AppDatabase based on the SQLite connection `db`.
 // `db` is required - an error will be returned if `db` is `nil`.
-func New(db *sql.DB) (AppDatabase, error) {
+// The optional `replicas` are read-only connections to copies of the database,
+// which serve the streams, the lists and the profile counters.
+func New(db *sql.DB, replicas ...*sql.DB) (AppDatabase, error) {
+	return newAppDatabase(db, replicas, sqliteDialect{})
+}
+
+// NewPostgres returns a new instance of AppDatabase based on the PostgreSQL connection `db`.
+// `db` is required - an error will be returned if `db` is `nil`.
+// The optional `replicas` are read-only connections to standby servers,
+// which serve the streams, the lists and the profile counters.
+func NewPostgres(db *sql.DB, replicas ...*sql.DB) (AppDatabase, error) {
+	return newAppDatabase(db, replicas, postgresDialect{})
+}
+
+// newAppDatabase prepares the connection `db` and creates the database structure using the SQL dialect `d`.
+// The structure of the `replicas` is not touched, as it is copied from `db`.
+func newAppDatabase(db *sql.DB, replicas []*sql.DB, d dialect) (AppDatabase, error) {
 	if db == nil {
 		return nil, errors.New("database is required when building a AppDatabase")
 	}
 
-	var err error
-
-	// enable checks for foreign keys
-	_, err = db.Exec("PRAGMA foreign_key=ON")
+	err := d.setup(db)
 
 	if err != nil {
 		return nil, err
 	}
 
-	userTable := `
-		CREATE TABLE IF NOT EXISTS User (
-			id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
-			username TEXT NOT NULL UNIQUE
-		);
-	`
-	photoTable := `
-		CREATE TABLE IF NOT EXISTS Photo (
-			id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
-			user INTEGER NOT NULL,
-			url TEXT NOT NULL,
-			date TEXT NOT NULL,
-			FOREIGN KEY (user) REFERENCES User(name)
-		);
-	`
-	commentTable := `
-		CREATE TABLE IF NOT EXISTS Comment (
-			id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
-			user INTEGER NOT NULL,
-			photo INTEGER NOT NULL,
-			date TEXT NOT NULL,
-			comment_body TEXT NOT NULL,
-			FOREIGN KEY (user) REFERENCES User(name),
-			FOREIGN KEY (photo) REFERENCES Photo(id)
-		);
-	`
-	followTable := `
-		CREATE TABLE IF NOT EXISTS follow (
-			first_user INTEGER NOT NULL,
-			second_user INTEGER NOT NULL,
-			PRIMARY KEY (first_user, second_user),
-			FOREIGN KEY (first_user) REFERENCES User(name),
-			FOREIGN KEY (second_user) REFERENCES User(name)
-		);
-	`
-	banTable := `
-		CREATE TABLE IF NOT EXISTS ban (
-			first_user INTEGER NOT NULL,
-			second_user INTEGER NOT NULL,
-			PRIMARY KEY (first_user, second_user),
-			FOREIGN KEY (first_user) REFERENCES User(name),
-			FOREIGN KEY (second_user) REFERENCES User(name)
-		);
-	`
-	likeTable := `
-		CREATE TABLE IF NOT EXISTS like (
-			user INTEGER NOT NULL,
-			photo INTEGER NOT NULL,
-			PRIMARY KEY (user, photo),
-			FOREIGN KEY (user) REFERENCES User(name),
-			FOREIGN KEY (photo) REFERENCES Photo(id)
-		);
-	`
-
-	_, err = db.Exec(userTable)
+	err = migrate(db, d)
 
 	if err != nil {
 		return nil, fmt.Errorf("error creating database structure: %w", err)
 	}
 
-	_, err = db.Exec(photoTable)
+	fullText, err := d.setupSearch(db)
 
 	if err != nil {
-		return nil, fmt.Errorf("error creating database structure: %w", err)
+		return nil, fmt.Errorf("error creating the search index: %w", err)
 	}
 
-	_, err = db.Exec(commentTable)
+	m := newMetrics()
 
-	if err != nil {
-		return nil, fmt.Errorf("error creating database structure: %w", err)
+	appdb := &appdbimpl{
+		c:        &dbconn{DB: db, d: d, m: m},
+		fullText: fullText,
+		users:    newUserCache(),
+		// the usernames are their own keys until a policy is used
+		usernameKey: func(username string) string { return username },
 	}
 
-	_, err = db.Exec(followTable)
+	for i, replica := range replicas {
+		if replica == nil {
+			return nil, fmt.Errorf("replica %d is nil", i)
+		}
 
-	if err != nil {
-		return nil, fmt.Errorf("error creating database structure: %w", err)
+		err = d.setup(replica)
+
+		if err != nil {
+			return nil, fmt.Errorf("error preparing replica %d: %w", i, err)
+		}
+
+		appdb.replicas = append(appdb.replicas, &dbconn{DB: replica, d: d, m: m})
 	}
 
-	_, err = db.Exec(banTable)
+	return appdb, nil
+}
+
+// read returns the connection for a query which can read data slightly older than
+// the last writes, going through the replicas in turn or using the primary if there
+// are none. Reads which must see the changes just made by the same request, or
+// which guard a write, must use db.c instead.
+func (db *appdbimpl) read() *dbconn {
+	if len(db.replicas) == 0 {
+		return db.c
+	}
+
+	n := atomic.AddUint32(&db.next, 1)
+
+	return db.replicas[n%uint32(len(db.replicas))]
+}
+
+func (db *appdbimpl) Ping(ctx context.Context) error {
+	err := db.c.PingContext(ctx)
 
 	if err != nil {
-		return nil, fmt.Errorf("error creating database structure: %w", err)
+		return err
+	}
+
+	for i, replica := range db.replicas {
+		err = replica.PingContext(ctx)
+
+		if err != nil {
+			return fmt.Errorf("replica %d: %w", i, err)
+		}
 	}
 
-	_, err = db.Exec(likeTable)
+	return nil
+}
+
+// SchemaVersion returns the version of the structure of the database, as recorded by the migrations, and the latest
+// version known to the package, which are the same once every migration has been applied
+func (db *appdbimpl) SchemaVersion(ctx context.Context) (int, int, error) {
+	var version int
+
+	err := db.c.QueryRowContext(ctx, `
+		SELECT version
+		FROM schema_version
+	`).Scan(&version)
 
 	if err != nil {
-		return nil, fmt.Errorf("error creating database structure: %w", err)
+		return 0, 0, err
 	}
 
-	return &appdbimpl{
-		c: db,
-	}, nil
+	return version, len(db.c.d.migrations()), nil
 }
 
-func (db *appdbimpl) Ping() error {
-	return db.c.Ping()
+func (db *appdbimpl) QueryStats() map[string]QueryStats {
+	return db.c.m.snapshot()
 }
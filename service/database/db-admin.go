@@ -0,0 +1,422 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+func (db *appdbimpl) GetAdminUserList(ctx context.Context, query string, limit int, after uint32) (DatabaseAdminUserList, error) {
+	dbAdminUserList := DatabaseAdminUserListDefault()
+
+	// the wildcards of LIKE in the query must be matched literally
+	pattern := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(strings.ToLower(query))
+
+	// get a page of at most `limit` users whose username contains
+	// the query (every user, if it is empty), sorted by id and
+	// starting right after the user `after`; the deactivated, the
+	// suspended and the shadow banned users are listed as well
+	rows, err := db.c.QueryContext(ctx, `
+		SELECT id, username, COALESCE(email, ''), email_verified, deactivated_at, suspended_at, shadow_banned
+		FROM "User"
+		WHERE LOWER(username) LIKE '%'||CAST(? AS TEXT)||'%' ESCAPE '\'
+		AND id > ?
+		ORDER BY id
+		LIMIT ?
+	`, pattern, after, limit+1)
+
+	if err != nil {
+		return dbAdminUserList, err
+	}
+
+	defer rows.Close()
+
+	// build the list
+	for rows.Next() {
+		dbAdminUser := DatabaseAdminUserDefault()
+
+		var deactivatedAt, suspendedAt sql.NullInt64
+
+		err = rows.Scan(&dbAdminUser.User.Id, &dbAdminUser.User.Username, &dbAdminUser.Email, &dbAdminUser.EmailVerified, &deactivatedAt, &suspendedAt, &dbAdminUser.ShadowBanned)
+
+		if err != nil {
+			return dbAdminUserList, err
+		}
+
+		if deactivatedAt.Valid {
+			date := time.Unix(deactivatedAt.Int64, 0).UTC()
+			dbAdminUser.DeactivatedAt = &date
+		}
+
+		if suspendedAt.Valid {
+			date := time.Unix(suspendedAt.Int64, 0).UTC()
+			dbAdminUser.SuspendedAt = &date
+		}
+
+		dbAdminUserList.Users = append(dbAdminUserList.Users, dbAdminUser)
+	}
+
+	if rows.Err() != nil {
+		return dbAdminUserList, rows.Err()
+	}
+
+	// if there is a next page, its cursor
+	// is the last user of the current one
+	if len(dbAdminUserList.Users) > limit {
+		dbAdminUserList.Users = dbAdminUserList.Users[:limit]
+		dbAdminUserList.NextCursor = dbAdminUserList.Users[limit-1].User.Id
+	}
+
+	return dbAdminUserList, nil
+}
+
+func (db *appdbimpl) SuspendUser(ctx context.Context, dbUser DatabaseUser, date time.Time) error {
+	// the user is hidden like a deactivated one, signed
+	// out of every session and stripped of their API keys
+	defer db.users.remove(dbUser.Id)
+
+	return db.withTx(ctx, func(tx *dbtx) error {
+		var suspendedAt sql.NullInt64
+
+		err := tx.QueryRowContext(ctx, `
+			SELECT suspended_at
+			FROM "User"
+			WHERE id=?
+		`, dbUser.Id).Scan(&suspendedAt)
+
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrUserDoesNotExist
+		}
+
+		// suspending the user again changes nothing
+		if err != nil || suspendedAt.Valid {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			UPDATE "User"
+			SET suspended_at=?, deactivated_at=COALESCE(deactivated_at, ?)
+			WHERE id=?
+		`, date.Unix(), date.Unix(), dbUser.Id)
+
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			DELETE FROM session
+			WHERE "user"=?
+		`, dbUser.Id)
+
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			DELETE FROM api_key
+			WHERE "user"=?
+		`, dbUser.Id)
+
+		if err != nil {
+			return err
+		}
+
+		return insertAuditTx(ctx, tx, AuditAdmin, AuditSuspendUser, dbUser.Id, dbUser.Username)
+	})
+}
+
+func (db *appdbimpl) UnsuspendUser(ctx context.Context, dbUser DatabaseUser) error {
+	defer db.users.remove(dbUser.Id)
+
+	return db.withTx(ctx, func(tx *dbtx) error {
+		// restore the account of the user
+		res, err := tx.ExecContext(ctx, `
+			UPDATE "User"
+			SET suspended_at=NULL, deactivated_at=NULL
+			WHERE id=?
+			AND suspended_at IS NOT NULL
+		`, dbUser.Id)
+
+		if err != nil {
+			return err
+		}
+
+		aff, err := res.RowsAffected()
+
+		if err != nil {
+			return err
+		}
+
+		// if there are no affected rows then the
+		// user did not exist or was not suspended
+		if aff == 0 {
+			return ErrUserNotSuspended
+		}
+
+		return insertAuditTx(ctx, tx, AuditAdmin, AuditUnsuspendUser, dbUser.Id, dbUser.Username)
+	})
+}
+
+func (db *appdbimpl) ShadowBanUser(ctx context.Context, dbUser DatabaseUser) error {
+	err := db.withTx(ctx, func(tx *dbtx) error {
+		var shadowBanned bool
+
+		err := tx.QueryRowContext(ctx, `
+			SELECT shadow_banned
+			FROM "User"
+			WHERE id=?
+		`, dbUser.Id).Scan(&shadowBanned)
+
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrUserDoesNotExist
+		}
+
+		// shadow banning the user again changes nothing
+		if err != nil || shadowBanned {
+			return err
+		}
+
+		// hide the photos and the comments of the user
+		// to everyone but the user
+		_, err = tx.ExecContext(ctx, `
+			UPDATE "User"
+			SET shadow_banned=TRUE
+			WHERE id=?
+		`, dbUser.Id)
+
+		if err != nil {
+			return err
+		}
+
+		return insertAuditTx(ctx, tx, AuditAdmin, AuditShadowBanUser, dbUser.Id, dbUser.Username)
+	})
+
+	if err != nil {
+		return err
+	}
+
+	db.invalidate(ctx, photosGroup(dbUser.Id))
+
+	return nil
+}
+
+func (db *appdbimpl) UnshadowBanUser(ctx context.Context, dbUser DatabaseUser) error {
+	err := db.withTx(ctx, func(tx *dbtx) error {
+		// show the photos and the comments of the user again
+		res, err := tx.ExecContext(ctx, `
+			UPDATE "User"
+			SET shadow_banned=FALSE
+			WHERE id=?
+			AND shadow_banned
+		`, dbUser.Id)
+
+		if err != nil {
+			return err
+		}
+
+		aff, err := res.RowsAffected()
+
+		if err != nil {
+			return err
+		}
+
+		// if there are no affected rows then the
+		// user did not exist or was not shadow banned
+		if aff == 0 {
+			return ErrUserNotShadowBanned
+		}
+
+		return insertAuditTx(ctx, tx, AuditAdmin, AuditUnshadowBanUser, dbUser.Id, dbUser.Username)
+	})
+
+	if err != nil {
+		return err
+	}
+
+	db.invalidate(ctx, photosGroup(dbUser.Id))
+
+	return nil
+}
+
+func (db *appdbimpl) ForceDeletePhoto(ctx context.Context, photoId uint32) (DatabasePhoto, error) {
+	dbPhoto := DatabasePhotoDefault()
+
+	// remove the photo whoever can see it, getting its owner, its url,
+	// its original and its poster to remove their files afterwards
+	err := db.withTx(ctx, func(tx *dbtx) error {
+		err := tx.QueryRowContext(ctx, `
+			SELECT id, "user", url, media_type, poster_url, original_url
+			FROM Photo
+			WHERE id=?
+		`, photoId).Scan(&dbPhoto.Id, &dbPhoto.User.Id, &dbPhoto.Url, &dbPhoto.MediaType, &dbPhoto.PosterUrl, &dbPhoto.OriginalUrl)
+
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrPhotoDoesNotExist
+		}
+
+		if err != nil {
+			return err
+		}
+
+		err = deletePhotoTx(ctx, tx, dbPhoto.Id)
+
+		if err != nil {
+			return err
+		}
+
+		return insertAuditTx(ctx, tx, AuditAdmin, AuditAdminDeletePhoto, dbPhoto.Id, dbPhoto.Url)
+	})
+
+	if err != nil {
+		return DatabasePhotoDefault(), err
+	}
+
+	db.invalidate(ctx, photosGroup(dbPhoto.User.Id), photoGroup(dbPhoto.Id))
+
+	return dbPhoto, nil
+}
+
+func (db *appdbimpl) ForceDeleteComment(ctx context.Context, commentId uint32) error {
+	var photoId uint32
+
+	err := db.withTx(ctx, func(tx *dbtx) error {
+		// remove the comment whoever can see it, getting
+		// the photo it was under and its body for the log
+		var body string
+
+		err := tx.QueryRowContext(ctx, `
+			DELETE FROM Comment
+			WHERE id=?
+			RETURNING photo, comment_body
+		`, commentId).Scan(&photoId, &body)
+
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrCommentDoesNotExist
+		}
+
+		if err != nil {
+			return err
+		}
+
+		err = addPhotoCommentCount(ctx, tx, photoId, -1)
+
+		if err != nil {
+			return err
+		}
+
+		return insertAuditTx(ctx, tx, AuditAdmin, AuditAdminDeleteComment, commentId, body)
+	})
+
+	if err != nil {
+		return err
+	}
+
+	db.invalidate(ctx, photoGroup(photoId))
+
+	return nil
+}
+
+func (db *appdbimpl) GetFlaggedPhotos(ctx context.Context, limit int, after uint32) (DatabaseFlaggedPhotoList, error) {
+	dbFlaggedPhotoList := DatabaseFlaggedPhotoListDefault()
+
+	// get a page of at most `limit` photos flagged as
+	// unsafe, from the oldest to the newest, starting
+	// right after the photo `after`
+	rows, err := db.c.QueryContext(ctx, `
+		SELECT id, "user"
+		FROM Photo
+		WHERE flagged
+		AND id > ?
+		ORDER BY id
+		LIMIT ?
+	`, after, limit+1)
+
+	if err != nil {
+		return dbFlaggedPhotoList, err
+	}
+
+	// the ids are read before the photos are
+	// loaded, which takes other connections
+	dbPhotos := make([]DatabasePhoto, 0)
+
+	for rows.Next() {
+		dbPhoto := DatabasePhotoDefault()
+
+		err = rows.Scan(&dbPhoto.Id, &dbPhoto.User.Id)
+
+		if err != nil {
+			_ = rows.Close()
+			return dbFlaggedPhotoList, err
+		}
+
+		dbPhotos = append(dbPhotos, dbPhoto)
+	}
+
+	if rows.Err() != nil {
+		_ = rows.Close()
+		return dbFlaggedPhotoList, rows.Err()
+	}
+
+	_ = rows.Close()
+
+	// the photos are loaded as their owner sees them,
+	// since nobody else can see them
+	for _, dbPhoto := range dbPhotos {
+		dbPhoto, err = db.GetDatabasePhoto(ctx, dbPhoto.Id, dbPhoto.User)
+
+		if err != nil {
+			return dbFlaggedPhotoList, err
+		}
+
+		dbFlaggedPhotoList.Photos = append(dbFlaggedPhotoList.Photos, dbPhoto)
+	}
+
+	// if there is a next page, its cursor
+	// is the last photo of the current one
+	if len(dbFlaggedPhotoList.Photos) > limit {
+		dbFlaggedPhotoList.Photos = dbFlaggedPhotoList.Photos[:limit]
+		dbFlaggedPhotoList.NextCursor = dbFlaggedPhotoList.Photos[limit-1].Id
+	}
+
+	return dbFlaggedPhotoList, nil
+}
+
+func (db *appdbimpl) UnflagPhoto(ctx context.Context, photoId uint32) error {
+	var userId uint32
+
+	err := db.withTx(ctx, func(tx *dbtx) error {
+		// show the photo to the others, getting
+		// its owner and its url for the log
+		var url string
+
+		err := tx.QueryRowContext(ctx, `
+			UPDATE Photo
+			SET flagged=FALSE
+			WHERE id=?
+			AND flagged
+			RETURNING "user", url
+		`, photoId).Scan(&userId, &url)
+
+		// if there are no rows then the photo
+		// did not exist or was not flagged
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrPhotoNotFlagged
+		}
+
+		if err != nil {
+			return err
+		}
+
+		return insertAuditTx(ctx, tx, AuditAdmin, AuditUnflagPhoto, photoId, url)
+	})
+
+	if err != nil {
+		return err
+	}
+
+	db.invalidate(ctx, photosGroup(userId), photoGroup(photoId))
+
+	return nil
+}
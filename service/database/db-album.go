@@ -0,0 +1,283 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+func (db *appdbimpl) GetDatabaseAlbum(ctx context.Context, albumId uint32, dbUser DatabaseUser) (DatabaseAlbum, error) {
+	dbAlbum := DatabaseAlbumDefault()
+
+	err := db.c.QueryRowContext(ctx, `
+		SELECT id, "user", name, date
+		FROM album
+		WHERE id=?
+	`, albumId).Scan(&dbAlbum.Id, &dbAlbum.User.Id, &dbAlbum.Name, unixTime{&dbAlbum.Date})
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return dbAlbum, ErrAlbumDoesNotExist
+	}
+
+	if err != nil {
+		return dbAlbum, err
+	}
+
+	// get the user information
+	dbAlbum.User, err = db.GetDatabaseUser(ctx, dbAlbum.User.Id)
+
+	if err != nil {
+		return dbAlbum, err
+	}
+
+	// get the photos of the album in their order,
+	// the archived ones being only visible to the owner
+	rows, err := db.c.QueryContext(ctx, `
+		SELECT album_photo.photo
+		FROM album_photo
+		JOIN Photo ON Photo.id=album_photo.photo
+		WHERE album_photo.album=?
+		AND (NOT Photo.archived OR Photo."user"=?)
+		AND `+visiblePhoto+`
+		ORDER BY album_photo.position
+	`, dbAlbum.Id, dbUser.Id, dbUser.Id, dbUser.Id, dbUser.Id)
+
+	if err != nil {
+		return dbAlbum, err
+	}
+
+	// build the photo list
+	for rows.Next() {
+		dbPhoto := DatabasePhotoDefault()
+
+		err = rows.Scan(&dbPhoto.Id)
+
+		if err != nil {
+			return dbAlbum, err
+		}
+
+		dbPhoto, err = db.GetDatabasePhoto(ctx, dbPhoto.Id, dbUser)
+
+		if err != nil {
+			return dbAlbum, err
+		}
+
+		dbAlbum.Photos = append(dbAlbum.Photos, dbPhoto)
+	}
+
+	if rows.Err() != nil {
+		return dbAlbum, err
+	}
+
+	_ = rows.Close()
+
+	dbAlbum.PhotoCount = len(dbAlbum.Photos)
+
+	if dbAlbum.PhotoCount > 0 {
+		dbAlbum.CoverUrl = dbAlbum.Photos[0].Url
+	}
+
+	return dbAlbum, err
+}
+
+func (db *appdbimpl) InsertAlbum(ctx context.Context, dbAlbum *DatabaseAlbum) error {
+	// insert the album into the database
+	// and get the album id
+	return db.retry(ctx, func() error {
+		return db.c.QueryRowContext(ctx, `
+			INSERT INTO album("user", name, date)
+			VALUES (?, ?, ?)
+			RETURNING id
+		`, dbAlbum.User.Id, dbAlbum.Name, dbAlbum.Date.Unix()).Scan(&dbAlbum.Id)
+	})
+}
+
+func (db *appdbimpl) UpdateAlbum(ctx context.Context, dbAlbum DatabaseAlbum) error {
+	var res sql.Result
+
+	// rename the album
+	err := db.retry(ctx, func() (err error) {
+		res, err = db.c.ExecContext(ctx, `
+			UPDATE album
+			SET name=?
+			WHERE id=?
+		`, dbAlbum.Name, dbAlbum.Id)
+
+		return err
+	})
+
+	if err != nil {
+		return err
+	}
+
+	aff, err := res.RowsAffected()
+
+	if err != nil {
+		return err
+	}
+
+	// if there are no affected rows
+	// then the album did not exist
+	if aff == 0 {
+		return ErrAlbumDoesNotExist
+	}
+
+	return nil
+}
+
+func (db *appdbimpl) DeleteAlbum(ctx context.Context, dbAlbum DatabaseAlbum) error {
+	var res sql.Result
+
+	// remove the album from the database, its photos
+	// are left untouched as only their membership
+	// goes away together with the album
+	err := db.retry(ctx, func() (err error) {
+		res, err = db.c.ExecContext(ctx, `
+			DELETE FROM album
+			WHERE id=?
+		`, dbAlbum.Id)
+
+		return err
+	})
+
+	if err != nil {
+		return err
+	}
+
+	aff, err := res.RowsAffected()
+
+	if err != nil {
+		return err
+	}
+
+	// if there are no affected rows
+	// then the album did not exist
+	if aff == 0 {
+		return ErrAlbumDoesNotExist
+	}
+
+	return nil
+}
+
+func (db *appdbimpl) SetAlbumPhotos(ctx context.Context, dbAlbum DatabaseAlbum, photoIds []uint32) error {
+	return db.withTx(ctx, func(tx *dbtx) error {
+		// get the owner of the album, whose
+		// photos are the only ones allowed
+		var userId uint32
+
+		err := tx.QueryRowContext(ctx, `
+			SELECT "user"
+			FROM album
+			WHERE id=?
+		`, dbAlbum.Id).Scan(&userId)
+
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrAlbumDoesNotExist
+		}
+
+		if err != nil {
+			return err
+		}
+
+		// replace the photos of the album
+		// with the given ones, in their order
+		_, err = tx.ExecContext(ctx, `
+			DELETE FROM album_photo
+			WHERE album=?
+		`, dbAlbum.Id)
+
+		if err != nil {
+			return err
+		}
+
+		for position, photoId := range photoIds {
+			res, err := tx.ExecContext(ctx, `
+				INSERT INTO album_photo(album, photo, position)
+				SELECT ?, id, ?
+				FROM Photo
+				WHERE id=?
+				AND "user"=?
+			`, dbAlbum.Id, position, photoId, userId)
+
+			if err != nil {
+				return err
+			}
+
+			aff, err := res.RowsAffected()
+
+			if err != nil {
+				return err
+			}
+
+			// if there are no affected rows then the
+			// photo does not exist or is not of the owner
+			if aff == 0 {
+				return ErrPhotoDoesNotExist
+			}
+		}
+
+		return nil
+	})
+}
+
+func (db *appdbimpl) GetAlbums(ctx context.Context, profileDbUser DatabaseUser, dbUser DatabaseUser) (DatabaseAlbumList, error) {
+	dbAlbumList := DatabaseAlbumListDefault()
+
+	// get the albums of the profile user, from the newest
+	// to the oldest, with the number of their photos and
+	// the first one as cover, the archived photos being
+	// only considered if the user is the owner
+	rows, err := db.read().QueryContext(ctx, `
+		SELECT
+			album.id,
+			album.name,
+			album.date,
+			(
+				SELECT COUNT(*)
+				FROM album_photo
+				JOIN Photo ON Photo.id=album_photo.photo
+				WHERE album_photo.album=album.id
+				AND (NOT Photo.archived OR Photo."user"=?)
+				AND `+visiblePhoto+`
+			),
+			COALESCE((
+				SELECT Photo.url
+				FROM album_photo
+				JOIN Photo ON Photo.id=album_photo.photo
+				WHERE album_photo.album=album.id
+				AND (NOT Photo.archived OR Photo."user"=?)
+				AND `+visiblePhoto+`
+				ORDER BY album_photo.position
+				LIMIT 1
+			), '')
+		FROM album
+		WHERE album."user"=?
+		ORDER BY album.date DESC, album.id DESC
+	`, dbUser.Id, dbUser.Id, dbUser.Id, dbUser.Id, dbUser.Id, dbUser.Id, dbUser.Id, dbUser.Id, profileDbUser.Id)
+
+	if err != nil {
+		return dbAlbumList, err
+	}
+
+	// build the album list
+	for rows.Next() {
+		dbAlbum := DatabaseAlbumDefault()
+		dbAlbum.User = profileDbUser
+
+		err = rows.Scan(&dbAlbum.Id, &dbAlbum.Name, unixTime{&dbAlbum.Date}, &dbAlbum.PhotoCount, &dbAlbum.CoverUrl)
+
+		if err != nil {
+			return dbAlbumList, err
+		}
+
+		dbAlbumList.Albums = append(dbAlbumList.Albums, dbAlbum)
+	}
+
+	if rows.Err() != nil {
+		return dbAlbumList, err
+	}
+
+	_ = rows.Close()
+
+	return dbAlbumList, err
+}
@@ -0,0 +1,153 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// scanLastUsed sets the date the API key was last used, which is null until it is used
+func scanLastUsed(dbAPIKey *DatabaseAPIKey, lastUsedAt sql.NullInt64) {
+	if lastUsedAt.Valid {
+		date := time.Unix(lastUsedAt.Int64, 0).UTC()
+		dbAPIKey.LastUsedAt = &date
+	}
+}
+
+func (db *appdbimpl) GetDatabaseAPIKey(ctx context.Context, keyHash string) (DatabaseAPIKey, error) {
+	dbAPIKey := DatabaseAPIKeyDefault()
+
+	var lastUsedAt sql.NullInt64
+
+	// get the key together with its user, unless the user is suspended or
+	// deactivated; the primary is always asked, since a key which was
+	// just revoked must be seen right away
+	err := db.c.QueryRowContext(ctx, `
+		SELECT api_key.id, api_key.name, api_key.key_hash, api_key.scope, api_key.rate_limit, api_key.created_at, api_key.last_used_at, "User".id, "User".username, "User".version
+		FROM api_key
+		JOIN "User" ON "User".id=api_key."user"
+		WHERE api_key.key_hash=?
+		AND "User".suspended_at IS NULL
+		AND "User".deactivated_at IS NULL
+	`, keyHash).Scan(&dbAPIKey.Id, &dbAPIKey.Name, &dbAPIKey.KeyHash, &dbAPIKey.Scope, &dbAPIKey.RateLimit, unixTime{&dbAPIKey.CreatedAt}, &lastUsedAt, &dbAPIKey.User.Id, &dbAPIKey.User.Username, &dbAPIKey.User.Version)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return dbAPIKey, ErrAPIKeyDoesNotExist
+	}
+
+	scanLastUsed(&dbAPIKey, lastUsedAt)
+
+	return dbAPIKey, err
+}
+
+func (db *appdbimpl) GetAPIKeys(ctx context.Context, dbUser DatabaseUser) ([]DatabaseAPIKey, error) {
+	dbAPIKeys := make([]DatabaseAPIKey, 0)
+
+	// get the keys of the user, from the first minted
+	rows, err := db.c.QueryContext(ctx, `
+		SELECT id, name, key_hash, scope, rate_limit, created_at, last_used_at
+		FROM api_key
+		WHERE "user"=?
+		ORDER BY id
+	`, dbUser.Id)
+
+	if err != nil {
+		return dbAPIKeys, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		dbAPIKey := DatabaseAPIKeyDefault()
+		dbAPIKey.User = dbUser
+
+		var lastUsedAt sql.NullInt64
+
+		err = rows.Scan(&dbAPIKey.Id, &dbAPIKey.Name, &dbAPIKey.KeyHash, &dbAPIKey.Scope, &dbAPIKey.RateLimit, unixTime{&dbAPIKey.CreatedAt}, &lastUsedAt)
+
+		if err != nil {
+			return dbAPIKeys, err
+		}
+
+		scanLastUsed(&dbAPIKey, lastUsedAt)
+
+		dbAPIKeys = append(dbAPIKeys, dbAPIKey)
+	}
+
+	return dbAPIKeys, rows.Err()
+}
+
+func (db *appdbimpl) InsertAPIKey(ctx context.Context, dbAPIKey *DatabaseAPIKey, maxKeys int) error {
+	return db.withTx(ctx, func(tx *dbtx) error {
+		var count int
+
+		err := tx.QueryRowContext(ctx, `
+			SELECT COUNT(*)
+			FROM api_key
+			WHERE "user"=?
+		`, dbAPIKey.User.Id).Scan(&count)
+
+		if err != nil {
+			return err
+		}
+
+		if count >= maxKeys {
+			return ErrTooManyAPIKeys
+		}
+
+		// insert the key into the database and get its id
+		return tx.QueryRowContext(ctx, `
+			INSERT INTO api_key("user", name, key_hash, scope, rate_limit, created_at)
+			VALUES (?, ?, ?, ?, ?, ?)
+			RETURNING id
+		`, dbAPIKey.User.Id, dbAPIKey.Name, dbAPIKey.KeyHash, dbAPIKey.Scope, dbAPIKey.RateLimit, dbAPIKey.CreatedAt.Unix()).Scan(&dbAPIKey.Id)
+	})
+}
+
+func (db *appdbimpl) TouchAPIKey(ctx context.Context, dbAPIKey DatabaseAPIKey, date time.Time) error {
+	// record when the key was last used; a key
+	// revoked meanwhile is simply not found
+	return db.retry(ctx, func() error {
+		_, err := db.c.ExecContext(ctx, `
+			UPDATE api_key
+			SET last_used_at=?
+			WHERE id=?
+		`, date.Unix(), dbAPIKey.Id)
+
+		return err
+	})
+}
+
+func (db *appdbimpl) DeleteAPIKey(ctx context.Context, dbAPIKey DatabaseAPIKey) error {
+	var res sql.Result
+
+	// revoke the key, which must belong to the user
+	err := db.retry(ctx, func() (err error) {
+		res, err = db.c.ExecContext(ctx, `
+			DELETE FROM api_key
+			WHERE id=?
+			AND "user"=?
+		`, dbAPIKey.Id, dbAPIKey.User.Id)
+
+		return err
+	})
+
+	if err != nil {
+		return err
+	}
+
+	aff, err := res.RowsAffected()
+
+	if err != nil {
+		return err
+	}
+
+	// if there are no affected rows then the
+	// key did not exist or is of another user
+	if aff == 0 {
+		return ErrAPIKeyDoesNotExist
+	}
+
+	return nil
+}
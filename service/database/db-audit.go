@@ -0,0 +1,99 @@
+package database
+
+import (
+	"context"
+
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/globaltime"
+)
+
+// The actions recorded in the audit log. The target of an entry is the photo
+// or the comment deleted, or the user affected by the action
+const (
+	AuditDeletePhoto    = "delete_photo"
+	AuditDeleteComment  = "delete_comment"
+	AuditBan            = "ban"
+	AuditUnban          = "unban"
+	AuditUnfollow       = "unfollow"
+	AuditChangeUsername = "change_username"
+	AuditDeleteUser     = "delete_user"
+	AuditEraseUser      = "erase_user"
+
+	// the actions of the administrators
+	AuditAdminDeletePhoto   = "admin_delete_photo"
+	AuditAdminDeleteComment = "admin_delete_comment"
+	AuditSuspendUser        = "suspend_user"
+	AuditUnsuspendUser      = "unsuspend_user"
+	AuditShadowBanUser      = "shadow_ban_user"
+	AuditUnshadowBanUser    = "unshadow_ban_user"
+	AuditBlockTerm          = "block_term"
+	AuditUnblockTerm        = "unblock_term"
+	AuditApproveComment     = "approve_comment"
+	AuditRejectComment      = "reject_comment"
+	AuditUnflagPhoto        = "unflag_photo"
+	AuditReserveName        = "reserve_name"
+	AuditUnreserveName      = "unreserve_name"
+)
+
+// AuditAdmin is the actor of the entries recorded for the administrators, who are not users
+const AuditAdmin uint32 = 0
+
+// insertAuditTx records in the audit log, inside the transaction `tx`,
+// that the user `actor` performed `action` on `target` right now
+func insertAuditTx(ctx context.Context, tx *dbtx, actor uint32, action string, target uint32, details string) error {
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO audit(actor, action, target, details, date)
+		VALUES (?, ?, ?, ?, ?)
+	`, actor, action, target, details, globaltime.Now().Unix())
+
+	return err
+}
+
+func (db *appdbimpl) GetAuditLog(ctx context.Context, actor uint32, action string, limit int, before uint32) (DatabaseAuditLog, error) {
+	dbAuditLog := DatabaseAuditLogDefault()
+
+	// get a page of at most `limit` entries of the log, from the
+	// newest to the oldest, keeping only the entries older than
+	// the entry `before` (if it is not 0) and, if they are given,
+	// the ones of the user `actor` and of the action `action`
+	rows, err := db.read().QueryContext(ctx, `
+		SELECT id, actor, action, target, details, date
+		FROM audit
+		WHERE (?=0 OR actor=?)
+		AND (CAST(? AS TEXT)='' OR action=?)
+		AND (
+			?=0
+			OR (date, id) < (
+				SELECT date, id
+				FROM audit
+				WHERE id=?
+			)
+		)
+		ORDER BY date DESC, id DESC
+		LIMIT ?
+	`, actor, actor, action, action, before, before, limit)
+
+	if err != nil {
+		return dbAuditLog, err
+	}
+
+	// build the log
+	for rows.Next() {
+		dbAuditEntry := DatabaseAuditEntryDefault()
+
+		err = rows.Scan(&dbAuditEntry.Id, &dbAuditEntry.Actor, &dbAuditEntry.Action, &dbAuditEntry.Target, &dbAuditEntry.Details, unixTime{&dbAuditEntry.Date})
+
+		if err != nil {
+			return dbAuditLog, err
+		}
+
+		dbAuditLog.Entries = append(dbAuditLog.Entries, dbAuditEntry)
+	}
+
+	if rows.Err() != nil {
+		return dbAuditLog, err
+	}
+
+	_ = rows.Close()
+
+	return dbAuditLog, err
+}
@@ -0,0 +1,19 @@
+package database
+
+import (
+	"context"
+)
+
+func (db *appdbimpl) Backup(ctx context.Context, path string) error {
+	query := db.c.d.backup()
+
+	if query == "" {
+		return ErrBackupUnsupported
+	}
+
+	// copy a consistent snapshot of the database into the file `path`,
+	// which must not exist, while the other connections keep working
+	_, err := db.c.ExecContext(ctx, query, path)
+
+	return err
+}
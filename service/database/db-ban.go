@@ -1,52 +1,88 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"errors"
+	"time"
 )
 
-func (db *appdbimpl) InsertBan(dbUser DatabaseUser, bannedDbUser DatabaseUser) error {
-	// insert the ban into the database
-	_, err := db.c.Exec(`
-		INSERT OR IGNORE INTO ban(first_user, second_user)
-		VALUES (?, ?)
-	`, dbUser.Id, bannedDbUser.Id)
+func (db *appdbimpl) InsertBan(ctx context.Context, dbUser DatabaseUser, dbBan DatabaseBan) error {
+	var expiresAt sql.NullInt64
 
-	return err
+	if dbBan.ExpiresAt != nil {
+		expiresAt = sql.NullInt64{Int64: dbBan.ExpiresAt.Unix(), Valid: true}
+	}
+
+	return db.withTx(ctx, func(tx *dbtx) error {
+		// insert the ban into the database
+		res, err := tx.ExecContext(ctx, `
+			INSERT INTO ban(first_user, second_user, reason, expires_at)
+			VALUES (?, ?, ?, ?)
+			ON CONFLICT DO NOTHING
+		`, dbUser.Id, dbBan.User.Id, dbBan.Reason, expiresAt)
+
+		if err != nil {
+			return err
+		}
+
+		aff, err := res.RowsAffected()
+
+		if err != nil {
+			return err
+		}
+
+		// the ban is recorded only the first time, banning
+		// the user again replaces its reason and its expiry
+		if aff == 0 {
+			_, err = tx.ExecContext(ctx, `
+				UPDATE ban
+				SET reason=?, expires_at=?
+				WHERE first_user=?
+				AND second_user=?
+			`, dbBan.Reason, expiresAt, dbUser.Id, dbBan.User.Id)
+
+			return err
+		}
+
+		return insertAuditTx(ctx, tx, dbUser.Id, AuditBan, dbBan.User.Id, dbBan.User.Username)
+	})
 }
 
-func (db *appdbimpl) DeleteBan(dbUser DatabaseUser, bannedDbUser DatabaseUser) error {
-	// remove the ban from the database
-	res, err := db.c.Exec(`
-		DELETE FROM ban
-		WHERE first_user=?
-		AND second_user=?
-	`, dbUser.Id, bannedDbUser.Id)
+func (db *appdbimpl) DeleteBan(ctx context.Context, dbUser DatabaseUser, bannedDbUser DatabaseUser) error {
+	return db.withTx(ctx, func(tx *dbtx) error {
+		// remove the ban from the database
+		res, err := tx.ExecContext(ctx, `
+			DELETE FROM ban
+			WHERE first_user=?
+			AND second_user=?
+		`, dbUser.Id, bannedDbUser.Id)
 
-	if err != nil {
-		return err
-	}
+		if err != nil {
+			return err
+		}
 
-	aff, err := res.RowsAffected()
+		aff, err := res.RowsAffected()
 
-	if err != nil {
-		return err
-	}
+		if err != nil {
+			return err
+		}
 
-	// if there are no affected rows
-	// then the user was not banned
-	if aff == 0 {
-		return ErrUserNotBanned
-	}
+		// if there are no affected rows
+		// then the user was not banned
+		if aff == 0 {
+			return ErrUserNotBanned
+		}
 
-	return nil
+		return insertAuditTx(ctx, tx, dbUser.Id, AuditUnban, bannedDbUser.Id, bannedDbUser.Username)
+	})
 }
 
-func (db *appdbimpl) CheckBan(firstDbUser DatabaseUser, secondDbUser DatabaseUser) (bool, error) {
+func (db *appdbimpl) CheckBan(ctx context.Context, firstDbUser DatabaseUser, secondDbUser DatabaseUser) (bool, error) {
 	checkBan := false
 
 	// check whether the first user has banned the second user
-	err := db.c.QueryRow(`
+	err := db.c.QueryRowContext(ctx, `
 		SELECT EXISTS(
 			SELECT 1
 			FROM ban
@@ -64,3 +100,64 @@ func (db *appdbimpl) CheckBan(firstDbUser DatabaseUser, secondDbUser DatabaseUse
 
 	return checkBan, err
 }
+
+func (db *appdbimpl) GetBanList(ctx context.Context, dbUser DatabaseUser) (DatabaseBanList, error) {
+	dbBanList := DatabaseBanListDefault()
+
+	// get the users banned by the user performing
+	// the action, together with the reason and the
+	// expiry of each ban; only the user can see it
+	rows, err := db.c.QueryContext(ctx, `
+		SELECT "User".id, "User".username, "User".avatar, ban.reason, ban.expires_at
+		FROM ban
+		JOIN "User" ON "User".id=ban.second_user
+		WHERE ban.first_user=?
+		AND "User".deactivated_at IS NULL
+		ORDER BY "User".username
+	`, dbUser.Id)
+
+	if err != nil {
+		return dbBanList, err
+	}
+
+	defer rows.Close()
+
+	// build the ban list
+	for rows.Next() {
+		dbBan := DatabaseBanDefault()
+
+		var expiresAt sql.NullInt64
+
+		err = rows.Scan(&dbBan.User.Id, &dbBan.User.Username, &dbBan.User.Avatar, &dbBan.Reason, &expiresAt)
+
+		if err != nil {
+			return dbBanList, err
+		}
+
+		if expiresAt.Valid {
+			date := time.Unix(expiresAt.Int64, 0).UTC()
+			dbBan.ExpiresAt = &date
+		}
+
+		dbBanList.Bans = append(dbBanList.Bans, dbBan)
+	}
+
+	return dbBanList, rows.Err()
+}
+
+func (db *appdbimpl) DeleteExpiredBans(ctx context.Context, now time.Time) (int, error) {
+	// remove the bans which have expired; they are
+	// lifted by no one, hence they are not recorded
+	res, err := db.c.ExecContext(ctx, `
+		DELETE FROM ban
+		WHERE expires_at <= ?
+	`, now.Unix())
+
+	if err != nil {
+		return 0, err
+	}
+
+	aff, err := res.RowsAffected()
+
+	return int(aff), err
+}
@@ -0,0 +1,204 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+func (db *appdbimpl) GetBlockedTerms(ctx context.Context) ([]DatabaseBlockedTerm, error) {
+	dbBlockedTerms := make([]DatabaseBlockedTerm, 0)
+
+	// get the words and the patterns blocked
+	// by the administrators, oldest first
+	rows, err := db.c.QueryContext(ctx, `
+		SELECT id, term, pattern
+		FROM blocked_term
+		ORDER BY id
+	`)
+
+	if err != nil {
+		return dbBlockedTerms, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		dbBlockedTerm := DatabaseBlockedTermDefault()
+
+		err = rows.Scan(&dbBlockedTerm.Id, &dbBlockedTerm.Term, &dbBlockedTerm.Pattern)
+
+		if err != nil {
+			return dbBlockedTerms, err
+		}
+
+		dbBlockedTerms = append(dbBlockedTerms, dbBlockedTerm)
+	}
+
+	return dbBlockedTerms, rows.Err()
+}
+
+func (db *appdbimpl) InsertBlockedTerm(ctx context.Context, dbBlockedTerm *DatabaseBlockedTerm) error {
+	return db.withTx(ctx, func(tx *dbtx) error {
+		// insert the term and get its id; if it is
+		// already blocked then no row is returned
+		err := tx.QueryRowContext(ctx, `
+			INSERT INTO blocked_term(term, pattern)
+			VALUES (?, ?)
+			ON CONFLICT DO NOTHING
+			RETURNING id
+		`, dbBlockedTerm.Term, dbBlockedTerm.Pattern).Scan(&dbBlockedTerm.Id)
+
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrBlockedTermAlreadyExists
+		}
+
+		if err != nil {
+			return err
+		}
+
+		return insertAuditTx(ctx, tx, AuditAdmin, AuditBlockTerm, dbBlockedTerm.Id, dbBlockedTerm.Term)
+	})
+}
+
+func (db *appdbimpl) DeleteBlockedTerm(ctx context.Context, termId uint32) error {
+	return db.withTx(ctx, func(tx *dbtx) error {
+		var term string
+
+		err := tx.QueryRowContext(ctx, `
+			DELETE FROM blocked_term
+			WHERE id=?
+			RETURNING term
+		`, termId).Scan(&term)
+
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrBlockedTermDoesNotExist
+		}
+
+		if err != nil {
+			return err
+		}
+
+		return insertAuditTx(ctx, tx, AuditAdmin, AuditUnblockTerm, termId, term)
+	})
+}
+
+func (db *appdbimpl) InsertHeldComment(ctx context.Context, dbHeldComment *DatabaseHeldComment) error {
+	// hold the comment back, away from the photo, until
+	// the administrators approve or reject it
+	return db.c.QueryRowContext(ctx, `
+		INSERT INTO held_comment("user", photo, date, comment_body, term)
+		VALUES (?, ?, ?, ?, ?)
+		RETURNING id
+	`, dbHeldComment.User.Id, dbHeldComment.Photo.Id, dbHeldComment.Date.Unix(), dbHeldComment.CommentBody, dbHeldComment.Term).Scan(&dbHeldComment.Id)
+}
+
+func (db *appdbimpl) GetHeldCommentList(ctx context.Context, limit int, after uint32) (DatabaseHeldCommentList, error) {
+	dbHeldCommentList := DatabaseHeldCommentListDefault()
+
+	// get a page of at most `limit` held comments, from
+	// the oldest to the newest, starting right after
+	// the held comment `after`
+	rows, err := db.c.QueryContext(ctx, `
+		SELECT held_comment.id, held_comment."user", author.username, Photo.id, Photo."user", owner.username, Photo.url, Photo.date, held_comment.date, held_comment.comment_body, held_comment.term
+		FROM held_comment
+		JOIN "User" AS author ON author.id=held_comment."user"
+		JOIN Photo ON Photo.id=held_comment.photo
+		JOIN "User" AS owner ON owner.id=Photo."user"
+		WHERE held_comment.id > ?
+		ORDER BY held_comment.id
+		LIMIT ?
+	`, after, limit+1)
+
+	if err != nil {
+		return dbHeldCommentList, err
+	}
+
+	defer rows.Close()
+
+	// build the list
+	for rows.Next() {
+		dbHeldComment := DatabaseHeldCommentDefault()
+
+		err = rows.Scan(&dbHeldComment.Id, &dbHeldComment.User.Id, &dbHeldComment.User.Username, &dbHeldComment.Photo.Id, &dbHeldComment.Photo.User.Id, &dbHeldComment.Photo.User.Username, &dbHeldComment.Photo.Url, unixTime{&dbHeldComment.Photo.Date}, unixTime{&dbHeldComment.Date}, &dbHeldComment.CommentBody, &dbHeldComment.Term)
+
+		if err != nil {
+			return dbHeldCommentList, err
+		}
+
+		dbHeldCommentList.Comments = append(dbHeldCommentList.Comments, dbHeldComment)
+	}
+
+	if rows.Err() != nil {
+		return dbHeldCommentList, rows.Err()
+	}
+
+	// if there is a next page, its cursor
+	// is the last comment of the current one
+	if len(dbHeldCommentList.Comments) > limit {
+		dbHeldCommentList.Comments = dbHeldCommentList.Comments[:limit]
+		dbHeldCommentList.NextCursor = dbHeldCommentList.Comments[limit-1].Id
+	}
+
+	return dbHeldCommentList, nil
+}
+
+func (db *appdbimpl) ReleaseHeldComment(ctx context.Context, heldId uint32) (DatabaseComment, error) {
+	dbComment := DatabaseCommentDefault()
+
+	// move the held comment under its photo, as
+	// if it had been written there in the first place
+	err := db.withTx(ctx, func(tx *dbtx) error {
+		err := tx.QueryRowContext(ctx, `
+			DELETE FROM held_comment
+			WHERE id=?
+			RETURNING "user", photo, date, comment_body
+		`, heldId).Scan(&dbComment.User.Id, &dbComment.Photo.Id, unixTime{&dbComment.Date}, &dbComment.CommentBody)
+
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrHeldCommentDoesNotExist
+		}
+
+		if err != nil {
+			return err
+		}
+
+		err = insertCommentTx(ctx, tx, &dbComment, db.usernameKey)
+
+		if err != nil {
+			return err
+		}
+
+		return insertAuditTx(ctx, tx, AuditAdmin, AuditApproveComment, dbComment.Id, dbComment.CommentBody)
+	})
+
+	if err != nil {
+		return DatabaseCommentDefault(), err
+	}
+
+	db.invalidate(ctx, photoGroup(dbComment.Photo.Id))
+
+	return dbComment, nil
+}
+
+func (db *appdbimpl) DeleteHeldComment(ctx context.Context, heldId uint32) error {
+	return db.withTx(ctx, func(tx *dbtx) error {
+		var body string
+
+		err := tx.QueryRowContext(ctx, `
+			DELETE FROM held_comment
+			WHERE id=?
+			RETURNING comment_body
+		`, heldId).Scan(&body)
+
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrHeldCommentDoesNotExist
+		}
+
+		if err != nil {
+			return err
+		}
+
+		return insertAuditTx(ctx, tx, AuditAdmin, AuditRejectComment, heldId, body)
+	})
+}
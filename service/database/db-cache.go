@@ -0,0 +1,98 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/cache"
+)
+
+// CacheTTL holds how long the entries of the cache live, at most, when no write invalidates them before. The counters
+// also change when a user bans another one, is deactivated or has their comments shadow banned, which do not invalidate
+// them: the counters seen by the users involved can be stale up to these durations.
+type CacheTTL struct {
+	// Profile is the life of the photo, followers and following counts of the profiles
+	Profile time.Duration
+
+	// Photo is the life of the like and comment counts and of the reactions of the photos
+	Photo time.Duration
+}
+
+// cachedPhotoStats are the fields of a DatabasePhoto filled by GetPhotoStats, as kept in the cache
+type cachedPhotoStats struct {
+	LikeCount    int            `json:"like_count"`
+	CommentCount int            `json:"comment_count"`
+	LikeStatus   bool           `json:"like_status"`
+	Reaction     string         `json:"reaction"`
+	Reactions    map[string]int `json:"reactions"`
+	LikesHidden  bool           `json:"likes_hidden"`
+}
+
+// The groups of the entries of the cache: the counts of each profile and the stats of each photo, holding an entry
+// for each user looking at them, since the counts leave out the users who banned them
+func followersGroup(userId uint32) string {
+	return "followers:" + strconv.FormatUint(uint64(userId), 10)
+}
+
+func followingGroup(userId uint32) string {
+	return "following:" + strconv.FormatUint(uint64(userId), 10)
+}
+
+func photosGroup(userId uint32) string {
+	return "photos:" + strconv.FormatUint(uint64(userId), 10)
+}
+
+func photoGroup(photoId uint32) string {
+	return "photo:" + strconv.FormatUint(uint64(photoId), 10)
+}
+
+// viewerKey is the key of the entry seen by the user
+func viewerKey(dbUser DatabaseUser) string {
+	return strconv.FormatUint(uint64(dbUser.Id), 10)
+}
+
+// UseCache keeps the counters of the profiles and the photos in `c`, for at most the durations of `ttl`
+func (db *appdbimpl) UseCache(c cache.Cache, ttl CacheTTL) {
+	db.cache = c
+	db.ttl = ttl
+}
+
+// cached reads the entry `key` of the group `group` into `v`, or runs `load` to fill `v` and saves it for `ttl`.
+// The cache failing is treated as a miss, so that the reads keep working without it.
+func (db *appdbimpl) cached(ctx context.Context, group string, key string, ttl time.Duration, v interface{}, load func() error) error {
+	if db.cache == nil {
+		return load()
+	}
+
+	value, ok, err := db.cache.Get(ctx, group, key)
+
+	if err == nil && ok && json.Unmarshal(value, v) == nil {
+		return nil
+	}
+
+	err = load()
+
+	if err != nil {
+		return err
+	}
+
+	value, err = json.Marshal(v)
+
+	if err == nil {
+		_ = db.cache.Set(ctx, group, key, value, ttl)
+	}
+
+	return nil
+}
+
+// invalidate removes the groups changed by a write. A failure leaves them stale until they expire, which is not worth
+// failing the write for, as it is already committed.
+func (db *appdbimpl) invalidate(ctx context.Context, groups ...string) {
+	if db.cache == nil {
+		return
+	}
+
+	_ = db.cache.Invalidate(ctx, groups...)
+}
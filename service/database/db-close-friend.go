@@ -0,0 +1,150 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+func (db *appdbimpl) InsertCloseFriend(ctx context.Context, dbUser DatabaseUser, friendDbUser DatabaseUser) error {
+	// insert the close friend into the database,
+	// only the followers of the user can be added
+	err := db.retry(ctx, func() error {
+		res, err := db.c.ExecContext(ctx, `
+			INSERT INTO close_friend(first_user, second_user)
+			SELECT second_user, first_user
+			FROM follow
+			WHERE first_user=?
+			AND second_user=?
+			ON CONFLICT DO NOTHING
+		`, friendDbUser.Id, dbUser.Id)
+
+		if err != nil {
+			return err
+		}
+
+		aff, err := res.RowsAffected()
+
+		if err != nil || aff > 0 {
+			return err
+		}
+
+		// nothing was inserted, either because the user
+		// was already a close friend or not a follower
+		isFollower, err := db.GetFollowStatus(ctx, friendDbUser, dbUser)
+
+		if err != nil {
+			return err
+		}
+
+		if !isFollower {
+			return ErrNotFollower
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	// the friend may now see more photos of the user
+	db.invalidate(ctx, photosGroup(dbUser.Id))
+
+	return nil
+}
+
+func (db *appdbimpl) DeleteCloseFriend(ctx context.Context, dbUser DatabaseUser, friendDbUser DatabaseUser) error {
+	var res sql.Result
+
+	// remove the close friend from the database
+	err := db.retry(ctx, func() (err error) {
+		res, err = db.c.ExecContext(ctx, `
+			DELETE FROM close_friend
+			WHERE first_user=?
+			AND second_user=?
+		`, dbUser.Id, friendDbUser.Id)
+
+		return err
+	})
+
+	if err != nil {
+		return err
+	}
+
+	aff, err := res.RowsAffected()
+
+	if err != nil {
+		return err
+	}
+
+	// if there are no affected rows
+	// then the user was not a close friend
+	if aff == 0 {
+		return ErrUserNotCloseFriend
+	}
+
+	db.invalidate(ctx, photosGroup(dbUser.Id))
+
+	return nil
+}
+
+func (db *appdbimpl) CheckCloseFriend(ctx context.Context, firstDbUser DatabaseUser, secondDbUser DatabaseUser) (bool, error) {
+	checkCloseFriend := false
+
+	// check whether the first user has added
+	// the second user to their close friends
+	err := db.c.QueryRowContext(ctx, `
+		SELECT EXISTS(
+			SELECT 1
+			FROM close_friend
+			WHERE first_user=?
+			AND second_user=?
+		)
+	`, firstDbUser.Id, secondDbUser.Id).Scan(&checkCloseFriend)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+
+	return checkCloseFriend, err
+}
+
+func (db *appdbimpl) GetCloseFriendsList(ctx context.Context, dbUser DatabaseUser) (DatabaseUserList, error) {
+	dbUserList := DatabaseUserListDefault()
+
+	// get the table of the close friends of the user
+	// performing the action, only the user can see it
+	rows, err := db.c.QueryContext(ctx, `
+		SELECT id, username, avatar
+		FROM "User"
+		WHERE id IN (
+			SELECT second_user
+			FROM close_friend
+			WHERE first_user=?
+		)
+		AND deactivated_at IS NULL
+		ORDER BY username
+	`, dbUser.Id)
+
+	if err != nil {
+		return dbUserList, err
+	}
+
+	defer rows.Close()
+
+	// build the close friends list
+	for rows.Next() {
+		tableDbUser := DatabaseUserDefault()
+
+		err = rows.Scan(&tableDbUser.Id, &tableDbUser.Username, &tableDbUser.Avatar)
+
+		if err != nil {
+			return dbUserList, err
+		}
+
+		dbUserList.Users = append(dbUserList.Users, tableDbUser)
+	}
+
+	return dbUserList, rows.Err()
+}
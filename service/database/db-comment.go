@@ -1,35 +1,69 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"errors"
+	"strings"
+	"time"
 )
 
-func (db *appdbimpl) GetDatabaseComment(commentId uint32, dbUser DatabaseUser) (DatabaseComment, error) {
+// The orders of the comment lists, from the oldest comment or from the newest one
+const (
+	CommentSortOldest = "oldest"
+	CommentSortNewest = "newest"
+)
+
+// CommentSorts are the orders of the comment lists, the first one being the default
+var CommentSorts = []string{CommentSortOldest, CommentSortNewest}
+
+// IsCommentSort reports whether `sort` is one of the CommentSorts.
+func IsCommentSort(sort string) bool {
+	for _, s := range CommentSorts {
+		if s == sort {
+			return true
+		}
+	}
+
+	return false
+}
+
+// visibleComment filters out the comments of the users shadow banned by the administrators, unless they were written by
+// the user performing the action. It takes the id of the user performing the action once.
+const visibleComment = `(
+	Comment."user"=?
+	OR Comment."user" NOT IN (
+		SELECT id
+		FROM "User"
+		WHERE shadow_banned
+	)
+)`
+
+func (db *appdbimpl) GetDatabaseComment(ctx context.Context, commentId uint32, dbUser DatabaseUser) (DatabaseComment, error) {
 	dbComment := DatabaseCommentDefault()
 
 	// get the comment from the database
-	err := db.c.QueryRow(`
-		SELECT id, user, date, photo, comment_body
+	err := db.c.QueryRowContext(ctx, `
+		SELECT id, "user", date, photo, comment_body
 		FROM Comment
 		WHERE id=?
-	`, commentId).Scan(&dbComment.Id, &dbComment.User.Id, &dbComment.Date, &dbComment.Photo.Id, &dbComment.CommentBody)
+	`, commentId).Scan(&dbComment.Id, &dbComment.User.Id, unixTime{&dbComment.Date}, &dbComment.Photo.Id, &dbComment.CommentBody)
 
 	if errors.Is(err, sql.ErrNoRows) {
 		return dbComment, ErrCommentDoesNotExist
 	}
 
 	// get the user of the comment
-	dbCommentUser, err := db.GetDatabaseUser(dbComment.User.Id)
+	dbCommentUser, err := db.GetDatabaseUser(ctx, dbComment.User.Id)
 
 	if err != nil {
 		return dbComment, err
 	}
 
-	dbComment.User.Username = dbCommentUser.Username
+	dbComment.User = dbCommentUser
 
 	// // get the photo of the comment
-	dbPhoto, err := db.GetDatabasePhoto(dbComment.Photo.Id, dbUser)
+	dbPhoto, err := db.GetDatabasePhoto(ctx, dbComment.Photo.Id, dbUser)
 
 	if err != nil {
 		return dbComment, err
@@ -40,68 +74,102 @@ func (db *appdbimpl) GetDatabaseComment(commentId uint32, dbUser DatabaseUser) (
 	return dbComment, err
 }
 
-func (db *appdbimpl) InsertComment(dbComment *DatabaseComment) error {
-	// insert the comment into the database
-	res, err := db.c.Exec(`
-		INSERT INTO Comment(user, photo, date, comment_body)
-		VALUES (?, ?, ?, ?)
-	`, dbComment.User.Id, dbComment.Photo.Id, dbComment.Date, dbComment.CommentBody)
-
-	if err != nil {
-		return err
-	}
-
-	// get the comment id
-	dbCommentId, err := res.LastInsertId()
+func (db *appdbimpl) InsertComment(ctx context.Context, dbComment *DatabaseComment) error {
+	err := db.withTx(ctx, func(tx *dbtx) error {
+		return insertCommentTx(ctx, tx, dbComment, db.usernameKey)
+	})
 
 	if err != nil {
 		return err
 	}
 
-	dbComment.Id = uint32(dbCommentId)
+	db.invalidate(ctx, photoGroup(dbComment.Photo.Id))
 
 	return nil
 }
 
-func (db *appdbimpl) DeleteComment(dbComment DatabaseComment) error {
-	// remove the comment from the database
-	res, err := db.c.Exec(`
-		DELETE FROM Comment
-		WHERE id=?
-	`, dbComment.Id)
+func (db *appdbimpl) DeleteComment(ctx context.Context, dbComment DatabaseComment) error {
+	var photoId uint32
+
+	err := db.withTx(ctx, func(tx *dbtx) error {
+		// remove the comment from the database
+		// and get the photo it was under, its
+		// author and its body for the audit log
+		var userId uint32
+		var body string
+
+		err := tx.QueryRowContext(ctx, `
+			DELETE FROM Comment
+			WHERE id=?
+			RETURNING photo, "user", comment_body
+		`, dbComment.Id).Scan(&photoId, &userId, &body)
+
+		// if there are no rows
+		// then the photo was not commented
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrPhotoNotCommented
+		}
+
+		if err != nil {
+			return err
+		}
+
+		err = addPhotoCommentCount(ctx, tx, photoId, -1)
+
+		if err != nil {
+			return err
+		}
+
+		return insertAuditTx(ctx, tx, userId, AuditDeleteComment, dbComment.Id, body)
+	})
 
 	if err != nil {
 		return err
 	}
 
-	aff, err := res.RowsAffected()
-
-	// if there are no affected rows
-	// then the photo was not commented
-	if aff == 0 {
-		return ErrPhotoNotCommented
-	}
+	db.invalidate(ctx, photoGroup(photoId))
 
-	return err
+	return nil
 }
 
-func (db *appdbimpl) GetCommentList(dbPhoto DatabasePhoto, dbUser DatabaseUser) (DatabaseCommentList, error) {
+func (db *appdbimpl) GetCommentList(ctx context.Context, dbPhoto DatabasePhoto, dbUser DatabaseUser, sort string, limit int, after uint32) (DatabaseCommentList, error) {
 	dbCommentList := DatabaseCommentListDefault()
 
-	// get the table of the comments under the photo
-	// without considering the comments made by users
-	// who banned the user performing the action
-	rows, err := db.c.Query(`
-		SELECT id, user, photo, date, comment_body
+	// the comments go from the oldest to the newest,
+	// unless they are sorted from the newest
+	following, order := ">", "date, id"
+
+	if sort == CommentSortNewest {
+		following, order = "<", "date DESC, id DESC"
+	}
+
+	// get a page of at most `limit` comments under the photo,
+	// in the given order, starting right after the comment
+	// `after` (or from the first comment if `after` is 0),
+	// without considering the comments made by users who
+	// banned the user performing the action and the
+	// comments of shadow banned users
+	rows, err := db.read().QueryContext(ctx, `
+		SELECT id, "user", photo, date, comment_body
 		FROM Comment
 		WHERE photo=?
-		AND user NOT IN (
+		AND "user" NOT IN (
 			SELECT first_user
 			FROM ban
 			WHERE second_user=?
 		)
-		ORDER BY date
-	`, dbPhoto.Id, dbUser.Id)
+		AND `+visibleComment+`
+		AND (
+			?=0
+			OR (date, id) `+following+` (
+				SELECT date, id
+				FROM Comment
+				WHERE id=?
+			)
+		)
+		ORDER BY `+order+`
+		LIMIT ?
+	`, dbPhoto.Id, dbUser.Id, dbUser.Id, after, after, limit)
 
 	if errors.Is(err, sql.ErrNoRows) {
 		return dbCommentList, ErrPhotoDoesNotExist
@@ -117,13 +185,13 @@ func (db *appdbimpl) GetCommentList(dbPhoto DatabasePhoto, dbUser DatabaseUser)
 	for rows.Next() {
 		dbComment := DatabaseCommentDefault()
 
-		err = rows.Scan(&dbComment.Id, &dbComment.User.Id, &dbComment.Photo.Id, &dbComment.Date, &dbComment.CommentBody)
+		err = rows.Scan(&dbComment.Id, &dbComment.User.Id, &dbComment.Photo.Id, unixTime{&dbComment.Date}, &dbComment.CommentBody)
 
 		if err != nil {
 			return dbCommentList, err
 		}
 
-		dbCommentUser, err := db.GetDatabaseUser(dbComment.User.Id)
+		dbCommentUser, err := db.GetDatabaseUser(ctx, dbComment.User.Id)
 
 		if err != nil {
 			return dbCommentList, err
@@ -132,7 +200,7 @@ func (db *appdbimpl) GetCommentList(dbPhoto DatabasePhoto, dbUser DatabaseUser)
 		dbComment.User = dbCommentUser
 
 		if dbCommentPhoto.Id == 0 {
-			dbCommentPhoto, err = db.GetDatabasePhoto(dbComment.Photo.Id, dbUser)
+			dbCommentPhoto, err = db.GetDatabasePhoto(ctx, dbComment.Photo.Id, dbUser)
 
 			if err != nil {
 				return dbCommentList, err
@@ -152,3 +220,247 @@ func (db *appdbimpl) GetCommentList(dbPhoto DatabasePhoto, dbUser DatabaseUser)
 
 	return dbCommentList, err
 }
+
+func (db *appdbimpl) GetPhotosComments(ctx context.Context, photoIds []uint32, dbUser DatabaseUser, limit int, after uint32) (map[uint32][]DatabaseComment, error) {
+	dbComments := make(map[uint32][]DatabaseComment)
+
+	if len(photoIds) == 0 {
+		return dbComments, nil
+	}
+
+	args := make([]interface{}, 0, len(photoIds)+5)
+
+	for _, photoId := range photoIds {
+		args = append(args, photoId)
+	}
+
+	// get a page of at most `limit` comments under each photo,
+	// as GetCommentList does for a single photo, together with
+	// their authors, numbering the comments of every photo
+	// to keep the first `limit` ones only
+	rows, err := db.read().QueryContext(ctx, `
+		SELECT id, "user", username, display_name, bio, website, avatar, photo, date, comment_body
+		FROM (
+			SELECT Comment.id, Comment."user", "User".username, "User".display_name, "User".bio, "User".website, "User".avatar,
+				Comment.photo, Comment.date, Comment.comment_body,
+				ROW_NUMBER() OVER (PARTITION BY Comment.photo ORDER BY Comment.date, Comment.id) AS position
+			FROM Comment
+			JOIN "User" ON "User".id=Comment."user"
+			WHERE Comment.photo IN (`+placeholders(len(photoIds))+`)
+			AND Comment."user" NOT IN (
+				SELECT first_user
+				FROM ban
+				WHERE second_user=?
+			)
+			AND `+visibleComment+`
+			AND (
+				?=0
+				OR (Comment.date, Comment.id) > (
+					SELECT date, id
+					FROM Comment
+					WHERE id=?
+				)
+			)
+		) AS page
+		WHERE position<=?
+		ORDER BY photo, date, id
+	`, append(args, dbUser.Id, dbUser.Id, after, after, limit)...)
+
+	if err != nil {
+		return dbComments, err
+	}
+
+	// group the comments by photo
+	for rows.Next() {
+		dbComment := DatabaseCommentDefault()
+
+		err = rows.Scan(&dbComment.Id, &dbComment.User.Id, &dbComment.User.Username, &dbComment.User.DisplayName, &dbComment.User.Bio, &dbComment.User.Website, &dbComment.User.Avatar, &dbComment.Photo.Id, unixTime{&dbComment.Date}, &dbComment.CommentBody)
+
+		if err != nil {
+			return dbComments, err
+		}
+
+		dbComments[dbComment.Photo.Id] = append(dbComments[dbComment.Photo.Id], dbComment)
+	}
+
+	if rows.Err() != nil {
+		return dbComments, rows.Err()
+	}
+
+	_ = rows.Close()
+
+	return dbComments, nil
+}
+
+func (db *appdbimpl) SearchComments(ctx context.Context, dbUser DatabaseUser, text string, limit int, before uint32) (DatabaseCommentList, error) {
+	dbCommentList := DatabaseCommentListDefault()
+
+	// there is nothing to match
+	if strings.TrimSpace(text) == "" {
+		return dbCommentList, nil
+	}
+
+	match, args := db.c.d.matchComment(db.fullText, text)
+
+	// get a page of at most `limit` comments matching the text,
+	// from the newest to the oldest, keeping only the comments
+	// older than the comment `before` (if it is not 0); the
+	// comments made by users who banned the user performing
+	// the action or who are shadow banned and the comments
+	// under photos they cannot see are not considered
+	rows, err := db.read().QueryContext(ctx, `
+		SELECT id, "user", photo, date, comment_body
+		FROM Comment
+		WHERE `+match+`
+		AND "user" NOT IN (
+			SELECT first_user
+			FROM ban
+			WHERE second_user=?
+		)
+		AND `+visibleComment+`
+		AND photo IN (
+			SELECT id
+			FROM Photo
+			WHERE (NOT archived OR "user"=?)
+			AND `+visiblePhoto+`
+			AND "user" NOT IN (
+				SELECT first_user
+				FROM ban
+				WHERE second_user=?
+			)
+		)
+		AND (
+			?=0
+			OR (date, id) < (
+				SELECT date, id
+				FROM Comment
+				WHERE id=?
+			)
+		)
+		ORDER BY date DESC, id DESC
+		LIMIT ?
+	`, append(args, dbUser.Id, dbUser.Id, dbUser.Id, dbUser.Id, dbUser.Id, dbUser.Id, dbUser.Id, before, before, limit)...)
+
+	if err != nil {
+		return dbCommentList, err
+	}
+
+	// build the comment list
+	for rows.Next() {
+		dbComment := DatabaseCommentDefault()
+
+		err = rows.Scan(&dbComment.Id, &dbComment.User.Id, &dbComment.Photo.Id, unixTime{&dbComment.Date}, &dbComment.CommentBody)
+
+		if err != nil {
+			return dbCommentList, err
+		}
+
+		dbComment.User, err = db.GetDatabaseUser(ctx, dbComment.User.Id)
+
+		if err != nil {
+			return dbCommentList, err
+		}
+
+		dbComment.Photo, err = db.GetDatabasePhoto(ctx, dbComment.Photo.Id, dbUser)
+
+		if err != nil {
+			return dbCommentList, err
+		}
+
+		dbCommentList.Comments = append(dbCommentList.Comments, dbComment)
+	}
+
+	if rows.Err() != nil {
+		return dbCommentList, err
+	}
+
+	_ = rows.Close()
+
+	return dbCommentList, err
+}
+
+func (db *appdbimpl) GetCommentActivity(ctx context.Context, dbUser DatabaseUser, body string, duplicatesSince time.Time, recentSince time.Time) (DatabaseCommentActivity, error) {
+	dbActivity := DatabaseCommentActivityDefault()
+
+	since := duplicatesSince
+
+	if recentSince.Before(since) {
+		since = recentSince
+	}
+
+	// count the comments of the user with the same body since
+	// `duplicatesSince` and all their comments since `recentSince`,
+	// counting the ones held back for a review as well
+	var lastDuplicate, firstRecent int64
+
+	err := db.c.QueryRowContext(ctx, `
+		SELECT
+			COALESCE(SUM(CASE WHEN comment_body=? AND date >= ? THEN 1 ELSE 0 END), 0),
+			COALESCE(MAX(CASE WHEN comment_body=? AND date >= ? THEN date END), 0),
+			COALESCE(SUM(CASE WHEN date >= ? THEN 1 ELSE 0 END), 0),
+			COALESCE(MIN(CASE WHEN date >= ? THEN date END), 0)
+		FROM (
+			SELECT date, comment_body
+			FROM Comment
+			WHERE "user"=?
+			AND date >= ?
+			UNION ALL
+			SELECT date, comment_body
+			FROM held_comment
+			WHERE "user"=?
+			AND date >= ?
+		) AS activity
+	`, body, duplicatesSince.Unix(), body, duplicatesSince.Unix(), recentSince.Unix(), recentSince.Unix(),
+		dbUser.Id, since.Unix(), dbUser.Id, since.Unix()).Scan(&dbActivity.Duplicates, &lastDuplicate, &dbActivity.Recent, &firstRecent)
+
+	if err != nil {
+		return dbActivity, err
+	}
+
+	if dbActivity.Duplicates > 0 {
+		dbActivity.LastDuplicate = time.Unix(lastDuplicate, 0).UTC()
+	}
+
+	if dbActivity.Recent > 0 {
+		dbActivity.FirstRecent = time.Unix(firstRecent, 0).UTC()
+	}
+
+	return dbActivity, nil
+}
+
+// insertCommentTx inserts the comment inside the transaction `tx`, setting its id, together
+// with its hashtags, its mentions (looked up by `usernameKey`) and its notifications, and
+// counts it under its photo
+func insertCommentTx(ctx context.Context, tx *dbtx, dbComment *DatabaseComment, usernameKey func(string) string) error {
+	// insert the comment into the database
+	// and get the comment id
+	err := tx.QueryRowContext(ctx, `
+		INSERT INTO Comment("user", photo, date, comment_body)
+		VALUES (?, ?, ?, ?)
+		RETURNING id
+	`, dbComment.User.Id, dbComment.Photo.Id, dbComment.Date.Unix(), dbComment.CommentBody).Scan(&dbComment.Id)
+
+	if err != nil {
+		return err
+	}
+
+	err = insertHashtagsTx(ctx, tx, dbComment.Id, dbComment.Photo.Id, dbComment.CommentBody)
+
+	if err != nil {
+		return err
+	}
+
+	err = insertMentionsTx(ctx, tx, *dbComment, usernameKey)
+
+	if err != nil {
+		return err
+	}
+
+	err = insertCommentNotificationsTx(ctx, tx, *dbComment)
+
+	if err != nil {
+		return err
+	}
+
+	return addPhotoCommentCount(ctx, tx, dbComment.Photo.Id, 1)
+}
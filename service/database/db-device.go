@@ -0,0 +1,110 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+func (db *appdbimpl) GetDatabaseDevice(ctx context.Context, deviceId uint32) (DatabaseDevice, error) {
+	dbDevice := DatabaseDeviceDefault()
+
+	err := db.c.QueryRowContext(ctx, `
+		SELECT id, "user", platform, token, date
+		FROM device
+		WHERE id=?
+	`, deviceId).Scan(&dbDevice.Id, &dbDevice.User.Id, &dbDevice.Platform, &dbDevice.Token, unixTime{&dbDevice.Date})
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return dbDevice, ErrDeviceDoesNotExist
+	}
+
+	if err != nil {
+		return dbDevice, err
+	}
+
+	// get the user information
+	dbDevice.User, err = db.GetDatabaseUser(ctx, dbDevice.User.Id)
+
+	return dbDevice, err
+}
+
+func (db *appdbimpl) InsertDevice(ctx context.Context, dbDevice *DatabaseDevice) error {
+	// insert the device into the database and get its id; a
+	// token which is already registered passes to the user, as
+	// the device was handed over or another account logged in
+	return db.retry(ctx, func() error {
+		return db.c.QueryRowContext(ctx, `
+			INSERT INTO device("user", platform, token, date)
+			VALUES (?, ?, ?, ?)
+			ON CONFLICT (token) DO UPDATE
+			SET "user"=excluded."user", platform=excluded.platform, date=excluded.date
+			RETURNING id
+		`, dbDevice.User.Id, dbDevice.Platform, dbDevice.Token, dbDevice.Date.Unix()).Scan(&dbDevice.Id)
+	})
+}
+
+func (db *appdbimpl) DeleteDevice(ctx context.Context, dbDevice DatabaseDevice) error {
+	var res sql.Result
+
+	// remove the device from the database
+	err := db.retry(ctx, func() (err error) {
+		res, err = db.c.ExecContext(ctx, `
+			DELETE FROM device
+			WHERE id=?
+		`, dbDevice.Id)
+
+		return err
+	})
+
+	if err != nil {
+		return err
+	}
+
+	aff, err := res.RowsAffected()
+
+	if err != nil {
+		return err
+	}
+
+	// if there are no affected rows
+	// then the device did not exist
+	if aff == 0 {
+		return ErrDeviceDoesNotExist
+	}
+
+	return nil
+}
+
+func (db *appdbimpl) GetDevices(ctx context.Context, dbUser DatabaseUser) ([]DatabaseDevice, error) {
+	dbDevices := make([]DatabaseDevice, 0)
+
+	// get the devices of the user, from the first registered
+	rows, err := db.c.QueryContext(ctx, `
+		SELECT id, platform, token, date
+		FROM device
+		WHERE "user"=?
+		ORDER BY id
+	`, dbUser.Id)
+
+	if err != nil {
+		return dbDevices, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		dbDevice := DatabaseDeviceDefault()
+		dbDevice.User = dbUser
+
+		err = rows.Scan(&dbDevice.Id, &dbDevice.Platform, &dbDevice.Token, unixTime{&dbDevice.Date})
+
+		if err != nil {
+			return dbDevices, err
+		}
+
+		dbDevices = append(dbDevices, dbDevice)
+	}
+
+	return dbDevices, rows.Err()
+}
@@ -0,0 +1,495 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// postgresDialect is the dialect of PostgreSQL databases
+type postgresDialect struct{}
+
+func (postgresDialect) rebind(query string) string {
+	// PostgreSQL expects numbered placeholders ($1, $2, ...)
+	var b strings.Builder
+
+	n := 0
+
+	for _, c := range query {
+		if c == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+		} else {
+			b.WriteRune(c)
+		}
+	}
+
+	return b.String()
+}
+
+func (postgresDialect) setup(db *sql.DB) error {
+	// foreign keys are always enforced by PostgreSQL
+	return nil
+}
+
+func (postgresDialect) schema() []string {
+	userTable := `
+		CREATE TABLE IF NOT EXISTS "User" (
+			id INTEGER GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+			username TEXT NOT NULL UNIQUE,
+			deactivated_at BIGINT,
+			version INTEGER NOT NULL DEFAULT 0,
+			strip_location BOOLEAN NOT NULL DEFAULT FALSE,
+			email TEXT,
+			email_verified BOOLEAN NOT NULL DEFAULT FALSE,
+			digest_sent_at BIGINT
+		);
+	`
+	photoTable := `
+		CREATE TABLE IF NOT EXISTS Photo (
+			id INTEGER GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+			"user" INTEGER NOT NULL,
+			url TEXT NOT NULL,
+			date BIGINT NOT NULL,
+			archived BOOLEAN NOT NULL DEFAULT FALSE,
+			like_count INTEGER NOT NULL DEFAULT 0,
+			comment_count INTEGER NOT NULL DEFAULT 0,
+			phash BIGINT,
+			latitude DOUBLE PRECISION,
+			longitude DOUBLE PRECISION,
+			place TEXT,
+			place_key TEXT,
+			pinned_at BIGINT,
+			FOREIGN KEY ("user") REFERENCES "User"(id) ON DELETE CASCADE
+		);
+	`
+	commentTable := `
+		CREATE TABLE IF NOT EXISTS Comment (
+			id INTEGER GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+			"user" INTEGER NOT NULL,
+			photo INTEGER NOT NULL,
+			date BIGINT NOT NULL,
+			comment_body TEXT NOT NULL,
+			FOREIGN KEY ("user") REFERENCES "User"(id) ON DELETE CASCADE,
+			FOREIGN KEY (photo) REFERENCES Photo(id) ON DELETE CASCADE
+		);
+	`
+	followTable := `
+		CREATE TABLE IF NOT EXISTS follow (
+			first_user INTEGER NOT NULL,
+			second_user INTEGER NOT NULL,
+			PRIMARY KEY (first_user, second_user),
+			FOREIGN KEY (first_user) REFERENCES "User"(id) ON DELETE CASCADE,
+			FOREIGN KEY (second_user) REFERENCES "User"(id) ON DELETE CASCADE
+		);
+	`
+	banTable := `
+		CREATE TABLE IF NOT EXISTS ban (
+			first_user INTEGER NOT NULL,
+			second_user INTEGER NOT NULL,
+			PRIMARY KEY (first_user, second_user),
+			FOREIGN KEY (first_user) REFERENCES "User"(id) ON DELETE CASCADE,
+			FOREIGN KEY (second_user) REFERENCES "User"(id) ON DELETE CASCADE
+		);
+	`
+	likeTable := `
+		CREATE TABLE IF NOT EXISTS "like" (
+			"user" INTEGER NOT NULL,
+			photo INTEGER NOT NULL,
+			type TEXT NOT NULL DEFAULT 'like',
+			date BIGINT,
+			PRIMARY KEY ("user", photo),
+			FOREIGN KEY ("user") REFERENCES "User"(id) ON DELETE CASCADE,
+			FOREIGN KEY (photo) REFERENCES Photo(id) ON DELETE CASCADE
+		);
+	`
+
+	return []string{userTable, photoTable, commentTable, followTable, banTable, likeTable, indexes, commentSearch, postgresAuditTable, postgresHashtagTables, mentionTable, postgresAlbumTables, photoPlaceIndex, postgresStoryTable, postgresNotificationTable, postgresDeviceTable, addNotificationPushed, activityIndexes, postgresSessionTable, postgresRefreshTokenTable, postgresIdentityTable, postgresAPIKeyTable, postgresUrlIndexes, muteTable, closeFriendsTable, addUserSuspendedAt, postgresBlocklistTables, addPhotoFlagged, commentUserDateIndexes, addUserShadowBanned, addBanReasonExpiry, postgresErasureTable, postgresWebhookTables, postgresIdempotencyKeyTable, addUserStreamSeenAt, settingsTables, notificationPreferenceTable, addUserProfile, addUserAvatar, usernameHistoryTable, addUsernameKey, postgresReservedNameTable, addPhotoMedia, addPhotoScheduled, addPhotoOriginalUrl, addPhotoAltText, photoImportTable}
+}
+
+func (postgresDialect) migrations() []string {
+	// replace the foreign keys with ones cascading on delete
+	fixForeignKeys := `
+		ALTER TABLE Photo
+			DROP CONSTRAINT IF EXISTS photo_user_fkey,
+			ADD CONSTRAINT photo_user_fkey FOREIGN KEY ("user") REFERENCES "User"(id) ON DELETE CASCADE;
+		ALTER TABLE Comment
+			DROP CONSTRAINT IF EXISTS comment_user_fkey,
+			DROP CONSTRAINT IF EXISTS comment_photo_fkey,
+			ADD CONSTRAINT comment_user_fkey FOREIGN KEY ("user") REFERENCES "User"(id) ON DELETE CASCADE,
+			ADD CONSTRAINT comment_photo_fkey FOREIGN KEY (photo) REFERENCES Photo(id) ON DELETE CASCADE;
+		ALTER TABLE follow
+			DROP CONSTRAINT IF EXISTS follow_first_user_fkey,
+			DROP CONSTRAINT IF EXISTS follow_second_user_fkey,
+			ADD CONSTRAINT follow_first_user_fkey FOREIGN KEY (first_user) REFERENCES "User"(id) ON DELETE CASCADE,
+			ADD CONSTRAINT follow_second_user_fkey FOREIGN KEY (second_user) REFERENCES "User"(id) ON DELETE CASCADE;
+		ALTER TABLE ban
+			DROP CONSTRAINT IF EXISTS ban_first_user_fkey,
+			DROP CONSTRAINT IF EXISTS ban_second_user_fkey,
+			ADD CONSTRAINT ban_first_user_fkey FOREIGN KEY (first_user) REFERENCES "User"(id) ON DELETE CASCADE,
+			ADD CONSTRAINT ban_second_user_fkey FOREIGN KEY (second_user) REFERENCES "User"(id) ON DELETE CASCADE;
+		ALTER TABLE "like"
+			DROP CONSTRAINT IF EXISTS like_user_fkey,
+			DROP CONSTRAINT IF EXISTS like_photo_fkey,
+			ADD CONSTRAINT like_user_fkey FOREIGN KEY ("user") REFERENCES "User"(id) ON DELETE CASCADE,
+			ADD CONSTRAINT like_photo_fkey FOREIGN KEY (photo) REFERENCES Photo(id) ON DELETE CASCADE;
+	`
+
+	addPhotoArchived := `
+		ALTER TABLE Photo ADD COLUMN archived BOOLEAN NOT NULL DEFAULT FALSE;
+	`
+
+	addUserDeactivatedAt := `
+		ALTER TABLE "User" ADD COLUMN deactivated_at TEXT;
+	`
+
+	addPhotoCounters := `
+		ALTER TABLE Photo ADD COLUMN like_count INTEGER NOT NULL DEFAULT 0;
+		ALTER TABLE Photo ADD COLUMN comment_count INTEGER NOT NULL DEFAULT 0;
+	` + rebuildPhotoCounters
+
+	convertDates := `
+		ALTER TABLE Photo
+			ALTER COLUMN date TYPE BIGINT
+			USING CAST(EXTRACT(EPOCH FROM CAST(date AS TIMESTAMP)) AS BIGINT);
+		ALTER TABLE Comment
+			ALTER COLUMN date TYPE BIGINT
+			USING CAST(EXTRACT(EPOCH FROM CAST(date AS TIMESTAMP)) AS BIGINT);
+		ALTER TABLE "User"
+			ALTER COLUMN deactivated_at TYPE BIGINT
+			USING CAST(EXTRACT(EPOCH FROM CAST(deactivated_at AS TIMESTAMP)) AS BIGINT);
+	`
+
+	return []string{fixForeignKeys, addPhotoArchived, addUserDeactivatedAt, addPhotoCounters, convertDates, indexes, commentSearch, postgresAuditTable, addUserVersion, addPhotoHash, postgresHashtagTables, mentionTable, addLikeType, postgresAlbumTables, addPhotoLocation, addPhotoPinnedAt, postgresStoryTable, postgresNotificationTable, postgresDeviceTable, addNotificationPushed, addUserEmail, addLikeDate, postgresSessionTable, postgresRefreshTokenTable, postgresIdentityTable, addEmailVerified, postgresAPIKeyTable, postgresUrlIndexes, muteTable, closeFriendsTable, addUserSuspendedAt, postgresBlocklistTables, addPhotoFlagged, commentUserDateIndexes, addUserShadowBanned, addBanReasonExpiry, postgresErasureTable, postgresWebhookTables, postgresIdempotencyKeyTable, addUserStreamSeenAt, settingsTables, notificationPreferenceTable, addUserProfile, addUserAvatar, usernameHistoryTable, addUsernameKey, postgresReservedNameTable, addPhotoMedia, addPhotoScheduled, addPhotoOriginalUrl, addPhotoAltText, photoImportTable}
+}
+
+// postgresAuditTable records the destructive operations, without foreign keys
+// since its entries must outlive the users and the photos they refer to
+const postgresAuditTable = `
+	CREATE TABLE IF NOT EXISTS audit (
+		id INTEGER GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+		actor INTEGER NOT NULL,
+		action TEXT NOT NULL,
+		target INTEGER NOT NULL,
+		details TEXT NOT NULL,
+		date BIGINT NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS audit_actor_date_idx ON audit(actor, date);
+`
+
+// postgresHashtagTables holds the hashtags and the photos tagged with them, each
+// tag coming from a comment under the photo and going away together with it
+const postgresHashtagTables = `
+	CREATE TABLE IF NOT EXISTS hashtag (
+		id INTEGER GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+		name TEXT NOT NULL UNIQUE
+	);
+	CREATE TABLE IF NOT EXISTS photo_hashtag (
+		photo INTEGER NOT NULL,
+		hashtag INTEGER NOT NULL,
+		comment INTEGER NOT NULL,
+		PRIMARY KEY (comment, hashtag),
+		FOREIGN KEY (photo) REFERENCES Photo(id) ON DELETE CASCADE,
+		FOREIGN KEY (hashtag) REFERENCES hashtag(id) ON DELETE CASCADE,
+		FOREIGN KEY (comment) REFERENCES Comment(id) ON DELETE CASCADE
+	);
+	CREATE INDEX IF NOT EXISTS photo_hashtag_hashtag_idx ON photo_hashtag(hashtag, photo);
+`
+
+// commentSearch is the full text index of the bodies of the comments
+const commentSearch = `
+	CREATE INDEX IF NOT EXISTS comment_body_search_idx ON Comment
+	USING GIN (to_tsvector('simple', comment_body));
+`
+
+// postgresAlbumTables holds the albums of the users and the photos they group, in
+// their order; a photo leaves its albums when it is deleted
+const postgresAlbumTables = `
+	CREATE TABLE IF NOT EXISTS album (
+		id INTEGER GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+		"user" INTEGER NOT NULL,
+		name TEXT NOT NULL,
+		date BIGINT NOT NULL,
+		FOREIGN KEY ("user") REFERENCES "User"(id) ON DELETE CASCADE
+	);
+	CREATE INDEX IF NOT EXISTS album_user_date_idx ON album("user", date);
+	CREATE TABLE IF NOT EXISTS album_photo (
+		album INTEGER NOT NULL,
+		photo INTEGER NOT NULL,
+		position INTEGER NOT NULL,
+		PRIMARY KEY (album, photo),
+		FOREIGN KEY (album) REFERENCES album(id) ON DELETE CASCADE,
+		FOREIGN KEY (photo) REFERENCES Photo(id) ON DELETE CASCADE
+	);
+`
+
+// postgresStoryTable holds the stories of the users, which are only shown
+// until they expire and are then removed by the cleanup job
+const postgresStoryTable = `
+	CREATE TABLE IF NOT EXISTS story (
+		id INTEGER GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+		"user" INTEGER NOT NULL,
+		url TEXT NOT NULL,
+		date BIGINT NOT NULL,
+		expires_at BIGINT NOT NULL,
+		FOREIGN KEY ("user") REFERENCES "User"(id) ON DELETE CASCADE
+	);
+	CREATE INDEX IF NOT EXISTS story_user_expires_at_idx ON story("user", expires_at);
+`
+
+// postgresNotificationTable holds the notifications of the users about the likes, the comments,
+// the mentions and the follows they received; a notification goes away together with what
+// it is about
+const postgresNotificationTable = `
+	CREATE TABLE IF NOT EXISTS notification (
+		id INTEGER GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+		"user" INTEGER NOT NULL,
+		actor INTEGER NOT NULL,
+		type TEXT NOT NULL,
+		photo INTEGER,
+		comment INTEGER,
+		date BIGINT NOT NULL,
+		read BOOLEAN NOT NULL DEFAULT FALSE,
+		FOREIGN KEY ("user") REFERENCES "User"(id) ON DELETE CASCADE,
+		FOREIGN KEY (actor) REFERENCES "User"(id) ON DELETE CASCADE,
+		FOREIGN KEY (photo) REFERENCES Photo(id) ON DELETE CASCADE,
+		FOREIGN KEY (comment) REFERENCES Comment(id) ON DELETE CASCADE
+	);
+	CREATE INDEX IF NOT EXISTS notification_user_date_idx ON notification("user", date);
+`
+
+// postgresDeviceTable holds the devices registered by the users to receive their notifications,
+// each one identified by the token given by the push service of its platform
+const postgresDeviceTable = `
+	CREATE TABLE IF NOT EXISTS device (
+		id INTEGER GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+		"user" INTEGER NOT NULL,
+		platform TEXT NOT NULL,
+		token TEXT NOT NULL UNIQUE,
+		date BIGINT NOT NULL,
+		FOREIGN KEY ("user") REFERENCES "User"(id) ON DELETE CASCADE
+	);
+	CREATE INDEX IF NOT EXISTS device_user_idx ON device("user");
+`
+
+// postgresSessionTable holds the sessions of the users, each one identified by the hash of its token,
+// so that the tokens can be revoked before they expire; the expired ones are looked up by user
+const postgresSessionTable = `
+	CREATE TABLE IF NOT EXISTS session (
+		id INTEGER GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+		token_hash TEXT NOT NULL UNIQUE,
+		"user" INTEGER NOT NULL,
+		created_at BIGINT NOT NULL,
+		expires_at BIGINT NOT NULL,
+		last_seen BIGINT NOT NULL,
+		FOREIGN KEY ("user") REFERENCES "User"(id) ON DELETE CASCADE
+	);
+	CREATE INDEX IF NOT EXISTS session_user_expires_at_idx ON session("user", expires_at);
+`
+
+// postgresRefreshTokenTable holds the refresh tokens of the sessions, each one identified by its hash; the
+// tokens which were exchanged are kept until they expire, so that their reuse can be detected
+const postgresRefreshTokenTable = `
+	CREATE TABLE IF NOT EXISTS refresh_token (
+		id INTEGER GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+		session INTEGER NOT NULL,
+		token_hash TEXT NOT NULL UNIQUE,
+		created_at BIGINT NOT NULL,
+		expires_at BIGINT NOT NULL,
+		used BOOLEAN NOT NULL DEFAULT FALSE,
+		FOREIGN KEY (session) REFERENCES session(id) ON DELETE CASCADE
+	);
+	CREATE INDEX IF NOT EXISTS refresh_token_session_idx ON refresh_token(session);
+`
+
+// postgresIdentityTable links the users signing in through an external provider to their
+// WASAPhoto user, each one identified by its subject within the provider
+const postgresIdentityTable = `
+	CREATE TABLE IF NOT EXISTS identity (
+		provider TEXT NOT NULL,
+		subject TEXT NOT NULL,
+		"user" INTEGER NOT NULL,
+		date BIGINT NOT NULL,
+		PRIMARY KEY (provider, subject),
+		FOREIGN KEY ("user") REFERENCES "User"(id) ON DELETE CASCADE
+	);
+	CREATE INDEX IF NOT EXISTS identity_user_idx ON identity("user");
+`
+
+// postgresAPIKeyTable holds the keys the users mint for their integrations, each one identified
+// by its hash, with what it may do and how many requests per minute it may send
+const postgresAPIKeyTable = `
+	CREATE TABLE IF NOT EXISTS api_key (
+		id INTEGER GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+		"user" INTEGER NOT NULL,
+		name TEXT NOT NULL,
+		key_hash TEXT NOT NULL UNIQUE,
+		scope TEXT NOT NULL,
+		rate_limit INTEGER NOT NULL,
+		created_at BIGINT NOT NULL,
+		last_used_at BIGINT,
+		FOREIGN KEY ("user") REFERENCES "User"(id) ON DELETE CASCADE
+	);
+	CREATE INDEX IF NOT EXISTS api_key_user_idx ON api_key("user");
+`
+
+// postgresUrlIndexes support the lookup of the photos and the stories served at a url, which
+// share their file when they have the same content; the indexes are hashes, since the urls
+// of the older photos hold the whole image and exceed the size of the entries of a B-tree
+const postgresUrlIndexes = `
+	CREATE INDEX IF NOT EXISTS photo_url_idx ON Photo USING HASH (url);
+	CREATE INDEX IF NOT EXISTS story_url_idx ON story USING HASH (url);
+`
+
+// postgresBlocklistTables hold the words and the patterns the administrators block in the comments,
+// besides the ones of the configuration, and the comments held back for matching them until
+// the administrators review them
+const postgresBlocklistTables = `
+	CREATE TABLE IF NOT EXISTS blocked_term (
+		id INTEGER GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+		term TEXT NOT NULL,
+		pattern BOOLEAN NOT NULL,
+		UNIQUE (term, pattern)
+	);
+	CREATE TABLE IF NOT EXISTS held_comment (
+		id INTEGER GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+		"user" INTEGER NOT NULL,
+		photo INTEGER NOT NULL,
+		date BIGINT NOT NULL,
+		comment_body TEXT NOT NULL,
+		term TEXT NOT NULL,
+		FOREIGN KEY ("user") REFERENCES "User"(id) ON DELETE CASCADE,
+		FOREIGN KEY (photo) REFERENCES Photo(id) ON DELETE CASCADE
+	);
+`
+
+// postgresReservedNameTable holds the usernames the administrators reserve, besides the ones of the configuration: a
+// name is either reserved as it is or blocked wherever it is contained in a username
+const postgresReservedNameTable = `
+	CREATE TABLE IF NOT EXISTS reserved_name (
+		id INTEGER GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+		name TEXT NOT NULL,
+		contained BOOLEAN NOT NULL,
+		UNIQUE (name, contained)
+	);
+`
+
+// postgresErasureTable records the erasures of the accounts requested by the users, without foreign keys since
+// its rows must outlive the users they erase; a user can have a single erasure pending at a time
+const postgresErasureTable = `
+	CREATE TABLE IF NOT EXISTS erasure (
+		id INTEGER GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+		"user" INTEGER NOT NULL,
+		requested_at BIGINT NOT NULL,
+		completed_at BIGINT
+	);
+	CREATE UNIQUE INDEX IF NOT EXISTS erasure_pending_user_idx ON erasure("user") WHERE completed_at IS NULL;
+`
+
+// postgresWebhookTables holds the webhooks registered by the administrators, the events each one is subscribed
+// to, and the deliveries of the events, which are kept after they end as the log of the webhook
+const postgresWebhookTables = `
+	CREATE TABLE IF NOT EXISTS webhook (
+		id INTEGER GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+		url TEXT NOT NULL,
+		secret TEXT NOT NULL,
+		date BIGINT NOT NULL
+	);
+	CREATE TABLE IF NOT EXISTS webhook_event (
+		webhook INTEGER NOT NULL,
+		event TEXT NOT NULL,
+		PRIMARY KEY (webhook, event),
+		FOREIGN KEY (webhook) REFERENCES webhook(id) ON DELETE CASCADE
+	);
+	CREATE INDEX IF NOT EXISTS webhook_event_event_idx ON webhook_event(event);
+	CREATE TABLE IF NOT EXISTS webhook_delivery (
+		id INTEGER GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+		webhook INTEGER NOT NULL,
+		event TEXT NOT NULL,
+		payload TEXT NOT NULL,
+		date BIGINT NOT NULL,
+		attempts INTEGER NOT NULL DEFAULT 0,
+		next_attempt_at BIGINT,
+		delivered_at BIGINT,
+		status_code INTEGER NOT NULL DEFAULT 0,
+		error TEXT NOT NULL DEFAULT '',
+		FOREIGN KEY (webhook) REFERENCES webhook(id) ON DELETE CASCADE
+	);
+	CREATE INDEX IF NOT EXISTS webhook_delivery_due_idx ON webhook_delivery(next_attempt_at) WHERE next_attempt_at IS NOT NULL;
+	CREATE INDEX IF NOT EXISTS webhook_delivery_webhook_idx ON webhook_delivery(webhook, id);
+	CREATE INDEX IF NOT EXISTS webhook_delivery_date_idx ON webhook_delivery(date);
+`
+
+// postgresIdempotencyKeyTable holds the idempotency keys sent by the users with their requests, together with the
+// response to replay on a retry; a key is still in progress while its status is 0
+const postgresIdempotencyKeyTable = `
+	CREATE TABLE IF NOT EXISTS idempotency_key (
+		"user" INTEGER NOT NULL,
+		"key" TEXT NOT NULL,
+		fingerprint TEXT NOT NULL,
+		status INTEGER NOT NULL DEFAULT 0,
+		content_type TEXT NOT NULL DEFAULT '',
+		body BYTEA,
+		date BIGINT NOT NULL,
+		PRIMARY KEY ("user", "key"),
+		FOREIGN KEY ("user") REFERENCES "User"(id) ON DELETE CASCADE
+	);
+	CREATE INDEX IF NOT EXISTS idempotency_key_date_idx ON idempotency_key(date);
+`
+
+func (postgresDialect) tableExists() string {
+	return `
+		SELECT EXISTS(
+			SELECT 1
+			FROM information_schema.tables
+			WHERE table_schema=current_schema()
+			AND table_name=?
+		)
+	`
+}
+
+func (postgresDialect) withoutForeignKeys(conn *sql.Conn, fn func() error) error {
+	// migrations alter the constraints in place,
+	// hence foreign keys can be left enabled
+	return fn()
+}
+
+func (postgresDialect) isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+func (postgresDialect) isBusy(err error) bool {
+	var pqErr *pq.Error
+
+	// serialization_failure and deadlock_detected
+	return errors.As(err, &pqErr) && (pqErr.Code == "40001" || pqErr.Code == "40P01")
+}
+
+func (postgresDialect) setupSearch(db *sql.DB) (bool, error) {
+	// the comments are indexed by the commentSearch
+	// index, which PostgreSQL keeps in sync by itself
+	return true, nil
+}
+
+func (postgresDialect) matchComment(fullText bool, text string) (string, []interface{}) {
+	if !fullText {
+		return matchWords("comment_body", text)
+	}
+
+	return `to_tsvector('simple', comment_body) @@ plainto_tsquery('simple', ?)`, []interface{}{text}
+}
+
+// backup is not supported, PostgreSQL databases
+// must be saved with pg_dump instead
+func (postgresDialect) backup() string {
+	return ""
+}
+
+func (postgresDialect) system() string {
+	return "postgresql"
+}
@@ -0,0 +1,672 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// sqliteDialect is the dialect of SQLite databases
+type sqliteDialect struct{}
+
+func (sqliteDialect) rebind(query string) string {
+	// SQLite natively understands `?` placeholders
+	return query
+}
+
+func (sqliteDialect) setup(db *sql.DB) error {
+	// check that foreign keys are enforced, since they
+	// must be enabled on every connection of the pool
+	// through the data source name
+	var foreignKeys bool
+
+	err := db.QueryRow("PRAGMA foreign_keys").Scan(&foreignKeys)
+
+	if err != nil {
+		return err
+	}
+
+	if !foreignKeys {
+		return errors.New("foreign keys are not enforced: open the database using SQLiteConfig.DataSourceName")
+	}
+
+	return nil
+}
+
+func (sqliteDialect) schema() []string {
+	userTable := `
+		CREATE TABLE IF NOT EXISTS "User" (
+			id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+			username TEXT NOT NULL UNIQUE,
+			deactivated_at INTEGER,
+			version INTEGER NOT NULL DEFAULT 0,
+			strip_location BOOLEAN NOT NULL DEFAULT FALSE,
+			email TEXT,
+			email_verified BOOLEAN NOT NULL DEFAULT FALSE,
+			digest_sent_at INTEGER
+		);
+	`
+	photoTable := `
+		CREATE TABLE IF NOT EXISTS Photo (
+			id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+			"user" INTEGER NOT NULL,
+			url TEXT NOT NULL,
+			date INTEGER NOT NULL,
+			archived BOOLEAN NOT NULL DEFAULT FALSE,
+			like_count INTEGER NOT NULL DEFAULT 0,
+			comment_count INTEGER NOT NULL DEFAULT 0,
+			phash BIGINT,
+			latitude DOUBLE PRECISION,
+			longitude DOUBLE PRECISION,
+			place TEXT,
+			place_key TEXT,
+			pinned_at BIGINT,
+			FOREIGN KEY ("user") REFERENCES "User"(id) ON DELETE CASCADE
+		);
+	`
+	commentTable := `
+		CREATE TABLE IF NOT EXISTS Comment (
+			id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+			"user" INTEGER NOT NULL,
+			photo INTEGER NOT NULL,
+			date INTEGER NOT NULL,
+			comment_body TEXT NOT NULL,
+			FOREIGN KEY ("user") REFERENCES "User"(id) ON DELETE CASCADE,
+			FOREIGN KEY (photo) REFERENCES Photo(id) ON DELETE CASCADE
+		);
+	`
+	followTable := `
+		CREATE TABLE IF NOT EXISTS follow (
+			first_user INTEGER NOT NULL,
+			second_user INTEGER NOT NULL,
+			PRIMARY KEY (first_user, second_user),
+			FOREIGN KEY (first_user) REFERENCES "User"(id) ON DELETE CASCADE,
+			FOREIGN KEY (second_user) REFERENCES "User"(id) ON DELETE CASCADE
+		);
+	`
+	banTable := `
+		CREATE TABLE IF NOT EXISTS ban (
+			first_user INTEGER NOT NULL,
+			second_user INTEGER NOT NULL,
+			PRIMARY KEY (first_user, second_user),
+			FOREIGN KEY (first_user) REFERENCES "User"(id) ON DELETE CASCADE,
+			FOREIGN KEY (second_user) REFERENCES "User"(id) ON DELETE CASCADE
+		);
+	`
+	likeTable := `
+		CREATE TABLE IF NOT EXISTS "like" (
+			"user" INTEGER NOT NULL,
+			photo INTEGER NOT NULL,
+			type TEXT NOT NULL DEFAULT 'like',
+			date BIGINT,
+			PRIMARY KEY ("user", photo),
+			FOREIGN KEY ("user") REFERENCES "User"(id) ON DELETE CASCADE,
+			FOREIGN KEY (photo) REFERENCES Photo(id) ON DELETE CASCADE
+		);
+	`
+
+	return []string{userTable, photoTable, commentTable, followTable, banTable, likeTable, indexes, sqliteAuditTable, sqliteHashtagTables, mentionTable, sqliteAlbumTables, photoPlaceIndex, sqliteStoryTable, sqliteNotificationTable, sqliteDeviceTable, addNotificationPushed, activityIndexes, sqliteSessionTable, sqliteRefreshTokenTable, sqliteIdentityTable, sqliteAPIKeyTable, sqliteUrlIndexes, muteTable, closeFriendsTable, addUserSuspendedAt, sqliteBlocklistTables, addPhotoFlagged, commentUserDateIndexes, addUserShadowBanned, addBanReasonExpiry, sqliteErasureTable, sqliteWebhookTables, sqliteIdempotencyKeyTable, addUserStreamSeenAt, settingsTables, notificationPreferenceTable, addUserProfile, addUserAvatar, usernameHistoryTable, addUsernameKey, sqliteReservedNameTable, addPhotoMedia, addPhotoScheduled, addPhotoOriginalUrl, addPhotoAltText, photoImportTable}
+}
+
+func (sqliteDialect) migrations() []string {
+	// SQLite cannot alter the constraints of a table, hence
+	// every table gets rebuilt with the new constraints
+	// and the rows referencing missing users or photos
+	// are dropped while being copied
+	fixForeignKeys := `
+		CREATE TABLE Photo_new (
+			id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+			"user" INTEGER NOT NULL,
+			url TEXT NOT NULL,
+			date TEXT NOT NULL,
+			FOREIGN KEY ("user") REFERENCES "User"(id) ON DELETE CASCADE
+		);
+		INSERT INTO Photo_new(id, "user", url, date)
+		SELECT id, "user", url, date
+		FROM Photo
+		WHERE "user" IN (SELECT id FROM "User");
+		DROP TABLE Photo;
+		ALTER TABLE Photo_new RENAME TO Photo;
+
+		CREATE TABLE Comment_new (
+			id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+			"user" INTEGER NOT NULL,
+			photo INTEGER NOT NULL,
+			date TEXT NOT NULL,
+			comment_body TEXT NOT NULL,
+			FOREIGN KEY ("user") REFERENCES "User"(id) ON DELETE CASCADE,
+			FOREIGN KEY (photo) REFERENCES Photo(id) ON DELETE CASCADE
+		);
+		INSERT INTO Comment_new(id, "user", photo, date, comment_body)
+		SELECT id, "user", photo, date, comment_body
+		FROM Comment
+		WHERE "user" IN (SELECT id FROM "User")
+		AND photo IN (SELECT id FROM Photo);
+		DROP TABLE Comment;
+		ALTER TABLE Comment_new RENAME TO Comment;
+
+		CREATE TABLE follow_new (
+			first_user INTEGER NOT NULL,
+			second_user INTEGER NOT NULL,
+			PRIMARY KEY (first_user, second_user),
+			FOREIGN KEY (first_user) REFERENCES "User"(id) ON DELETE CASCADE,
+			FOREIGN KEY (second_user) REFERENCES "User"(id) ON DELETE CASCADE
+		);
+		INSERT INTO follow_new(first_user, second_user)
+		SELECT first_user, second_user
+		FROM follow
+		WHERE first_user IN (SELECT id FROM "User")
+		AND second_user IN (SELECT id FROM "User");
+		DROP TABLE follow;
+		ALTER TABLE follow_new RENAME TO follow;
+
+		CREATE TABLE ban_new (
+			first_user INTEGER NOT NULL,
+			second_user INTEGER NOT NULL,
+			PRIMARY KEY (first_user, second_user),
+			FOREIGN KEY (first_user) REFERENCES "User"(id) ON DELETE CASCADE,
+			FOREIGN KEY (second_user) REFERENCES "User"(id) ON DELETE CASCADE
+		);
+		INSERT INTO ban_new(first_user, second_user)
+		SELECT first_user, second_user
+		FROM ban
+		WHERE first_user IN (SELECT id FROM "User")
+		AND second_user IN (SELECT id FROM "User");
+		DROP TABLE ban;
+		ALTER TABLE ban_new RENAME TO ban;
+
+		CREATE TABLE like_new (
+			"user" INTEGER NOT NULL,
+			photo INTEGER NOT NULL,
+			PRIMARY KEY ("user", photo),
+			FOREIGN KEY ("user") REFERENCES "User"(id) ON DELETE CASCADE,
+			FOREIGN KEY (photo) REFERENCES Photo(id) ON DELETE CASCADE
+		);
+		INSERT INTO like_new("user", photo)
+		SELECT "user", photo
+		FROM "like"
+		WHERE "user" IN (SELECT id FROM "User")
+		AND photo IN (SELECT id FROM Photo);
+		DROP TABLE "like";
+		ALTER TABLE like_new RENAME TO "like";
+	`
+
+	addPhotoArchived := `
+		ALTER TABLE Photo ADD COLUMN archived BOOLEAN NOT NULL DEFAULT FALSE;
+	`
+
+	addUserDeactivatedAt := `
+		ALTER TABLE "User" ADD COLUMN deactivated_at TEXT;
+	`
+
+	addPhotoCounters := `
+		ALTER TABLE Photo ADD COLUMN like_count INTEGER NOT NULL DEFAULT 0;
+		ALTER TABLE Photo ADD COLUMN comment_count INTEGER NOT NULL DEFAULT 0;
+	` + rebuildPhotoCounters
+
+	// the dates become unix timestamps: SQLite cannot change
+	// the type of a column, hence the tables are rebuilt
+	// while the user column is replaced by a new one
+	convertDates := `
+		CREATE TABLE Photo_new (
+			id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+			"user" INTEGER NOT NULL,
+			url TEXT NOT NULL,
+			date INTEGER NOT NULL,
+			archived BOOLEAN NOT NULL DEFAULT FALSE,
+			like_count INTEGER NOT NULL DEFAULT 0,
+			comment_count INTEGER NOT NULL DEFAULT 0,
+			FOREIGN KEY ("user") REFERENCES "User"(id) ON DELETE CASCADE
+		);
+		INSERT INTO Photo_new(id, "user", url, date, archived, like_count, comment_count)
+		SELECT id, "user", url, COALESCE(CAST(strftime('%s', date) AS INTEGER), 0), archived, like_count, comment_count
+		FROM Photo;
+		DROP TABLE Photo;
+		ALTER TABLE Photo_new RENAME TO Photo;
+
+		CREATE TABLE Comment_new (
+			id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+			"user" INTEGER NOT NULL,
+			photo INTEGER NOT NULL,
+			date INTEGER NOT NULL,
+			comment_body TEXT NOT NULL,
+			FOREIGN KEY ("user") REFERENCES "User"(id) ON DELETE CASCADE,
+			FOREIGN KEY (photo) REFERENCES Photo(id) ON DELETE CASCADE
+		);
+		INSERT INTO Comment_new(id, "user", photo, date, comment_body)
+		SELECT id, "user", photo, COALESCE(CAST(strftime('%s', date) AS INTEGER), 0), comment_body
+		FROM Comment;
+		DROP TABLE Comment;
+		ALTER TABLE Comment_new RENAME TO Comment;
+
+		ALTER TABLE "User" ADD COLUMN deactivated_at_new INTEGER;
+		UPDATE "User"
+		SET deactivated_at_new=CAST(strftime('%s', deactivated_at) AS INTEGER);
+		ALTER TABLE "User" DROP COLUMN deactivated_at;
+		ALTER TABLE "User" RENAME COLUMN deactivated_at_new TO deactivated_at;
+	`
+
+	return []string{fixForeignKeys, addPhotoArchived, addUserDeactivatedAt, addPhotoCounters, convertDates, indexes, sqliteAuditTable, addUserVersion, addPhotoHash, sqliteHashtagTables, mentionTable, addLikeType, sqliteAlbumTables, addPhotoLocation, addPhotoPinnedAt, sqliteStoryTable, sqliteNotificationTable, sqliteDeviceTable, addNotificationPushed, addUserEmail, addLikeDate, sqliteSessionTable, sqliteRefreshTokenTable, sqliteIdentityTable, addEmailVerified, sqliteAPIKeyTable, sqliteUrlIndexes, muteTable, closeFriendsTable, addUserSuspendedAt, sqliteBlocklistTables, addPhotoFlagged, commentUserDateIndexes, addUserShadowBanned, addBanReasonExpiry, sqliteErasureTable, sqliteWebhookTables, sqliteIdempotencyKeyTable, addUserStreamSeenAt, settingsTables, notificationPreferenceTable, addUserProfile, addUserAvatar, usernameHistoryTable, addUsernameKey, sqliteReservedNameTable, addPhotoMedia, addPhotoScheduled, addPhotoOriginalUrl, addPhotoAltText, photoImportTable}
+}
+
+// sqliteAuditTable records the destructive operations, without foreign keys
+// since its entries must outlive the users and the photos they refer to
+const sqliteAuditTable = `
+	CREATE TABLE IF NOT EXISTS audit (
+		id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+		actor INTEGER NOT NULL,
+		action TEXT NOT NULL,
+		target INTEGER NOT NULL,
+		details TEXT NOT NULL,
+		date INTEGER NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS audit_actor_date_idx ON audit(actor, date);
+`
+
+// sqliteHashtagTables holds the hashtags and the photos tagged with them, each tag
+// coming from a comment under the photo and going away together with it
+const sqliteHashtagTables = `
+	CREATE TABLE IF NOT EXISTS hashtag (
+		id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL UNIQUE
+	);
+	CREATE TABLE IF NOT EXISTS photo_hashtag (
+		photo INTEGER NOT NULL,
+		hashtag INTEGER NOT NULL,
+		comment INTEGER NOT NULL,
+		PRIMARY KEY (comment, hashtag),
+		FOREIGN KEY (photo) REFERENCES Photo(id) ON DELETE CASCADE,
+		FOREIGN KEY (hashtag) REFERENCES hashtag(id) ON DELETE CASCADE,
+		FOREIGN KEY (comment) REFERENCES Comment(id) ON DELETE CASCADE
+	);
+	CREATE INDEX IF NOT EXISTS photo_hashtag_hashtag_idx ON photo_hashtag(hashtag, photo);
+`
+
+// sqliteAlbumTables holds the albums of the users and the photos they group, in
+// their order; a photo leaves its albums when it is deleted
+const sqliteAlbumTables = `
+	CREATE TABLE IF NOT EXISTS album (
+		id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+		"user" INTEGER NOT NULL,
+		name TEXT NOT NULL,
+		date INTEGER NOT NULL,
+		FOREIGN KEY ("user") REFERENCES "User"(id) ON DELETE CASCADE
+	);
+	CREATE INDEX IF NOT EXISTS album_user_date_idx ON album("user", date);
+	CREATE TABLE IF NOT EXISTS album_photo (
+		album INTEGER NOT NULL,
+		photo INTEGER NOT NULL,
+		position INTEGER NOT NULL,
+		PRIMARY KEY (album, photo),
+		FOREIGN KEY (album) REFERENCES album(id) ON DELETE CASCADE,
+		FOREIGN KEY (photo) REFERENCES Photo(id) ON DELETE CASCADE
+	);
+`
+
+// sqliteStoryTable holds the stories of the users, which are only shown
+// until they expire and are then removed by the cleanup job
+const sqliteStoryTable = `
+	CREATE TABLE IF NOT EXISTS story (
+		id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+		"user" INTEGER NOT NULL,
+		url TEXT NOT NULL,
+		date INTEGER NOT NULL,
+		expires_at INTEGER NOT NULL,
+		FOREIGN KEY ("user") REFERENCES "User"(id) ON DELETE CASCADE
+	);
+	CREATE INDEX IF NOT EXISTS story_user_expires_at_idx ON story("user", expires_at);
+`
+
+// sqliteNotificationTable holds the notifications of the users about the likes, the comments,
+// the mentions and the follows they received; a notification goes away together with what
+// it is about
+const sqliteNotificationTable = `
+	CREATE TABLE IF NOT EXISTS notification (
+		id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+		"user" INTEGER NOT NULL,
+		actor INTEGER NOT NULL,
+		type TEXT NOT NULL,
+		photo INTEGER,
+		comment INTEGER,
+		date INTEGER NOT NULL,
+		read BOOLEAN NOT NULL DEFAULT FALSE,
+		FOREIGN KEY ("user") REFERENCES "User"(id) ON DELETE CASCADE,
+		FOREIGN KEY (actor) REFERENCES "User"(id) ON DELETE CASCADE,
+		FOREIGN KEY (photo) REFERENCES Photo(id) ON DELETE CASCADE,
+		FOREIGN KEY (comment) REFERENCES Comment(id) ON DELETE CASCADE
+	);
+	CREATE INDEX IF NOT EXISTS notification_user_date_idx ON notification("user", date);
+`
+
+// sqliteDeviceTable holds the devices registered by the users to receive their notifications,
+// each one identified by the token given by the push service of its platform
+const sqliteDeviceTable = `
+	CREATE TABLE IF NOT EXISTS device (
+		id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+		"user" INTEGER NOT NULL,
+		platform TEXT NOT NULL,
+		token TEXT NOT NULL UNIQUE,
+		date INTEGER NOT NULL,
+		FOREIGN KEY ("user") REFERENCES "User"(id) ON DELETE CASCADE
+	);
+	CREATE INDEX IF NOT EXISTS device_user_idx ON device("user");
+`
+
+// sqliteSessionTable holds the sessions of the users, each one identified by the hash of its token,
+// so that the tokens can be revoked before they expire; the expired ones are looked up by user
+const sqliteSessionTable = `
+	CREATE TABLE IF NOT EXISTS session (
+		id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+		token_hash TEXT NOT NULL UNIQUE,
+		"user" INTEGER NOT NULL,
+		created_at INTEGER NOT NULL,
+		expires_at INTEGER NOT NULL,
+		last_seen INTEGER NOT NULL,
+		FOREIGN KEY ("user") REFERENCES "User"(id) ON DELETE CASCADE
+	);
+	CREATE INDEX IF NOT EXISTS session_user_expires_at_idx ON session("user", expires_at);
+`
+
+// sqliteRefreshTokenTable holds the refresh tokens of the sessions, each one identified by its hash; the
+// tokens which were exchanged are kept until they expire, so that their reuse can be detected
+const sqliteRefreshTokenTable = `
+	CREATE TABLE IF NOT EXISTS refresh_token (
+		id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+		session INTEGER NOT NULL,
+		token_hash TEXT NOT NULL UNIQUE,
+		created_at INTEGER NOT NULL,
+		expires_at INTEGER NOT NULL,
+		used BOOLEAN NOT NULL DEFAULT FALSE,
+		FOREIGN KEY (session) REFERENCES session(id) ON DELETE CASCADE
+	);
+	CREATE INDEX IF NOT EXISTS refresh_token_session_idx ON refresh_token(session);
+`
+
+// sqliteIdentityTable links the users signing in through an external provider to their
+// WASAPhoto user, each one identified by its subject within the provider
+const sqliteIdentityTable = `
+	CREATE TABLE IF NOT EXISTS identity (
+		provider TEXT NOT NULL,
+		subject TEXT NOT NULL,
+		"user" INTEGER NOT NULL,
+		date INTEGER NOT NULL,
+		PRIMARY KEY (provider, subject),
+		FOREIGN KEY ("user") REFERENCES "User"(id) ON DELETE CASCADE
+	);
+	CREATE INDEX IF NOT EXISTS identity_user_idx ON identity("user");
+`
+
+// sqliteAPIKeyTable holds the keys the users mint for their integrations, each one identified
+// by its hash, with what it may do and how many requests per minute it may send
+const sqliteAPIKeyTable = `
+	CREATE TABLE IF NOT EXISTS api_key (
+		id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+		"user" INTEGER NOT NULL,
+		name TEXT NOT NULL,
+		key_hash TEXT NOT NULL UNIQUE,
+		scope TEXT NOT NULL,
+		rate_limit INTEGER NOT NULL,
+		created_at INTEGER NOT NULL,
+		last_used_at INTEGER,
+		FOREIGN KEY ("user") REFERENCES "User"(id) ON DELETE CASCADE
+	);
+	CREATE INDEX IF NOT EXISTS api_key_user_idx ON api_key("user");
+`
+
+// sqliteUrlIndexes support the lookup of the photos and the stories served at a url, which
+// share their file when they have the same content
+const sqliteUrlIndexes = `
+	CREATE INDEX IF NOT EXISTS photo_url_idx ON Photo(url);
+	CREATE INDEX IF NOT EXISTS story_url_idx ON story(url);
+`
+
+// sqliteBlocklistTables hold the words and the patterns the administrators block in the comments,
+// besides the ones of the configuration, and the comments held back for matching them until
+// the administrators review them
+const sqliteBlocklistTables = `
+	CREATE TABLE IF NOT EXISTS blocked_term (
+		id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+		term TEXT NOT NULL,
+		pattern BOOLEAN NOT NULL,
+		UNIQUE (term, pattern)
+	);
+	CREATE TABLE IF NOT EXISTS held_comment (
+		id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+		"user" INTEGER NOT NULL,
+		photo INTEGER NOT NULL,
+		date INTEGER NOT NULL,
+		comment_body TEXT NOT NULL,
+		term TEXT NOT NULL,
+		FOREIGN KEY ("user") REFERENCES "User"(id) ON DELETE CASCADE,
+		FOREIGN KEY (photo) REFERENCES Photo(id) ON DELETE CASCADE
+	);
+`
+
+// sqliteReservedNameTable holds the usernames the administrators reserve, besides the ones of the configuration: a
+// name is either reserved as it is or blocked wherever it is contained in a username
+const sqliteReservedNameTable = `
+	CREATE TABLE IF NOT EXISTS reserved_name (
+		id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL,
+		contained BOOLEAN NOT NULL,
+		UNIQUE (name, contained)
+	);
+`
+
+// sqliteErasureTable records the erasures of the accounts requested by the users, without foreign keys since
+// its rows must outlive the users they erase; a user can have a single erasure pending at a time
+const sqliteErasureTable = `
+	CREATE TABLE IF NOT EXISTS erasure (
+		id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+		"user" INTEGER NOT NULL,
+		requested_at INTEGER NOT NULL,
+		completed_at INTEGER
+	);
+	CREATE UNIQUE INDEX IF NOT EXISTS erasure_pending_user_idx ON erasure("user") WHERE completed_at IS NULL;
+`
+
+// sqliteWebhookTables holds the webhooks registered by the administrators, the events each one is subscribed
+// to, and the deliveries of the events, which are kept after they end as the log of the webhook
+const sqliteWebhookTables = `
+	CREATE TABLE IF NOT EXISTS webhook (
+		id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+		url TEXT NOT NULL,
+		secret TEXT NOT NULL,
+		date INTEGER NOT NULL
+	);
+	CREATE TABLE IF NOT EXISTS webhook_event (
+		webhook INTEGER NOT NULL,
+		event TEXT NOT NULL,
+		PRIMARY KEY (webhook, event),
+		FOREIGN KEY (webhook) REFERENCES webhook(id) ON DELETE CASCADE
+	);
+	CREATE INDEX IF NOT EXISTS webhook_event_event_idx ON webhook_event(event);
+	CREATE TABLE IF NOT EXISTS webhook_delivery (
+		id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+		webhook INTEGER NOT NULL,
+		event TEXT NOT NULL,
+		payload TEXT NOT NULL,
+		date INTEGER NOT NULL,
+		attempts INTEGER NOT NULL DEFAULT 0,
+		next_attempt_at INTEGER,
+		delivered_at INTEGER,
+		status_code INTEGER NOT NULL DEFAULT 0,
+		error TEXT NOT NULL DEFAULT '',
+		FOREIGN KEY (webhook) REFERENCES webhook(id) ON DELETE CASCADE
+	);
+	CREATE INDEX IF NOT EXISTS webhook_delivery_due_idx ON webhook_delivery(next_attempt_at) WHERE next_attempt_at IS NOT NULL;
+	CREATE INDEX IF NOT EXISTS webhook_delivery_webhook_idx ON webhook_delivery(webhook, id);
+	CREATE INDEX IF NOT EXISTS webhook_delivery_date_idx ON webhook_delivery(date);
+`
+
+// sqliteIdempotencyKeyTable holds the idempotency keys sent by the users with their requests, together with the
+// response to replay on a retry; a key is still in progress while its status is 0
+const sqliteIdempotencyKeyTable = `
+	CREATE TABLE IF NOT EXISTS idempotency_key (
+		"user" INTEGER NOT NULL,
+		"key" TEXT NOT NULL,
+		fingerprint TEXT NOT NULL,
+		status INTEGER NOT NULL DEFAULT 0,
+		content_type TEXT NOT NULL DEFAULT '',
+		body BLOB,
+		date INTEGER NOT NULL,
+		PRIMARY KEY ("user", "key"),
+		FOREIGN KEY ("user") REFERENCES "User"(id) ON DELETE CASCADE
+	);
+	CREATE INDEX IF NOT EXISTS idempotency_key_date_idx ON idempotency_key(date);
+`
+
+func (sqliteDialect) tableExists() string {
+	return `
+		SELECT EXISTS(
+			SELECT 1
+			FROM sqlite_master
+			WHERE type='table'
+			AND name=?
+		)
+	`
+}
+
+func (sqliteDialect) withoutForeignKeys(conn *sql.Conn, fn func() error) error {
+	// the pragma is a no-op inside a transaction, hence it
+	// must be changed on the connection before fn starts one
+	_, err := conn.ExecContext(context.Background(), "PRAGMA foreign_keys=OFF")
+
+	if err != nil {
+		return err
+	}
+
+	err = fn()
+
+	_, _ = conn.ExecContext(context.Background(), "PRAGMA foreign_keys=ON")
+
+	return err
+}
+
+func (sqliteDialect) isUniqueViolation(err error) bool {
+	var sqliteErr sqlite3.Error
+
+	// a duplicate primary key is a unique violation as well, like in PostgreSQL
+	return errors.As(err, &sqliteErr) && (sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique || sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey)
+}
+
+func (sqliteDialect) isBusy(err error) bool {
+	var sqliteErr sqlite3.Error
+
+	// SQLITE_BUSY is also returned without waiting for the busy timeout when
+	// a transaction reading an old snapshot of the WAL tries to write
+	return errors.As(err, &sqliteErr) && (sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked)
+}
+
+func (sqliteDialect) setupSearch(db *sql.DB) (bool, error) {
+	// the fts5 module is only compiled in with the
+	// sqlite_fts5 build tag of go-sqlite3
+	var available bool
+
+	err := db.QueryRow(`
+		SELECT sqlite_compileoption_used('ENABLE_FTS5')
+	`).Scan(&available)
+
+	if err != nil {
+		return false, err
+	}
+
+	if !available {
+		// the triggers would make every change to the comments fail,
+		// hence they are dropped, and the index will be rebuilt once
+		// the module is available again
+		_, err = db.Exec(`
+			DROP TRIGGER IF EXISTS comment_fts_insert;
+			DROP TRIGGER IF EXISTS comment_fts_delete;
+			DROP TRIGGER IF EXISTS comment_fts_update;
+		`)
+
+		return false, err
+	}
+
+	// the triggers are missing if the index was never built,
+	// or if they were dropped together with the Comment table
+	// by a migration or by a build without the module
+	var synced bool
+
+	err = db.QueryRow(`
+		SELECT EXISTS(
+			SELECT 1
+			FROM sqlite_master
+			WHERE type='trigger'
+			AND name='comment_fts_insert'
+		)
+	`).Scan(&synced)
+
+	if err != nil || synced {
+		return err == nil, err
+	}
+
+	tx, err := db.Begin()
+
+	if err != nil {
+		return false, err
+	}
+
+	_, err = tx.Exec(`
+		CREATE VIRTUAL TABLE IF NOT EXISTS comment_fts USING fts5(
+			comment_body,
+			content='Comment',
+			content_rowid='id'
+		);
+		CREATE TRIGGER comment_fts_insert AFTER INSERT ON Comment BEGIN
+			INSERT INTO comment_fts(rowid, comment_body)
+			VALUES (new.id, new.comment_body);
+		END;
+		CREATE TRIGGER comment_fts_delete AFTER DELETE ON Comment BEGIN
+			INSERT INTO comment_fts(comment_fts, rowid, comment_body)
+			VALUES ('delete', old.id, old.comment_body);
+		END;
+		CREATE TRIGGER comment_fts_update AFTER UPDATE OF comment_body ON Comment BEGIN
+			INSERT INTO comment_fts(comment_fts, rowid, comment_body)
+			VALUES ('delete', old.id, old.comment_body);
+			INSERT INTO comment_fts(rowid, comment_body)
+			VALUES (new.id, new.comment_body);
+		END;
+		INSERT INTO comment_fts(comment_fts)
+		VALUES ('rebuild');
+	`)
+
+	if err != nil {
+		_ = tx.Rollback()
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+func (sqliteDialect) matchComment(fullText bool, text string) (string, []interface{}) {
+	if !fullText {
+		return matchWords("comment_body", text)
+	}
+
+	// every word is quoted, so that the text is never
+	// parsed as an fts5 query and all words must match
+	words := strings.Fields(text)
+
+	for i, word := range words {
+		words[i] = `"` + strings.ReplaceAll(word, `"`, `""`) + `"`
+	}
+
+	return `id IN (
+			SELECT rowid
+			FROM comment_fts
+			WHERE comment_fts MATCH ?
+		)`, []interface{}{strings.Join(words, " ")}
+}
+
+func (sqliteDialect) backup() string {
+	return `VACUUM INTO ?`
+}
+
+func (sqliteDialect) system() string {
+	return "sqlite"
+}
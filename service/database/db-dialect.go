@@ -0,0 +1,209 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/tracing"
+)
+
+// dialect hides the differences between the SQL engines supported by the
+// package. Queries are written once, using `?` placeholders and double quotes
+// around reserved identifiers, and the dialect adapts them to the engine
+type dialect interface {
+	// rebind rewrites the `?` placeholders of the query into the syntax
+	// expected by the engine
+	rebind(query string) string
+
+	// setup configures a freshly opened connection
+	setup(db *sql.DB) error
+
+	// schema returns the statements creating the latest database structure
+	schema() []string
+
+	// migrations returns the scripts upgrading the database structure, where
+	// the i-th script upgrades a database from version i to version i+1
+	migrations() []string
+
+	// tableExists returns a query reporting whether the table exists
+	tableExists() string
+
+	// withoutForeignKeys runs fn on the connection while foreign keys are
+	// not enforced, so that migrations can rebuild referenced tables
+	withoutForeignKeys(conn *sql.Conn, fn func() error) error
+
+	// isUniqueViolation reports whether the error was caused
+	// by a UNIQUE constraint failure
+	isUniqueViolation(err error) bool
+
+	// isBusy reports whether the error was caused by a transient
+	// lock contention, after which the write can be run again
+	isBusy(err error) bool
+
+	// setupSearch prepares the full text index of the comments, kept in
+	// sync by the engine, and reports whether the engine supports it
+	setupSearch(db *sql.DB) (bool, error)
+
+	// matchComment returns the condition selecting the comments whose body
+	// contains every word of the text, together with its arguments; the full
+	// text index is used only if fullText is true, otherwise the body is scanned
+	matchComment(fullText bool, text string) (string, []interface{})
+
+	// backup returns the statement copying a consistent snapshot of the
+	// database into the file given as its argument, or an empty string if
+	// the engine cannot do it
+	backup() string
+
+	// system returns the name of the engine, as it
+	// is reported in the spans of the queries
+	system() string
+}
+
+// matchWords returns the condition selecting the rows whose column contains
+// every word of the text, ignoring case, together with its arguments
+func matchWords(column string, text string) (string, []interface{}) {
+	words := strings.Fields(text)
+	conditions := make([]string, len(words))
+	args := make([]interface{}, len(words))
+
+	for i, word := range words {
+		conditions[i] = `LOWER(` + column + `) LIKE '%'||LOWER(CAST(? AS TEXT))||'%'`
+		args[i] = word
+	}
+
+	return `(` + strings.Join(conditions, " AND ") + `)`, args
+}
+
+// dbconn is a database connection which rewrites every query
+// through the dialect of the underlying engine and records its metrics
+type dbconn struct {
+	*sql.DB
+
+	d dialect
+	m *metrics
+}
+
+func (c *dbconn) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return exec(ctx, c.DB, c.d, c.m, query, args...)
+}
+
+func (c *dbconn) QueryContext(ctx context.Context, query string, args ...interface{}) (*dbrows, error) {
+	return queryRows(ctx, c.DB, c.d, c.m, query, args...)
+}
+
+func (c *dbconn) QueryRowContext(ctx context.Context, query string, args ...interface{}) *dbrow {
+	return queryRow(ctx, c.DB, c.d, c.m, query, args...)
+}
+
+func (c *dbconn) BeginTx(ctx context.Context, opts *sql.TxOptions) (*dbtx, error) {
+	tx, err := c.DB.BeginTx(ctx, opts)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &dbtx{Tx: tx, d: c.d, m: c.m}, nil
+}
+
+// dbtx is a transaction which rewrites every query
+// through the dialect of the underlying engine and records its metrics
+type dbtx struct {
+	*sql.Tx
+
+	d dialect
+	m *metrics
+}
+
+func (t *dbtx) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return exec(ctx, t.Tx, t.d, t.m, query, args...)
+}
+
+func (t *dbtx) QueryContext(ctx context.Context, query string, args ...interface{}) (*dbrows, error) {
+	return queryRows(ctx, t.Tx, t.d, t.m, query, args...)
+}
+
+func (t *dbtx) QueryRowContext(ctx context.Context, query string, args ...interface{}) *dbrow {
+	return queryRow(ctx, t.Tx, t.d, t.m, query, args...)
+}
+
+// querier is implemented by both *sql.DB and *sql.Tx
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// exec runs the statement on q, recording its metrics under the name of
+// the method which called dbconn or dbtx, two frames above this function
+func exec(ctx context.Context, q querier, d dialect, m *metrics, query string, args ...interface{}) (sql.Result, error) {
+	name := m.name(2)
+	start := time.Now()
+	span := startSpan(ctx, d, name, query)
+
+	res, err := q.ExecContext(ctx, d.rebind(query), args...)
+
+	var rows int64
+
+	if err == nil {
+		rows, _ = res.RowsAffected()
+	}
+
+	m.record(name, start, rows, err)
+	endSpan(span, rows, err)
+
+	return res, err
+}
+
+// queryRows runs the query on q, recording its metrics like exec
+// once the rows have been read
+func queryRows(ctx context.Context, q querier, d dialect, m *metrics, query string, args ...interface{}) (*dbrows, error) {
+	name := m.name(2)
+	start := time.Now()
+	span := startSpan(ctx, d, name, query)
+
+	rows, err := q.QueryContext(ctx, d.rebind(query), args...)
+
+	if err != nil {
+		m.record(name, start, 0, err)
+		endSpan(span, 0, err)
+		return nil, err
+	}
+
+	return &dbrows{Rows: rows, m: m, name: name, start: start, span: span}, nil
+}
+
+// queryRow runs the query on q, recording its metrics like exec
+// once the row has been scanned
+func queryRow(ctx context.Context, q querier, d dialect, m *metrics, query string, args ...interface{}) *dbrow {
+	name := m.name(2)
+	start := time.Now()
+	span := startSpan(ctx, d, name, query)
+
+	return &dbrow{Row: q.QueryRowContext(ctx, d.rebind(query), args...), m: m, name: name, start: start, span: span}
+}
+
+// startSpan starts the span of the query issued by the method `name`, within the trace of the request, if any
+func startSpan(ctx context.Context, d dialect, name string, query string) *tracing.Span {
+	_, span := tracing.Start(ctx, name, tracing.Client)
+
+	if span != nil {
+		span.SetAttribute("db.system", d.system())
+		span.SetAttribute("db.statement", strings.Join(strings.Fields(query), " "))
+	}
+
+	return span
+}
+
+// endSpan ends the span of a query which read or affected `rows` rows and ended with `err`
+func endSpan(span *tracing.Span, rows int64, err error) {
+	span.SetAttribute("db.rows", rows)
+	span.SetError(err)
+	span.End()
+}
+
+// placeholders returns `n` placeholders separated by commas, for the lists of values of the IN clauses
+func placeholders(n int) string {
+	return strings.TrimPrefix(strings.Repeat(",?", n), ",")
+}
@@ -0,0 +1,213 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+func (db *appdbimpl) GetDigestRecipients(ctx context.Context, sentBefore time.Time, after uint32, limit int) ([]DatabaseDigest, error) {
+	dbDigests := make([]DatabaseDigest, 0)
+
+	// get at most `limit` users with a verified email address
+	// whose last digest was sent before `sentBefore` (or never),
+	// with an id greater than `after`, leaving out the
+	// deactivated ones
+	rows, err := db.c.QueryContext(ctx, `
+		SELECT id, username, version, email, digest_sent_at
+		FROM "User"
+		WHERE email IS NOT NULL
+		AND email_verified
+		AND deactivated_at IS NULL
+		AND (digest_sent_at IS NULL OR digest_sent_at < ?)
+		AND id > ?
+		ORDER BY id
+		LIMIT ?
+	`, sentBefore.Unix(), after, limit)
+
+	if err != nil {
+		return dbDigests, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		dbDigest := DatabaseDigestDefault()
+
+		var sentAt sql.NullInt64
+
+		err = rows.Scan(&dbDigest.User.Id, &dbDigest.User.Username, &dbDigest.User.Version, &dbDigest.Email, &sentAt)
+
+		if err != nil {
+			return dbDigests, err
+		}
+
+		// the digest starts where the last one ended
+		if sentAt.Valid {
+			dbDigest.Since = time.Unix(sentAt.Int64, 0).UTC()
+		}
+
+		dbDigests = append(dbDigests, dbDigest)
+	}
+
+	return dbDigests, rows.Err()
+}
+
+func (db *appdbimpl) GetDigest(ctx context.Context, dbDigest *DatabaseDigest, limit int) error {
+	dbUser := dbDigest.User
+
+	// get at most `limit` users who followed the user since
+	// the start of the digest, from the latest, unless the
+	// user does not receive the follows by email; the follows
+	// are dated by their notifications, which go away when
+	// the user is unfollowed
+	rows, err := db.read().QueryContext(ctx, `
+		SELECT actor
+		FROM notification
+		WHERE `+visibleNotifications+`
+		AND `+notificationEnabled(ChannelEmail)+`
+		AND type=?
+		AND date >= ?
+		ORDER BY date DESC, id DESC
+		LIMIT ?
+	`, dbUser.Id, dbUser.Id, dbUser.Id, dbUser.Id, dbUser.Id, dbUser.Id, dbUser.Id, dbUser.Id, dbUser.Id, NotificationFollow, dbDigest.Since.Unix(), limit)
+
+	if err != nil {
+		return err
+	}
+
+	dbDigest.NewFollowers = make([]DatabaseUser, 0)
+
+	for rows.Next() {
+		follower := DatabaseUserDefault()
+
+		err = rows.Scan(&follower.Id)
+
+		if err != nil {
+			_ = rows.Close()
+			return err
+		}
+
+		dbDigest.NewFollowers = append(dbDigest.NewFollowers, follower)
+	}
+
+	_ = rows.Close()
+
+	if rows.Err() != nil {
+		return rows.Err()
+	}
+
+	for i := range dbDigest.NewFollowers {
+		dbDigest.NewFollowers[i], err = db.GetDatabaseUser(ctx, dbDigest.NewFollowers[i].Id)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	// count the other notifications the user received since
+	// the start of the digest, of the types they receive by
+	// email
+	rows, err = db.read().QueryContext(ctx, `
+		SELECT type, COUNT(*)
+		FROM notification
+		WHERE `+visibleNotifications+`
+		AND `+notificationEnabled(ChannelEmail)+`
+		AND type<>?
+		AND date >= ?
+		GROUP BY type
+	`, dbUser.Id, dbUser.Id, dbUser.Id, dbUser.Id, dbUser.Id, dbUser.Id, dbUser.Id, dbUser.Id, dbUser.Id, NotificationFollow, dbDigest.Since.Unix())
+
+	if err != nil {
+		return err
+	}
+
+	dbDigest.Activity = make(map[string]int)
+
+	for rows.Next() {
+		var notificationType string
+		var count int
+
+		err = rows.Scan(&notificationType, &count)
+
+		if err != nil {
+			_ = rows.Close()
+			return err
+		}
+
+		dbDigest.Activity[notificationType] = count
+	}
+
+	_ = rows.Close()
+
+	if rows.Err() != nil {
+		return rows.Err()
+	}
+
+	// get at most `limit` photos posted since the start of
+	// the digest by the users followed by the user, from the
+	// most liked, with the same rules as the stream
+	rows, err = db.read().QueryContext(ctx, `
+		SELECT id
+		FROM Photo
+		WHERE NOT archived
+		AND `+visiblePhoto+`
+		AND `+streamAuthor+`
+		AND date >= ?
+		AND like_count > 0
+		ORDER BY like_count DESC, date DESC, id DESC
+		LIMIT ?
+	`, dbUser.Id, dbUser.Id, dbUser.Id, dbUser.Id, dbUser.Id, dbUser.Id, dbDigest.Since.Unix(), limit)
+
+	if err != nil {
+		return err
+	}
+
+	var photoIds []uint32
+
+	for rows.Next() {
+		var photoId uint32
+
+		err = rows.Scan(&photoId)
+
+		if err != nil {
+			_ = rows.Close()
+			return err
+		}
+
+		photoIds = append(photoIds, photoId)
+	}
+
+	_ = rows.Close()
+
+	if rows.Err() != nil {
+		return rows.Err()
+	}
+
+	dbDigest.TopPhotos = make([]DatabasePhoto, 0)
+
+	for _, photoId := range photoIds {
+		dbPhoto, err := db.GetDatabasePhoto(ctx, photoId, dbUser)
+
+		if err != nil {
+			return err
+		}
+
+		dbDigest.TopPhotos = append(dbDigest.TopPhotos, dbPhoto)
+	}
+
+	return nil
+}
+
+func (db *appdbimpl) SetDigestSent(ctx context.Context, dbUser DatabaseUser, date time.Time) error {
+	// record when the last digest was sent to the user
+	return db.retry(ctx, func() error {
+		_, err := db.c.ExecContext(ctx, `
+			UPDATE "User"
+			SET digest_sent_at=?
+			WHERE id=?
+		`, date.Unix(), dbUser.Id)
+
+		return err
+	})
+}
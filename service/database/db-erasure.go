@@ -0,0 +1,254 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// DeletedUsername is the username of the account credited with the comments the erased users left under the photos
+// of the others. The account is created suspended by the first erasure, hence no one can log in as it
+const DeletedUsername = "deleted user"
+
+func (db *appdbimpl) RequestErasure(ctx context.Context, dbUser DatabaseUser, date time.Time) (DatabaseErasure, error) {
+	dbErasure := DatabaseErasureDefault()
+	dbErasure.User = dbUser.Id
+	dbErasure.RequestedAt = date.UTC().Truncate(time.Second)
+
+	defer db.users.remove(dbUser.Id)
+
+	// hide the user and sign them out right away, then
+	// record the erasure for the background job
+	err := db.withTx(ctx, func(tx *dbtx) error {
+		res, err := tx.ExecContext(ctx, `
+			UPDATE "User"
+			SET deactivated_at=COALESCE(deactivated_at, ?)
+			WHERE id=?
+		`, dbErasure.RequestedAt.Unix(), dbUser.Id)
+
+		if err != nil {
+			return err
+		}
+
+		aff, err := res.RowsAffected()
+
+		if err != nil {
+			return err
+		}
+
+		if aff == 0 {
+			return ErrUserDoesNotExist
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			DELETE FROM session
+			WHERE "user"=?
+		`, dbUser.Id)
+
+		if err != nil {
+			return err
+		}
+
+		// a user can have a single erasure pending,
+		// hence no row is returned for a second one
+		err = tx.QueryRowContext(ctx, `
+			INSERT INTO erasure("user", requested_at)
+			VALUES (?, ?)
+			ON CONFLICT DO NOTHING
+			RETURNING id
+		`, dbUser.Id, dbErasure.RequestedAt.Unix()).Scan(&dbErasure.Id)
+
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrErasurePending
+		}
+
+		return err
+	})
+
+	if err != nil {
+		return DatabaseErasureDefault(), err
+	}
+
+	return dbErasure, nil
+}
+
+func (db *appdbimpl) GetPendingErasures(ctx context.Context, limit int) ([]DatabaseErasure, error) {
+	dbErasures := make([]DatabaseErasure, 0)
+
+	// get at most `limit` erasures still to be
+	// performed, from the oldest request
+	rows, err := db.c.QueryContext(ctx, `
+		SELECT id, "user", requested_at
+		FROM erasure
+		WHERE completed_at IS NULL
+		ORDER BY id
+		LIMIT ?
+	`, limit)
+
+	if err != nil {
+		return dbErasures, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		dbErasure := DatabaseErasureDefault()
+
+		err = rows.Scan(&dbErasure.Id, &dbErasure.User, unixTime{&dbErasure.RequestedAt})
+
+		if err != nil {
+			return dbErasures, err
+		}
+
+		dbErasures = append(dbErasures, dbErasure)
+	}
+
+	return dbErasures, rows.Err()
+}
+
+func (db *appdbimpl) EraseUser(ctx context.Context, dbErasure DatabaseErasure, date time.Time) ([]string, error) {
+	var urls []string
+
+	defer db.users.remove(dbErasure.User)
+
+	err := db.withTx(ctx, func(tx *dbtx) (err error) {
+		// get the urls of the files of the user,
+		// which are removed once they are gone
+		urls, err = userFileUrlsTx(ctx, tx, dbErasure.User)
+
+		if err != nil {
+			return err
+		}
+
+		// the comments under the photos of the others are
+		// kept, credited to the deleted user instead
+		deletedId, ok, err := deletedUserTx(ctx, tx, db.usernameKey(DeletedUsername), date)
+
+		if err != nil {
+			return err
+		}
+
+		if ok {
+			_, err = tx.ExecContext(ctx, `
+				UPDATE Comment
+				SET "user"=?
+				WHERE "user"=?
+				AND photo NOT IN (
+					SELECT id
+					FROM Photo
+					WHERE "user"=?
+				)
+			`, deletedId, dbErasure.User, dbErasure.User)
+
+			if err != nil {
+				return err
+			}
+		}
+
+		// remove everything else, unless the user
+		// was already removed in another way
+		err = deleteUserTx(ctx, tx, dbErasure.User)
+
+		if err != nil && !errors.Is(err, ErrUserDoesNotExist) {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			UPDATE erasure
+			SET completed_at=?
+			WHERE id=?
+		`, date.Unix(), dbErasure.Id)
+
+		if err != nil {
+			return err
+		}
+
+		return insertAuditTx(ctx, tx, dbErasure.User, AuditEraseUser, dbErasure.User, "")
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return urls, nil
+}
+
+// deletedUserTx returns the id of the deleted user, whose username has the key `deletedKey`, inside the transaction
+// `tx`, creating it if needed, and whether there is one: if a user registered with DeletedUsername before the first
+// erasure, it is not suspended and the comments of the erased users are removed instead of being credited to them
+func deletedUserTx(ctx context.Context, tx *dbtx, deletedKey string, date time.Time) (uint32, bool, error) {
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO "User"(username, username_key, deactivated_at, suspended_at)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT DO NOTHING
+	`, DeletedUsername, deletedKey, date.Unix(), date.Unix())
+
+	if err != nil {
+		return 0, false, err
+	}
+
+	var deletedId uint32
+	var suspended bool
+
+	err = tx.QueryRowContext(ctx, `
+		SELECT id, suspended_at IS NOT NULL
+		FROM "User"
+		WHERE username_key=?
+	`, deletedKey).Scan(&deletedId, &suspended)
+
+	return deletedId, suspended, err
+}
+
+func (db *appdbimpl) GetErasures(ctx context.Context, limit int, after uint32) (DatabaseErasureList, error) {
+	dbErasureList := DatabaseErasureListDefault()
+
+	// get a page of at most `limit` erasures, from the
+	// oldest request, starting right after the erasure `after`
+	rows, err := db.c.QueryContext(ctx, `
+		SELECT id, "user", requested_at, completed_at
+		FROM erasure
+		WHERE id > ?
+		ORDER BY id
+		LIMIT ?
+	`, after, limit+1)
+
+	if err != nil {
+		return dbErasureList, err
+	}
+
+	defer rows.Close()
+
+	// build the list
+	for rows.Next() {
+		dbErasure := DatabaseErasureDefault()
+
+		var completedAt sql.NullInt64
+
+		err = rows.Scan(&dbErasure.Id, &dbErasure.User, unixTime{&dbErasure.RequestedAt}, &completedAt)
+
+		if err != nil {
+			return dbErasureList, err
+		}
+
+		if completedAt.Valid {
+			date := time.Unix(completedAt.Int64, 0).UTC()
+			dbErasure.CompletedAt = &date
+		}
+
+		dbErasureList.Erasures = append(dbErasureList.Erasures, dbErasure)
+	}
+
+	if rows.Err() != nil {
+		return dbErasureList, rows.Err()
+	}
+
+	// if there is a next page, its cursor
+	// is the last erasure of the current one
+	if len(dbErasureList.Erasures) > limit {
+		dbErasureList.Erasures = dbErasureList.Erasures[:limit]
+		dbErasureList.NextCursor = dbErasureList.Erasures[limit-1].Id
+	}
+
+	return dbErasureList, nil
+}
@@ -4,15 +4,33 @@ import "errors"
 
 // User
 var ErrUserDoesNotExist = errors.New("the requested user does not exist")
+var ErrUsernameAlreadyTaken = errors.New("the requested username is already taken by another user")
+var ErrConflict = errors.New("the requested user was modified by another request")
+var ErrEmailChanged = errors.New("the email address of the user was changed or the user does not exist")
+var ErrUserSuspended = errors.New("the user was suspended by the administrators")
+var ErrUserNotSuspended = errors.New("the user was not suspended")
+var ErrErasurePending = errors.New("the account of the user is being erased")
+var ErrUserNotShadowBanned = errors.New("the user was not shadow banned")
 
 // Follow
 var ErrUserNotFollowed = errors.New("the second user was not followed by the first user")
+var ErrFollowRequestDoesNotExist = errors.New("the first user did not request to follow the second user")
 
 // Ban
 var ErrUserNotBanned = errors.New("the second user was not banned by the first user")
 
+// Mute
+var ErrUserNotMuted = errors.New("the second user was not muted by the first user")
+
+// Close friend
+var ErrUserNotCloseFriend = errors.New("the second user is not a close friend of the first user")
+var ErrNotFollower = errors.New("the second user does not follow the first user")
+
 // Photo
 var ErrPhotoDoesNotExist = errors.New("the requested photo does not exist")
+var ErrTooManyPinnedPhotos = errors.New("the user has already pinned the maximum number of photos")
+var ErrPhotoNotFlagged = errors.New("the requested photo was not flagged as unsafe")
+var ErrPhotoAlreadyImported = errors.New("the photo was already imported from the export archive")
 
 // Like
 var ErrPhotoNotLiked = errors.New("the requested photo was not liked by the given user")
@@ -20,3 +38,44 @@ var ErrPhotoNotLiked = errors.New("the requested photo was not liked by the give
 // Comment
 var ErrCommentDoesNotExist = errors.New("the requested comment does not exist")
 var ErrPhotoNotCommented = errors.New("the requested photo was not commented by the given user")
+
+// Blocklist
+var ErrBlockedTermDoesNotExist = errors.New("the requested blocked term does not exist")
+var ErrBlockedTermAlreadyExists = errors.New("the term is already blocked")
+var ErrHeldCommentDoesNotExist = errors.New("the requested held comment does not exist")
+
+// Reserved names
+var ErrReservedNameDoesNotExist = errors.New("the requested reserved name does not exist")
+var ErrReservedNameAlreadyExists = errors.New("the name is already reserved")
+
+// Album
+var ErrAlbumDoesNotExist = errors.New("the requested album does not exist")
+
+// Story
+var ErrStoryDoesNotExist = errors.New("the requested story does not exist")
+
+// Device
+var ErrDeviceDoesNotExist = errors.New("the requested device does not exist")
+
+// Session
+var ErrSessionDoesNotExist = errors.New("the requested session does not exist")
+var ErrRefreshTokenDoesNotExist = errors.New("the requested refresh token does not exist")
+var ErrRefreshTokenReused = errors.New("the refresh token was already exchanged")
+
+// Identity
+var ErrIdentityDoesNotExist = errors.New("the requested identity is not linked to any user")
+var ErrIdentityAlreadyLinked = errors.New("the identity is already linked to another user")
+
+// API key
+var ErrAPIKeyDoesNotExist = errors.New("the requested API key does not exist")
+var ErrTooManyAPIKeys = errors.New("the user has already minted the maximum number of API keys")
+
+// Webhook
+var ErrWebhookDoesNotExist = errors.New("the requested webhook does not exist")
+
+// Idempotency key
+var ErrIdempotencyKeyDoesNotExist = errors.New("the requested idempotency key does not exist")
+var ErrIdempotencyKeyInUse = errors.New("the idempotency key was already used")
+
+// Backup
+var ErrBackupUnsupported = errors.New("the database engine does not support backups")
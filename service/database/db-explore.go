@@ -0,0 +1,119 @@
+package database
+
+import (
+	"context"
+	"time"
+)
+
+// recentActivity lists the photo of each reaction and comment since a date, once per reaction or comment, so that the
+// photos can be ranked by their recent activity. It takes the date twice.
+const recentActivity = `
+	SELECT photo
+	FROM "like"
+	WHERE date >= ?
+	UNION ALL
+	SELECT photo
+	FROM Comment
+	WHERE date >= ?
+`
+
+func (db *appdbimpl) GetExplorePhotos(ctx context.Context, dbUser DatabaseUser, since time.Time, limit int, offset int) (DatabaseExploreFeed, error) {
+	dbFeed := DatabaseExploreFeedDefault()
+
+	// get a page of at most `limit` photos of the users not
+	// followed by the user performing the action, skipping the
+	// first `offset` ones, ranked by the number of reactions
+	// and comments they received since `since`; the photos of
+	// the user, of deactivated, shadow banned or private
+	// users and of users banned by or banning the user are
+	// not considered, and neither are the photos without
+	// any recent activity; one more photo is requested to
+	// know whether there is a next page
+	rows, err := db.read().QueryContext(ctx, `
+		SELECT Photo.id
+		FROM (`+recentActivity+`) activity
+		JOIN Photo ON Photo.id=activity.photo
+		WHERE NOT Photo.archived
+		AND NOT Photo.close_friends
+		AND NOT Photo.flagged
+		AND NOT Photo.scheduled
+		AND Photo."user"<>?
+		AND Photo."user" NOT IN (
+			SELECT second_user
+			FROM follow
+			WHERE first_user=?
+		)
+		AND Photo."user" NOT IN (
+			SELECT first_user
+			FROM ban
+			WHERE second_user=?
+		)
+		AND Photo."user" NOT IN (
+			SELECT second_user
+			FROM ban
+			WHERE first_user=?
+		)
+		AND Photo."user" NOT IN (
+			SELECT id
+			FROM "User"
+			WHERE deactivated_at IS NOT NULL
+			OR shadow_banned
+		)
+		AND Photo."user" NOT IN (
+			SELECT "user"
+			FROM settings
+			WHERE private
+		)
+		GROUP BY Photo.id, Photo.date
+		ORDER BY COUNT(*) DESC, Photo.date DESC, Photo.id DESC
+		LIMIT ?
+		OFFSET ?
+	`, since.Unix(), since.Unix(), dbUser.Id, dbUser.Id, dbUser.Id, dbUser.Id, limit+1, offset)
+
+	if err != nil {
+		return dbFeed, err
+	}
+
+	defer rows.Close()
+
+	// the ids are read before the photos are
+	// loaded, which takes other connections
+	photoIds := make([]uint32, 0)
+
+	for rows.Next() {
+		var photoId uint32
+
+		err = rows.Scan(&photoId)
+
+		if err != nil {
+			return dbFeed, err
+		}
+
+		photoIds = append(photoIds, photoId)
+	}
+
+	if rows.Err() != nil {
+		return dbFeed, rows.Err()
+	}
+
+	_ = rows.Close()
+
+	// if there is a next page, it starts
+	// right after the current one
+	if len(photoIds) > limit {
+		photoIds = photoIds[:limit]
+		dbFeed.NextOffset = offset + limit
+	}
+
+	for _, photoId := range photoIds {
+		dbPhoto, err := db.GetDatabasePhoto(ctx, photoId, dbUser)
+
+		if err != nil {
+			return dbFeed, err
+		}
+
+		dbFeed.Photos = append(dbFeed.Photos, dbPhoto)
+	}
+
+	return dbFeed, nil
+}
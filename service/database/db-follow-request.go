@@ -0,0 +1,157 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+func (db *appdbimpl) InsertFollowRequest(ctx context.Context, dbUser DatabaseUser, followedDbUser DatabaseUser, date time.Time) error {
+	// record the request to follow the user, keeping
+	// the date of the first one if it is sent again
+	return db.retry(ctx, func() error {
+		_, err := db.c.ExecContext(ctx, `
+			INSERT INTO follow_request(first_user, second_user, date)
+			VALUES (?, ?, ?)
+			ON CONFLICT DO NOTHING
+		`, dbUser.Id, followedDbUser.Id, date.Unix())
+
+		return err
+	})
+}
+
+func (db *appdbimpl) DeleteFollowRequest(ctx context.Context, dbUser DatabaseUser, followedDbUser DatabaseUser) error {
+	var res sql.Result
+
+	// remove the request to follow the user, withdrawn by
+	// the user who sent it or refused by the one receiving it
+	err := db.retry(ctx, func() (err error) {
+		res, err = db.c.ExecContext(ctx, `
+			DELETE FROM follow_request
+			WHERE first_user=?
+			AND second_user=?
+		`, dbUser.Id, followedDbUser.Id)
+
+		return err
+	})
+
+	if err != nil {
+		return err
+	}
+
+	aff, err := res.RowsAffected()
+
+	if err != nil {
+		return err
+	}
+
+	// if there are no affected rows
+	// then the request was not sent
+	if aff == 0 {
+		return ErrFollowRequestDoesNotExist
+	}
+
+	return nil
+}
+
+func (db *appdbimpl) ApproveFollowRequest(ctx context.Context, dbUser DatabaseUser, requesterDbUser DatabaseUser) error {
+	err := db.withTx(ctx, func(tx *dbtx) error {
+		// the request must still be pending
+		var requested bool
+
+		err := tx.QueryRowContext(ctx, `
+			SELECT EXISTS(
+				SELECT 1
+				FROM follow_request
+				WHERE first_user=?
+				AND second_user=?
+			)
+		`, requesterDbUser.Id, dbUser.Id).Scan(&requested)
+
+		if err != nil {
+			return err
+		}
+
+		if !requested {
+			return ErrFollowRequestDoesNotExist
+		}
+
+		// the requester follows the user from now on
+		return insertFollowTx(ctx, tx, requesterDbUser, dbUser)
+	})
+
+	if err != nil {
+		return err
+	}
+
+	db.invalidate(ctx, followersGroup(dbUser.Id), followingGroup(requesterDbUser.Id), photosGroup(dbUser.Id))
+
+	return nil
+}
+
+func (db *appdbimpl) GetFollowRequests(ctx context.Context, dbUser DatabaseUser) (DatabaseUserList, error) {
+	dbUserList := DatabaseUserListDefault()
+
+	// get the users who requested to follow the user, from the
+	// oldest request, without the users they banned and the
+	// deactivated ones
+	rows, err := db.read().QueryContext(ctx, `
+		SELECT "User".id, "User".username, "User".avatar
+		FROM follow_request
+		JOIN "User" ON "User".id=follow_request.first_user
+		WHERE follow_request.second_user=?
+		AND "User".id NOT IN (
+			SELECT second_user
+			FROM ban
+			WHERE first_user=?
+		)
+		AND "User".deactivated_at IS NULL
+		ORDER BY follow_request.date, "User".id
+	`, dbUser.Id, dbUser.Id)
+
+	if err != nil {
+		return dbUserList, err
+	}
+
+	// build the list of the requesters
+	for rows.Next() {
+		requesterDbUser := DatabaseUserDefault()
+
+		err = rows.Scan(&requesterDbUser.Id, &requesterDbUser.Username, &requesterDbUser.Avatar)
+
+		if err != nil {
+			return dbUserList, err
+		}
+
+		dbUserList.Users = append(dbUserList.Users, requesterDbUser)
+	}
+
+	if rows.Err() != nil {
+		return dbUserList, err
+	}
+
+	_ = rows.Close()
+
+	return dbUserList, err
+}
+
+func (db *appdbimpl) CheckFollowRequest(ctx context.Context, dbUser DatabaseUser, followedDbUser DatabaseUser) (bool, error) {
+	requested := false
+
+	// check whether the first user requested to follow the second user
+	err := db.c.QueryRowContext(ctx, `
+		SELECT EXISTS(
+			SELECT 1
+			FROM follow_request
+			WHERE first_user=?
+			AND second_user=?
+		)
+	`, dbUser.Id, followedDbUser.Id).Scan(&requested)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+
+	return requested, err
+}
@@ -1,24 +1,31 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 )
 
-func (db *appdbimpl) InsertFollow(dbUser DatabaseUser, followedDbUser DatabaseUser) error {
-	// insert the following into the database
-	_, err := db.c.Exec(`
-		INSERT OR IGNORE INTO follow(first_user, second_user)
-		VALUES (?, ?)
-	`, dbUser.Id, followedDbUser.Id)
+func (db *appdbimpl) InsertFollow(ctx context.Context, dbUser DatabaseUser, followedDbUser DatabaseUser) error {
+	err := db.withTx(ctx, func(tx *dbtx) error {
+		return insertFollowTx(ctx, tx, dbUser, followedDbUser)
+	})
 
-	return err
+	if err != nil {
+		return err
+	}
+
+	// the follower may now see the photos of a private account
+	db.invalidate(ctx, followersGroup(followedDbUser.Id), followingGroup(dbUser.Id), photosGroup(followedDbUser.Id))
+
+	return nil
 }
 
-func (db *appdbimpl) DeleteFollow(dbUser DatabaseUser, followedDbUser DatabaseUser) error {
-	// remove the following from the database
-	res, err := db.c.Exec(`
-		DELETE FROM follow
+// insertFollowTx inserts the following inside the transaction `tx`, notifying the followed user the first time and
+// removing the request to follow them, if any
+func insertFollowTx(ctx context.Context, tx *dbtx, dbUser DatabaseUser, followedDbUser DatabaseUser) error {
+	_, err := tx.ExecContext(ctx, `
+		DELETE FROM follow_request
 		WHERE first_user=?
 		AND second_user=?
 	`, dbUser.Id, followedDbUser.Id)
@@ -27,89 +34,174 @@ func (db *appdbimpl) DeleteFollow(dbUser DatabaseUser, followedDbUser DatabaseUs
 		return err
 	}
 
-	aff, err := res.RowsAffected()
+	// insert the following into the database
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO follow(first_user, second_user)
+		VALUES (?, ?)
+		ON CONFLICT DO NOTHING
+	`, dbUser.Id, followedDbUser.Id)
 
 	if err != nil {
 		return err
 	}
 
-	// if there are no affected rows
-	// then the user was not followed
-	if aff == 0 {
-		return ErrUserNotFollowed
+	aff, err := res.RowsAffected()
+
+	// if there are no affected rows then the user
+	// was already followed and already notified
+	if err != nil || aff == 0 {
+		return err
 	}
 
-	return nil
+	return insertFollowNotificationTx(ctx, tx, dbUser, followedDbUser)
 }
 
-func (db *appdbimpl) GetFollowersCount(profileDbUser DatabaseUser, dbUser DatabaseUser) (int, error) {
-	var followersCount int
+func (db *appdbimpl) DeleteFollow(ctx context.Context, dbUser DatabaseUser, followedDbUser DatabaseUser) error {
+	err := db.withTx(ctx, func(tx *dbtx) error {
+		// remove the following from the database
+		res, err := tx.ExecContext(ctx, `
+			DELETE FROM follow
+			WHERE first_user=?
+			AND second_user=?
+		`, dbUser.Id, followedDbUser.Id)
 
-	// get the number of user following
-	// the user performing the action
-	err := db.c.QueryRow(`
-		SELECT COUNT(*)
-		FROM follow
-		WHERE second_user=?
-		AND first_user NOT IN (
-			SELECT first_user
-			FROM ban
-			WHERE second_user=?
-		)
-	`, profileDbUser.Id, dbUser.Id).Scan(&followersCount)
+		if err != nil {
+			return err
+		}
 
-	if errors.Is(err, sql.ErrNoRows) {
-		return followersCount, ErrUserDoesNotExist
+		aff, err := res.RowsAffected()
+
+		if err != nil {
+			return err
+		}
+
+		// if there are no affected rows
+		// then the user was not followed
+		if aff == 0 {
+			return ErrUserNotFollowed
+		}
+
+		// the user is no longer notified of the following
+		err = deleteNotificationTx(ctx, tx, dbUser.Id, NotificationFollow, followedDbUser.Id, 0)
+
+		if err != nil {
+			return err
+		}
+
+		// only followers can be close friends
+		_, err = tx.ExecContext(ctx, `
+			DELETE FROM close_friend
+			WHERE first_user=?
+			AND second_user=?
+		`, followedDbUser.Id, dbUser.Id)
+
+		if err != nil {
+			return err
+		}
+
+		return insertAuditTx(ctx, tx, dbUser.Id, AuditUnfollow, followedDbUser.Id, followedDbUser.Username)
+	})
+
+	if err != nil {
+		return err
 	}
 
-	return followersCount, err
-}
+	db.invalidate(ctx, followersGroup(followedDbUser.Id), followingGroup(dbUser.Id), photosGroup(followedDbUser.Id))
 
-func (db *appdbimpl) GetFollowingCount(profileDbUser DatabaseUser, dbUser DatabaseUser) (int, error) {
-	var followingCount int
+	return nil
+}
 
-	var err error
+func (db *appdbimpl) GetFollowersCount(ctx context.Context, profileDbUser DatabaseUser, dbUser DatabaseUser) (int, error) {
+	var followersCount int
 
-	// check whether the user performing the action
-	// is the same user of whom the following list is requested
-	if profileDbUser.Id != dbUser.Id {
-		// get the number of users followed by
+	err := db.cached(ctx, followersGroup(profileDbUser.Id), viewerKey(dbUser), db.ttl.Profile, &followersCount, func() error {
+		// get the number of user following
 		// the user performing the action
-		err = db.c.QueryRow(`
+		err := db.read().QueryRowContext(ctx, `
 			SELECT COUNT(*)
 			FROM follow
-			WHERE first_user=?
-			AND second_user NOT IN (
+			WHERE second_user=?
+			AND first_user NOT IN (
 				SELECT first_user
 				FROM ban
 				WHERE second_user=?
 			)
-		`, profileDbUser.Id, dbUser.Id).Scan(&followingCount)
-	} else {
-		// get the number of users followed by
-		// the user performing the action
-		err = db.c.QueryRow(`
-			SELECT COUNT(*)
-			FROM follow
-			WHERE first_user=?
-		`, profileDbUser.Id, dbUser.Id).Scan(&followingCount)
-	}
+			AND first_user NOT IN (
+				SELECT id
+				FROM "User"
+				WHERE deactivated_at IS NOT NULL
+			)
+		`, profileDbUser.Id, dbUser.Id).Scan(&followersCount)
 
-	if errors.Is(err, sql.ErrNoRows) {
-		return followingCount, ErrUserDoesNotExist
-	}
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrUserDoesNotExist
+		}
+
+		return err
+	})
+
+	return followersCount, err
+}
+
+func (db *appdbimpl) GetFollowingCount(ctx context.Context, profileDbUser DatabaseUser, dbUser DatabaseUser) (int, error) {
+	var followingCount int
+
+	err := db.cached(ctx, followingGroup(profileDbUser.Id), viewerKey(dbUser), db.ttl.Profile, &followingCount, func() error {
+		var err error
+
+		// check whether the user performing the action
+		// is the same user of whom the following list is requested
+		if profileDbUser.Id != dbUser.Id {
+			// get the number of users followed by
+			// the user performing the action
+			err = db.read().QueryRowContext(ctx, `
+				SELECT COUNT(*)
+				FROM follow
+				WHERE first_user=?
+				AND second_user NOT IN (
+					SELECT first_user
+					FROM ban
+					WHERE second_user=?
+				)
+				AND second_user NOT IN (
+					SELECT id
+					FROM "User"
+					WHERE deactivated_at IS NOT NULL
+				)
+			`, profileDbUser.Id, dbUser.Id).Scan(&followingCount)
+		} else {
+			// get the number of users followed by
+			// the user performing the action
+			err = db.read().QueryRowContext(ctx, `
+				SELECT COUNT(*)
+				FROM follow
+				WHERE first_user=?
+				AND second_user NOT IN (
+					SELECT id
+					FROM "User"
+					WHERE deactivated_at IS NOT NULL
+				)
+			`, profileDbUser.Id).Scan(&followingCount)
+		}
+
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrUserDoesNotExist
+		}
+
+		return err
+	})
 
 	return followingCount, err
 }
 
-func (db *appdbimpl) GetFollowersList(followersDbUser DatabaseUser, dbUser DatabaseUser) (DatabaseUserList, error) {
+func (db *appdbimpl) GetFollowersList(ctx context.Context, followersDbUser DatabaseUser, dbUser DatabaseUser) (DatabaseUserList, error) {
 	dbUserList := DatabaseUserListDefault()
 
 	// get the table of the followers
 	// without the users who banned the user performing the action
-	rows, err := db.c.Query(`
-		SELECT id, username
-		FROM User
+	rows, err := db.read().QueryContext(ctx, `
+		SELECT id, username, avatar
+		FROM "User"
 		WHERE id IN (
 			SELECT first_user
 			FROM follow
@@ -120,6 +212,7 @@ func (db *appdbimpl) GetFollowersList(followersDbUser DatabaseUser, dbUser Datab
 			FROM ban
 			WHERE second_user=?
 		)
+		AND deactivated_at IS NULL
 	`, followersDbUser.Id, dbUser.Id)
 
 	if errors.Is(err, sql.ErrNoRows) {
@@ -134,7 +227,7 @@ func (db *appdbimpl) GetFollowersList(followersDbUser DatabaseUser, dbUser Datab
 	for rows.Next() {
 		tableDbUser := DatabaseUserDefault()
 
-		err = rows.Scan(&tableDbUser.Id, &tableDbUser.Username)
+		err = rows.Scan(&tableDbUser.Id, &tableDbUser.Username, &tableDbUser.Avatar)
 
 		if err != nil {
 			return dbUserList, err
@@ -152,10 +245,10 @@ func (db *appdbimpl) GetFollowersList(followersDbUser DatabaseUser, dbUser Datab
 	return dbUserList, err
 }
 
-func (db *appdbimpl) GetFollowingList(followingDbUser DatabaseUser, dbUser DatabaseUser) (DatabaseUserList, error) {
+func (db *appdbimpl) GetFollowingList(ctx context.Context, followingDbUser DatabaseUser, dbUser DatabaseUser) (DatabaseUserList, error) {
 	dbUserList := DatabaseUserListDefault()
 
-	var rows *sql.Rows
+	var rows *dbrows
 	var err error
 
 	// check whether the user performing the action
@@ -163,9 +256,9 @@ func (db *appdbimpl) GetFollowingList(followingDbUser DatabaseUser, dbUser Datab
 	if followingDbUser.Id != dbUser.Id {
 		// get the table of the followed
 		// without the users who banned the user performing the action
-		rows, err = db.c.Query(`
-			SELECT id, username
-			FROM User
+		rows, err = db.read().QueryContext(ctx, `
+			SELECT id, username, avatar
+			FROM "User"
 			WHERE id IN (
 				SELECT second_user
 				FROM follow
@@ -176,16 +269,18 @@ func (db *appdbimpl) GetFollowingList(followingDbUser DatabaseUser, dbUser Datab
 				FROM ban
 				WHERE second_user=?
 			)
+			AND deactivated_at IS NULL
 		`, followingDbUser.Id, dbUser.Id)
 	} else {
-		rows, err = db.c.Query(`
-			SELECT id, username
-			FROM User
+		rows, err = db.read().QueryContext(ctx, `
+			SELECT id, username, avatar
+			FROM "User"
 			WHERE id IN (
 				SELECT second_user
 				FROM follow
 				WHERE first_user=?
 			)
+			AND deactivated_at IS NULL
 		`, followingDbUser.Id)
 	}
 
@@ -201,7 +296,7 @@ func (db *appdbimpl) GetFollowingList(followingDbUser DatabaseUser, dbUser Datab
 	for rows.Next() {
 		tableDbUser := DatabaseUserDefault()
 
-		err = rows.Scan(&tableDbUser.Id, &tableDbUser.Username)
+		err = rows.Scan(&tableDbUser.Id, &tableDbUser.Username, &tableDbUser.Avatar)
 
 		if err != nil {
 			return dbUserList, err
@@ -219,11 +314,11 @@ func (db *appdbimpl) GetFollowingList(followingDbUser DatabaseUser, dbUser Datab
 	return dbUserList, err
 }
 
-func (db *appdbimpl) GetFollowStatus(firstDbUser DatabaseUser, secondDbUser DatabaseUser) (bool, error) {
+func (db *appdbimpl) GetFollowStatus(ctx context.Context, firstDbUser DatabaseUser, secondDbUser DatabaseUser) (bool, error) {
 	followStatus := false
 
 	// check whether the first user follows the second user
-	err := db.c.QueryRow(`
+	err := db.c.QueryRowContext(ctx, `
 		SELECT EXISTS(
 			SELECT 1
 			FROM follow
@@ -0,0 +1,310 @@
+package database
+
+import (
+	"context"
+	"regexp"
+	"strings"
+)
+
+// MaxHashtagLength is the maximum number of characters of a hashtag, the longer ones are not tagged
+const MaxHashtagLength = 100
+
+// hashtagPattern matches a # followed by letters, digits and underscores, as long
+// as it does not continue a word (eg. the fragment of a url or an html entity)
+var hashtagPattern = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_&#/])#([\p{L}\p{N}_]+)`)
+
+// validHashtag matches a whole hashtag, without the leading #
+var validHashtag = regexp.MustCompile(`^[\p{L}\p{N}_]+$`)
+
+// ParseHashtags returns the distinct hashtags of the text, without the leading # and lowercased, in the order they
+// first appear.
+func ParseHashtags(text string) []string {
+	hashtags := make([]string, 0)
+	seen := make(map[string]bool)
+
+	for _, match := range hashtagPattern.FindAllStringSubmatch(text, -1) {
+		hashtag, ok := NormalizeHashtag(match[1])
+
+		if ok && !seen[hashtag] {
+			seen[hashtag] = true
+			hashtags = append(hashtags, hashtag)
+		}
+	}
+
+	return hashtags
+}
+
+// NormalizeHashtag returns the hashtag as it is stored, lowercased and without the leading # (if any), and whether it is
+// a valid hashtag.
+func NormalizeHashtag(hashtag string) (string, bool) {
+	hashtag = strings.ToLower(strings.TrimPrefix(hashtag, "#"))
+
+	if !validHashtag.MatchString(hashtag) || len([]rune(hashtag)) > MaxHashtagLength {
+		return "", false
+	}
+
+	return hashtag, true
+}
+
+// insertHashtagsTx tags the photo of the comment with the hashtags of its body within the given transaction
+func insertHashtagsTx(ctx context.Context, tx *dbtx, commentId uint32, photoId uint32, body string) error {
+	for _, hashtag := range ParseHashtags(body) {
+		// create the hashtag the first time it is used
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO hashtag(name)
+			VALUES (?)
+			ON CONFLICT (name) DO NOTHING
+		`, hashtag)
+
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO photo_hashtag(photo, hashtag, comment)
+			SELECT ?, id, ?
+			FROM hashtag
+			WHERE name=?
+		`, photoId, commentId, hashtag)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (db *appdbimpl) GetHashtagPhotos(ctx context.Context, dbUser DatabaseUser, hashtag string, limit int, before uint32) (DatabaseHashtagFeed, error) {
+	dbFeed := DatabaseHashtagFeedDefault()
+	dbFeed.Hashtag = hashtag
+
+	// get a page of at most `limit` photos tagged with the
+	// hashtag, from the newest to the oldest, keeping only the
+	// photos older than the photo `before` (if it is not 0);
+	// the photos of users who banned the user performing the
+	// action or who are deactivated or shadow banned are not
+	// considered, and neither are the hashtags written by
+	// users who banned the user or who are shadow banned; one
+	// more photo is requested to know whether there is a next
+	// page
+	rows, err := db.read().QueryContext(ctx, `
+		SELECT id
+		FROM Photo
+		WHERE NOT archived
+		AND NOT close_friends
+		AND NOT flagged
+		AND NOT scheduled
+		AND id IN (
+			SELECT photo_hashtag.photo
+			FROM photo_hashtag
+			JOIN hashtag ON hashtag.id=photo_hashtag.hashtag
+			JOIN Comment ON Comment.id=photo_hashtag.comment
+			WHERE hashtag.name=?
+			AND Comment."user" NOT IN (
+				SELECT first_user
+				FROM ban
+				WHERE second_user=?
+			)
+			AND `+visibleComment+`
+		)
+		AND "user" NOT IN (
+			SELECT first_user
+			FROM ban
+			WHERE second_user=?
+		)
+		AND "user" NOT IN (
+			SELECT id
+			FROM "User"
+			WHERE deactivated_at IS NOT NULL
+		)
+		AND `+visiblePhotoOwner+`
+		AND (
+			?=0
+			OR (date, id) < (
+				SELECT date, id
+				FROM Photo
+				WHERE id=?
+			)
+		)
+		ORDER BY date DESC, id DESC
+		LIMIT ?
+	`, hashtag, dbUser.Id, dbUser.Id, dbUser.Id, dbUser.Id, before, before, limit+1)
+
+	if err != nil {
+		return dbFeed, err
+	}
+
+	// build the feed
+	for rows.Next() {
+		dbPhoto := DatabasePhotoDefault()
+
+		err = rows.Scan(&dbPhoto.Id)
+
+		if err != nil {
+			return dbFeed, err
+		}
+
+		dbPhoto, err = db.GetDatabasePhoto(ctx, dbPhoto.Id, dbUser)
+
+		if err != nil {
+			return dbFeed, err
+		}
+
+		dbFeed.Photos = append(dbFeed.Photos, dbPhoto)
+	}
+
+	if rows.Err() != nil {
+		return dbFeed, err
+	}
+
+	_ = rows.Close()
+
+	// if there is a next page, its cursor
+	// is the last photo of the current one
+	if len(dbFeed.Photos) > limit {
+		dbFeed.Photos = dbFeed.Photos[:limit]
+		dbFeed.NextCursor = dbFeed.Photos[limit-1].Id
+	}
+
+	return dbFeed, err
+}
+
+func (db *appdbimpl) SearchHashtags(ctx context.Context, dbUser DatabaseUser, query string, limit int) ([]DatabaseHashtagCount, error) {
+	dbHashtags := make([]DatabaseHashtagCount, 0)
+
+	// a query which cannot be part of a hashtag matches nothing
+	query, ok := NormalizeHashtag(query)
+
+	if !ok {
+		return dbHashtags, nil
+	}
+
+	// the underscores of the query must be matched literally
+	pattern := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(query)
+
+	// get at most `limit` hashtags containing the query, ranking
+	// the exact match first, then the hashtags starting with the
+	// query and then the others, each by the number of comments
+	// they were written in; the comments are counted with the
+	// same rules as the hashtag feed, and the hashtags without
+	// any of them are left out
+	rows, err := db.read().QueryContext(ctx, `
+		WITH result AS (
+			SELECT hashtag.name AS name, COUNT(*) AS uses,
+				CASE
+					WHEN hashtag.name=CAST(? AS TEXT) THEN 0
+					WHEN hashtag.name LIKE CAST(? AS TEXT)||'%' ESCAPE '\' THEN 1
+					ELSE 2
+				END AS position
+			FROM hashtag
+			JOIN photo_hashtag ON photo_hashtag.hashtag=hashtag.id
+			JOIN Comment ON Comment.id=photo_hashtag.comment
+			JOIN Photo ON Photo.id=photo_hashtag.photo
+			WHERE hashtag.name LIKE '%'||CAST(? AS TEXT)||'%' ESCAPE '\'
+			AND Comment."user" NOT IN (
+				SELECT first_user
+				FROM ban
+				WHERE second_user=?
+			)
+			AND `+visibleComment+`
+			AND NOT Photo.archived
+			AND NOT Photo.close_friends
+			AND NOT Photo.flagged
+			AND NOT Photo.scheduled
+			AND Photo."user" NOT IN (
+				SELECT first_user
+				FROM ban
+				WHERE second_user=?
+			)
+			AND Photo."user" NOT IN (
+				SELECT id
+				FROM "User"
+				WHERE deactivated_at IS NOT NULL
+			)
+			AND `+visiblePhotoOwner+`
+			GROUP BY hashtag.name
+		)
+		SELECT name, uses
+		FROM result
+		ORDER BY position, uses DESC, name
+		LIMIT ?
+	`, query, pattern, pattern, dbUser.Id, dbUser.Id, dbUser.Id, dbUser.Id, limit)
+
+	if err != nil {
+		return dbHashtags, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		dbHashtag := DatabaseHashtagCountDefault()
+
+		err = rows.Scan(&dbHashtag.Hashtag, &dbHashtag.Count)
+
+		if err != nil {
+			return dbHashtags, err
+		}
+
+		dbHashtags = append(dbHashtags, dbHashtag)
+	}
+
+	return dbHashtags, rows.Err()
+}
+
+func (db *appdbimpl) RebuildHashtags(ctx context.Context) error {
+	// tag the photos again from the bodies of all the
+	// comments, including the ones written before the
+	// hashtags were parsed
+	return db.withTx(ctx, func(tx *dbtx) error {
+		_, err := tx.ExecContext(ctx, `
+			DELETE FROM photo_hashtag
+		`)
+
+		if err != nil {
+			return err
+		}
+
+		rows, err := tx.QueryContext(ctx, `
+			SELECT id, photo, comment_body
+			FROM Comment
+		`)
+
+		if err != nil {
+			return err
+		}
+
+		// the comments are read before tagging them,
+		// as the transaction runs on a single connection
+		dbComments := make([]DatabaseComment, 0)
+
+		for rows.Next() {
+			dbComment := DatabaseCommentDefault()
+
+			err = rows.Scan(&dbComment.Id, &dbComment.Photo.Id, &dbComment.CommentBody)
+
+			if err != nil {
+				_ = rows.Close()
+				return err
+			}
+
+			dbComments = append(dbComments, dbComment)
+		}
+
+		if rows.Err() != nil {
+			return rows.Err()
+		}
+
+		_ = rows.Close()
+
+		for _, dbComment := range dbComments {
+			err = insertHashtagsTx(ctx, tx, dbComment.Id, dbComment.Photo.Id, dbComment.CommentBody)
+
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
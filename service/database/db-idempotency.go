@@ -0,0 +1,116 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+func (db *appdbimpl) ReserveIdempotencyKey(ctx context.Context, dbKey DatabaseIdempotencyKey, expired time.Time, abandoned time.Time) error {
+	// reserve the key for the request, taking over the key
+	// if it was used before `expired`, or if its request
+	// is still in progress since before `abandoned`, so
+	// that the request is in progress until it is
+	// completed or deleted
+	res, err := db.c.ExecContext(ctx, `
+		INSERT INTO idempotency_key("user", "key", fingerprint, status, content_type, body, date)
+		VALUES (?, ?, ?, 0, '', NULL, ?)
+		ON CONFLICT ("user", "key") DO UPDATE
+		SET fingerprint=excluded.fingerprint, status=0, content_type='', body=NULL, date=excluded.date
+		WHERE idempotency_key.date < ?
+		OR (idempotency_key.status=0 AND idempotency_key.date < ?)
+	`, dbKey.User, dbKey.Key, dbKey.Fingerprint, dbKey.Date.Unix(), expired.Unix(), abandoned.Unix())
+
+	if err != nil {
+		return err
+	}
+
+	aff, err := res.RowsAffected()
+
+	if err != nil {
+		return err
+	}
+
+	// if there are no affected rows then
+	// the key is still in use
+	if aff == 0 {
+		return ErrIdempotencyKeyInUse
+	}
+
+	return nil
+}
+
+func (db *appdbimpl) GetIdempotencyKey(ctx context.Context, userId uint32, key string) (DatabaseIdempotencyKey, error) {
+	dbKey := DatabaseIdempotencyKeyDefault()
+
+	// the key is read from the primary, since it
+	// may have been completed a moment before
+	err := db.c.QueryRowContext(ctx, `
+		SELECT "user", "key", fingerprint, status, content_type, body, date
+		FROM idempotency_key
+		WHERE "user"=?
+		AND "key"=?
+	`, userId, key).Scan(&dbKey.User, &dbKey.Key, &dbKey.Fingerprint, &dbKey.Status, &dbKey.ContentType, &dbKey.Body, unixTime{&dbKey.Date})
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return dbKey, ErrIdempotencyKeyDoesNotExist
+	}
+
+	return dbKey, err
+}
+
+func (db *appdbimpl) CompleteIdempotencyKey(ctx context.Context, dbKey DatabaseIdempotencyKey) error {
+	// store the response to the request, keeping
+	// the date the key was reserved at
+	res, err := db.c.ExecContext(ctx, `
+		UPDATE idempotency_key
+		SET status=?, content_type=?, body=?
+		WHERE "user"=?
+		AND "key"=?
+		AND fingerprint=?
+	`, dbKey.Status, dbKey.ContentType, dbKey.Body, dbKey.User, dbKey.Key, dbKey.Fingerprint)
+
+	if err != nil {
+		return err
+	}
+
+	aff, err := res.RowsAffected()
+
+	if err != nil {
+		return err
+	}
+
+	if aff == 0 {
+		return ErrIdempotencyKeyDoesNotExist
+	}
+
+	return nil
+}
+
+func (db *appdbimpl) DeleteIdempotencyKey(ctx context.Context, userId uint32, key string) error {
+	_, err := db.c.ExecContext(ctx, `
+		DELETE FROM idempotency_key
+		WHERE "user"=?
+		AND "key"=?
+	`, userId, key)
+
+	return err
+}
+
+func (db *appdbimpl) DeleteExpiredIdempotencyKeys(ctx context.Context, before time.Time) (int, error) {
+	// remove the keys used before `before`,
+	// whose responses are no longer replayed
+	res, err := db.c.ExecContext(ctx, `
+		DELETE FROM idempotency_key
+		WHERE date < ?
+	`, before.Unix())
+
+	if err != nil {
+		return 0, err
+	}
+
+	aff, err := res.RowsAffected()
+
+	return int(aff), err
+}
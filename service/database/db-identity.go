@@ -0,0 +1,122 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+func (db *appdbimpl) GetIdentityUser(ctx context.Context, provider string, subject string) (DatabaseUser, error) {
+	dbUser := DatabaseUserDefault()
+
+	// get the user linked to the identity
+	err := db.c.QueryRowContext(ctx, `
+		SELECT "User".id, "User".username, "User".version
+		FROM identity
+		JOIN "User" ON "User".id=identity."user"
+		WHERE identity.provider=?
+		AND identity.subject=?
+	`, provider, subject).Scan(&dbUser.Id, &dbUser.Username, &dbUser.Version)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return dbUser, ErrIdentityDoesNotExist
+	}
+
+	return dbUser, err
+}
+
+func (db *appdbimpl) InsertIdentity(ctx context.Context, dbIdentity DatabaseIdentity) error {
+	return db.withTx(ctx, func(tx *dbtx) error {
+		// link the identity to the user, unless
+		// it is already linked to a user
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO identity(provider, subject, "user", date)
+			VALUES (?, ?, ?, ?)
+			ON CONFLICT (provider, subject) DO NOTHING
+		`, dbIdentity.Provider, dbIdentity.Subject, dbIdentity.User.Id, dbIdentity.Date.Unix())
+
+		if err != nil {
+			return err
+		}
+
+		// an identity linked again to the
+		// same user is left as it was
+		var userId uint32
+
+		err = tx.QueryRowContext(ctx, `
+			SELECT "user"
+			FROM identity
+			WHERE provider=?
+			AND subject=?
+		`, dbIdentity.Provider, dbIdentity.Subject).Scan(&userId)
+
+		if err != nil {
+			return err
+		}
+
+		if userId != dbIdentity.User.Id {
+			return ErrIdentityAlreadyLinked
+		}
+
+		return nil
+	})
+}
+
+func (db *appdbimpl) InsertIdentityUser(ctx context.Context, dbUser *DatabaseUser, dbIdentity DatabaseIdentity) error {
+	return db.withTx(ctx, func(tx *dbtx) error {
+		// register a new user, whose username must be free: unlike
+		// the login, the identity never takes over an existing user
+		reserved, err := usernameReservedTx(ctx, tx, db.usernameKey(dbUser.Username), 0)
+
+		if err != nil {
+			return err
+		}
+
+		if reserved {
+			return ErrUsernameAlreadyTaken
+		}
+
+		err = tx.QueryRowContext(ctx, `
+			INSERT INTO "User"(username, username_key)
+			VALUES (?, ?)
+			RETURNING id
+		`, dbUser.Username, db.usernameKey(dbUser.Username)).Scan(&dbUser.Id)
+
+		if db.c.d.isUniqueViolation(err) {
+			return ErrUsernameAlreadyTaken
+		}
+
+		if err != nil {
+			return err
+		}
+
+		// link the identity to the new user
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO identity(provider, subject, "user", date)
+			VALUES (?, ?, ?, ?)
+		`, dbIdentity.Provider, dbIdentity.Subject, dbUser.Id, dbIdentity.Date.Unix())
+
+		if db.c.d.isUniqueViolation(err) {
+			return ErrIdentityAlreadyLinked
+		}
+
+		return err
+	})
+}
+
+func (db *appdbimpl) CheckIdentity(ctx context.Context, dbLogin DatabaseLogin) (bool, error) {
+	checkIdentity := false
+
+	// check whether the user with the username
+	// signs in through an external provider
+	err := db.c.QueryRowContext(ctx, `
+		SELECT EXISTS(
+			SELECT 1
+			FROM identity
+			JOIN "User" ON "User".id=identity."user"
+			WHERE "User".username_key=?
+		)
+	`, db.usernameKey(dbLogin.Username)).Scan(&checkIdentity)
+
+	return checkIdentity, err
+}
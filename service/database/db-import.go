@@ -0,0 +1,262 @@
+package database
+
+import (
+	"context"
+)
+
+func (db *appdbimpl) GetExport(ctx context.Context, dbUser DatabaseUser) (DatabaseExport, error) {
+	dbExport := DatabaseExportDefault()
+	dbExport.User = dbUser
+
+	// get the images of the user, from the oldest, archived ones
+	// included; the scheduled photos, not published yet, and the
+	// videos, whose posters cannot be imported back, are left out
+	rows, err := db.c.QueryContext(ctx, `
+		SELECT id
+		FROM Photo
+		WHERE "user"=?
+		AND media_type=?
+		AND NOT scheduled
+		ORDER BY date, id
+	`, dbUser.Id, MediaImage)
+
+	if err != nil {
+		return dbExport, err
+	}
+
+	photoIds := make([]uint32, 0)
+
+	for rows.Next() {
+		var photoId uint32
+
+		err = rows.Scan(&photoId)
+
+		if err != nil {
+			_ = rows.Close()
+			return dbExport, err
+		}
+
+		photoIds = append(photoIds, photoId)
+	}
+
+	if rows.Err() != nil {
+		return dbExport, rows.Err()
+	}
+
+	_ = rows.Close()
+
+	// the position of each photo in the export
+	positions := make(map[uint32]int)
+
+	for _, photoId := range photoIds {
+		dbPhoto, err := db.GetDatabasePhoto(ctx, photoId, dbUser)
+
+		if err != nil {
+			return dbExport, err
+		}
+
+		dbExportPhoto := DatabaseExportPhotoDefault()
+		dbExportPhoto.Photo = dbPhoto
+
+		positions[photoId] = len(dbExport.Photos)
+		dbExport.Photos = append(dbExport.Photos, dbExportPhoto)
+	}
+
+	// get the comments under the photos, from the oldest,
+	// with the username of their author, without the
+	// comments of shadow banned users
+	rows, err = db.c.QueryContext(ctx, `
+		SELECT Comment.id, Comment.photo, Comment.date, Comment.comment_body, "User".id, "User".username
+		FROM Comment
+		JOIN Photo ON Photo.id=Comment.photo
+		JOIN "User" ON "User".id=Comment."user"
+		WHERE Photo."user"=?
+		AND Photo.media_type=?
+		AND NOT Photo.scheduled
+		AND `+visibleComment+`
+		ORDER BY Comment.date, Comment.id
+	`, dbUser.Id, MediaImage, dbUser.Id)
+
+	if err != nil {
+		return dbExport, err
+	}
+
+	for rows.Next() {
+		dbComment := DatabaseCommentDefault()
+
+		err = rows.Scan(&dbComment.Id, &dbComment.Photo.Id, unixTime{&dbComment.Date}, &dbComment.CommentBody, &dbComment.User.Id, &dbComment.User.Username)
+
+		if err != nil {
+			_ = rows.Close()
+			return dbExport, err
+		}
+
+		// the photos published meanwhile are not part of the export
+		position, ok := positions[dbComment.Photo.Id]
+
+		if !ok {
+			continue
+		}
+
+		dbExport.Photos[position].Comments = append(dbExport.Photos[position].Comments, dbComment)
+	}
+
+	if rows.Err() != nil {
+		return dbExport, rows.Err()
+	}
+
+	_ = rows.Close()
+
+	return dbExport, nil
+}
+
+func (db *appdbimpl) GetImportedPhotos(ctx context.Context, dbUser DatabaseUser, source string) (map[uint32]uint32, error) {
+	imported := make(map[uint32]uint32)
+
+	// get the photos already imported by the user from the
+	// archive of the account `source`, by their id in it
+	rows, err := db.c.QueryContext(ctx, `
+		SELECT source_id, photo
+		FROM photo_import
+		WHERE "user"=?
+		AND source=?
+	`, dbUser.Id, source)
+
+	if err != nil {
+		return imported, err
+	}
+
+	for rows.Next() {
+		var sourceId, photoId uint32
+
+		err = rows.Scan(&sourceId, &photoId)
+
+		if err != nil {
+			_ = rows.Close()
+			return imported, err
+		}
+
+		imported[sourceId] = photoId
+	}
+
+	if rows.Err() != nil {
+		return imported, rows.Err()
+	}
+
+	_ = rows.Close()
+
+	return imported, nil
+}
+
+func (db *appdbimpl) ImportPhoto(ctx context.Context, dbImport *DatabaseImport) error {
+	dbPhoto := &dbImport.Photo
+
+	// the hash is stored as the signed integer with the same bits
+	var hash interface{}
+
+	if dbPhoto.Hash != nil {
+		hash = int64(*dbPhoto.Hash)
+	}
+
+	// a photo without a place has neither the place nor its key
+	var place, key interface{}
+
+	if dbPhoto.Place != "" {
+		place = dbPhoto.Place
+		key = placeKey(dbPhoto.Place)
+	}
+
+	// the photo, its comments and the record of its import are
+	// inserted together, so that an import failing halfway is
+	// resumed from the first photo which was not imported
+	err := db.withTx(ctx, func(tx *dbtx) error {
+		var imported bool
+
+		err := tx.QueryRowContext(ctx, `
+			SELECT EXISTS (
+				SELECT 1
+				FROM photo_import
+				WHERE "user"=?
+				AND source=?
+				AND source_id=?
+			)
+		`, dbPhoto.User.Id, dbImport.Source, dbImport.SourceId).Scan(&imported)
+
+		if err != nil {
+			return err
+		}
+
+		if imported {
+			return ErrPhotoAlreadyImported
+		}
+
+		// insert the photo with its original date
+		err = tx.QueryRowContext(ctx, `
+			INSERT INTO Photo("user", url, date, phash, latitude, longitude, place, place_key, archived, close_friends, flagged, media_type, alt_text)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			RETURNING id
+		`, dbPhoto.User.Id, dbPhoto.Url, dbPhoto.Date.Unix(), hash, dbPhoto.Latitude, dbPhoto.Longitude, place, key, dbPhoto.Archived, dbPhoto.CloseFriends, dbPhoto.Flagged, MediaImage, dbPhoto.AltText).Scan(&dbPhoto.Id)
+
+		if err != nil {
+			return err
+		}
+
+		for i := range dbImport.Comments {
+			dbComment := &dbImport.Comments[i]
+			dbComment.Photo.Id = dbPhoto.Id
+
+			// the comments are the ones the exported account wrote,
+			// which become comments of the user
+			dbComment.User = dbPhoto.User
+
+			err = importCommentTx(ctx, tx, dbComment, db.usernameKey)
+
+			if err != nil {
+				return err
+			}
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO photo_import("user", source, source_id, photo)
+			VALUES (?, ?, ?, ?)
+		`, dbPhoto.User.Id, dbImport.Source, dbImport.SourceId, dbPhoto.Id)
+
+		return err
+	})
+
+	if err != nil {
+		return err
+	}
+
+	db.invalidate(ctx, photosGroup(dbPhoto.User.Id))
+
+	return nil
+}
+
+// importCommentTx inserts an imported comment within the given transaction, like insertCommentTx but without notifying
+// anyone, as the comment was already seen in the exported account
+func importCommentTx(ctx context.Context, tx *dbtx, dbComment *DatabaseComment, usernameKey func(string) string) error {
+	err := tx.QueryRowContext(ctx, `
+		INSERT INTO Comment("user", photo, date, comment_body)
+		VALUES (?, ?, ?, ?)
+		RETURNING id
+	`, dbComment.User.Id, dbComment.Photo.Id, dbComment.Date.Unix(), dbComment.CommentBody).Scan(&dbComment.Id)
+
+	if err != nil {
+		return err
+	}
+
+	err = insertHashtagsTx(ctx, tx, dbComment.Id, dbComment.Photo.Id, dbComment.CommentBody)
+
+	if err != nil {
+		return err
+	}
+
+	err = insertMentionsTx(ctx, tx, *dbComment, usernameKey)
+
+	if err != nil {
+		return err
+	}
+
+	return addPhotoCommentCount(ctx, tx, dbComment.Photo.Id, 1)
+}
@@ -1,57 +1,163 @@
 package database
 
 import (
-	"database/sql"
-	"errors"
+	"context"
+
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/globaltime"
+)
+
+// The types of the reactions to a photo. A like is the reaction of type
+// ReactionLike, and every reaction counts as a like of the photo
+const (
+	ReactionLike  = "like"
+	ReactionLove  = "love"
+	ReactionLaugh = "laugh"
+	ReactionWow   = "wow"
+	ReactionSad   = "sad"
+	ReactionAngry = "angry"
 )
 
-func (db *appdbimpl) InsertLike(dbUser DatabaseUser, dbPhoto DatabasePhoto) error {
-	// insert the like into the database
-	_, err := db.c.Exec(`
-		INSERT OR IGNORE INTO like(user, photo)
-		VALUES (?, ?)
-	`, dbUser.Id, dbPhoto.Id)
+// Reactions are the types of the reactions, in the order they are shown
+var Reactions = []string{ReactionLike, ReactionLove, ReactionLaugh, ReactionWow, ReactionSad, ReactionAngry}
 
-	return err
+// IsReaction reports whether `reaction` is one of the Reactions.
+func IsReaction(reaction string) bool {
+	for _, r := range Reactions {
+		if r == reaction {
+			return true
+		}
+	}
+
+	return false
 }
 
-func (db *appdbimpl) DeleteLike(dbUser DatabaseUser, dbPhoto DatabasePhoto) error {
-	res, err := db.c.Exec(`
-		DELETE FROM like
-		WHERE user=?
-		AND photo=?
-	`, dbUser.Id, dbPhoto.Id)
+func (db *appdbimpl) InsertLike(ctx context.Context, dbUser DatabaseUser, dbPhoto DatabasePhoto, reaction string) error {
+	err := db.withTx(ctx, func(tx *dbtx) error {
+		// change the type of the reaction
+		// if the user already reacted
+		res, err := tx.ExecContext(ctx, `
+			UPDATE "like"
+			SET type=?
+			WHERE "user"=?
+			AND photo=?
+		`, reaction, dbUser.Id, dbPhoto.Id)
+
+		if err != nil {
+			return err
+		}
+
+		aff, err := res.RowsAffected()
+
+		if err != nil || aff > 0 {
+			return err
+		}
+
+		// insert the reaction into the database
+		res, err = tx.ExecContext(ctx, `
+			INSERT INTO "like"("user", photo, type, date)
+			VALUES (?, ?, ?, ?)
+			ON CONFLICT DO NOTHING
+		`, dbUser.Id, dbPhoto.Id, reaction, globaltime.Now().Unix())
+
+		if err != nil {
+			return err
+		}
+
+		aff, err = res.RowsAffected()
+
+		if err != nil {
+			return err
+		}
+
+		// if there are no affected rows then the photo
+		// was already liked, hence the counter is unchanged
+		if aff == 0 {
+			return nil
+		}
+
+		err = insertLikeNotificationTx(ctx, tx, dbUser, dbPhoto)
+
+		if err != nil {
+			return err
+		}
+
+		return addPhotoLikeCount(ctx, tx, dbPhoto.Id, 1)
+	})
 
 	if err != nil {
 		return err
 	}
 
-	aff, err := res.RowsAffected()
+	db.invalidate(ctx, photoGroup(dbPhoto.Id))
+
+	return nil
+}
+
+func (db *appdbimpl) DeleteLike(ctx context.Context, dbUser DatabaseUser, dbPhoto DatabasePhoto) error {
+	err := db.withTx(ctx, func(tx *dbtx) error {
+		res, err := tx.ExecContext(ctx, `
+			DELETE FROM "like"
+			WHERE "user"=?
+			AND photo=?
+		`, dbUser.Id, dbPhoto.Id)
+
+		if err != nil {
+			return err
+		}
+
+		aff, err := res.RowsAffected()
+
+		if err != nil {
+			return err
+		}
+
+		// if there are no affected rows
+		// then the photo was not liked
+		if aff == 0 {
+			return ErrPhotoNotLiked
+		}
+
+		// the owner is no longer notified of the like
+		err = deleteNotificationTx(ctx, tx, dbUser.Id, NotificationLike, 0, dbPhoto.Id)
+
+		if err != nil {
+			return err
+		}
+
+		return addPhotoLikeCount(ctx, tx, dbPhoto.Id, -1)
+	})
 
 	if err != nil {
 		return err
 	}
 
-	// if there are no affected rows
-	// then the photo was not liked
-	if aff == 0 {
-		return ErrPhotoNotLiked
-	}
+	db.invalidate(ctx, photoGroup(dbPhoto.Id))
 
-	return err
+	return nil
 }
 
-func (db *appdbimpl) GetLikeList(dbPhoto DatabasePhoto, dbUser DatabaseUser) (DatabaseUserList, error) {
-	dbUserList := DatabaseUserListDefault()
+func (db *appdbimpl) GetLikeList(ctx context.Context, dbPhoto DatabasePhoto, dbUser DatabaseUser, limit int, after uint32) (DatabaseLikeList, error) {
+	dbLikeList := DatabaseLikeListDefault()
 
-	// get the table of the users who liked the photo
-	// without the users who banned the user performing the action
-	rows, err := db.c.Query(`
-		SELECT id, username
-		FROM User
+	// get the total number of likes from the counter of the photo
+	err := db.GetPhotoLikeCount(ctx, &dbPhoto, dbUser)
+
+	if err != nil {
+		return dbLikeList, err
+	}
+
+	dbLikeList.Total = dbPhoto.LikeCount
+
+	// get a page of at most `limit` users who liked the photo,
+	// sorted by id and starting right after the user `after`
+	// (or from the first user if `after` is 0), without the
+	// users who banned the user performing the action
+	rows, err := db.read().QueryContext(ctx, `
+		SELECT id, username, avatar
+		FROM "User"
 		WHERE id IN (
-			SELECT user
-			FROM like
+			SELECT "user"
+			FROM "like"
 			WHERE photo=?
 		)
 		AND id NOT IN (
@@ -59,34 +165,159 @@ func (db *appdbimpl) GetLikeList(dbPhoto DatabasePhoto, dbUser DatabaseUser) (Da
 			FROM ban
 			WHERE second_user=?
 		)
-	`, dbPhoto.Id, dbUser.Id)
+		AND id>?
+		ORDER BY id
+		LIMIT ?
+	`, dbPhoto.Id, dbUser.Id, after, limit)
 
-	if errors.Is(err, sql.ErrNoRows) {
-		return dbUserList, ErrPhotoDoesNotExist
+	if err != nil {
+		return dbLikeList, err
 	}
 
+	// build the like list
+	for rows.Next() {
+		tableDbUser := DatabaseUserDefault()
+
+		err = rows.Scan(&tableDbUser.Id, &tableDbUser.Username, &tableDbUser.Avatar)
+
+		if err != nil {
+			return dbLikeList, err
+		}
+
+		dbLikeList.Users = append(dbLikeList.Users, tableDbUser)
+	}
+
+	if rows.Err() != nil {
+		return dbLikeList, err
+	}
+
+	_ = rows.Close()
+
+	return dbLikeList, err
+}
+
+func (db *appdbimpl) GetPhotosLikes(ctx context.Context, photoIds []uint32, dbUser DatabaseUser, limit int, after uint32) (map[uint32][]DatabaseUser, error) {
+	dbUsers := make(map[uint32][]DatabaseUser)
+
+	if len(photoIds) == 0 {
+		return dbUsers, nil
+	}
+
+	args := make([]interface{}, 0, len(photoIds)+3)
+
+	for _, photoId := range photoIds {
+		args = append(args, photoId)
+	}
+
+	// get a page of at most `limit` users who liked each photo,
+	// as GetLikeList does for a single photo, numbering the
+	// users of every photo to keep the first `limit` ones only
+	rows, err := db.read().QueryContext(ctx, `
+		SELECT photo, id, username, avatar
+		FROM (
+			SELECT "like".photo, "User".id, "User".username, "User".avatar,
+				ROW_NUMBER() OVER (PARTITION BY "like".photo ORDER BY "User".id) AS position
+			FROM "like"
+			JOIN "User" ON "User".id="like"."user"
+			WHERE "like".photo IN (`+placeholders(len(photoIds))+`)
+			AND "User".id NOT IN (
+				SELECT first_user
+				FROM ban
+				WHERE second_user=?
+			)
+			AND "User".id>?
+		) AS page
+		WHERE position<=?
+		ORDER BY photo, id
+	`, append(args, dbUser.Id, after, limit)...)
+
 	if err != nil {
-		return dbUserList, err
+		return dbUsers, err
 	}
 
-	// build the like list
+	// group the users by photo
 	for rows.Next() {
+		var photoId uint32
 		tableDbUser := DatabaseUserDefault()
 
-		err = rows.Scan(&tableDbUser.Id, &tableDbUser.Username)
+		err = rows.Scan(&photoId, &tableDbUser.Id, &tableDbUser.Username, &tableDbUser.Avatar)
+
+		if err != nil {
+			return dbUsers, err
+		}
+
+		dbUsers[photoId] = append(dbUsers[photoId], tableDbUser)
+	}
+
+	if rows.Err() != nil {
+		return dbUsers, rows.Err()
+	}
+
+	_ = rows.Close()
+
+	return dbUsers, nil
+}
+
+func (db *appdbimpl) GetReactionList(ctx context.Context, dbPhoto DatabasePhoto, dbUser DatabaseUser, reaction string, limit int, after uint32) (DatabaseReactionList, error) {
+	dbReactionList := DatabaseReactionListDefault()
+
+	// get the number of reactions of each type
+	err := db.GetPhotoStats(ctx, &dbPhoto, dbUser)
+
+	if err != nil {
+		return dbReactionList, err
+	}
+
+	dbReactionList.Total = dbPhoto.Reactions[reaction]
+
+	if reaction == "" {
+		dbReactionList.Total = dbPhoto.LikeCount
+	}
+
+	// get a page of at most `limit` reactions to the photo,
+	// of the given type (or of every type if `reaction` is
+	// empty), sorted by user id and starting right after the
+	// user `after` (or from the first user if `after` is 0),
+	// without the users who banned the user performing the
+	// action
+	rows, err := db.read().QueryContext(ctx, `
+		SELECT "User".id, "User".username, "User".avatar, "like".type
+		FROM "like"
+		JOIN "User" ON "User".id="like"."user"
+		WHERE "like".photo=?
+		AND (CAST(? AS TEXT)='' OR "like".type=?)
+		AND "User".id NOT IN (
+			SELECT first_user
+			FROM ban
+			WHERE second_user=?
+		)
+		AND "User".id>?
+		ORDER BY "User".id
+		LIMIT ?
+	`, dbPhoto.Id, reaction, reaction, dbUser.Id, after, limit)
+
+	if err != nil {
+		return dbReactionList, err
+	}
+
+	// build the reaction list
+	for rows.Next() {
+		dbReaction := DatabaseReaction{User: DatabaseUserDefault()}
+
+		err = rows.Scan(&dbReaction.User.Id, &dbReaction.User.Username, &dbReaction.User.Avatar, &dbReaction.Type)
 
 		if err != nil {
-			return dbUserList, err
+			return dbReactionList, err
 		}
 
-		dbUserList.Users = append(dbUserList.Users, tableDbUser)
+		dbReactionList.Reactions = append(dbReactionList.Reactions, dbReaction)
 	}
 
 	if rows.Err() != nil {
-		return dbUserList, err
+		return dbReactionList, err
 	}
 
 	_ = rows.Close()
 
-	return dbUserList, err
+	return dbReactionList, err
 }
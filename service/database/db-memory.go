@@ -0,0 +1,5470 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/bits"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/cache"
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/globaltime"
+)
+
+// memdb is an AppDatabase keeping every table in memory. It behaves like the SQL implementations, hence it can
+// replace them wherever a real database is not needed (eg. when testing the API handlers).
+type memdb struct {
+	mu sync.Mutex
+
+	users    map[uint32]*memUser
+	photos   map[uint32]*memPhoto
+	comments map[uint32]*memComment
+	follows  map[memPair]bool
+	// followRequests maps the requests to follow the private accounts to when they were sent
+	followRequests map[memPair]time.Time
+	bans           map[memPair]bool
+	// banDetails holds the reason and the expiry of each ban
+	banDetails map[memPair]memBan
+	mutes      map[memPair]bool
+	// closeFriends pairs each user with the followers they added as close friends
+	closeFriends map[memPair]bool
+	// likes maps each reaction to its type, and likeDates to when it was added
+	likes     map[memPair]string
+	likeDates map[memPair]time.Time
+	// albums are kept apart from the photos they group
+	albums  map[uint32]*memAlbum
+	stories map[uint32]*memStory
+	// notifications are sent to the users by the actions of the others
+	notifications map[uint32]*memNotification
+	devices       map[uint32]*memDevice
+	// sessions are keyed by the hash of their access token,
+	// and refreshTokens by their own hash
+	sessions      map[string]*memSession
+	refreshTokens map[string]*memRefreshToken
+	// identities link the users of the external providers to their user
+	identities map[memIdentity]*memIdentityLink
+	// apiKeys are keyed by their hash
+	apiKeys map[string]*memAPIKey
+	// blockedTerms are the terms blocked by the administrators, and heldComments
+	// the comments held back for matching a blocked term
+	blockedTerms map[uint32]*DatabaseBlockedTerm
+	heldComments map[uint32]*memHeldComment
+	// reservedNames are the usernames reserved by the administrators
+	reservedNames map[uint32]*DatabaseReservedName
+	// erasures are the erasures requested by the users, from the oldest
+	erasures []*DatabaseErasure
+	// webhooks are keyed by their id, and webhookDeliveries are kept from the oldest
+	webhooks          map[uint32]*DatabaseWebhook
+	webhookDeliveries []*DatabaseWebhookDelivery
+	// idempotencyKeys are keyed by their user and their key
+	idempotencyKeys map[memIdempotencyKey]*DatabaseIdempotencyKey
+	// imports map the photos imported from the export archives to the photos they became
+	imports map[memImport]uint32
+
+	// audit holds the entries of the audit log, from the oldest to the newest
+	audit []DatabaseAuditEntry
+	// usernameHistory holds the usernames left by the users, from the oldest to the newest
+	usernameHistory []memUsernameChange
+	// usernameKey gives the key the users are looked up by to their usernames
+	usernameKey func(string) string
+
+	// the ids are never reused, like the autoincrement columns
+	lastUserId         uint32
+	lastPhotoId        uint32
+	lastCommentId      uint32
+	lastAlbumId        uint32
+	lastStoryId        uint32
+	lastNotificationId uint32
+	lastDeviceId       uint32
+	lastSessionId      uint32
+	lastRefreshTokenId uint32
+	lastAPIKeyId       uint32
+	lastBlockedTermId  uint32
+	lastHeldCommentId  uint32
+	lastReservedNameId uint32
+	lastErasureId      uint32
+	lastWebhookId      uint32
+	lastDeliveryId     uint32
+}
+
+type memUsernameChange struct {
+	username      string
+	user          uint32
+	changedAt     time.Time
+	reservedUntil time.Time
+}
+
+type memBan struct {
+	reason string
+	// expiresAt is nil if the ban never expires
+	expiresAt *time.Time
+}
+
+type memUser struct {
+	id       uint32
+	username string
+	// displayName, bio and website are the profile of the user, empty until they set it
+	displayName string
+	bio         string
+	website     string
+	// avatar is the url of the avatar of the user, empty until they upload one
+	avatar        string
+	deactivatedAt *time.Time
+	// suspendedAt is when the administrators suspended the user, nil if they did not
+	suspendedAt *time.Time
+	// shadowBanned is whether the administrators hid the photos and the comments of the user to everyone else
+	shadowBanned  bool
+	version       uint32
+	stripLocation bool
+	// email is empty if unset, and digestSentAt is nil if no digest was sent
+	email         string
+	emailVerified bool
+	digestSentAt  *time.Time
+	// streamSeenAt is nil until the user marks their stream as seen
+	streamSeenAt *time.Time
+	// private, commentPolicy, mentionPolicy and hideLikeCounts are the privacy settings of the user
+	private        bool
+	commentPolicy  string
+	mentionPolicy  string
+	hideLikeCounts bool
+	// notificationPreferences holds the channels of the types of notification the user changed
+	notificationPreferences map[string]DatabaseNotificationPreference
+}
+
+type memPhoto struct {
+	id       uint32
+	user     uint32
+	url      string
+	date     time.Time
+	archived bool
+	hash     *uint64
+	// latitude and longitude are either both set or both nil
+	latitude  *float64
+	longitude *float64
+	place     string
+	// pinnedAt is when the photo was pinned, nil if it is not pinned
+	pinnedAt *time.Time
+	// closeFriends is set if the photo is only for the close friends of the user
+	closeFriends bool
+	// flagged is set if the photo was flagged as unsafe, hiding it to everyone but its owner
+	flagged bool
+	// scheduled is set until the photo is published at its date, hiding it to everyone but its owner
+	scheduled bool
+	// mediaType is MediaImage or MediaVideo; posterUrl and duration are only set for the videos
+	mediaType string
+	posterUrl string
+	duration  time.Duration
+	// originalUrl is the url of the original image of an edited photo, empty if it was not edited
+	originalUrl string
+	// altText describes the photo to the users who cannot see it
+	altText string
+}
+
+type memComment struct {
+	id   uint32
+	user uint32
+	// photo is the id of the photo the comment is under
+	photo uint32
+	date  time.Time
+	body  string
+	// mentions are the ids of the users mentioned in the body
+	mentions []uint32
+}
+
+type memAlbum struct {
+	id   uint32
+	user uint32
+	name string
+	date time.Time
+	// photos are the ids of the photos of the album, in their order
+	photos []uint32
+}
+
+type memStory struct {
+	id        uint32
+	user      uint32
+	url       string
+	date      time.Time
+	expiresAt time.Time
+}
+
+type memNotification struct {
+	id    uint32
+	user  uint32
+	actor uint32
+	kind  string
+	// photo and comment are 0 if the notification is not about them
+	photo   uint32
+	comment uint32
+	date    time.Time
+	read    bool
+	pushed  bool
+}
+
+type memDevice struct {
+	id       uint32
+	user     uint32
+	platform string
+	token    string
+	date     time.Time
+}
+
+type memSession struct {
+	id        uint32
+	user      uint32
+	createdAt time.Time
+	expiresAt time.Time
+	lastSeen  time.Time
+}
+
+type memRefreshToken struct {
+	id uint32
+	// session is the id of the session the token refreshes
+	session   uint32
+	createdAt time.Time
+	expiresAt time.Time
+	used      bool
+}
+
+// memIdentity is the user known by an external provider as the subject
+type memIdentity struct {
+	provider string
+	subject  string
+}
+
+type memIdentityLink struct {
+	user uint32
+	date time.Time
+}
+
+// memIdempotencyKey is the idempotency key sent by the user
+type memIdempotencyKey struct {
+	user uint32
+	key  string
+}
+
+// memImport identifies a photo imported by the user from the archive of the account `source`, by its id in it
+type memImport struct {
+	user     uint32
+	source   string
+	sourceId uint32
+}
+
+type memAPIKey struct {
+	id         uint32
+	user       uint32
+	name       string
+	scope      string
+	rateLimit  int
+	createdAt  time.Time
+	lastUsedAt *time.Time
+}
+
+type memHeldComment struct {
+	id    uint32
+	user  uint32
+	photo uint32
+	date  time.Time
+	body  string
+	// term is the blocked term the comment matched
+	term string
+}
+
+// memPair is a row of the follow, ban and like tables: the first
+// user follows (or bans) the second one, or the user likes the photo
+type memPair struct {
+	first  uint32
+	second uint32
+}
+
+// NewMemory returns a new, empty instance of AppDatabase kept in memory.
+func NewMemory() AppDatabase {
+	return &memdb{
+		users:           make(map[uint32]*memUser),
+		photos:          make(map[uint32]*memPhoto),
+		comments:        make(map[uint32]*memComment),
+		follows:         make(map[memPair]bool),
+		followRequests:  make(map[memPair]time.Time),
+		bans:            make(map[memPair]bool),
+		banDetails:      make(map[memPair]memBan),
+		mutes:           make(map[memPair]bool),
+		closeFriends:    make(map[memPair]bool),
+		likes:           make(map[memPair]string),
+		likeDates:       make(map[memPair]time.Time),
+		albums:          make(map[uint32]*memAlbum),
+		stories:         make(map[uint32]*memStory),
+		notifications:   make(map[uint32]*memNotification),
+		devices:         make(map[uint32]*memDevice),
+		sessions:        make(map[string]*memSession),
+		refreshTokens:   make(map[string]*memRefreshToken),
+		identities:      make(map[memIdentity]*memIdentityLink),
+		apiKeys:         make(map[string]*memAPIKey),
+		blockedTerms:    make(map[uint32]*DatabaseBlockedTerm),
+		heldComments:    make(map[uint32]*memHeldComment),
+		reservedNames:   make(map[uint32]*DatabaseReservedName),
+		webhooks:        make(map[uint32]*DatabaseWebhook),
+		idempotencyKeys: make(map[memIdempotencyKey]*DatabaseIdempotencyKey),
+		usernameKey:     func(username string) string { return username },
+		imports:         make(map[memImport]uint32),
+	}
+}
+
+// Ban
+
+func (m *memdb) InsertBan(ctx context.Context, dbUser DatabaseUser, dbBan DatabaseBan) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.users[dbUser.Id] == nil || m.users[dbBan.User.Id] == nil {
+		return ErrUserDoesNotExist
+	}
+
+	pair := memPair{dbUser.Id, dbBan.User.Id}
+
+	// the ban is recorded only the first time, banning
+	// the user again replaces its reason and its expiry
+	if !m.bans[pair] {
+		m.bans[pair] = true
+		m.insertAudit(dbUser.Id, AuditBan, dbBan.User.Id, dbBan.User.Username)
+	}
+
+	var expiresAt *time.Time
+
+	if dbBan.ExpiresAt != nil {
+		date := dbBan.ExpiresAt.UTC().Truncate(time.Second)
+		expiresAt = &date
+	}
+
+	m.banDetails[pair] = memBan{reason: dbBan.Reason, expiresAt: expiresAt}
+
+	return nil
+}
+
+func (m *memdb) DeleteBan(ctx context.Context, dbUser DatabaseUser, bannedDbUser DatabaseUser) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	pair := memPair{dbUser.Id, bannedDbUser.Id}
+
+	if !m.bans[pair] {
+		return ErrUserNotBanned
+	}
+
+	delete(m.bans, pair)
+	delete(m.banDetails, pair)
+
+	m.insertAudit(dbUser.Id, AuditUnban, bannedDbUser.Id, bannedDbUser.Username)
+
+	return nil
+}
+
+func (m *memdb) CheckBan(ctx context.Context, firstDbUser DatabaseUser, secondDbUser DatabaseUser) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.bans[memPair{firstDbUser.Id, secondDbUser.Id}], nil
+}
+
+func (m *memdb) GetBanList(ctx context.Context, dbUser DatabaseUser) (DatabaseBanList, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	dbBanList := DatabaseBanListDefault()
+
+	for pair := range m.bans {
+		if pair.first != dbUser.Id || !m.active(pair.second) {
+			continue
+		}
+
+		details := m.banDetails[pair]
+
+		dbBan := DatabaseBanDefault()
+
+		dbBan.User = m.user(pair.second)
+		dbBan.Reason = details.reason
+		dbBan.ExpiresAt = details.expiresAt
+
+		dbBanList.Bans = append(dbBanList.Bans, dbBan)
+	}
+
+	sort.Slice(dbBanList.Bans, func(i, j int) bool {
+		return dbBanList.Bans[i].User.Username < dbBanList.Bans[j].User.Username
+	})
+
+	return dbBanList, nil
+}
+
+func (m *memdb) DeleteExpiredBans(ctx context.Context, now time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	deleted := 0
+
+	for pair, details := range m.banDetails {
+		if details.expiresAt != nil && details.expiresAt.Unix() <= now.Unix() {
+			delete(m.bans, pair)
+			delete(m.banDetails, pair)
+			deleted++
+		}
+	}
+
+	return deleted, nil
+}
+
+// Mute
+
+func (m *memdb) InsertMute(ctx context.Context, dbUser DatabaseUser, mutedDbUser DatabaseUser) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.users[dbUser.Id] == nil || m.users[mutedDbUser.Id] == nil {
+		return ErrUserDoesNotExist
+	}
+
+	m.mutes[memPair{dbUser.Id, mutedDbUser.Id}] = true
+
+	return nil
+}
+
+func (m *memdb) DeleteMute(ctx context.Context, dbUser DatabaseUser, mutedDbUser DatabaseUser) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	pair := memPair{dbUser.Id, mutedDbUser.Id}
+
+	if !m.mutes[pair] {
+		return ErrUserNotMuted
+	}
+
+	delete(m.mutes, pair)
+
+	return nil
+}
+
+func (m *memdb) CheckMute(ctx context.Context, firstDbUser DatabaseUser, secondDbUser DatabaseUser) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.mutes[memPair{firstDbUser.Id, secondDbUser.Id}], nil
+}
+
+func (m *memdb) GetMutedList(ctx context.Context, dbUser DatabaseUser) (DatabaseUserList, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	dbUserList := DatabaseUserListDefault()
+
+	for pair := range m.mutes {
+		if pair.first == dbUser.Id && m.active(pair.second) {
+			dbUserList.Users = append(dbUserList.Users, m.user(pair.second))
+		}
+	}
+
+	sort.Slice(dbUserList.Users, func(i, j int) bool {
+		return dbUserList.Users[i].Username < dbUserList.Users[j].Username
+	})
+
+	return dbUserList, nil
+}
+
+// Close friend
+
+func (m *memdb) InsertCloseFriend(ctx context.Context, dbUser DatabaseUser, friendDbUser DatabaseUser) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.users[dbUser.Id] == nil || m.users[friendDbUser.Id] == nil {
+		return ErrUserDoesNotExist
+	}
+
+	// only the followers of the user can be added
+	if !m.follows[memPair{friendDbUser.Id, dbUser.Id}] {
+		return ErrNotFollower
+	}
+
+	m.closeFriends[memPair{dbUser.Id, friendDbUser.Id}] = true
+
+	return nil
+}
+
+func (m *memdb) DeleteCloseFriend(ctx context.Context, dbUser DatabaseUser, friendDbUser DatabaseUser) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	pair := memPair{dbUser.Id, friendDbUser.Id}
+
+	if !m.closeFriends[pair] {
+		return ErrUserNotCloseFriend
+	}
+
+	delete(m.closeFriends, pair)
+
+	return nil
+}
+
+func (m *memdb) CheckCloseFriend(ctx context.Context, firstDbUser DatabaseUser, secondDbUser DatabaseUser) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.closeFriends[memPair{firstDbUser.Id, secondDbUser.Id}], nil
+}
+
+func (m *memdb) GetCloseFriendsList(ctx context.Context, dbUser DatabaseUser) (DatabaseUserList, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	dbUserList := DatabaseUserListDefault()
+
+	for pair := range m.closeFriends {
+		if pair.first == dbUser.Id && m.active(pair.second) {
+			dbUserList.Users = append(dbUserList.Users, m.user(pair.second))
+		}
+	}
+
+	sort.Slice(dbUserList.Users, func(i, j int) bool {
+		return dbUserList.Users[i].Username < dbUserList.Users[j].Username
+	})
+
+	return dbUserList, nil
+}
+
+// visiblePhoto reports whether the user can see the photo, which is false for the photos flagged as unsafe, for the
+// scheduled photos, for the photos of shadow banned users, for the photos for close friends of the users who did not add them as close friends
+// and for the photos of the private accounts the user does not follow, unless the user owns them
+func (m *memdb) visiblePhoto(photo *memPhoto, userId uint32) bool {
+	if photo.user == userId {
+		return true
+	}
+
+	if m.privateHidden(photo.user, userId) && !m.follows[memPair{userId, photo.user}] {
+		return false
+	}
+
+	return !photo.flagged && !photo.scheduled && !m.shadowHidden(photo.user, userId) && (!photo.closeFriends || m.closeFriends[memPair{photo.user, userId}])
+}
+
+// privateHidden reports whether the user `userId` is a private account other than the user `viewerId`, whose photos
+// are left out of the public lists
+func (m *memdb) privateHidden(userId uint32, viewerId uint32) bool {
+	user := m.users[userId]
+
+	return userId != viewerId && user != nil && user.private
+}
+
+// shadowHidden reports whether the photos and the comments of the user `userId` are hidden to the user `viewerId`,
+// which is the case when the former is shadow banned and they are not the same user
+func (m *memdb) shadowHidden(userId uint32, viewerId uint32) bool {
+	user := m.users[userId]
+
+	return userId != viewerId && user != nil && user.shadowBanned
+}
+
+// Follow
+
+func (m *memdb) InsertFollow(ctx context.Context, dbUser DatabaseUser, followedDbUser DatabaseUser) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.users[dbUser.Id] == nil || m.users[followedDbUser.Id] == nil {
+		return ErrUserDoesNotExist
+	}
+
+	m.follow(dbUser.Id, followedDbUser.Id)
+
+	return nil
+}
+
+// follow makes the user `userId` follow the user `followedId`, notifying the
+// latter the first time and removing the request to follow them, if any
+func (m *memdb) follow(userId uint32, followedId uint32) {
+	pair := memPair{userId, followedId}
+
+	delete(m.followRequests, pair)
+
+	if !m.follows[pair] {
+		m.follows[pair] = true
+		m.notify(followedId, userId, NotificationFollow, 0, 0)
+	}
+}
+
+func (m *memdb) DeleteFollow(ctx context.Context, dbUser DatabaseUser, followedDbUser DatabaseUser) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	pair := memPair{dbUser.Id, followedDbUser.Id}
+
+	if !m.follows[pair] {
+		return ErrUserNotFollowed
+	}
+
+	delete(m.follows, pair)
+
+	// only followers can be close friends
+	delete(m.closeFriends, memPair{followedDbUser.Id, dbUser.Id})
+
+	m.unnotify(dbUser.Id, NotificationFollow, followedDbUser.Id, 0)
+
+	m.insertAudit(dbUser.Id, AuditUnfollow, followedDbUser.Id, followedDbUser.Username)
+
+	return nil
+}
+
+func (m *memdb) GetFollowersCount(ctx context.Context, profileDbUser DatabaseUser, dbUser DatabaseUser) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return len(m.followers(profileDbUser.Id, dbUser.Id)), nil
+}
+
+func (m *memdb) GetFollowingCount(ctx context.Context, profileDbUser DatabaseUser, dbUser DatabaseUser) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return len(m.following(profileDbUser.Id, dbUser.Id)), nil
+}
+
+func (m *memdb) GetFollowersList(ctx context.Context, followersDbUser DatabaseUser, dbUser DatabaseUser) (DatabaseUserList, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.userList(m.followers(followersDbUser.Id, dbUser.Id)), nil
+}
+
+func (m *memdb) GetFollowingList(ctx context.Context, followingDbUser DatabaseUser, dbUser DatabaseUser) (DatabaseUserList, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.userList(m.following(followingDbUser.Id, dbUser.Id)), nil
+}
+
+func (m *memdb) GetFollowStatus(ctx context.Context, firstDbUser DatabaseUser, secondDbUser DatabaseUser) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.follows[memPair{firstDbUser.Id, secondDbUser.Id}], nil
+}
+
+// followers returns the active users following the user `userId`,
+// without the users who banned the user `viewerId`
+func (m *memdb) followers(userId uint32, viewerId uint32) []uint32 {
+	ids := make([]uint32, 0)
+
+	for pair := range m.follows {
+		if pair.second == userId && m.active(pair.first) && !m.bans[memPair{pair.first, viewerId}] {
+			ids = append(ids, pair.first)
+		}
+	}
+
+	return ids
+}
+
+// following returns the active users followed by the user `userId`, without
+// the users who banned the user `viewerId` unless they are the same user
+func (m *memdb) following(userId uint32, viewerId uint32) []uint32 {
+	ids := make([]uint32, 0)
+
+	for pair := range m.follows {
+		if pair.first != userId || !m.active(pair.second) {
+			continue
+		}
+
+		if userId != viewerId && m.bans[memPair{pair.second, viewerId}] {
+			continue
+		}
+
+		ids = append(ids, pair.second)
+	}
+
+	return ids
+}
+
+// Follow request
+
+func (m *memdb) InsertFollowRequest(ctx context.Context, dbUser DatabaseUser, followedDbUser DatabaseUser, date time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.users[dbUser.Id] == nil || m.users[followedDbUser.Id] == nil {
+		return ErrUserDoesNotExist
+	}
+
+	pair := memPair{dbUser.Id, followedDbUser.Id}
+
+	// the date of the first request is kept
+	if _, ok := m.followRequests[pair]; !ok {
+		m.followRequests[pair] = date.UTC().Truncate(time.Second)
+	}
+
+	return nil
+}
+
+func (m *memdb) DeleteFollowRequest(ctx context.Context, dbUser DatabaseUser, followedDbUser DatabaseUser) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	pair := memPair{dbUser.Id, followedDbUser.Id}
+
+	if _, ok := m.followRequests[pair]; !ok {
+		return ErrFollowRequestDoesNotExist
+	}
+
+	delete(m.followRequests, pair)
+
+	return nil
+}
+
+func (m *memdb) ApproveFollowRequest(ctx context.Context, dbUser DatabaseUser, requesterDbUser DatabaseUser) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.followRequests[memPair{requesterDbUser.Id, dbUser.Id}]; !ok {
+		return ErrFollowRequestDoesNotExist
+	}
+
+	m.follow(requesterDbUser.Id, dbUser.Id)
+
+	return nil
+}
+
+func (m *memdb) GetFollowRequests(ctx context.Context, dbUser DatabaseUser) (DatabaseUserList, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.userList(m.followRequesters(dbUser.Id)), nil
+}
+
+func (m *memdb) CheckFollowRequest(ctx context.Context, dbUser DatabaseUser, followedDbUser DatabaseUser) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, ok := m.followRequests[memPair{dbUser.Id, followedDbUser.Id}]
+
+	return ok, nil
+}
+
+// followRequesters returns the active users who requested to follow the user `userId`, from the oldest request,
+// without the users they banned
+func (m *memdb) followRequesters(userId uint32) []uint32 {
+	ids := make([]uint32, 0)
+
+	for pair := range m.followRequests {
+		if pair.second == userId && m.active(pair.first) && !m.bans[memPair{userId, pair.first}] {
+			ids = append(ids, pair.first)
+		}
+	}
+
+	sort.Slice(ids, func(i, j int) bool {
+		first, second := m.followRequests[memPair{ids[i], userId}], m.followRequests[memPair{ids[j], userId}]
+
+		if !first.Equal(second) {
+			return first.Before(second)
+		}
+
+		return ids[i] < ids[j]
+	})
+
+	return ids
+}
+
+// Photo
+
+func (m *memdb) GetDatabasePhoto(ctx context.Context, photoId uint32, dbUser DatabaseUser) (DatabasePhoto, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.photo(photoId, dbUser.Id)
+}
+
+func (m *memdb) InsertPhoto(ctx context.Context, dbPhoto *DatabasePhoto) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.users[dbPhoto.User.Id] == nil {
+		return ErrUserDoesNotExist
+	}
+
+	m.lastPhotoId++
+
+	dbPhoto.Id = m.lastPhotoId
+
+	photo := &memPhoto{
+		id:           dbPhoto.Id,
+		user:         dbPhoto.User.Id,
+		url:          dbPhoto.Url,
+		date:         dbPhoto.Date.UTC().Truncate(time.Second),
+		closeFriends: dbPhoto.CloseFriends,
+		flagged:      dbPhoto.Flagged,
+		scheduled:    dbPhoto.Scheduled,
+		mediaType:    dbPhoto.MediaType,
+		posterUrl:    dbPhoto.PosterUrl,
+		duration:     dbPhoto.Duration.Truncate(time.Millisecond),
+		altText:      dbPhoto.AltText,
+	}
+
+	if dbPhoto.Hash != nil {
+		hash := *dbPhoto.Hash
+		photo.hash = &hash
+	}
+
+	if dbPhoto.Latitude != nil && dbPhoto.Longitude != nil {
+		latitude, longitude := *dbPhoto.Latitude, *dbPhoto.Longitude
+		photo.latitude, photo.longitude = &latitude, &longitude
+	}
+
+	photo.place, _ = NormalizePlace(dbPhoto.Place)
+
+	m.photos[dbPhoto.Id] = photo
+
+	return nil
+}
+
+func (m *memdb) GetSimilarPhoto(ctx context.Context, dbUser DatabaseUser, hash uint64, distance int) (DatabasePhoto, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	dbPhoto := DatabasePhotoDefault()
+
+	best := distance + 1
+
+	for _, photo := range m.photos {
+		if photo.user != dbUser.Id || photo.hash == nil {
+			continue
+		}
+
+		if d := bits.OnesCount64(*photo.hash ^ hash); d < best || (d == best && photo.id < dbPhoto.Id) {
+			best = d
+
+			dbPhoto = DatabasePhotoDefault()
+			dbPhoto.Id = photo.id
+			dbPhoto.User = dbUser
+			dbPhoto.Url = photo.url
+			dbPhoto.Date = photo.date
+			dbPhoto.Hash = photo.hash
+		}
+	}
+
+	if best > distance {
+		return dbPhoto, ErrPhotoDoesNotExist
+	}
+
+	return dbPhoto, nil
+}
+
+func (m *memdb) DeletePhoto(ctx context.Context, dbPhoto DatabasePhoto) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.photos[dbPhoto.Id] == nil {
+		return ErrPhotoDoesNotExist
+	}
+
+	m.deletePhoto(dbPhoto.Id)
+
+	m.insertAudit(dbPhoto.User.Id, AuditDeletePhoto, dbPhoto.Id, "")
+
+	return nil
+}
+
+func (m *memdb) IsUrlUsed(ctx context.Context, url string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, photo := range m.photos {
+		if photo.url == url || photo.originalUrl == url || photo.posterUrl == url {
+			return true, nil
+		}
+	}
+
+	for _, story := range m.stories {
+		if story.url == url {
+			return true, nil
+		}
+	}
+
+	for _, user := range m.users {
+		if user.avatar == url {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (m *memdb) GetPhotoLikeCount(ctx context.Context, dbPhoto *DatabasePhoto, dbUser DatabaseUser) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.photos[dbPhoto.Id] == nil {
+		return ErrPhotoDoesNotExist
+	}
+
+	dbPhoto.LikeCount = m.likeCount(dbPhoto.Id, dbUser.Id)
+
+	return nil
+}
+
+func (m *memdb) GetPhotoCommentCount(ctx context.Context, dbPhoto *DatabasePhoto, dbUser DatabaseUser) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.photos[dbPhoto.Id] == nil {
+		return ErrPhotoDoesNotExist
+	}
+
+	dbPhoto.CommentCount = m.commentCount(dbPhoto.Id, dbUser.Id)
+
+	return nil
+}
+
+func (m *memdb) GetPhotoLikeStatus(ctx context.Context, dbPhoto *DatabasePhoto, dbUser DatabaseUser) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	dbPhoto.Reaction = m.likes[memPair{dbUser.Id, dbPhoto.Id}]
+	dbPhoto.LikeStatus = dbPhoto.Reaction != ""
+
+	return nil
+}
+
+func (m *memdb) GetPhotoStats(ctx context.Context, dbPhoto *DatabasePhoto, dbUser DatabaseUser) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.photos[dbPhoto.Id] == nil {
+		return ErrPhotoDoesNotExist
+	}
+
+	dbPhoto.LikeCount = m.likeCount(dbPhoto.Id, dbUser.Id)
+	dbPhoto.CommentCount = m.commentCount(dbPhoto.Id, dbUser.Id)
+	dbPhoto.Reaction = m.likes[memPair{dbUser.Id, dbPhoto.Id}]
+	dbPhoto.LikeStatus = dbPhoto.Reaction != ""
+	dbPhoto.Reactions = m.reactions(dbPhoto.Id, dbUser.Id)
+
+	return nil
+}
+
+func (m *memdb) GetPhotos(ctx context.Context, dbProfile *DatabaseProfile, dbUser DatabaseUser, archived bool, limit int, before uint32) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	photos := make([]*memPhoto, 0)
+	pinned := make([]*memPhoto, 0)
+
+	for _, photo := range m.photos {
+		if photo.user != dbProfile.User.Id || photo.archived != archived || !m.visiblePhoto(photo, dbUser.Id) {
+			continue
+		}
+
+		if photo.pinnedAt != nil {
+			pinned = append(pinned, photo)
+		} else {
+			photos = append(photos, photo)
+		}
+	}
+
+	// the first page of the photos which are not archived
+	// starts with the pinned ones, from the last pinned
+	if !archived && before == 0 {
+		sort.Slice(pinned, func(i, j int) bool {
+			return newer(*pinned[i].pinnedAt, pinned[i].id, *pinned[j].pinnedAt, pinned[j].id)
+		})
+
+		for _, photo := range pinned {
+			dbPhoto, err := m.photo(photo.id, dbUser.Id)
+
+			if err != nil {
+				return err
+			}
+
+			dbProfile.Photos = append(dbProfile.Photos, dbPhoto)
+		}
+	}
+
+	dbPhotos := make([]DatabasePhoto, 0)
+
+	// one more photo is kept to know whether there is a next page
+	page := m.newestFirst(photos, before, 0, limit+1)
+
+	for _, photo := range page {
+		dbPhoto, err := m.photo(photo.id, dbUser.Id)
+
+		if err != nil {
+			return err
+		}
+
+		dbPhotos = append(dbPhotos, dbPhoto)
+	}
+
+	// if there is a next page, its cursor
+	// is the last photo of the current one
+	if len(dbPhotos) > limit {
+		dbPhotos = dbPhotos[:limit]
+		dbProfile.NextCursor = dbPhotos[limit-1].Id
+	}
+
+	dbProfile.Photos = append(dbProfile.Photos, dbPhotos...)
+
+	return nil
+}
+
+func (m *memdb) GetPhotoCount(ctx context.Context, profileDbUser DatabaseUser, dbUser DatabaseUser) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	photoCount := 0
+
+	for _, photo := range m.photos {
+		if photo.user == profileDbUser.Id && !photo.archived && m.visiblePhoto(photo, dbUser.Id) {
+			photoCount++
+		}
+	}
+
+	return photoCount, nil
+}
+
+func (m *memdb) ArchivePhoto(ctx context.Context, dbPhoto DatabasePhoto) error {
+	return m.setPhotoArchived(dbPhoto.Id, true)
+}
+
+func (m *memdb) UnarchivePhoto(ctx context.Context, dbPhoto DatabasePhoto) error {
+	return m.setPhotoArchived(dbPhoto.Id, false)
+}
+
+func (m *memdb) SetPhotoAltText(ctx context.Context, dbPhoto DatabasePhoto, altText string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	photo := m.photos[dbPhoto.Id]
+
+	if photo == nil {
+		return ErrPhotoDoesNotExist
+	}
+
+	photo.altText = altText
+
+	return nil
+}
+
+func (m *memdb) EditPhoto(ctx context.Context, dbPhoto DatabasePhoto, url string, originalUrl string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	photo := m.photos[dbPhoto.Id]
+
+	if photo == nil {
+		return "", ErrPhotoDoesNotExist
+	}
+
+	replaced := photo.url
+
+	photo.url = url
+	photo.originalUrl = originalUrl
+
+	return replaced, nil
+}
+
+func (m *memdb) PublishScheduledPhotos(ctx context.Context, now time.Time) ([]DatabasePhoto, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ids := make([]uint32, 0)
+
+	for id, photo := range m.photos {
+		if photo.scheduled && !photo.date.After(now) {
+			ids = append(ids, id)
+		}
+	}
+
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i] < ids[j]
+	})
+
+	dbPhotos := make([]DatabasePhoto, 0, len(ids))
+
+	for _, id := range ids {
+		photo := m.photos[id]
+		photo.scheduled = false
+
+		dbPhoto := DatabasePhotoDefault()
+		dbPhoto.Id = photo.id
+		dbPhoto.User.Id = photo.user
+		dbPhoto.Date = photo.date
+		dbPhoto.Flagged = photo.flagged
+
+		dbPhotos = append(dbPhotos, dbPhoto)
+	}
+
+	return dbPhotos, nil
+}
+
+func (m *memdb) setPhotoArchived(photoId uint32, archived bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	photo := m.photos[photoId]
+
+	if photo == nil {
+		return ErrPhotoDoesNotExist
+	}
+
+	photo.archived = archived
+
+	// an archived photo is no longer pinned
+	if archived {
+		photo.pinnedAt = nil
+	}
+
+	return nil
+}
+
+func (m *memdb) PinPhoto(ctx context.Context, dbPhoto DatabasePhoto, maxPinned int, date time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	photo := m.photos[dbPhoto.Id]
+
+	if photo == nil {
+		return ErrPhotoDoesNotExist
+	}
+
+	// a photo pinned again keeps its place
+	if photo.pinnedAt != nil {
+		return nil
+	}
+
+	count := 0
+
+	for _, other := range m.photos {
+		if other.user == photo.user && other.pinnedAt != nil {
+			count++
+		}
+	}
+
+	if count >= maxPinned {
+		return ErrTooManyPinnedPhotos
+	}
+
+	pinnedAt := date.UTC().Truncate(time.Second)
+
+	photo.pinnedAt = &pinnedAt
+
+	return nil
+}
+
+func (m *memdb) UnpinPhoto(ctx context.Context, dbPhoto DatabasePhoto) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	photo := m.photos[dbPhoto.Id]
+
+	if photo == nil {
+		return ErrPhotoDoesNotExist
+	}
+
+	photo.pinnedAt = nil
+
+	return nil
+}
+
+func (m *memdb) RebuildPhotoCounters(ctx context.Context) error {
+	// the counters are always computed from the likes and the comments
+	return nil
+}
+
+// photo builds the photo `photoId` as seen by the user `viewerId`
+func (m *memdb) photo(photoId uint32, viewerId uint32) (DatabasePhoto, error) {
+	photo := m.photos[photoId]
+
+	// an archived, flagged or scheduled photo is only visible to its owner,
+	// and a photo for the close friends to them and to its owner
+	if photo == nil || (photo.archived && photo.user != viewerId) || !m.visiblePhoto(photo, viewerId) {
+		return DatabasePhotoDefault(), ErrPhotoDoesNotExist
+	}
+
+	dbPhoto := DatabasePhotoDefault()
+
+	dbPhoto.Id = photo.id
+	dbPhoto.User = m.user(photo.user)
+	dbPhoto.Url = photo.url
+	dbPhoto.Date = photo.date
+	dbPhoto.Archived = photo.archived
+	dbPhoto.Latitude = photo.latitude
+	dbPhoto.Longitude = photo.longitude
+	dbPhoto.Place = photo.place
+	dbPhoto.Pinned = photo.pinnedAt != nil
+	dbPhoto.CloseFriends = photo.closeFriends
+	dbPhoto.Flagged = photo.flagged
+	dbPhoto.Scheduled = photo.scheduled
+	dbPhoto.MediaType = photo.mediaType
+	dbPhoto.PosterUrl = photo.posterUrl
+	dbPhoto.Duration = photo.duration
+	dbPhoto.AltText = photo.altText
+
+	// the original of an edited photo is only given to its owner
+	if photo.user == viewerId {
+		dbPhoto.OriginalUrl = photo.originalUrl
+	}
+	dbPhoto.LikeCount = m.likeCount(photo.id, viewerId)
+	dbPhoto.CommentCount = m.commentCount(photo.id, viewerId)
+	dbPhoto.Reaction = m.likes[memPair{viewerId, photo.id}]
+	dbPhoto.LikeStatus = dbPhoto.Reaction != ""
+	dbPhoto.Reactions = m.reactions(photo.id, viewerId)
+
+	// the owner of the photo hid how many users liked it
+	if owner := m.users[photo.user]; photo.user != viewerId && owner != nil && owner.hideLikeCounts {
+		dbPhoto.LikesHidden = true
+		dbPhoto.LikeCount = 0
+		dbPhoto.Reactions = make(map[string]int)
+	}
+
+	return dbPhoto, nil
+}
+
+// likeCount returns the likes to the photo `photoId`
+// without the likes of users who banned the user `viewerId`
+func (m *memdb) likeCount(photoId uint32, viewerId uint32) int {
+	likeCount := 0
+
+	for like := range m.likes {
+		if like.second == photoId && !m.bans[memPair{like.first, viewerId}] {
+			likeCount++
+		}
+	}
+
+	return likeCount
+}
+
+// reactions counts the reactions to the photo `photoId` of each type
+// without the reactions of users who banned the user `viewerId`
+func (m *memdb) reactions(photoId uint32, viewerId uint32) map[string]int {
+	reactions := make(map[string]int)
+
+	for like, reaction := range m.likes {
+		if like.second == photoId && !m.bans[memPair{like.first, viewerId}] {
+			reactions[reaction]++
+		}
+	}
+
+	return reactions
+}
+
+// commentCount returns the comments under the photo `photoId`
+// without the comments of users who banned the user `viewerId`
+// and the comments of shadow banned users
+func (m *memdb) commentCount(photoId uint32, viewerId uint32) int {
+	commentCount := 0
+
+	for _, comment := range m.comments {
+		if comment.photo == photoId && !m.bans[memPair{comment.user, viewerId}] && !m.shadowHidden(comment.user, viewerId) {
+			commentCount++
+		}
+	}
+
+	return commentCount
+}
+
+// deletePhoto removes the photo `photoId` together with its likes and comments
+func (m *memdb) deletePhoto(photoId uint32) {
+	for like := range m.likes {
+		if like.second == photoId {
+			delete(m.likes, like)
+			delete(m.likeDates, like)
+		}
+	}
+
+	for id, comment := range m.comments {
+		if comment.photo == photoId {
+			m.deleteComment(id)
+		}
+	}
+
+	for id, notification := range m.notifications {
+		if notification.photo == photoId {
+			delete(m.notifications, id)
+		}
+	}
+
+	for id, held := range m.heldComments {
+		if held.photo == photoId {
+			delete(m.heldComments, id)
+		}
+	}
+
+	for _, album := range m.albums {
+		photos := album.photos[:0]
+
+		for _, id := range album.photos {
+			if id != photoId {
+				photos = append(photos, id)
+			}
+		}
+
+		album.photos = photos
+	}
+
+	delete(m.photos, photoId)
+}
+
+// newestFirst sorts the photos from the newest to the oldest and returns at most `limit` of them, keeping only the
+// photos older than the photo `before` and newer than the photo `after` (each cursor is ignored if it is 0)
+func (m *memdb) newestFirst(photos []*memPhoto, before uint32, after uint32, limit int) []*memPhoto {
+	sort.Slice(photos, func(i, j int) bool {
+		return newer(photos[i].date, photos[i].id, photos[j].date, photos[j].id)
+	})
+
+	page := make([]*memPhoto, 0)
+
+	for _, photo := range photos {
+		if len(page) == limit {
+			break
+		}
+
+		if before != 0 {
+			cursor := m.photos[before]
+
+			if cursor == nil || !newer(cursor.date, cursor.id, photo.date, photo.id) {
+				continue
+			}
+		}
+
+		if after != 0 {
+			cursor := m.photos[after]
+
+			if cursor == nil || !newer(photo.date, photo.id, cursor.date, cursor.id) {
+				continue
+			}
+		}
+
+		page = append(page, photo)
+	}
+
+	return page
+}
+
+// newer reports whether (firstDate, firstId) comes after (secondDate, secondId)
+func newer(firstDate time.Time, firstId uint32, secondDate time.Time, secondId uint32) bool {
+	if !firstDate.Equal(secondDate) {
+		return firstDate.After(secondDate)
+	}
+
+	return firstId > secondId
+}
+
+// Like
+
+func (m *memdb) InsertLike(ctx context.Context, dbUser DatabaseUser, dbPhoto DatabasePhoto, reaction string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.users[dbUser.Id] == nil {
+		return ErrUserDoesNotExist
+	}
+
+	if m.photos[dbPhoto.Id] == nil {
+		return ErrPhotoDoesNotExist
+	}
+
+	like := memPair{dbUser.Id, dbPhoto.Id}
+
+	if m.likes[like] == "" {
+		m.notify(m.photos[dbPhoto.Id].user, dbUser.Id, NotificationLike, dbPhoto.Id, 0)
+		m.likeDates[like] = globaltime.Now().UTC().Truncate(time.Second)
+	}
+
+	m.likes[like] = reaction
+
+	return nil
+}
+
+func (m *memdb) DeleteLike(ctx context.Context, dbUser DatabaseUser, dbPhoto DatabasePhoto) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	like := memPair{dbUser.Id, dbPhoto.Id}
+
+	if m.likes[like] == "" {
+		return ErrPhotoNotLiked
+	}
+
+	delete(m.likes, like)
+	delete(m.likeDates, like)
+
+	m.unnotify(dbUser.Id, NotificationLike, 0, dbPhoto.Id)
+
+	return nil
+}
+
+func (m *memdb) GetLikeList(ctx context.Context, dbPhoto DatabasePhoto, dbUser DatabaseUser, limit int, after uint32) (DatabaseLikeList, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	dbLikeList := DatabaseLikeListDefault()
+
+	if m.photos[dbPhoto.Id] == nil {
+		return dbLikeList, ErrPhotoDoesNotExist
+	}
+
+	dbLikeList.Total = m.likeCount(dbPhoto.Id, dbUser.Id)
+
+	ids := make([]uint32, 0)
+
+	for like := range m.likes {
+		if like.second == dbPhoto.Id && like.first > after && !m.bans[memPair{like.first, dbUser.Id}] {
+			ids = append(ids, like.first)
+		}
+	}
+
+	// the list is sorted by id, hence the page is its beginning
+	dbUserList := m.userList(ids)
+
+	if len(dbUserList.Users) > limit {
+		dbUserList.Users = dbUserList.Users[:limit]
+	}
+
+	dbLikeList.Users = dbUserList.Users
+
+	return dbLikeList, nil
+}
+
+func (m *memdb) GetPhotosLikes(ctx context.Context, photoIds []uint32, dbUser DatabaseUser, limit int, after uint32) (map[uint32][]DatabaseUser, error) {
+	dbUsers := make(map[uint32][]DatabaseUser)
+
+	for _, photoId := range photoIds {
+		dbLikeList, err := m.GetLikeList(ctx, DatabasePhoto{Id: photoId}, dbUser, limit, after)
+
+		if errors.Is(err, ErrPhotoDoesNotExist) {
+			continue
+		}
+
+		if err != nil {
+			return dbUsers, err
+		}
+
+		if len(dbLikeList.Users) > 0 {
+			dbUsers[photoId] = dbLikeList.Users
+		}
+	}
+
+	return dbUsers, nil
+}
+
+func (m *memdb) GetReactionList(ctx context.Context, dbPhoto DatabasePhoto, dbUser DatabaseUser, reaction string, limit int, after uint32) (DatabaseReactionList, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	dbReactionList := DatabaseReactionListDefault()
+
+	if m.photos[dbPhoto.Id] == nil {
+		return dbReactionList, ErrPhotoDoesNotExist
+	}
+
+	dbReactionList.Total = m.reactions(dbPhoto.Id, dbUser.Id)[reaction]
+
+	if reaction == "" {
+		dbReactionList.Total = m.likeCount(dbPhoto.Id, dbUser.Id)
+	}
+
+	ids := make([]uint32, 0)
+
+	for like, likeReaction := range m.likes {
+		if like.second != dbPhoto.Id || (reaction != "" && likeReaction != reaction) {
+			continue
+		}
+
+		if like.first > after && !m.bans[memPair{like.first, dbUser.Id}] {
+			ids = append(ids, like.first)
+		}
+	}
+
+	// the list is sorted by id, hence the page is its beginning
+	for _, dbReactionUser := range m.userList(ids).Users {
+		if len(dbReactionList.Reactions) == limit {
+			break
+		}
+
+		dbReactionList.Reactions = append(dbReactionList.Reactions, DatabaseReaction{
+			User: dbReactionUser,
+			Type: m.likes[memPair{dbReactionUser.Id, dbPhoto.Id}],
+		})
+	}
+
+	return dbReactionList, nil
+}
+
+// Comment
+
+func (m *memdb) GetDatabaseComment(ctx context.Context, commentId uint32, dbUser DatabaseUser) (DatabaseComment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	dbComment := DatabaseCommentDefault()
+
+	comment := m.comments[commentId]
+
+	if comment == nil {
+		return dbComment, ErrCommentDoesNotExist
+	}
+
+	dbPhoto, err := m.photo(comment.photo, dbUser.Id)
+
+	if err != nil {
+		return dbComment, err
+	}
+
+	dbComment.Id = comment.id
+	dbComment.User = m.user(comment.user)
+	dbComment.Photo = dbPhoto
+	dbComment.Date = comment.date
+	dbComment.CommentBody = comment.body
+
+	return dbComment, nil
+}
+
+func (m *memdb) InsertComment(ctx context.Context, dbComment *DatabaseComment) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.users[dbComment.User.Id] == nil {
+		return ErrUserDoesNotExist
+	}
+
+	if m.photos[dbComment.Photo.Id] == nil {
+		return ErrPhotoDoesNotExist
+	}
+
+	m.insertComment(dbComment)
+
+	return nil
+}
+
+// insertComment inserts the comment, setting its id, with its mentions and its notifications
+func (m *memdb) insertComment(dbComment *DatabaseComment) {
+	mentions := m.addComment(dbComment)
+
+	m.notify(m.photos[dbComment.Photo.Id].user, dbComment.User.Id, NotificationComment, dbComment.Photo.Id, dbComment.Id)
+
+	for _, userId := range mentions {
+		m.notify(userId, dbComment.User.Id, NotificationMention, dbComment.Photo.Id, dbComment.Id)
+	}
+}
+
+// addComment adds the comment, setting its id, with its mentions, which it returns
+func (m *memdb) addComment(dbComment *DatabaseComment) []uint32 {
+	m.lastCommentId++
+
+	dbComment.Id = m.lastCommentId
+
+	// the mentions of users who do not exist, are deactivated,
+	// banned the author of the comment or do not let them
+	// mention them are ignored
+	mentions := make([]uint32, 0)
+
+	for _, username := range ParseMentions(dbComment.CommentBody) {
+		user := m.userFromUsername(username)
+
+		if user == nil || user.deactivatedAt != nil || user.id == dbComment.User.Id || m.bans[memPair{user.id, dbComment.User.Id}] {
+			continue
+		}
+
+		if user.mentionPolicy == PolicyNobody || (user.mentionPolicy == PolicyFollowers && !m.follows[memPair{dbComment.User.Id, user.id}]) {
+			continue
+		}
+
+		mentions = append(mentions, user.id)
+	}
+
+	m.comments[dbComment.Id] = &memComment{
+		id:       dbComment.Id,
+		user:     dbComment.User.Id,
+		photo:    dbComment.Photo.Id,
+		date:     dbComment.Date.UTC().Truncate(time.Second),
+		body:     dbComment.CommentBody,
+		mentions: mentions,
+	}
+
+	return mentions
+}
+
+func (m *memdb) DeleteComment(ctx context.Context, dbComment DatabaseComment) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	comment := m.comments[dbComment.Id]
+
+	if comment == nil {
+		return ErrPhotoNotCommented
+	}
+
+	m.deleteComment(dbComment.Id)
+
+	m.insertAudit(comment.user, AuditDeleteComment, comment.id, comment.body)
+
+	return nil
+}
+
+func (m *memdb) GetCommentList(ctx context.Context, dbPhoto DatabasePhoto, dbUser DatabaseUser, commentSort string, limit int, after uint32) (DatabaseCommentList, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	dbCommentList := DatabaseCommentListDefault()
+
+	comments := make([]*memComment, 0)
+
+	for _, comment := range m.comments {
+		if comment.photo == dbPhoto.Id && !m.bans[memPair{comment.user, dbUser.Id}] && !m.shadowHidden(comment.user, dbUser.Id) {
+			comments = append(comments, comment)
+		}
+	}
+
+	newest := commentSort == CommentSortNewest
+
+	// the comments go from the oldest to the newest,
+	// unless they are sorted from the newest
+	following := func(first *memComment, second *memComment) bool {
+		if newest {
+			return newer(second.date, second.id, first.date, first.id)
+		}
+
+		return newer(first.date, first.id, second.date, second.id)
+	}
+
+	sort.Slice(comments, func(i, j int) bool {
+		return following(comments[j], comments[i])
+	})
+
+	for _, comment := range comments {
+		if len(dbCommentList.Comments) == limit {
+			break
+		}
+
+		if after != 0 {
+			cursor := m.comments[after]
+
+			if cursor == nil || !following(comment, cursor) {
+				continue
+			}
+		}
+
+		dbCommentPhoto, err := m.photo(comment.photo, dbUser.Id)
+
+		if err != nil {
+			return dbCommentList, err
+		}
+
+		dbComment := DatabaseCommentDefault()
+
+		dbComment.Id = comment.id
+		dbComment.User = m.user(comment.user)
+		dbComment.Photo = dbCommentPhoto
+		dbComment.Date = comment.date
+		dbComment.CommentBody = comment.body
+
+		dbCommentList.Comments = append(dbCommentList.Comments, dbComment)
+	}
+
+	return dbCommentList, nil
+}
+
+func (m *memdb) GetPhotosComments(ctx context.Context, photoIds []uint32, dbUser DatabaseUser, limit int, after uint32) (map[uint32][]DatabaseComment, error) {
+	dbComments := make(map[uint32][]DatabaseComment)
+
+	for _, photoId := range photoIds {
+		dbCommentList, err := m.GetCommentList(ctx, DatabasePhoto{Id: photoId}, dbUser, CommentSortOldest, limit, after)
+
+		if err != nil {
+			return dbComments, err
+		}
+
+		if len(dbCommentList.Comments) > 0 {
+			dbComments[photoId] = dbCommentList.Comments
+		}
+	}
+
+	return dbComments, nil
+}
+
+func (m *memdb) SearchComments(ctx context.Context, dbUser DatabaseUser, text string, limit int, before uint32) (DatabaseCommentList, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	dbCommentList := DatabaseCommentListDefault()
+
+	words := strings.Fields(strings.ToLower(text))
+
+	if len(words) == 0 {
+		return dbCommentList, nil
+	}
+
+	comments := make([]*memComment, 0)
+
+	for _, comment := range m.comments {
+		photo := m.photos[comment.photo]
+
+		if m.bans[memPair{comment.user, dbUser.Id}] || m.bans[memPair{photo.user, dbUser.Id}] || m.shadowHidden(comment.user, dbUser.Id) {
+			continue
+		}
+
+		if (photo.archived && photo.user != dbUser.Id) || !m.visiblePhoto(photo, dbUser.Id) {
+			continue
+		}
+
+		// every word of the text must be in the body
+		body := strings.ToLower(comment.body)
+		matches := true
+
+		for _, word := range words {
+			matches = matches && strings.Contains(body, word)
+		}
+
+		if matches {
+			comments = append(comments, comment)
+		}
+	}
+
+	// the comments go from the newest to the oldest
+	sort.Slice(comments, func(i, j int) bool {
+		return newer(comments[i].date, comments[i].id, comments[j].date, comments[j].id)
+	})
+
+	for _, comment := range comments {
+		if len(dbCommentList.Comments) == limit {
+			break
+		}
+
+		if before != 0 {
+			cursor := m.comments[before]
+
+			if cursor == nil || !newer(cursor.date, cursor.id, comment.date, comment.id) {
+				continue
+			}
+		}
+
+		dbCommentPhoto, err := m.photo(comment.photo, dbUser.Id)
+
+		if err != nil {
+			return dbCommentList, err
+		}
+
+		dbComment := DatabaseCommentDefault()
+
+		dbComment.Id = comment.id
+		dbComment.User = m.user(comment.user)
+		dbComment.Photo = dbCommentPhoto
+		dbComment.Date = comment.date
+		dbComment.CommentBody = comment.body
+
+		dbCommentList.Comments = append(dbCommentList.Comments, dbComment)
+	}
+
+	return dbCommentList, nil
+}
+
+func (m *memdb) GetCommentActivity(ctx context.Context, dbUser DatabaseUser, body string, duplicatesSince time.Time, recentSince time.Time) (DatabaseCommentActivity, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	dbActivity := DatabaseCommentActivityDefault()
+
+	count := func(date time.Time, commentBody string) {
+		if commentBody == body && !date.Before(duplicatesSince) {
+			dbActivity.Duplicates++
+
+			if date.After(dbActivity.LastDuplicate) {
+				dbActivity.LastDuplicate = date
+			}
+		}
+
+		if !date.Before(recentSince) {
+			dbActivity.Recent++
+
+			if dbActivity.Recent == 1 || date.Before(dbActivity.FirstRecent) {
+				dbActivity.FirstRecent = date
+			}
+		}
+	}
+
+	// the comments held back for a review count as well
+	for _, comment := range m.comments {
+		if comment.user == dbUser.Id {
+			count(comment.date, comment.body)
+		}
+	}
+
+	for _, held := range m.heldComments {
+		if held.user == dbUser.Id {
+			count(held.date, held.body)
+		}
+	}
+
+	return dbActivity, nil
+}
+
+// Mention
+
+func (m *memdb) GetMentions(ctx context.Context, dbUser DatabaseUser, limit int, before uint32) (DatabaseCommentList, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	dbCommentList := DatabaseCommentListDefault()
+
+	comments := make([]*memComment, 0)
+
+	for _, comment := range m.comments {
+		photo := m.photos[comment.photo]
+
+		if m.bans[memPair{comment.user, dbUser.Id}] || m.bans[memPair{dbUser.Id, comment.user}] || m.bans[memPair{photo.user, dbUser.Id}] {
+			continue
+		}
+
+		if m.shadowHidden(comment.user, dbUser.Id) {
+			continue
+		}
+
+		if (photo.archived && photo.user != dbUser.Id) || !m.visiblePhoto(photo, dbUser.Id) {
+			continue
+		}
+
+		for _, userId := range comment.mentions {
+			if userId == dbUser.Id {
+				comments = append(comments, comment)
+				break
+			}
+		}
+	}
+
+	// the comments go from the newest to the oldest
+	sort.Slice(comments, func(i, j int) bool {
+		return newer(comments[i].date, comments[i].id, comments[j].date, comments[j].id)
+	})
+
+	for _, comment := range comments {
+		if len(dbCommentList.Comments) == limit {
+			break
+		}
+
+		if before != 0 {
+			cursor := m.comments[before]
+
+			if cursor == nil || !newer(cursor.date, cursor.id, comment.date, comment.id) {
+				continue
+			}
+		}
+
+		dbCommentPhoto, err := m.photo(comment.photo, dbUser.Id)
+
+		if err != nil {
+			return dbCommentList, err
+		}
+
+		dbComment := DatabaseCommentDefault()
+
+		dbComment.Id = comment.id
+		dbComment.User = m.user(comment.user)
+		dbComment.Photo = dbCommentPhoto
+		dbComment.Date = comment.date
+		dbComment.CommentBody = comment.body
+
+		dbCommentList.Comments = append(dbCommentList.Comments, dbComment)
+	}
+
+	return dbCommentList, nil
+}
+
+// Notification
+
+func (m *memdb) GetNotifications(ctx context.Context, dbUser DatabaseUser, unread bool, limit int, before uint32) (DatabaseNotificationList, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	dbNotificationList := DatabaseNotificationListDefault()
+
+	notifications := make([]*memNotification, 0)
+
+	for _, notification := range m.visibleNotifications(dbUser.Id) {
+		if !m.notificationEnabled(notification, ChannelInApp) {
+			continue
+		}
+
+		if !notification.read {
+			dbNotificationList.UnreadCount++
+		}
+
+		if unread && notification.read {
+			continue
+		}
+
+		if before != 0 {
+			cursor := m.notifications[before]
+
+			if cursor == nil || !newer(cursor.date, cursor.id, notification.date, notification.id) {
+				continue
+			}
+		}
+
+		notifications = append(notifications, notification)
+	}
+
+	// the notifications go from the newest to the oldest
+	sort.Slice(notifications, func(i, j int) bool {
+		return newer(notifications[i].date, notifications[i].id, notifications[j].date, notifications[j].id)
+	})
+
+	// if there is a next page, its cursor
+	// is the last notification of the current one
+	if len(notifications) > limit {
+		notifications = notifications[:limit]
+		dbNotificationList.NextCursor = notifications[limit-1].id
+	}
+
+	for _, notification := range notifications {
+		dbNotification, err := m.notification(notification, dbUser.Id)
+
+		if err != nil {
+			return dbNotificationList, err
+		}
+
+		dbNotificationList.Notifications = append(dbNotificationList.Notifications, dbNotification)
+	}
+
+	return dbNotificationList, nil
+}
+
+func (m *memdb) GetNotificationsAfter(ctx context.Context, dbUser DatabaseUser, after uint32, limit int) (DatabaseNotificationList, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	dbNotificationList := DatabaseNotificationListDefault()
+
+	notifications := make([]*memNotification, 0)
+
+	for _, notification := range m.visibleNotifications(dbUser.Id) {
+		if notification.id > after && m.notificationEnabled(notification, ChannelInApp) {
+			notifications = append(notifications, notification)
+		}
+	}
+
+	// the notifications go from the oldest to the newest
+	sort.Slice(notifications, func(i, j int) bool {
+		return notifications[i].id < notifications[j].id
+	})
+
+	// if there are more notifications, the
+	// cursor is the last one of the current page
+	if len(notifications) > limit {
+		notifications = notifications[:limit]
+		dbNotificationList.NextCursor = notifications[limit-1].id
+	}
+
+	for _, notification := range notifications {
+		dbNotification, err := m.notification(notification, dbUser.Id)
+
+		if err != nil {
+			return dbNotificationList, err
+		}
+
+		dbNotificationList.Notifications = append(dbNotificationList.Notifications, dbNotification)
+	}
+
+	return dbNotificationList, nil
+}
+
+func (m *memdb) GetUnreadNotificationCount(ctx context.Context, dbUser DatabaseUser) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	unreadCount := 0
+
+	for _, notification := range m.visibleNotifications(dbUser.Id) {
+		if !notification.read && m.notificationEnabled(notification, ChannelInApp) {
+			unreadCount++
+		}
+	}
+
+	return unreadCount, nil
+}
+
+func (m *memdb) MarkNotificationsRead(ctx context.Context, dbUser DatabaseUser, notificationIds []uint32) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, notificationId := range notificationIds {
+		if notification := m.notifications[notificationId]; notification != nil && notification.user == dbUser.Id {
+			notification.read = true
+		}
+	}
+
+	return nil
+}
+
+func (m *memdb) MarkAllNotificationsRead(ctx context.Context, dbUser DatabaseUser) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, notification := range m.notifications {
+		if notification.user == dbUser.Id {
+			notification.read = true
+		}
+	}
+
+	return nil
+}
+
+func (m *memdb) TakeNotificationsToPush(ctx context.Context, limit int) ([]DatabaseNotification, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	taken := make([]*memNotification, 0)
+
+	for _, notification := range m.notifications {
+		if !notification.pushed {
+			taken = append(taken, notification)
+		}
+	}
+
+	sort.Slice(taken, func(i, j int) bool {
+		return taken[i].id < taken[j].id
+	})
+
+	if len(taken) > limit {
+		taken = taken[:limit]
+	}
+
+	dbNotifications := make([]DatabaseNotification, 0)
+
+	for _, notification := range taken {
+		notification.pushed = true
+
+		// the notifications their users cannot see, or do
+		// not receive as push notifications, are never pushed
+		visible := false
+
+		for _, visibleNotification := range m.visibleNotifications(notification.user) {
+			visible = visible || visibleNotification == notification
+		}
+
+		if !visible || !m.notificationEnabled(notification, ChannelPush) {
+			continue
+		}
+
+		dbNotification, err := m.notification(notification, notification.user)
+
+		if err != nil {
+			return dbNotifications, err
+		}
+
+		dbNotifications = append(dbNotifications, dbNotification)
+	}
+
+	return dbNotifications, nil
+}
+
+// notification builds the notification as seen by the user `viewerId`, together with
+// the liked photo or with the comment it is about
+func (m *memdb) notification(notification *memNotification, viewerId uint32) (DatabaseNotification, error) {
+	dbNotification := DatabaseNotificationDefault()
+
+	dbNotification.Id = notification.id
+	dbNotification.User = m.user(notification.user)
+	dbNotification.Actor = m.user(notification.actor)
+	dbNotification.Type = notification.kind
+	dbNotification.Date = notification.date
+	dbNotification.Read = notification.read
+
+	switch {
+	case notification.comment != 0:
+		comment := m.comments[notification.comment]
+
+		dbCommentPhoto, err := m.photo(comment.photo, viewerId)
+
+		if err != nil {
+			return dbNotification, err
+		}
+
+		dbComment := DatabaseCommentDefault()
+
+		dbComment.Id = comment.id
+		dbComment.User = m.user(comment.user)
+		dbComment.Photo = dbCommentPhoto
+		dbComment.Date = comment.date
+		dbComment.CommentBody = comment.body
+
+		dbNotification.Comment = &dbComment
+	case notification.photo != 0:
+		dbPhoto, err := m.photo(notification.photo, viewerId)
+
+		if err != nil {
+			return dbNotification, err
+		}
+
+		dbNotification.Photo = &dbPhoto
+	}
+
+	return dbNotification, nil
+}
+
+// notify sends the notification of the given type from the user `actor` to the user `userId`,
+// unless they are the same user; `photoId` and `commentId` are 0 if it is not about them
+func (m *memdb) notify(userId uint32, actor uint32, kind string, photoId uint32, commentId uint32) {
+	if userId == actor {
+		return
+	}
+
+	m.lastNotificationId++
+
+	m.notifications[m.lastNotificationId] = &memNotification{
+		id:      m.lastNotificationId,
+		user:    userId,
+		actor:   actor,
+		kind:    kind,
+		photo:   photoId,
+		comment: commentId,
+		date:    globaltime.Now().UTC().Truncate(time.Second),
+	}
+}
+
+// unnotify removes the notifications of the given type sent by the user `actor` to the
+// user `userId` about the photo `photoId`, each id being ignored if it is 0
+func (m *memdb) unnotify(actor uint32, kind string, userId uint32, photoId uint32) {
+	for id, notification := range m.notifications {
+		if notification.actor != actor || notification.kind != kind {
+			continue
+		}
+
+		if (userId == 0 || notification.user == userId) && (photoId == 0 || notification.photo == photoId) {
+			delete(m.notifications, id)
+		}
+	}
+}
+
+// visibleNotifications returns the notifications of the user `userId` which they can still see,
+// leaving out the ones of deactivated or banned actors, the comments and the mentions of
+// shadow banned actors and the ones about hidden photos
+func (m *memdb) visibleNotifications(userId uint32) []*memNotification {
+	notifications := make([]*memNotification, 0)
+
+	for _, notification := range m.notifications {
+		if notification.user != userId || !m.active(notification.actor) {
+			continue
+		}
+
+		if m.bans[memPair{notification.actor, userId}] || m.bans[memPair{userId, notification.actor}] {
+			continue
+		}
+
+		if (notification.kind == NotificationComment || notification.kind == NotificationMention) && m.shadowHidden(notification.actor, userId) {
+			continue
+		}
+
+		if notification.photo != 0 {
+			photo := m.photos[notification.photo]
+
+			if (photo.archived && photo.user != userId) || !m.visiblePhoto(photo, userId) || m.bans[memPair{photo.user, userId}] {
+				continue
+			}
+		}
+
+		notifications = append(notifications, notification)
+	}
+
+	return notifications
+}
+
+// notificationEnabled reports whether the user of the notification receives its type on the channel
+func (m *memdb) notificationEnabled(notification *memNotification, channel string) bool {
+	preference := DatabaseNotificationPreferenceDefault()
+
+	if user := m.users[notification.user]; user != nil {
+		if p, ok := user.notificationPreferences[notification.kind]; ok {
+			preference = p
+		}
+	}
+
+	switch channel {
+	case ChannelInApp:
+		return preference.InApp
+	case ChannelPush:
+		return preference.Push
+	default:
+		return preference.Email
+	}
+}
+
+func (m *memdb) GetNotificationPreferences(ctx context.Context, dbUser DatabaseUser) (map[string]DatabaseNotificationPreference, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	preferences := make(map[string]DatabaseNotificationPreference)
+
+	for _, notificationType := range NotificationTypes {
+		preferences[notificationType] = DatabaseNotificationPreferenceDefault()
+	}
+
+	if user := m.users[dbUser.Id]; user != nil {
+		for notificationType, preference := range user.notificationPreferences {
+			preferences[notificationType] = preference
+		}
+	}
+
+	return preferences, nil
+}
+
+func (m *memdb) UpdateNotificationPreferences(ctx context.Context, dbUser DatabaseUser, preferences map[string]DatabaseNotificationPreference) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user := m.users[dbUser.Id]
+
+	if user == nil {
+		return ErrUserDoesNotExist
+	}
+
+	user.notificationPreferences = make(map[string]DatabaseNotificationPreference)
+
+	for _, notificationType := range NotificationTypes {
+		preference, ok := preferences[notificationType]
+
+		if !ok {
+			preference = DatabaseNotificationPreferenceDefault()
+		}
+
+		user.notificationPreferences[notificationType] = preference
+	}
+
+	return nil
+}
+
+// deleteComment removes the comment `commentId` together with its notifications
+func (m *memdb) deleteComment(commentId uint32) {
+	for id, notification := range m.notifications {
+		if notification.comment == commentId {
+			delete(m.notifications, id)
+		}
+	}
+
+	delete(m.comments, commentId)
+}
+
+// Device
+
+func (m *memdb) GetDatabaseDevice(ctx context.Context, deviceId uint32) (DatabaseDevice, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	device := m.devices[deviceId]
+
+	if device == nil {
+		return DatabaseDeviceDefault(), ErrDeviceDoesNotExist
+	}
+
+	return m.device(device), nil
+}
+
+func (m *memdb) InsertDevice(ctx context.Context, dbDevice *DatabaseDevice) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.users[dbDevice.User.Id] == nil {
+		return ErrUserDoesNotExist
+	}
+
+	// a token which is already registered passes to the user
+	for _, device := range m.devices {
+		if device.token == dbDevice.Token {
+			device.user = dbDevice.User.Id
+			device.platform = dbDevice.Platform
+			device.date = dbDevice.Date.UTC().Truncate(time.Second)
+
+			dbDevice.Id = device.id
+
+			return nil
+		}
+	}
+
+	m.lastDeviceId++
+
+	dbDevice.Id = m.lastDeviceId
+
+	m.devices[dbDevice.Id] = &memDevice{
+		id:       dbDevice.Id,
+		user:     dbDevice.User.Id,
+		platform: dbDevice.Platform,
+		token:    dbDevice.Token,
+		date:     dbDevice.Date.UTC().Truncate(time.Second),
+	}
+
+	return nil
+}
+
+func (m *memdb) DeleteDevice(ctx context.Context, dbDevice DatabaseDevice) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.devices[dbDevice.Id] == nil {
+		return ErrDeviceDoesNotExist
+	}
+
+	delete(m.devices, dbDevice.Id)
+
+	return nil
+}
+
+func (m *memdb) GetDevices(ctx context.Context, dbUser DatabaseUser) ([]DatabaseDevice, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	dbDevices := make([]DatabaseDevice, 0)
+
+	for _, device := range m.devices {
+		if device.user == dbUser.Id {
+			dbDevices = append(dbDevices, m.device(device))
+		}
+	}
+
+	sort.Slice(dbDevices, func(i, j int) bool {
+		return dbDevices[i].Id < dbDevices[j].Id
+	})
+
+	return dbDevices, nil
+}
+
+// device builds the device with the information of its user
+func (m *memdb) device(device *memDevice) DatabaseDevice {
+	dbDevice := DatabaseDeviceDefault()
+
+	dbDevice.Id = device.id
+	dbDevice.User = m.user(device.user)
+	dbDevice.Platform = device.platform
+	dbDevice.Token = device.token
+	dbDevice.Date = device.date
+
+	return dbDevice
+}
+
+// Session
+
+func (m *memdb) GetDatabaseSession(ctx context.Context, tokenHash string) (DatabaseSession, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	session := m.sessions[tokenHash]
+
+	if session == nil {
+		return DatabaseSessionDefault(), ErrSessionDoesNotExist
+	}
+
+	return m.session(tokenHash, session), nil
+}
+
+func (m *memdb) InsertSession(ctx context.Context, dbSession *DatabaseSession, dbRefreshToken *DatabaseRefreshToken) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.users[dbSession.User.Id] == nil {
+		return ErrUserDoesNotExist
+	}
+
+	// the expired sessions of the user are
+	// removed whenever they log in again
+	for tokenHash, session := range m.sessions {
+		if session.user == dbSession.User.Id && session.expiresAt.Unix() <= dbSession.CreatedAt.Unix() {
+			m.deleteSession(tokenHash)
+		}
+	}
+
+	m.lastSessionId++
+
+	dbSession.Id = m.lastSessionId
+
+	m.sessions[dbSession.TokenHash] = &memSession{
+		id:        dbSession.Id,
+		user:      dbSession.User.Id,
+		createdAt: dbSession.CreatedAt.UTC().Truncate(time.Second),
+		expiresAt: dbSession.ExpiresAt.UTC().Truncate(time.Second),
+		lastSeen:  dbSession.LastSeen.UTC().Truncate(time.Second),
+	}
+
+	// insert the first refresh token of the session
+	dbRefreshToken.Session = *dbSession
+
+	m.insertRefreshToken(dbRefreshToken)
+
+	return nil
+}
+
+func (m *memdb) TouchSession(ctx context.Context, dbSession DatabaseSession, date time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, session := range m.sessions {
+		if session.id == dbSession.Id {
+			session.lastSeen = date.UTC().Truncate(time.Second)
+
+			return nil
+		}
+	}
+
+	return ErrSessionDoesNotExist
+}
+
+func (m *memdb) DeleteSession(ctx context.Context, dbSession DatabaseSession) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for tokenHash, session := range m.sessions {
+		if session.id == dbSession.Id {
+			m.deleteSession(tokenHash)
+
+			return nil
+		}
+	}
+
+	return ErrSessionDoesNotExist
+}
+
+func (m *memdb) DeleteUserSessions(ctx context.Context, dbUser DatabaseUser) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for tokenHash, session := range m.sessions {
+		if session.user == dbUser.Id {
+			m.deleteSession(tokenHash)
+		}
+	}
+
+	return nil
+}
+
+func (m *memdb) GetDatabaseRefreshToken(ctx context.Context, tokenHash string) (DatabaseRefreshToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	dbRefreshToken := DatabaseRefreshTokenDefault()
+
+	refreshToken := m.refreshTokens[tokenHash]
+
+	if refreshToken == nil {
+		return dbRefreshToken, ErrRefreshTokenDoesNotExist
+	}
+
+	for sessionHash, session := range m.sessions {
+		if session.id == refreshToken.session {
+			dbRefreshToken.Session = m.session(sessionHash, session)
+		}
+	}
+
+	dbRefreshToken.Id = refreshToken.id
+	dbRefreshToken.TokenHash = tokenHash
+	dbRefreshToken.CreatedAt = refreshToken.createdAt
+	dbRefreshToken.ExpiresAt = refreshToken.expiresAt
+	dbRefreshToken.Used = refreshToken.used
+
+	return dbRefreshToken, nil
+}
+
+func (m *memdb) RotateRefreshToken(ctx context.Context, dbRefreshToken DatabaseRefreshToken, newDbRefreshToken *DatabaseRefreshToken, accessTokenHash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// the refresh token can be exchanged only once
+	var refreshToken *memRefreshToken
+
+	for _, token := range m.refreshTokens {
+		if token.id == dbRefreshToken.Id {
+			refreshToken = token
+		}
+	}
+
+	if refreshToken == nil || refreshToken.used {
+		return ErrRefreshTokenReused
+	}
+
+	for sessionHash, session := range m.sessions {
+		if session.id != dbRefreshToken.Session.Id {
+			continue
+		}
+
+		refreshToken.used = true
+
+		// the session now accepts only the new access
+		// token, and lasts as long as the new refresh token
+		delete(m.sessions, sessionHash)
+
+		m.sessions[accessTokenHash] = session
+
+		session.expiresAt = newDbRefreshToken.ExpiresAt.UTC().Truncate(time.Second)
+		session.lastSeen = newDbRefreshToken.CreatedAt.UTC().Truncate(time.Second)
+
+		// the expired refresh tokens of the session are removed
+		for tokenHash, token := range m.refreshTokens {
+			if token.session == session.id && token.expiresAt.Unix() <= newDbRefreshToken.CreatedAt.Unix() {
+				delete(m.refreshTokens, tokenHash)
+			}
+		}
+
+		newDbRefreshToken.Session = dbRefreshToken.Session
+
+		m.insertRefreshToken(newDbRefreshToken)
+
+		return nil
+	}
+
+	return ErrSessionDoesNotExist
+}
+
+// session builds the session of the access token `tokenHash` with the information of its user
+func (m *memdb) session(tokenHash string, session *memSession) DatabaseSession {
+	dbSession := DatabaseSessionDefault()
+
+	dbSession.Id = session.id
+	dbSession.User = m.user(session.user)
+	dbSession.TokenHash = tokenHash
+	dbSession.CreatedAt = session.createdAt
+	dbSession.ExpiresAt = session.expiresAt
+	dbSession.LastSeen = session.lastSeen
+
+	return dbSession
+}
+
+// insertRefreshToken inserts the refresh token, which is not used yet, and sets its id
+func (m *memdb) insertRefreshToken(dbRefreshToken *DatabaseRefreshToken) {
+	m.lastRefreshTokenId++
+
+	dbRefreshToken.Id = m.lastRefreshTokenId
+
+	m.refreshTokens[dbRefreshToken.TokenHash] = &memRefreshToken{
+		id:        dbRefreshToken.Id,
+		session:   dbRefreshToken.Session.Id,
+		createdAt: dbRefreshToken.CreatedAt.UTC().Truncate(time.Second),
+		expiresAt: dbRefreshToken.ExpiresAt.UTC().Truncate(time.Second),
+	}
+}
+
+// deleteSession removes the session of the access token `tokenHash` together with its refresh tokens
+func (m *memdb) deleteSession(tokenHash string) {
+	session := m.sessions[tokenHash]
+
+	for refreshHash, refreshToken := range m.refreshTokens {
+		if refreshToken.session == session.id {
+			delete(m.refreshTokens, refreshHash)
+		}
+	}
+
+	delete(m.sessions, tokenHash)
+}
+
+// Identity
+
+func (m *memdb) GetIdentityUser(ctx context.Context, provider string, subject string) (DatabaseUser, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	link := m.identities[memIdentity{provider, subject}]
+
+	if link == nil {
+		return DatabaseUserDefault(), ErrIdentityDoesNotExist
+	}
+
+	return m.user(link.user), nil
+}
+
+func (m *memdb) InsertIdentity(ctx context.Context, dbIdentity DatabaseIdentity) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.users[dbIdentity.User.Id] == nil {
+		return ErrUserDoesNotExist
+	}
+
+	identity := memIdentity{dbIdentity.Provider, dbIdentity.Subject}
+
+	// an identity linked again to the
+	// same user is left as it was
+	if link := m.identities[identity]; link != nil {
+		if link.user != dbIdentity.User.Id {
+			return ErrIdentityAlreadyLinked
+		}
+
+		return nil
+	}
+
+	m.identities[identity] = &memIdentityLink{
+		user: dbIdentity.User.Id,
+		date: dbIdentity.Date.UTC().Truncate(time.Second),
+	}
+
+	return nil
+}
+
+func (m *memdb) InsertIdentityUser(ctx context.Context, dbUser *DatabaseUser, dbIdentity DatabaseIdentity) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// the identity never takes over an existing user
+	if m.userFromUsername(dbUser.Username) != nil || m.usernameReserved(dbUser.Username, 0) {
+		return ErrUsernameAlreadyTaken
+	}
+
+	identity := memIdentity{dbIdentity.Provider, dbIdentity.Subject}
+
+	if m.identities[identity] != nil {
+		return ErrIdentityAlreadyLinked
+	}
+
+	m.lastUserId++
+
+	dbUser.Id = m.lastUserId
+
+	m.users[dbUser.Id] = &memUser{
+		id:            dbUser.Id,
+		username:      dbUser.Username,
+		commentPolicy: PolicyEveryone,
+		mentionPolicy: PolicyEveryone,
+	}
+
+	m.identities[identity] = &memIdentityLink{
+		user: dbUser.Id,
+		date: dbIdentity.Date.UTC().Truncate(time.Second),
+	}
+
+	return nil
+}
+
+func (m *memdb) CheckIdentity(ctx context.Context, dbLogin DatabaseLogin) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user := m.userFromUsername(dbLogin.Username)
+
+	if user == nil {
+		return false, nil
+	}
+
+	for _, link := range m.identities {
+		if link.user == user.id {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// API key
+
+func (m *memdb) GetDatabaseAPIKey(ctx context.Context, keyHash string) (DatabaseAPIKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	apiKey := m.apiKeys[keyHash]
+
+	if apiKey == nil {
+		return DatabaseAPIKeyDefault(), ErrAPIKeyDoesNotExist
+	}
+
+	// the keys of the suspended or deactivated users are not accepted
+	if user := m.users[apiKey.user]; user == nil || user.suspendedAt != nil || user.deactivatedAt != nil {
+		return DatabaseAPIKeyDefault(), ErrAPIKeyDoesNotExist
+	}
+
+	return m.apiKey(keyHash, apiKey), nil
+}
+
+func (m *memdb) GetAPIKeys(ctx context.Context, dbUser DatabaseUser) ([]DatabaseAPIKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	dbAPIKeys := make([]DatabaseAPIKey, 0)
+
+	for keyHash, apiKey := range m.apiKeys {
+		if apiKey.user == dbUser.Id {
+			dbAPIKeys = append(dbAPIKeys, m.apiKey(keyHash, apiKey))
+		}
+	}
+
+	// from the first minted
+	sort.Slice(dbAPIKeys, func(i, j int) bool {
+		return dbAPIKeys[i].Id < dbAPIKeys[j].Id
+	})
+
+	return dbAPIKeys, nil
+}
+
+func (m *memdb) InsertAPIKey(ctx context.Context, dbAPIKey *DatabaseAPIKey, maxKeys int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.users[dbAPIKey.User.Id] == nil {
+		return ErrUserDoesNotExist
+	}
+
+	count := 0
+
+	for _, apiKey := range m.apiKeys {
+		if apiKey.user == dbAPIKey.User.Id {
+			count++
+		}
+	}
+
+	if count >= maxKeys {
+		return ErrTooManyAPIKeys
+	}
+
+	m.lastAPIKeyId++
+
+	dbAPIKey.Id = m.lastAPIKeyId
+
+	m.apiKeys[dbAPIKey.KeyHash] = &memAPIKey{
+		id:        dbAPIKey.Id,
+		user:      dbAPIKey.User.Id,
+		name:      dbAPIKey.Name,
+		scope:     dbAPIKey.Scope,
+		rateLimit: dbAPIKey.RateLimit,
+		createdAt: dbAPIKey.CreatedAt.UTC().Truncate(time.Second),
+	}
+
+	return nil
+}
+
+func (m *memdb) TouchAPIKey(ctx context.Context, dbAPIKey DatabaseAPIKey, date time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, apiKey := range m.apiKeys {
+		if apiKey.id == dbAPIKey.Id {
+			lastUsedAt := date.UTC().Truncate(time.Second)
+			apiKey.lastUsedAt = &lastUsedAt
+		}
+	}
+
+	return nil
+}
+
+func (m *memdb) DeleteAPIKey(ctx context.Context, dbAPIKey DatabaseAPIKey) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for keyHash, apiKey := range m.apiKeys {
+		if apiKey.id == dbAPIKey.Id && apiKey.user == dbAPIKey.User.Id {
+			delete(m.apiKeys, keyHash)
+
+			return nil
+		}
+	}
+
+	return ErrAPIKeyDoesNotExist
+}
+
+// apiKey converts an API key to its database form, together with its user
+func (m *memdb) apiKey(keyHash string, apiKey *memAPIKey) DatabaseAPIKey {
+	dbAPIKey := DatabaseAPIKeyDefault()
+	dbAPIKey.Id = apiKey.id
+	dbAPIKey.User = m.user(apiKey.user)
+	dbAPIKey.Name = apiKey.name
+	dbAPIKey.KeyHash = keyHash
+	dbAPIKey.Scope = apiKey.scope
+	dbAPIKey.RateLimit = apiKey.rateLimit
+	dbAPIKey.CreatedAt = apiKey.createdAt
+
+	if apiKey.lastUsedAt != nil {
+		lastUsedAt := *apiKey.lastUsedAt
+		dbAPIKey.LastUsedAt = &lastUsedAt
+	}
+
+	return dbAPIKey
+}
+
+// Hashtag
+
+func (m *memdb) GetHashtagPhotos(ctx context.Context, dbUser DatabaseUser, hashtag string, limit int, before uint32) (DatabaseHashtagFeed, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	dbFeed := DatabaseHashtagFeedDefault()
+	dbFeed.Hashtag = hashtag
+
+	// the hashtags are parsed every time from the
+	// comments written by users who did not ban the user
+	tagged := make(map[uint32]bool)
+
+	for _, comment := range m.comments {
+		if tagged[comment.photo] || m.bans[memPair{comment.user, dbUser.Id}] || m.shadowHidden(comment.user, dbUser.Id) {
+			continue
+		}
+
+		for _, commentHashtag := range ParseHashtags(comment.body) {
+			if commentHashtag == hashtag {
+				tagged[comment.photo] = true
+			}
+		}
+	}
+
+	photos := make([]*memPhoto, 0)
+
+	for photoId := range tagged {
+		photo := m.photos[photoId]
+
+		if photo.archived || photo.closeFriends || photo.flagged || photo.scheduled || !m.active(photo.user) || m.bans[memPair{photo.user, dbUser.Id}] || m.shadowHidden(photo.user, dbUser.Id) || m.privateHidden(photo.user, dbUser.Id) {
+			continue
+		}
+
+		photos = append(photos, photo)
+	}
+
+	// one more photo is kept to know whether there is a next page
+	for _, photo := range m.newestFirst(photos, before, 0, limit+1) {
+		dbPhoto, err := m.photo(photo.id, dbUser.Id)
+
+		if err != nil {
+			return dbFeed, err
+		}
+
+		dbFeed.Photos = append(dbFeed.Photos, dbPhoto)
+	}
+
+	// if there is a next page, its cursor
+	// is the last photo of the current one
+	if len(dbFeed.Photos) > limit {
+		dbFeed.Photos = dbFeed.Photos[:limit]
+		dbFeed.NextCursor = dbFeed.Photos[limit-1].Id
+	}
+
+	return dbFeed, nil
+}
+
+func (m *memdb) SearchHashtags(ctx context.Context, dbUser DatabaseUser, query string, limit int) ([]DatabaseHashtagCount, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	dbHashtags := make([]DatabaseHashtagCount, 0)
+
+	query, ok := NormalizeHashtag(query)
+
+	if !ok {
+		return dbHashtags, nil
+	}
+
+	// the hashtags are counted once per comment, with
+	// the same rules as the hashtag feed
+	counts := make(map[string]int)
+
+	for _, comment := range m.comments {
+		if m.bans[memPair{comment.user, dbUser.Id}] || m.shadowHidden(comment.user, dbUser.Id) {
+			continue
+		}
+
+		photo := m.photos[comment.photo]
+
+		if photo.archived || photo.closeFriends || photo.flagged || photo.scheduled || !m.active(photo.user) || m.bans[memPair{photo.user, dbUser.Id}] || m.shadowHidden(photo.user, dbUser.Id) || m.privateHidden(photo.user, dbUser.Id) {
+			continue
+		}
+
+		for _, hashtag := range ParseHashtags(comment.body) {
+			if strings.Contains(hashtag, query) {
+				counts[hashtag]++
+			}
+		}
+	}
+
+	position := func(hashtag string) int {
+		switch {
+		case hashtag == query:
+			return 0
+		case strings.HasPrefix(hashtag, query):
+			return 1
+		default:
+			return 2
+		}
+	}
+
+	for hashtag, count := range counts {
+		dbHashtags = append(dbHashtags, DatabaseHashtagCount{Hashtag: hashtag, Count: count})
+	}
+
+	sort.Slice(dbHashtags, func(i, j int) bool {
+		if position(dbHashtags[i].Hashtag) != position(dbHashtags[j].Hashtag) {
+			return position(dbHashtags[i].Hashtag) < position(dbHashtags[j].Hashtag)
+		}
+
+		if dbHashtags[i].Count != dbHashtags[j].Count {
+			return dbHashtags[i].Count > dbHashtags[j].Count
+		}
+
+		return dbHashtags[i].Hashtag < dbHashtags[j].Hashtag
+	})
+
+	if len(dbHashtags) > limit {
+		dbHashtags = dbHashtags[:limit]
+	}
+
+	return dbHashtags, nil
+}
+
+func (m *memdb) RebuildHashtags(ctx context.Context) error {
+	// the hashtags are always parsed from the comments
+	return nil
+}
+
+// Album
+
+func (m *memdb) GetDatabaseAlbum(ctx context.Context, albumId uint32, dbUser DatabaseUser) (DatabaseAlbum, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	album := m.albums[albumId]
+
+	if album == nil {
+		return DatabaseAlbumDefault(), ErrAlbumDoesNotExist
+	}
+
+	dbAlbum := m.album(album, dbUser.Id)
+
+	for _, photoId := range album.photos {
+		if dbPhoto, err := m.photo(photoId, dbUser.Id); err == nil {
+			dbAlbum.Photos = append(dbAlbum.Photos, dbPhoto)
+		}
+	}
+
+	return dbAlbum, nil
+}
+
+func (m *memdb) InsertAlbum(ctx context.Context, dbAlbum *DatabaseAlbum) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.users[dbAlbum.User.Id] == nil {
+		return ErrUserDoesNotExist
+	}
+
+	m.lastAlbumId++
+
+	dbAlbum.Id = m.lastAlbumId
+
+	m.albums[dbAlbum.Id] = &memAlbum{
+		id:     dbAlbum.Id,
+		user:   dbAlbum.User.Id,
+		name:   dbAlbum.Name,
+		date:   dbAlbum.Date.UTC().Truncate(time.Second),
+		photos: make([]uint32, 0),
+	}
+
+	return nil
+}
+
+func (m *memdb) UpdateAlbum(ctx context.Context, dbAlbum DatabaseAlbum) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	album := m.albums[dbAlbum.Id]
+
+	if album == nil {
+		return ErrAlbumDoesNotExist
+	}
+
+	album.name = dbAlbum.Name
+
+	return nil
+}
+
+func (m *memdb) DeleteAlbum(ctx context.Context, dbAlbum DatabaseAlbum) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.albums[dbAlbum.Id] == nil {
+		return ErrAlbumDoesNotExist
+	}
+
+	delete(m.albums, dbAlbum.Id)
+
+	return nil
+}
+
+func (m *memdb) SetAlbumPhotos(ctx context.Context, dbAlbum DatabaseAlbum, photoIds []uint32) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	album := m.albums[dbAlbum.Id]
+
+	if album == nil {
+		return ErrAlbumDoesNotExist
+	}
+
+	for _, photoId := range photoIds {
+		if photo := m.photos[photoId]; photo == nil || photo.user != album.user {
+			return ErrPhotoDoesNotExist
+		}
+	}
+
+	album.photos = append(make([]uint32, 0, len(photoIds)), photoIds...)
+
+	return nil
+}
+
+func (m *memdb) GetAlbums(ctx context.Context, profileDbUser DatabaseUser, dbUser DatabaseUser) (DatabaseAlbumList, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	dbAlbumList := DatabaseAlbumListDefault()
+
+	albums := make([]*memAlbum, 0)
+
+	for _, album := range m.albums {
+		if album.user == profileDbUser.Id {
+			albums = append(albums, album)
+		}
+	}
+
+	sort.Slice(albums, func(i, j int) bool {
+		return newer(albums[i].date, albums[i].id, albums[j].date, albums[j].id)
+	})
+
+	for _, album := range albums {
+		dbAlbumList.Albums = append(dbAlbumList.Albums, m.album(album, dbUser.Id))
+	}
+
+	return dbAlbumList, nil
+}
+
+// album builds the album as seen by the user `viewerId`, counting
+// its visible photos and without the list of the photos
+func (m *memdb) album(album *memAlbum, viewerId uint32) DatabaseAlbum {
+	dbAlbum := DatabaseAlbumDefault()
+
+	dbAlbum.Id = album.id
+	dbAlbum.User = m.user(album.user)
+	dbAlbum.Name = album.name
+	dbAlbum.Date = album.date
+
+	for _, photoId := range album.photos {
+		photo := m.photos[photoId]
+
+		if (photo.archived && photo.user != viewerId) || !m.visiblePhoto(photo, viewerId) {
+			continue
+		}
+
+		if dbAlbum.PhotoCount == 0 {
+			dbAlbum.CoverUrl = photo.url
+		}
+
+		dbAlbum.PhotoCount++
+	}
+
+	return dbAlbum
+}
+
+// Place
+
+func (m *memdb) GetPlacePhotos(ctx context.Context, dbUser DatabaseUser, place string, limit int, before uint32) (DatabasePlaceFeed, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	dbFeed := DatabasePlaceFeedDefault()
+	dbFeed.Place, _ = NormalizePlace(place)
+
+	key := placeKey(place)
+
+	photos := make([]*memPhoto, 0)
+
+	for _, photo := range m.photos {
+		if photo.place == "" || placeKey(photo.place) != key {
+			continue
+		}
+
+		if photo.archived || photo.closeFriends || photo.flagged || photo.scheduled || !m.active(photo.user) || m.bans[memPair{photo.user, dbUser.Id}] || m.shadowHidden(photo.user, dbUser.Id) || m.privateHidden(photo.user, dbUser.Id) {
+			continue
+		}
+
+		photos = append(photos, photo)
+	}
+
+	// one more photo is kept to know whether there is a next page
+	for _, photo := range m.newestFirst(photos, before, 0, limit+1) {
+		dbPhoto, err := m.photo(photo.id, dbUser.Id)
+
+		if err != nil {
+			return dbFeed, err
+		}
+
+		dbFeed.Photos = append(dbFeed.Photos, dbPhoto)
+	}
+
+	// if there is a next page, its cursor
+	// is the last photo of the current one
+	if len(dbFeed.Photos) > limit {
+		dbFeed.Photos = dbFeed.Photos[:limit]
+		dbFeed.NextCursor = dbFeed.Photos[limit-1].Id
+	}
+
+	return dbFeed, nil
+}
+
+// Explore
+
+func (m *memdb) GetExplorePhotos(ctx context.Context, dbUser DatabaseUser, since time.Time, limit int, offset int) (DatabaseExploreFeed, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	dbFeed := DatabaseExploreFeedDefault()
+	activity := m.activity(since)
+
+	photos := make([]*memPhoto, 0)
+
+	for photoId := range activity {
+		photo := m.photos[photoId]
+
+		if photo == nil || photo.archived || photo.closeFriends || photo.flagged || photo.scheduled || photo.user == dbUser.Id || m.follows[memPair{dbUser.Id, photo.user}] {
+			continue
+		}
+
+		if !m.active(photo.user) || m.shadowHidden(photo.user, dbUser.Id) || m.privateHidden(photo.user, dbUser.Id) || m.bans[memPair{photo.user, dbUser.Id}] || m.bans[memPair{dbUser.Id, photo.user}] {
+			continue
+		}
+
+		photos = append(photos, photo)
+	}
+
+	m.mostActiveFirst(photos, activity)
+
+	if offset >= len(photos) {
+		return dbFeed, nil
+	}
+
+	photos = photos[offset:]
+
+	if len(photos) > limit {
+		photos = photos[:limit]
+		dbFeed.NextOffset = offset + limit
+	}
+
+	for _, photo := range photos {
+		dbPhoto, err := m.photo(photo.id, dbUser.Id)
+
+		if err != nil {
+			return dbFeed, err
+		}
+
+		dbFeed.Photos = append(dbFeed.Photos, dbPhoto)
+	}
+
+	return dbFeed, nil
+}
+
+// activity returns the number of reactions and comments each photo received since `since`
+func (m *memdb) activity(since time.Time) map[uint32]int {
+	since = since.UTC().Truncate(time.Second)
+	activity := make(map[uint32]int)
+
+	for like, date := range m.likeDates {
+		if !date.Before(since) {
+			activity[like.second]++
+		}
+	}
+
+	for _, comment := range m.comments {
+		if !comment.date.Before(since) {
+			activity[comment.photo]++
+		}
+	}
+
+	return activity
+}
+
+// mostActiveFirst sorts the photos by their activity, the newest
+// first among the photos as active as each other
+func (m *memdb) mostActiveFirst(photos []*memPhoto, activity map[uint32]int) {
+	sort.Slice(photos, func(i, j int) bool {
+		if activity[photos[i].id] != activity[photos[j].id] {
+			return activity[photos[i].id] > activity[photos[j].id]
+		}
+
+		return newer(photos[i].date, photos[i].id, photos[j].date, photos[j].id)
+	})
+}
+
+// Trending
+
+func (m *memdb) GetTrending(ctx context.Context, dbUser DatabaseUser, since time.Time, limit int) (DatabaseTrending, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	dbTrending := DatabaseTrendingDefault()
+	activity := m.activity(since)
+
+	photos := make([]*memPhoto, 0)
+
+	for photoId := range activity {
+		photo := m.photos[photoId]
+
+		if photo == nil || photo.archived || photo.closeFriends || photo.flagged || photo.scheduled || !m.active(photo.user) || m.shadowHidden(photo.user, dbUser.Id) || m.privateHidden(photo.user, dbUser.Id) {
+			continue
+		}
+
+		if m.bans[memPair{photo.user, dbUser.Id}] || m.bans[memPair{dbUser.Id, photo.user}] {
+			continue
+		}
+
+		photos = append(photos, photo)
+	}
+
+	m.mostActiveFirst(photos, activity)
+
+	if len(photos) > limit {
+		photos = photos[:limit]
+	}
+
+	for _, photo := range photos {
+		dbPhoto, err := m.photo(photo.id, dbUser.Id)
+
+		if err != nil {
+			return dbTrending, err
+		}
+
+		dbTrending.Photos = append(dbTrending.Photos, dbPhoto)
+	}
+
+	// the hashtags are counted once per comment, with
+	// the same rules as the hashtag feed
+	since = since.UTC().Truncate(time.Second)
+	counts := make(map[string]int)
+
+	for _, comment := range m.comments {
+		if comment.date.Before(since) || m.bans[memPair{comment.user, dbUser.Id}] || m.shadowHidden(comment.user, dbUser.Id) {
+			continue
+		}
+
+		photo := m.photos[comment.photo]
+
+		if photo.archived || photo.closeFriends || photo.flagged || photo.scheduled || !m.active(photo.user) || m.bans[memPair{photo.user, dbUser.Id}] || m.shadowHidden(photo.user, dbUser.Id) || m.privateHidden(photo.user, dbUser.Id) {
+			continue
+		}
+
+		for _, hashtag := range ParseHashtags(comment.body) {
+			counts[hashtag]++
+		}
+	}
+
+	for hashtag, count := range counts {
+		dbTrending.Hashtags = append(dbTrending.Hashtags, DatabaseHashtagCount{Hashtag: hashtag, Count: count})
+	}
+
+	sort.Slice(dbTrending.Hashtags, func(i, j int) bool {
+		if dbTrending.Hashtags[i].Count != dbTrending.Hashtags[j].Count {
+			return dbTrending.Hashtags[i].Count > dbTrending.Hashtags[j].Count
+		}
+
+		return dbTrending.Hashtags[i].Hashtag < dbTrending.Hashtags[j].Hashtag
+	})
+
+	if len(dbTrending.Hashtags) > limit {
+		dbTrending.Hashtags = dbTrending.Hashtags[:limit]
+	}
+
+	return dbTrending, nil
+}
+
+// Story
+
+func (m *memdb) GetDatabaseStory(ctx context.Context, storyId uint32) (DatabaseStory, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	story := m.stories[storyId]
+
+	if story == nil {
+		return DatabaseStoryDefault(), ErrStoryDoesNotExist
+	}
+
+	return m.story(story), nil
+}
+
+func (m *memdb) InsertStory(ctx context.Context, dbStory *DatabaseStory) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.users[dbStory.User.Id] == nil {
+		return ErrUserDoesNotExist
+	}
+
+	m.lastStoryId++
+
+	dbStory.Id = m.lastStoryId
+
+	m.stories[dbStory.Id] = &memStory{
+		id:        dbStory.Id,
+		user:      dbStory.User.Id,
+		url:       dbStory.Url,
+		date:      dbStory.Date.UTC().Truncate(time.Second),
+		expiresAt: dbStory.ExpiresAt.UTC().Truncate(time.Second),
+	}
+
+	return nil
+}
+
+func (m *memdb) DeleteStory(ctx context.Context, dbStory DatabaseStory) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.stories[dbStory.Id] == nil {
+		return ErrStoryDoesNotExist
+	}
+
+	delete(m.stories, dbStory.Id)
+
+	return nil
+}
+
+func (m *memdb) GetStories(ctx context.Context, storyDbUser DatabaseUser, now time.Time) (DatabaseStoryList, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	dbStoryList := DatabaseStoryListDefault()
+
+	for _, story := range m.unexpiredStories(now) {
+		if story.user == storyDbUser.Id {
+			dbStoryList.Stories = append(dbStoryList.Stories, m.story(story))
+		}
+	}
+
+	return dbStoryList, nil
+}
+
+func (m *memdb) GetStoryTray(ctx context.Context, dbUser DatabaseUser, now time.Time) (DatabaseStoryTray, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	dbStoryTray := DatabaseStoryTrayDefault()
+
+	entries := make(map[uint32]*DatabaseStoryTrayEntry)
+
+	for _, story := range m.unexpiredStories(now) {
+		if !m.follows[memPair{dbUser.Id, story.user}] || m.bans[memPair{story.user, dbUser.Id}] || !m.active(story.user) || m.shadowHidden(story.user, dbUser.Id) {
+			continue
+		}
+
+		entry := entries[story.user]
+
+		if entry == nil {
+			entry = &DatabaseStoryTrayEntry{User: m.user(story.user)}
+			entries[story.user] = entry
+		}
+
+		// the stories are sorted from the oldest,
+		// hence the last one is the latest
+		entry.StoryCount++
+		entry.LatestDate = story.date
+	}
+
+	for _, entry := range entries {
+		dbStoryTray.Users = append(dbStoryTray.Users, *entry)
+	}
+
+	sort.Slice(dbStoryTray.Users, func(i, j int) bool {
+		first, second := dbStoryTray.Users[i], dbStoryTray.Users[j]
+
+		if !first.LatestDate.Equal(second.LatestDate) {
+			return first.LatestDate.After(second.LatestDate)
+		}
+
+		return first.User.Id < second.User.Id
+	})
+
+	return dbStoryTray, nil
+}
+
+func (m *memdb) DeleteExpiredStories(ctx context.Context, now time.Time) ([]DatabaseStory, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	dbStories := make([]DatabaseStory, 0)
+
+	for id, story := range m.stories {
+		if story.expiresAt.After(now) {
+			continue
+		}
+
+		dbStories = append(dbStories, m.story(story))
+
+		delete(m.stories, id)
+	}
+
+	return dbStories, nil
+}
+
+// unexpiredStories returns the stories which have not expired at
+// the time `now`, from the oldest to the newest
+func (m *memdb) unexpiredStories(now time.Time) []*memStory {
+	stories := make([]*memStory, 0)
+
+	for _, story := range m.stories {
+		if story.expiresAt.After(now) {
+			stories = append(stories, story)
+		}
+	}
+
+	sort.Slice(stories, func(i, j int) bool {
+		return newer(stories[j].date, stories[j].id, stories[i].date, stories[i].id)
+	})
+
+	return stories
+}
+
+// story builds the story with the information of its user
+func (m *memdb) story(story *memStory) DatabaseStory {
+	dbStory := DatabaseStoryDefault()
+
+	dbStory.Id = story.id
+	dbStory.User = m.user(story.user)
+	dbStory.Url = story.url
+	dbStory.Date = story.date
+	dbStory.ExpiresAt = story.expiresAt
+
+	return dbStory
+}
+
+// Digest
+
+func (m *memdb) GetDigestRecipients(ctx context.Context, sentBefore time.Time, after uint32, limit int) ([]DatabaseDigest, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	dbDigests := make([]DatabaseDigest, 0)
+
+	for _, user := range m.users {
+		if user.email == "" || !user.emailVerified || user.deactivatedAt != nil || user.id <= after {
+			continue
+		}
+
+		if user.digestSentAt != nil && !user.digestSentAt.Before(sentBefore.UTC().Truncate(time.Second)) {
+			continue
+		}
+
+		dbDigest := DatabaseDigestDefault()
+
+		dbDigest.User = m.user(user.id)
+		dbDigest.User.Version = user.version
+		dbDigest.Email = user.email
+
+		// the digest starts where the last one ended
+		if user.digestSentAt != nil {
+			dbDigest.Since = *user.digestSentAt
+		}
+
+		dbDigests = append(dbDigests, dbDigest)
+	}
+
+	sort.Slice(dbDigests, func(i, j int) bool {
+		return dbDigests[i].User.Id < dbDigests[j].User.Id
+	})
+
+	if len(dbDigests) > limit {
+		dbDigests = dbDigests[:limit]
+	}
+
+	return dbDigests, nil
+}
+
+func (m *memdb) GetDigest(ctx context.Context, dbDigest *DatabaseDigest, limit int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	userId := dbDigest.User.Id
+	since := dbDigest.Since.UTC().Truncate(time.Second)
+
+	// the follows are dated by their notifications, and only
+	// the types the user receives by email are written
+	follows := make([]*memNotification, 0)
+
+	dbDigest.Activity = make(map[string]int)
+
+	for _, notification := range m.visibleNotifications(userId) {
+		if notification.date.Before(since) || !m.notificationEnabled(notification, ChannelEmail) {
+			continue
+		}
+
+		if notification.kind == NotificationFollow {
+			follows = append(follows, notification)
+		} else {
+			dbDigest.Activity[notification.kind]++
+		}
+	}
+
+	sort.Slice(follows, func(i, j int) bool {
+		return newer(follows[i].date, follows[i].id, follows[j].date, follows[j].id)
+	})
+
+	if len(follows) > limit {
+		follows = follows[:limit]
+	}
+
+	dbDigest.NewFollowers = make([]DatabaseUser, 0)
+
+	for _, notification := range follows {
+		dbDigest.NewFollowers = append(dbDigest.NewFollowers, m.user(notification.actor))
+	}
+
+	// the photos of the followed users, with the same rules as the stream
+	photos := make([]*memPhoto, 0)
+	likeCounts := make(map[uint32]int)
+
+	for _, photo := range m.photos {
+		if photo.archived || !m.follows[memPair{userId, photo.user}] || !m.visiblePhoto(photo, userId) || photo.date.Before(since) {
+			continue
+		}
+
+		if !m.active(photo.user) || m.bans[memPair{photo.user, userId}] || m.mutes[memPair{userId, photo.user}] {
+			continue
+		}
+
+		likeCounts[photo.id] = m.likeCount(photo.id, 0)
+
+		if likeCounts[photo.id] > 0 {
+			photos = append(photos, photo)
+		}
+	}
+
+	sort.Slice(photos, func(i, j int) bool {
+		if likeCounts[photos[i].id] != likeCounts[photos[j].id] {
+			return likeCounts[photos[i].id] > likeCounts[photos[j].id]
+		}
+
+		return newer(photos[i].date, photos[i].id, photos[j].date, photos[j].id)
+	})
+
+	if len(photos) > limit {
+		photos = photos[:limit]
+	}
+
+	dbDigest.TopPhotos = make([]DatabasePhoto, 0)
+
+	for _, photo := range photos {
+		dbPhoto, err := m.photo(photo.id, userId)
+
+		if err != nil {
+			return err
+		}
+
+		dbDigest.TopPhotos = append(dbDigest.TopPhotos, dbPhoto)
+	}
+
+	return nil
+}
+
+func (m *memdb) SetDigestSent(ctx context.Context, dbUser DatabaseUser, date time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user := m.users[dbUser.Id]
+
+	if user == nil {
+		return ErrUserDoesNotExist
+	}
+
+	sentAt := date.UTC().Truncate(time.Second)
+	user.digestSentAt = &sentAt
+
+	return nil
+}
+
+// Stream
+
+func (m *memdb) GetDatabaseStream(ctx context.Context, dbUser DatabaseUser, filter DatabaseStreamFilter, limit int, before uint32, after uint32) (DatabaseStream, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	dbStream := DatabaseStreamDefault()
+
+	for _, photo := range m.newestFirst(m.streamPhotos(dbUser.Id, filter), before, after, limit) {
+		dbPhoto, err := m.photo(photo.id, dbUser.Id)
+
+		if err != nil {
+			return dbStream, err
+		}
+
+		dbStream.Photos = append(dbStream.Photos, dbPhoto)
+	}
+
+	return dbStream, nil
+}
+
+func (m *memdb) GetStreamUpdates(ctx context.Context, dbUser DatabaseUser, since uint32) (DatabaseStreamUpdates, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	dbUpdates := DatabaseStreamUpdatesDefault()
+
+	photos := m.streamPhotos(dbUser.Id, DatabaseStreamFilterDefault())
+	photos = m.newestFirst(photos, 0, since, len(photos))
+
+	dbUpdates.Count = len(photos)
+
+	if len(photos) > 0 {
+		dbUpdates.NewestId = photos[0].id
+	}
+
+	return dbUpdates, nil
+}
+
+// streamPhotos returns the photos of the stream of the user, narrowed down by the filter, in no particular order
+func (m *memdb) streamPhotos(userId uint32, filter DatabaseStreamFilter) []*memPhoto {
+	var seenAt *time.Time
+
+	if user := m.users[userId]; user != nil && filter.Unseen {
+		seenAt = user.streamSeenAt
+	}
+
+	authors := make(map[uint32]bool, len(filter.Authors))
+
+	for _, author := range filter.Authors {
+		authors[author] = true
+	}
+
+	photos := make([]*memPhoto, 0)
+
+	for _, photo := range m.photos {
+		if photo.archived || photo.scheduled || !m.follows[memPair{userId, photo.user}] || !m.visiblePhoto(photo, userId) {
+			continue
+		}
+
+		if !m.active(photo.user) || m.bans[memPair{photo.user, userId}] || m.mutes[memPair{userId, photo.user}] {
+			continue
+		}
+
+		// the dates are compared to the second, as stored by the database
+		date := photo.date.Unix()
+
+		if (!filter.Since.IsZero() && date < filter.Since.Unix()) || (!filter.Until.IsZero() && date >= filter.Until.Unix()) {
+			continue
+		}
+
+		if (seenAt != nil && date <= seenAt.Unix()) || (len(authors) > 0 && !authors[photo.user]) {
+			continue
+		}
+
+		photos = append(photos, photo)
+	}
+
+	return photos
+}
+
+func (m *memdb) SetStreamSeen(ctx context.Context, dbUser DatabaseUser, date time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user := m.users[dbUser.Id]
+
+	if user == nil {
+		return ErrUserDoesNotExist
+	}
+
+	seenAt := date.UTC().Truncate(time.Second)
+	user.streamSeenAt = &seenAt
+
+	return nil
+}
+
+// User
+
+func (m *memdb) GetDatabaseUser(ctx context.Context, userId uint32) (DatabaseUser, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.users[userId] == nil {
+		return DatabaseUserDefault(), ErrUserDoesNotExist
+	}
+
+	dbUser := m.user(userId)
+	dbUser.Version = m.users[userId].version
+
+	return dbUser, nil
+}
+
+func (m *memdb) GetDatabaseUserFromDatabaseLogin(ctx context.Context, dbLogin DatabaseLogin) (DatabaseUser, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user := m.userFromUsername(dbLogin.Username)
+
+	// a deactivated user cannot be found until they log in again
+	if user == nil || user.deactivatedAt != nil {
+		return DatabaseUserDefault(), ErrUserDoesNotExist
+	}
+
+	dbUser := m.user(user.id)
+	dbUser.Version = user.version
+
+	return dbUser, nil
+}
+
+func (m *memdb) InsertUser(ctx context.Context, dbUser *DatabaseUser) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// the user may be already registered
+	user := m.userFromUsername(dbUser.Username)
+
+	if user != nil {
+		dbUser.Id = user.id
+		dbUser.Username = user.username
+		return nil
+	}
+
+	if m.usernameReserved(dbUser.Username, 0) {
+		return ErrUsernameAlreadyTaken
+	}
+
+	m.lastUserId++
+
+	dbUser.Id = m.lastUserId
+
+	m.users[dbUser.Id] = &memUser{
+		id:            dbUser.Id,
+		username:      dbUser.Username,
+		commentPolicy: PolicyEveryone,
+		mentionPolicy: PolicyEveryone,
+	}
+
+	return nil
+}
+
+func (m *memdb) UpdateUser(ctx context.Context, oldDbUser DatabaseUser, newDbUser DatabaseUser, reservedUntil time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user := m.users[oldDbUser.Id]
+
+	if user == nil {
+		return ErrUserDoesNotExist
+	}
+
+	// the user was updated after it was read
+	if user.version != oldDbUser.Version {
+		return ErrConflict
+	}
+
+	taken := m.userFromUsername(newDbUser.Username)
+
+	if taken != nil && taken.id != user.id {
+		return ErrUsernameAlreadyTaken
+	}
+
+	renamed := newDbUser.Username != oldDbUser.Username
+	rekeyed := m.usernameKey(newDbUser.Username) != m.usernameKey(oldDbUser.Username)
+
+	if rekeyed && m.usernameReserved(newDbUser.Username, user.id) {
+		return ErrUsernameAlreadyTaken
+	}
+
+	user.username = newDbUser.Username
+	user.displayName = newDbUser.DisplayName
+	user.bio = newDbUser.Bio
+	user.website = newDbUser.Website
+	user.version++
+
+	// only the changes of the username are audited, and only
+	// the ones changing its key leave the old one reserved
+	if !renamed {
+		return nil
+	}
+
+	if !rekeyed {
+		m.insertAudit(user.id, AuditChangeUsername, user.id, oldDbUser.Username+" -> "+newDbUser.Username)
+		return nil
+	}
+
+	now := globaltime.Now().UTC().Truncate(time.Second)
+
+	// the user taking back a username they left
+	// does not keep it reserved anymore
+	for i, change := range m.usernameHistory {
+		if m.usernameKey(change.username) == m.usernameKey(newDbUser.Username) && change.user == user.id && change.reservedUntil.After(now) {
+			m.usernameHistory[i].reservedUntil = now
+		}
+	}
+
+	// keep the old username reserved to the user
+	change := memUsernameChange{
+		username:      oldDbUser.Username,
+		user:          user.id,
+		changedAt:     now,
+		reservedUntil: reservedUntil.UTC().Truncate(time.Second),
+	}
+
+	replaced := false
+
+	for i := range m.usernameHistory {
+		if m.usernameHistory[i].username == change.username && m.usernameHistory[i].changedAt.Equal(now) {
+			m.usernameHistory[i] = change
+			replaced = true
+		}
+	}
+
+	if !replaced {
+		m.usernameHistory = append(m.usernameHistory, change)
+	}
+
+	m.insertAudit(user.id, AuditChangeUsername, user.id, oldDbUser.Username+" -> "+newDbUser.Username)
+
+	return nil
+}
+
+// usernameReserved reports whether the username was left by a user other than `userId` who still holds it
+func (m *memdb) usernameReserved(username string, userId uint32) bool {
+	now := globaltime.Now()
+
+	for _, change := range m.usernameHistory {
+		if m.usernameKey(change.username) == m.usernameKey(username) && change.user != userId && change.reservedUntil.After(now) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (m *memdb) GetRenamedUser(ctx context.Context, username string) (DatabaseUser, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := globaltime.Now()
+
+	// the history is sorted by date, so the
+	// user who left the username last wins
+	for i := len(m.usernameHistory) - 1; i >= 0; i-- {
+		change := m.usernameHistory[i]
+
+		if m.usernameKey(change.username) == m.usernameKey(username) && change.reservedUntil.After(now) && m.active(change.user) {
+			dbUser := m.user(change.user)
+			dbUser.Version = m.users[change.user].version
+
+			return dbUser, nil
+		}
+	}
+
+	return DatabaseUserDefault(), ErrUserDoesNotExist
+}
+
+func (m *memdb) DeleteUser(ctx context.Context, dbUser DatabaseUser) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.users[dbUser.Id] == nil {
+		return nil, ErrUserDoesNotExist
+	}
+
+	urls := m.userFileUrls(dbUser.Id)
+
+	m.deleteUser(dbUser.Id)
+
+	m.insertAudit(dbUser.Id, AuditDeleteUser, dbUser.Id, dbUser.Username)
+
+	return urls, nil
+}
+
+// userFileUrls returns the urls of the files of the user, each once: their photos, the originals of the edited ones,
+// the posters of the videos, their stories and their avatar
+func (m *memdb) userFileUrls(userId uint32) []string {
+	urls := make([]string, 0)
+	seen := make(map[string]bool)
+
+	add := func(url string) {
+		if url != "" && !seen[url] {
+			seen[url] = true
+			urls = append(urls, url)
+		}
+	}
+
+	for _, photo := range m.photos {
+		if photo.user == userId {
+			add(photo.url)
+			add(photo.originalUrl)
+			add(photo.posterUrl)
+		}
+	}
+
+	for _, story := range m.stories {
+		if story.user == userId {
+			add(story.url)
+		}
+	}
+
+	if user := m.users[userId]; user != nil {
+		add(user.avatar)
+	}
+
+	return urls
+}
+
+func (m *memdb) GetUserSettings(ctx context.Context, dbUser DatabaseUser) (DatabaseSettings, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	dbSettings := DatabaseSettingsDefault()
+
+	user := m.users[dbUser.Id]
+
+	if user == nil {
+		return dbSettings, ErrUserDoesNotExist
+	}
+
+	dbSettings.StripLocation = user.stripLocation
+	dbSettings.Email = user.email
+	dbSettings.EmailVerified = user.emailVerified
+	dbSettings.Private = user.private
+	dbSettings.CommentPolicy = user.commentPolicy
+	dbSettings.MentionPolicy = user.mentionPolicy
+	dbSettings.HideLikeCounts = user.hideLikeCounts
+
+	return dbSettings, nil
+}
+
+func (m *memdb) UpdateUserSettings(ctx context.Context, dbUser DatabaseUser, dbSettings DatabaseSettings) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user := m.users[dbUser.Id]
+
+	if user == nil {
+		return ErrUserDoesNotExist
+	}
+
+	// a new address is not verified
+	if user.email != dbSettings.Email {
+		user.emailVerified = false
+	}
+
+	user.stripLocation = dbSettings.StripLocation
+	user.email = dbSettings.Email
+	user.private = dbSettings.Private
+	user.commentPolicy = dbSettings.CommentPolicy
+	user.mentionPolicy = dbSettings.MentionPolicy
+	user.hideLikeCounts = dbSettings.HideLikeCounts
+
+	// a public account can be followed by anyone,
+	// so the pending requests to follow it are approved
+	if !user.private {
+		for pair := range m.followRequests {
+			if pair.second == user.id {
+				m.follow(pair.first, user.id)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (m *memdb) VerifyUserEmail(ctx context.Context, dbUser DatabaseUser, email string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user := m.users[dbUser.Id]
+
+	if user == nil || user.email == "" || user.email != email {
+		return ErrEmailChanged
+	}
+
+	user.emailVerified = true
+
+	return nil
+}
+
+func (m *memdb) SetUserAvatar(ctx context.Context, dbUser DatabaseUser, avatar string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user := m.users[dbUser.Id]
+
+	if user == nil {
+		return "", ErrUserDoesNotExist
+	}
+
+	oldAvatar := user.avatar
+	user.avatar = avatar
+
+	return oldAvatar, nil
+}
+
+func (m *memdb) DeactivateUser(ctx context.Context, dbUser DatabaseUser, date time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user := m.users[dbUser.Id]
+
+	if user == nil || user.deactivatedAt != nil {
+		return ErrUserDoesNotExist
+	}
+
+	deactivatedAt := date.UTC().Truncate(time.Second)
+
+	user.deactivatedAt = &deactivatedAt
+
+	return nil
+}
+
+func (m *memdb) ReactivateUser(ctx context.Context, dbLogin DatabaseLogin, since time.Time) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user := m.userFromUsername(dbLogin.Username)
+
+	if user == nil || user.deactivatedAt == nil {
+		return nil, nil
+	}
+
+	if user.suspendedAt != nil {
+		return nil, ErrUserSuspended
+	}
+
+	for _, erasure := range m.erasures {
+		if erasure.User == user.id && erasure.CompletedAt == nil {
+			return nil, ErrErasurePending
+		}
+	}
+
+	// once the reactivation window is over the data and the files
+	// of the user are removed and they will be registered again
+	if user.deactivatedAt.Unix() < since.Unix() {
+		urls := m.userFileUrls(user.id)
+
+		m.deleteUser(user.id)
+
+		return urls, nil
+	}
+
+	user.deactivatedAt = nil
+
+	return nil, nil
+}
+
+func (m *memdb) GetUserList(ctx context.Context, dbUser DatabaseUser, dbLogin DatabaseLogin) (DatabaseUserList, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ids := make([]uint32, 0)
+
+	query := strings.ToLower(dbLogin.Username)
+
+	for id, user := range m.users {
+		if id == dbUser.Id || user.deactivatedAt != nil || m.bans[memPair{id, dbUser.Id}] {
+			continue
+		}
+
+		if strings.Contains(strings.ToLower(user.username), query) {
+			ids = append(ids, id)
+		}
+	}
+
+	return m.userList(ids), nil
+}
+
+func (m *memdb) SearchUsers(ctx context.Context, dbUser DatabaseUser, query string, limit int, after uint32) (DatabaseUserList, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	type result struct {
+		id       uint32
+		name     string
+		position int
+	}
+
+	query = strings.ToLower(query)
+
+	results := make([]result, 0)
+
+	for id, user := range m.users {
+		if id == dbUser.Id || user.deactivatedAt != nil || m.bans[memPair{id, dbUser.Id}] || m.bans[memPair{dbUser.Id, id}] {
+			continue
+		}
+
+		name := strings.ToLower(user.username)
+
+		switch {
+		case name == query:
+			results = append(results, result{id, name, 0})
+		case strings.HasPrefix(name, query):
+			results = append(results, result{id, name, 1})
+		case strings.Contains(name, query):
+			results = append(results, result{id, name, 2})
+		}
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].position != results[j].position {
+			return results[i].position < results[j].position
+		}
+
+		if results[i].name != results[j].name {
+			return results[i].name < results[j].name
+		}
+
+		return results[i].id < results[j].id
+	})
+
+	dbUserList := DatabaseUserListDefault()
+
+	start := 0
+
+	// the page starts right after the user `after`, and
+	// it is empty if the user is not among the results
+	if after != 0 {
+		start = len(results)
+
+		for i, r := range results {
+			if r.id == after {
+				start = i + 1
+			}
+		}
+	}
+
+	for _, r := range results[start:] {
+		if len(dbUserList.Users) == limit {
+			break
+		}
+
+		dbUserList.Users = append(dbUserList.Users, m.user(r.id))
+	}
+
+	return dbUserList, nil
+}
+
+// user returns the user `userId`, which must exist
+func (m *memdb) user(userId uint32) DatabaseUser {
+	dbUser := DatabaseUserDefault()
+
+	dbUser.Id = userId
+	dbUser.Username = m.users[userId].username
+	dbUser.DisplayName = m.users[userId].displayName
+	dbUser.Bio = m.users[userId].bio
+	dbUser.Website = m.users[userId].website
+	dbUser.Avatar = m.users[userId].avatar
+
+	return dbUser
+}
+
+// userFromUsername returns the user having the given username, or nil
+func (m *memdb) userFromUsername(username string) *memUser {
+	for _, user := range m.users {
+		if m.usernameKey(user.username) == m.usernameKey(username) {
+			return user
+		}
+	}
+
+	return nil
+}
+
+// userList returns the list of the given users sorted by id
+func (m *memdb) userList(ids []uint32) DatabaseUserList {
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i] < ids[j]
+	})
+
+	dbUserList := DatabaseUserListDefault()
+
+	for _, id := range ids {
+		dbUserList.Users = append(dbUserList.Users, m.user(id))
+	}
+
+	return dbUserList
+}
+
+// active reports whether the user `userId` exists and is not deactivated
+func (m *memdb) active(userId uint32) bool {
+	user := m.users[userId]
+
+	return user != nil && user.deactivatedAt == nil
+}
+
+// deleteUser removes the user `userId` together with everything
+// they posted and every relationship they are part of
+func (m *memdb) deleteUser(userId uint32) {
+	for id, photo := range m.photos {
+		if photo.user == userId {
+			m.deletePhoto(id)
+		}
+	}
+
+	for like := range m.likes {
+		if like.first == userId {
+			delete(m.likes, like)
+			delete(m.likeDates, like)
+		}
+	}
+
+	for id, album := range m.albums {
+		if album.user == userId {
+			delete(m.albums, id)
+		}
+	}
+
+	for id, story := range m.stories {
+		if story.user == userId {
+			delete(m.stories, id)
+		}
+	}
+
+	for id, comment := range m.comments {
+		if comment.user == userId {
+			m.deleteComment(id)
+		}
+	}
+
+	for id, notification := range m.notifications {
+		if notification.user == userId || notification.actor == userId {
+			delete(m.notifications, id)
+		}
+	}
+
+	for id, device := range m.devices {
+		if device.user == userId {
+			delete(m.devices, id)
+		}
+	}
+
+	for tokenHash, session := range m.sessions {
+		if session.user == userId {
+			m.deleteSession(tokenHash)
+		}
+	}
+
+	for identity, link := range m.identities {
+		if link.user == userId {
+			delete(m.identities, identity)
+		}
+	}
+
+	for keyHash, apiKey := range m.apiKeys {
+		if apiKey.user == userId {
+			delete(m.apiKeys, keyHash)
+		}
+	}
+
+	for key := range m.idempotencyKeys {
+		if key.user == userId {
+			delete(m.idempotencyKeys, key)
+		}
+	}
+
+	for pair := range m.follows {
+		if pair.first == userId || pair.second == userId {
+			delete(m.follows, pair)
+		}
+	}
+
+	for pair := range m.followRequests {
+		if pair.first == userId || pair.second == userId {
+			delete(m.followRequests, pair)
+		}
+	}
+
+	for pair := range m.bans {
+		if pair.first == userId || pair.second == userId {
+			delete(m.bans, pair)
+			delete(m.banDetails, pair)
+		}
+	}
+
+	for pair := range m.mutes {
+		if pair.first == userId || pair.second == userId {
+			delete(m.mutes, pair)
+		}
+	}
+
+	for pair := range m.closeFriends {
+		if pair.first == userId || pair.second == userId {
+			delete(m.closeFriends, pair)
+		}
+	}
+
+	for id, held := range m.heldComments {
+		if held.user == userId {
+			delete(m.heldComments, id)
+		}
+	}
+
+	history := m.usernameHistory[:0]
+
+	for _, change := range m.usernameHistory {
+		if change.user != userId {
+			history = append(history, change)
+		}
+	}
+
+	m.usernameHistory = history
+
+	delete(m.users, userId)
+}
+
+// Erasure
+
+func (m *memdb) RequestErasure(ctx context.Context, dbUser DatabaseUser, date time.Time) (DatabaseErasure, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user := m.users[dbUser.Id]
+
+	if user == nil {
+		return DatabaseErasureDefault(), ErrUserDoesNotExist
+	}
+
+	for _, erasure := range m.erasures {
+		if erasure.User == dbUser.Id && erasure.CompletedAt == nil {
+			return DatabaseErasureDefault(), ErrErasurePending
+		}
+	}
+
+	requestedAt := date.UTC().Truncate(time.Second)
+
+	if user.deactivatedAt == nil {
+		user.deactivatedAt = &requestedAt
+	}
+
+	for tokenHash, session := range m.sessions {
+		if session.user == dbUser.Id {
+			m.deleteSession(tokenHash)
+		}
+	}
+
+	m.lastErasureId++
+
+	dbErasure := DatabaseErasureDefault()
+	dbErasure.Id = m.lastErasureId
+	dbErasure.User = dbUser.Id
+	dbErasure.RequestedAt = requestedAt
+
+	erasure := dbErasure
+	m.erasures = append(m.erasures, &erasure)
+
+	return dbErasure, nil
+}
+
+func (m *memdb) GetPendingErasures(ctx context.Context, limit int) ([]DatabaseErasure, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	dbErasures := make([]DatabaseErasure, 0)
+
+	for _, erasure := range m.erasures {
+		if len(dbErasures) == limit {
+			break
+		}
+
+		if erasure.CompletedAt == nil {
+			dbErasures = append(dbErasures, *erasure)
+		}
+	}
+
+	return dbErasures, nil
+}
+
+func (m *memdb) EraseUser(ctx context.Context, dbErasure DatabaseErasure, date time.Time) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	urls := m.userFileUrls(dbErasure.User)
+
+	// the comments under the photos of the others are
+	// kept, credited to the deleted user instead
+	date = date.UTC().Truncate(time.Second)
+	deleted := m.userFromUsername(DeletedUsername)
+
+	if deleted == nil {
+		m.lastUserId++
+
+		deleted = &memUser{
+			id:            m.lastUserId,
+			username:      DeletedUsername,
+			deactivatedAt: &date,
+			suspendedAt:   &date,
+		}
+
+		m.users[deleted.id] = deleted
+	}
+
+	if deleted.suspendedAt != nil {
+		for _, comment := range m.comments {
+			if comment.user == dbErasure.User && m.photos[comment.photo].user != dbErasure.User {
+				comment.user = deleted.id
+			}
+		}
+	}
+
+	if m.users[dbErasure.User] != nil {
+		m.deleteUser(dbErasure.User)
+	}
+
+	for _, erasure := range m.erasures {
+		if erasure.Id == dbErasure.Id {
+			erasure.CompletedAt = &date
+		}
+	}
+
+	m.insertAudit(dbErasure.User, AuditEraseUser, dbErasure.User, "")
+
+	return urls, nil
+}
+
+func (m *memdb) GetErasures(ctx context.Context, limit int, after uint32) (DatabaseErasureList, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	dbErasureList := DatabaseErasureListDefault()
+
+	for _, erasure := range m.erasures {
+		if erasure.Id <= after {
+			continue
+		}
+
+		// one more erasure means that there is a next page
+		if len(dbErasureList.Erasures) == limit {
+			dbErasureList.NextCursor = dbErasureList.Erasures[limit-1].Id
+			break
+		}
+
+		dbErasureList.Erasures = append(dbErasureList.Erasures, *erasure)
+	}
+
+	return dbErasureList, nil
+}
+
+// Export
+
+func (m *memdb) GetExport(ctx context.Context, dbUser DatabaseUser) (DatabaseExport, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	dbExport := DatabaseExportDefault()
+	dbExport.User = dbUser
+
+	// the images of the user, archived ones included, without
+	// the scheduled photos and the videos, from the oldest
+	photos := make([]*memPhoto, 0)
+
+	for _, photo := range m.photos {
+		if photo.user == dbUser.Id && photo.mediaType == MediaImage && !photo.scheduled {
+			photos = append(photos, photo)
+		}
+	}
+
+	sort.Slice(photos, func(i, j int) bool {
+		if !photos[i].date.Equal(photos[j].date) {
+			return photos[i].date.Before(photos[j].date)
+		}
+
+		return photos[i].id < photos[j].id
+	})
+
+	for _, photo := range photos {
+		dbExportPhoto := DatabaseExportPhotoDefault()
+
+		dbPhoto, err := m.photo(photo.id, dbUser.Id)
+
+		if err != nil {
+			return dbExport, err
+		}
+
+		dbExportPhoto.Photo = dbPhoto
+
+		// the comments under the photo, from the oldest,
+		// without the comments of shadow banned users
+		comments := make([]*memComment, 0)
+
+		for _, comment := range m.comments {
+			if comment.photo == photo.id && !m.shadowHidden(comment.user, dbUser.Id) {
+				comments = append(comments, comment)
+			}
+		}
+
+		sort.Slice(comments, func(i, j int) bool {
+			if !comments[i].date.Equal(comments[j].date) {
+				return comments[i].date.Before(comments[j].date)
+			}
+
+			return comments[i].id < comments[j].id
+		})
+
+		for _, comment := range comments {
+			dbComment := DatabaseCommentDefault()
+
+			dbComment.Id = comment.id
+			dbComment.User.Id = comment.user
+			dbComment.User.Username = m.users[comment.user].username
+			dbComment.Photo.Id = comment.photo
+			dbComment.Date = comment.date
+			dbComment.CommentBody = comment.body
+
+			dbExportPhoto.Comments = append(dbExportPhoto.Comments, dbComment)
+		}
+
+		dbExport.Photos = append(dbExport.Photos, dbExportPhoto)
+	}
+
+	return dbExport, nil
+}
+
+func (m *memdb) GetImportedPhotos(ctx context.Context, dbUser DatabaseUser, source string) (map[uint32]uint32, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	imported := make(map[uint32]uint32)
+
+	for key, photoId := range m.imports {
+		if key.user == dbUser.Id && key.source == source && m.photos[photoId] != nil {
+			imported[key.sourceId] = photoId
+		}
+	}
+
+	return imported, nil
+}
+
+func (m *memdb) ImportPhoto(ctx context.Context, dbImport *DatabaseImport) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	dbPhoto := &dbImport.Photo
+
+	if m.users[dbPhoto.User.Id] == nil {
+		return ErrUserDoesNotExist
+	}
+
+	key := memImport{dbPhoto.User.Id, dbImport.Source, dbImport.SourceId}
+
+	// the record of an import goes away with its photo, like
+	// the foreign key of the SQL implementations
+	if photoId, ok := m.imports[key]; ok && m.photos[photoId] != nil {
+		return ErrPhotoAlreadyImported
+	}
+
+	m.lastPhotoId++
+
+	dbPhoto.Id = m.lastPhotoId
+
+	photo := &memPhoto{
+		id:           dbPhoto.Id,
+		user:         dbPhoto.User.Id,
+		url:          dbPhoto.Url,
+		date:         dbPhoto.Date.UTC().Truncate(time.Second),
+		archived:     dbPhoto.Archived,
+		closeFriends: dbPhoto.CloseFriends,
+		flagged:      dbPhoto.Flagged,
+		mediaType:    MediaImage,
+		altText:      dbPhoto.AltText,
+	}
+
+	if dbPhoto.Hash != nil {
+		hash := *dbPhoto.Hash
+		photo.hash = &hash
+	}
+
+	if dbPhoto.Latitude != nil && dbPhoto.Longitude != nil {
+		latitude, longitude := *dbPhoto.Latitude, *dbPhoto.Longitude
+		photo.latitude, photo.longitude = &latitude, &longitude
+	}
+
+	photo.place, _ = NormalizePlace(dbPhoto.Place)
+
+	m.photos[dbPhoto.Id] = photo
+
+	for i := range dbImport.Comments {
+		dbComment := &dbImport.Comments[i]
+		dbComment.Photo.Id = dbPhoto.Id
+
+		// the comments are the ones the exported account wrote,
+		// which become comments of the user, notifying no one
+		dbComment.User = dbPhoto.User
+
+		m.addComment(dbComment)
+	}
+
+	m.imports[key] = dbPhoto.Id
+
+	return nil
+}
+
+// Webhook
+
+func (m *memdb) GetWebhooks(ctx context.Context) ([]DatabaseWebhook, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	dbWebhooks := make([]DatabaseWebhook, 0)
+
+	for _, webhook := range m.webhooks {
+		dbWebhooks = append(dbWebhooks, copyWebhook(webhook))
+	}
+
+	sort.Slice(dbWebhooks, func(i, j int) bool {
+		return dbWebhooks[i].Id < dbWebhooks[j].Id
+	})
+
+	return dbWebhooks, nil
+}
+
+func (m *memdb) GetWebhook(ctx context.Context, webhookId uint32) (DatabaseWebhook, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	webhook := m.webhooks[webhookId]
+
+	if webhook == nil {
+		return DatabaseWebhookDefault(), ErrWebhookDoesNotExist
+	}
+
+	return copyWebhook(webhook), nil
+}
+
+// copyWebhook returns a copy of the webhook, with its events sorted by name
+func copyWebhook(webhook *DatabaseWebhook) DatabaseWebhook {
+	dbWebhook := *webhook
+	dbWebhook.Events = append([]string{}, webhook.Events...)
+
+	sort.Strings(dbWebhook.Events)
+
+	return dbWebhook
+}
+
+func (m *memdb) InsertWebhook(ctx context.Context, dbWebhook *DatabaseWebhook) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.lastWebhookId++
+	dbWebhook.Id = m.lastWebhookId
+
+	webhook := *dbWebhook
+	webhook.Events = make([]string, 0)
+
+	for _, event := range dbWebhook.Events {
+		if !containsString(webhook.Events, event) {
+			webhook.Events = append(webhook.Events, event)
+		}
+	}
+
+	m.webhooks[webhook.Id] = &webhook
+
+	return nil
+}
+
+func (m *memdb) DeleteWebhook(ctx context.Context, webhookId uint32) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.webhooks[webhookId] == nil {
+		return ErrWebhookDoesNotExist
+	}
+
+	delete(m.webhooks, webhookId)
+
+	// the deliveries go with their webhook
+	deliveries := make([]*DatabaseWebhookDelivery, 0, len(m.webhookDeliveries))
+
+	for _, delivery := range m.webhookDeliveries {
+		if delivery.Webhook != webhookId {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+
+	m.webhookDeliveries = deliveries
+
+	return nil
+}
+
+func (m *memdb) InsertWebhookEvent(ctx context.Context, dbEvent DatabaseWebhookEvent) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if actor := m.users[dbEvent.Actor]; actor != nil && actor.shadowBanned {
+		return nil
+	}
+
+	date := dbEvent.Date.UTC().Truncate(time.Second)
+
+	for _, dbWebhook := range m.sortedWebhooks() {
+		if !containsString(dbWebhook.Events, dbEvent.Event) {
+			continue
+		}
+
+		m.lastDeliveryId++
+
+		delivery := DatabaseWebhookDeliveryDefault()
+		delivery.Id = m.lastDeliveryId
+		delivery.Webhook = dbWebhook.Id
+		delivery.Event = dbEvent.Event
+		delivery.Payload = dbEvent.Payload
+		delivery.Date = date
+
+		next := date
+		delivery.NextAttemptAt = &next
+
+		m.webhookDeliveries = append(m.webhookDeliveries, &delivery)
+	}
+
+	return nil
+}
+
+// containsString returns whether the strings contain `value`
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// sortedWebhooks returns the webhooks sorted by id
+func (m *memdb) sortedWebhooks() []*DatabaseWebhook {
+	webhooks := make([]*DatabaseWebhook, 0, len(m.webhooks))
+
+	for _, webhook := range m.webhooks {
+		webhooks = append(webhooks, webhook)
+	}
+
+	sort.Slice(webhooks, func(i, j int) bool {
+		return webhooks[i].Id < webhooks[j].Id
+	})
+
+	return webhooks
+}
+
+func (m *memdb) TakeWebhookDeliveries(ctx context.Context, now time.Time, lease time.Time, limit int) ([]DatabaseWebhookDelivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	due := make([]*DatabaseWebhookDelivery, 0)
+
+	for _, delivery := range m.webhookDeliveries {
+		if delivery.NextAttemptAt != nil && delivery.NextAttemptAt.Unix() <= now.Unix() {
+			due = append(due, delivery)
+		}
+	}
+
+	sort.SliceStable(due, func(i, j int) bool {
+		return due[i].NextAttemptAt.Before(*due[j].NextAttemptAt)
+	})
+
+	if len(due) > limit {
+		due = due[:limit]
+	}
+
+	dbDeliveries := make([]DatabaseWebhookDelivery, 0, len(due))
+
+	for _, delivery := range due {
+		next := lease.UTC().Truncate(time.Second)
+		delivery.NextAttemptAt = &next
+
+		dbDeliveries = append(dbDeliveries, *delivery)
+	}
+
+	sort.Slice(dbDeliveries, func(i, j int) bool {
+		return dbDeliveries[i].Id < dbDeliveries[j].Id
+	})
+
+	return dbDeliveries, nil
+}
+
+func (m *memdb) UpdateWebhookDelivery(ctx context.Context, dbDelivery DatabaseWebhookDelivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, delivery := range m.webhookDeliveries {
+		if delivery.Id == dbDelivery.Id {
+			delivery.Attempts = dbDelivery.Attempts
+			delivery.NextAttemptAt = dbDelivery.NextAttemptAt
+			delivery.DeliveredAt = dbDelivery.DeliveredAt
+			delivery.StatusCode = dbDelivery.StatusCode
+			delivery.Error = dbDelivery.Error
+		}
+	}
+
+	return nil
+}
+
+func (m *memdb) GetWebhookDeliveries(ctx context.Context, webhookId uint32, limit int, before uint32) (DatabaseWebhookDeliveryList, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	dbDeliveryList := DatabaseWebhookDeliveryListDefault()
+
+	// the deliveries are appended in order, hence
+	// they are read backwards, from the newest
+	for i := len(m.webhookDeliveries) - 1; i >= 0 && len(dbDeliveryList.Deliveries) < limit; i-- {
+		delivery := m.webhookDeliveries[i]
+
+		if delivery.Webhook == webhookId && (before == 0 || delivery.Id < before) {
+			dbDeliveryList.Deliveries = append(dbDeliveryList.Deliveries, *delivery)
+		}
+	}
+
+	return dbDeliveryList, nil
+}
+
+func (m *memdb) DeleteOldWebhookDeliveries(ctx context.Context, before time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	deliveries := make([]*DatabaseWebhookDelivery, 0, len(m.webhookDeliveries))
+
+	for _, delivery := range m.webhookDeliveries {
+		if delivery.Date.Before(before) && delivery.NextAttemptAt == nil {
+			continue
+		}
+
+		deliveries = append(deliveries, delivery)
+	}
+
+	deleted := len(m.webhookDeliveries) - len(deliveries)
+	m.webhookDeliveries = deliveries
+
+	return deleted, nil
+}
+
+// Idempotency key
+
+func (m *memdb) ReserveIdempotencyKey(ctx context.Context, dbKey DatabaseIdempotencyKey, expired time.Time, abandoned time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.users[dbKey.User] == nil {
+		return ErrUserDoesNotExist
+	}
+
+	key := memIdempotencyKey{dbKey.User, dbKey.Key}
+
+	if stored := m.idempotencyKeys[key]; stored != nil && !stored.Date.Before(expired) && (stored.Status != 0 || !stored.Date.Before(abandoned)) {
+		return ErrIdempotencyKeyInUse
+	}
+
+	m.idempotencyKeys[key] = &DatabaseIdempotencyKey{
+		User:        dbKey.User,
+		Key:         dbKey.Key,
+		Fingerprint: dbKey.Fingerprint,
+		Date:        dbKey.Date,
+	}
+
+	return nil
+}
+
+func (m *memdb) GetIdempotencyKey(ctx context.Context, userId uint32, key string) (DatabaseIdempotencyKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored := m.idempotencyKeys[memIdempotencyKey{userId, key}]
+
+	if stored == nil {
+		return DatabaseIdempotencyKeyDefault(), ErrIdempotencyKeyDoesNotExist
+	}
+
+	dbKey := *stored
+	dbKey.Body = append([]byte(nil), stored.Body...)
+
+	return dbKey, nil
+}
+
+func (m *memdb) CompleteIdempotencyKey(ctx context.Context, dbKey DatabaseIdempotencyKey) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored := m.idempotencyKeys[memIdempotencyKey{dbKey.User, dbKey.Key}]
+
+	if stored == nil || stored.Fingerprint != dbKey.Fingerprint {
+		return ErrIdempotencyKeyDoesNotExist
+	}
+
+	stored.Status = dbKey.Status
+	stored.ContentType = dbKey.ContentType
+	stored.Body = append([]byte(nil), dbKey.Body...)
+
+	return nil
+}
+
+func (m *memdb) DeleteIdempotencyKey(ctx context.Context, userId uint32, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.idempotencyKeys, memIdempotencyKey{userId, key})
+
+	return nil
+}
+
+func (m *memdb) DeleteExpiredIdempotencyKeys(ctx context.Context, before time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	deleted := 0
+
+	for key, stored := range m.idempotencyKeys {
+		if stored.Date.Before(before) {
+			delete(m.idempotencyKeys, key)
+			deleted++
+		}
+	}
+
+	return deleted, nil
+}
+
+// Admin
+
+func (m *memdb) GetAdminUserList(ctx context.Context, query string, limit int, after uint32) (DatabaseAdminUserList, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	dbAdminUserList := DatabaseAdminUserListDefault()
+
+	ids := make([]uint32, 0)
+
+	for id, user := range m.users {
+		if id > after && strings.Contains(strings.ToLower(user.username), strings.ToLower(query)) {
+			ids = append(ids, id)
+		}
+	}
+
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i] < ids[j]
+	})
+
+	for _, id := range ids {
+		user := m.users[id]
+
+		dbAdminUser := DatabaseAdminUserDefault()
+
+		dbAdminUser.User = m.user(id)
+		dbAdminUser.Email = user.email
+		dbAdminUser.EmailVerified = user.emailVerified
+		dbAdminUser.DeactivatedAt = user.deactivatedAt
+		dbAdminUser.SuspendedAt = user.suspendedAt
+		dbAdminUser.ShadowBanned = user.shadowBanned
+
+		dbAdminUserList.Users = append(dbAdminUserList.Users, dbAdminUser)
+	}
+
+	// if there is a next page, its cursor
+	// is the last user of the current one
+	if len(dbAdminUserList.Users) > limit {
+		dbAdminUserList.Users = dbAdminUserList.Users[:limit]
+		dbAdminUserList.NextCursor = dbAdminUserList.Users[limit-1].User.Id
+	}
+
+	return dbAdminUserList, nil
+}
+
+func (m *memdb) SuspendUser(ctx context.Context, dbUser DatabaseUser, date time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user := m.users[dbUser.Id]
+
+	if user == nil {
+		return ErrUserDoesNotExist
+	}
+
+	if user.suspendedAt != nil {
+		return nil
+	}
+
+	suspendedAt := date.UTC().Truncate(time.Second)
+
+	user.suspendedAt = &suspendedAt
+
+	if user.deactivatedAt == nil {
+		user.deactivatedAt = &suspendedAt
+	}
+
+	for tokenHash, session := range m.sessions {
+		if session.user == dbUser.Id {
+			m.deleteSession(tokenHash)
+		}
+	}
+
+	for keyHash, apiKey := range m.apiKeys {
+		if apiKey.user == dbUser.Id {
+			delete(m.apiKeys, keyHash)
+		}
+	}
+
+	m.insertAudit(AuditAdmin, AuditSuspendUser, dbUser.Id, dbUser.Username)
+
+	return nil
+}
+
+func (m *memdb) UnsuspendUser(ctx context.Context, dbUser DatabaseUser) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user := m.users[dbUser.Id]
+
+	if user == nil || user.suspendedAt == nil {
+		return ErrUserNotSuspended
+	}
+
+	user.suspendedAt = nil
+	user.deactivatedAt = nil
+
+	m.insertAudit(AuditAdmin, AuditUnsuspendUser, dbUser.Id, dbUser.Username)
+
+	return nil
+}
+
+func (m *memdb) ShadowBanUser(ctx context.Context, dbUser DatabaseUser) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user := m.users[dbUser.Id]
+
+	if user == nil {
+		return ErrUserDoesNotExist
+	}
+
+	if user.shadowBanned {
+		return nil
+	}
+
+	user.shadowBanned = true
+
+	m.insertAudit(AuditAdmin, AuditShadowBanUser, dbUser.Id, dbUser.Username)
+
+	return nil
+}
+
+func (m *memdb) UnshadowBanUser(ctx context.Context, dbUser DatabaseUser) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user := m.users[dbUser.Id]
+
+	if user == nil || !user.shadowBanned {
+		return ErrUserNotShadowBanned
+	}
+
+	user.shadowBanned = false
+
+	m.insertAudit(AuditAdmin, AuditUnshadowBanUser, dbUser.Id, dbUser.Username)
+
+	return nil
+}
+
+func (m *memdb) ForceDeletePhoto(ctx context.Context, photoId uint32) (DatabasePhoto, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	photo := m.photos[photoId]
+
+	if photo == nil {
+		return DatabasePhotoDefault(), ErrPhotoDoesNotExist
+	}
+
+	dbPhoto := DatabasePhotoDefault()
+
+	dbPhoto.Id = photo.id
+	dbPhoto.User.Id = photo.user
+	dbPhoto.Url = photo.url
+	dbPhoto.MediaType = photo.mediaType
+	dbPhoto.PosterUrl = photo.posterUrl
+	dbPhoto.OriginalUrl = photo.originalUrl
+
+	m.deletePhoto(photo.id)
+
+	m.insertAudit(AuditAdmin, AuditAdminDeletePhoto, dbPhoto.Id, dbPhoto.Url)
+
+	return dbPhoto, nil
+}
+
+func (m *memdb) ForceDeleteComment(ctx context.Context, commentId uint32) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	comment := m.comments[commentId]
+
+	if comment == nil {
+		return ErrCommentDoesNotExist
+	}
+
+	m.deleteComment(comment.id)
+
+	m.insertAudit(AuditAdmin, AuditAdminDeleteComment, comment.id, comment.body)
+
+	return nil
+}
+
+func (m *memdb) GetFlaggedPhotos(ctx context.Context, limit int, after uint32) (DatabaseFlaggedPhotoList, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	dbFlaggedPhotoList := DatabaseFlaggedPhotoListDefault()
+
+	ids := make([]uint32, 0)
+
+	for id, photo := range m.photos {
+		if id > after && photo.flagged {
+			ids = append(ids, id)
+		}
+	}
+
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i] < ids[j]
+	})
+
+	for _, id := range ids {
+		// the photos are loaded as their owner sees them
+		dbPhoto, err := m.photo(id, m.photos[id].user)
+
+		if err != nil {
+			return dbFlaggedPhotoList, err
+		}
+
+		dbFlaggedPhotoList.Photos = append(dbFlaggedPhotoList.Photos, dbPhoto)
+	}
+
+	// if there is a next page, its cursor
+	// is the last photo of the current one
+	if len(dbFlaggedPhotoList.Photos) > limit {
+		dbFlaggedPhotoList.Photos = dbFlaggedPhotoList.Photos[:limit]
+		dbFlaggedPhotoList.NextCursor = dbFlaggedPhotoList.Photos[limit-1].Id
+	}
+
+	return dbFlaggedPhotoList, nil
+}
+
+func (m *memdb) UnflagPhoto(ctx context.Context, photoId uint32) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	photo := m.photos[photoId]
+
+	if photo == nil || !photo.flagged {
+		return ErrPhotoNotFlagged
+	}
+
+	photo.flagged = false
+
+	m.insertAudit(AuditAdmin, AuditUnflagPhoto, photo.id, photo.url)
+
+	return nil
+}
+
+// Blocklist
+
+func (m *memdb) GetBlockedTerms(ctx context.Context) ([]DatabaseBlockedTerm, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	dbBlockedTerms := make([]DatabaseBlockedTerm, 0)
+
+	for _, term := range m.blockedTerms {
+		dbBlockedTerms = append(dbBlockedTerms, *term)
+	}
+
+	sort.Slice(dbBlockedTerms, func(i, j int) bool {
+		return dbBlockedTerms[i].Id < dbBlockedTerms[j].Id
+	})
+
+	return dbBlockedTerms, nil
+}
+
+func (m *memdb) InsertBlockedTerm(ctx context.Context, dbBlockedTerm *DatabaseBlockedTerm) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, term := range m.blockedTerms {
+		if term.Term == dbBlockedTerm.Term && term.Pattern == dbBlockedTerm.Pattern {
+			return ErrBlockedTermAlreadyExists
+		}
+	}
+
+	m.lastBlockedTermId++
+
+	dbBlockedTerm.Id = m.lastBlockedTermId
+
+	term := *dbBlockedTerm
+	m.blockedTerms[term.Id] = &term
+
+	m.insertAudit(AuditAdmin, AuditBlockTerm, term.Id, term.Term)
+
+	return nil
+}
+
+func (m *memdb) DeleteBlockedTerm(ctx context.Context, termId uint32) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	term := m.blockedTerms[termId]
+
+	if term == nil {
+		return ErrBlockedTermDoesNotExist
+	}
+
+	delete(m.blockedTerms, termId)
+
+	m.insertAudit(AuditAdmin, AuditUnblockTerm, term.Id, term.Term)
+
+	return nil
+}
+
+func (m *memdb) InsertHeldComment(ctx context.Context, dbHeldComment *DatabaseHeldComment) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.users[dbHeldComment.User.Id] == nil {
+		return ErrUserDoesNotExist
+	}
+
+	if m.photos[dbHeldComment.Photo.Id] == nil {
+		return ErrPhotoDoesNotExist
+	}
+
+	m.lastHeldCommentId++
+
+	dbHeldComment.Id = m.lastHeldCommentId
+
+	m.heldComments[dbHeldComment.Id] = &memHeldComment{
+		id:    dbHeldComment.Id,
+		user:  dbHeldComment.User.Id,
+		photo: dbHeldComment.Photo.Id,
+		date:  dbHeldComment.Date.UTC().Truncate(time.Second),
+		body:  dbHeldComment.CommentBody,
+		term:  dbHeldComment.Term,
+	}
+
+	return nil
+}
+
+func (m *memdb) GetHeldCommentList(ctx context.Context, limit int, after uint32) (DatabaseHeldCommentList, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	dbHeldCommentList := DatabaseHeldCommentListDefault()
+
+	ids := make([]uint32, 0)
+
+	for id := range m.heldComments {
+		if id > after {
+			ids = append(ids, id)
+		}
+	}
+
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i] < ids[j]
+	})
+
+	for _, id := range ids {
+		held := m.heldComments[id]
+
+		dbHeldComment := DatabaseHeldCommentDefault()
+
+		dbHeldComment.Id = held.id
+		dbHeldComment.User = m.user(held.user)
+		photo := m.photos[held.photo]
+
+		dbHeldComment.Photo.Id = photo.id
+		dbHeldComment.Photo.User = m.user(photo.user)
+		dbHeldComment.Photo.Url = photo.url
+		dbHeldComment.Photo.Date = photo.date
+		dbHeldComment.Date = held.date
+		dbHeldComment.CommentBody = held.body
+		dbHeldComment.Term = held.term
+
+		dbHeldCommentList.Comments = append(dbHeldCommentList.Comments, dbHeldComment)
+	}
+
+	// if there is a next page, its cursor
+	// is the last comment of the current one
+	if len(dbHeldCommentList.Comments) > limit {
+		dbHeldCommentList.Comments = dbHeldCommentList.Comments[:limit]
+		dbHeldCommentList.NextCursor = dbHeldCommentList.Comments[limit-1].Id
+	}
+
+	return dbHeldCommentList, nil
+}
+
+func (m *memdb) ReleaseHeldComment(ctx context.Context, heldId uint32) (DatabaseComment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	held := m.heldComments[heldId]
+
+	if held == nil {
+		return DatabaseCommentDefault(), ErrHeldCommentDoesNotExist
+	}
+
+	delete(m.heldComments, heldId)
+
+	dbComment := DatabaseCommentDefault()
+
+	dbComment.User.Id = held.user
+	dbComment.Photo.Id = held.photo
+	dbComment.Date = held.date
+	dbComment.CommentBody = held.body
+
+	m.insertComment(&dbComment)
+
+	m.insertAudit(AuditAdmin, AuditApproveComment, dbComment.Id, dbComment.CommentBody)
+
+	return dbComment, nil
+}
+
+func (m *memdb) DeleteHeldComment(ctx context.Context, heldId uint32) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	held := m.heldComments[heldId]
+
+	if held == nil {
+		return ErrHeldCommentDoesNotExist
+	}
+
+	delete(m.heldComments, heldId)
+
+	m.insertAudit(AuditAdmin, AuditRejectComment, held.id, held.body)
+
+	return nil
+}
+
+// Reserved names
+
+func (m *memdb) GetReservedNames(ctx context.Context) ([]DatabaseReservedName, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	dbReservedNames := make([]DatabaseReservedName, 0)
+
+	for _, name := range m.reservedNames {
+		dbReservedNames = append(dbReservedNames, *name)
+	}
+
+	sort.Slice(dbReservedNames, func(i, j int) bool {
+		return dbReservedNames[i].Id < dbReservedNames[j].Id
+	})
+
+	return dbReservedNames, nil
+}
+
+func (m *memdb) InsertReservedName(ctx context.Context, dbReservedName *DatabaseReservedName) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, name := range m.reservedNames {
+		if name.Name == dbReservedName.Name && name.Contained == dbReservedName.Contained {
+			return ErrReservedNameAlreadyExists
+		}
+	}
+
+	m.lastReservedNameId++
+
+	dbReservedName.Id = m.lastReservedNameId
+
+	name := *dbReservedName
+	m.reservedNames[name.Id] = &name
+
+	m.insertAudit(AuditAdmin, AuditReserveName, name.Id, name.Name)
+
+	return nil
+}
+
+func (m *memdb) DeleteReservedName(ctx context.Context, nameId uint32) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name := m.reservedNames[nameId]
+
+	if name == nil {
+		return ErrReservedNameDoesNotExist
+	}
+
+	delete(m.reservedNames, nameId)
+
+	m.insertAudit(AuditAdmin, AuditUnreserveName, name.Id, name.Name)
+
+	return nil
+}
+
+// Audit
+
+func (m *memdb) GetAuditLog(ctx context.Context, actor uint32, action string, limit int, before uint32) (DatabaseAuditLog, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	dbAuditLog := DatabaseAuditLogDefault()
+
+	// the entries are appended in order, hence the log is
+	// read backwards, starting right before the entry `before`
+	end := len(m.audit)
+
+	if before != 0 {
+		end = 0
+
+		for i, dbAuditEntry := range m.audit {
+			if dbAuditEntry.Id == before {
+				end = i
+			}
+		}
+	}
+
+	for i := end - 1; i >= 0 && len(dbAuditLog.Entries) < limit; i-- {
+		dbAuditEntry := m.audit[i]
+
+		if (actor == 0 || dbAuditEntry.Actor == actor) && (action == "" || dbAuditEntry.Action == action) {
+			dbAuditLog.Entries = append(dbAuditLog.Entries, dbAuditEntry)
+		}
+	}
+
+	return dbAuditLog, nil
+}
+
+// insertAudit records in the audit log that the user `actor` performed `action` on `target` right now
+func (m *memdb) insertAudit(actor uint32, action string, target uint32, details string) {
+	dbAuditEntry := DatabaseAuditEntryDefault()
+
+	dbAuditEntry.Id = uint32(len(m.audit)) + 1
+	dbAuditEntry.Actor = actor
+	dbAuditEntry.Action = action
+	dbAuditEntry.Target = target
+	dbAuditEntry.Details = details
+	dbAuditEntry.Date = globaltime.Now().UTC().Truncate(time.Second)
+
+	m.audit = append(m.audit, dbAuditEntry)
+}
+
+// Liveness
+
+func (m *memdb) Ping(ctx context.Context) error {
+	return nil
+}
+
+// SchemaVersion reports memdb as up to date, since it has no structure to migrate
+func (m *memdb) SchemaVersion(ctx context.Context) (int, int, error) {
+	return 0, 0, nil
+}
+
+// Backup is not supported, since memdb has no file to copy
+func (m *memdb) Backup(ctx context.Context, path string) error {
+	return ErrBackupUnsupported
+}
+
+// QueryStats is always empty, since memdb runs no queries
+func (m *memdb) QueryStats() map[string]QueryStats {
+	return make(map[string]QueryStats)
+}
+
+// UseCache does nothing, since memdb is already in memory
+func (m *memdb) UseCache(c cache.Cache, ttl CacheTTL) {}
+
+// Usernames
+
+func (m *memdb) UseUsernameKey(ctx context.Context, key func(string) string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	keys := make(map[string]string)
+
+	for _, user := range m.users {
+		other, ok := keys[key(user.username)]
+
+		if ok {
+			return fmt.Errorf("the usernames %q and %q have the same key under the username policy", other, user.username)
+		}
+
+		keys[key(user.username)] = user.username
+	}
+
+	m.usernameKey = key
+
+	return nil
+}
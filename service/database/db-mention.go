@@ -0,0 +1,158 @@
+package database
+
+import (
+	"context"
+	"regexp"
+	"strings"
+)
+
+// mentionPattern matches a @ followed by the characters of a username, as long
+// as it does not continue a word (eg. the domain of an email address)
+var mentionPattern = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_.@])@([\p{L}\p{N}_.]+)`)
+
+// ParseMentions returns the distinct usernames mentioned in the text, without the leading @, in the order they first
+// appear. The dots ending a mention are left out, since they usually end the sentence.
+func ParseMentions(text string) []string {
+	usernames := make([]string, 0)
+	seen := make(map[string]bool)
+
+	for _, match := range mentionPattern.FindAllStringSubmatch(text, -1) {
+		username := strings.TrimRight(match[1], ".")
+
+		if username != "" && !seen[username] {
+			seen[username] = true
+			usernames = append(usernames, username)
+		}
+	}
+
+	return usernames
+}
+
+// insertMentionsTx records the users mentioned in the body of the comment within the given transaction, looking them up
+// by the key of the username given by `usernameKey`. The mentions of users who do not exist, are deactivated, banned the
+// author of the comment or do not let them mention them are ignored, as is the author mentioning themselves.
+func insertMentionsTx(ctx context.Context, tx *dbtx, dbComment DatabaseComment, usernameKey func(string) string) error {
+	for _, username := range ParseMentions(dbComment.CommentBody) {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO mention(comment, "user")
+			SELECT ?, id
+			FROM "User"
+			WHERE username_key=?
+			AND deactivated_at IS NULL
+			AND id<>?
+			AND id NOT IN (
+				SELECT first_user
+				FROM ban
+				WHERE second_user=?
+			)
+			AND id NOT IN (
+				SELECT "user"
+				FROM settings
+				WHERE mention_policy='nobody'
+				OR (
+					mention_policy='followers'
+					AND "user" NOT IN (
+						SELECT second_user
+						FROM follow
+						WHERE first_user=?
+					)
+				)
+			)
+		`, dbComment.Id, usernameKey(username), dbComment.User.Id, dbComment.User.Id, dbComment.User.Id)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (db *appdbimpl) GetMentions(ctx context.Context, dbUser DatabaseUser, limit int, before uint32) (DatabaseCommentList, error) {
+	dbCommentList := DatabaseCommentListDefault()
+
+	// get a page of at most `limit` comments mentioning the
+	// user, from the newest to the oldest, keeping only the
+	// comments older than the comment `before` (if it is
+	// not 0); the comments of users who banned the user or
+	// were banned by them or who are shadow banned, and the
+	// comments under photos the user cannot see are not
+	// considered
+	rows, err := db.read().QueryContext(ctx, `
+		SELECT id, "user", photo, date, comment_body
+		FROM Comment
+		WHERE id IN (
+			SELECT comment
+			FROM mention
+			WHERE "user"=?
+		)
+		AND "user" NOT IN (
+			SELECT first_user
+			FROM ban
+			WHERE second_user=?
+			UNION
+			SELECT second_user
+			FROM ban
+			WHERE first_user=?
+		)
+		AND `+visibleComment+`
+		AND photo IN (
+			SELECT id
+			FROM Photo
+			WHERE (NOT archived OR "user"=?)
+			AND `+visiblePhoto+`
+			AND "user" NOT IN (
+				SELECT first_user
+				FROM ban
+				WHERE second_user=?
+			)
+		)
+		AND (
+			?=0
+			OR (date, id) < (
+				SELECT date, id
+				FROM Comment
+				WHERE id=?
+			)
+		)
+		ORDER BY date DESC, id DESC
+		LIMIT ?
+	`, dbUser.Id, dbUser.Id, dbUser.Id, dbUser.Id, dbUser.Id, dbUser.Id, dbUser.Id, dbUser.Id, dbUser.Id, before, before, limit)
+
+	if err != nil {
+		return dbCommentList, err
+	}
+
+	// build the comment list
+	for rows.Next() {
+		dbComment := DatabaseCommentDefault()
+
+		err = rows.Scan(&dbComment.Id, &dbComment.User.Id, &dbComment.Photo.Id, unixTime{&dbComment.Date}, &dbComment.CommentBody)
+
+		if err != nil {
+			return dbCommentList, err
+		}
+
+		dbComment.User, err = db.GetDatabaseUser(ctx, dbComment.User.Id)
+
+		if err != nil {
+			return dbCommentList, err
+		}
+
+		dbComment.Photo, err = db.GetDatabasePhoto(ctx, dbComment.Photo.Id, dbUser)
+
+		if err != nil {
+			return dbCommentList, err
+		}
+
+		dbCommentList.Comments = append(dbCommentList.Comments, dbComment)
+	}
+
+	if rows.Err() != nil {
+		return dbCommentList, err
+	}
+
+	_ = rows.Close()
+
+	return dbCommentList, err
+}
@@ -0,0 +1,193 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/tracing"
+)
+
+// QueryStats holds the counters collected for the queries issued by the same method of the database.
+type QueryStats struct {
+	// Calls is the number of queries run
+	Calls uint64
+
+	// Errors is the number of queries which failed
+	Errors uint64
+
+	// Rows is the number of rows read or affected by the queries
+	Rows uint64
+
+	// Duration is the total time spent running the queries
+	Duration time.Duration
+
+	// MaxDuration is the time spent running the slowest query
+	MaxDuration time.Duration
+}
+
+// metrics collects the QueryStats of the queries run through a dbconn
+type metrics struct {
+	mu    sync.Mutex
+	stats map[string]*QueryStats
+
+	// names caches the query name of each caller
+	names sync.Map
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		stats: make(map[string]*QueryStats),
+	}
+}
+
+// record adds to the counters of `name` a query started at `start`
+// which read or affected `rows` rows and ended with `err`
+func (m *metrics) record(name string, start time.Time, rows int64, err error) {
+	duration := time.Since(start)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stats, ok := m.stats[name]
+
+	if !ok {
+		stats = &QueryStats{}
+		m.stats[name] = stats
+	}
+
+	stats.Calls++
+	stats.Duration += duration
+
+	if duration > stats.MaxDuration {
+		stats.MaxDuration = duration
+	}
+
+	if err != nil {
+		stats.Errors++
+	}
+
+	if rows > 0 {
+		stats.Rows += uint64(rows)
+	}
+}
+
+// snapshot returns a copy of the counters, indexed by query name
+func (m *metrics) snapshot() map[string]QueryStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stats := make(map[string]QueryStats, len(m.stats))
+
+	for name, s := range m.stats {
+		stats[name] = *s
+	}
+
+	return stats
+}
+
+// name returns the name of the method of the package which issued the query,
+// skipping `skip` stack frames above the caller of name; the closures passed
+// to withTx are named after the method creating them
+func (m *metrics) name(skip int) string {
+	pc, _, _, ok := runtime.Caller(skip + 1)
+
+	if !ok {
+		return "unknown"
+	}
+
+	if name, ok := m.names.Load(pc); ok {
+		return name.(string)
+	}
+
+	name := "unknown"
+
+	if fn := runtime.FuncForPC(pc); fn != nil {
+		// eg. "<module>/service/database.(*appdbimpl).InsertLike.func1"
+		parts := strings.Split(fn.Name()[strings.LastIndex(fn.Name(), "/")+1:], ".")
+
+		for _, part := range parts[1:] {
+			if !strings.HasPrefix(part, "(") {
+				name = part
+				break
+			}
+		}
+	}
+
+	m.names.Store(pc, name)
+
+	return name
+}
+
+// dbrows are the rows returned by a query, which record
+// the metrics of the query once they have been read
+type dbrows struct {
+	*sql.Rows
+
+	m     *metrics
+	name  string
+	start time.Time
+	span  *tracing.Span
+	count int64
+	done  bool
+}
+
+func (r *dbrows) Next() bool {
+	if r.Rows.Next() {
+		r.count++
+		return true
+	}
+
+	r.finish()
+
+	return false
+}
+
+func (r *dbrows) Close() error {
+	err := r.Rows.Close()
+
+	r.finish()
+
+	return err
+}
+
+func (r *dbrows) finish() {
+	if !r.done {
+		r.done = true
+		r.m.record(r.name, r.start, r.count, r.Rows.Err())
+		endSpan(r.span, r.count, r.Rows.Err())
+	}
+}
+
+// dbrow is the row returned by a query, which records
+// the metrics of the query once it has been scanned
+type dbrow struct {
+	*sql.Row
+
+	m     *metrics
+	name  string
+	start time.Time
+	span  *tracing.Span
+}
+
+func (r *dbrow) Scan(dest ...interface{}) error {
+	err := r.Row.Scan(dest...)
+
+	// a missing row is an answer, not a failure
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		r.m.record(r.name, r.start, 0, nil)
+		endSpan(r.span, 0, nil)
+	case err != nil:
+		r.m.record(r.name, r.start, 0, err)
+		endSpan(r.span, 0, err)
+	default:
+		r.m.record(r.name, r.start, 1, nil)
+		endSpan(r.span, 1, nil)
+	}
+
+	return err
+}
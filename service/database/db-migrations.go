@@ -0,0 +1,399 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// migrate brings the database structure up to date. A new database gets the latest structure straight away, while a
+// database created by a previous version of the package is upgraded by running the missing migrations of the dialect.
+// The version of the structure is kept in the schema_version table.
+func migrate(db *sql.DB, d dialect) error {
+	ctx := context.Background()
+
+	// every statement must run on the same connection,
+	// since some dialects change its settings
+	conn, err := db.Conn(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	// check whether the database was created by a previous version
+	// of the package, before the schema_version table existed
+	var legacy bool
+
+	err = conn.QueryRowContext(ctx, d.rebind(d.tableExists()), "User").Scan(&legacy)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = conn.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_version (
+			version INTEGER NOT NULL
+		);
+	`)
+
+	if err != nil {
+		return err
+	}
+
+	migrations := d.migrations()
+
+	var version int
+
+	err = conn.QueryRowContext(ctx, `
+		SELECT version
+		FROM schema_version
+	`).Scan(&version)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		if legacy {
+			// the database has the structure of the first version
+			version = 0
+		} else {
+			// the database is empty, hence the latest structure can be created
+			for _, table := range d.schema() {
+				_, err = conn.ExecContext(ctx, table)
+
+				if err != nil {
+					return err
+				}
+			}
+
+			version = len(migrations)
+		}
+
+		_, err = conn.ExecContext(ctx, d.rebind(`
+			INSERT INTO schema_version(version)
+			VALUES (?)
+		`), version)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if version >= len(migrations) {
+		return nil
+	}
+
+	return d.withoutForeignKeys(conn, func() error {
+		for ; version < len(migrations); version++ {
+			err := runMigration(ctx, conn, d, migrations[version], version+1)
+
+			if err != nil {
+				return fmt.Errorf("migrating to version %d: %w", version+1, err)
+			}
+		}
+
+		return nil
+	})
+}
+
+// runMigration runs the migration script and records the new version in a single transaction.
+func runMigration(ctx context.Context, conn *sql.Conn, d dialect, script string, version int) error {
+	tx, err := conn.BeginTx(ctx, nil)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, script)
+
+	if err == nil {
+		_, err = tx.ExecContext(ctx, d.rebind(`
+			UPDATE schema_version
+			SET version=?
+		`), version)
+	}
+
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// indexes supports the lookups not covered by the primary keys: the followers
+// and the bans of a user, the likes and the comments of a photo
+const indexes = `
+	CREATE INDEX IF NOT EXISTS follow_second_user_idx ON follow(second_user);
+	CREATE INDEX IF NOT EXISTS ban_second_user_idx ON ban(second_user);
+	CREATE INDEX IF NOT EXISTS like_photo_idx ON "like"(photo);
+	CREATE INDEX IF NOT EXISTS comment_photo_date_idx ON Comment(photo, date);
+`
+
+// addUserVersion counts the updates of each user, so that an update
+// based on a stale copy of the user can be detected and rejected
+const addUserVersion = `
+	ALTER TABLE "User" ADD COLUMN version INTEGER NOT NULL DEFAULT 0;
+`
+
+// addPhotoHash stores the perceptual hash of each photo, used to
+// find the near duplicates among the photos of the same user
+const addPhotoHash = `
+	ALTER TABLE Photo ADD COLUMN phash BIGINT;
+`
+
+// addLikeType turns the likes into reactions of different types, the
+// existing likes being reactions of type like
+const addLikeType = `
+	ALTER TABLE "like" ADD COLUMN type TEXT NOT NULL DEFAULT 'like';
+`
+
+// addPhotoLocation stores where each photo was taken, either as coordinates or
+// as the name of a place (or both), and whether each user strips the location
+// from their photos by default
+const addPhotoLocation = `
+	ALTER TABLE Photo ADD COLUMN latitude DOUBLE PRECISION;
+	ALTER TABLE Photo ADD COLUMN longitude DOUBLE PRECISION;
+	ALTER TABLE Photo ADD COLUMN place TEXT;
+	ALTER TABLE Photo ADD COLUMN place_key TEXT;
+	ALTER TABLE "User" ADD COLUMN strip_location BOOLEAN NOT NULL DEFAULT FALSE;
+` + photoPlaceIndex
+
+// addPhotoPinnedAt stores when each photo was pinned to the top of the profile of its
+// user, the photos which are not pinned having none
+const addPhotoPinnedAt = `
+	ALTER TABLE Photo ADD COLUMN pinned_at BIGINT;
+`
+
+// addNotificationPushed records which notifications were already pushed to the devices
+// of their users, the existing ones being considered pushed so that they are not sent
+// late; the ones waiting to be pushed are indexed apart
+const addNotificationPushed = `
+	ALTER TABLE notification ADD COLUMN pushed BOOLEAN NOT NULL DEFAULT FALSE;
+	UPDATE notification SET pushed=TRUE;
+	CREATE INDEX IF NOT EXISTS notification_unpushed_idx ON notification(id) WHERE NOT pushed;
+`
+
+// addUserEmail stores the email address of each user, who can leave it unset, and
+// when the last digest of what they missed was sent to them
+const addUserEmail = `
+	ALTER TABLE "User" ADD COLUMN email TEXT;
+	ALTER TABLE "User" ADD COLUMN digest_sent_at BIGINT;
+`
+
+// addEmailVerified records whether each user proved to own their email address, by following the link sent to it;
+// the addresses given before are trusted, so that their digests are not stopped
+const addEmailVerified = `
+	ALTER TABLE "User" ADD COLUMN email_verified BOOLEAN NOT NULL DEFAULT FALSE;
+	UPDATE "User" SET email_verified=TRUE WHERE email IS NOT NULL;
+`
+
+// addLikeDate stores when each reaction was added, the existing ones having no date; the
+// recent reactions are indexed to rank the photos by their activity
+const addLikeDate = `
+	ALTER TABLE "like" ADD COLUMN date BIGINT;
+` + activityIndexes
+
+// activityIndexes support the lookup of the recent reactions and comments
+const activityIndexes = `
+	CREATE INDEX IF NOT EXISTS like_date_idx ON "like"(date);
+	CREATE INDEX IF NOT EXISTS comment_date_idx ON Comment(date);
+`
+
+// photoPlaceIndex supports the lookup of the photos taken in a place
+const photoPlaceIndex = `
+	CREATE INDEX IF NOT EXISTS photo_place_key_date_idx ON Photo(place_key, date);
+`
+
+// closeFriendsTable records the close friends of each user, chosen among their followers, who alone can see the
+// photos restricted to them
+const closeFriendsTable = `
+	CREATE TABLE IF NOT EXISTS close_friend (
+		first_user INTEGER NOT NULL,
+		second_user INTEGER NOT NULL,
+		PRIMARY KEY (first_user, second_user),
+		FOREIGN KEY (first_user) REFERENCES "User"(id) ON DELETE CASCADE,
+		FOREIGN KEY (second_user) REFERENCES "User"(id) ON DELETE CASCADE
+	);
+	CREATE INDEX IF NOT EXISTS close_friend_second_user_idx ON close_friend(second_user);
+	ALTER TABLE Photo ADD COLUMN close_friends BOOLEAN NOT NULL DEFAULT FALSE;
+`
+
+// addPhotoFlagged marks the photos flagged as unsafe by the classifier, hidden to everyone but their owner until the
+// administrators review them
+const addPhotoFlagged = `
+	ALTER TABLE Photo ADD COLUMN flagged BOOLEAN NOT NULL DEFAULT FALSE;
+`
+
+// addUserSuspendedAt records when each user was suspended by the administrators, if they were
+const addUserSuspendedAt = `
+	ALTER TABLE "User" ADD COLUMN suspended_at BIGINT;
+`
+
+// muteTable records the users whose photos each user hides from their stream, while still following them
+const muteTable = `
+	CREATE TABLE IF NOT EXISTS mute (
+		first_user INTEGER NOT NULL,
+		second_user INTEGER NOT NULL,
+		PRIMARY KEY (first_user, second_user),
+		FOREIGN KEY (first_user) REFERENCES "User"(id) ON DELETE CASCADE,
+		FOREIGN KEY (second_user) REFERENCES "User"(id) ON DELETE CASCADE
+	);
+`
+
+// mentionTable records the users mentioned in each comment, going away together with the comment
+const mentionTable = `
+	CREATE TABLE IF NOT EXISTS mention (
+		comment INTEGER NOT NULL,
+		"user" INTEGER NOT NULL,
+		PRIMARY KEY (comment, "user"),
+		FOREIGN KEY (comment) REFERENCES Comment(id) ON DELETE CASCADE,
+		FOREIGN KEY ("user") REFERENCES "User"(id) ON DELETE CASCADE
+	);
+	CREATE INDEX IF NOT EXISTS mention_user_idx ON mention("user");
+`
+
+// commentUserDateIndexes speed up counting the recent comments of a user, held back ones included
+const commentUserDateIndexes = `
+	CREATE INDEX IF NOT EXISTS comment_user_date_idx ON Comment("user", date);
+	CREATE INDEX IF NOT EXISTS held_comment_user_date_idx ON held_comment("user", date);
+`
+
+// addUserShadowBanned marks the users shadow banned by the administrators, whose photos and comments only they see
+const addUserShadowBanned = `
+	ALTER TABLE "User" ADD COLUMN shadow_banned BOOLEAN NOT NULL DEFAULT FALSE;
+`
+
+// addUserStreamSeenAt records when each user last marked their stream as seen, if they did, to tell the photos they
+// did not see yet
+const addUserStreamSeenAt = `
+	ALTER TABLE "User" ADD COLUMN stream_seen_at BIGINT;
+`
+
+// settingsTables holds the privacy settings of the users who changed them, the others having the default ones, and the
+// requests to follow the private accounts, waiting for their approval
+const settingsTables = `
+	CREATE TABLE IF NOT EXISTS settings (
+		"user" INTEGER NOT NULL PRIMARY KEY,
+		private BOOLEAN NOT NULL DEFAULT FALSE,
+		comment_policy TEXT NOT NULL DEFAULT 'everyone',
+		mention_policy TEXT NOT NULL DEFAULT 'everyone',
+		hide_like_counts BOOLEAN NOT NULL DEFAULT FALSE,
+		FOREIGN KEY ("user") REFERENCES "User"(id) ON DELETE CASCADE
+	);
+	CREATE TABLE IF NOT EXISTS follow_request (
+		first_user INTEGER NOT NULL,
+		second_user INTEGER NOT NULL,
+		date BIGINT NOT NULL,
+		PRIMARY KEY (first_user, second_user),
+		FOREIGN KEY (first_user) REFERENCES "User"(id) ON DELETE CASCADE,
+		FOREIGN KEY (second_user) REFERENCES "User"(id) ON DELETE CASCADE
+	);
+	CREATE INDEX IF NOT EXISTS follow_request_second_user_idx ON follow_request(second_user, date);
+`
+
+// notificationPreferenceTable holds, for each type of notification, the channels on which the user receives it, only
+// for the types whose channels they changed; a missing type is received on every channel
+const notificationPreferenceTable = `
+	CREATE TABLE IF NOT EXISTS notification_preference (
+		"user" INTEGER NOT NULL,
+		type TEXT NOT NULL,
+		in_app BOOLEAN NOT NULL DEFAULT TRUE,
+		push BOOLEAN NOT NULL DEFAULT TRUE,
+		email BOOLEAN NOT NULL DEFAULT TRUE,
+		PRIMARY KEY ("user", type),
+		FOREIGN KEY ("user") REFERENCES "User"(id) ON DELETE CASCADE
+	);
+`
+
+// addUserProfile stores the name, the biography and the website each user shows on their profile, all of them
+// being empty until they are set
+const addUserProfile = `
+	ALTER TABLE "User" ADD COLUMN display_name TEXT NOT NULL DEFAULT '';
+	ALTER TABLE "User" ADD COLUMN bio TEXT NOT NULL DEFAULT '';
+	ALTER TABLE "User" ADD COLUMN website TEXT NOT NULL DEFAULT '';
+`
+
+// addUserAvatar stores the url of the avatar of each user, empty until they upload one; the avatars are indexed to tell
+// whether a file of the storage is still used
+const addUserAvatar = `
+	ALTER TABLE "User" ADD COLUMN avatar TEXT NOT NULL DEFAULT '';
+	CREATE INDEX IF NOT EXISTS user_avatar_idx ON "User"(avatar) WHERE avatar<>'';
+`
+
+// usernameHistoryTable records the usernames the users left, with when they left them and until when they are reserved
+// to them: meanwhile, the requests naming an old username are redirected to its user, and no one else can take it
+const usernameHistoryTable = `
+	CREATE TABLE IF NOT EXISTS username_history (
+		username TEXT NOT NULL,
+		"user" INTEGER NOT NULL,
+		changed_at BIGINT NOT NULL,
+		reserved_until BIGINT NOT NULL,
+		PRIMARY KEY (username, changed_at),
+		FOREIGN KEY ("user") REFERENCES "User"(id) ON DELETE CASCADE
+	);
+	CREATE INDEX IF NOT EXISTS username_history_user_idx ON username_history("user");
+`
+
+// addUsernameKey stores the key of each username under the username policy, which must be unique among the users and
+// is looked up in place of the username; the keys are computed again whenever the server starts, with its policy
+const addUsernameKey = `
+	ALTER TABLE "User" ADD COLUMN username_key TEXT;
+	UPDATE "User" SET username_key=username;
+	CREATE UNIQUE INDEX IF NOT EXISTS user_username_key_idx ON "User"(username_key);
+	ALTER TABLE username_history ADD COLUMN username_key TEXT;
+	UPDATE username_history SET username_key=username;
+	CREATE INDEX IF NOT EXISTS username_history_key_idx ON username_history(username_key);
+`
+
+// addPhotoMedia stores whether each photo is an image or a video, with the url of the poster and the duration in
+// milliseconds of the videos; the posters are indexed to tell whether a file of the storage is still used
+const addPhotoMedia = `
+	ALTER TABLE Photo ADD COLUMN media_type TEXT NOT NULL DEFAULT 'image';
+	ALTER TABLE Photo ADD COLUMN poster_url TEXT NOT NULL DEFAULT '';
+	ALTER TABLE Photo ADD COLUMN duration BIGINT NOT NULL DEFAULT 0;
+	CREATE INDEX IF NOT EXISTS photo_poster_url_idx ON Photo(poster_url) WHERE poster_url<>'';
+`
+
+// addPhotoScheduled stores whether each photo is scheduled, its date being when it is published; the scheduled photos
+// are indexed by their date to publish the due ones
+const addPhotoScheduled = `
+	ALTER TABLE Photo ADD COLUMN scheduled BOOLEAN NOT NULL DEFAULT FALSE;
+	CREATE INDEX IF NOT EXISTS photo_scheduled_idx ON Photo(date) WHERE scheduled;
+`
+
+// addPhotoOriginalUrl stores the url of the original image of the edited photos, whose url is the one of the image
+// derived from it; the originals are indexed to tell whether a file of the storage is still used
+const addPhotoOriginalUrl = `
+	ALTER TABLE Photo ADD COLUMN original_url TEXT NOT NULL DEFAULT '';
+	CREATE INDEX IF NOT EXISTS photo_original_url_idx ON Photo(original_url) WHERE original_url<>'';
+`
+
+// addPhotoAltText stores the text describing each photo to the users who cannot see it, empty if it is not given
+const addPhotoAltText = `
+	ALTER TABLE Photo ADD COLUMN alt_text TEXT NOT NULL DEFAULT '';
+`
+
+// photoImportTable records the photos imported from an export archive, by the username of the exported account and
+// the id of the photo in it, so that an import started again skips them; the records go away with the photos
+const photoImportTable = `
+	CREATE TABLE IF NOT EXISTS photo_import (
+		"user" INTEGER NOT NULL,
+		source TEXT NOT NULL,
+		source_id INTEGER NOT NULL,
+		photo INTEGER NOT NULL UNIQUE,
+		PRIMARY KEY ("user", source, source_id),
+		FOREIGN KEY ("user") REFERENCES "User"(id) ON DELETE CASCADE,
+		FOREIGN KEY (photo) REFERENCES Photo(id) ON DELETE CASCADE
+	);
+`
+
+// addBanReasonExpiry stores why each ban was made and when it expires, the existing ones having
+// no reason and never expiring; the expiring bans are indexed to remove them once expired
+const addBanReasonExpiry = `
+	ALTER TABLE ban ADD COLUMN reason TEXT NOT NULL DEFAULT '';
+	ALTER TABLE ban ADD COLUMN expires_at BIGINT;
+	CREATE INDEX IF NOT EXISTS ban_expires_at_idx ON ban(expires_at);
+`
@@ -0,0 +1,113 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+func (db *appdbimpl) InsertMute(ctx context.Context, dbUser DatabaseUser, mutedDbUser DatabaseUser) error {
+	// insert the mute into the database, the
+	// users keep following each other as before
+	return db.retry(ctx, func() error {
+		_, err := db.c.ExecContext(ctx, `
+			INSERT INTO mute(first_user, second_user)
+			VALUES (?, ?)
+			ON CONFLICT DO NOTHING
+		`, dbUser.Id, mutedDbUser.Id)
+
+		return err
+	})
+}
+
+func (db *appdbimpl) DeleteMute(ctx context.Context, dbUser DatabaseUser, mutedDbUser DatabaseUser) error {
+	var res sql.Result
+
+	// remove the mute from the database
+	err := db.retry(ctx, func() (err error) {
+		res, err = db.c.ExecContext(ctx, `
+			DELETE FROM mute
+			WHERE first_user=?
+			AND second_user=?
+		`, dbUser.Id, mutedDbUser.Id)
+
+		return err
+	})
+
+	if err != nil {
+		return err
+	}
+
+	aff, err := res.RowsAffected()
+
+	if err != nil {
+		return err
+	}
+
+	// if there are no affected rows
+	// then the user was not muted
+	if aff == 0 {
+		return ErrUserNotMuted
+	}
+
+	return nil
+}
+
+func (db *appdbimpl) CheckMute(ctx context.Context, firstDbUser DatabaseUser, secondDbUser DatabaseUser) (bool, error) {
+	checkMute := false
+
+	// check whether the first user has muted the second user
+	err := db.c.QueryRowContext(ctx, `
+		SELECT EXISTS(
+			SELECT 1
+			FROM mute
+			WHERE first_user=?
+			AND second_user=?
+		)
+	`, firstDbUser.Id, secondDbUser.Id).Scan(&checkMute)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+
+	return checkMute, err
+}
+
+func (db *appdbimpl) GetMutedList(ctx context.Context, dbUser DatabaseUser) (DatabaseUserList, error) {
+	dbUserList := DatabaseUserListDefault()
+
+	// get the table of the users muted by the user
+	// performing the action, only the user can see it
+	rows, err := db.c.QueryContext(ctx, `
+		SELECT id, username, avatar
+		FROM "User"
+		WHERE id IN (
+			SELECT second_user
+			FROM mute
+			WHERE first_user=?
+		)
+		AND deactivated_at IS NULL
+		ORDER BY username
+	`, dbUser.Id)
+
+	if err != nil {
+		return dbUserList, err
+	}
+
+	defer rows.Close()
+
+	// build the muted list
+	for rows.Next() {
+		tableDbUser := DatabaseUserDefault()
+
+		err = rows.Scan(&tableDbUser.Id, &tableDbUser.Username, &tableDbUser.Avatar)
+
+		if err != nil {
+			return dbUserList, err
+		}
+
+		dbUserList.Users = append(dbUserList.Users, tableDbUser)
+	}
+
+	return dbUserList, rows.Err()
+}
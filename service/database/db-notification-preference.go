@@ -0,0 +1,72 @@
+package database
+
+import (
+	"context"
+)
+
+func (db *appdbimpl) GetNotificationPreferences(ctx context.Context, dbUser DatabaseUser) (map[string]DatabaseNotificationPreference, error) {
+	preferences := make(map[string]DatabaseNotificationPreference)
+
+	// the types the user did not change are received on every channel
+	for _, notificationType := range NotificationTypes {
+		preferences[notificationType] = DatabaseNotificationPreferenceDefault()
+	}
+
+	// get the channels of the types the user changed
+	rows, err := db.c.QueryContext(ctx, `
+		SELECT type, in_app, push, email
+		FROM notification_preference
+		WHERE "user"=?
+	`, dbUser.Id)
+
+	if err != nil {
+		return preferences, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var notificationType string
+
+		preference := DatabaseNotificationPreferenceDefault()
+
+		err = rows.Scan(&notificationType, &preference.InApp, &preference.Push, &preference.Email)
+
+		if err != nil {
+			return preferences, err
+		}
+
+		preferences[notificationType] = preference
+	}
+
+	return preferences, rows.Err()
+}
+
+func (db *appdbimpl) UpdateNotificationPreferences(ctx context.Context, dbUser DatabaseUser, preferences map[string]DatabaseNotificationPreference) error {
+	// replace the channels of every type, the missing
+	// types being received on every channel
+	return db.withTx(ctx, func(tx *dbtx) error {
+		for _, notificationType := range NotificationTypes {
+			preference, ok := preferences[notificationType]
+
+			if !ok {
+				preference = DatabaseNotificationPreferenceDefault()
+			}
+
+			_, err := tx.ExecContext(ctx, `
+				INSERT INTO notification_preference("user", type, in_app, push, email)
+				VALUES (?, ?, ?, ?, ?)
+				ON CONFLICT ("user", type) DO UPDATE
+				SET in_app=excluded.in_app,
+					push=excluded.push,
+					email=excluded.email
+			`, dbUser.Id, notificationType, preference.InApp, preference.Push, preference.Email)
+
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
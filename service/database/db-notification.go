@@ -0,0 +1,441 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"sort"
+
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/globaltime"
+)
+
+// the types of the notifications
+const (
+	NotificationLike    = "like"
+	NotificationComment = "comment"
+	NotificationMention = "mention"
+	NotificationFollow  = "follow"
+)
+
+// NotificationTypes are the types of the notifications, each received on the channels chosen by the user
+var NotificationTypes = []string{NotificationLike, NotificationComment, NotificationMention, NotificationFollow}
+
+// the channels the notifications are received on, named after the columns of notification_preference
+const (
+	ChannelInApp = "in_app"
+	ChannelPush  = "push"
+	ChannelEmail = "email"
+)
+
+// notificationEnabled is the condition keeping the notifications whose type the user receives on the channel, one of
+// the columns of notification_preference. It takes the id of the user once.
+func notificationEnabled(channel string) string {
+	return `type NOT IN (
+		SELECT type
+		FROM notification_preference
+		WHERE "user"=?
+		AND NOT ` + channel + `
+	)`
+}
+
+// visibleNotifications is the condition keeping the notifications of the user which they can still see: the ones of
+// actors who are deactivated, who banned the user or were banned by them, the comments and the mentions of shadow banned
+// actors, and the ones about photos the user cannot see are left out. It takes the id of the user eight times.
+const visibleNotifications = `
+	"user"=?
+	AND actor NOT IN (
+		SELECT id
+		FROM "User"
+		WHERE deactivated_at IS NOT NULL
+	)
+	AND (
+		type NOT IN ('comment', 'mention')
+		OR actor NOT IN (
+			SELECT id
+			FROM "User"
+			WHERE shadow_banned
+		)
+	)
+	AND actor NOT IN (
+		SELECT first_user
+		FROM ban
+		WHERE second_user=?
+		UNION
+		SELECT second_user
+		FROM ban
+		WHERE first_user=?
+	)
+	AND (
+		photo IS NULL
+		OR photo IN (
+			SELECT id
+			FROM Photo
+			WHERE (NOT archived OR "user"=?)
+			AND ` + visiblePhoto + `
+			AND "user" NOT IN (
+				SELECT first_user
+				FROM ban
+				WHERE second_user=?
+			)
+		)
+	)
+`
+
+// insertLikeNotificationTx notifies the owner of the photo, within the given transaction, that the user liked it,
+// unless the user is the owner
+func insertLikeNotificationTx(ctx context.Context, tx *dbtx, dbUser DatabaseUser, dbPhoto DatabasePhoto) error {
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO notification("user", actor, type, photo, date)
+		SELECT "user", ?, ?, id, ?
+		FROM Photo
+		WHERE id=?
+		AND "user"<>?
+	`, dbUser.Id, NotificationLike, globaltime.Now().Unix(), dbPhoto.Id, dbUser.Id)
+
+	return err
+}
+
+// insertCommentNotificationsTx notifies, within the given transaction, the owner of the photo that the comment was
+// written under it, unless they are its author, and the users mentioned in the comment, which must be already recorded
+func insertCommentNotificationsTx(ctx context.Context, tx *dbtx, dbComment DatabaseComment) error {
+	date := globaltime.Now().Unix()
+
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO notification("user", actor, type, photo, comment, date)
+		SELECT "user", ?, ?, id, ?, ?
+		FROM Photo
+		WHERE id=?
+		AND "user"<>?
+	`, dbComment.User.Id, NotificationComment, dbComment.Id, date, dbComment.Photo.Id, dbComment.User.Id)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO notification("user", actor, type, photo, comment, date)
+		SELECT "user", ?, ?, ?, comment, ?
+		FROM mention
+		WHERE comment=?
+	`, dbComment.User.Id, NotificationMention, dbComment.Photo.Id, date, dbComment.Id)
+
+	return err
+}
+
+// insertFollowNotificationTx notifies the followed user, within the given transaction, that the user followed them
+func insertFollowNotificationTx(ctx context.Context, tx *dbtx, dbUser DatabaseUser, followedDbUser DatabaseUser) error {
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO notification("user", actor, type, date)
+		VALUES (?, ?, ?, ?)
+	`, followedDbUser.Id, dbUser.Id, NotificationFollow, globaltime.Now().Unix())
+
+	return err
+}
+
+// deleteNotificationTx removes, within the given transaction, the notifications of the given type sent by the actor to
+// the user `userId` about the photo `photoId`, since what they were about was undone; each id is ignored if it is 0
+func deleteNotificationTx(ctx context.Context, tx *dbtx, actor uint32, notificationType string, userId uint32, photoId uint32) error {
+	_, err := tx.ExecContext(ctx, `
+		DELETE FROM notification
+		WHERE actor=?
+		AND type=?
+		AND (?=0 OR "user"=?)
+		AND (?=0 OR photo=?)
+	`, actor, notificationType, userId, userId, photoId, photoId)
+
+	return err
+}
+
+func (db *appdbimpl) GetNotifications(ctx context.Context, dbUser DatabaseUser, unread bool, limit int, before uint32) (DatabaseNotificationList, error) {
+	dbNotificationList := DatabaseNotificationListDefault()
+
+	var err error
+
+	dbNotificationList.UnreadCount, err = db.GetUnreadNotificationCount(ctx, dbUser)
+
+	if err != nil {
+		return dbNotificationList, err
+	}
+
+	// get a page of at most `limit` notifications of the
+	// user, only the unread ones if requested, from the
+	// newest to the oldest, keeping only the notifications
+	// older than the notification `before` (if it is not
+	// 0); one more notification is requested to know
+	// whether there is a next page
+	rows, err := db.read().QueryContext(ctx, `
+		SELECT id, actor, type, photo, comment, date, read
+		FROM notification
+		WHERE `+visibleNotifications+`
+		AND `+notificationEnabled(ChannelInApp)+`
+		AND (NOT ? OR NOT read)
+		AND (
+			?=0
+			OR (date, id) < (
+				SELECT date, id
+				FROM notification
+				WHERE id=?
+			)
+		)
+		ORDER BY date DESC, id DESC
+		LIMIT ?
+	`, dbUser.Id, dbUser.Id, dbUser.Id, dbUser.Id, dbUser.Id, dbUser.Id, dbUser.Id, dbUser.Id, dbUser.Id, unread, before, before, limit+1)
+
+	if err != nil {
+		return dbNotificationList, err
+	}
+
+	dbNotificationList.Notifications, err = db.notificationsFromRows(ctx, rows, dbUser)
+
+	if err != nil {
+		return dbNotificationList, err
+	}
+
+	// if there is a next page, its cursor
+	// is the last notification of the current one
+	if len(dbNotificationList.Notifications) > limit {
+		dbNotificationList.Notifications = dbNotificationList.Notifications[:limit]
+		dbNotificationList.NextCursor = dbNotificationList.Notifications[limit-1].Id
+	}
+
+	return dbNotificationList, err
+}
+
+func (db *appdbimpl) GetNotificationsAfter(ctx context.Context, dbUser DatabaseUser, after uint32, limit int) (DatabaseNotificationList, error) {
+	dbNotificationList := DatabaseNotificationListDefault()
+
+	// get at most `limit` notifications of the user newer
+	// than the notification `after`, from the oldest to the
+	// newest, so that they can be sent in the order they
+	// were created; one more notification is requested to
+	// know whether there are more of them (the number of
+	// unread notifications is not counted here)
+	rows, err := db.read().QueryContext(ctx, `
+		SELECT id, actor, type, photo, comment, date, read
+		FROM notification
+		WHERE `+visibleNotifications+`
+		AND `+notificationEnabled(ChannelInApp)+`
+		AND id > ?
+		ORDER BY id
+		LIMIT ?
+	`, dbUser.Id, dbUser.Id, dbUser.Id, dbUser.Id, dbUser.Id, dbUser.Id, dbUser.Id, dbUser.Id, dbUser.Id, after, limit+1)
+
+	if err != nil {
+		return dbNotificationList, err
+	}
+
+	dbNotificationList.Notifications, err = db.notificationsFromRows(ctx, rows, dbUser)
+
+	if err != nil {
+		return dbNotificationList, err
+	}
+
+	// if there are more notifications, the
+	// cursor is the last one of the current page
+	if len(dbNotificationList.Notifications) > limit {
+		dbNotificationList.Notifications = dbNotificationList.Notifications[:limit]
+		dbNotificationList.NextCursor = dbNotificationList.Notifications[limit-1].Id
+	}
+
+	return dbNotificationList, nil
+}
+
+func (db *appdbimpl) TakeNotificationsToPush(ctx context.Context, limit int) ([]DatabaseNotification, error) {
+	type pending struct {
+		id   uint32
+		user uint32
+	}
+
+	var taken []pending
+
+	// mark at most `limit` of the notifications waiting to be
+	// pushed as pushed, getting them back; being taken in a
+	// single statement, each one is pushed at most once even
+	// by many instances sharing the database
+	err := db.retry(ctx, func() error {
+		taken = make([]pending, 0)
+
+		rows, err := db.c.QueryContext(ctx, `
+			UPDATE notification
+			SET pushed=TRUE
+			WHERE NOT pushed
+			AND id IN (
+				SELECT id
+				FROM notification
+				WHERE NOT pushed
+				ORDER BY id
+				LIMIT ?
+			)
+			RETURNING id, "user"
+		`, limit)
+
+		if err != nil {
+			return err
+		}
+
+		defer rows.Close()
+
+		for rows.Next() {
+			var p pending
+
+			err = rows.Scan(&p.id, &p.user)
+
+			if err != nil {
+				return err
+			}
+
+			taken = append(taken, p)
+		}
+
+		return rows.Err()
+	})
+
+	dbNotifications := make([]DatabaseNotification, 0)
+
+	if err != nil {
+		return dbNotifications, err
+	}
+
+	sort.Slice(taken, func(i, j int) bool {
+		return taken[i].id < taken[j].id
+	})
+
+	// build the notifications which their users can still
+	// see and receive as push notifications, the other
+	// ones are never pushed
+	for _, p := range taken {
+		dbUser, err := db.GetDatabaseUser(ctx, p.user)
+
+		if errors.Is(err, ErrUserDoesNotExist) {
+			continue
+		}
+
+		if err != nil {
+			return dbNotifications, err
+		}
+
+		rows, err := db.c.QueryContext(ctx, `
+			SELECT id, actor, type, photo, comment, date, read
+			FROM notification
+			WHERE `+visibleNotifications+`
+			AND `+notificationEnabled(ChannelPush)+`
+			AND id=?
+		`, dbUser.Id, dbUser.Id, dbUser.Id, dbUser.Id, dbUser.Id, dbUser.Id, dbUser.Id, dbUser.Id, dbUser.Id, p.id)
+
+		if err != nil {
+			return dbNotifications, err
+		}
+
+		visible, err := db.notificationsFromRows(ctx, rows, dbUser)
+
+		if err != nil {
+			return dbNotifications, err
+		}
+
+		dbNotifications = append(dbNotifications, visible...)
+	}
+
+	return dbNotifications, nil
+}
+
+// notificationsFromRows builds the notifications of the user from the rows of a query selecting their id, actor,
+// type, photo, comment, date and read flag, closing the rows
+func (db *appdbimpl) notificationsFromRows(ctx context.Context, rows *dbrows, dbUser DatabaseUser) ([]DatabaseNotification, error) {
+	dbNotifications := make([]DatabaseNotification, 0)
+
+	defer rows.Close()
+
+	for rows.Next() {
+		dbNotification := DatabaseNotificationDefault()
+		dbNotification.User = dbUser
+
+		var photoId, commentId *uint32
+
+		err := rows.Scan(&dbNotification.Id, &dbNotification.Actor.Id, &dbNotification.Type, &photoId, &commentId, unixTime{&dbNotification.Date}, &dbNotification.Read)
+
+		if err != nil {
+			return dbNotifications, err
+		}
+
+		dbNotification.Actor, err = db.GetDatabaseUser(ctx, dbNotification.Actor.Id)
+
+		if err != nil {
+			return dbNotifications, err
+		}
+
+		// the comments come with the photo they are
+		// under, hence the photo is only set for the likes
+		switch {
+		case commentId != nil:
+			dbComment, err := db.GetDatabaseComment(ctx, *commentId, dbUser)
+
+			if err != nil {
+				return dbNotifications, err
+			}
+
+			dbNotification.Comment = &dbComment
+		case photoId != nil:
+			dbPhoto, err := db.GetDatabasePhoto(ctx, *photoId, dbUser)
+
+			if err != nil {
+				return dbNotifications, err
+			}
+
+			dbNotification.Photo = &dbPhoto
+		}
+
+		dbNotifications = append(dbNotifications, dbNotification)
+	}
+
+	return dbNotifications, rows.Err()
+}
+
+func (db *appdbimpl) GetUnreadNotificationCount(ctx context.Context, dbUser DatabaseUser) (int, error) {
+	var unreadCount int
+
+	// get the number of unread notifications of the user
+	err := db.read().QueryRowContext(ctx, `
+		SELECT COUNT(*)
+		FROM notification
+		WHERE `+visibleNotifications+`
+		AND `+notificationEnabled(ChannelInApp)+`
+		AND NOT read
+	`, dbUser.Id, dbUser.Id, dbUser.Id, dbUser.Id, dbUser.Id, dbUser.Id, dbUser.Id, dbUser.Id, dbUser.Id).Scan(&unreadCount)
+
+	return unreadCount, err
+}
+
+func (db *appdbimpl) MarkNotificationsRead(ctx context.Context, dbUser DatabaseUser, notificationIds []uint32) error {
+	// mark the given notifications of the user as read; the
+	// ones which do not exist (eg. because what they were
+	// about was undone) are ignored
+	return db.withTx(ctx, func(tx *dbtx) error {
+		for _, notificationId := range notificationIds {
+			_, err := tx.ExecContext(ctx, `
+				UPDATE notification
+				SET read=TRUE
+				WHERE id=?
+				AND "user"=?
+			`, notificationId, dbUser.Id)
+
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (db *appdbimpl) MarkAllNotificationsRead(ctx context.Context, dbUser DatabaseUser) error {
+	// mark every notification of the user as read
+	return db.retry(ctx, func() error {
+		_, err := db.c.ExecContext(ctx, `
+			UPDATE notification
+			SET read=TRUE
+			WHERE "user"=?
+			AND NOT read
+		`, dbUser.Id)
+
+		return err
+	})
+}
@@ -0,0 +1,1174 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// The parity suite runs every scenario against each implementation of AppDatabase, the SQLite one used in production
+// and the one kept in memory for the tests of the handlers, expecting the same results from both: a scenario failing
+// for one of them only means that the memory implementation drifted from the queries.
+
+// databases returns a new, empty instance of each implementation of AppDatabase, by name
+func databases(t *testing.T) map[string]AppDatabase {
+	t.Helper()
+
+	dsn := SQLiteConfig{JournalMode: "WAL", BusyTimeout: 5 * time.Second}.DataSourceName(filepath.Join(t.TempDir(), "parity.db"))
+
+	conn, err := sql.Open("sqlite3", dsn)
+
+	if err != nil {
+		t.Fatalf("opening SQLite: %v", err)
+	}
+
+	t.Cleanup(func() {
+		_ = conn.Close()
+	})
+
+	sqlite, err := New(conn)
+
+	if err != nil {
+		t.Fatalf("creating the SQLite database: %v", err)
+	}
+
+	return map[string]AppDatabase{
+		"sqlite": sqlite,
+		"memory": NewMemory(),
+	}
+}
+
+// parity runs the scenario once for each implementation of AppDatabase, as a subtest named after it
+func parity(t *testing.T, scenario func(t *testing.T, db AppDatabase)) {
+	dbs := databases(t)
+
+	for _, name := range []string{"sqlite", "memory"} {
+		db := dbs[name]
+
+		t.Run(name, func(t *testing.T) {
+			scenario(t, db)
+		})
+	}
+}
+
+// parityDate is the date the scenarios start from, as the databases store the dates to the second
+var parityDate = time.Date(2023, 11, 21, 9, 0, 0, 0, time.UTC)
+
+func insertUser(t *testing.T, db AppDatabase, username string) DatabaseUser {
+	t.Helper()
+
+	dbUser := DatabaseUserDefault()
+	dbUser.Username = username
+
+	err := db.InsertUser(context.Background(), &dbUser)
+
+	if err != nil {
+		t.Fatalf("inserting the user %s: %v", username, err)
+	}
+
+	return dbUser
+}
+
+// insertPhoto inserts a photo of the user at the url, posted `minutes` after parityDate, changed by `options` first
+func insertPhoto(t *testing.T, db AppDatabase, dbUser DatabaseUser, url string, minutes int, options ...func(*DatabasePhoto)) DatabasePhoto {
+	t.Helper()
+
+	dbPhoto := DatabasePhotoDefault()
+	dbPhoto.User = dbUser
+	dbPhoto.Url = url
+	dbPhoto.Date = parityDate.Add(time.Duration(minutes) * time.Minute)
+
+	for _, option := range options {
+		option(&dbPhoto)
+	}
+
+	err := db.InsertPhoto(context.Background(), &dbPhoto)
+
+	if err != nil {
+		t.Fatalf("inserting the photo %s: %v", url, err)
+	}
+
+	return dbPhoto
+}
+
+func insertComment(t *testing.T, db AppDatabase, dbUser DatabaseUser, dbPhoto DatabasePhoto, body string, minutes int) DatabaseComment {
+	t.Helper()
+
+	dbComment := DatabaseCommentDefault()
+	dbComment.User = dbUser
+	dbComment.Photo = dbPhoto
+	dbComment.Date = parityDate.Add(time.Duration(minutes) * time.Minute)
+	dbComment.CommentBody = body
+
+	err := db.InsertComment(context.Background(), &dbComment)
+
+	if err != nil {
+		t.Fatalf("inserting the comment %q: %v", body, err)
+	}
+
+	return dbComment
+}
+
+func mustDo(t *testing.T, what string, err error) {
+	t.Helper()
+
+	if err != nil {
+		t.Fatalf("%s: %v", what, err)
+	}
+}
+
+func expectError(t *testing.T, what string, err error, want error) {
+	t.Helper()
+
+	if !errors.Is(err, want) {
+		t.Errorf("%s: got error %v, want %v", what, err, want)
+	}
+}
+
+func expectEqual(t *testing.T, what string, got interface{}, want interface{}) {
+	t.Helper()
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("%s: got %v, want %v", what, got, want)
+	}
+}
+
+func photoIds(dbPhotos []DatabasePhoto) []uint32 {
+	ids := make([]uint32, 0, len(dbPhotos))
+
+	for _, dbPhoto := range dbPhotos {
+		ids = append(ids, dbPhoto.Id)
+	}
+
+	return ids
+}
+
+func usernames(dbUsers []DatabaseUser) []string {
+	names := make([]string, 0, len(dbUsers))
+
+	for _, dbUser := range dbUsers {
+		names = append(names, dbUser.Username)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+func sortedUrls(urls []string) []string {
+	sorted := append(make([]string, 0, len(urls)), urls...)
+
+	sort.Strings(sorted)
+
+	return sorted
+}
+
+func TestParityUsers(t *testing.T) {
+	parity(t, func(t *testing.T, db AppDatabase) {
+		ctx := context.Background()
+
+		alice := insertUser(t, db, "alice")
+		bob := insertUser(t, db, "bob")
+
+		if alice.Id == 0 || bob.Id == alice.Id {
+			t.Fatalf("got ids %d and %d, want distinct ids", alice.Id, bob.Id)
+		}
+
+		// a registered user is returned as they are
+		again := insertUser(t, db, "alice")
+		expectEqual(t, "id of the user registered again", again.Id, alice.Id)
+
+		dbUser, err := db.GetDatabaseUser(ctx, bob.Id)
+		mustDo(t, "getting a user", err)
+		expectEqual(t, "username", dbUser.Username, "bob")
+
+		dbLogin := DatabaseLoginDefault()
+		dbLogin.Username = "alice"
+
+		dbUser, err = db.GetDatabaseUserFromDatabaseLogin(ctx, dbLogin)
+		mustDo(t, "getting a user from the login", err)
+		expectEqual(t, "id", dbUser.Id, alice.Id)
+
+		_, err = db.GetDatabaseUser(ctx, bob.Id+100)
+		expectError(t, "getting a missing user", err, ErrUserDoesNotExist)
+
+		// a renamed user keeps their id, while the username they
+		// left is reserved to them until the given date
+		renamed := alice
+		renamed.Username = "alicia"
+
+		mustDo(t, "renaming a user", db.UpdateUser(ctx, alice, renamed, time.Now().Add(time.Hour)))
+
+		dbUser, err = db.GetDatabaseUser(ctx, alice.Id)
+		mustDo(t, "getting a renamed user", err)
+		expectEqual(t, "new username", dbUser.Username, "alicia")
+
+		dbUser, err = db.GetRenamedUser(ctx, "alice")
+		mustDo(t, "getting a user by the username they left", err)
+		expectEqual(t, "id of the renamed user", dbUser.Id, alice.Id)
+
+		reserved := DatabaseUserDefault()
+		reserved.Username = "alice"
+
+		expectError(t, "registering a reserved username", db.InsertUser(ctx, &reserved), ErrUsernameAlreadyTaken)
+
+		taken := renamed
+		taken.Username = "bob"
+
+		expectError(t, "renaming to a taken username", db.UpdateUser(ctx, dbUser, taken, time.Time{}), ErrUsernameAlreadyTaken)
+
+		_, err = db.DeleteUser(ctx, DatabaseUser{Id: bob.Id + 100})
+		expectError(t, "deleting a missing user", err, ErrUserDoesNotExist)
+	})
+}
+
+func TestParityFollows(t *testing.T) {
+	parity(t, func(t *testing.T, db AppDatabase) {
+		ctx := context.Background()
+
+		alice := insertUser(t, db, "alice")
+		bob := insertUser(t, db, "bob")
+		carol := insertUser(t, db, "carol")
+
+		mustDo(t, "following bob", db.InsertFollow(ctx, alice, bob))
+		mustDo(t, "following carol", db.InsertFollow(ctx, alice, carol))
+		mustDo(t, "following alice", db.InsertFollow(ctx, carol, alice))
+
+		following, err := db.GetFollowingCount(ctx, alice, alice)
+		mustDo(t, "counting the followed users", err)
+		expectEqual(t, "following count", following, 2)
+
+		followers, err := db.GetFollowersCount(ctx, bob, alice)
+		mustDo(t, "counting the followers", err)
+		expectEqual(t, "followers count", followers, 1)
+
+		status, err := db.GetFollowStatus(ctx, alice, bob)
+		mustDo(t, "getting the follow status", err)
+		expectEqual(t, "alice follows bob", status, true)
+
+		status, err = db.GetFollowStatus(ctx, bob, alice)
+		mustDo(t, "getting the follow status", err)
+		expectEqual(t, "bob follows alice", status, false)
+
+		dbUserList, err := db.GetFollowingList(ctx, alice, alice)
+		mustDo(t, "listing the followed users", err)
+		expectEqual(t, "followed users", usernames(dbUserList.Users), []string{"bob", "carol"})
+
+		dbUserList, err = db.GetFollowersList(ctx, alice, alice)
+		mustDo(t, "listing the followers", err)
+		expectEqual(t, "followers", usernames(dbUserList.Users), []string{"carol"})
+
+		mustDo(t, "unfollowing bob", db.DeleteFollow(ctx, alice, bob))
+		expectError(t, "unfollowing bob again", db.DeleteFollow(ctx, alice, bob), ErrUserNotFollowed)
+
+		following, err = db.GetFollowingCount(ctx, alice, alice)
+		mustDo(t, "counting the followed users", err)
+		expectEqual(t, "following count after unfollowing", following, 1)
+	})
+}
+
+func TestParityBans(t *testing.T) {
+	parity(t, func(t *testing.T, db AppDatabase) {
+		ctx := context.Background()
+
+		alice := insertUser(t, db, "alice")
+		bob := insertUser(t, db, "bob")
+
+		dbBan := DatabaseBanDefault()
+		dbBan.User = bob
+		dbBan.Reason = "spam"
+
+		mustDo(t, "banning bob", db.InsertBan(ctx, alice, dbBan))
+
+		banned, err := db.CheckBan(ctx, alice, bob)
+		mustDo(t, "checking the ban", err)
+		expectEqual(t, "alice banned bob", banned, true)
+
+		banned, err = db.CheckBan(ctx, bob, alice)
+		mustDo(t, "checking the ban", err)
+		expectEqual(t, "bob banned alice", banned, false)
+
+		dbBanList, err := db.GetBanList(ctx, alice)
+		mustDo(t, "listing the bans", err)
+
+		if len(dbBanList.Bans) != 1 {
+			t.Fatalf("got %d bans, want 1", len(dbBanList.Bans))
+		}
+
+		expectEqual(t, "banned user", dbBanList.Bans[0].User.Username, "bob")
+		expectEqual(t, "reason", dbBanList.Bans[0].Reason, "spam")
+
+		mustDo(t, "unbanning bob", db.DeleteBan(ctx, alice, bob))
+		expectError(t, "unbanning bob again", db.DeleteBan(ctx, alice, bob), ErrUserNotBanned)
+
+		// the bans expire at their date
+		expiresAt := parityDate.Add(time.Hour)
+		dbBan.ExpiresAt = &expiresAt
+
+		mustDo(t, "banning bob until a date", db.InsertBan(ctx, alice, dbBan))
+
+		expired, err := db.DeleteExpiredBans(ctx, parityDate)
+		mustDo(t, "removing the expired bans", err)
+		expectEqual(t, "bans expired before the date", expired, 0)
+
+		expired, err = db.DeleteExpiredBans(ctx, expiresAt.Add(time.Second))
+		mustDo(t, "removing the expired bans", err)
+		expectEqual(t, "bans expired after the date", expired, 1)
+	})
+}
+
+func TestParityPhotoVisibility(t *testing.T) {
+	parity(t, func(t *testing.T, db AppDatabase) {
+		ctx := context.Background()
+
+		alice := insertUser(t, db, "alice")
+		bob := insertUser(t, db, "bob")
+		carol := insertUser(t, db, "carol")
+		dave := insertUser(t, db, "dave")
+		erin := insertUser(t, db, "erin")
+
+		// bob follows alice, who added them as a close friend, carol
+		// follows erin, whose account is private, and dave is a stranger
+		mustDo(t, "following alice", db.InsertFollow(ctx, bob, alice))
+		mustDo(t, "adding a close friend", db.InsertCloseFriend(ctx, alice, bob))
+		mustDo(t, "following erin", db.InsertFollow(ctx, carol, erin))
+
+		dbSettings := DatabaseSettingsDefault()
+		dbSettings.Private = true
+
+		mustDo(t, "making the account private", db.UpdateUserSettings(ctx, erin, dbSettings))
+
+		public := insertPhoto(t, db, alice, "/photos/public.jpg", 0)
+		archived := insertPhoto(t, db, alice, "/photos/archived.jpg", 1)
+		friends := insertPhoto(t, db, alice, "/photos/friends.jpg", 2, func(dbPhoto *DatabasePhoto) { dbPhoto.CloseFriends = true })
+		flagged := insertPhoto(t, db, alice, "/photos/flagged.jpg", 3, func(dbPhoto *DatabasePhoto) { dbPhoto.Flagged = true })
+		scheduled := insertPhoto(t, db, alice, "/photos/scheduled.jpg", 4, func(dbPhoto *DatabasePhoto) { dbPhoto.Scheduled = true })
+		private := insertPhoto(t, db, erin, "/photos/private.jpg", 5)
+
+		mustDo(t, "archiving a photo", db.ArchivePhoto(ctx, archived))
+
+		tests := []struct {
+			name    string
+			photo   DatabasePhoto
+			viewers map[string]bool
+		}{
+			{"public", public, map[string]bool{"alice": true, "bob": true, "carol": true, "dave": true}},
+			{"archived", archived, map[string]bool{"alice": true, "bob": false, "dave": false}},
+			{"close friends", friends, map[string]bool{"alice": true, "bob": true, "dave": false}},
+			{"flagged", flagged, map[string]bool{"alice": true, "bob": false, "dave": false}},
+			{"scheduled", scheduled, map[string]bool{"alice": true, "bob": false, "dave": false}},
+			{"private account", private, map[string]bool{"erin": true, "carol": true, "dave": false}},
+		}
+
+		viewers := map[string]DatabaseUser{"alice": alice, "bob": bob, "carol": carol, "dave": dave, "erin": erin}
+
+		for _, test := range tests {
+			for viewer, visible := range test.viewers {
+				dbPhoto, err := db.GetDatabasePhoto(ctx, test.photo.Id, viewers[viewer])
+
+				if !visible {
+					expectError(t, test.name+" photo seen by "+viewer, err, ErrPhotoDoesNotExist)
+					continue
+				}
+
+				mustDo(t, "getting the "+test.name+" photo as "+viewer, err)
+				expectEqual(t, test.name+" photo url", dbPhoto.Url, test.photo.Url)
+				expectEqual(t, test.name+" photo date", dbPhoto.Date.Unix(), test.photo.Date.Unix())
+			}
+		}
+
+		_, err := db.GetDatabasePhoto(ctx, private.Id+100, alice)
+		expectError(t, "getting a missing photo", err, ErrPhotoDoesNotExist)
+
+		// the profile counts the photos the user can see
+		count, err := db.GetPhotoCount(ctx, alice, dave)
+		mustDo(t, "counting the photos", err)
+		expectEqual(t, "photos of alice seen by dave", count, 1)
+
+		count, err = db.GetPhotoCount(ctx, alice, alice)
+		mustDo(t, "counting the photos", err)
+		expectEqual(t, "photos of alice seen by alice", count, 4)
+	})
+}
+
+func TestParityLikesAndComments(t *testing.T) {
+	parity(t, func(t *testing.T, db AppDatabase) {
+		ctx := context.Background()
+
+		alice := insertUser(t, db, "alice")
+		bob := insertUser(t, db, "bob")
+		carol := insertUser(t, db, "carol")
+
+		dbPhoto := insertPhoto(t, db, alice, "/photos/liked.jpg", 0)
+
+		mustDo(t, "liking the photo", db.InsertLike(ctx, bob, dbPhoto, ReactionLike))
+		mustDo(t, "loving the photo", db.InsertLike(ctx, carol, dbPhoto, ReactionLove))
+
+		// liking again replaces the reaction
+		mustDo(t, "changing the reaction", db.InsertLike(ctx, bob, dbPhoto, ReactionWow))
+
+		first := insertComment(t, db, bob, dbPhoto, "first", 1)
+		insertComment(t, db, carol, dbPhoto, "second", 2)
+		insertComment(t, db, alice, dbPhoto, "third", 3)
+
+		seen, err := db.GetDatabasePhoto(ctx, dbPhoto.Id, bob)
+		mustDo(t, "getting the photo", err)
+		expectEqual(t, "like count", seen.LikeCount, 2)
+		expectEqual(t, "comment count", seen.CommentCount, 3)
+		expectEqual(t, "like status", seen.LikeStatus, true)
+		expectEqual(t, "reaction", seen.Reaction, ReactionWow)
+		expectEqual(t, "reactions", seen.Reactions, map[string]int{ReactionWow: 1, ReactionLove: 1})
+
+		seen, err = db.GetDatabasePhoto(ctx, dbPhoto.Id, alice)
+		mustDo(t, "getting the photo", err)
+		expectEqual(t, "like status of the owner", seen.LikeStatus, false)
+
+		dbCommentList, err := db.GetCommentList(ctx, dbPhoto, alice, CommentSortOldest, 10, 0)
+		mustDo(t, "listing the comments", err)
+		expectEqual(t, "comments from the oldest", commentBodies(dbCommentList.Comments), []string{"first", "second", "third"})
+
+		dbCommentList, err = db.GetCommentList(ctx, dbPhoto, alice, CommentSortNewest, 2, 0)
+		mustDo(t, "listing the comments", err)
+		expectEqual(t, "first page from the newest", commentBodies(dbCommentList.Comments), []string{"third", "second"})
+
+		// the likes and the comments of the users who banned the user are not counted
+		dbBan := DatabaseBanDefault()
+		dbBan.User = bob
+
+		mustDo(t, "banning bob", db.InsertBan(ctx, carol, dbBan))
+
+		seen, err = db.GetDatabasePhoto(ctx, dbPhoto.Id, bob)
+		mustDo(t, "getting the photo", err)
+		expectEqual(t, "like count without the users banning bob", seen.LikeCount, 1)
+		expectEqual(t, "comment count without the users banning bob", seen.CommentCount, 2)
+
+		// the owner can hide the like counts of their photos to the others
+		dbSettings := DatabaseSettingsDefault()
+		dbSettings.HideLikeCounts = true
+
+		mustDo(t, "hiding the like counts", db.UpdateUserSettings(ctx, alice, dbSettings))
+
+		seen, err = db.GetDatabasePhoto(ctx, dbPhoto.Id, carol)
+		mustDo(t, "getting the photo", err)
+		expectEqual(t, "likes hidden", seen.LikesHidden, true)
+		expectEqual(t, "hidden like count", seen.LikeCount, 0)
+
+		seen, err = db.GetDatabasePhoto(ctx, dbPhoto.Id, alice)
+		mustDo(t, "getting the photo", err)
+		expectEqual(t, "likes hidden to the owner", seen.LikesHidden, false)
+		expectEqual(t, "like count seen by the owner", seen.LikeCount, 2)
+
+		mustDo(t, "unliking the photo", db.DeleteLike(ctx, carol, dbPhoto))
+		expectError(t, "unliking the photo again", db.DeleteLike(ctx, carol, dbPhoto), ErrPhotoNotLiked)
+
+		mustDo(t, "deleting a comment", db.DeleteComment(ctx, first))
+
+		_, err = db.GetDatabaseComment(ctx, first.Id, alice)
+		expectError(t, "getting a deleted comment", err, ErrCommentDoesNotExist)
+
+		seen, err = db.GetDatabasePhoto(ctx, dbPhoto.Id, alice)
+		mustDo(t, "getting the photo", err)
+		expectEqual(t, "like count after unliking", seen.LikeCount, 1)
+		expectEqual(t, "comment count after deleting", seen.CommentCount, 2)
+	})
+}
+
+func commentBodies(dbComments []DatabaseComment) []string {
+	bodies := make([]string, 0, len(dbComments))
+
+	for _, dbComment := range dbComments {
+		bodies = append(bodies, dbComment.CommentBody)
+	}
+
+	return bodies
+}
+
+func TestParityProfilePhotos(t *testing.T) {
+	parity(t, func(t *testing.T, db AppDatabase) {
+		ctx := context.Background()
+
+		alice := insertUser(t, db, "alice")
+		bob := insertUser(t, db, "bob")
+
+		dbPhotos := make([]DatabasePhoto, 0)
+
+		for i, url := range []string{"/photos/1.jpg", "/photos/2.jpg", "/photos/3.jpg", "/photos/4.jpg", "/photos/5.jpg"} {
+			dbPhotos = append(dbPhotos, insertPhoto(t, db, alice, url, i))
+		}
+
+		// the pinned photos come first, from the last pinned
+		mustDo(t, "pinning a photo", db.PinPhoto(ctx, dbPhotos[1], 2, parityDate))
+		mustDo(t, "pinning a photo", db.PinPhoto(ctx, dbPhotos[0], 2, parityDate.Add(time.Minute)))
+		expectError(t, "pinning too many photos", db.PinPhoto(ctx, dbPhotos[2], 2, parityDate.Add(2*time.Minute)), ErrTooManyPinnedPhotos)
+
+		mustDo(t, "archiving a photo", db.ArchivePhoto(ctx, dbPhotos[3]))
+
+		dbProfile := DatabaseProfileDefault()
+		dbProfile.User = alice
+
+		mustDo(t, "getting the first page", db.GetPhotos(ctx, &dbProfile, bob, false, 1, 0))
+		expectEqual(t, "first page", photoIds(dbProfile.Photos), []uint32{dbPhotos[0].Id, dbPhotos[1].Id, dbPhotos[4].Id})
+		expectEqual(t, "cursor of the first page", dbProfile.NextCursor, dbPhotos[4].Id)
+
+		dbProfile = DatabaseProfileDefault()
+		dbProfile.User = alice
+
+		mustDo(t, "getting the second page", db.GetPhotos(ctx, &dbProfile, bob, false, 1, dbPhotos[4].Id))
+		expectEqual(t, "second page", photoIds(dbProfile.Photos), []uint32{dbPhotos[2].Id})
+		expectEqual(t, "cursor of the last page", dbProfile.NextCursor, uint32(0))
+
+		dbProfile = DatabaseProfileDefault()
+		dbProfile.User = alice
+
+		mustDo(t, "getting the archive", db.GetPhotos(ctx, &dbProfile, alice, true, 10, 0))
+		expectEqual(t, "archive", photoIds(dbProfile.Photos), []uint32{dbPhotos[3].Id})
+
+		// archiving a pinned photo unpins it
+		mustDo(t, "archiving a pinned photo", db.ArchivePhoto(ctx, dbPhotos[0]))
+		mustDo(t, "restoring the photo", db.UnarchivePhoto(ctx, dbPhotos[0]))
+
+		dbPhoto, err := db.GetDatabasePhoto(ctx, dbPhotos[0].Id, alice)
+		mustDo(t, "getting the restored photo", err)
+		expectEqual(t, "pinned after the archive", dbPhoto.Pinned, false)
+
+		mustDo(t, "unpinning a photo", db.UnpinPhoto(ctx, dbPhotos[1]))
+
+		dbPhoto, err = db.GetDatabasePhoto(ctx, dbPhotos[1].Id, alice)
+		mustDo(t, "getting the unpinned photo", err)
+		expectEqual(t, "pinned after unpinning", dbPhoto.Pinned, false)
+
+		mustDo(t, "deleting a photo", db.DeletePhoto(ctx, dbPhotos[2]))
+		expectError(t, "deleting the photo again", db.DeletePhoto(ctx, dbPhotos[2]), ErrPhotoDoesNotExist)
+	})
+}
+
+func TestParityStream(t *testing.T) {
+	parity(t, func(t *testing.T, db AppDatabase) {
+		ctx := context.Background()
+
+		alice := insertUser(t, db, "alice")
+		bob := insertUser(t, db, "bob")
+		carol := insertUser(t, db, "carol")
+		dave := insertUser(t, db, "dave")
+
+		mustDo(t, "following bob", db.InsertFollow(ctx, alice, bob))
+		mustDo(t, "following carol", db.InsertFollow(ctx, alice, carol))
+
+		insertPhoto(t, db, alice, "/photos/own.jpg", 0)
+		bob1 := insertPhoto(t, db, bob, "/photos/bob1.jpg", 1)
+		carol1 := insertPhoto(t, db, carol, "/photos/carol1.jpg", 2)
+		insertPhoto(t, db, dave, "/photos/dave.jpg", 3)
+		bob2 := insertPhoto(t, db, bob, "/photos/bob2.jpg", 4)
+		insertPhoto(t, db, bob, "/photos/later.jpg", 5, func(dbPhoto *DatabasePhoto) { dbPhoto.Scheduled = true })
+
+		dbStream, err := db.GetDatabaseStream(ctx, alice, DatabaseStreamFilterDefault(), 10, 0, 0)
+		mustDo(t, "getting the stream", err)
+		expectEqual(t, "stream", photoIds(dbStream.Photos), []uint32{bob2.Id, carol1.Id, bob1.Id})
+
+		if len(dbStream.Photos) > 0 {
+			expectEqual(t, "author of the newest photo", dbStream.Photos[0].User.Username, "bob")
+		}
+
+		dbStream, err = db.GetDatabaseStream(ctx, alice, DatabaseStreamFilterDefault(), 2, carol1.Id, 0)
+		mustDo(t, "getting the stream before a photo", err)
+		expectEqual(t, "stream before carol1", photoIds(dbStream.Photos), []uint32{bob1.Id})
+
+		dbStream, err = db.GetDatabaseStream(ctx, alice, DatabaseStreamFilterDefault(), 10, 0, carol1.Id)
+		mustDo(t, "getting the stream after a photo", err)
+		expectEqual(t, "stream after carol1", photoIds(dbStream.Photos), []uint32{bob2.Id})
+
+		filter := DatabaseStreamFilterDefault()
+		filter.Authors = []uint32{carol.Id}
+
+		dbStream, err = db.GetDatabaseStream(ctx, alice, filter, 10, 0, 0)
+		mustDo(t, "getting the stream of an author", err)
+		expectEqual(t, "stream of carol", photoIds(dbStream.Photos), []uint32{carol1.Id})
+
+		filter = DatabaseStreamFilterDefault()
+		filter.Since = carol1.Date
+		filter.Until = bob2.Date
+
+		dbStream, err = db.GetDatabaseStream(ctx, alice, filter, 10, 0, 0)
+		mustDo(t, "getting the stream between two dates", err)
+		expectEqual(t, "stream between two dates", photoIds(dbStream.Photos), []uint32{carol1.Id})
+
+		// the photos the user saw are left out of the unseen ones
+		mustDo(t, "marking the stream as seen", db.SetStreamSeen(ctx, alice, carol1.Date))
+
+		filter = DatabaseStreamFilterDefault()
+		filter.Unseen = true
+
+		dbStream, err = db.GetDatabaseStream(ctx, alice, filter, 10, 0, 0)
+		mustDo(t, "getting the unseen stream", err)
+		expectEqual(t, "unseen stream", photoIds(dbStream.Photos), []uint32{bob2.Id})
+
+		dbUpdates, err := db.GetStreamUpdates(ctx, alice, bob1.Id)
+		mustDo(t, "getting the stream updates", err)
+		expectEqual(t, "stream updates", dbUpdates, DatabaseStreamUpdates{Count: 2, NewestId: bob2.Id})
+
+		// the muted users are left out of the stream
+		mustDo(t, "muting bob", db.InsertMute(ctx, alice, bob))
+
+		dbStream, err = db.GetDatabaseStream(ctx, alice, DatabaseStreamFilterDefault(), 10, 0, 0)
+		mustDo(t, "getting the stream", err)
+		expectEqual(t, "stream without bob", photoIds(dbStream.Photos), []uint32{carol1.Id})
+	})
+}
+
+func TestParityPhotoChanges(t *testing.T) {
+	parity(t, func(t *testing.T, db AppDatabase) {
+		ctx := context.Background()
+
+		alice := insertUser(t, db, "alice")
+		bob := insertUser(t, db, "bob")
+
+		mustDo(t, "following alice", db.InsertFollow(ctx, bob, alice))
+
+		dbPhoto := insertPhoto(t, db, alice, "/photos/first.jpg", 0, func(dbPhoto *DatabasePhoto) { dbPhoto.AltText = "A photo" })
+		later := insertPhoto(t, db, alice, "/photos/later.jpg", 10, func(dbPhoto *DatabasePhoto) { dbPhoto.Scheduled = true })
+
+		seen, err := db.GetDatabasePhoto(ctx, dbPhoto.Id, bob)
+		mustDo(t, "getting the photo", err)
+		expectEqual(t, "alt text given at the upload", seen.AltText, "A photo")
+
+		mustDo(t, "setting the alt text", db.SetPhotoAltText(ctx, dbPhoto, "A new description"))
+
+		dbStream, err := db.GetDatabaseStream(ctx, bob, DatabaseStreamFilterDefault(), 10, 0, 0)
+		mustDo(t, "getting the stream", err)
+		expectEqual(t, "stream before the publication", photoIds(dbStream.Photos), []uint32{dbPhoto.Id})
+
+		if len(dbStream.Photos) > 0 {
+			expectEqual(t, "alt text in the stream", dbStream.Photos[0].AltText, "A new description")
+		}
+
+		expectError(t, "setting the alt text of a missing photo", db.SetPhotoAltText(ctx, DatabasePhoto{Id: later.Id + 100}, ""), ErrPhotoDoesNotExist)
+
+		// the scheduled photos are published once their date has come
+		dbPhotos, err := db.PublishScheduledPhotos(ctx, later.Date.Add(-time.Second))
+		mustDo(t, "publishing the scheduled photos", err)
+		expectEqual(t, "photos published before their date", photoIds(dbPhotos), []uint32{})
+
+		dbPhotos, err = db.PublishScheduledPhotos(ctx, later.Date)
+		mustDo(t, "publishing the scheduled photos", err)
+		expectEqual(t, "photos published at their date", photoIds(dbPhotos), []uint32{later.Id})
+
+		dbStream, err = db.GetDatabaseStream(ctx, bob, DatabaseStreamFilterDefault(), 10, 0, 0)
+		mustDo(t, "getting the stream", err)
+		expectEqual(t, "stream after the publication", photoIds(dbStream.Photos), []uint32{later.Id, dbPhoto.Id})
+
+		// an edited photo keeps its original, which only its owner sees
+		replaced, err := db.EditPhoto(ctx, dbPhoto, "/photos/edited.jpg", "/photos/first.jpg")
+		mustDo(t, "editing the photo", err)
+		expectEqual(t, "replaced url", replaced, "/photos/first.jpg")
+
+		seen, err = db.GetDatabasePhoto(ctx, dbPhoto.Id, alice)
+		mustDo(t, "getting the edited photo", err)
+		expectEqual(t, "url of the edited photo", seen.Url, "/photos/edited.jpg")
+		expectEqual(t, "original seen by the owner", seen.OriginalUrl, "/photos/first.jpg")
+
+		seen, err = db.GetDatabasePhoto(ctx, dbPhoto.Id, bob)
+		mustDo(t, "getting the edited photo", err)
+		expectEqual(t, "original seen by the others", seen.OriginalUrl, "")
+
+		for url, want := range map[string]bool{"/photos/edited.jpg": true, "/photos/first.jpg": true, "/photos/missing.jpg": false} {
+			used, err := db.IsUrlUsed(ctx, url)
+			mustDo(t, "checking the url "+url, err)
+			expectEqual(t, "url "+url+" used", used, want)
+		}
+
+		_, err = db.EditPhoto(ctx, DatabasePhoto{Id: later.Id + 100}, "/photos/x.jpg", "")
+		expectError(t, "editing a missing photo", err, ErrPhotoDoesNotExist)
+	})
+}
+
+func TestParityAccountRemoval(t *testing.T) {
+	parity(t, func(t *testing.T, db AppDatabase) {
+		ctx := context.Background()
+
+		alice := insertUser(t, db, "alice")
+		bob := insertUser(t, db, "bob")
+		carol := insertUser(t, db, "carol")
+
+		// each account has a photo, an edited one, a video with
+		// its poster, a story and an avatar, sharing no files
+		for _, dbUser := range []DatabaseUser{alice, bob, carol} {
+			name := dbUser.Username
+
+			insertPhoto(t, db, dbUser, "/photos/"+name+".jpg", 0)
+			edited := insertPhoto(t, db, dbUser, "/photos/"+name+"-original.jpg", 1)
+
+			_, err := db.EditPhoto(ctx, edited, "/photos/"+name+"-edited.jpg", "/photos/"+name+"-original.jpg")
+			mustDo(t, "editing the photo", err)
+
+			insertPhoto(t, db, dbUser, "/photos/"+name+".mp4", 2, func(dbPhoto *DatabasePhoto) {
+				dbPhoto.MediaType = MediaVideo
+				dbPhoto.PosterUrl = "/photos/" + name + "-poster.jpg"
+				dbPhoto.Duration = 3 * time.Second
+			})
+
+			dbStory := DatabaseStoryDefault()
+			dbStory.User = dbUser
+			dbStory.Url = "/photos/" + name + "-story.jpg"
+			dbStory.Date = parityDate
+			dbStory.ExpiresAt = parityDate.Add(24 * time.Hour)
+
+			mustDo(t, "inserting the story", db.InsertStory(ctx, &dbStory))
+
+			_, err = db.SetUserAvatar(ctx, dbUser, "/photos/"+name+"-avatar.jpg")
+			mustDo(t, "setting the avatar", err)
+		}
+
+		files := func(name string) []string {
+			return sortedUrls([]string{
+				"/photos/" + name + ".jpg",
+				"/photos/" + name + "-edited.jpg",
+				"/photos/" + name + "-original.jpg",
+				"/photos/" + name + ".mp4",
+				"/photos/" + name + "-poster.jpg",
+				"/photos/" + name + "-story.jpg",
+				"/photos/" + name + "-avatar.jpg",
+			})
+		}
+
+		// a deleted account returns the urls of its files
+		urls, err := db.DeleteUser(ctx, alice)
+		mustDo(t, "deleting alice", err)
+		expectEqual(t, "files of the deleted account", sortedUrls(urls), files("alice"))
+
+		used, err := db.IsUrlUsed(ctx, "/photos/alice.jpg")
+		mustDo(t, "checking a url of the deleted account", err)
+		expectEqual(t, "url of the deleted account used", used, false)
+
+		// so does an account deactivated outside of the reactivation window
+		mustDo(t, "deactivating bob", db.DeactivateUser(ctx, bob, parityDate))
+
+		dbLogin := DatabaseLoginDefault()
+		dbLogin.Username = "bob"
+
+		urls, err = db.ReactivateUser(ctx, dbLogin, parityDate.Add(-time.Hour))
+		mustDo(t, "reactivating bob within the window", err)
+		expectEqual(t, "files of the reactivated account", sortedUrls(urls), []string{})
+
+		mustDo(t, "deactivating bob again", db.DeactivateUser(ctx, bob, parityDate))
+
+		urls, err = db.ReactivateUser(ctx, dbLogin, parityDate.Add(time.Hour))
+		mustDo(t, "reactivating bob after the window", err)
+		expectEqual(t, "files of the expired account", sortedUrls(urls), files("bob"))
+
+		_, err = db.GetDatabaseUser(ctx, bob.Id)
+		expectError(t, "getting the expired account", err, ErrUserDoesNotExist)
+
+		// and an erased one, whose erasure is requested once
+		dave := insertUser(t, db, "dave")
+		commented := insertPhoto(t, db, dave, "/photos/dave.jpg", 0)
+		insertComment(t, db, carol, commented, "a comment which is kept", 1)
+
+		dbErasure, err := db.RequestErasure(ctx, carol, parityDate)
+		mustDo(t, "requesting the erasure of carol", err)
+
+		_, err = db.RequestErasure(ctx, carol, parityDate)
+		expectError(t, "requesting the erasure again", err, ErrErasurePending)
+
+		_, err = db.ReactivateUser(ctx, DatabaseLogin{Username: "carol"}, parityDate.Add(-time.Hour))
+		expectError(t, "reactivating an account being erased", err, ErrErasurePending)
+
+		dbErasures, err := db.GetPendingErasures(ctx, 10)
+		mustDo(t, "getting the pending erasures", err)
+
+		if len(dbErasures) != 1 || dbErasures[0].Id != dbErasure.Id {
+			t.Fatalf("got pending erasures %v, want the erasure %d", dbErasures, dbErasure.Id)
+		}
+
+		urls, err = db.EraseUser(ctx, dbErasures[0], parityDate.Add(time.Hour))
+		mustDo(t, "erasing carol", err)
+		expectEqual(t, "files of the erased account", sortedUrls(urls), files("carol"))
+
+		dbErasures, err = db.GetPendingErasures(ctx, 10)
+		mustDo(t, "getting the pending erasures", err)
+		expectEqual(t, "pending erasures after the erasure", len(dbErasures), 0)
+
+		// the comments under the photos of the others are credited to the deleted user
+		dbCommentList, err := db.GetCommentList(ctx, commented, dave, CommentSortOldest, 10, 0)
+		mustDo(t, "listing the comments", err)
+
+		if len(dbCommentList.Comments) != 1 {
+			t.Fatalf("got %d comments, want the comment of the erased user", len(dbCommentList.Comments))
+		}
+
+		expectEqual(t, "author of the kept comment", dbCommentList.Comments[0].User.Username, DeletedUsername)
+	})
+}
+
+func TestParityFollowRequests(t *testing.T) {
+	parity(t, func(t *testing.T, db AppDatabase) {
+		ctx := context.Background()
+
+		alice := insertUser(t, db, "alice")
+		bob := insertUser(t, db, "bob")
+		carol := insertUser(t, db, "carol")
+
+		mustDo(t, "bob requesting to follow alice", db.InsertFollowRequest(ctx, bob, alice, parityDate))
+		mustDo(t, "carol requesting to follow alice", db.InsertFollowRequest(ctx, carol, alice, parityDate))
+
+		requested, err := db.CheckFollowRequest(ctx, bob, alice)
+		mustDo(t, "checking the request", err)
+		expectEqual(t, "bob requested to follow alice", requested, true)
+
+		dbUserList, err := db.GetFollowRequests(ctx, alice)
+		mustDo(t, "listing the requests", err)
+		expectEqual(t, "requesters", usernames(dbUserList.Users), []string{"bob", "carol"})
+
+		mustDo(t, "approving the request of bob", db.ApproveFollowRequest(ctx, alice, bob))
+		mustDo(t, "refusing the request of carol", db.DeleteFollowRequest(ctx, carol, alice))
+
+		expectError(t, "approving a refused request", db.ApproveFollowRequest(ctx, alice, carol), ErrFollowRequestDoesNotExist)
+		expectError(t, "refusing a refused request", db.DeleteFollowRequest(ctx, carol, alice), ErrFollowRequestDoesNotExist)
+
+		status, err := db.GetFollowStatus(ctx, bob, alice)
+		mustDo(t, "getting the follow status", err)
+		expectEqual(t, "bob follows alice after the approval", status, true)
+
+		dbUserList, err = db.GetFollowRequests(ctx, alice)
+		mustDo(t, "listing the requests", err)
+		expectEqual(t, "requesters after the approval", usernames(dbUserList.Users), []string{})
+	})
+}
+
+func TestParityStories(t *testing.T) {
+	parity(t, func(t *testing.T, db AppDatabase) {
+		ctx := context.Background()
+
+		alice := insertUser(t, db, "alice")
+		bob := insertUser(t, db, "bob")
+		carol := insertUser(t, db, "carol")
+
+		mustDo(t, "following bob", db.InsertFollow(ctx, alice, bob))
+		mustDo(t, "following carol", db.InsertFollow(ctx, alice, carol))
+
+		insertStory := func(dbUser DatabaseUser, url string, minutes int) DatabaseStory {
+			dbStory := DatabaseStoryDefault()
+			dbStory.User = dbUser
+			dbStory.Url = url
+			dbStory.Date = parityDate.Add(time.Duration(minutes) * time.Minute)
+			dbStory.ExpiresAt = dbStory.Date.Add(time.Hour)
+
+			mustDo(t, "inserting the story "+url, db.InsertStory(ctx, &dbStory))
+
+			return dbStory
+		}
+
+		first := insertStory(bob, "/photos/bob1.jpg", 0)
+		second := insertStory(bob, "/photos/bob2.jpg", 30)
+		insertStory(carol, "/photos/carol.jpg", 10)
+
+		now := parityDate.Add(45 * time.Minute)
+
+		dbStoryList, err := db.GetStories(ctx, bob, now)
+		mustDo(t, "listing the stories", err)
+		expectEqual(t, "stories from the oldest", storyIds(dbStoryList.Stories), []uint32{first.Id, second.Id})
+
+		dbStoryTray, err := db.GetStoryTray(ctx, alice, now)
+		mustDo(t, "getting the story tray", err)
+
+		tray := make([]string, 0)
+
+		for _, entry := range dbStoryTray.Users {
+			tray = append(tray, entry.User.Username)
+		}
+
+		expectEqual(t, "story tray from the latest", tray, []string{"bob", "carol"})
+
+		if len(dbStoryTray.Users) > 0 {
+			expectEqual(t, "stories of bob", dbStoryTray.Users[0].StoryCount, 2)
+			expectEqual(t, "latest story of bob", dbStoryTray.Users[0].LatestDate.Unix(), second.Date.Unix())
+		}
+
+		// the expired stories are left out, then removed
+		now = parityDate.Add(75 * time.Minute)
+
+		dbStoryList, err = db.GetStories(ctx, bob, now)
+		mustDo(t, "listing the stories", err)
+		expectEqual(t, "stories left", storyIds(dbStoryList.Stories), []uint32{second.Id})
+
+		dbStories, err := db.DeleteExpiredStories(ctx, now)
+		mustDo(t, "removing the expired stories", err)
+
+		expired := make([]string, 0)
+
+		for _, dbStory := range dbStories {
+			expired = append(expired, dbStory.Url)
+		}
+
+		expectEqual(t, "expired stories", sortedUrls(expired), []string{"/photos/bob1.jpg", "/photos/carol.jpg"})
+
+		_, err = db.GetDatabaseStory(ctx, first.Id)
+		expectError(t, "getting an expired story", err, ErrStoryDoesNotExist)
+
+		mustDo(t, "deleting a story", db.DeleteStory(ctx, second))
+		expectError(t, "deleting the story again", db.DeleteStory(ctx, second), ErrStoryDoesNotExist)
+	})
+}
+
+func storyIds(dbStories []DatabaseStory) []uint32 {
+	ids := make([]uint32, 0, len(dbStories))
+
+	for _, dbStory := range dbStories {
+		ids = append(ids, dbStory.Id)
+	}
+
+	return ids
+}
+
+func TestParityAlbums(t *testing.T) {
+	parity(t, func(t *testing.T, db AppDatabase) {
+		ctx := context.Background()
+
+		alice := insertUser(t, db, "alice")
+		bob := insertUser(t, db, "bob")
+
+		first := insertPhoto(t, db, alice, "/photos/1.jpg", 0)
+		second := insertPhoto(t, db, alice, "/photos/2.jpg", 1)
+		archived := insertPhoto(t, db, alice, "/photos/3.jpg", 2)
+
+		mustDo(t, "archiving a photo", db.ArchivePhoto(ctx, archived))
+
+		dbAlbum := DatabaseAlbumDefault()
+		dbAlbum.User = alice
+		dbAlbum.Name = "Rome"
+		dbAlbum.Date = parityDate
+
+		mustDo(t, "inserting the album", db.InsertAlbum(ctx, &dbAlbum))
+		mustDo(t, "setting the photos", db.SetAlbumPhotos(ctx, dbAlbum, []uint32{second.Id, archived.Id, first.Id}))
+
+		seen, err := db.GetDatabaseAlbum(ctx, dbAlbum.Id, alice)
+		mustDo(t, "getting the album", err)
+		expectEqual(t, "photos seen by the owner", photoIds(seen.Photos), []uint32{second.Id, archived.Id, first.Id})
+		expectEqual(t, "cover", seen.CoverUrl, "/photos/2.jpg")
+
+		seen, err = db.GetDatabaseAlbum(ctx, dbAlbum.Id, bob)
+		mustDo(t, "getting the album", err)
+		expectEqual(t, "photos seen by the others", photoIds(seen.Photos), []uint32{second.Id, first.Id})
+		expectEqual(t, "photo count seen by the others", seen.PhotoCount, 2)
+
+		dbAlbum.Name = "Roma"
+
+		mustDo(t, "renaming the album", db.UpdateAlbum(ctx, dbAlbum))
+
+		dbAlbumList, err := db.GetAlbums(ctx, alice, bob)
+		mustDo(t, "listing the albums", err)
+
+		if len(dbAlbumList.Albums) != 1 {
+			t.Fatalf("got %d albums, want 1", len(dbAlbumList.Albums))
+		}
+
+		expectEqual(t, "name of the renamed album", dbAlbumList.Albums[0].Name, "Roma")
+
+		// deleting a photo takes it out of the album
+		mustDo(t, "deleting a photo", db.DeletePhoto(ctx, second))
+
+		seen, err = db.GetDatabaseAlbum(ctx, dbAlbum.Id, alice)
+		mustDo(t, "getting the album", err)
+		expectEqual(t, "photos after deleting one", photoIds(seen.Photos), []uint32{archived.Id, first.Id})
+
+		mustDo(t, "deleting the album", db.DeleteAlbum(ctx, dbAlbum))
+		expectError(t, "deleting the album again", db.DeleteAlbum(ctx, dbAlbum), ErrAlbumDoesNotExist)
+
+		_, err = db.GetDatabaseAlbum(ctx, dbAlbum.Id, alice)
+		expectError(t, "getting the deleted album", err, ErrAlbumDoesNotExist)
+
+		// the photos outlive the album
+		_, err = db.GetDatabasePhoto(ctx, first.Id, alice)
+		mustDo(t, "getting a photo of the deleted album", err)
+	})
+}
+
+func TestParityExportImport(t *testing.T) {
+	parity(t, func(t *testing.T, db AppDatabase) {
+		ctx := context.Background()
+
+		alice := insertUser(t, db, "alice")
+		bob := insertUser(t, db, "bob")
+		carol := insertUser(t, db, "carol")
+
+		first := insertPhoto(t, db, alice, "/photos/1.jpg", 0)
+		archived := insertPhoto(t, db, alice, "/photos/2.jpg", 1)
+		insertPhoto(t, db, alice, "/photos/video.mp4", 2, func(p *DatabasePhoto) { p.MediaType = MediaVideo })
+		insertPhoto(t, db, alice, "/photos/later.jpg", 3, func(p *DatabasePhoto) { p.Scheduled = true })
+
+		mustDo(t, "archiving a photo", db.ArchivePhoto(ctx, archived))
+
+		insertComment(t, db, bob, first, "nice @carol", 10)
+		insertComment(t, db, alice, first, "thanks", 11)
+		insertComment(t, db, carol, first, "wow", 12)
+
+		// the scheduled photos and the videos are left out
+		dbExport, err := db.GetExport(ctx, alice)
+		mustDo(t, "exporting the account", err)
+
+		exported := make([]uint32, 0)
+
+		for _, dbExportPhoto := range dbExport.Photos {
+			exported = append(exported, dbExportPhoto.Photo.Id)
+		}
+
+		expectEqual(t, "exported photos", exported, []uint32{first.Id, archived.Id})
+		expectEqual(t, "exported comments", commentBodies(dbExport.Photos[0].Comments), []string{"nice @carol", "thanks", "wow"})
+		expectEqual(t, "author of an exported comment", dbExport.Photos[0].Comments[0].User.Username, "bob")
+
+		dave := insertUser(t, db, "dave")
+
+		// only the comments of the exported account are imported, as the
+		// importer cannot prove who wrote the others
+		dbImport := DatabaseImportDefault()
+		dbImport.Source = "alice"
+		dbImport.SourceId = first.Id
+		dbImport.Photo = dbExport.Photos[0].Photo
+		dbImport.Photo.User = dave
+		dbImport.Comments = dbExport.Photos[0].Comments[1:2]
+
+		mustDo(t, "importing a photo", db.ImportPhoto(ctx, &dbImport))
+
+		imported, err := db.GetDatabasePhoto(ctx, dbImport.Photo.Id, dave)
+		mustDo(t, "getting the imported photo", err)
+		expectEqual(t, "date of the imported photo", imported.Date, first.Date)
+		expectEqual(t, "comment count of the imported photo", imported.CommentCount, 1)
+
+		dbCommentList, err := db.GetCommentList(ctx, imported, dave, CommentSortOldest, 10, 0)
+		mustDo(t, "listing the imported comments", err)
+		expectEqual(t, "imported comments", commentBodies(dbCommentList.Comments), []string{"thanks"})
+		expectEqual(t, "date of an imported comment", dbCommentList.Comments[0].Date, parityDate.Add(11*time.Minute))
+		expectEqual(t, "author of the comment of the exported account", dbCommentList.Comments[0].User.Id, dave.Id)
+
+		// the imported comments notify no one
+		count, err := db.GetUnreadNotificationCount(ctx, dave)
+		mustDo(t, "counting the notifications", err)
+		expectEqual(t, "notifications of the imported comments", count, 0)
+
+		// importing the photo again fails, and the import is resumed from the next one
+		expectError(t, "importing the photo again", db.ImportPhoto(ctx, &dbImport), ErrPhotoAlreadyImported)
+
+		importedIds, err := db.GetImportedPhotos(ctx, dave, "alice")
+		mustDo(t, "getting the imported photos", err)
+		expectEqual(t, "imported photos", importedIds, map[uint32]uint32{first.Id: dbImport.Photo.Id})
+
+		// deleting the imported photo lets it be imported again
+		mustDo(t, "deleting the imported photo", db.DeletePhoto(ctx, imported))
+
+		importedIds, err = db.GetImportedPhotos(ctx, dave, "alice")
+		mustDo(t, "getting the imported photos", err)
+		expectEqual(t, "imported photos after deleting one", importedIds, map[uint32]uint32{})
+	})
+}
+
+func TestParitySessions(t *testing.T) {
+	parity(t, func(t *testing.T, db AppDatabase) {
+		ctx := context.Background()
+
+		alice := insertUser(t, db, "alice")
+
+		dbSession := DatabaseSessionDefault()
+		dbSession.User = alice
+		dbSession.TokenHash = "access-1"
+		dbSession.CreatedAt = parityDate
+		dbSession.ExpiresAt = parityDate.Add(time.Hour)
+		dbSession.LastSeen = parityDate
+
+		dbRefreshToken := DatabaseRefreshTokenDefault()
+		dbRefreshToken.TokenHash = "refresh-1"
+		dbRefreshToken.CreatedAt = parityDate
+		dbRefreshToken.ExpiresAt = parityDate.Add(time.Hour)
+
+		mustDo(t, "inserting the session", db.InsertSession(ctx, &dbSession, &dbRefreshToken))
+
+		seen, err := db.GetDatabaseSession(ctx, "access-1")
+		mustDo(t, "getting the session", err)
+		expectEqual(t, "user of the session", seen.User.Username, "alice")
+		expectEqual(t, "expiry of the session", seen.ExpiresAt.Unix(), dbSession.ExpiresAt.Unix())
+
+		mustDo(t, "touching the session", db.TouchSession(ctx, seen, parityDate.Add(time.Minute)))
+
+		// a refresh token is exchanged once for new tokens
+		dbRefreshToken, err = db.GetDatabaseRefreshToken(ctx, "refresh-1")
+		mustDo(t, "getting the refresh token", err)
+		expectEqual(t, "session of the refresh token", dbRefreshToken.Session.Id, dbSession.Id)
+
+		newDbRefreshToken := DatabaseRefreshTokenDefault()
+		newDbRefreshToken.TokenHash = "refresh-2"
+		newDbRefreshToken.CreatedAt = parityDate.Add(time.Minute)
+		newDbRefreshToken.ExpiresAt = parityDate.Add(2 * time.Hour)
+
+		mustDo(t, "rotating the refresh token", db.RotateRefreshToken(ctx, dbRefreshToken, &newDbRefreshToken, "access-2"))
+
+		reused := DatabaseRefreshTokenDefault()
+		reused.TokenHash = "refresh-3"
+
+		expectError(t, "rotating the refresh token again", db.RotateRefreshToken(ctx, dbRefreshToken, &reused, "access-3"), ErrRefreshTokenReused)
+
+		_, err = db.GetDatabaseSession(ctx, "access-1")
+		expectError(t, "getting the session by the old token", err, ErrSessionDoesNotExist)
+
+		seen, err = db.GetDatabaseSession(ctx, "access-2")
+		mustDo(t, "getting the session by the new token", err)
+		expectEqual(t, "expiry of the rotated session", seen.ExpiresAt.Unix(), newDbRefreshToken.ExpiresAt.Unix())
+
+		mustDo(t, "signing the user out", db.DeleteUserSessions(ctx, alice))
+
+		_, err = db.GetDatabaseSession(ctx, "access-2")
+		expectError(t, "getting a revoked session", err, ErrSessionDoesNotExist)
+
+		expectError(t, "revoking a revoked session", db.DeleteSession(ctx, seen), ErrSessionDoesNotExist)
+	})
+}
+
+func TestParityAPIKeys(t *testing.T) {
+	parity(t, func(t *testing.T, db AppDatabase) {
+		ctx := context.Background()
+
+		alice := insertUser(t, db, "alice")
+		bob := insertUser(t, db, "bob")
+
+		insertKey := func(dbUser DatabaseUser, keyHash string) {
+			dbAPIKey := DatabaseAPIKeyDefault()
+			dbAPIKey.User = dbUser
+			dbAPIKey.Name = keyHash
+			dbAPIKey.KeyHash = keyHash
+			dbAPIKey.Scope = "read"
+			dbAPIKey.CreatedAt = parityDate
+
+			mustDo(t, "inserting the API key", db.InsertAPIKey(ctx, &dbAPIKey, 10))
+		}
+
+		insertKey(alice, "key-alice")
+		insertKey(bob, "key-bob")
+
+		dbAPIKey, err := db.GetDatabaseAPIKey(ctx, "key-alice")
+		mustDo(t, "getting the API key", err)
+		expectEqual(t, "user of the API key", dbAPIKey.User.Username, "alice")
+
+		// suspending a user revokes their keys, which
+		// stay revoked once the suspension is lifted
+		mustDo(t, "suspending alice", db.SuspendUser(ctx, alice, parityDate))
+
+		_, err = db.GetDatabaseAPIKey(ctx, "key-alice")
+		expectError(t, "getting the API key of a suspended user", err, ErrAPIKeyDoesNotExist)
+
+		mustDo(t, "unsuspending alice", db.UnsuspendUser(ctx, alice))
+
+		dbAPIKeys, err := db.GetAPIKeys(ctx, alice)
+		mustDo(t, "listing the API keys", err)
+		expectEqual(t, "API keys of an unsuspended user", len(dbAPIKeys), 0)
+
+		// the keys of a deactivated user are kept, but not accepted
+		mustDo(t, "deactivating bob", db.DeactivateUser(ctx, bob, parityDate))
+
+		_, err = db.GetDatabaseAPIKey(ctx, "key-bob")
+		expectError(t, "getting the API key of a deactivated user", err, ErrAPIKeyDoesNotExist)
+	})
+}
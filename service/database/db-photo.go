@@ -1,139 +1,488 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"errors"
+	"math/bits"
+	"time"
 )
 
-func (db *appdbimpl) GetDatabasePhoto(photoId uint32, dbUser DatabaseUser) (DatabasePhoto, error) {
+// the media types of the photos: the images, and the short videos shown with a poster
+const (
+	MediaImage = "image"
+	MediaVideo = "video"
+)
+
+// visiblePhoto filters out the photos that the user performing the action cannot see besides the archived ones: the
+// photos flagged as unsafe, which only their owner sees until the administrators clear them, the scheduled photos,
+// which only their owner sees until they are published, the photos of the users
+// shadow banned by the administrators, which only their owner sees, the photos for close friends, which their owner
+// and the users they added as close friends see, and the photos of the private accounts, which their owner and their
+// followers see. It takes the id of the user performing the action three times.
+const visiblePhoto = `(
+	Photo."user"=?
+	OR (
+		NOT Photo.flagged
+		AND NOT Photo.scheduled
+		AND Photo."user" NOT IN (
+			SELECT id
+			FROM "User"
+			WHERE shadow_banned
+		)
+		AND (
+			NOT Photo.close_friends
+			OR Photo."user" IN (
+				SELECT first_user
+				FROM close_friend
+				WHERE second_user=?
+			)
+		)
+		AND (
+			Photo."user" NOT IN (
+				SELECT "user"
+				FROM settings
+				WHERE private
+			)
+			OR Photo."user" IN (
+				SELECT second_user
+				FROM follow
+				WHERE first_user=?
+			)
+		)
+	)
+)`
+
+// visiblePhotoOwner filters out the photos of the users shadow banned by the administrators and of the private
+// accounts, unless they belong to the user performing the action, for the public lists of photos not using
+// visiblePhoto. It takes the id of the user performing the action once.
+const visiblePhotoOwner = `(
+	Photo."user"=?
+	OR (
+		Photo."user" NOT IN (
+			SELECT id
+			FROM "User"
+			WHERE shadow_banned
+		)
+		AND Photo."user" NOT IN (
+			SELECT "user"
+			FROM settings
+			WHERE private
+		)
+	)
+)`
+
+func (db *appdbimpl) GetDatabasePhoto(ctx context.Context, photoId uint32, dbUser DatabaseUser) (DatabasePhoto, error) {
 	dbPhoto := DatabasePhotoDefault()
 
-	err := db.c.QueryRow(`
-		SELECT id, user, date, url
+	var visible bool
+
+	err := db.c.QueryRowContext(ctx, `
+		SELECT id, "user", date, url, archived, close_friends, flagged, scheduled, `+visiblePhoto+`, latitude, longitude, COALESCE(place, ''), pinned_at IS NOT NULL, media_type, poster_url, duration, original_url, alt_text
 		FROM Photo
 		WHERE id=?
-	`, photoId).Scan(&dbPhoto.Id, &dbPhoto.User.Id, &dbPhoto.Date, &dbPhoto.Url)
+	`, dbUser.Id, dbUser.Id, dbUser.Id, photoId).Scan(&dbPhoto.Id, &dbPhoto.User.Id, unixTime{&dbPhoto.Date}, &dbPhoto.Url, &dbPhoto.Archived, &dbPhoto.CloseFriends, &dbPhoto.Flagged, &dbPhoto.Scheduled, &visible, &dbPhoto.Latitude, &dbPhoto.Longitude, &dbPhoto.Place, &dbPhoto.Pinned, &dbPhoto.MediaType, &dbPhoto.PosterUrl, milliseconds{&dbPhoto.Duration}, &dbPhoto.OriginalUrl, &dbPhoto.AltText)
 
 	if errors.Is(err, sql.ErrNoRows) {
 		return dbPhoto, ErrPhotoDoesNotExist
 	}
 
+	if err != nil {
+		return dbPhoto, err
+	}
+
+	// an archived, a flagged or a scheduled photo is only visible to its owner,
+	// and a photo for the close friends to them and to its owner
+	if (dbPhoto.Archived && dbPhoto.User.Id != dbUser.Id) || !visible {
+		return DatabasePhotoDefault(), ErrPhotoDoesNotExist
+	}
+
+	// the original of an edited photo is only given to its owner
+	if dbPhoto.User.Id != dbUser.Id {
+		dbPhoto.OriginalUrl = ""
+	}
+
 	// get the user information
-	dbPhotoUser, err := db.GetDatabaseUser(dbPhoto.User.Id)
+	dbPhotoUser, err := db.GetDatabaseUser(ctx, dbPhoto.User.Id)
 
 	if err != nil {
 		return dbPhoto, err
 	}
 
-	dbPhoto.User.Username = dbPhotoUser.Username
+	dbPhoto.User = dbPhotoUser
+
+	// get the like count, the comment count and the like status
+	err = db.GetPhotoStats(ctx, &dbPhoto, dbUser)
+
+	return dbPhoto, err
+}
+
+func (db *appdbimpl) GetPhotoStats(ctx context.Context, dbPhoto *DatabasePhoto, dbUser DatabaseUser) error {
+	var stats cachedPhotoStats
 
-	// get the like count
-	err = db.GetPhotoLikeCount(&dbPhoto, dbUser)
+	err := db.cached(ctx, photoGroup(dbPhoto.Id), viewerKey(dbUser), db.ttl.Photo, &stats, func() error {
+		err := db.getPhotoStats(ctx, dbPhoto, dbUser)
+
+		stats = cachedPhotoStats{
+			LikeCount:    dbPhoto.LikeCount,
+			CommentCount: dbPhoto.CommentCount,
+			LikeStatus:   dbPhoto.LikeStatus,
+			Reaction:     dbPhoto.Reaction,
+			Reactions:    dbPhoto.Reactions,
+			LikesHidden:  dbPhoto.LikesHidden,
+		}
+
+		return err
+	})
 
 	if err != nil {
-		return dbPhoto, err
+		return err
 	}
 
-	// get the comment count
-	err = db.GetPhotoCommentCount(&dbPhoto, dbUser)
+	dbPhoto.LikeCount = stats.LikeCount
+	dbPhoto.CommentCount = stats.CommentCount
+	dbPhoto.LikeStatus = stats.LikeStatus
+	dbPhoto.Reaction = stats.Reaction
+	dbPhoto.Reactions = stats.Reactions
+	dbPhoto.LikesHidden = stats.LikesHidden
+
+	return nil
+}
+
+// getPhotoStats reads the stats of the photo from the database
+func (db *appdbimpl) getPhotoStats(ctx context.Context, dbPhoto *DatabasePhoto, dbUser DatabaseUser) error {
+	var reaction sql.NullString
+
+	// return the number of likes and comments to the photo,
+	// without counting the ones of users who banned the user
+	// performing the action and the comments the user cannot
+	// see, the reaction of the user performing the action
+	// (if any) and whether the owner of the photo hid its
+	// likes to the user, in a single round trip
+	err := db.c.QueryRowContext(ctx, `
+		SELECT
+			like_count - (
+				SELECT COUNT(*)
+				FROM "like"
+				WHERE photo=Photo.id
+				AND "user" IN (
+					SELECT first_user
+					FROM ban
+					WHERE second_user=?
+				)
+			),
+			comment_count - (
+				SELECT COUNT(*)
+				FROM Comment
+				WHERE photo=Photo.id
+				AND (
+					"user" IN (
+						SELECT first_user
+						FROM ban
+						WHERE second_user=?
+					)
+					OR NOT `+visibleComment+`
+				)
+			),
+			(
+				SELECT type
+				FROM "like"
+				WHERE "user"=?
+				AND photo=Photo.id
+			),
+			Photo."user"<>? AND Photo."user" IN (
+				SELECT "user"
+				FROM settings
+				WHERE hide_like_counts
+			)
+		FROM Photo
+		WHERE id=?
+	`, dbUser.Id, dbUser.Id, dbUser.Id, dbUser.Id, dbUser.Id, dbPhoto.Id).Scan(&dbPhoto.LikeCount, &dbPhoto.CommentCount, &reaction, &dbPhoto.LikesHidden)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrPhotoDoesNotExist
+	}
 
 	if err != nil {
-		return dbPhoto, err
+		return err
 	}
 
-	// get the like status
-	err = db.GetPhotoLikeStatus(&dbPhoto, dbUser)
+	dbPhoto.LikeStatus = reaction.Valid
+	dbPhoto.Reaction = reaction.String
 
-	return dbPhoto, err
+	// the owner of the photo hid how many users liked it
+	if dbPhoto.LikesHidden {
+		dbPhoto.LikeCount = 0
+		dbPhoto.Reactions = make(map[string]int)
+
+		return nil
+	}
+
+	return db.getPhotoReactions(ctx, dbPhoto, dbUser)
 }
 
-func (db *appdbimpl) GetPhotoLikeStatus(dbPhoto *DatabasePhoto, dbUser DatabaseUser) error {
-	// check whether the first user has banned the second user
-	err := db.c.QueryRow(`
-		SELECT EXISTS(
-			SELECT 1
-			FROM like
-			WHERE user=?
-			AND photo=?
+// getPhotoReactions counts the reactions to the photo of each type, without
+// counting the ones of users who banned the user performing the action
+func (db *appdbimpl) getPhotoReactions(ctx context.Context, dbPhoto *DatabasePhoto, dbUser DatabaseUser) error {
+	rows, err := db.c.QueryContext(ctx, `
+		SELECT type, COUNT(*)
+		FROM "like"
+		WHERE photo=?
+		AND "user" NOT IN (
+			SELECT first_user
+			FROM ban
+			WHERE second_user=?
 		)
-	`, dbUser.Id, dbPhoto.Id).Scan(&dbPhoto.LikeStatus)
+		GROUP BY type
+	`, dbPhoto.Id, dbUser.Id)
+
+	if err != nil {
+		return err
+	}
+
+	dbPhoto.Reactions = make(map[string]int)
+
+	for rows.Next() {
+		var reaction string
+		var count int
+
+		err = rows.Scan(&reaction, &count)
+
+		if err != nil {
+			return err
+		}
+
+		dbPhoto.Reactions[reaction] = count
+	}
+
+	if rows.Err() != nil {
+		return err
+	}
+
+	_ = rows.Close()
+
+	return err
+}
+
+func (db *appdbimpl) GetPhotoLikeStatus(ctx context.Context, dbPhoto *DatabasePhoto, dbUser DatabaseUser) error {
+	// get the reaction of the user to the photo
+	err := db.c.QueryRowContext(ctx, `
+		SELECT type
+		FROM "like"
+		WHERE "user"=?
+		AND photo=?
+	`, dbUser.Id, dbPhoto.Id).Scan(&dbPhoto.Reaction)
 
 	// if no table rows are found, then there is no row
 	// containing the like, hence the user has not liked the photo
 	if errors.Is(err, sql.ErrNoRows) {
+		dbPhoto.LikeStatus = false
+		dbPhoto.Reaction = ""
 		return nil
 	}
 
+	dbPhoto.LikeStatus = err == nil
+
 	return err
 }
 
-func (db *appdbimpl) InsertPhoto(dbPhoto *DatabasePhoto) error {
+func (db *appdbimpl) InsertPhoto(ctx context.Context, dbPhoto *DatabasePhoto) error {
 	// insert the photo into the database
-	res, err := db.c.Exec(`
-		INSERT INTO Photo(user, url, date)
-		VALUES (?, ?, ?)
-	`, dbPhoto.User.Id, dbPhoto.Url, dbPhoto.Date)
+	// and get the photo id
+	// the hash is stored as the signed integer with the same bits
+	var hash interface{}
+
+	if dbPhoto.Hash != nil {
+		hash = int64(*dbPhoto.Hash)
+	}
+
+	// a photo without a place has neither the place nor its key
+	var place, key interface{}
+
+	if dbPhoto.Place != "" {
+		place = dbPhoto.Place
+		key = placeKey(dbPhoto.Place)
+	}
+
+	err := db.retry(ctx, func() error {
+		return db.c.QueryRowContext(ctx, `
+			INSERT INTO Photo("user", url, date, phash, latitude, longitude, place, place_key, close_friends, flagged, scheduled, media_type, poster_url, duration, alt_text)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			RETURNING id
+		`, dbPhoto.User.Id, dbPhoto.Url, dbPhoto.Date.Unix(), hash, dbPhoto.Latitude, dbPhoto.Longitude, place, key, dbPhoto.CloseFriends, dbPhoto.Flagged, dbPhoto.Scheduled, dbPhoto.MediaType, dbPhoto.PosterUrl, dbPhoto.Duration.Milliseconds(), dbPhoto.AltText).Scan(&dbPhoto.Id)
+	})
 
 	if err != nil {
 		return err
 	}
 
-	// get the photo id
-	dbPhotoId, err := res.LastInsertId()
+	db.invalidate(ctx, photosGroup(dbPhoto.User.Id))
+
+	return nil
+}
+
+func (db *appdbimpl) GetSimilarPhoto(ctx context.Context, dbUser DatabaseUser, hash uint64, distance int) (DatabasePhoto, error) {
+	dbPhoto := DatabasePhotoDefault()
+
+	// get the hashes of every photo of the user, archived ones included;
+	// the distance between the hashes is computed here since the engines
+	// do not share a function counting the bits
+	rows, err := db.c.QueryContext(ctx, `
+		SELECT id, url, date, phash
+		FROM Photo
+		WHERE "user"=?
+		AND phash IS NOT NULL
+	`, dbUser.Id)
+
+	if err != nil {
+		return dbPhoto, err
+	}
+
+	best := distance + 1
+
+	for rows.Next() {
+		photo := DatabasePhotoDefault()
+
+		var photoHash int64
+
+		err = rows.Scan(&photo.Id, &photo.Url, unixTime{&photo.Date}, &photoHash)
+
+		if err != nil {
+			_ = rows.Close()
+			return dbPhoto, err
+		}
+
+		photo.User = dbUser
+
+		photo.Hash = new(uint64)
+		*photo.Hash = uint64(photoHash)
+
+		// keep the nearest photo, the oldest one among the equally near
+		if d := bits.OnesCount64(*photo.Hash ^ hash); d < best || (d == best && photo.Id < dbPhoto.Id) {
+			best = d
+			dbPhoto = photo
+		}
+	}
+
+	if rows.Err() != nil {
+		return dbPhoto, err
+	}
+
+	_ = rows.Close()
+
+	if best > distance {
+		return dbPhoto, ErrPhotoDoesNotExist
+	}
+
+	return dbPhoto, nil
+}
+
+func (db *appdbimpl) DeletePhoto(ctx context.Context, dbPhoto DatabasePhoto) error {
+	// remove the photo together with its likes and comments
+	// in a single transaction, so that a failure halfway
+	// through does not leave orphaned rows behind
+	err := db.withTx(ctx, func(tx *dbtx) error {
+		err := deletePhotoTx(ctx, tx, dbPhoto.Id)
+
+		if err != nil {
+			return err
+		}
+
+		return insertAuditTx(ctx, tx, dbPhoto.User.Id, AuditDeletePhoto, dbPhoto.Id, "")
+	})
 
 	if err != nil {
 		return err
 	}
 
-	dbPhoto.Id = uint32(dbPhotoId)
+	db.invalidate(ctx, photosGroup(dbPhoto.User.Id), photoGroup(dbPhoto.Id))
 
 	return nil
 }
 
-func (db *appdbimpl) DeletePhoto(dbPhoto DatabasePhoto) error {
+// IsUrlUsed tells whether a photo, the original of an edited photo, the poster of a video, a story or an avatar is
+// served at `url`, reading from the primary so that the ones inserted just before are seen
+func (db *appdbimpl) IsUrlUsed(ctx context.Context, url string) (bool, error) {
+	var used bool
+
+	err := db.c.QueryRowContext(ctx, `
+		SELECT EXISTS (SELECT 1 FROM Photo WHERE url=?)
+		OR EXISTS (SELECT 1 FROM Photo WHERE original_url=?)
+		OR EXISTS (SELECT 1 FROM Photo WHERE poster_url=?)
+		OR EXISTS (SELECT 1 FROM story WHERE url=?)
+		OR EXISTS (SELECT 1 FROM "User" WHERE avatar=?)
+	`, url, url, url, url, url).Scan(&used)
+
+	return used, err
+}
+
+// deletePhotoTx removes the photo with the given id, every like
+// to it and every comment under it within the given transaction
+func deletePhotoTx(ctx context.Context, tx *dbtx, photoId uint32) error {
 	// remove every like to the photo from the database
-	_, err := db.c.Exec(`
-		DELETE FROM like
+	_, err := tx.ExecContext(ctx, `
+		DELETE FROM "like"
 		WHERE photo=?
-	`, dbPhoto.Id)
+	`, photoId)
 
 	if err != nil {
 		return err
 	}
 
 	// remove every comment under the photo from the database
-	_, err = db.c.Exec(`
+	_, err = tx.ExecContext(ctx, `
 		DELETE FROM Comment
 		WHERE photo=?
-	`, dbPhoto.Id)
+	`, photoId)
 
 	if err != nil {
 		return err
 	}
 
 	// remove the photo from the database
-	_, err = db.c.Exec(`
+	res, err := tx.ExecContext(ctx, `
 		DELETE FROM Photo
 		WHERE id=?
-	`, dbPhoto.Id)
+	`, photoId)
 
-	return err
+	if err != nil {
+		return err
+	}
+
+	aff, err := res.RowsAffected()
+
+	if err != nil {
+		return err
+	}
+
+	// if there are no affected rows
+	// then the photo did not exist
+	if aff == 0 {
+		return ErrPhotoDoesNotExist
+	}
+
+	return nil
 }
 
-func (db *appdbimpl) GetPhotoLikeCount(dbPhoto *DatabasePhoto, dbUser DatabaseUser) error {
+func (db *appdbimpl) GetPhotoLikeCount(ctx context.Context, dbPhoto *DatabasePhoto, dbUser DatabaseUser) error {
 	// return the number of likes to the photo
 	// without counting the likes of users who banned
-	// the user performing the action
-	err := db.c.QueryRow(`
-		SELECT COUNT(*)
-		FROM like
-		WHERE photo=?
-		AND user NOT IN (
-			SELECT first_user
-			FROM ban
-			WHERE second_user=?
+	// the user performing the action, subtracting
+	// them from the counter of the photo
+	err := db.c.QueryRowContext(ctx, `
+		SELECT like_count - (
+			SELECT COUNT(*)
+			FROM "like"
+			WHERE photo=?
+			AND "user" IN (
+				SELECT first_user
+				FROM ban
+				WHERE second_user=?
+			)
 		)
-	`, dbPhoto.Id, dbUser.Id).Scan(&dbPhoto.LikeCount)
+		FROM Photo
+		WHERE id=?
+	`, dbPhoto.Id, dbUser.Id, dbPhoto.Id).Scan(&dbPhoto.LikeCount)
 
 	if errors.Is(err, sql.ErrNoRows) {
 		return ErrPhotoDoesNotExist
@@ -142,19 +491,25 @@ func (db *appdbimpl) GetPhotoLikeCount(dbPhoto *DatabasePhoto, dbUser DatabaseUs
 	return err
 }
 
-func (db *appdbimpl) GetPhotoCommentCount(dbPhoto *DatabasePhoto, dbUser DatabaseUser) error {
-	// return the number of likes to the photo
-	// without counting the likes of users who banned
-	// the user performing the action
-	err := db.c.QueryRow(`
-		SELECT COUNT(*)
-		FROM Comment
-		WHERE photo=?
-		AND user NOT IN (
-			SELECT first_user
-			FROM ban
-			WHERE second_user=?
-		)`, dbPhoto.Id, dbUser.Id).Scan(&dbPhoto.CommentCount)
+func (db *appdbimpl) GetPhotoCommentCount(ctx context.Context, dbPhoto *DatabasePhoto, dbUser DatabaseUser) error {
+	// return the number of comments to the photo
+	// without counting the comments of users who banned
+	// the user performing the action, subtracting
+	// them from the counter of the photo
+	err := db.c.QueryRowContext(ctx, `
+		SELECT comment_count - (
+			SELECT COUNT(*)
+			FROM Comment
+			WHERE photo=?
+			AND "user" IN (
+				SELECT first_user
+				FROM ban
+				WHERE second_user=?
+			)
+		)
+		FROM Photo
+		WHERE id=?
+	`, dbPhoto.Id, dbUser.Id, dbPhoto.Id).Scan(&dbPhoto.CommentCount)
 
 	if errors.Is(err, sql.ErrNoRows) {
 		return ErrPhotoDoesNotExist
@@ -163,13 +518,40 @@ func (db *appdbimpl) GetPhotoCommentCount(dbPhoto *DatabasePhoto, dbUser Databas
 	return err
 }
 
-func (db *appdbimpl) GetPhotos(dbProfile *DatabaseProfile, dbUser DatabaseUser) error {
-	rows, err := db.c.Query(`
+func (db *appdbimpl) GetPhotos(ctx context.Context, dbProfile *DatabaseProfile, dbUser DatabaseUser, archived bool, limit int, before uint32) error {
+	// the first page of the photos which are not archived
+	// starts with the pinned ones, from the last pinned
+	if !archived && before == 0 {
+		err := db.getPinnedPhotos(ctx, dbProfile, dbUser)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	// get a page of at most `limit` photos of the profile,
+	// either archived or not and without the pinned ones,
+	// keeping only the photos older than the photo `before`
+	// (if it is not 0); one more photo is requested to know
+	// whether there is a next page
+	rows, err := db.read().QueryContext(ctx, `
 		SELECT id
-		FROM photo
-		WHERE user=?
-		ORDER BY date DESC
-	`, dbProfile.User.Id)
+		FROM Photo
+		WHERE "user"=?
+		AND archived=?
+		AND pinned_at IS NULL
+		AND `+visiblePhoto+`
+		AND (
+			?=0
+			OR (date, id) < (
+				SELECT date, id
+				FROM Photo
+				WHERE id=?
+			)
+		)
+		ORDER BY date DESC, id DESC
+		LIMIT ?
+	`, dbProfile.User.Id, archived, dbUser.Id, dbUser.Id, dbUser.Id, before, before, limit+1)
 
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
@@ -179,6 +561,8 @@ func (db *appdbimpl) GetPhotos(dbProfile *DatabaseProfile, dbUser DatabaseUser)
 		return err
 	}
 
+	dbPhotos := make([]DatabasePhoto, 0)
+
 	// build the results list
 	for rows.Next() {
 		newDbPhoto := DatabasePhotoDefault()
@@ -189,13 +573,13 @@ func (db *appdbimpl) GetPhotos(dbProfile *DatabaseProfile, dbUser DatabaseUser)
 			return err
 		}
 
-		newDbPhoto, err = db.GetDatabasePhoto(newDbPhoto.Id, dbUser)
+		newDbPhoto, err = db.GetDatabasePhoto(ctx, newDbPhoto.Id, dbUser)
 
 		if err != nil {
 			return err
 		}
 
-		dbProfile.Photos = append(dbProfile.Photos, newDbPhoto)
+		dbPhotos = append(dbPhotos, newDbPhoto)
 	}
 
 	if rows.Err() != nil {
@@ -204,22 +588,379 @@ func (db *appdbimpl) GetPhotos(dbProfile *DatabaseProfile, dbUser DatabaseUser)
 
 	_ = rows.Close()
 
+	// if there is a next page, its cursor
+	// is the last photo of the current one
+	if len(dbPhotos) > limit {
+		dbPhotos = dbPhotos[:limit]
+		dbProfile.NextCursor = dbPhotos[limit-1].Id
+	}
+
+	dbProfile.Photos = append(dbProfile.Photos, dbPhotos...)
+
 	return err
 }
 
-func (db *appdbimpl) GetPhotoCount(dbUser DatabaseUser) (int, error) {
-	var photoCount int
-
-	// get the number of photos the user has posted
-	err := db.c.QueryRow(`
-		SELECT COUNT(*)
+// getPinnedPhotos adds to the profile the photos pinned by its user, from the last pinned to the first one
+func (db *appdbimpl) getPinnedPhotos(ctx context.Context, dbProfile *DatabaseProfile, dbUser DatabaseUser) error {
+	rows, err := db.read().QueryContext(ctx, `
+		SELECT id
 		FROM Photo
-		WHERE user=?
-	`, dbUser.Id).Scan(&photoCount)
+		WHERE "user"=?
+		AND pinned_at IS NOT NULL
+		AND NOT archived
+		AND `+visiblePhoto+`
+		ORDER BY pinned_at DESC, id DESC
+	`, dbProfile.User.Id, dbUser.Id, dbUser.Id, dbUser.Id)
 
-	if errors.Is(err, sql.ErrNoRows) {
-		return photoCount, ErrPhotoDoesNotExist
+	if err != nil {
+		return err
+	}
+
+	for rows.Next() {
+		dbPhoto := DatabasePhotoDefault()
+
+		err = rows.Scan(&dbPhoto.Id)
+
+		if err != nil {
+			return err
+		}
+
+		dbPhoto, err = db.GetDatabasePhoto(ctx, dbPhoto.Id, dbUser)
+
+		if err != nil {
+			return err
+		}
+
+		dbProfile.Photos = append(dbProfile.Photos, dbPhoto)
+	}
+
+	if rows.Err() != nil {
+		return err
+	}
+
+	_ = rows.Close()
+
+	return err
+}
+
+func (db *appdbimpl) PinPhoto(ctx context.Context, dbPhoto DatabasePhoto, maxPinned int, date time.Time) error {
+	return db.withTx(ctx, func(tx *dbtx) error {
+		var userId uint32
+		var pinned bool
+
+		// get the owner of the photo and whether it is already pinned
+		err := tx.QueryRowContext(ctx, `
+			SELECT "user", pinned_at IS NOT NULL
+			FROM Photo
+			WHERE id=?
+		`, dbPhoto.Id).Scan(&userId, &pinned)
+
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrPhotoDoesNotExist
+		}
+
+		if err != nil {
+			return err
+		}
+
+		// a photo pinned again keeps its place
+		if pinned {
+			return nil
+		}
+
+		var count int
+
+		err = tx.QueryRowContext(ctx, `
+			SELECT COUNT(*)
+			FROM Photo
+			WHERE "user"=?
+			AND pinned_at IS NOT NULL
+		`, userId).Scan(&count)
+
+		if err != nil {
+			return err
+		}
+
+		if count >= maxPinned {
+			return ErrTooManyPinnedPhotos
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			UPDATE Photo
+			SET pinned_at=?
+			WHERE id=?
+		`, date.Unix(), dbPhoto.Id)
+
+		return err
+	})
+}
+
+func (db *appdbimpl) UnpinPhoto(ctx context.Context, dbPhoto DatabasePhoto) error {
+	var res sql.Result
+
+	err := db.retry(ctx, func() (err error) {
+		res, err = db.c.ExecContext(ctx, `
+			UPDATE Photo
+			SET pinned_at=NULL
+			WHERE id=?
+		`, dbPhoto.Id)
+
+		return err
+	})
+
+	if err != nil {
+		return err
+	}
+
+	aff, err := res.RowsAffected()
+
+	if err != nil {
+		return err
 	}
 
+	// if there are no affected rows
+	// then the photo did not exist
+	if aff == 0 {
+		return ErrPhotoDoesNotExist
+	}
+
+	return nil
+}
+
+func (db *appdbimpl) GetPhotoCount(ctx context.Context, profileDbUser DatabaseUser, dbUser DatabaseUser) (int, error) {
+	var photoCount int
+
+	err := db.cached(ctx, photosGroup(profileDbUser.Id), viewerKey(dbUser), db.ttl.Profile, &photoCount, func() error {
+		// get the number of photos the user has posted
+		// without counting the archived ones and the ones
+		// for close friends the user performing the action
+		// cannot see
+		err := db.read().QueryRowContext(ctx, `
+			SELECT COUNT(*)
+			FROM Photo
+			WHERE "user"=?
+			AND NOT archived
+			AND `+visiblePhoto+`
+		`, profileDbUser.Id, dbUser.Id, dbUser.Id, dbUser.Id).Scan(&photoCount)
+
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrPhotoDoesNotExist
+		}
+
+		return err
+	})
+
 	return photoCount, err
 }
+
+func (db *appdbimpl) ArchivePhoto(ctx context.Context, dbPhoto DatabasePhoto) error {
+	return db.setPhotoArchived(ctx, dbPhoto, true)
+}
+
+func (db *appdbimpl) UnarchivePhoto(ctx context.Context, dbPhoto DatabasePhoto) error {
+	return db.setPhotoArchived(ctx, dbPhoto, false)
+}
+
+func (db *appdbimpl) SetPhotoAltText(ctx context.Context, dbPhoto DatabasePhoto, altText string) error {
+	var res sql.Result
+
+	err := db.retry(ctx, func() (err error) {
+		res, err = db.c.ExecContext(ctx, `
+			UPDATE Photo
+			SET alt_text=?
+			WHERE id=?
+		`, altText, dbPhoto.Id)
+
+		return err
+	})
+
+	if err != nil {
+		return err
+	}
+
+	aff, err := res.RowsAffected()
+
+	if err != nil {
+		return err
+	}
+
+	// if there are no affected rows
+	// then the photo did not exist
+	if aff == 0 {
+		return ErrPhotoDoesNotExist
+	}
+
+	db.invalidate(ctx, photosGroup(dbPhoto.User.Id), photoGroup(dbPhoto.Id))
+
+	return nil
+}
+
+func (db *appdbimpl) EditPhoto(ctx context.Context, dbPhoto DatabasePhoto, url string, originalUrl string) (string, error) {
+	var replaced string
+
+	err := db.withTx(ctx, func(tx *dbtx) error {
+		// get the url being replaced, whose file
+		// is removed afterwards unless still used
+		err := tx.QueryRowContext(ctx, `
+			SELECT url
+			FROM Photo
+			WHERE id=?
+		`, dbPhoto.Id).Scan(&replaced)
+
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrPhotoDoesNotExist
+		}
+
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			UPDATE Photo
+			SET url=?, original_url=?
+			WHERE id=?
+		`, url, originalUrl, dbPhoto.Id)
+
+		return err
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	db.invalidate(ctx, photosGroup(dbPhoto.User.Id), photoGroup(dbPhoto.Id))
+
+	return replaced, nil
+}
+
+func (db *appdbimpl) PublishScheduledPhotos(ctx context.Context, now time.Time) ([]DatabasePhoto, error) {
+	dbPhotos := make([]DatabasePhoto, 0)
+
+	err := db.retry(ctx, func() error {
+		dbPhotos = dbPhotos[:0]
+
+		// show the scheduled photos whose date has come, which
+		// enter the streams and the profiles with that date
+		rows, err := db.c.QueryContext(ctx, `
+			UPDATE Photo
+			SET scheduled=FALSE
+			WHERE scheduled
+			AND date<=?
+			RETURNING id, "user", date, flagged
+		`, now.Unix())
+
+		if err != nil {
+			return err
+		}
+
+		defer rows.Close()
+
+		for rows.Next() {
+			dbPhoto := DatabasePhotoDefault()
+
+			err = rows.Scan(&dbPhoto.Id, &dbPhoto.User.Id, unixTime{&dbPhoto.Date}, &dbPhoto.Flagged)
+
+			if err != nil {
+				return err
+			}
+
+			dbPhotos = append(dbPhotos, dbPhoto)
+		}
+
+		return rows.Err()
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, dbPhoto := range dbPhotos {
+		db.invalidate(ctx, photosGroup(dbPhoto.User.Id), photoGroup(dbPhoto.Id))
+	}
+
+	return dbPhotos, nil
+}
+
+// setPhotoArchived hides (or shows again) the photo from the profile
+// and the streams, leaving its likes and comments untouched; an
+// archived photo is no longer pinned
+func (db *appdbimpl) setPhotoArchived(ctx context.Context, dbPhoto DatabasePhoto, archived bool) error {
+	var res sql.Result
+
+	err := db.retry(ctx, func() (err error) {
+		res, err = db.c.ExecContext(ctx, `
+			UPDATE Photo
+			SET archived=?, pinned_at=CASE WHEN ? THEN NULL ELSE pinned_at END
+			WHERE id=?
+		`, archived, archived, dbPhoto.Id)
+
+		return err
+	})
+
+	if err != nil {
+		return err
+	}
+
+	aff, err := res.RowsAffected()
+
+	if err != nil {
+		return err
+	}
+
+	// if there are no affected rows
+	// then the photo did not exist
+	if aff == 0 {
+		return ErrPhotoDoesNotExist
+	}
+
+	db.invalidate(ctx, photosGroup(dbPhoto.User.Id))
+
+	return nil
+}
+
+// rebuildPhotoCounters recomputes the like and comment counters of every photo from the like and comment tables
+const rebuildPhotoCounters = `
+		UPDATE Photo
+		SET like_count=(
+			SELECT COUNT(*)
+			FROM "like"
+			WHERE "like".photo=Photo.id
+		),
+		comment_count=(
+			SELECT COUNT(*)
+			FROM Comment
+			WHERE Comment.photo=Photo.id
+		);
+	`
+
+func (db *appdbimpl) RebuildPhotoCounters(ctx context.Context) error {
+	// recompute the counters from scratch, fixing
+	// any drift from the like and comment tables
+	return db.retry(ctx, func() error {
+		_, err := db.c.ExecContext(ctx, rebuildPhotoCounters)
+
+		return err
+	})
+}
+
+// addPhotoLikeCount adds `delta` to the like counter of the photo `photoId` within the given transaction
+func addPhotoLikeCount(ctx context.Context, tx *dbtx, photoId uint32, delta int) error {
+	_, err := tx.ExecContext(ctx, `
+		UPDATE Photo
+		SET like_count=like_count+?
+		WHERE id=?
+	`, delta, photoId)
+
+	return err
+}
+
+// addPhotoCommentCount adds `delta` to the comment counter of the photo `photoId` within the given transaction
+func addPhotoCommentCount(ctx context.Context, tx *dbtx, photoId uint32, delta int) error {
+	_, err := tx.ExecContext(ctx, `
+		UPDATE Photo
+		SET comment_count=comment_count+?
+		WHERE id=?
+	`, delta, photoId)
+
+	return err
+}
@@ -0,0 +1,110 @@
+package database
+
+import (
+	"context"
+	"strings"
+)
+
+// MaxPlaceLength is the maximum number of characters of the name of a place
+const MaxPlaceLength = 100
+
+// NormalizePlace returns the name of the place as it is stored, without the surrounding spaces and with the inner ones
+// collapsed, and whether it is a valid name (ie. neither empty nor too long).
+func NormalizePlace(place string) (string, bool) {
+	place = strings.Join(strings.Fields(place), " ")
+
+	if place == "" || len([]rune(place)) > MaxPlaceLength {
+		return "", false
+	}
+
+	return place, true
+}
+
+// placeKey returns the key the photos taken in the place are looked up by,
+// so that the names differing only in case refer to the same place
+func placeKey(place string) string {
+	place, _ = NormalizePlace(place)
+
+	return strings.ToLower(place)
+}
+
+func (db *appdbimpl) GetPlacePhotos(ctx context.Context, dbUser DatabaseUser, place string, limit int, before uint32) (DatabasePlaceFeed, error) {
+	dbFeed := DatabasePlaceFeedDefault()
+	dbFeed.Place, _ = NormalizePlace(place)
+
+	// get a page of at most `limit` photos taken in the
+	// place, from the newest to the oldest, keeping only the
+	// photos older than the photo `before` (if it is not 0);
+	// the photos of users who banned the user performing the
+	// action or who are deactivated or shadow banned are not
+	// considered; one more photo is requested to know whether
+	// there is a next page
+	rows, err := db.read().QueryContext(ctx, `
+		SELECT id
+		FROM Photo
+		WHERE place_key=?
+		AND NOT archived
+		AND NOT close_friends
+		AND NOT flagged
+		AND NOT scheduled
+		AND "user" NOT IN (
+			SELECT first_user
+			FROM ban
+			WHERE second_user=?
+		)
+		AND "user" NOT IN (
+			SELECT id
+			FROM "User"
+			WHERE deactivated_at IS NOT NULL
+		)
+		AND `+visiblePhotoOwner+`
+		AND (
+			?=0
+			OR (date, id) < (
+				SELECT date, id
+				FROM Photo
+				WHERE id=?
+			)
+		)
+		ORDER BY date DESC, id DESC
+		LIMIT ?
+	`, placeKey(place), dbUser.Id, dbUser.Id, before, before, limit+1)
+
+	if err != nil {
+		return dbFeed, err
+	}
+
+	// build the feed
+	for rows.Next() {
+		dbPhoto := DatabasePhotoDefault()
+
+		err = rows.Scan(&dbPhoto.Id)
+
+		if err != nil {
+			return dbFeed, err
+		}
+
+		dbPhoto, err = db.GetDatabasePhoto(ctx, dbPhoto.Id, dbUser)
+
+		if err != nil {
+			return dbFeed, err
+		}
+
+		dbFeed.Photos = append(dbFeed.Photos, dbPhoto)
+	}
+
+	if rows.Err() != nil {
+		return dbFeed, err
+	}
+
+	_ = rows.Close()
+
+	// if there is a next page, its cursor
+	// is the last photo of the current one
+	if len(dbFeed.Photos) > limit {
+		dbFeed.Photos = dbFeed.Photos[:limit]
+		dbFeed.NextCursor = dbFeed.Photos[limit-1].Id
+	}
+
+	return dbFeed, err
+}
@@ -0,0 +1,84 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+func (db *appdbimpl) GetReservedNames(ctx context.Context) ([]DatabaseReservedName, error) {
+	dbReservedNames := make([]DatabaseReservedName, 0)
+
+	// get the names reserved by
+	// the administrators, oldest first
+	rows, err := db.c.QueryContext(ctx, `
+		SELECT id, name, contained
+		FROM reserved_name
+		ORDER BY id
+	`)
+
+	if err != nil {
+		return dbReservedNames, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		dbReservedName := DatabaseReservedNameDefault()
+
+		err = rows.Scan(&dbReservedName.Id, &dbReservedName.Name, &dbReservedName.Contained)
+
+		if err != nil {
+			return dbReservedNames, err
+		}
+
+		dbReservedNames = append(dbReservedNames, dbReservedName)
+	}
+
+	return dbReservedNames, rows.Err()
+}
+
+func (db *appdbimpl) InsertReservedName(ctx context.Context, dbReservedName *DatabaseReservedName) error {
+	return db.withTx(ctx, func(tx *dbtx) error {
+		// insert the name and get its id; if it is
+		// already reserved then no row is returned
+		err := tx.QueryRowContext(ctx, `
+			INSERT INTO reserved_name(name, contained)
+			VALUES (?, ?)
+			ON CONFLICT DO NOTHING
+			RETURNING id
+		`, dbReservedName.Name, dbReservedName.Contained).Scan(&dbReservedName.Id)
+
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrReservedNameAlreadyExists
+		}
+
+		if err != nil {
+			return err
+		}
+
+		return insertAuditTx(ctx, tx, AuditAdmin, AuditReserveName, dbReservedName.Id, dbReservedName.Name)
+	})
+}
+
+func (db *appdbimpl) DeleteReservedName(ctx context.Context, nameId uint32) error {
+	return db.withTx(ctx, func(tx *dbtx) error {
+		var name string
+
+		err := tx.QueryRowContext(ctx, `
+			DELETE FROM reserved_name
+			WHERE id=?
+			RETURNING name
+		`, nameId).Scan(&name)
+
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrReservedNameDoesNotExist
+		}
+
+		if err != nil {
+			return err
+		}
+
+		return insertAuditTx(ctx, tx, AuditAdmin, AuditUnreserveName, nameId, name)
+	})
+}
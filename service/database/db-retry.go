@@ -0,0 +1,46 @@
+package database
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+// retryAttempts is how many times a write is attempted
+// before its lock contention error is returned
+const retryAttempts = 5
+
+// retryBackoff is the longest wait before the second attempt
+// of a write, which doubles after every failed attempt
+const retryBackoff = 20 * time.Millisecond
+
+// retry runs the write fn until it succeeds, it fails for a reason other than
+// a transient lock contention (see dialect.isBusy), or it has been attempted
+// retryAttempts times. Between the attempts it waits a random time, up to a
+// bound growing exponentially, so that the writers which collided spread out.
+// fn must be safe to run again after a failure, as a single statement or a
+// whole transaction is.
+func (db *appdbimpl) retry(ctx context.Context, fn func() error) error {
+	backoff := retryBackoff
+
+	for attempt := 1; ; attempt++ {
+		err := fn()
+
+		if err == nil || attempt == retryAttempts || !db.c.d.isBusy(err) {
+			return err
+		}
+
+		// wait between half and the whole backoff
+		wait := backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+		timer := time.NewTimer(wait)
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+
+		backoff *= 2
+	}
+}
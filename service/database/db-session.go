@@ -0,0 +1,234 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+func (db *appdbimpl) GetDatabaseSession(ctx context.Context, tokenHash string) (DatabaseSession, error) {
+	dbSession := DatabaseSessionDefault()
+
+	// get the session of the token together with its user; the
+	// primary is always asked, since a session which was just
+	// created or revoked must be seen right away
+	err := db.c.QueryRowContext(ctx, `
+		SELECT session.id, session.token_hash, session.created_at, session.expires_at, session.last_seen, "User".id, "User".username, "User".version
+		FROM session
+		JOIN "User" ON "User".id=session."user"
+		WHERE session.token_hash=?
+	`, tokenHash).Scan(&dbSession.Id, &dbSession.TokenHash, unixTime{&dbSession.CreatedAt}, unixTime{&dbSession.ExpiresAt}, unixTime{&dbSession.LastSeen}, &dbSession.User.Id, &dbSession.User.Username, &dbSession.User.Version)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return dbSession, ErrSessionDoesNotExist
+	}
+
+	return dbSession, err
+}
+
+func (db *appdbimpl) InsertSession(ctx context.Context, dbSession *DatabaseSession, dbRefreshToken *DatabaseRefreshToken) error {
+	return db.withTx(ctx, func(tx *dbtx) error {
+		// the expired sessions of the user are
+		// removed whenever they log in again
+		_, err := tx.ExecContext(ctx, `
+			DELETE FROM session
+			WHERE "user"=?
+			AND expires_at<=?
+		`, dbSession.User.Id, dbSession.CreatedAt.Unix())
+
+		if err != nil {
+			return err
+		}
+
+		// insert the session into the database and get its id
+		err = tx.QueryRowContext(ctx, `
+			INSERT INTO session(token_hash, "user", created_at, expires_at, last_seen)
+			VALUES (?, ?, ?, ?, ?)
+			RETURNING id
+		`, dbSession.TokenHash, dbSession.User.Id, dbSession.CreatedAt.Unix(), dbSession.ExpiresAt.Unix(), dbSession.LastSeen.Unix()).Scan(&dbSession.Id)
+
+		if err != nil {
+			return err
+		}
+
+		// insert the first refresh token of the session
+		dbRefreshToken.Session = *dbSession
+
+		return tx.QueryRowContext(ctx, `
+			INSERT INTO refresh_token(session, token_hash, created_at, expires_at)
+			VALUES (?, ?, ?, ?)
+			RETURNING id
+		`, dbSession.Id, dbRefreshToken.TokenHash, dbRefreshToken.CreatedAt.Unix(), dbRefreshToken.ExpiresAt.Unix()).Scan(&dbRefreshToken.Id)
+	})
+}
+
+func (db *appdbimpl) TouchSession(ctx context.Context, dbSession DatabaseSession, date time.Time) error {
+	var res sql.Result
+
+	// record when the session was last used
+	err := db.retry(ctx, func() (err error) {
+		res, err = db.c.ExecContext(ctx, `
+			UPDATE session
+			SET last_seen=?
+			WHERE id=?
+		`, date.Unix(), dbSession.Id)
+
+		return err
+	})
+
+	if err != nil {
+		return err
+	}
+
+	aff, err := res.RowsAffected()
+
+	if err != nil {
+		return err
+	}
+
+	// if there are no affected rows then
+	// the session was revoked meanwhile
+	if aff == 0 {
+		return ErrSessionDoesNotExist
+	}
+
+	return nil
+}
+
+func (db *appdbimpl) DeleteSession(ctx context.Context, dbSession DatabaseSession) error {
+	var res sql.Result
+
+	// revoke the session, together with its refresh tokens
+	err := db.retry(ctx, func() (err error) {
+		res, err = db.c.ExecContext(ctx, `
+			DELETE FROM session
+			WHERE id=?
+		`, dbSession.Id)
+
+		return err
+	})
+
+	if err != nil {
+		return err
+	}
+
+	aff, err := res.RowsAffected()
+
+	if err != nil {
+		return err
+	}
+
+	// if there are no affected rows
+	// then the session did not exist
+	if aff == 0 {
+		return ErrSessionDoesNotExist
+	}
+
+	return nil
+}
+
+func (db *appdbimpl) DeleteUserSessions(ctx context.Context, dbUser DatabaseUser) error {
+	// revoke every session of the user, so that
+	// none of their tokens is accepted anymore
+	return db.retry(ctx, func() error {
+		_, err := db.c.ExecContext(ctx, `
+			DELETE FROM session
+			WHERE "user"=?
+		`, dbUser.Id)
+
+		return err
+	})
+}
+
+func (db *appdbimpl) GetDatabaseRefreshToken(ctx context.Context, tokenHash string) (DatabaseRefreshToken, error) {
+	dbRefreshToken := DatabaseRefreshTokenDefault()
+	dbSession := &dbRefreshToken.Session
+
+	// get the refresh token together with its session and its user
+	err := db.c.QueryRowContext(ctx, `
+		SELECT refresh_token.id, refresh_token.token_hash, refresh_token.created_at, refresh_token.expires_at, refresh_token.used,
+			session.id, session.token_hash, session.created_at, session.expires_at, session.last_seen, "User".id, "User".username, "User".version
+		FROM refresh_token
+		JOIN session ON session.id=refresh_token.session
+		JOIN "User" ON "User".id=session."user"
+		WHERE refresh_token.token_hash=?
+	`, tokenHash).Scan(&dbRefreshToken.Id, &dbRefreshToken.TokenHash, unixTime{&dbRefreshToken.CreatedAt}, unixTime{&dbRefreshToken.ExpiresAt}, &dbRefreshToken.Used,
+		&dbSession.Id, &dbSession.TokenHash, unixTime{&dbSession.CreatedAt}, unixTime{&dbSession.ExpiresAt}, unixTime{&dbSession.LastSeen}, &dbSession.User.Id, &dbSession.User.Username, &dbSession.User.Version)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return dbRefreshToken, ErrRefreshTokenDoesNotExist
+	}
+
+	return dbRefreshToken, err
+}
+
+func (db *appdbimpl) RotateRefreshToken(ctx context.Context, dbRefreshToken DatabaseRefreshToken, newDbRefreshToken *DatabaseRefreshToken, accessTokenHash string) error {
+	return db.withTx(ctx, func(tx *dbtx) error {
+		// exchange the refresh token, which can happen only once:
+		// if another request exchanged it first, it was reused
+		res, err := tx.ExecContext(ctx, `
+			UPDATE refresh_token
+			SET used=TRUE
+			WHERE id=?
+			AND NOT used
+		`, dbRefreshToken.Id)
+
+		if err != nil {
+			return err
+		}
+
+		aff, err := res.RowsAffected()
+
+		if err != nil {
+			return err
+		}
+
+		if aff == 0 {
+			return ErrRefreshTokenReused
+		}
+
+		// the session now accepts only the new access
+		// token, and lasts as long as the new refresh token
+		res, err = tx.ExecContext(ctx, `
+			UPDATE session
+			SET token_hash=?, expires_at=?, last_seen=?
+			WHERE id=?
+		`, accessTokenHash, newDbRefreshToken.ExpiresAt.Unix(), newDbRefreshToken.CreatedAt.Unix(), dbRefreshToken.Session.Id)
+
+		if err != nil {
+			return err
+		}
+
+		aff, err = res.RowsAffected()
+
+		if err != nil {
+			return err
+		}
+
+		if aff == 0 {
+			return ErrSessionDoesNotExist
+		}
+
+		// the expired refresh tokens of the session
+		// cannot be reused anymore, hence are removed
+		_, err = tx.ExecContext(ctx, `
+			DELETE FROM refresh_token
+			WHERE session=?
+			AND expires_at<=?
+		`, dbRefreshToken.Session.Id, newDbRefreshToken.CreatedAt.Unix())
+
+		if err != nil {
+			return err
+		}
+
+		// insert the new refresh token of the session
+		newDbRefreshToken.Session = dbRefreshToken.Session
+
+		return tx.QueryRowContext(ctx, `
+			INSERT INTO refresh_token(session, token_hash, created_at, expires_at)
+			VALUES (?, ?, ?, ?)
+			RETURNING id
+		`, dbRefreshToken.Session.Id, newDbRefreshToken.TokenHash, newDbRefreshToken.CreatedAt.Unix(), newDbRefreshToken.ExpiresAt.Unix()).Scan(&newDbRefreshToken.Id)
+	})
+}
@@ -0,0 +1,49 @@
+package database
+
+import (
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// SQLiteConfig holds the settings applied to every connection opened to a SQLite database.
+type SQLiteConfig struct {
+	// JournalMode is the journal mode of the database (e.g., DELETE, WAL)
+	JournalMode string
+
+	// BusyTimeout is how long a connection waits for a lock held by another one before failing
+	BusyTimeout time.Duration
+
+	// Synchronous is how often SQLite flushes to disk (OFF, NORMAL, FULL, EXTRA)
+	Synchronous string
+
+	// QueryOnly prevents every change to the database, as needed by the connections to a read-only replica
+	QueryOnly bool
+}
+
+// DataSourceName returns the data source name to be passed to sql.Open for the SQLite database `filename`. The settings
+// are set as connection parameters, so that the driver applies them to every connection of the pool (a PRAGMA executed
+// on the *sql.DB would only reach one of them). Foreign keys are always enforced.
+func (cfg SQLiteConfig) DataSourceName(filename string) string {
+	params := url.Values{}
+
+	params.Set("_foreign_keys", "on")
+
+	if cfg.JournalMode != "" {
+		params.Set("_journal_mode", cfg.JournalMode)
+	}
+
+	if cfg.BusyTimeout > 0 {
+		params.Set("_busy_timeout", strconv.FormatInt(cfg.BusyTimeout.Milliseconds(), 10))
+	}
+
+	if cfg.Synchronous != "" {
+		params.Set("_synchronous", cfg.Synchronous)
+	}
+
+	if cfg.QueryOnly {
+		params.Set("_query_only", "on")
+	}
+
+	return filename + "?" + params.Encode()
+}
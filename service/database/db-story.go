@@ -0,0 +1,218 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+func (db *appdbimpl) GetDatabaseStory(ctx context.Context, storyId uint32) (DatabaseStory, error) {
+	dbStory := DatabaseStoryDefault()
+
+	err := db.c.QueryRowContext(ctx, `
+		SELECT id, "user", url, date, expires_at
+		FROM story
+		WHERE id=?
+	`, storyId).Scan(&dbStory.Id, &dbStory.User.Id, &dbStory.Url, unixTime{&dbStory.Date}, unixTime{&dbStory.ExpiresAt})
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return dbStory, ErrStoryDoesNotExist
+	}
+
+	if err != nil {
+		return dbStory, err
+	}
+
+	// get the user information
+	dbStory.User, err = db.GetDatabaseUser(ctx, dbStory.User.Id)
+
+	return dbStory, err
+}
+
+func (db *appdbimpl) InsertStory(ctx context.Context, dbStory *DatabaseStory) error {
+	// insert the story into the database
+	// and get the story id
+	return db.retry(ctx, func() error {
+		return db.c.QueryRowContext(ctx, `
+			INSERT INTO story("user", url, date, expires_at)
+			VALUES (?, ?, ?, ?)
+			RETURNING id
+		`, dbStory.User.Id, dbStory.Url, dbStory.Date.Unix(), dbStory.ExpiresAt.Unix()).Scan(&dbStory.Id)
+	})
+}
+
+func (db *appdbimpl) DeleteStory(ctx context.Context, dbStory DatabaseStory) error {
+	var res sql.Result
+
+	// remove the story from the database
+	err := db.retry(ctx, func() (err error) {
+		res, err = db.c.ExecContext(ctx, `
+			DELETE FROM story
+			WHERE id=?
+		`, dbStory.Id)
+
+		return err
+	})
+
+	if err != nil {
+		return err
+	}
+
+	aff, err := res.RowsAffected()
+
+	if err != nil {
+		return err
+	}
+
+	// if there are no affected rows
+	// then the story did not exist
+	if aff == 0 {
+		return ErrStoryDoesNotExist
+	}
+
+	return nil
+}
+
+func (db *appdbimpl) GetStories(ctx context.Context, storyDbUser DatabaseUser, now time.Time) (DatabaseStoryList, error) {
+	dbStoryList := DatabaseStoryListDefault()
+
+	// get the stories of the user which have not expired
+	// yet, from the oldest to the newest, as they are
+	// meant to be watched in the order they were posted
+	rows, err := db.read().QueryContext(ctx, `
+		SELECT id, url, date, expires_at
+		FROM story
+		WHERE "user"=?
+		AND expires_at > ?
+		ORDER BY date, id
+	`, storyDbUser.Id, now.Unix())
+
+	if err != nil {
+		return dbStoryList, err
+	}
+
+	// build the story list
+	for rows.Next() {
+		dbStory := DatabaseStoryDefault()
+		dbStory.User = storyDbUser
+
+		err = rows.Scan(&dbStory.Id, &dbStory.Url, unixTime{&dbStory.Date}, unixTime{&dbStory.ExpiresAt})
+
+		if err != nil {
+			return dbStoryList, err
+		}
+
+		dbStoryList.Stories = append(dbStoryList.Stories, dbStory)
+	}
+
+	if rows.Err() != nil {
+		return dbStoryList, err
+	}
+
+	_ = rows.Close()
+
+	return dbStoryList, err
+}
+
+func (db *appdbimpl) GetStoryTray(ctx context.Context, dbUser DatabaseUser, now time.Time) (DatabaseStoryTray, error) {
+	dbStoryTray := DatabaseStoryTrayDefault()
+
+	// get the users followed by the user who have stories
+	// which have not expired yet, with the number of those
+	// stories, from the user who posted most recently; the
+	// users who banned the user or who are deactivated or
+	// shadow banned are not considered
+	rows, err := db.read().QueryContext(ctx, `
+		SELECT "user", COUNT(*), MAX(date)
+		FROM story
+		WHERE expires_at > ?
+		AND "user" IN (
+			SELECT second_user
+			FROM follow
+			WHERE first_user=?
+			  AND second_user NOT IN (
+				SELECT first_user
+				FROM ban
+				WHERE second_user=?
+			)
+			AND second_user NOT IN (
+				SELECT id
+				FROM "User"
+				WHERE deactivated_at IS NOT NULL
+				OR shadow_banned
+			)
+		)
+		GROUP BY "user"
+		ORDER BY MAX(date) DESC, "user"
+	`, now.Unix(), dbUser.Id, dbUser.Id)
+
+	if err != nil {
+		return dbStoryTray, err
+	}
+
+	// build the story tray
+	for rows.Next() {
+		var entry DatabaseStoryTrayEntry
+
+		err = rows.Scan(&entry.User.Id, &entry.StoryCount, unixTime{&entry.LatestDate})
+
+		if err != nil {
+			return dbStoryTray, err
+		}
+
+		entry.User, err = db.GetDatabaseUser(ctx, entry.User.Id)
+
+		if err != nil {
+			return dbStoryTray, err
+		}
+
+		dbStoryTray.Users = append(dbStoryTray.Users, entry)
+	}
+
+	if rows.Err() != nil {
+		return dbStoryTray, err
+	}
+
+	_ = rows.Close()
+
+	return dbStoryTray, err
+}
+
+func (db *appdbimpl) DeleteExpiredStories(ctx context.Context, now time.Time) ([]DatabaseStory, error) {
+	var dbStories []DatabaseStory
+
+	// remove the stories which have expired, returning
+	// them so that their files can be removed as well
+	err := db.retry(ctx, func() error {
+		dbStories = make([]DatabaseStory, 0)
+
+		rows, err := db.c.QueryContext(ctx, `
+			DELETE FROM story
+			WHERE expires_at <= ?
+			RETURNING id, "user", url
+		`, now.Unix())
+
+		if err != nil {
+			return err
+		}
+
+		defer rows.Close()
+
+		for rows.Next() {
+			dbStory := DatabaseStoryDefault()
+
+			err = rows.Scan(&dbStory.Id, &dbStory.User.Id, &dbStory.Url)
+
+			if err != nil {
+				return err
+			}
+
+			dbStories = append(dbStories, dbStory)
+		}
+
+		return rows.Err()
+	})
+
+	return dbStories, err
+}
@@ -1,29 +1,112 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"errors"
+	"time"
 )
 
-func (db *appdbimpl) GetDatabaseStream(dbUser DatabaseUser) (DatabaseStream, error) {
+// streamAuthor keeps the photos of the users followed by the user performing the action, leaving out the ones who
+// banned them, the ones they muted and the deactivated ones. It takes the id of the user performing the action three
+// times.
+const streamAuthor = `"user" IN (
+	SELECT second_user
+	FROM follow
+	WHERE first_user=?
+	AND second_user NOT IN (
+		SELECT first_user
+		FROM ban
+		WHERE second_user=?
+	)
+	AND second_user NOT IN (
+		SELECT second_user
+		FROM mute
+		WHERE first_user=?
+	)
+	AND second_user NOT IN (
+		SELECT id
+		FROM "User"
+		WHERE deactivated_at IS NOT NULL
+	)
+)`
+
+func (db *appdbimpl) GetDatabaseStream(ctx context.Context, dbUser DatabaseUser, filter DatabaseStreamFilter, limit int, before uint32, after uint32) (DatabaseStream, error) {
 	dbStream := DatabaseStreamDefault()
 
-	// get the user's stream table
-	rows, err := db.c.Query(`
-		SELECT id, user, url, date
+	var since, until int64
+
+	if !filter.Since.IsZero() {
+		since = filter.Since.Unix()
+	}
+
+	if !filter.Until.IsZero() {
+		until = filter.Until.Unix()
+	}
+
+	unseen := 0
+
+	if filter.Unseen {
+		unseen = 1
+	}
+
+	args := []interface{}{dbUser.Id, dbUser.Id, dbUser.Id, dbUser.Id, dbUser.Id, dbUser.Id, before, before, after, after, since, since, until, until, unseen, dbUser.Id}
+
+	// keep the photos of the given authors only, if any
+	var authors string
+
+	if len(filter.Authors) > 0 {
+		authors = `AND "user" IN (` + placeholders(len(filter.Authors)) + `)`
+
+		for _, author := range filter.Authors {
+			args = append(args, author)
+		}
+	}
+
+	// get a page of at most `limit` photos of the user's
+	// stream, leaving out the users they muted and keeping
+	// only the photos older than the photo
+	// `before` and newer than the photo `after` (each
+	// cursor is ignored if it is 0), posted from `since`
+	// to `until` (each ignored if it is 0) and, if
+	// `unseen`, after the user last saw their stream
+	rows, err := db.read().QueryContext(ctx, `
+		SELECT id, "user", url, date, latitude, longitude, COALESCE(place, ''), pinned_at IS NOT NULL, media_type, poster_url, duration, alt_text
 		FROM Photo
-		WHERE user IN (
-			SELECT second_user
-			FROM follow
-			WHERE first_user=?
-			  AND second_user NOT IN (
-				SELECT first_user
-				FROM ban
-				WHERE second_user=?
+		WHERE NOT archived
+		AND NOT scheduled
+		AND `+visiblePhoto+`
+		AND `+streamAuthor+`
+		AND (
+			?=0
+			OR (date, id) < (
+				SELECT date, id
+				FROM Photo
+				WHERE id=?
+			)
+		)
+		AND (
+			?=0
+			OR (date, id) > (
+				SELECT date, id
+				FROM Photo
+				WHERE id=?
 			)
 		)
-		ORDER BY date DESC
-	`, dbUser.Id, dbUser.Id)
+		AND (?=0 OR date >= ?)
+		AND (?=0 OR date < ?)
+		AND (
+			?=0
+			OR date > COALESCE((
+				SELECT stream_seen_at
+				FROM "User"
+				WHERE id=?
+			), 0)
+		)
+		`+authors+`
+		ORDER BY date DESC, id DESC
+		LIMIT ?
+	`, append(args, limit)...)
 
 	if errors.Is(err, sql.ErrNoRows) {
 		return dbStream, ErrUserDoesNotExist
@@ -33,41 +116,24 @@ func (db *appdbimpl) GetDatabaseStream(dbUser DatabaseUser) (DatabaseStream, err
 		return dbStream, err
 	}
 
-	dbPhotoUser := DatabaseUserDefault()
-
 	// build the user's stream
 	for rows.Next() {
 		dbPhoto := DatabasePhotoDefault()
 
-		err = rows.Scan(&dbPhoto.Id, &dbPhoto.User.Id, &dbPhoto.Url, &dbPhoto.Date)
-
-		if err != nil {
-			return dbStream, err
-		}
-
-		if dbPhotoUser.Id == 0 {
-			dbPhotoUser, err = db.GetDatabaseUser(dbPhoto.User.Id)
-
-			if err != nil {
-				return dbStream, err
-			}
-		}
-
-		dbPhoto.User = dbPhotoUser
-
-		err = db.GetPhotoLikeCount(&dbPhoto, dbUser)
+		err = rows.Scan(&dbPhoto.Id, &dbPhoto.User.Id, &dbPhoto.Url, unixTime{&dbPhoto.Date}, &dbPhoto.Latitude, &dbPhoto.Longitude, &dbPhoto.Place, &dbPhoto.Pinned, &dbPhoto.MediaType, &dbPhoto.PosterUrl, milliseconds{&dbPhoto.Duration}, &dbPhoto.AltText)
 
 		if err != nil {
 			return dbStream, err
 		}
 
-		err = db.GetPhotoCommentCount(&dbPhoto, dbUser)
+		// the photos of the stream belong to different users
+		dbPhoto.User, err = db.GetDatabaseUser(ctx, dbPhoto.User.Id)
 
 		if err != nil {
 			return dbStream, err
 		}
 
-		err = db.GetPhotoLikeStatus(&dbPhoto, dbUser)
+		err = db.GetPhotoStats(ctx, &dbPhoto, dbUser)
 
 		if err != nil {
 			return dbStream, err
@@ -84,3 +150,49 @@ func (db *appdbimpl) GetDatabaseStream(dbUser DatabaseUser) (DatabaseStream, err
 
 	return dbStream, err
 }
+
+func (db *appdbimpl) SetStreamSeen(ctx context.Context, dbUser DatabaseUser, date time.Time) error {
+	// record when the user last saw their stream
+	_, err := db.c.ExecContext(ctx, `
+		UPDATE "User"
+		SET stream_seen_at=?
+		WHERE id=?
+	`, date.Unix(), dbUser.Id)
+
+	return err
+}
+
+func (db *appdbimpl) GetStreamUpdates(ctx context.Context, dbUser DatabaseUser, since uint32) (DatabaseStreamUpdates, error) {
+	dbUpdates := DatabaseStreamUpdatesDefault()
+
+	// the photos of the user's stream newer than the photo
+	// `since` (all of them if it is 0)
+	where := `
+		FROM Photo
+		WHERE NOT archived
+		AND NOT scheduled
+		AND ` + visiblePhoto + `
+		AND ` + streamAuthor + `
+		AND (
+			?=0
+			OR (date, id) > (
+				SELECT date, id
+				FROM Photo
+				WHERE id=?
+			)
+		)
+	`
+
+	args := []interface{}{dbUser.Id, dbUser.Id, dbUser.Id, dbUser.Id, dbUser.Id, dbUser.Id, since, since}
+
+	err := db.read().QueryRowContext(ctx, `SELECT COUNT(*) `+where, args...).Scan(&dbUpdates.Count)
+
+	if err != nil || dbUpdates.Count == 0 {
+		return dbUpdates, err
+	}
+
+	// get the newest of them
+	err = db.read().QueryRowContext(ctx, `SELECT id `+where+` ORDER BY date DESC, id DESC LIMIT 1`, args...).Scan(&dbUpdates.NewestId)
+
+	return dbUpdates, err
+}
@@ -1,5 +1,9 @@
 package database
 
+import (
+	"time"
+)
+
 type DatabaseLogin struct {
 	Username string `json:"username"`
 }
@@ -11,25 +15,84 @@ func DatabaseLoginDefault() DatabaseLogin {
 }
 
 type DatabaseUser struct {
-	Id       uint32 `json:"id"`
-	Username string `json:"username"`
+	Id          uint32 `json:"id"`
+	Username    string `json:"username"`
+	DisplayName string `json:"display_name"`
+	Bio         string `json:"bio"`
+	Website     string `json:"website"`
+	Avatar      string `json:"avatar"`
+	Version     uint32 `json:"version"`
 }
 
 func DatabaseUserDefault() DatabaseUser {
 	return DatabaseUser{
-		Id:       0,
-		Username: "",
+		Id:          0,
+		Username:    "",
+		DisplayName: "",
+		Bio:         "",
+		Website:     "",
+		Avatar:      "",
+		Version:     0,
+	}
+}
+
+type DatabaseSettings struct {
+	StripLocation bool `json:"strip_location"`
+	// Email is the email address of the user, empty if unset
+	Email string `json:"email"`
+	// EmailVerified is whether the user followed the verification link sent to Email
+	EmailVerified bool `json:"email_verified"`
+	// Private is whether only the followers approved by the user see their photos
+	Private bool `json:"private"`
+	// CommentPolicy and MentionPolicy are the Policies telling who can comment the photos of the user and mention them
+	CommentPolicy string `json:"comment_policy"`
+	MentionPolicy string `json:"mention_policy"`
+	// HideLikeCounts is whether the like counts of the photos of the user are hidden to the others
+	HideLikeCounts bool `json:"hide_like_counts"`
+}
+
+func DatabaseSettingsDefault() DatabaseSettings {
+	return DatabaseSettings{
+		StripLocation:  false,
+		Email:          "",
+		EmailVerified:  false,
+		Private:        false,
+		CommentPolicy:  PolicyEveryone,
+		MentionPolicy:  PolicyEveryone,
+		HideLikeCounts: false,
 	}
 }
 
 type DatabasePhoto struct {
-	Id           uint32       `json:"id"`
-	User         DatabaseUser `json:"user"`
-	Url          string       `json:"url"`
-	Date         string       `json:"date"`
-	LikeCount    int          `json:"like_count"`
-	CommentCount int          `json:"comment_count"`
-	LikeStatus   bool         `json:"like_status"`
+	Id           uint32         `json:"id"`
+	User         DatabaseUser   `json:"user"`
+	Url          string         `json:"url"`
+	Date         time.Time      `json:"date"`
+	LikeCount    int            `json:"like_count"`
+	CommentCount int            `json:"comment_count"`
+	LikeStatus   bool           `json:"like_status"`
+	Reaction     string         `json:"reaction"`
+	Reactions    map[string]int `json:"reactions"`
+	Archived     bool           `json:"archived"`
+	Hash         *uint64        `json:"hash"`
+	Latitude     *float64       `json:"latitude"`
+	Longitude    *float64       `json:"longitude"`
+	Place        string         `json:"place"`
+	Pinned       bool           `json:"pinned"`
+	CloseFriends bool           `json:"close_friends"`
+	Flagged      bool           `json:"flagged"`
+	// Scheduled is whether the photo is only visible to its owner until its date, when it is published
+	Scheduled bool `json:"scheduled"`
+	// LikesHidden is whether the owner of the photo hid its like count and its reactions to the user
+	LikesHidden bool `json:"likes_hidden"`
+	// MediaType is MediaImage or MediaVideo; PosterUrl and Duration are only set for the videos
+	MediaType string        `json:"media_type"`
+	PosterUrl string        `json:"poster_url"`
+	Duration  time.Duration `json:"duration"`
+	// OriginalUrl is the url of the original image of an edited photo, only given to its owner
+	OriginalUrl string `json:"original_url"`
+	// AltText describes the photo to the users who cannot see it, empty if it is not given
+	AltText string `json:"alt_text"`
 }
 
 func DatabasePhotoDefault() DatabasePhoto {
@@ -37,10 +100,27 @@ func DatabasePhotoDefault() DatabasePhoto {
 		Id:           0,
 		User:         DatabaseUserDefault(),
 		Url:          "",
-		Date:         "",
+		Date:         time.Time{},
 		LikeCount:    0,
 		CommentCount: 0,
 		LikeStatus:   false,
+		Reaction:     "",
+		Reactions:    make(map[string]int),
+		Archived:     false,
+		Hash:         nil,
+		Latitude:     nil,
+		Longitude:    nil,
+		Place:        "",
+		Pinned:       false,
+		CloseFriends: false,
+		Flagged:      false,
+		Scheduled:    false,
+		LikesHidden:  false,
+		MediaType:    MediaImage,
+		PosterUrl:    "",
+		Duration:     0,
+		OriginalUrl:  "",
+		AltText:      "",
 	}
 }
 
@@ -48,7 +128,7 @@ type DatabaseComment struct {
 	Id          uint32        `json:"id"`
 	User        DatabaseUser  `json:"user"`
 	Photo       DatabasePhoto `json:"photo"`
-	Date        string        `json:"date"`
+	Date        time.Time     `json:"date"`
 	CommentBody string        `json:"comment_body"`
 }
 
@@ -57,11 +137,27 @@ func DatabaseCommentDefault() DatabaseComment {
 		Id:          0,
 		User:        DatabaseUserDefault(),
 		Photo:       DatabasePhotoDefault(),
-		Date:        "",
+		Date:        time.Time{},
 		CommentBody: "",
 	}
 }
 
+type DatabaseCommentActivity struct {
+	Duplicates    int       `json:"duplicates"`
+	LastDuplicate time.Time `json:"last_duplicate"`
+	Recent        int       `json:"recent"`
+	FirstRecent   time.Time `json:"first_recent"`
+}
+
+func DatabaseCommentActivityDefault() DatabaseCommentActivity {
+	return DatabaseCommentActivity{
+		Duplicates:    0,
+		LastDuplicate: time.Time{},
+		Recent:        0,
+		FirstRecent:   time.Time{},
+	}
+}
+
 type DatabaseProfile struct {
 	User           DatabaseUser    `json:"user"`
 	Photos         []DatabasePhoto `json:"photos"`
@@ -70,6 +166,11 @@ type DatabaseProfile struct {
 	FollowingCount int             `json:"following_count"`
 	FollowStatus   bool            `json:"follow_status"`
 	BanStatus      bool            `json:"ban_status"`
+	MuteStatus     bool            `json:"mute_status"`
+	CloseFriend    bool            `json:"close_friend_status"`
+	Private        bool            `json:"private"`
+	FollowRequest  bool            `json:"follow_requested"`
+	NextCursor     uint32          `json:"next_cursor"`
 }
 
 func DatabaseProfileDefault() DatabaseProfile {
@@ -83,6 +184,11 @@ func DatabaseProfileDefault() DatabaseProfile {
 		FollowingCount: 0,
 		FollowStatus:   false,
 		BanStatus:      false,
+		MuteStatus:     false,
+		CloseFriend:    false,
+		Private:        false,
+		FollowRequest:  false,
+		NextCursor:     0,
 	}
 }
 
@@ -100,6 +206,108 @@ func DatabaseStreamDefault() DatabaseStream {
 	}
 }
 
+// DatabaseStreamFilter narrows the stream down to the photos posted from Since (included) to Until (excluded), the
+// ones the user did not see yet if Unseen, and the ones of the Authors only; the zero values filter nothing
+type DatabaseStreamFilter struct {
+	Since   time.Time `json:"since"`
+	Until   time.Time `json:"until"`
+	Unseen  bool      `json:"unseen"`
+	Authors []uint32  `json:"authors"`
+}
+
+func DatabaseStreamFilterDefault() DatabaseStreamFilter {
+	return DatabaseStreamFilter{
+		Since:   time.Time{},
+		Until:   time.Time{},
+		Unseen:  false,
+		Authors: nil,
+	}
+}
+
+// DatabaseStreamUpdates is the number of the photos of a stream newer than a cursor, and the id of the newest one (0 if
+// there are none)
+type DatabaseStreamUpdates struct {
+	Count    int    `json:"count"`
+	NewestId uint32 `json:"newest_id"`
+}
+
+func DatabaseStreamUpdatesDefault() DatabaseStreamUpdates {
+	return DatabaseStreamUpdates{
+		Count:    0,
+		NewestId: 0,
+	}
+}
+
+type DatabaseHashtagFeed struct {
+	Hashtag    string          `json:"hashtag"`
+	Photos     []DatabasePhoto `json:"photos"`
+	NextCursor uint32          `json:"next_cursor"`
+}
+
+func DatabaseHashtagFeedDefault() DatabaseHashtagFeed {
+	emptyArray := make([]DatabasePhoto, 0)
+
+	return DatabaseHashtagFeed{
+		Hashtag:    "",
+		Photos:     emptyArray,
+		NextCursor: 0,
+	}
+}
+
+type DatabasePlaceFeed struct {
+	Place      string          `json:"place"`
+	Photos     []DatabasePhoto `json:"photos"`
+	NextCursor uint32          `json:"next_cursor"`
+}
+
+func DatabasePlaceFeedDefault() DatabasePlaceFeed {
+	emptyArray := make([]DatabasePhoto, 0)
+
+	return DatabasePlaceFeed{
+		Place:      "",
+		Photos:     emptyArray,
+		NextCursor: 0,
+	}
+}
+
+type DatabaseExploreFeed struct {
+	Photos     []DatabasePhoto `json:"photos"`
+	NextOffset int             `json:"next_offset"`
+}
+
+func DatabaseExploreFeedDefault() DatabaseExploreFeed {
+	emptyArray := make([]DatabasePhoto, 0)
+
+	return DatabaseExploreFeed{
+		Photos:     emptyArray,
+		NextOffset: 0,
+	}
+}
+
+type DatabaseHashtagCount struct {
+	Hashtag string `json:"hashtag"`
+	Count   int    `json:"count"`
+}
+
+func DatabaseHashtagCountDefault() DatabaseHashtagCount {
+	return DatabaseHashtagCount{
+		Hashtag: "",
+		Count:   0,
+	}
+}
+
+type DatabaseTrending struct {
+	Photos   []DatabasePhoto        `json:"photos"`
+	Hashtags []DatabaseHashtagCount `json:"hashtags"`
+}
+
+func DatabaseTrendingDefault() DatabaseTrending {
+	return DatabaseTrending{
+		Photos:   make([]DatabasePhoto, 0),
+		Hashtags: make([]DatabaseHashtagCount, 0),
+	}
+}
+
 type DatabaseUserList struct {
 	Users []DatabaseUser `json:"users"`
 }
@@ -112,6 +320,32 @@ func DatabaseUserListDefault() DatabaseUserList {
 	}
 }
 
+type DatabaseBan struct {
+	User      DatabaseUser `json:"user"`
+	Reason    string       `json:"reason"`
+	ExpiresAt *time.Time   `json:"expires_at"`
+}
+
+func DatabaseBanDefault() DatabaseBan {
+	return DatabaseBan{
+		User:      DatabaseUserDefault(),
+		Reason:    "",
+		ExpiresAt: nil,
+	}
+}
+
+type DatabaseBanList struct {
+	Bans []DatabaseBan `json:"bans"`
+}
+
+func DatabaseBanListDefault() DatabaseBanList {
+	emptyArray := make([]DatabaseBan, 0)
+
+	return DatabaseBanList{
+		Bans: emptyArray,
+	}
+}
+
 type DatabaseCommentList struct {
 	Comments []DatabaseComment `json:"comments"`
 }
@@ -123,3 +357,636 @@ func DatabaseCommentListDefault() DatabaseCommentList {
 		Comments: emptyArray,
 	}
 }
+
+type DatabaseAuditEntry struct {
+	Id      uint32    `json:"id"`
+	Actor   uint32    `json:"actor"`
+	Action  string    `json:"action"`
+	Target  uint32    `json:"target"`
+	Details string    `json:"details"`
+	Date    time.Time `json:"date"`
+}
+
+func DatabaseAuditEntryDefault() DatabaseAuditEntry {
+	return DatabaseAuditEntry{
+		Id:      0,
+		Actor:   0,
+		Action:  "",
+		Target:  0,
+		Details: "",
+		Date:    time.Time{},
+	}
+}
+
+type DatabaseAuditLog struct {
+	Entries []DatabaseAuditEntry `json:"entries"`
+}
+
+func DatabaseAuditLogDefault() DatabaseAuditLog {
+	emptyArray := make([]DatabaseAuditEntry, 0)
+
+	return DatabaseAuditLog{
+		Entries: emptyArray,
+	}
+}
+
+type DatabaseAdminUser struct {
+	User          DatabaseUser `json:"user"`
+	Email         string       `json:"email"`
+	EmailVerified bool         `json:"email_verified"`
+	DeactivatedAt *time.Time   `json:"deactivated_at"`
+	SuspendedAt   *time.Time   `json:"suspended_at"`
+	ShadowBanned  bool         `json:"shadow_banned"`
+}
+
+func DatabaseAdminUserDefault() DatabaseAdminUser {
+	return DatabaseAdminUser{
+		User:          DatabaseUserDefault(),
+		Email:         "",
+		EmailVerified: false,
+		DeactivatedAt: nil,
+		SuspendedAt:   nil,
+		ShadowBanned:  false,
+	}
+}
+
+type DatabaseAdminUserList struct {
+	Users      []DatabaseAdminUser `json:"users"`
+	NextCursor uint32              `json:"next_cursor"`
+}
+
+func DatabaseAdminUserListDefault() DatabaseAdminUserList {
+	emptyArray := make([]DatabaseAdminUser, 0)
+
+	return DatabaseAdminUserList{
+		Users:      emptyArray,
+		NextCursor: 0,
+	}
+}
+
+type DatabaseFlaggedPhotoList struct {
+	Photos     []DatabasePhoto `json:"photos"`
+	NextCursor uint32          `json:"next_cursor"`
+}
+
+func DatabaseFlaggedPhotoListDefault() DatabaseFlaggedPhotoList {
+	emptyArray := make([]DatabasePhoto, 0)
+
+	return DatabaseFlaggedPhotoList{
+		Photos:     emptyArray,
+		NextCursor: 0,
+	}
+}
+
+type DatabaseErasure struct {
+	Id          uint32     `json:"id"`
+	User        uint32     `json:"user"`
+	RequestedAt time.Time  `json:"requested_at"`
+	CompletedAt *time.Time `json:"completed_at"`
+}
+
+func DatabaseErasureDefault() DatabaseErasure {
+	return DatabaseErasure{
+		Id:          0,
+		User:        0,
+		RequestedAt: time.Time{},
+		CompletedAt: nil,
+	}
+}
+
+type DatabaseErasureList struct {
+	Erasures   []DatabaseErasure `json:"erasures"`
+	NextCursor uint32            `json:"next_cursor"`
+}
+
+func DatabaseErasureListDefault() DatabaseErasureList {
+	emptyArray := make([]DatabaseErasure, 0)
+
+	return DatabaseErasureList{
+		Erasures:   emptyArray,
+		NextCursor: 0,
+	}
+}
+
+type DatabaseWebhook struct {
+	Id     uint32    `json:"id"`
+	Url    string    `json:"url"`
+	Secret string    `json:"secret"`
+	Events []string  `json:"events"`
+	Date   time.Time `json:"date"`
+}
+
+func DatabaseWebhookDefault() DatabaseWebhook {
+	return DatabaseWebhook{
+		Id:     0,
+		Url:    "",
+		Secret: "",
+		Events: make([]string, 0),
+		Date:   time.Time{},
+	}
+}
+
+// DatabaseWebhookEvent is an event to be delivered to the webhooks subscribed to it
+type DatabaseWebhookEvent struct {
+	Event string `json:"event"`
+	// Actor is the user who caused the event, whose events are not delivered if they are shadow banned
+	Actor   uint32    `json:"actor"`
+	Payload string    `json:"payload"`
+	Date    time.Time `json:"date"`
+}
+
+func DatabaseWebhookEventDefault() DatabaseWebhookEvent {
+	return DatabaseWebhookEvent{
+		Event:   "",
+		Actor:   0,
+		Payload: "",
+		Date:    time.Time{},
+	}
+}
+
+type DatabaseWebhookDelivery struct {
+	Id       uint32    `json:"id"`
+	Webhook  uint32    `json:"webhook"`
+	Event    string    `json:"event"`
+	Payload  string    `json:"payload"`
+	Date     time.Time `json:"date"`
+	Attempts int       `json:"attempts"`
+	// NextAttemptAt is nil once the delivery succeeded or was given up
+	NextAttemptAt *time.Time `json:"next_attempt_at"`
+	// DeliveredAt is nil until the receiver accepts the delivery
+	DeliveredAt *time.Time `json:"delivered_at"`
+	// StatusCode and Error tell the outcome of the last attempt, 0 and empty if there was none
+	StatusCode int    `json:"status_code"`
+	Error      string `json:"error"`
+}
+
+func DatabaseWebhookDeliveryDefault() DatabaseWebhookDelivery {
+	return DatabaseWebhookDelivery{
+		Id:            0,
+		Webhook:       0,
+		Event:         "",
+		Payload:       "",
+		Date:          time.Time{},
+		Attempts:      0,
+		NextAttemptAt: nil,
+		DeliveredAt:   nil,
+		StatusCode:    0,
+		Error:         "",
+	}
+}
+
+type DatabaseWebhookDeliveryList struct {
+	Deliveries []DatabaseWebhookDelivery `json:"deliveries"`
+}
+
+func DatabaseWebhookDeliveryListDefault() DatabaseWebhookDeliveryList {
+	emptyArray := make([]DatabaseWebhookDelivery, 0)
+
+	return DatabaseWebhookDeliveryList{
+		Deliveries: emptyArray,
+	}
+}
+
+type DatabaseBlockedTerm struct {
+	Id      uint32 `json:"id"`
+	Term    string `json:"term"`
+	Pattern bool   `json:"pattern"`
+}
+
+func DatabaseBlockedTermDefault() DatabaseBlockedTerm {
+	return DatabaseBlockedTerm{
+		Id:      0,
+		Term:    "",
+		Pattern: false,
+	}
+}
+
+type DatabaseReservedName struct {
+	Id        uint32 `json:"id"`
+	Name      string `json:"name"`
+	Contained bool   `json:"contained"`
+}
+
+func DatabaseReservedNameDefault() DatabaseReservedName {
+	return DatabaseReservedName{
+		Id:        0,
+		Name:      "",
+		Contained: false,
+	}
+}
+
+type DatabaseHeldComment struct {
+	Id          uint32        `json:"id"`
+	User        DatabaseUser  `json:"user"`
+	Photo       DatabasePhoto `json:"photo"`
+	Date        time.Time     `json:"date"`
+	CommentBody string        `json:"comment_body"`
+	Term        string        `json:"term"`
+}
+
+func DatabaseHeldCommentDefault() DatabaseHeldComment {
+	return DatabaseHeldComment{
+		Id:          0,
+		User:        DatabaseUserDefault(),
+		Photo:       DatabasePhotoDefault(),
+		Date:        time.Time{},
+		CommentBody: "",
+		Term:        "",
+	}
+}
+
+type DatabaseHeldCommentList struct {
+	Comments   []DatabaseHeldComment `json:"comments"`
+	NextCursor uint32                `json:"next_cursor"`
+}
+
+func DatabaseHeldCommentListDefault() DatabaseHeldCommentList {
+	emptyArray := make([]DatabaseHeldComment, 0)
+
+	return DatabaseHeldCommentList{
+		Comments:   emptyArray,
+		NextCursor: 0,
+	}
+}
+
+type DatabaseLikeList struct {
+	Users []DatabaseUser `json:"users"`
+	Total int            `json:"total"`
+}
+
+func DatabaseLikeListDefault() DatabaseLikeList {
+	emptyArray := make([]DatabaseUser, 0)
+
+	return DatabaseLikeList{
+		Users: emptyArray,
+		Total: 0,
+	}
+}
+
+type DatabaseReaction struct {
+	User DatabaseUser `json:"user"`
+	Type string       `json:"type"`
+}
+
+type DatabaseReactionList struct {
+	Reactions []DatabaseReaction `json:"reactions"`
+	Total     int                `json:"total"`
+}
+
+func DatabaseReactionListDefault() DatabaseReactionList {
+	emptyArray := make([]DatabaseReaction, 0)
+
+	return DatabaseReactionList{
+		Reactions: emptyArray,
+		Total:     0,
+	}
+}
+
+type DatabaseAlbum struct {
+	Id         uint32          `json:"id"`
+	User       DatabaseUser    `json:"user"`
+	Name       string          `json:"name"`
+	Date       time.Time       `json:"date"`
+	Photos     []DatabasePhoto `json:"photos"`
+	PhotoCount int             `json:"photo_count"`
+	CoverUrl   string          `json:"cover_url"`
+}
+
+func DatabaseAlbumDefault() DatabaseAlbum {
+	emptyArray := make([]DatabasePhoto, 0)
+
+	return DatabaseAlbum{
+		Id:         0,
+		User:       DatabaseUserDefault(),
+		Name:       "",
+		Date:       time.Time{},
+		Photos:     emptyArray,
+		PhotoCount: 0,
+		CoverUrl:   "",
+	}
+}
+
+type DatabaseAlbumList struct {
+	Albums []DatabaseAlbum `json:"albums"`
+}
+
+func DatabaseAlbumListDefault() DatabaseAlbumList {
+	emptyArray := make([]DatabaseAlbum, 0)
+
+	return DatabaseAlbumList{
+		Albums: emptyArray,
+	}
+}
+
+type DatabaseStory struct {
+	Id        uint32       `json:"id"`
+	User      DatabaseUser `json:"user"`
+	Url       string       `json:"url"`
+	Date      time.Time    `json:"date"`
+	ExpiresAt time.Time    `json:"expires_at"`
+}
+
+func DatabaseStoryDefault() DatabaseStory {
+	return DatabaseStory{
+		Id:        0,
+		User:      DatabaseUserDefault(),
+		Url:       "",
+		Date:      time.Time{},
+		ExpiresAt: time.Time{},
+	}
+}
+
+type DatabaseStoryList struct {
+	Stories []DatabaseStory `json:"stories"`
+}
+
+func DatabaseStoryListDefault() DatabaseStoryList {
+	emptyArray := make([]DatabaseStory, 0)
+
+	return DatabaseStoryList{
+		Stories: emptyArray,
+	}
+}
+
+// DatabaseStoryTrayEntry is a user having unexpired stories, as shown in the story tray
+type DatabaseStoryTrayEntry struct {
+	User       DatabaseUser `json:"user"`
+	StoryCount int          `json:"story_count"`
+	LatestDate time.Time    `json:"latest_date"`
+}
+
+type DatabaseStoryTray struct {
+	Users []DatabaseStoryTrayEntry `json:"users"`
+}
+
+func DatabaseStoryTrayDefault() DatabaseStoryTray {
+	emptyArray := make([]DatabaseStoryTrayEntry, 0)
+
+	return DatabaseStoryTray{
+		Users: emptyArray,
+	}
+}
+
+type DatabaseNotification struct {
+	Id    uint32       `json:"id"`
+	User  DatabaseUser `json:"user"`
+	Actor DatabaseUser `json:"actor"`
+	Type  string       `json:"type"`
+	// Photo is the liked photo, only set for the likes
+	Photo *DatabasePhoto `json:"photo"`
+	// Comment is the comment, only set for the comments and the mentions
+	Comment *DatabaseComment `json:"comment"`
+	Date    time.Time        `json:"date"`
+	Read    bool             `json:"read"`
+}
+
+func DatabaseNotificationDefault() DatabaseNotification {
+	return DatabaseNotification{
+		Id:      0,
+		User:    DatabaseUserDefault(),
+		Actor:   DatabaseUserDefault(),
+		Type:    "",
+		Photo:   nil,
+		Comment: nil,
+		Date:    time.Time{},
+		Read:    false,
+	}
+}
+
+// DatabaseNotificationPreference tells on which channels a user receives the notifications of a type
+type DatabaseNotificationPreference struct {
+	InApp bool `json:"in_app"`
+	Push  bool `json:"push"`
+	Email bool `json:"email"`
+}
+
+func DatabaseNotificationPreferenceDefault() DatabaseNotificationPreference {
+	return DatabaseNotificationPreference{
+		InApp: true,
+		Push:  true,
+		Email: true,
+	}
+}
+
+type DatabaseNotificationList struct {
+	Notifications []DatabaseNotification `json:"notifications"`
+	UnreadCount   int                    `json:"unread_count"`
+	NextCursor    uint32                 `json:"next_cursor"`
+}
+
+func DatabaseNotificationListDefault() DatabaseNotificationList {
+	emptyArray := make([]DatabaseNotification, 0)
+
+	return DatabaseNotificationList{
+		Notifications: emptyArray,
+		UnreadCount:   0,
+		NextCursor:    0,
+	}
+}
+
+type DatabaseDevice struct {
+	Id       uint32       `json:"id"`
+	User     DatabaseUser `json:"user"`
+	Platform string       `json:"platform"`
+	Token    string       `json:"token"`
+	Date     time.Time    `json:"date"`
+}
+
+func DatabaseDeviceDefault() DatabaseDevice {
+	return DatabaseDevice{
+		Id:       0,
+		User:     DatabaseUserDefault(),
+		Platform: "",
+		Token:    "",
+		Date:     time.Time{},
+	}
+}
+
+// DatabaseSession is a login of a user, identified by the hash of the token issued to them, which is accepted until
+// the session expires or is revoked
+type DatabaseSession struct {
+	Id        uint32       `json:"id"`
+	User      DatabaseUser `json:"user"`
+	TokenHash string       `json:"token_hash"`
+	CreatedAt time.Time    `json:"created_at"`
+	ExpiresAt time.Time    `json:"expires_at"`
+	LastSeen  time.Time    `json:"last_seen"`
+}
+
+func DatabaseSessionDefault() DatabaseSession {
+	return DatabaseSession{
+		Id:        0,
+		User:      DatabaseUserDefault(),
+		TokenHash: "",
+		CreatedAt: time.Time{},
+		ExpiresAt: time.Time{},
+		LastSeen:  time.Time{},
+	}
+}
+
+// DatabaseRefreshToken is a token exchanged once for new tokens of its session, identified by its hash; Used is true
+// once it was exchanged
+type DatabaseRefreshToken struct {
+	Id        uint32          `json:"id"`
+	Session   DatabaseSession `json:"session"`
+	TokenHash string          `json:"token_hash"`
+	CreatedAt time.Time       `json:"created_at"`
+	ExpiresAt time.Time       `json:"expires_at"`
+	Used      bool            `json:"used"`
+}
+
+func DatabaseRefreshTokenDefault() DatabaseRefreshToken {
+	return DatabaseRefreshToken{
+		Id:        0,
+		Session:   DatabaseSessionDefault(),
+		TokenHash: "",
+		CreatedAt: time.Time{},
+		ExpiresAt: time.Time{},
+		Used:      false,
+	}
+}
+
+// DatabaseIdentity links the user known by an external provider as Subject to their WASAPhoto user
+type DatabaseIdentity struct {
+	Provider string       `json:"provider"`
+	Subject  string       `json:"subject"`
+	User     DatabaseUser `json:"user"`
+	Date     time.Time    `json:"date"`
+}
+
+func DatabaseIdentityDefault() DatabaseIdentity {
+	return DatabaseIdentity{
+		Provider: "",
+		Subject:  "",
+		User:     DatabaseUserDefault(),
+		Date:     time.Time{},
+	}
+}
+
+// DatabaseAPIKey is a key minted by a user for their integrations, identified by its hash: Scope tells whether it may
+// only read or also write, RateLimit how many requests per minute it may send, and LastUsedAt is nil until it is used
+type DatabaseAPIKey struct {
+	Id         uint32       `json:"id"`
+	User       DatabaseUser `json:"user"`
+	Name       string       `json:"name"`
+	KeyHash    string       `json:"key_hash"`
+	Scope      string       `json:"scope"`
+	RateLimit  int          `json:"rate_limit"`
+	CreatedAt  time.Time    `json:"created_at"`
+	LastUsedAt *time.Time   `json:"last_used_at"`
+}
+
+func DatabaseAPIKeyDefault() DatabaseAPIKey {
+	return DatabaseAPIKey{
+		Id:         0,
+		User:       DatabaseUserDefault(),
+		Name:       "",
+		KeyHash:    "",
+		Scope:      "",
+		RateLimit:  0,
+		CreatedAt:  time.Time{},
+		LastUsedAt: nil,
+	}
+}
+
+// DatabaseDigest is what a user missed since Since, sent to their email address: the users who followed them and the
+// most liked photos posted by the users they follow
+type DatabaseDigest struct {
+	User         DatabaseUser    `json:"user"`
+	Email        string          `json:"email"`
+	Since        time.Time       `json:"since"`
+	NewFollowers []DatabaseUser  `json:"new_followers"`
+	TopPhotos    []DatabasePhoto `json:"top_photos"`
+	// Activity counts the likes, the comments and the mentions the user received, for the types they receive by email
+	Activity map[string]int `json:"activity"`
+}
+
+func DatabaseDigestDefault() DatabaseDigest {
+	return DatabaseDigest{
+		User:         DatabaseUserDefault(),
+		Email:        "",
+		Since:        time.Time{},
+		NewFollowers: make([]DatabaseUser, 0),
+		TopPhotos:    make([]DatabasePhoto, 0),
+		Activity:     make(map[string]int),
+	}
+}
+
+// DatabaseIdempotencyKey is an idempotency key sent by a user with a request, together with the response to replay
+// on a retry of the request
+type DatabaseIdempotencyKey struct {
+	User uint32 `json:"user"`
+	Key  string `json:"key"`
+	// Fingerprint identifies the request, so that the key is not reused for a different one
+	Fingerprint string `json:"fingerprint"`
+	// Status is 0 while the request is in progress, and the status of its response afterwards
+	Status      int       `json:"status"`
+	ContentType string    `json:"content_type"`
+	Body        []byte    `json:"body"`
+	Date        time.Time `json:"date"`
+}
+
+func DatabaseIdempotencyKeyDefault() DatabaseIdempotencyKey {
+	return DatabaseIdempotencyKey{
+		User:        0,
+		Key:         "",
+		Fingerprint: "",
+		Status:      0,
+		ContentType: "",
+		Body:        nil,
+		Date:        time.Time{},
+	}
+}
+
+// DatabaseExport holds the data of an account written to its export archive: its published photos, from the oldest,
+// with the comments under them
+type DatabaseExport struct {
+	User   DatabaseUser          `json:"user"`
+	Photos []DatabaseExportPhoto `json:"photos"`
+}
+
+func DatabaseExportDefault() DatabaseExport {
+	emptyArray := make([]DatabaseExportPhoto, 0)
+
+	return DatabaseExport{
+		User:   DatabaseUserDefault(),
+		Photos: emptyArray,
+	}
+}
+
+// DatabaseExportPhoto is a photo of an export, with its comments from the oldest
+type DatabaseExportPhoto struct {
+	Photo    DatabasePhoto     `json:"photo"`
+	Comments []DatabaseComment `json:"comments"`
+}
+
+func DatabaseExportPhotoDefault() DatabaseExportPhoto {
+	emptyArray := make([]DatabaseComment, 0)
+
+	return DatabaseExportPhoto{
+		Photo:    DatabasePhotoDefault(),
+		Comments: emptyArray,
+	}
+}
+
+// DatabaseImport is a photo read back from an export archive into the account of Photo.User, together with the
+// comments the exported account wrote under it, which become comments of Photo.User
+type DatabaseImport struct {
+	// Source is the username of the exported account, and SourceId the id of the photo in it, which identify the
+	// photo across the attempts of the same import
+	Source   string            `json:"source"`
+	SourceId uint32            `json:"source_id"`
+	Photo    DatabasePhoto     `json:"photo"`
+	Comments []DatabaseComment `json:"comments"`
+}
+
+func DatabaseImportDefault() DatabaseImport {
+	emptyArray := make([]DatabaseComment, 0)
+
+	return DatabaseImport{
+		Source:   "",
+		SourceId: 0,
+		Photo:    DatabasePhotoDefault(),
+		Comments: emptyArray,
+	}
+}
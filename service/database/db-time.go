@@ -0,0 +1,38 @@
+package database
+
+import (
+	"fmt"
+	"time"
+)
+
+// unixTime reads a date stored as a unix timestamp into the time.Time it points to,
+// so that it can be passed straight to Scan
+type unixTime struct {
+	t *time.Time
+}
+
+func (u unixTime) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case int64:
+		*u.t = time.Unix(v, 0).UTC()
+		return nil
+	default:
+		return fmt.Errorf("cannot scan %T into a unix timestamp", src)
+	}
+}
+
+// milliseconds reads a duration stored as a number of milliseconds into the time.Duration it points to, so that it
+// can be passed straight to Scan
+type milliseconds struct {
+	d *time.Duration
+}
+
+func (m milliseconds) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case int64:
+		*m.d = time.Duration(v) * time.Millisecond
+		return nil
+	default:
+		return fmt.Errorf("cannot scan %T into a number of milliseconds", src)
+	}
+}
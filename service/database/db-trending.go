@@ -0,0 +1,138 @@
+package database
+
+import (
+	"context"
+	"time"
+)
+
+func (db *appdbimpl) GetTrending(ctx context.Context, dbUser DatabaseUser, since time.Time, limit int) (DatabaseTrending, error) {
+	dbTrending := DatabaseTrendingDefault()
+
+	// get the `limit` photos which received the most reactions
+	// and comments since `since`, from the most active one;
+	// the photos of deactivated or shadow banned users and of
+	// users banned by or banning the user performing the action
+	// are left out
+	rows, err := db.read().QueryContext(ctx, `
+		SELECT Photo.id
+		FROM (`+recentActivity+`) activity
+		JOIN Photo ON Photo.id=activity.photo
+		WHERE NOT Photo.archived
+		AND NOT Photo.close_friends
+		AND NOT Photo.flagged
+		AND NOT Photo.scheduled
+		AND Photo."user" NOT IN (
+			SELECT first_user
+			FROM ban
+			WHERE second_user=?
+			UNION
+			SELECT second_user
+			FROM ban
+			WHERE first_user=?
+		)
+		AND Photo."user" NOT IN (
+			SELECT id
+			FROM "User"
+			WHERE deactivated_at IS NOT NULL
+		)
+		AND `+visiblePhotoOwner+`
+		GROUP BY Photo.id, Photo.date
+		ORDER BY COUNT(*) DESC, Photo.date DESC, Photo.id DESC
+		LIMIT ?
+	`, since.Unix(), since.Unix(), dbUser.Id, dbUser.Id, dbUser.Id, limit)
+
+	if err != nil {
+		return dbTrending, err
+	}
+
+	defer rows.Close()
+
+	// the ids are read before the photos are
+	// loaded, which takes other connections
+	photoIds := make([]uint32, 0)
+
+	for rows.Next() {
+		var photoId uint32
+
+		err = rows.Scan(&photoId)
+
+		if err != nil {
+			return dbTrending, err
+		}
+
+		photoIds = append(photoIds, photoId)
+	}
+
+	if rows.Err() != nil {
+		return dbTrending, rows.Err()
+	}
+
+	_ = rows.Close()
+
+	for _, photoId := range photoIds {
+		dbPhoto, err := db.GetDatabasePhoto(ctx, photoId, dbUser)
+
+		if err != nil {
+			return dbTrending, err
+		}
+
+		dbTrending.Photos = append(dbTrending.Photos, dbPhoto)
+	}
+
+	// get the `limit` hashtags written in the most comments
+	// since `since`, with the same rules as the hashtag feed:
+	// the comments of users who banned the user and the ones
+	// under photos the user cannot see are not counted
+	rows, err = db.read().QueryContext(ctx, `
+		SELECT hashtag.name, COUNT(*)
+		FROM photo_hashtag
+		JOIN hashtag ON hashtag.id=photo_hashtag.hashtag
+		JOIN Comment ON Comment.id=photo_hashtag.comment
+		JOIN Photo ON Photo.id=photo_hashtag.photo
+		WHERE Comment.date >= ?
+		AND Comment."user" NOT IN (
+			SELECT first_user
+			FROM ban
+			WHERE second_user=?
+		)
+		AND `+visibleComment+`
+		AND NOT Photo.archived
+		AND NOT Photo.close_friends
+		AND NOT Photo.flagged
+		AND NOT Photo.scheduled
+		AND Photo."user" NOT IN (
+			SELECT first_user
+			FROM ban
+			WHERE second_user=?
+		)
+		AND Photo."user" NOT IN (
+			SELECT id
+			FROM "User"
+			WHERE deactivated_at IS NOT NULL
+		)
+		AND `+visiblePhotoOwner+`
+		GROUP BY hashtag.name
+		ORDER BY COUNT(*) DESC, hashtag.name
+		LIMIT ?
+	`, since.Unix(), dbUser.Id, dbUser.Id, dbUser.Id, dbUser.Id, limit)
+
+	if err != nil {
+		return dbTrending, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		dbHashtag := DatabaseHashtagCountDefault()
+
+		err = rows.Scan(&dbHashtag.Hashtag, &dbHashtag.Count)
+
+		if err != nil {
+			return dbTrending, err
+		}
+
+		dbTrending.Hashtags = append(dbTrending.Hashtags, dbHashtag)
+	}
+
+	return dbTrending, rows.Err()
+}
@@ -0,0 +1,28 @@
+package database
+
+import (
+	"context"
+)
+
+// withTx runs fn inside a transaction, committing it if fn succeeds
+// and rolling it back otherwise, so that either every statement
+// executed by fn is applied or none of them is; the transaction is
+// run again from the start if it fails because of lock contention
+func (db *appdbimpl) withTx(ctx context.Context, fn func(tx *dbtx) error) error {
+	return db.retry(ctx, func() error {
+		tx, err := db.c.BeginTx(ctx, nil)
+
+		if err != nil {
+			return err
+		}
+
+		err = fn(tx)
+
+		if err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+
+		return tx.Commit()
+	})
+}
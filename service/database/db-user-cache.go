@@ -0,0 +1,105 @@
+package database
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// userCacheSize is the number of users kept by the cache of the lookups, and userCacheTTL how long each of them is
+// kept, which bounds how stale a user changed through another instance of the server can be
+const userCacheSize = 4096
+const userCacheTTL = time.Minute
+
+// userCache keeps the users read by GetDatabaseUser, which is called for every photo, comment and notification of a
+// list, dropping the least recently used ones once full. The users are removed when they are updated or deleted.
+type userCache struct {
+	mu sync.Mutex
+
+	// entries holds the elements of order by user id, and order
+	// the entries from the most to the least recently used
+	entries map[uint32]*list.Element
+	order   *list.List
+
+	// generation changes on every removal, so that a user read
+	// from the database before a removal is not added after it
+	generation uint64
+}
+
+type userCacheEntry struct {
+	dbUser  DatabaseUser
+	expires time.Time
+}
+
+func newUserCache() *userCache {
+	return &userCache{
+		entries: make(map[uint32]*list.Element),
+		order:   list.New(),
+	}
+}
+
+// get returns the user if cached, or the generation to pass to add once the user is read from the database
+func (c *userCache) get(userId uint32) (DatabaseUser, bool, uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[userId]
+
+	if !ok {
+		return DatabaseUser{}, false, c.generation
+	}
+
+	entry := elem.Value.(*userCacheEntry)
+
+	if time.Now().After(entry.expires) {
+		c.order.Remove(elem)
+		delete(c.entries, userId)
+
+		return DatabaseUser{}, false, c.generation
+	}
+
+	c.order.MoveToFront(elem)
+
+	return entry.dbUser, true, 0
+}
+
+// add caches the user read from the database, unless a user was removed since `generation` was returned by get
+func (c *userCache) add(dbUser DatabaseUser, generation uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if generation != c.generation {
+		return
+	}
+
+	entry := &userCacheEntry{dbUser: dbUser, expires: time.Now().Add(userCacheTTL)}
+
+	if elem, ok := c.entries[dbUser.Id]; ok {
+		elem.Value = entry
+		c.order.MoveToFront(elem)
+
+		return
+	}
+
+	c.entries[dbUser.Id] = c.order.PushFront(entry)
+
+	// drop the least recently used user
+	if c.order.Len() > userCacheSize {
+		last := c.order.Back()
+		c.order.Remove(last)
+		delete(c.entries, last.Value.(*userCacheEntry).dbUser.Id)
+	}
+}
+
+// remove drops the user, which was updated or deleted
+func (c *userCache) remove(userId uint32) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+
+	if elem, ok := c.entries[userId]; ok {
+		c.order.Remove(elem)
+		delete(c.entries, userId)
+	}
+}
@@ -1,36 +1,77 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"git.sapienzaapps.it/fantasticcoffee/fantastic-coffee-decaffeinated/service/globaltime"
 )
 
-func (db *appdbimpl) GetDatabaseUser(userId uint32) (DatabaseUser, error) {
-	dbUser := DatabaseUserDefault()
+// The policies of the privacy settings, telling who can comment the photos of a user or mention them
+const (
+	PolicyEveryone  = "everyone"
+	PolicyFollowers = "followers"
+	PolicyNobody    = "nobody"
+)
+
+// Policies are the policies of the privacy settings, the first one being the default
+var Policies = []string{PolicyEveryone, PolicyFollowers, PolicyNobody}
+
+// IsPolicy reports whether `policy` is one of the Policies.
+func IsPolicy(policy string) bool {
+	for _, p := range Policies {
+		if p == policy {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (db *appdbimpl) GetDatabaseUser(ctx context.Context, userId uint32) (DatabaseUser, error) {
+	dbUser, ok, generation := db.users.get(userId)
+
+	if ok {
+		return dbUser, nil
+	}
+
+	dbUser = DatabaseUserDefault()
 
 	// get the user having the given user id
-	err := db.c.QueryRow(`
-		SELECT id, username
-		FROM User
+	err := db.c.QueryRowContext(ctx, `
+		SELECT id, username, display_name, bio, website, avatar, version
+		FROM "User"
 		WHERE id=?
-	`, userId).Scan(&dbUser.Id, &dbUser.Username)
+	`, userId).Scan(&dbUser.Id, &dbUser.Username, &dbUser.DisplayName, &dbUser.Bio, &dbUser.Website, &dbUser.Avatar, &dbUser.Version)
 
 	if errors.Is(err, sql.ErrNoRows) {
 		return dbUser, ErrUserDoesNotExist
 	}
 
-	return dbUser, err
+	if err != nil {
+		return dbUser, err
+	}
+
+	db.users.add(dbUser, generation)
+
+	return dbUser, nil
 }
 
-func (db *appdbimpl) GetDatabaseUserFromDatabaseLogin(dbLogin DatabaseLogin) (DatabaseUser, error) {
+func (db *appdbimpl) GetDatabaseUserFromDatabaseLogin(ctx context.Context, dbLogin DatabaseLogin) (DatabaseUser, error) {
 	dbUser := DatabaseUserDefault()
 
-	// get the user from the given login instance
-	err := db.c.QueryRow(`
-		SELECT id, username
-		FROM User
-		WHERE username=?
-	`, dbLogin.Username).Scan(&dbUser.Id, &dbUser.Username)
+	// get the user from the given login instance,
+	// unless their account is deactivated
+	err := db.c.QueryRowContext(ctx, `
+		SELECT id, username, display_name, bio, website, avatar, version
+		FROM "User"
+		WHERE username_key=?
+		AND deactivated_at IS NULL
+	`, db.usernameKey(dbLogin.Username)).Scan(&dbUser.Id, &dbUser.Username, &dbUser.DisplayName, &dbUser.Bio, &dbUser.Website, &dbUser.Avatar, &dbUser.Version)
 
 	if errors.Is(err, sql.ErrNoRows) {
 		return dbUser, ErrUserDoesNotExist
@@ -39,54 +80,602 @@ func (db *appdbimpl) GetDatabaseUserFromDatabaseLogin(dbLogin DatabaseLogin) (Da
 	return dbUser, err
 }
 
-func (db *appdbimpl) InsertUser(dbUser *DatabaseUser) error {
-	// check if the user is already registered
-	err := db.c.QueryRow(`
-		SELECT id
-		FROM User
-		WHERE username=?
-	`, dbUser.Username).Scan(&dbUser.Id)
+func (db *appdbimpl) InsertUser(ctx context.Context, dbUser *DatabaseUser) error {
+	// check if the user is already registered, under
+	// the username they registered with
+	err := db.c.QueryRowContext(ctx, `
+		SELECT id, username
+		FROM "User"
+		WHERE username_key=?
+	`, db.usernameKey(dbUser.Username)).Scan(&dbUser.Id, &dbUser.Username)
 
 	if err != nil {
 		// if there are no rows, the user was not registered
 		// hence it must be inserted into the database
 		if errors.Is(err, sql.ErrNoRows) {
 			// insert the new user into the database
-			res, err := db.c.Exec(`
-				INSERT INTO User(username)
-				VALUES (?)
-			`, dbUser.Username)
+			// and get the user id, unless the username
+			// is still reserved to the user who left it
+			return db.withTx(ctx, func(tx *dbtx) error {
+				reserved, err := usernameReservedTx(ctx, tx, db.usernameKey(dbUser.Username), 0)
+
+				if err != nil {
+					return err
+				}
+
+				if reserved {
+					return ErrUsernameAlreadyTaken
+				}
+
+				return tx.QueryRowContext(ctx, `
+					INSERT INTO "User"(username, username_key)
+					VALUES (?, ?)
+					RETURNING id
+				`, dbUser.Username, db.usernameKey(dbUser.Username)).Scan(&dbUser.Id)
+			})
+		} else {
+			return err
+		}
+	} else {
+		return nil
+	}
+}
+
+func (db *appdbimpl) UpdateUser(ctx context.Context, oldDbUser DatabaseUser, newDbUser DatabaseUser, reservedUntil time.Time) error {
+	// the cached user is removed even if the update fails, since
+	// it may be the stale one which made the update conflict
+	defer db.users.remove(oldDbUser.Id)
+
+	// a username differing only in its case, with a case-insensitive
+	// policy, changes how the user is shown but not their key
+	renamed := newDbUser.Username != oldDbUser.Username
+	rekeyed := db.usernameKey(newDbUser.Username) != db.usernameKey(oldDbUser.Username)
+
+	return db.withTx(ctx, func(tx *dbtx) error {
+		// the username left by another user is reserved to them
+		if rekeyed {
+			reserved, err := usernameReservedTx(ctx, tx, db.usernameKey(newDbUser.Username), oldDbUser.Id)
 
 			if err != nil {
 				return err
 			}
 
-			// get the user id
-			dbUserId, err := res.LastInsertId()
+			if reserved {
+				return ErrUsernameAlreadyTaken
+			}
+		}
+
+		// update the username and the profile in the database,
+		// unless the user was updated after it was read
+		res, err := tx.ExecContext(ctx, `
+			UPDATE "User"
+			SET username=?, username_key=?, display_name=?, bio=?, website=?, version=version+1
+			WHERE id=?
+			AND version=?
+		`, newDbUser.Username, db.usernameKey(newDbUser.Username), newDbUser.DisplayName, newDbUser.Bio, newDbUser.Website, oldDbUser.Id, oldDbUser.Version)
+
+		// the new username was already taken by another user
+		if db.c.d.isUniqueViolation(err) {
+			return ErrUsernameAlreadyTaken
+		}
+
+		if err != nil {
+			return err
+		}
+
+		aff, err := res.RowsAffected()
+
+		if err != nil {
+			return err
+		}
+
+		// if there are no affected rows then either
+		// the user does not exist or it is stale
+		if aff == 0 {
+			var exists bool
+
+			err = tx.QueryRowContext(ctx, `
+				SELECT EXISTS(
+					SELECT 1
+					FROM "User"
+					WHERE id=?
+				)
+			`, oldDbUser.Id).Scan(&exists)
 
 			if err != nil {
 				return err
 			}
 
-			dbUser.Id = uint32(dbUserId)
+			if exists {
+				return ErrConflict
+			}
+
+			return ErrUserDoesNotExist
+		}
 
+		// only the changes of the username are audited, and only
+		// the ones changing its key leave the old one reserved
+		if !renamed {
 			return nil
-		} else {
+		}
+
+		if !rekeyed {
+			return insertAuditTx(ctx, tx, oldDbUser.Id, AuditChangeUsername, oldDbUser.Id, oldDbUser.Username+" -> "+newDbUser.Username)
+		}
+
+		now := globaltime.Now()
+
+		// the user taking back a username they left
+		// does not keep it reserved anymore
+		_, err = tx.ExecContext(ctx, `
+			UPDATE username_history
+			SET reserved_until=?
+			WHERE username_key=?
+			AND "user"=?
+			AND reserved_until>?
+		`, now.Unix(), db.usernameKey(newDbUser.Username), oldDbUser.Id, now.Unix())
+
+		if err != nil {
 			return err
 		}
-	} else {
+
+		// keep the old username reserved to the user
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO username_history(username, username_key, "user", changed_at, reserved_until)
+			VALUES (?, ?, ?, ?, ?)
+			ON CONFLICT (username, changed_at) DO UPDATE
+			SET username_key=excluded.username_key, "user"=excluded."user", reserved_until=excluded.reserved_until
+		`, oldDbUser.Username, db.usernameKey(oldDbUser.Username), oldDbUser.Id, now.Unix(), reservedUntil.Unix())
+
+		if err != nil {
+			return err
+		}
+
+		return insertAuditTx(ctx, tx, oldDbUser.Id, AuditChangeUsername, oldDbUser.Id, oldDbUser.Username+" -> "+newDbUser.Username)
+	})
+}
+
+// usernameReservedTx tells, inside the transaction `tx`, whether the username with the key `usernameKey` was left by a
+// user other than `userId` who still holds it
+func usernameReservedTx(ctx context.Context, tx *dbtx, usernameKey string, userId uint32) (bool, error) {
+	var reserved bool
+
+	err := tx.QueryRowContext(ctx, `
+		SELECT EXISTS(
+			SELECT 1
+			FROM username_history
+			WHERE username_key=?
+			AND "user"<>?
+			AND reserved_until>?
+		)
+	`, usernameKey, userId, globaltime.Now().Unix()).Scan(&reserved)
+
+	return reserved, err
+}
+
+func (db *appdbimpl) GetRenamedUser(ctx context.Context, username string) (DatabaseUser, error) {
+	var userId uint32
+
+	// get the user who left the username most recently, as
+	// long as it is reserved to them and they are active
+	err := db.c.QueryRowContext(ctx, `
+		SELECT "user"
+		FROM username_history
+		WHERE username_key=?
+		AND reserved_until>?
+		AND "user" IN (
+			SELECT id
+			FROM "User"
+			WHERE deactivated_at IS NULL
+		)
+		ORDER BY changed_at DESC
+		LIMIT 1
+	`, db.usernameKey(username), globaltime.Now().Unix()).Scan(&userId)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return DatabaseUserDefault(), ErrUserDoesNotExist
+	}
+
+	if err != nil {
+		return DatabaseUserDefault(), err
+	}
+
+	return db.GetDatabaseUser(ctx, userId)
+}
+
+// UseUsernameKey looks the users up by the key `key` gives to their usernames, computing again the keys of the users
+// and of the usernames they left. It fails, changing nothing, if two users end up with the same key.
+func (db *appdbimpl) UseUsernameKey(ctx context.Context, key func(string) string) error {
+	type keyedUsername struct {
+		id       uint32
+		username string
+	}
+
+	err := db.withTx(ctx, func(tx *dbtx) error {
+		rows, err := tx.QueryContext(ctx, `
+			SELECT id, username
+			FROM "User"
+		`)
+
+		if err != nil {
+			return err
+		}
+
+		var users []keyedUsername
+
+		for rows.Next() {
+			var user keyedUsername
+
+			err = rows.Scan(&user.id, &user.username)
+
+			if err != nil {
+				rows.Close()
+				return err
+			}
+
+			users = append(users, user)
+		}
+
+		rows.Close()
+
+		if rows.Err() != nil {
+			return rows.Err()
+		}
+
+		// the old keys are cleared first, since a user may
+		// get the old key of another one, changed later
+		_, err = tx.ExecContext(ctx, `
+			UPDATE "User"
+			SET username_key=NULL
+		`)
+
+		if err != nil {
+			return err
+		}
+
+		for _, user := range users {
+			_, err = tx.ExecContext(ctx, `
+				UPDATE "User"
+				SET username_key=?
+				WHERE id=?
+			`, key(user.username), user.id)
+
+			if db.c.d.isUniqueViolation(err) {
+				var other string
+
+				err = tx.QueryRowContext(ctx, `
+					SELECT username
+					FROM "User"
+					WHERE username_key=?
+				`, key(user.username)).Scan(&other)
+
+				if err != nil {
+					return err
+				}
+
+				return fmt.Errorf("the usernames %q and %q have the same key under the username policy", other, user.username)
+			}
+
+			if err != nil {
+				return err
+			}
+		}
+
+		rows, err = tx.QueryContext(ctx, `
+			SELECT DISTINCT username
+			FROM username_history
+		`)
+
+		if err != nil {
+			return err
+		}
+
+		var usernames []string
+
+		for rows.Next() {
+			var username string
+
+			err = rows.Scan(&username)
+
+			if err != nil {
+				rows.Close()
+				return err
+			}
+
+			usernames = append(usernames, username)
+		}
+
+		rows.Close()
+
+		if rows.Err() != nil {
+			return rows.Err()
+		}
+
+		for _, username := range usernames {
+			_, err = tx.ExecContext(ctx, `
+				UPDATE username_history
+				SET username_key=?
+				WHERE username=?
+			`, key(username), username)
+
+			if err != nil {
+				return err
+			}
+		}
+
 		return nil
+	})
+
+	if err != nil {
+		return err
 	}
+
+	db.usernameKey = key
+
+	return nil
 }
 
-func (db *appdbimpl) UpdateUser(oldDbUser DatabaseUser, newDbUser DatabaseUser) error {
-	// update the username in the database
-	res, err := db.c.Exec(`
-		UPDATE User
-		SET username=?
+func (db *appdbimpl) DeleteUser(ctx context.Context, dbUser DatabaseUser) ([]string, error) {
+	var urls []string
+
+	// remove the user together with everything they
+	// posted and every relationship they are part of
+	// in a single transaction
+	defer db.users.remove(dbUser.Id)
+
+	err := db.withTx(ctx, func(tx *dbtx) (err error) {
+		// get the urls of the files of the user,
+		// which are removed once they are gone
+		urls, err = userFileUrlsTx(ctx, tx, dbUser.Id)
+
+		if err != nil {
+			return err
+		}
+
+		err = deleteUserTx(ctx, tx, dbUser.Id)
+
+		if err != nil {
+			return err
+		}
+
+		return insertAuditTx(ctx, tx, dbUser.Id, AuditDeleteUser, dbUser.Id, dbUser.Username)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return urls, nil
+}
+
+// userFileUrlsTx returns the urls of the files of the user `userId` inside the transaction `tx`: their photos, the
+// originals of the edited ones, the posters of the videos, their stories and their avatar
+func userFileUrlsTx(ctx context.Context, tx *dbtx, userId uint32) ([]string, error) {
+	urls := make([]string, 0)
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT url
+		FROM Photo
+		WHERE "user"=?
+		UNION
+		SELECT original_url
+		FROM Photo
+		WHERE "user"=?
+		AND original_url<>''
+		UNION
+		SELECT poster_url
+		FROM Photo
+		WHERE "user"=?
+		AND poster_url<>''
+		UNION
+		SELECT url
+		FROM story
+		WHERE "user"=?
+		UNION
+		SELECT avatar
+		FROM "User"
+		WHERE id=?
+		AND avatar<>''
+	`, userId, userId, userId, userId, userId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var url string
+
+		err = rows.Scan(&url)
+
+		if err != nil {
+			return nil, err
+		}
+
+		urls = append(urls, url)
+	}
+
+	return urls, rows.Err()
+}
+
+// deleteUserTx removes the user `userId` and all their data inside the transaction `tx`
+func deleteUserTx(ctx context.Context, tx *dbtx, userId uint32) error {
+	// remove the likes and the comments to the photos of the user
+	_, err := tx.ExecContext(ctx, `
+		DELETE FROM "like"
+		WHERE photo IN (
+			SELECT id
+			FROM Photo
+			WHERE "user"=?
+		)
+	`, userId)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		DELETE FROM Comment
+		WHERE photo IN (
+			SELECT id
+			FROM Photo
+			WHERE "user"=?
+		)
+	`, userId)
+
+	if err != nil {
+		return err
+	}
+
+	// remove the photos of the user
+	_, err = tx.ExecContext(ctx, `
+		DELETE FROM Photo
+		WHERE "user"=?
+	`, userId)
+
+	if err != nil {
+		return err
+	}
+
+	// update the counters of the photos the user liked
+	// or commented, then remove the likes and the
+	// comments made by the user
+	_, err = tx.ExecContext(ctx, `
+		UPDATE Photo
+		SET like_count=like_count-1
+		WHERE id IN (
+			SELECT photo
+			FROM "like"
+			WHERE "user"=?
+		)
+	`, userId)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE Photo
+		SET comment_count=comment_count-(
+			SELECT COUNT(*)
+			FROM Comment
+			WHERE Comment.photo=Photo.id
+			AND Comment."user"=?
+		)
+		WHERE id IN (
+			SELECT photo
+			FROM Comment
+			WHERE "user"=?
+		)
+	`, userId, userId)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		DELETE FROM "like"
+		WHERE "user"=?
+	`, userId)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		DELETE FROM Comment
+		WHERE "user"=?
+	`, userId)
+
+	if err != nil {
+		return err
+	}
+
+	// remove the followings, the bans and the mutes in both directions
+	_, err = tx.ExecContext(ctx, `
+		DELETE FROM follow
+		WHERE first_user=?
+		OR second_user=?
+	`, userId, userId)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		DELETE FROM ban
+		WHERE first_user=?
+		OR second_user=?
+	`, userId, userId)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		DELETE FROM mute
+		WHERE first_user=?
+		OR second_user=?
+	`, userId, userId)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		DELETE FROM close_friend
+		WHERE first_user=?
+		OR second_user=?
+	`, userId, userId)
+
+	if err != nil {
+		return err
+	}
+
+	// remove the settings of the user, the requests to follow in both directions and the notification preferences
+	_, err = tx.ExecContext(ctx, `
+		DELETE FROM follow_request
+		WHERE first_user=?
+		OR second_user=?
+	`, userId, userId)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		DELETE FROM settings
+		WHERE "user"=?
+	`, userId)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		DELETE FROM notification_preference
+		WHERE "user"=?
+	`, userId)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		DELETE FROM username_history
+		WHERE "user"=?
+	`, userId)
+
+	if err != nil {
+		return err
+	}
+
+	// remove the user
+	res, err := tx.ExecContext(ctx, `
+		DELETE FROM "User"
 		WHERE id=?
-		AND username=?
-	`, newDbUser.Username, oldDbUser.Id, oldDbUser.Username)
+	`, userId)
 
 	if err != nil {
 		return err
@@ -98,6 +687,8 @@ func (db *appdbimpl) UpdateUser(oldDbUser DatabaseUser, newDbUser DatabaseUser)
 		return err
 	}
 
+	// if there are no affected rows
+	// then the user did not exist
 	if aff == 0 {
 		return ErrUserDoesNotExist
 	}
@@ -105,23 +696,140 @@ func (db *appdbimpl) UpdateUser(oldDbUser DatabaseUser, newDbUser DatabaseUser)
 	return nil
 }
 
-func (db *appdbimpl) GetUserList(dbUser DatabaseUser, dbLogin DatabaseLogin) (DatabaseUserList, error) {
+func (db *appdbimpl) DeactivateUser(ctx context.Context, dbUser DatabaseUser, date time.Time) error {
+	// mark the user as deactivated, keeping all their data
+	var res sql.Result
+
+	err := db.retry(ctx, func() (err error) {
+		res, err = db.c.ExecContext(ctx, `
+			UPDATE "User"
+			SET deactivated_at=?
+			WHERE id=?
+			AND deactivated_at IS NULL
+		`, date.Unix(), dbUser.Id)
+
+		return err
+	})
+
+	if err != nil {
+		return err
+	}
+
+	aff, err := res.RowsAffected()
+
+	if err != nil {
+		return err
+	}
+
+	// if there are no affected rows then the
+	// user did not exist or was already deactivated
+	if aff == 0 {
+		return ErrUserDoesNotExist
+	}
+
+	return nil
+}
+
+func (db *appdbimpl) ReactivateUser(ctx context.Context, dbLogin DatabaseLogin, since time.Time) ([]string, error) {
+	var userId uint32
+	var urls []string
+
+	// the user may be deleted, if the reactivation window is over
+	defer func() {
+		if userId != 0 {
+			db.users.remove(userId)
+		}
+	}()
+
+	err := db.withTx(ctx, func(tx *dbtx) error {
+		var deactivatedAt, suspendedAt sql.NullInt64
+		var erasing bool
+
+		urls = nil
+
+		// get the deactivation date of the user logging in
+		err := tx.QueryRowContext(ctx, `
+			SELECT id, deactivated_at, suspended_at, EXISTS(
+				SELECT 1
+				FROM erasure
+				WHERE erasure."user"="User".id
+				AND completed_at IS NULL
+			)
+			FROM "User"
+			WHERE username_key=?
+		`, db.usernameKey(dbLogin.Username)).Scan(&userId, &deactivatedAt, &suspendedAt, &erasing)
+
+		// if there are no rows the user was never registered,
+		// while a null date means the account is active
+		if errors.Is(err, sql.ErrNoRows) || (err == nil && !deactivatedAt.Valid) {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		// only the administrators can restore
+		// the account of a suspended user
+		if suspendedAt.Valid {
+			return ErrUserSuspended
+		}
+
+		// the account of a user who asked for its
+		// erasure cannot be restored anymore
+		if erasing {
+			return ErrErasurePending
+		}
+
+		// if the account was deactivated before `since` the
+		// reactivation window is over, hence its data and
+		// its files are removed and the user will be
+		// registered again
+		if deactivatedAt.Int64 < since.Unix() {
+			urls, err = userFileUrlsTx(ctx, tx, userId)
+
+			if err != nil {
+				return err
+			}
+
+			return deleteUserTx(ctx, tx, userId)
+		}
+
+		// restore the account
+		_, err = tx.ExecContext(ctx, `
+			UPDATE "User"
+			SET deactivated_at=NULL
+			WHERE id=?
+		`, userId)
+
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return urls, nil
+}
+
+func (db *appdbimpl) GetUserList(ctx context.Context, dbUser DatabaseUser, dbLogin DatabaseLogin) (DatabaseUserList, error) {
 	dbUserList := DatabaseUserListDefault()
 
 	// get the table of the users matching the query
-	rows, err := db.c.Query(`
-		SELECT id, username
-		FROM User
+	rows, err := db.read().QueryContext(ctx, `
+		SELECT id, username, display_name, bio, website, avatar
+		FROM "User"
 		WHERE id IN (
 			SELECT id
-			FROM User
-			WHERE username LIKE '%'||?||'%'
-			EXCEPT 
+			FROM "User"
+			WHERE LOWER(username) LIKE '%'||LOWER(CAST(? AS TEXT))||'%'
+			AND deactivated_at IS NULL
+			EXCEPT
 			SELECT first_user
 			FROM ban
 			WHERE second_user=?
 			EXCEPT
-			SELECT ?
+			SELECT CAST(? AS INTEGER)
 		)
 	`, dbLogin.Username, dbUser.Id, dbUser.Id)
 
@@ -137,7 +845,7 @@ func (db *appdbimpl) GetUserList(dbUser DatabaseUser, dbLogin DatabaseLogin) (Da
 	for rows.Next() {
 		newDbUser := DatabaseUserDefault()
 
-		err = rows.Scan(&newDbUser.Id, &newDbUser.Username)
+		err = rows.Scan(&newDbUser.Id, &newDbUser.Username, &newDbUser.DisplayName, &newDbUser.Bio, &newDbUser.Website, &newDbUser.Avatar)
 
 		if err != nil {
 			return dbUserList, err
@@ -154,3 +862,342 @@ func (db *appdbimpl) GetUserList(dbUser DatabaseUser, dbLogin DatabaseLogin) (Da
 
 	return dbUserList, err
 }
+
+func (db *appdbimpl) SearchUsers(ctx context.Context, dbUser DatabaseUser, query string, limit int, after uint32) (DatabaseUserList, error) {
+	dbUserList := DatabaseUserListDefault()
+
+	// the wildcards of LIKE in the query must be matched literally
+	pattern := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(strings.ToLower(query))
+
+	// get a page of at most `limit` users whose username contains
+	// the query, ranking the exact match first, then the usernames
+	// starting with the query and then the others, sorted by name;
+	// only the users coming after the user `after` are kept (if it
+	// is not 0), while the users who banned the user performing the
+	// action, or who were banned by them, are not considered
+	rows, err := db.read().QueryContext(ctx, `
+		WITH result AS (
+			SELECT id, username, display_name, bio, website, avatar, LOWER(username) AS name,
+				CASE
+					WHEN LOWER(username)=CAST(? AS TEXT) THEN 0
+					WHEN LOWER(username) LIKE CAST(? AS TEXT)||'%' ESCAPE '\' THEN 1
+					ELSE 2
+				END AS position
+			FROM "User"
+			WHERE LOWER(username) LIKE '%'||CAST(? AS TEXT)||'%' ESCAPE '\'
+			AND deactivated_at IS NULL
+			AND id<>?
+			AND id NOT IN (
+				SELECT first_user
+				FROM ban
+				WHERE second_user=?
+			)
+			AND id NOT IN (
+				SELECT second_user
+				FROM ban
+				WHERE first_user=?
+			)
+		)
+		SELECT id, username, display_name, bio, website, avatar
+		FROM result
+		WHERE ?=0
+		OR (position, name, id) > (
+			SELECT position, name, id
+			FROM result
+			WHERE id=?
+		)
+		ORDER BY position, name, id
+		LIMIT ?
+	`, strings.ToLower(query), pattern, pattern, dbUser.Id, dbUser.Id, dbUser.Id, after, after, limit)
+
+	if err != nil {
+		return dbUserList, err
+	}
+
+	// build the results list
+	for rows.Next() {
+		newDbUser := DatabaseUserDefault()
+
+		err = rows.Scan(&newDbUser.Id, &newDbUser.Username, &newDbUser.DisplayName, &newDbUser.Bio, &newDbUser.Website, &newDbUser.Avatar)
+
+		if err != nil {
+			return dbUserList, err
+		}
+
+		dbUserList.Users = append(dbUserList.Users, newDbUser)
+	}
+
+	if rows.Err() != nil {
+		return dbUserList, err
+	}
+
+	_ = rows.Close()
+
+	return dbUserList, err
+}
+
+func (db *appdbimpl) GetUserSettings(ctx context.Context, dbUser DatabaseUser) (DatabaseSettings, error) {
+	dbSettings := DatabaseSettingsDefault()
+
+	// get the settings of the user, the privacy settings
+	// being the default ones if the user never changed them
+	err := db.c.QueryRowContext(ctx, `
+		SELECT
+			strip_location,
+			COALESCE(email, ''),
+			email_verified,
+			COALESCE(settings.private, FALSE),
+			COALESCE(settings.comment_policy, ?),
+			COALESCE(settings.mention_policy, ?),
+			COALESCE(settings.hide_like_counts, FALSE)
+		FROM "User"
+		LEFT JOIN settings ON settings."user"="User".id
+		WHERE id=?
+	`, PolicyEveryone, PolicyEveryone, dbUser.Id).Scan(&dbSettings.StripLocation, &dbSettings.Email, &dbSettings.EmailVerified, &dbSettings.Private, &dbSettings.CommentPolicy, &dbSettings.MentionPolicy, &dbSettings.HideLikeCounts)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return dbSettings, ErrUserDoesNotExist
+	}
+
+	return dbSettings, err
+}
+
+func (db *appdbimpl) UpdateUserSettings(ctx context.Context, dbUser DatabaseUser, dbSettings DatabaseSettings) error {
+	var likesHidden bool
+	var approved []DatabaseUser
+
+	err := db.withTx(ctx, func(tx *dbtx) error {
+		// replace the settings of the user, an empty email address
+		// leaving the address unset; a new address is not verified
+		res, err := tx.ExecContext(ctx, `
+			UPDATE "User"
+			SET strip_location=?,
+				email_verified=CASE WHEN email=NULLIF(?, '') THEN email_verified ELSE FALSE END,
+				email=NULLIF(?, '')
+			WHERE id=?
+		`, dbSettings.StripLocation, dbSettings.Email, dbSettings.Email, dbUser.Id)
+
+		if err != nil {
+			return err
+		}
+
+		aff, err := res.RowsAffected()
+
+		if err != nil {
+			return err
+		}
+
+		// if there are no affected rows
+		// then the user did not exist
+		if aff == 0 {
+			return ErrUserDoesNotExist
+		}
+
+		// the like counts are cached, so they have
+		// to be refreshed if they are hidden or shown
+		err = tx.QueryRowContext(ctx, `
+			SELECT EXISTS(
+				SELECT 1
+				FROM settings
+				WHERE "user"=?
+				AND hide_like_counts
+			)
+		`, dbUser.Id).Scan(&likesHidden)
+
+		if err != nil {
+			return err
+		}
+
+		// replace the privacy settings of the user
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO settings("user", private, comment_policy, mention_policy, hide_like_counts)
+			VALUES (?, ?, ?, ?, ?)
+			ON CONFLICT ("user") DO UPDATE
+			SET private=excluded.private,
+				comment_policy=excluded.comment_policy,
+				mention_policy=excluded.mention_policy,
+				hide_like_counts=excluded.hide_like_counts
+		`, dbUser.Id, dbSettings.Private, dbSettings.CommentPolicy, dbSettings.MentionPolicy, dbSettings.HideLikeCounts)
+
+		if err != nil || dbSettings.Private {
+			return err
+		}
+
+		// a public account can be followed by anyone,
+		// so the pending requests to follow it are approved
+		approved, err = approveFollowRequestsTx(ctx, tx, dbUser)
+
+		return err
+	})
+
+	if err != nil {
+		return err
+	}
+
+	groups := []string{photosGroup(dbUser.Id), followersGroup(dbUser.Id)}
+
+	for _, requesterDbUser := range approved {
+		groups = append(groups, followingGroup(requesterDbUser.Id))
+	}
+
+	if likesHidden != dbSettings.HideLikeCounts {
+		photoIds, err := db.getUserPhotoIds(ctx, dbUser)
+
+		if err != nil {
+			return err
+		}
+
+		for _, photoId := range photoIds {
+			groups = append(groups, photoGroup(photoId))
+		}
+	}
+
+	db.invalidate(ctx, groups...)
+
+	return nil
+}
+
+// approveFollowRequestsTx approves all the requests to follow the user inside the transaction `tx`, returning the users
+// who sent them
+func approveFollowRequestsTx(ctx context.Context, tx *dbtx, dbUser DatabaseUser) ([]DatabaseUser, error) {
+	requesters := make([]DatabaseUser, 0)
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT first_user
+		FROM follow_request
+		WHERE second_user=?
+	`, dbUser.Id)
+
+	if err != nil {
+		return requesters, err
+	}
+
+	for rows.Next() {
+		requesterDbUser := DatabaseUserDefault()
+
+		err = rows.Scan(&requesterDbUser.Id)
+
+		if err != nil {
+			_ = rows.Close()
+			return requesters, err
+		}
+
+		requesters = append(requesters, requesterDbUser)
+	}
+
+	err = rows.Err()
+	_ = rows.Close()
+
+	if err != nil {
+		return requesters, err
+	}
+
+	for _, requesterDbUser := range requesters {
+		err = insertFollowTx(ctx, tx, requesterDbUser, dbUser)
+
+		if err != nil {
+			return requesters, err
+		}
+	}
+
+	return requesters, nil
+}
+
+// getUserPhotoIds returns the ids of all the photos of the user
+func (db *appdbimpl) getUserPhotoIds(ctx context.Context, dbUser DatabaseUser) ([]uint32, error) {
+	photoIds := make([]uint32, 0)
+
+	rows, err := db.c.QueryContext(ctx, `
+		SELECT id
+		FROM Photo
+		WHERE "user"=?
+	`, dbUser.Id)
+
+	if err != nil {
+		return photoIds, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var photoId uint32
+
+		err = rows.Scan(&photoId)
+
+		if err != nil {
+			return photoIds, err
+		}
+
+		photoIds = append(photoIds, photoId)
+	}
+
+	return photoIds, rows.Err()
+}
+
+func (db *appdbimpl) VerifyUserEmail(ctx context.Context, dbUser DatabaseUser, email string) error {
+	var res sql.Result
+
+	// verify the email address of the user, unless
+	// it was changed since the link was sent to it
+	err := db.retry(ctx, func() (err error) {
+		res, err = db.c.ExecContext(ctx, `
+			UPDATE "User"
+			SET email_verified=TRUE
+			WHERE id=?
+			AND email=?
+		`, dbUser.Id, email)
+
+		return err
+	})
+
+	if err != nil {
+		return err
+	}
+
+	aff, err := res.RowsAffected()
+
+	if err != nil {
+		return err
+	}
+
+	if aff == 0 {
+		return ErrEmailChanged
+	}
+
+	return nil
+}
+
+// SetUserAvatar replaces the url of the avatar of the user, an empty url removing it, and returns the url of the avatar
+// it replaced, whose file may have to be removed
+func (db *appdbimpl) SetUserAvatar(ctx context.Context, dbUser DatabaseUser, avatar string) (string, error) {
+	var oldAvatar string
+
+	defer db.users.remove(dbUser.Id)
+
+	err := db.withTx(ctx, func(tx *dbtx) error {
+		// get the avatar being replaced
+		err := tx.QueryRowContext(ctx, `
+			SELECT avatar
+			FROM "User"
+			WHERE id=?
+		`, dbUser.Id).Scan(&oldAvatar)
+
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrUserDoesNotExist
+		}
+
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			UPDATE "User"
+			SET avatar=?
+			WHERE id=?
+		`, avatar, dbUser.Id)
+
+		return err
+	})
+
+	return oldAvatar, err
+}
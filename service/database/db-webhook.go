@@ -0,0 +1,332 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sort"
+	"time"
+)
+
+func (db *appdbimpl) GetWebhooks(ctx context.Context) ([]DatabaseWebhook, error) {
+	dbWebhooks := make([]DatabaseWebhook, 0)
+
+	// get the webhooks registered by the administrators, oldest first
+	rows, err := db.c.QueryContext(ctx, `
+		SELECT id, url, secret, date
+		FROM webhook
+		ORDER BY id
+	`)
+
+	if err != nil {
+		return dbWebhooks, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		dbWebhook := DatabaseWebhookDefault()
+
+		err = rows.Scan(&dbWebhook.Id, &dbWebhook.Url, &dbWebhook.Secret, unixTime{&dbWebhook.Date})
+
+		if err != nil {
+			return dbWebhooks, err
+		}
+
+		dbWebhooks = append(dbWebhooks, dbWebhook)
+	}
+
+	if rows.Err() != nil {
+		return dbWebhooks, rows.Err()
+	}
+
+	_ = rows.Close()
+
+	// get the events each webhook is subscribed to
+	for i := range dbWebhooks {
+		dbWebhooks[i].Events, err = db.webhookEvents(ctx, dbWebhooks[i].Id)
+
+		if err != nil {
+			return dbWebhooks, err
+		}
+	}
+
+	return dbWebhooks, nil
+}
+
+func (db *appdbimpl) GetWebhook(ctx context.Context, webhookId uint32) (DatabaseWebhook, error) {
+	dbWebhook := DatabaseWebhookDefault()
+
+	err := db.c.QueryRowContext(ctx, `
+		SELECT id, url, secret, date
+		FROM webhook
+		WHERE id=?
+	`, webhookId).Scan(&dbWebhook.Id, &dbWebhook.Url, &dbWebhook.Secret, unixTime{&dbWebhook.Date})
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return dbWebhook, ErrWebhookDoesNotExist
+	}
+
+	if err != nil {
+		return dbWebhook, err
+	}
+
+	dbWebhook.Events, err = db.webhookEvents(ctx, webhookId)
+
+	return dbWebhook, err
+}
+
+// webhookEvents returns the events the webhook is subscribed to, sorted by name
+func (db *appdbimpl) webhookEvents(ctx context.Context, webhookId uint32) ([]string, error) {
+	events := make([]string, 0)
+
+	rows, err := db.c.QueryContext(ctx, `
+		SELECT event
+		FROM webhook_event
+		WHERE webhook=?
+		ORDER BY event
+	`, webhookId)
+
+	if err != nil {
+		return events, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var event string
+
+		err = rows.Scan(&event)
+
+		if err != nil {
+			return events, err
+		}
+
+		events = append(events, event)
+	}
+
+	return events, rows.Err()
+}
+
+func (db *appdbimpl) InsertWebhook(ctx context.Context, dbWebhook *DatabaseWebhook) error {
+	return db.withTx(ctx, func(tx *dbtx) error {
+		err := tx.QueryRowContext(ctx, `
+			INSERT INTO webhook(url, secret, date)
+			VALUES (?, ?, ?)
+			RETURNING id
+		`, dbWebhook.Url, dbWebhook.Secret, dbWebhook.Date.Unix()).Scan(&dbWebhook.Id)
+
+		if err != nil {
+			return err
+		}
+
+		// subscribe the webhook to its events
+		for _, event := range dbWebhook.Events {
+			_, err = tx.ExecContext(ctx, `
+				INSERT INTO webhook_event(webhook, event)
+				VALUES (?, ?)
+				ON CONFLICT DO NOTHING
+			`, dbWebhook.Id, event)
+
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (db *appdbimpl) DeleteWebhook(ctx context.Context, webhookId uint32) error {
+	// remove the webhook, together with its
+	// subscriptions and its deliveries
+	res, err := db.c.ExecContext(ctx, `
+		DELETE FROM webhook
+		WHERE id=?
+	`, webhookId)
+
+	if err != nil {
+		return err
+	}
+
+	aff, err := res.RowsAffected()
+
+	if err != nil {
+		return err
+	}
+
+	if aff == 0 {
+		return ErrWebhookDoesNotExist
+	}
+
+	return nil
+}
+
+func (db *appdbimpl) InsertWebhookEvent(ctx context.Context, dbEvent DatabaseWebhookEvent) error {
+	// queue a delivery of the event for every webhook subscribed
+	// to it, due right away; the events of the shadow banned users
+	// are not delivered, as no one else sees what they do
+	_, err := db.c.ExecContext(ctx, `
+		INSERT INTO webhook_delivery(webhook, event, payload, date, next_attempt_at)
+		SELECT webhook, CAST(? AS TEXT), CAST(? AS TEXT), CAST(? AS BIGINT), CAST(? AS BIGINT)
+		FROM webhook_event
+		WHERE event=?
+		AND NOT EXISTS (
+			SELECT 1
+			FROM "User"
+			WHERE id=?
+			AND shadow_banned
+		)
+	`, dbEvent.Event, dbEvent.Payload, dbEvent.Date.Unix(), dbEvent.Date.Unix(), dbEvent.Event, dbEvent.Actor)
+
+	return err
+}
+
+func (db *appdbimpl) TakeWebhookDeliveries(ctx context.Context, now time.Time, lease time.Time, limit int) ([]DatabaseWebhookDelivery, error) {
+	var dbDeliveries []DatabaseWebhookDelivery
+
+	// postpone at most `limit` of the due deliveries until the
+	// lease expires, getting them back; being taken in a single
+	// statement, each one is attempted by a single instance at a
+	// time, and it is attempted again if the instance taking it
+	// stops before telling how the attempt went
+	err := db.retry(ctx, func() error {
+		dbDeliveries = make([]DatabaseWebhookDelivery, 0)
+
+		rows, err := db.c.QueryContext(ctx, `
+			UPDATE webhook_delivery
+			SET next_attempt_at=?
+			WHERE next_attempt_at <= ?
+			AND id IN (
+				SELECT id
+				FROM webhook_delivery
+				WHERE next_attempt_at <= ?
+				ORDER BY next_attempt_at, id
+				LIMIT ?
+			)
+			RETURNING id, webhook, event, payload, date, attempts, status_code, error
+		`, lease.Unix(), now.Unix(), now.Unix(), limit)
+
+		if err != nil {
+			return err
+		}
+
+		defer rows.Close()
+
+		for rows.Next() {
+			dbDelivery := DatabaseWebhookDeliveryDefault()
+
+			err = rows.Scan(&dbDelivery.Id, &dbDelivery.Webhook, &dbDelivery.Event, &dbDelivery.Payload, unixTime{&dbDelivery.Date}, &dbDelivery.Attempts, &dbDelivery.StatusCode, &dbDelivery.Error)
+
+			if err != nil {
+				return err
+			}
+
+			next := lease.UTC().Truncate(time.Second)
+			dbDelivery.NextAttemptAt = &next
+
+			dbDeliveries = append(dbDeliveries, dbDelivery)
+		}
+
+		return rows.Err()
+	})
+
+	if err != nil {
+		return make([]DatabaseWebhookDelivery, 0), err
+	}
+
+	sort.Slice(dbDeliveries, func(i, j int) bool {
+		return dbDeliveries[i].Id < dbDeliveries[j].Id
+	})
+
+	return dbDeliveries, nil
+}
+
+func (db *appdbimpl) UpdateWebhookDelivery(ctx context.Context, dbDelivery DatabaseWebhookDelivery) error {
+	var nextAttemptAt, deliveredAt sql.NullInt64
+
+	if dbDelivery.NextAttemptAt != nil {
+		nextAttemptAt = sql.NullInt64{Int64: dbDelivery.NextAttemptAt.Unix(), Valid: true}
+	}
+
+	if dbDelivery.DeliveredAt != nil {
+		deliveredAt = sql.NullInt64{Int64: dbDelivery.DeliveredAt.Unix(), Valid: true}
+	}
+
+	// the delivery is gone if its webhook was removed
+	// meanwhile, hence no error is returned for it
+	_, err := db.c.ExecContext(ctx, `
+		UPDATE webhook_delivery
+		SET attempts=?, next_attempt_at=?, delivered_at=?, status_code=?, error=?
+		WHERE id=?
+	`, dbDelivery.Attempts, nextAttemptAt, deliveredAt, dbDelivery.StatusCode, dbDelivery.Error, dbDelivery.Id)
+
+	return err
+}
+
+func (db *appdbimpl) GetWebhookDeliveries(ctx context.Context, webhookId uint32, limit int, before uint32) (DatabaseWebhookDeliveryList, error) {
+	dbDeliveryList := DatabaseWebhookDeliveryListDefault()
+
+	// get a page of at most `limit` deliveries of the webhook,
+	// from the newest to the oldest, keeping only the ones
+	// older than the delivery `before` (if it is not 0)
+	rows, err := db.read().QueryContext(ctx, `
+		SELECT id, webhook, event, payload, date, attempts, next_attempt_at, delivered_at, status_code, error
+		FROM webhook_delivery
+		WHERE webhook=?
+		AND (?=0 OR id < ?)
+		ORDER BY id DESC
+		LIMIT ?
+	`, webhookId, before, before, limit)
+
+	if err != nil {
+		return dbDeliveryList, err
+	}
+
+	defer rows.Close()
+
+	// build the log
+	for rows.Next() {
+		dbDelivery := DatabaseWebhookDeliveryDefault()
+
+		var nextAttemptAt, deliveredAt sql.NullInt64
+
+		err = rows.Scan(&dbDelivery.Id, &dbDelivery.Webhook, &dbDelivery.Event, &dbDelivery.Payload, unixTime{&dbDelivery.Date}, &dbDelivery.Attempts, &nextAttemptAt, &deliveredAt, &dbDelivery.StatusCode, &dbDelivery.Error)
+
+		if err != nil {
+			return dbDeliveryList, err
+		}
+
+		if nextAttemptAt.Valid {
+			date := time.Unix(nextAttemptAt.Int64, 0).UTC()
+			dbDelivery.NextAttemptAt = &date
+		}
+
+		if deliveredAt.Valid {
+			date := time.Unix(deliveredAt.Int64, 0).UTC()
+			dbDelivery.DeliveredAt = &date
+		}
+
+		dbDeliveryList.Deliveries = append(dbDeliveryList.Deliveries, dbDelivery)
+	}
+
+	return dbDeliveryList, rows.Err()
+}
+
+func (db *appdbimpl) DeleteOldWebhookDeliveries(ctx context.Context, before time.Time) (int, error) {
+	// remove the deliveries of the events which happened before
+	// `before` and are not going to be attempted again
+	res, err := db.c.ExecContext(ctx, `
+		DELETE FROM webhook_delivery
+		WHERE date < ?
+		AND next_attempt_at IS NULL
+	`, before.Unix())
+
+	if err != nil {
+		return 0, err
+	}
+
+	aff, err := res.RowsAffected()
+
+	return int(aff), err
+}
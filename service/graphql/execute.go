@@ -0,0 +1,801 @@
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+)
+
+// maxFields is the highest number of fields a request may select, counting the fields of the fragments each time they
+// are spread; as every field is resolved once for all of its objects, this bounds the number of the resolutions of a
+// request, even if it repeats a field under many aliases
+const maxFields = 500
+
+// Result is an object of the data of a response, keeping its fields in the order they were selected
+type Result struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+func newResult() *Result {
+	return &Result{values: make(map[string]interface{})}
+}
+
+func (r *Result) set(key string, value interface{}) {
+	if _, ok := r.values[key]; !ok {
+		r.keys = append(r.keys, key)
+	}
+
+	r.values[key] = value
+}
+
+// Get returns the value of a field of the result, which is a *Result, a []interface{}, a scalar or nil
+func (r *Result) Get(key string) (interface{}, bool) {
+	value, ok := r.values[key]
+
+	return value, ok
+}
+
+func (r *Result) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+
+	b.WriteByte('{')
+
+	for i, key := range r.keys {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+
+		k, _ := json.Marshal(key)
+		b.Write(k)
+		b.WriteByte(':')
+
+		v, err := json.Marshal(r.values[key])
+
+		if err != nil {
+			return nil, err
+		}
+
+		b.Write(v)
+	}
+
+	b.WriteByte('}')
+
+	return b.Bytes(), nil
+}
+
+// path is the path of a value in the data of a response, made of the keys of the fields and of the indexes of the
+// elements of the lists
+type path []interface{}
+
+func (p path) with(key interface{}) path {
+	q := make(path, len(p)+1)
+	copy(q, p)
+	q[len(p)] = key
+
+	return q
+}
+
+// executor executes an operation of a document, collecting its errors
+type executor struct {
+	schema *Schema
+	doc    *Document
+
+	// the variables of the operation, as declared and coerced
+	definitions map[string]*VariableDefinition
+	variables   map[string]interface{}
+
+	// the arguments of each field and whether each selection is included, as
+	// coerced by the validation, which the execution relies upon
+	args     map[*Field]map[string]interface{}
+	included map[*Selection]bool
+	fields   int
+
+	errors []*Error
+}
+
+// Execute executes the operation of the request named OperationName, or its only operation, returning the response
+// holding its data and its errors. The request is validated beforehand, and it is not executed at all if invalid.
+func (s *Schema) Execute(ctx context.Context, req Request) Response {
+	doc, err := Parse(req.Query)
+
+	if err != nil {
+		var syntaxErr *SyntaxError
+
+		if errors.As(err, &syntaxErr) {
+			return Response{Errors: []*Error{{Message: syntaxErr.Message, Locations: []Location{{syntaxErr.Line, syntaxErr.Column}}}}}
+		}
+
+		return Response{Errors: []*Error{{Message: err.Error()}}}
+	}
+
+	op, err := operation(doc, req.OperationName)
+
+	if err != nil {
+		return Response{Errors: []*Error{{Message: err.Error()}}}
+	}
+
+	root := s.query
+
+	switch op.Type {
+	case "mutation":
+		root = s.mutation
+	case "subscription":
+		root = nil
+	}
+
+	if root == nil {
+		return Response{Errors: []*Error{{Message: "the schema does not support the " + op.Type + " operations"}}}
+	}
+
+	e := &executor{
+		schema:      s,
+		doc:         doc,
+		definitions: make(map[string]*VariableDefinition),
+		variables:   make(map[string]interface{}),
+		args:        make(map[*Field]map[string]interface{}),
+		included:    make(map[*Selection]bool),
+	}
+
+	e.coerceVariables(op, req.Variables)
+
+	if len(e.errors) == 0 {
+		e.validate(root, op.SelectionSet, make(map[string]bool))
+	}
+
+	if len(e.errors) == 0 && e.fields > maxFields {
+		e.errors = append(e.errors, &Error{Message: ErrTooManyFields.Error()})
+	}
+
+	if len(e.errors) > 0 {
+		return Response{Errors: e.errors}
+	}
+
+	// the fields of the mutations are executed one after the
+	// other, as the fields of every object are executed
+	data := e.selectionSet(ctx, root, []interface{}{nil}, []path{nil}, op.SelectionSet)
+
+	return Response{Data: data[0], Errors: e.errors, executed: true}
+}
+
+// operation returns the operation of the document to be executed
+func operation(doc *Document, name string) (*Operation, error) {
+	if name == "" {
+		if len(doc.Operations) > 1 {
+			return nil, errors.New("the operation to be executed must be named, as the document has more than one")
+		}
+
+		return doc.Operations[0], nil
+	}
+
+	for _, op := range doc.Operations {
+		if op.Name == name {
+			return op, nil
+		}
+	}
+
+	return nil, fmt.Errorf("the document has no operation named %s", name)
+}
+
+func (e *executor) fail(message string, field *Field, p path) {
+	err := &Error{Message: message}
+
+	if field != nil {
+		err.Locations = []Location{{field.Line, field.Column}}
+	}
+
+	if len(p) > 0 {
+		err.Path = p
+	}
+
+	e.errors = append(e.errors, err)
+}
+
+func (e *executor) coerceVariables(op *Operation, values map[string]interface{}) {
+	for _, definition := range op.Variables {
+		if e.definitions[definition.Name] != nil {
+			e.fail("there can be only one variable named $"+definition.Name, nil, nil)
+			continue
+		}
+
+		e.definitions[definition.Name] = definition
+
+		if !scalars[namedType(definition.Type)] {
+			e.fail("the variable $"+definition.Name+" is not of a scalar type", nil, nil)
+			continue
+		}
+
+		value, provided := values[definition.Name]
+
+		if !provided && definition.Default != nil {
+			value, provided = definition.Default, true
+		}
+
+		if !provided {
+			if definition.Type.NonNull {
+				e.fail("the variable $"+definition.Name+" of the required type "+definition.Type.String()+" was not provided", nil, nil)
+			}
+
+			continue
+		}
+
+		coerced, err := e.coerce(definition.Type, value)
+
+		if err != nil {
+			e.fail("the variable $"+definition.Name+" got an invalid value: "+err.Error(), nil, nil)
+			continue
+		}
+
+		e.variables[definition.Name] = coerced
+	}
+}
+
+// coerce coerces an input value, written in the document or given as a variable, to the type
+func (e *executor) coerce(t *TypeRef, value interface{}) (interface{}, error) {
+	if name, ok := value.(Variable); ok {
+		definition := e.definitions[string(name)]
+
+		if definition == nil {
+			return nil, fmt.Errorf("the variable $%s is not defined", name)
+		}
+
+		if namedType(definition.Type) != namedType(t) || listDepth(definition.Type) != listDepth(t) {
+			return nil, fmt.Errorf("the variable $%s of type %s cannot be used as %s", name, definition.Type, t)
+		}
+
+		value = e.variables[string(name)]
+
+		if value == nil && t.NonNull {
+			return nil, fmt.Errorf("the variable $%s is null, while %s is expected", name, t)
+		}
+
+		return value, nil
+	}
+
+	if value == nil {
+		if t.NonNull {
+			return nil, fmt.Errorf("null is not a valid %s", t)
+		}
+
+		return nil, nil
+	}
+
+	if t.Elem != nil {
+		list, ok := value.([]interface{})
+
+		// a single value stands for a list of one value
+		if !ok {
+			list = []interface{}{value}
+		}
+
+		coerced := make([]interface{}, len(list))
+
+		for i, item := range list {
+			var err error
+
+			coerced[i], err = e.coerce(t.Elem, item)
+
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		return coerced, nil
+	}
+
+	return coerceScalar(t.Name, value)
+}
+
+func listDepth(t *TypeRef) int {
+	depth := 0
+
+	for ; t.Elem != nil; t = t.Elem {
+		depth++
+	}
+
+	return depth
+}
+
+// coerceScalar coerces an input value to the scalar; the integers are written in the documents as int64 and given in
+// the variables as float64, as decoded from JSON
+func coerceScalar(name string, value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case int64:
+		switch name {
+		case "Int":
+			if v >= math.MinInt32 && v <= math.MaxInt32 {
+				return int(v), nil
+			}
+		case "Float":
+			return float64(v), nil
+		case "ID":
+			return strconv.FormatInt(v, 10), nil
+		}
+	case float64:
+		switch name {
+		case "Int":
+			if v == math.Trunc(v) && v >= math.MinInt32 && v <= math.MaxInt32 {
+				return int(v), nil
+			}
+		case "Float":
+			return v, nil
+		case "ID":
+			if v == math.Trunc(v) && math.Abs(v) < 1<<53 {
+				return strconv.FormatInt(int64(v), 10), nil
+			}
+		}
+	case string:
+		if name == "String" || name == "ID" {
+			return v, nil
+		}
+	case bool:
+		if name == "Boolean" {
+			return v, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%v is not a valid %s", value, name)
+}
+
+// validate checks the selections against the object type, coercing the arguments of their fields and telling whether
+// each one is included, as the execution expects
+func (e *executor) validate(object *Object, selections []*Selection, spread map[string]bool) {
+	keys := make(map[string]*Field)
+
+	e.validateSelections(object, selections, spread, keys)
+}
+
+func (e *executor) validateSelections(object *Object, selections []*Selection, spread map[string]bool, keys map[string]*Field) {
+	for _, selection := range selections {
+		e.included[selection] = e.validateDirectives(selection)
+
+		switch {
+		case selection.Field != nil:
+			e.validateField(object, selection.Field, keys)
+		case selection.FragmentName != "":
+			fragment := e.doc.Fragments[selection.FragmentName]
+
+			if fragment == nil {
+				e.fail("the fragment "+selection.FragmentName+" is not defined", nil, nil)
+				continue
+			}
+
+			if spread[fragment.Name] {
+				e.fail("the fragment "+fragment.Name+" spreads itself", nil, nil)
+				continue
+			}
+
+			if fragment.TypeCondition != object.Name {
+				e.fail("the fragment "+fragment.Name+" on "+fragment.TypeCondition+" cannot be spread on "+object.Name, nil, nil)
+				continue
+			}
+
+			spread[fragment.Name] = true
+			e.validateSelections(object, fragment.SelectionSet, spread, keys)
+			delete(spread, fragment.Name)
+		default:
+			if selection.TypeCondition != "" && selection.TypeCondition != object.Name {
+				e.fail("an inline fragment on "+selection.TypeCondition+" cannot be spread on "+object.Name, nil, nil)
+				continue
+			}
+
+			e.validateSelections(object, selection.SelectionSet, spread, keys)
+		}
+	}
+}
+
+// validateDirectives checks the directives of the selection, telling whether it is included
+func (e *executor) validateDirectives(selection *Selection) bool {
+	included := true
+
+	for _, directive := range selection.Directives {
+		if directive.Name != "skip" && directive.Name != "include" {
+			e.fail("the directive @"+directive.Name+" is not supported", nil, nil)
+			continue
+		}
+
+		cond, ok := directive.Arguments["if"]
+
+		if !ok || len(directive.Arguments) != 1 {
+			e.fail("the directive @"+directive.Name+" takes only the argument if", nil, nil)
+			continue
+		}
+
+		value, err := e.coerce(&TypeRef{Name: "Boolean", NonNull: true}, cond)
+
+		if err != nil {
+			e.fail("the argument if of @"+directive.Name+": "+err.Error(), nil, nil)
+			continue
+		}
+
+		if value.(bool) == (directive.Name == "skip") {
+			included = false
+		}
+	}
+
+	return included
+}
+
+func (e *executor) validateField(object *Object, field *Field, keys map[string]*Field) {
+	e.fields++
+
+	// the fields under the same key must be the same
+	if other := keys[field.ResponseKey()]; other != nil && (other.Name != field.Name || !reflect.DeepEqual(other.Arguments, field.Arguments)) {
+		e.fail("the fields under the key "+field.ResponseKey()+" differ", field, nil)
+		return
+	}
+
+	keys[field.ResponseKey()] = field
+
+	if field.Name == "__typename" {
+		if len(field.Arguments) > 0 || field.SelectionSet != nil {
+			e.fail("the field __typename has no arguments and no fields", field, nil)
+		}
+
+		return
+	}
+
+	definition := object.fields[field.Name]
+
+	if definition == nil {
+		e.fail("the type "+object.Name+" has no field "+field.Name, field, nil)
+		return
+	}
+
+	// coerce the arguments
+	args := make(map[string]interface{})
+
+	for name, value := range field.Arguments {
+		t := definition.args[name]
+
+		if t == nil {
+			e.fail("the field "+object.Name+"."+field.Name+" has no argument "+name, field, nil)
+			continue
+		}
+
+		coerced, err := e.coerce(t, value)
+
+		if err != nil {
+			e.fail("the argument "+name+" of "+object.Name+"."+field.Name+": "+err.Error(), field, nil)
+			continue
+		}
+
+		// the variables which were not provided
+		// leave their arguments out
+		if variable, ok := value.(Variable); ok {
+			if _, provided := e.variables[string(variable)]; !provided {
+				continue
+			}
+		}
+
+		args[name] = coerced
+	}
+
+	for _, arg := range definition.Args {
+		if _, ok := args[arg.Name]; !ok && definition.args[arg.Name].NonNull {
+			e.fail("the argument "+arg.Name+" of "+object.Name+"."+field.Name+" is required", field, nil)
+		}
+	}
+
+	e.args[field] = args
+
+	// the objects are selected
+	// fields, the scalars are not
+	fieldObject := e.schema.types[namedType(definition.typ)]
+
+	switch {
+	case fieldObject == nil && field.SelectionSet != nil:
+		e.fail("the field "+object.Name+"."+field.Name+" is a scalar, and has no fields", field, nil)
+	case fieldObject != nil && field.SelectionSet == nil:
+		e.fail("the field "+object.Name+"."+field.Name+" is an object, whose fields must be selected", field, nil)
+	case fieldObject != nil:
+		// the selections of the fields merged under the same
+		// key are checked together by the execution
+		e.validate(fieldObject, field.SelectionSet, make(map[string]bool))
+	}
+}
+
+// collected are the fields selected under the same key
+type collected struct {
+	key    string
+	fields []*Field
+}
+
+// collect gathers the fields of the selections included, under their keys in the order they are selected
+func (e *executor) collect(selections []*Selection, fields []*collected, spread map[string]bool) []*collected {
+	for _, selection := range selections {
+		if !e.included[selection] {
+			continue
+		}
+
+		switch {
+		case selection.Field != nil:
+			key := selection.Field.ResponseKey()
+			found := false
+
+			for _, c := range fields {
+				if c.key == key {
+					c.fields = append(c.fields, selection.Field)
+					found = true
+				}
+			}
+
+			if !found {
+				fields = append(fields, &collected{key: key, fields: []*Field{selection.Field}})
+			}
+		case selection.FragmentName != "":
+			if spread[selection.FragmentName] {
+				continue
+			}
+
+			spread[selection.FragmentName] = true
+			fields = e.collect(e.doc.Fragments[selection.FragmentName].SelectionSet, fields, spread)
+		default:
+			fields = e.collect(selection.SelectionSet, fields, spread)
+		}
+	}
+
+	return fields
+}
+
+// selectionSet resolves the selections on every parent of the object type at once, returning the result of each
+// parent, or nil for the parents whose result is null since one of their non-null fields is
+func (e *executor) selectionSet(ctx context.Context, object *Object, parents []interface{}, paths []path, selections []*Selection) []*Result {
+	results := make([]*Result, len(parents))
+
+	for i := range results {
+		results[i] = newResult()
+	}
+
+	for _, c := range e.collect(selections, nil, make(map[string]bool)) {
+		field := c.fields[0]
+
+		// the parents whose result is not null yet
+		live := make([]int, 0, len(parents))
+
+		for i := range parents {
+			if results[i] != nil {
+				live = append(live, i)
+			}
+		}
+
+		if len(live) == 0 {
+			break
+		}
+
+		if field.Name == "__typename" {
+			for _, i := range live {
+				results[i].set(c.key, object.Name)
+			}
+
+			continue
+		}
+
+		definition := object.fields[field.Name]
+
+		liveParents := make([]interface{}, len(live))
+		livePaths := make([]path, len(live))
+
+		for j, i := range live {
+			liveParents[j] = parents[i]
+			livePaths[j] = paths[i].with(c.key)
+		}
+
+		values, err := definition.Resolve(ctx, liveParents, e.args[field])
+
+		if err == nil && len(values) != len(liveParents) {
+			err = fmt.Errorf("the field %s.%s was resolved for %d objects out of %d", object.Name, field.Name, len(values), len(liveParents))
+		}
+
+		// the error fails the field for every parent
+		if err != nil {
+			values = make([]interface{}, len(liveParents))
+
+			for j := range values {
+				values[j] = err
+			}
+		}
+
+		// the fields selected on the value are
+		// the ones of every field merged
+		var subselections []*Selection
+
+		for _, f := range c.fields {
+			subselections = append(subselections, f.SelectionSet...)
+		}
+
+		completed, failed := e.complete(ctx, definition.typ, values, livePaths, field, subselections)
+
+		for j, i := range live {
+			if failed[j] && definition.typ.NonNull {
+				results[i] = nil
+			} else {
+				results[i].set(c.key, completed[j])
+			}
+		}
+	}
+
+	return results
+}
+
+// complete completes the values of a field resolved for some parents into the values of the response, resolving the
+// fields selected on the objects. A value is failed if it is null because of an error, which makes the parent null
+// in turn if the field is non-null.
+func (e *executor) complete(ctx context.Context, t *TypeRef, values []interface{}, paths []path, field *Field, selections []*Selection) ([]interface{}, []bool) {
+	completed := make([]interface{}, len(values))
+	failed := make([]bool, len(values))
+
+	if t.NonNull {
+		nullable := *t
+		nullable.NonNull = false
+
+		completed, failed = e.complete(ctx, &nullable, values, paths, field, selections)
+
+		for i := range completed {
+			if completed[i] == nil && !failed[i] {
+				e.fail("the non-null field "+field.Name+" resolved to null", field, paths[i])
+				failed[i] = true
+			}
+		}
+
+		return completed, failed
+	}
+
+	// the values which are neither null nor errors
+	present := make([]int, 0, len(values))
+
+	for i, value := range values {
+		if err, ok := value.(error); ok {
+			message := err.Error()
+			e.fail(message, field, paths[i])
+
+			var coded CodedError
+
+			if errors.As(err, &coded) {
+				e.errors[len(e.errors)-1].Extensions = map[string]interface{}{"code": coded.Code()}
+			}
+
+			failed[i] = true
+		} else if value != nil && !isNilPointer(value) {
+			present = append(present, i)
+		}
+	}
+
+	switch {
+	case t.Elem != nil:
+		e.completeLists(ctx, t, values, paths, field, selections, present, completed, failed)
+	case scalars[t.Name]:
+		for _, i := range present {
+			value, err := serialize(t.Name, values[i])
+
+			if err != nil {
+				e.fail(err.Error(), field, paths[i])
+				failed[i] = true
+				continue
+			}
+
+			completed[i] = value
+		}
+	default:
+		objects := make([]interface{}, len(present))
+		objectPaths := make([]path, len(present))
+
+		for j, i := range present {
+			objects[j] = values[i]
+			objectPaths[j] = paths[i]
+		}
+
+		// the objects of every parent are resolved at once
+		results := e.selectionSet(ctx, e.schema.types[t.Name], objects, objectPaths, selections)
+
+		for j, i := range present {
+			if results[j] == nil {
+				failed[i] = true
+			} else {
+				completed[i] = results[j]
+			}
+		}
+	}
+
+	return completed, failed
+}
+
+// completeLists completes the lists among the values, resolving the elements of every list at once
+func (e *executor) completeLists(ctx context.Context, t *TypeRef, values []interface{}, paths []path, field *Field, selections []*Selection, present []int, completed []interface{}, failed []bool) {
+	var elements []interface{}
+	var elementPaths []path
+
+	// the list each element belongs to
+	var owners []int
+
+	for _, i := range present {
+		list := reflect.ValueOf(values[i])
+
+		if list.Kind() != reflect.Slice && list.Kind() != reflect.Array {
+			e.fail(fmt.Sprintf("the field %s resolved to %T instead of a list", field.Name, values[i]), field, paths[i])
+			failed[i] = true
+			continue
+		}
+
+		completed[i] = make([]interface{}, 0, list.Len())
+
+		for j := 0; j < list.Len(); j++ {
+			elements = append(elements, list.Index(j).Interface())
+			elementPaths = append(elementPaths, paths[i].with(j))
+			owners = append(owners, i)
+		}
+	}
+
+	completedElements, failedElements := e.complete(ctx, t.Elem, elements, elementPaths, field, selections)
+
+	for j, i := range owners {
+		if failed[i] {
+			continue
+		}
+
+		// a null element which cannot be null makes its list null
+		if failedElements[j] && t.Elem.NonNull {
+			completed[i] = nil
+			failed[i] = true
+			continue
+		}
+
+		completed[i] = append(completed[i].([]interface{}), completedElements[j])
+	}
+}
+
+func isNilPointer(value interface{}) bool {
+	v := reflect.ValueOf(value)
+
+	return v.Kind() == reflect.Ptr && v.IsNil()
+}
+
+// serialize returns the value of a scalar as written in the response
+func serialize(name string, value interface{}) (interface{}, error) {
+	v := reflect.ValueOf(value)
+
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+
+	switch name {
+	case "ID":
+		switch v.Kind() {
+		case reflect.String:
+			return v.String(), nil
+		case reflect.Int, reflect.Int32, reflect.Int64:
+			return strconv.FormatInt(v.Int(), 10), nil
+		case reflect.Uint, reflect.Uint32, reflect.Uint64:
+			return strconv.FormatUint(v.Uint(), 10), nil
+		}
+	case "Int":
+		switch v.Kind() {
+		case reflect.Int, reflect.Int32, reflect.Int64:
+			return v.Int(), nil
+		case reflect.Uint, reflect.Uint32, reflect.Uint64:
+			return v.Uint(), nil
+		}
+	case "Float":
+		switch v.Kind() {
+		case reflect.Float32, reflect.Float64:
+			return v.Float(), nil
+		case reflect.Int, reflect.Int32, reflect.Int64:
+			return float64(v.Int()), nil
+		}
+	case "String":
+		if v.Kind() == reflect.String {
+			return v.String(), nil
+		}
+	case "Boolean":
+		if v.Kind() == reflect.Bool {
+			return v.Bool(), nil
+		}
+	}
+
+	return nil, fmt.Errorf("the value of type %T is not a valid %s", value, name)
+}
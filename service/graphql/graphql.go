@@ -0,0 +1,292 @@
+/*
+Package graphql serves GraphQL requests against a schema whose fields are resolved in batches. The fields of the same
+selection are resolved at once for every object of a list, so that a resolver loads what it needs for all of them
+with a single query, instead of a query per object (the way a dataloader would):
+
+	photo := &graphql.Object{
+		Name: "Photo",
+		Fields: []*graphql.FieldDef{
+			{Name: "id", Type: "ID!", Resolve: graphql.Each(photoId)},
+			{Name: "comments", Type: "[Comment!]!", Args: []graphql.ArgDef{{Name: "limit", Type: "Int"}}, Resolve: photoComments},
+		},
+	}
+
+	schema, err := graphql.NewSchema(query, mutation, photo, comment)
+	if err != nil {
+		return fmt.Errorf("building the GraphQL schema: %w", err)
+	}
+
+	resp := schema.Execute(ctx, graphql.Request{Query: `{ stream { id comments(limit: 3) { body } } }`})
+
+The operations, the fragments, the variables and the @skip and @include directives are supported; the schemas are made
+of objects and of the built-in scalars only, and they are not introspected: their definition, in the schema definition
+language, is returned by Schema.String instead.
+
+See the `graphql.go` file inside the `service/api` for a full usage example.
+*/
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Resolver resolves a field for a batch of parent objects, returning its value for each of them in the same order. A
+// value may be an error, failing the field of its parent only, while an error returned fails the field of all of
+// them. The arguments are coerced to int, float64, string (for both String and ID), bool and []interface{}; the ones
+// not given are missing from `args`.
+type Resolver func(ctx context.Context, parents []interface{}, args map[string]interface{}) ([]interface{}, error)
+
+// Each returns a Resolver resolving the field for each parent in turn, for the fields which are not worth batching
+func Each(resolve func(ctx context.Context, parent interface{}, args map[string]interface{}) (interface{}, error)) Resolver {
+	return func(ctx context.Context, parents []interface{}, args map[string]interface{}) ([]interface{}, error) {
+		values := make([]interface{}, len(parents))
+
+		for i, parent := range parents {
+			value, err := resolve(ctx, parent, args)
+
+			if err != nil {
+				values[i] = err
+			} else {
+				values[i] = value
+			}
+		}
+
+		return values, nil
+	}
+}
+
+// Object is an object type of the schema
+type Object struct {
+	Name        string
+	Description string
+	Fields      []*FieldDef
+
+	fields map[string]*FieldDef
+}
+
+// FieldDef defines a field of an object type, with the type of its value written as in the documents (eg. [Photo!]!)
+type FieldDef struct {
+	Name        string
+	Description string
+	Type        string
+	Args        []ArgDef
+	Resolve     Resolver
+
+	typ  *TypeRef
+	args map[string]*TypeRef
+}
+
+// ArgDef defines an argument of a field, whose type is a built-in scalar or a list of them
+type ArgDef struct {
+	Name string
+	Type string
+}
+
+// the built-in scalars
+var scalars = map[string]bool{"Int": true, "Float": true, "String": true, "Boolean": true, "ID": true}
+
+// Schema is the schema the requests are served against
+type Schema struct {
+	query    *Object
+	mutation *Object
+	types    map[string]*Object
+}
+
+// NewSchema builds the schema whose root types are `query` and `mutation` (which may be nil), together with the
+// object types they lead to, checking that every type used is defined
+func NewSchema(query *Object, mutation *Object, types ...*Object) (*Schema, error) {
+	schema := &Schema{query: query, mutation: mutation, types: make(map[string]*Object)}
+
+	all := append([]*Object{query}, types...)
+
+	if mutation != nil {
+		all = append(all, mutation)
+	}
+
+	for _, object := range all {
+		if schema.types[object.Name] != nil || scalars[object.Name] {
+			return nil, fmt.Errorf("the type %s is defined twice", object.Name)
+		}
+
+		schema.types[object.Name] = object
+	}
+
+	for _, object := range all {
+		object.fields = make(map[string]*FieldDef)
+
+		for _, field := range object.Fields {
+			if object.fields[field.Name] != nil || strings.HasPrefix(field.Name, "__") {
+				return nil, fmt.Errorf("the field %s.%s is defined twice or reserved", object.Name, field.Name)
+			}
+
+			object.fields[field.Name] = field
+
+			var err error
+
+			field.typ, err = ParseType(field.Type)
+
+			if err != nil {
+				return nil, fmt.Errorf("the type of %s.%s: %w", object.Name, field.Name, err)
+			}
+
+			if !scalars[namedType(field.typ)] && schema.types[namedType(field.typ)] == nil {
+				return nil, fmt.Errorf("the type of %s.%s is not defined", object.Name, field.Name)
+			}
+
+			field.args = make(map[string]*TypeRef)
+
+			for _, arg := range field.Args {
+				field.args[arg.Name], err = ParseType(arg.Type)
+
+				if err != nil {
+					return nil, fmt.Errorf("the type of the argument %s of %s.%s: %w", arg.Name, object.Name, field.Name, err)
+				}
+
+				if !scalars[namedType(field.args[arg.Name])] {
+					return nil, fmt.Errorf("the argument %s of %s.%s is not a scalar", arg.Name, object.Name, field.Name)
+				}
+			}
+
+			if field.Resolve == nil {
+				return nil, fmt.Errorf("the field %s.%s has no resolver", object.Name, field.Name)
+			}
+		}
+	}
+
+	return schema, nil
+}
+
+// namedType returns the name of the type, or of the type of its elements if it is a list
+func namedType(t *TypeRef) string {
+	for t.Elem != nil {
+		t = t.Elem
+	}
+
+	return t.Name
+}
+
+// String returns the definition of the schema in the schema definition language, for the clients generating their
+// types from it
+func (s *Schema) String() string {
+	var b strings.Builder
+
+	b.WriteString("schema {\n  query: " + s.query.Name + "\n")
+
+	if s.mutation != nil {
+		b.WriteString("  mutation: " + s.mutation.Name + "\n")
+	}
+
+	b.WriteString("}\n")
+
+	names := make([]string, 0, len(s.types))
+
+	for name := range s.types {
+		if name != s.query.Name && (s.mutation == nil || name != s.mutation.Name) {
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+
+	objects := []*Object{s.query}
+
+	if s.mutation != nil {
+		objects = append(objects, s.mutation)
+	}
+
+	for _, name := range names {
+		objects = append(objects, s.types[name])
+	}
+
+	for _, object := range objects {
+		b.WriteString("\n")
+		writeDescription(&b, object.Description, "")
+		b.WriteString("type " + object.Name + " {\n")
+
+		for _, field := range object.Fields {
+			writeDescription(&b, field.Description, "  ")
+			b.WriteString("  " + field.Name)
+
+			if len(field.Args) > 0 {
+				args := make([]string, len(field.Args))
+
+				for i, arg := range field.Args {
+					args[i] = arg.Name + ": " + arg.Type
+				}
+
+				b.WriteString("(" + strings.Join(args, ", ") + ")")
+			}
+
+			b.WriteString(": " + field.Type + "\n")
+		}
+
+		b.WriteString("}\n")
+	}
+
+	return b.String()
+}
+
+func writeDescription(b *strings.Builder, description string, indent string) {
+	if description != "" {
+		b.WriteString(indent + `"""` + strings.ReplaceAll(description, `"""`, `\"""`) + `"""` + "\n")
+	}
+}
+
+// Request is a GraphQL request, as sent in the body of a POST
+type Request struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// Error is an error of a request, telling where it happened in the document (Locations) or in the response (Path)
+type Error struct {
+	Message    string                 `json:"message"`
+	Locations  []Location             `json:"locations,omitempty"`
+	Path       []interface{}          `json:"path,omitempty"`
+	Extensions map[string]interface{} `json:"extensions,omitempty"`
+}
+
+// Location is a position in a document, from 1
+type Location struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// CodedError is an error reported with a code, in the extensions of the GraphQL error
+type CodedError interface {
+	error
+	Code() string
+}
+
+// Response is the response to a request: Data is nil if the request failed before being executed, or if its execution
+// ended in a null
+type Response struct {
+	Data   *Result
+	Errors []*Error
+
+	// executed tells whether the request was executed, and
+	// then its data is written even if null
+	executed bool
+}
+
+func (r Response) MarshalJSON() ([]byte, error) {
+	if !r.executed {
+		return json.Marshal(struct {
+			Errors []*Error `json:"errors"`
+		}{r.Errors})
+	}
+
+	return json.Marshal(struct {
+		Data   *Result  `json:"data"`
+		Errors []*Error `json:"errors,omitempty"`
+	}{r.Data, r.Errors})
+}
+
+// ErrTooManyFields is reported when a request selects more fields than a schema resolves for a request
+var ErrTooManyFields = errors.New("the request selects too many fields")
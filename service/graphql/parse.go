@@ -0,0 +1,1013 @@
+package graphql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Document is a parsed GraphQL request, with its operations and its fragments
+type Document struct {
+	Operations []*Operation
+	Fragments  map[string]*Fragment
+}
+
+// Operation is a query or a mutation of a document
+type Operation struct {
+	Type         string // "query" or "mutation"
+	Name         string
+	Variables    []*VariableDefinition
+	SelectionSet []*Selection
+}
+
+// VariableDefinition declares a variable of an operation, with its type and its default value (nil if it has none)
+type VariableDefinition struct {
+	Name    string
+	Type    *TypeRef
+	Default interface{}
+}
+
+// Fragment is a named fragment of a document
+type Fragment struct {
+	Name          string
+	TypeCondition string
+	SelectionSet  []*Selection
+}
+
+// Selection is either a field, a spread of a named fragment or an inline fragment, as told by which of Field and
+// FragmentName is set
+type Selection struct {
+	// the field selected, if the selection is a field
+	Field *Field
+
+	// the name of the fragment spread, if the selection is a fragment spread
+	FragmentName string
+
+	// the type condition (possibly empty) and the selections of an inline fragment
+	TypeCondition string
+	SelectionSet  []*Selection
+
+	Directives []*Directive
+}
+
+// Field is a field selected, together with its arguments and the fields selected on its value
+type Field struct {
+	Alias        string
+	Name         string
+	Arguments    map[string]interface{}
+	SelectionSet []*Selection
+	Line         int
+	Column       int
+}
+
+// ResponseKey is the key of the field in the response, its alias or else its name
+func (f *Field) ResponseKey() string {
+	if f.Alias != "" {
+		return f.Alias
+	}
+
+	return f.Name
+}
+
+// Directive is a directive of a selection, such as @skip(if: $cond)
+type Directive struct {
+	Name      string
+	Arguments map[string]interface{}
+}
+
+// Variable is a reference to a variable, as the value of an argument
+type Variable string
+
+// EnumValue is an enum value written in a document
+type EnumValue string
+
+// TypeRef is a type of GraphQL, such as [Photo!]!: either a named type or a list of its element type, possibly
+// non-null
+type TypeRef struct {
+	Name    string
+	Elem    *TypeRef
+	NonNull bool
+}
+
+func (t *TypeRef) String() string {
+	s := t.Name
+
+	if t.Elem != nil {
+		s = "[" + t.Elem.String() + "]"
+	}
+
+	if t.NonNull {
+		s += "!"
+	}
+
+	return s
+}
+
+// ParseType parses a type written as in the documents, such as [Photo!]!
+func ParseType(s string) (*TypeRef, error) {
+	p := &parser{lexer: lexer{src: s, line: 1, lineStart: 0}}
+
+	err := p.advance()
+
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := p.parseType()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if p.tok.kind != tokenEOF {
+		return nil, p.unexpected()
+	}
+
+	return t, nil
+}
+
+// SyntaxError is returned when a document cannot be parsed
+type SyntaxError struct {
+	Message string
+	Line    int
+	Column  int
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("syntax error at %d:%d: %s", e.Line, e.Column, e.Message)
+}
+
+// the kinds of the tokens of a document
+const (
+	tokenEOF = iota
+	tokenPunctuator
+	tokenName
+	tokenInt
+	tokenFloat
+	tokenString
+)
+
+type token struct {
+	kind   int
+	value  string
+	line   int
+	column int
+}
+
+// lexer splits a document into its tokens, skipping the whitespaces, the commas and the comments
+type lexer struct {
+	src       string
+	pos       int
+	line      int
+	lineStart int
+}
+
+func (l *lexer) errorf(format string, args ...interface{}) error {
+	return &SyntaxError{Message: fmt.Sprintf(format, args...), Line: l.line, Column: l.pos - l.lineStart + 1}
+}
+
+func (l *lexer) next() (token, error) {
+	// skip what is ignored
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+
+		switch {
+		case c == ' ' || c == '\t' || c == ',' || c == '\r':
+			l.pos++
+		case c == '\n':
+			l.pos++
+			l.line, l.lineStart = l.line+1, l.pos
+		case c == '#':
+			for l.pos < len(l.src) && l.src[l.pos] != '\n' {
+				l.pos++
+			}
+		case strings.HasPrefix(l.src[l.pos:], "\ufeff"):
+			l.pos += len("\ufeff")
+		default:
+			return l.token()
+		}
+	}
+
+	return token{kind: tokenEOF, line: l.line, column: l.pos - l.lineStart + 1}, nil
+}
+
+func (l *lexer) token() (token, error) {
+	start := l.pos
+	tok := token{line: l.line, column: l.pos - l.lineStart + 1}
+	c := l.src[l.pos]
+
+	switch {
+	case strings.HasPrefix(l.src[l.pos:], "..."):
+		l.pos += 3
+		tok.kind, tok.value = tokenPunctuator, "..."
+	case strings.IndexByte("!$&()[]{}:=@|", c) >= 0:
+		l.pos++
+		tok.kind, tok.value = tokenPunctuator, string(c)
+	case c == '_' || isLetter(c):
+		for l.pos < len(l.src) && (l.src[l.pos] == '_' || isLetter(l.src[l.pos]) || isDigit(l.src[l.pos])) {
+			l.pos++
+		}
+
+		tok.kind, tok.value = tokenName, l.src[start:l.pos]
+	case c == '-' || isDigit(c):
+		return l.number(tok)
+	case strings.HasPrefix(l.src[l.pos:], `"""`):
+		return l.blockString(tok)
+	case c == '"':
+		return l.string(tok)
+	default:
+		r, _ := utf8.DecodeRuneInString(l.src[l.pos:])
+		return tok, l.errorf("unexpected character %q", r)
+	}
+
+	return tok, nil
+}
+
+func (l *lexer) number(tok token) (token, error) {
+	start := l.pos
+	tok.kind = tokenInt
+
+	if l.src[l.pos] == '-' {
+		l.pos++
+	}
+
+	digits := func() int {
+		n := 0
+
+		for l.pos < len(l.src) && isDigit(l.src[l.pos]) {
+			l.pos++
+			n++
+		}
+
+		return n
+	}
+
+	if digits() == 0 {
+		return tok, l.errorf("invalid number")
+	}
+
+	if l.pos < len(l.src) && l.src[l.pos] == '.' {
+		l.pos++
+		tok.kind = tokenFloat
+
+		if digits() == 0 {
+			return tok, l.errorf("invalid number")
+		}
+	}
+
+	if l.pos < len(l.src) && (l.src[l.pos] == 'e' || l.src[l.pos] == 'E') {
+		l.pos++
+		tok.kind = tokenFloat
+
+		if l.pos < len(l.src) && (l.src[l.pos] == '+' || l.src[l.pos] == '-') {
+			l.pos++
+		}
+
+		if digits() == 0 {
+			return tok, l.errorf("invalid number")
+		}
+	}
+
+	// a number cannot be followed by a name
+	if l.pos < len(l.src) && (l.src[l.pos] == '_' || l.src[l.pos] == '.' || isLetter(l.src[l.pos])) {
+		return tok, l.errorf("invalid number")
+	}
+
+	tok.value = l.src[start:l.pos]
+
+	return tok, nil
+}
+
+func (l *lexer) string(tok token) (token, error) {
+	var b strings.Builder
+
+	tok.kind = tokenString
+	l.pos++
+
+	for {
+		if l.pos >= len(l.src) || l.src[l.pos] == '\n' {
+			return tok, l.errorf("unterminated string")
+		}
+
+		c := l.src[l.pos]
+
+		switch {
+		case c == '"':
+			l.pos++
+			tok.value = b.String()
+
+			return tok, nil
+		case c == '\\':
+			if l.pos+1 >= len(l.src) {
+				return tok, l.errorf("unterminated string")
+			}
+
+			escape := l.src[l.pos+1]
+			l.pos += 2
+
+			switch escape {
+			case '"', '\\', '/':
+				b.WriteByte(escape)
+			case 'b':
+				b.WriteByte('\b')
+			case 'f':
+				b.WriteByte('\f')
+			case 'n':
+				b.WriteByte('\n')
+			case 'r':
+				b.WriteByte('\r')
+			case 't':
+				b.WriteByte('\t')
+			case 'u':
+				if l.pos+4 > len(l.src) {
+					return tok, l.errorf("invalid unicode escape")
+				}
+
+				code, err := strconv.ParseUint(l.src[l.pos:l.pos+4], 16, 32)
+
+				if err != nil {
+					return tok, l.errorf("invalid unicode escape")
+				}
+
+				l.pos += 4
+				b.WriteRune(rune(code))
+			default:
+				return tok, l.errorf("invalid escape \\%c", escape)
+			}
+		default:
+			b.WriteByte(c)
+			l.pos++
+		}
+	}
+}
+
+// blockString reads a block string, which holds its text as it is; the indentation common to its lines is removed,
+// together with its leading and trailing blank lines
+func (l *lexer) blockString(tok token) (token, error) {
+	tok.kind = tokenString
+	l.pos += 3
+
+	end := strings.Index(strings.ReplaceAll(l.src[l.pos:], `\"""`, "xxxx"), `"""`)
+
+	if end < 0 {
+		return tok, l.errorf("unterminated string")
+	}
+
+	raw := strings.ReplaceAll(l.src[l.pos:l.pos+end], `\"""`, `"""`)
+
+	for _, c := range l.src[l.pos : l.pos+end] {
+		if c == '\n' {
+			l.line++
+		}
+	}
+
+	l.pos += end + 3
+
+	if i := strings.LastIndexByte(l.src[:l.pos], '\n'); i >= 0 {
+		l.lineStart = i + 1
+	}
+
+	lines := strings.Split(strings.ReplaceAll(raw, "\r\n", "\n"), "\n")
+
+	// the common indentation, leaving out the first line
+	indent := -1
+
+	for _, line := range lines[1:] {
+		trimmed := strings.TrimLeft(line, " \t")
+
+		if trimmed != "" && (indent < 0 || len(line)-len(trimmed) < indent) {
+			indent = len(line) - len(trimmed)
+		}
+	}
+
+	if indent > 0 {
+		for i := 1; i < len(lines); i++ {
+			if len(lines[i]) >= indent {
+				lines[i] = lines[i][indent:]
+			} else {
+				lines[i] = strings.TrimLeft(lines[i], " \t")
+			}
+		}
+	}
+
+	for len(lines) > 0 && strings.TrimLeft(lines[0], " \t") == "" {
+		lines = lines[1:]
+	}
+
+	for len(lines) > 0 && strings.TrimLeft(lines[len(lines)-1], " \t") == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	tok.value = strings.Join(lines, "\n")
+
+	return tok, nil
+}
+
+func isLetter(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// parser builds a Document from the tokens of its source
+type parser struct {
+	lexer lexer
+	tok   token
+}
+
+// Parse parses the source of a GraphQL request into its Document, which must define at least an operation; the type
+// system definitions are not accepted
+func Parse(src string) (*Document, error) {
+	p := &parser{lexer: lexer{src: src, line: 1}}
+
+	err := p.advance()
+
+	if err != nil {
+		return nil, err
+	}
+
+	doc := &Document{Fragments: make(map[string]*Fragment)}
+
+	for p.tok.kind != tokenEOF {
+		switch {
+		case p.peek(tokenPunctuator, "{"), p.peek(tokenName, "query"), p.peek(tokenName, "mutation"), p.peek(tokenName, "subscription"):
+			op, err := p.parseOperation()
+
+			if err != nil {
+				return nil, err
+			}
+
+			doc.Operations = append(doc.Operations, op)
+		case p.peek(tokenName, "fragment"):
+			tok := p.tok
+			frag, err := p.parseFragment()
+
+			if err != nil {
+				return nil, err
+			}
+
+			if doc.Fragments[frag.Name] != nil {
+				return nil, &SyntaxError{Message: "there can be only one fragment named " + frag.Name, Line: tok.line, Column: tok.column}
+			}
+
+			doc.Fragments[frag.Name] = frag
+		default:
+			return nil, p.unexpected()
+		}
+	}
+
+	if len(doc.Operations) == 0 {
+		return nil, &SyntaxError{Message: "the document has no operation", Line: p.tok.line, Column: p.tok.column}
+	}
+
+	return doc, nil
+}
+
+func (p *parser) advance() error {
+	tok, err := p.lexer.next()
+
+	if err != nil {
+		return err
+	}
+
+	p.tok = tok
+
+	return nil
+}
+
+func (p *parser) peek(kind int, value string) bool {
+	return p.tok.kind == kind && p.tok.value == value
+}
+
+func (p *parser) unexpected() error {
+	if p.tok.kind == tokenEOF {
+		return &SyntaxError{Message: "unexpected end of the document", Line: p.tok.line, Column: p.tok.column}
+	}
+
+	return &SyntaxError{Message: fmt.Sprintf("unexpected %q", p.tok.value), Line: p.tok.line, Column: p.tok.column}
+}
+
+// expect consumes the punctuator, failing if it is not the next token
+func (p *parser) expect(punctuator string) error {
+	if !p.peek(tokenPunctuator, punctuator) {
+		return p.unexpected()
+	}
+
+	return p.advance()
+}
+
+// skip consumes the punctuator if it is the next token, telling whether it was
+func (p *parser) skip(punctuator string) (bool, error) {
+	if !p.peek(tokenPunctuator, punctuator) {
+		return false, nil
+	}
+
+	return true, p.advance()
+}
+
+func (p *parser) name() (string, error) {
+	if p.tok.kind != tokenName {
+		return "", p.unexpected()
+	}
+
+	name := p.tok.value
+
+	return name, p.advance()
+}
+
+func (p *parser) parseOperation() (*Operation, error) {
+	op := &Operation{Type: "query"}
+
+	// the shorthand of a query is just its selections
+	if p.peek(tokenPunctuator, "{") {
+		var err error
+
+		op.SelectionSet, err = p.parseSelectionSet()
+
+		return op, err
+	}
+
+	op.Type = p.tok.value
+
+	err := p.advance()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if p.tok.kind == tokenName {
+		op.Name = p.tok.value
+
+		err = p.advance()
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if p.peek(tokenPunctuator, "(") {
+		op.Variables, err = p.parseVariableDefinitions()
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// the directives of the operations are not used, but accepted
+	_, err = p.parseDirectives()
+
+	if err != nil {
+		return nil, err
+	}
+
+	op.SelectionSet, err = p.parseSelectionSet()
+
+	return op, err
+}
+
+func (p *parser) parseVariableDefinitions() ([]*VariableDefinition, error) {
+	err := p.expect("(")
+
+	if err != nil {
+		return nil, err
+	}
+
+	definitions := make([]*VariableDefinition, 0)
+
+	for !p.peek(tokenPunctuator, ")") {
+		err = p.expect("$")
+
+		if err != nil {
+			return nil, err
+		}
+
+		definition := &VariableDefinition{}
+
+		definition.Name, err = p.name()
+
+		if err != nil {
+			return nil, err
+		}
+
+		err = p.expect(":")
+
+		if err != nil {
+			return nil, err
+		}
+
+		definition.Type, err = p.parseType()
+
+		if err != nil {
+			return nil, err
+		}
+
+		hasDefault, err := p.skip("=")
+
+		if err != nil {
+			return nil, err
+		}
+
+		if hasDefault {
+			definition.Default, err = p.parseValue(true)
+
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		_, err = p.parseDirectives()
+
+		if err != nil {
+			return nil, err
+		}
+
+		definitions = append(definitions, definition)
+	}
+
+	return definitions, p.advance()
+}
+
+func (p *parser) parseType() (*TypeRef, error) {
+	t := &TypeRef{}
+
+	isList, err := p.skip("[")
+
+	if err != nil {
+		return nil, err
+	}
+
+	if isList {
+		t.Elem, err = p.parseType()
+
+		if err != nil {
+			return nil, err
+		}
+
+		err = p.expect("]")
+	} else {
+		t.Name, err = p.name()
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	t.NonNull, err = p.skip("!")
+
+	return t, err
+}
+
+func (p *parser) parseFragment() (*Fragment, error) {
+	err := p.advance()
+
+	if err != nil {
+		return nil, err
+	}
+
+	frag := &Fragment{}
+
+	frag.Name, err = p.name()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if frag.Name == "on" {
+		return nil, p.unexpected()
+	}
+
+	if !p.peek(tokenName, "on") {
+		return nil, p.unexpected()
+	}
+
+	err = p.advance()
+
+	if err != nil {
+		return nil, err
+	}
+
+	frag.TypeCondition, err = p.name()
+
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = p.parseDirectives()
+
+	if err != nil {
+		return nil, err
+	}
+
+	frag.SelectionSet, err = p.parseSelectionSet()
+
+	return frag, err
+}
+
+func (p *parser) parseSelectionSet() ([]*Selection, error) {
+	err := p.expect("{")
+
+	if err != nil {
+		return nil, err
+	}
+
+	selections := make([]*Selection, 0)
+
+	for !p.peek(tokenPunctuator, "}") {
+		selection, err := p.parseSelection()
+
+		if err != nil {
+			return nil, err
+		}
+
+		selections = append(selections, selection)
+	}
+
+	if len(selections) == 0 {
+		return nil, p.unexpected()
+	}
+
+	return selections, p.advance()
+}
+
+func (p *parser) parseSelection() (*Selection, error) {
+	spread, err := p.skip("...")
+
+	if err != nil {
+		return nil, err
+	}
+
+	selection := &Selection{}
+
+	if spread {
+		// a named fragment, unless the name is the
+		// type condition of an inline fragment
+		if p.tok.kind == tokenName && p.tok.value != "on" {
+			selection.FragmentName, err = p.name()
+
+			if err != nil {
+				return nil, err
+			}
+
+			selection.Directives, err = p.parseDirectives()
+
+			return selection, err
+		}
+
+		if p.peek(tokenName, "on") {
+			err = p.advance()
+
+			if err != nil {
+				return nil, err
+			}
+
+			selection.TypeCondition, err = p.name()
+
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		selection.Directives, err = p.parseDirectives()
+
+		if err != nil {
+			return nil, err
+		}
+
+		selection.SelectionSet, err = p.parseSelectionSet()
+
+		return selection, err
+	}
+
+	field := &Field{Line: p.tok.line, Column: p.tok.column}
+
+	field.Name, err = p.name()
+
+	if err != nil {
+		return nil, err
+	}
+
+	alias, err := p.skip(":")
+
+	if err != nil {
+		return nil, err
+	}
+
+	if alias {
+		field.Alias = field.Name
+
+		field.Name, err = p.name()
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	field.Arguments, err = p.parseArguments(false)
+
+	if err != nil {
+		return nil, err
+	}
+
+	selection.Directives, err = p.parseDirectives()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if p.peek(tokenPunctuator, "{") {
+		field.SelectionSet, err = p.parseSelectionSet()
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	selection.Field = field
+
+	return selection, nil
+}
+
+func (p *parser) parseArguments(constant bool) (map[string]interface{}, error) {
+	arguments := make(map[string]interface{})
+
+	if !p.peek(tokenPunctuator, "(") {
+		return arguments, nil
+	}
+
+	err := p.advance()
+
+	if err != nil {
+		return nil, err
+	}
+
+	for !p.peek(tokenPunctuator, ")") {
+		tok := p.tok
+
+		name, err := p.name()
+
+		if err != nil {
+			return nil, err
+		}
+
+		err = p.expect(":")
+
+		if err != nil {
+			return nil, err
+		}
+
+		value, err := p.parseValue(constant)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if _, ok := arguments[name]; ok {
+			return nil, &SyntaxError{Message: "there can be only one argument named " + name, Line: tok.line, Column: tok.column}
+		}
+
+		arguments[name] = value
+	}
+
+	if len(arguments) == 0 {
+		return nil, p.unexpected()
+	}
+
+	return arguments, p.advance()
+}
+
+func (p *parser) parseDirectives() ([]*Directive, error) {
+	directives := make([]*Directive, 0)
+
+	for p.peek(tokenPunctuator, "@") {
+		err := p.advance()
+
+		if err != nil {
+			return nil, err
+		}
+
+		directive := &Directive{}
+
+		directive.Name, err = p.name()
+
+		if err != nil {
+			return nil, err
+		}
+
+		directive.Arguments, err = p.parseArguments(false)
+
+		if err != nil {
+			return nil, err
+		}
+
+		directives = append(directives, directive)
+	}
+
+	return directives, nil
+}
+
+// parseValue parses a value written in a document: a Variable (unless `constant`), an int64, a float64, a string, a
+// bool, nil, an EnumValue, a list ([]interface{}) or an input object (map[string]interface{})
+func (p *parser) parseValue(constant bool) (interface{}, error) {
+	tok := p.tok
+
+	switch {
+	case p.peek(tokenPunctuator, "$") && !constant:
+		err := p.advance()
+
+		if err != nil {
+			return nil, err
+		}
+
+		name, err := p.name()
+
+		return Variable(name), err
+	case p.peek(tokenPunctuator, "["):
+		err := p.advance()
+
+		if err != nil {
+			return nil, err
+		}
+
+		list := make([]interface{}, 0)
+
+		for !p.peek(tokenPunctuator, "]") {
+			item, err := p.parseValue(constant)
+
+			if err != nil {
+				return nil, err
+			}
+
+			list = append(list, item)
+		}
+
+		return list, p.advance()
+	case p.peek(tokenPunctuator, "{"):
+		err := p.advance()
+
+		if err != nil {
+			return nil, err
+		}
+
+		object := make(map[string]interface{})
+
+		for !p.peek(tokenPunctuator, "}") {
+			name, err := p.name()
+
+			if err != nil {
+				return nil, err
+			}
+
+			err = p.expect(":")
+
+			if err != nil {
+				return nil, err
+			}
+
+			object[name], err = p.parseValue(constant)
+
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		return object, p.advance()
+	case tok.kind == tokenInt:
+		v, err := strconv.ParseInt(tok.value, 10, 64)
+
+		if err != nil {
+			return nil, &SyntaxError{Message: "the integer " + tok.value + " is too large", Line: tok.line, Column: tok.column}
+		}
+
+		return v, p.advance()
+	case tok.kind == tokenFloat:
+		v, err := strconv.ParseFloat(tok.value, 64)
+
+		if err != nil {
+			return nil, &SyntaxError{Message: "invalid float " + tok.value, Line: tok.line, Column: tok.column}
+		}
+
+		return v, p.advance()
+	case tok.kind == tokenString:
+		return tok.value, p.advance()
+	case tok.kind == tokenName:
+		var v interface{}
+
+		switch tok.value {
+		case "true":
+			v = true
+		case "false":
+			v = false
+		case "null":
+			v = nil
+		default:
+			v = EnumValue(tok.value)
+		}
+
+		return v, p.advance()
+	default:
+		return nil, p.unexpected()
+	}
+}
@@ -0,0 +1,109 @@
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/jpeg"
+	"image/png"
+)
+
+// ErrInvalidEdit is returned when the crop rectangle is empty or not inside the image, or the rotation is not a
+// multiple of 90 degrees
+var ErrInvalidEdit = errors.New("invalid crop or rotation")
+
+// Rectangle is a rectangle of an image, in pixels from its top-left corner
+type Rectangle struct {
+	X      int
+	Y      int
+	Width  int
+	Height int
+}
+
+// rotations maps the clockwise rotations to the EXIF orientations applying them
+var rotations = map[int]int{
+	0:   1,
+	90:  6,
+	180: 3,
+	270: 8,
+}
+
+// Edit returns the image `content` of type `contentType` cropped to `crop`, given in the pixels of the image (or left
+// whole if nil), and then rotated clockwise by `rotation` degrees, which must be 0, 90, 180 or 270. The result keeps
+// the format of the image: the JPEG images are encoded again with JPEGQuality, and the PNG ones keep their
+// transparency. It returns ErrUnsupportedFormat for the WebP images, which cannot be decoded, and ErrInvalidEdit if
+// the crop or the rotation is not valid.
+func Edit(content []byte, contentType string, crop *Rectangle, rotation int) ([]byte, error) {
+	orientation, ok := rotations[rotation]
+
+	if !ok {
+		return nil, ErrInvalidEdit
+	}
+
+	img, err := decode(content, contentType)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if crop != nil {
+		bounds := img.Bounds()
+		w, h := bounds.Dx(), bounds.Dy()
+
+		// compared without adding them, which could overflow
+		if crop.X < 0 || crop.Y < 0 || crop.Width <= 0 || crop.Height <= 0 || crop.X >= w || crop.Y >= h || crop.Width > w-crop.X || crop.Height > h-crop.Y {
+			return nil, ErrInvalidEdit
+		}
+
+		// the decoded images share their pixels with their parts
+		sub, ok := img.(interface {
+			SubImage(r image.Rectangle) image.Image
+		})
+
+		if !ok {
+			return nil, ErrInvalidImage
+		}
+
+		img = sub.SubImage(image.Rect(crop.X, crop.Y, crop.X+crop.Width, crop.Y+crop.Height).Add(bounds.Min))
+	}
+
+	if orientation != 1 {
+		img = orient(img, orientation)
+	}
+
+	var buf bytes.Buffer
+
+	if contentType == PNG {
+		err = png.Encode(&buf, img)
+	} else {
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: JPEGQuality})
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// decode decodes the JPEG or PNG image `content` of type `contentType`, returning ErrUnsupportedFormat for the WebP
+// images and ErrInvalidImage if it cannot be decoded
+func decode(content []byte, contentType string) (image.Image, error) {
+	var img image.Image
+	var err error
+
+	switch contentType {
+	case JPEG:
+		img, err = jpeg.Decode(bytes.NewReader(content))
+	case PNG:
+		img, err = png.Decode(bytes.NewReader(content))
+	default:
+		return nil, ErrUnsupportedFormat
+	}
+
+	if err != nil || img.Bounds().Empty() {
+		return nil, ErrInvalidImage
+	}
+
+	return img, nil
+}
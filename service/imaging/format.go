@@ -0,0 +1,110 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/jpeg"
+	"image/png"
+)
+
+// the media types of the formats accepted for the photos
+const (
+	JPEG = "image/jpeg"
+	PNG  = "image/png"
+	WebP = "image/webp"
+)
+
+// ErrUnsupportedFormat is returned when an image is not a JPEG, PNG or WebP image
+var ErrUnsupportedFormat = errors.New("unsupported image format")
+
+// Info describes an image without decoding it.
+type Info struct {
+	// ContentType is the media type of the format of the image (JPEG, PNG or WebP)
+	ContentType string
+
+	// Width and Height are the size of the image in pixels
+	Width  int
+	Height int
+}
+
+// Inspect detects the format of the image `content` from its first bytes (its magic number), ignoring what the client
+// declared, and reads its size from its header. It returns ErrUnsupportedFormat if the image is not a JPEG, PNG or
+// WebP image, and ErrInvalidImage if its header is damaged.
+func Inspect(content []byte) (Info, error) {
+	var cfg image.Config
+	var err error
+
+	info := Info{}
+
+	switch {
+	case bytes.HasPrefix(content, []byte("\xff\xd8\xff")):
+		info.ContentType = JPEG
+		cfg, err = jpeg.DecodeConfig(bytes.NewReader(content))
+	case bytes.HasPrefix(content, []byte("\x89PNG\r\n\x1a\n")):
+		info.ContentType = PNG
+		cfg, err = png.DecodeConfig(bytes.NewReader(content))
+	case len(content) >= 12 && string(content[:4]) == "RIFF" && string(content[8:12]) == "WEBP":
+		info.ContentType = WebP
+		cfg, err = webpConfig(content)
+	default:
+		return info, ErrUnsupportedFormat
+	}
+
+	if err != nil || cfg.Width <= 0 || cfg.Height <= 0 {
+		return info, ErrInvalidImage
+	}
+
+	info.Width, info.Height = cfg.Width, cfg.Height
+
+	return info, nil
+}
+
+// webpConfig reads the size of the WebP image `content` from its first chunk,
+// which is VP8 for the lossy images, VP8L for the lossless ones and VP8X for
+// the ones with extended features (eg. transparency or animation)
+func webpConfig(content []byte) (image.Config, error) {
+	if len(content) < 20 {
+		return image.Config{}, ErrInvalidImage
+	}
+
+	data := content[20:]
+
+	switch string(content[12:16]) {
+	case "VP8 ":
+		// the frame tag (3 bytes), the start code and the 14-bit sizes
+		if len(data) < 10 || !bytes.Equal(data[3:6], []byte{0x9d, 0x01, 0x2a}) {
+			return image.Config{}, ErrInvalidImage
+		}
+
+		return image.Config{
+			Width:  int(binary.LittleEndian.Uint16(data[6:8]) & 0x3fff),
+			Height: int(binary.LittleEndian.Uint16(data[8:10]) & 0x3fff),
+		}, nil
+	case "VP8L":
+		// the signature and the 14-bit sizes minus one
+		if len(data) < 5 || data[0] != 0x2f {
+			return image.Config{}, ErrInvalidImage
+		}
+
+		bits := binary.LittleEndian.Uint32(data[1:5])
+
+		return image.Config{
+			Width:  int(bits&0x3fff) + 1,
+			Height: int((bits>>14)&0x3fff) + 1,
+		}, nil
+	case "VP8X":
+		// the flags (4 bytes) and the 24-bit sizes of the canvas minus one
+		if len(data) < 10 {
+			return image.Config{}, ErrInvalidImage
+		}
+
+		return image.Config{
+			Width:  int(uint32(data[4])|uint32(data[5])<<8|uint32(data[6])<<16) + 1,
+			Height: int(uint32(data[7])|uint32(data[8])<<8|uint32(data[9])<<16) + 1,
+		}, nil
+	default:
+		return image.Config{}, ErrInvalidImage
+	}
+}
@@ -0,0 +1,90 @@
+package imaging
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+)
+
+// DifferenceHash returns the perceptual hash of the image `content` of type `contentType`, which is the same, or
+// differs in a few bits, for the images looking alike (eg. the same photo resized, compressed again or slightly
+// retouched). The image is reduced to 9x8 gray cells, and each bit of the hash tells if a cell is brighter than the
+// next one on its right. It returns ErrUnsupportedFormat for the WebP images, which cannot be decoded.
+func DifferenceHash(content []byte, contentType string) (uint64, error) {
+	var img image.Image
+	var err error
+
+	switch contentType {
+	case JPEG:
+		img, err = jpeg.Decode(bytes.NewReader(content))
+	case PNG:
+		img, err = png.Decode(bytes.NewReader(content))
+	default:
+		return 0, ErrUnsupportedFormat
+	}
+
+	if err != nil {
+		return 0, ErrInvalidImage
+	}
+
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+
+	if w == 0 || h == 0 {
+		return 0, ErrInvalidImage
+	}
+
+	// the average brightness of every cell
+	var sums [8][9]uint64
+	var counts [8][9]uint64
+
+	for y := 0; y < h; y++ {
+		row := y * 8 / h
+
+		for x := 0; x < w; x++ {
+			column := x * 9 / w
+
+			sums[row][column] += uint64(luminance(img, bounds.Min.X+x, bounds.Min.Y+y))
+			counts[row][column]++
+		}
+	}
+
+	var hash uint64
+
+	for row := 0; row < 8; row++ {
+		for column := 0; column < 8; column++ {
+			hash <<= 1
+
+			// the cells of the images smaller than 9x8 may be
+			// empty, and compare like the cells of the same color
+			if sums[row][column]*max1(counts[row][column+1]) > sums[row][column+1]*max1(counts[row][column]) {
+				hash |= 1
+			}
+		}
+	}
+
+	return hash, nil
+}
+
+// luminance returns the brightness of a pixel, reading the luma plane
+// directly for the JPEG images instead of converting the colors
+func luminance(img image.Image, x int, y int) uint8 {
+	switch img := img.(type) {
+	case *image.YCbCr:
+		return img.Y[img.YOffset(x, y)]
+	case *image.Gray:
+		return img.Pix[img.PixOffset(x, y)]
+	default:
+		return color.GrayModel.Convert(img.At(x, y)).(color.Gray).Y
+	}
+}
+
+func max1(n uint64) uint64 {
+	if n == 0 {
+		return 1
+	}
+
+	return n
+}
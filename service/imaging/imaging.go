@@ -0,0 +1,16 @@
+/*
+Package imaging prepares the uploaded photos before they are saved, removing the metadata which could disclose private
+information about their author and fixing their orientation, turns the uploaded avatars into small squares, and crops
+and rotates the photos edited by their owners.
+*/
+package imaging
+
+import (
+	"errors"
+)
+
+// ErrInvalidImage is returned when the content of an image does not follow its format
+var ErrInvalidImage = errors.New("invalid image")
+
+// JPEGQuality is the quality of the JPEG images encoded again after being rotated, cropped or squared
+const JPEGQuality = 90
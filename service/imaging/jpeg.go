@@ -0,0 +1,211 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/jpeg"
+)
+
+// the JPEG markers handled by CleanJPEG
+const (
+	markerSOI  = 0xd8
+	markerEOI  = 0xd9
+	markerSOS  = 0xda
+	markerRST0 = 0xd0
+	markerRST7 = 0xd7
+	markerTEM  = 0x01
+	markerAPP1 = 0xe1
+	markerAPPD = 0xed
+	markerCOM  = 0xfe
+)
+
+// exifOrientation is the tag of the EXIF orientation
+const exifOrientation = 0x0112
+
+// CleanJPEG returns the JPEG image `content` without its metadata, so that it does not disclose where or with which
+// device the photo was taken. The EXIF and XMP segments (APP1), the IPTC segments (APP13) and the comments are removed
+// without touching the image data, while the segments needed to show the image correctly (e.g., the ICC color profile)
+// are kept. If the EXIF orientation tag asks to rotate or flip the image, the image is decoded, turned upright and
+// encoded again, dropping every segment.
+func CleanJPEG(content []byte) ([]byte, error) {
+	if len(content) < 4 || content[0] != 0xff || content[1] != markerSOI {
+		return nil, ErrInvalidImage
+	}
+
+	cleaned := bytes.NewBuffer(make([]byte, 0, len(content)))
+	cleaned.Write(content[:2])
+
+	orientation := 1
+
+segments:
+	for i := 2; ; {
+		// a marker is 0xff followed by its code, optionally after some 0xff fill bytes
+		if i+1 >= len(content) || content[i] != 0xff {
+			return nil, ErrInvalidImage
+		}
+
+		for i+1 < len(content) && content[i+1] == 0xff {
+			i++
+		}
+
+		if i+1 >= len(content) {
+			return nil, ErrInvalidImage
+		}
+
+		marker := content[i+1]
+
+		// the markers without a segment
+		if marker == markerTEM || (marker >= markerRST0 && marker <= markerRST7) {
+			cleaned.Write(content[i : i+2])
+			i += 2
+			continue
+		}
+
+		if marker == markerEOI {
+			cleaned.Write(content[i : i+2])
+			break segments
+		}
+
+		if i+3 >= len(content) {
+			return nil, ErrInvalidImage
+		}
+
+		// the length of the segment includes its two bytes
+		end := i + 2 + int(binary.BigEndian.Uint16(content[i+2:i+4]))
+
+		if end > len(content) || end < i+4 {
+			return nil, ErrInvalidImage
+		}
+
+		switch marker {
+		case markerAPP1:
+			if o, ok := parseOrientation(content[i+4 : end]); ok {
+				orientation = o
+			}
+		case markerAPPD, markerCOM:
+		case markerSOS:
+			// the scan data follow, up to the end of the image
+			cleaned.Write(content[i:])
+			break segments
+		default:
+			cleaned.Write(content[i:end])
+		}
+
+		i = end
+	}
+
+	if orientation == 1 {
+		return cleaned.Bytes(), nil
+	}
+
+	img, err := jpeg.Decode(bytes.NewReader(cleaned.Bytes()))
+
+	if err != nil {
+		return nil, ErrInvalidImage
+	}
+
+	var rotated bytes.Buffer
+
+	err = jpeg.Encode(&rotated, orient(img, orientation), &jpeg.Options{Quality: JPEGQuality})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return rotated.Bytes(), nil
+}
+
+// parseOrientation returns the orientation (from 1 to 8) of the EXIF
+// data held by the APP1 segment `segment`, or false if there is none
+func parseOrientation(segment []byte) (int, bool) {
+	// the EXIF header is followed by a TIFF header: the byte
+	// order, the number 42 and the offset of the first IFD
+	if len(segment) < 14 || string(segment[:6]) != "Exif\x00\x00" {
+		return 0, false
+	}
+
+	tiff := segment[6:]
+
+	var order binary.ByteOrder
+
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0, false
+	}
+
+	ifd := int(order.Uint32(tiff[4:8]))
+
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 0, false
+	}
+
+	// every entry of the IFD is made of the tag, the type,
+	// the count and the value, taking 2, 2, 4 and 4 bytes
+	count := int(order.Uint16(tiff[ifd : ifd+2]))
+
+	for n := 0; n < count; n++ {
+		entry := ifd + 2 + n*12
+
+		if entry+12 > len(tiff) {
+			return 0, false
+		}
+
+		if order.Uint16(tiff[entry:entry+2]) == exifOrientation {
+			orientation := int(order.Uint16(tiff[entry+8 : entry+10]))
+
+			return orientation, orientation >= 1 && orientation <= 8
+		}
+	}
+
+	return 0, false
+}
+
+// orient returns the image `img` turned upright, applying the flip or the
+// rotation required by the EXIF orientation `orientation`
+func orient(img image.Image, orientation int) image.Image {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+
+	// the orientations from 5 to 8 swap width and height
+	dw, dh := w, h
+
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+
+			switch orientation {
+			case 2: // flip horizontally
+				dx, dy = w-1-x, y
+			case 3: // rotate by 180°
+				dx, dy = w-1-x, h-1-y
+			case 4: // flip vertically
+				dx, dy = x, h-1-y
+			case 5: // flip along the main diagonal
+				dx, dy = y, x
+			case 6: // rotate by 90° clockwise
+				dx, dy = h-1-y, x
+			case 7: // flip along the anti-diagonal
+				dx, dy = h-1-y, w-1-x
+			case 8: // rotate by 90° counterclockwise
+				dx, dy = y, w-1-x
+			default:
+				dx, dy = x, y
+			}
+
+			dst.Set(dx, dy, img.At(bounds.Min.X+x, bounds.Min.Y+y))
+		}
+	}
+
+	return dst
+}
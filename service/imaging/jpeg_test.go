@@ -0,0 +1,224 @@
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// The fixtures under testdata show the same upright image, 32x16 pixels with a red, a green, a blue and a white
+// quadrant, from the top left one. The orientation-N.jpg ones are saved turned as a camera would, with the EXIF
+// orientation N telling how to turn them upright (using the big-endian byte order for the even N and the little-endian
+// one for the odd N), while metadata.jpg is upright and carries an EXIF segment, an XMP one, an IPTC one, a comment and
+// an ICC color profile.
+
+// uprightQuadrants are the colors of the quadrants of the upright image, from the top left one
+var uprightQuadrants = []color.RGBA{
+	{R: 255, A: 255},
+	{G: 255, A: 255},
+	{B: 255, A: 255},
+	{R: 255, G: 255, B: 255, A: 255},
+}
+
+func readFixture(t *testing.T, name string) []byte {
+	t.Helper()
+
+	content, err := os.ReadFile(filepath.Join("testdata", name))
+
+	if err != nil {
+		t.Fatalf("reading the fixture %s: %v", name, err)
+	}
+
+	return content
+}
+
+func decodeJPEG(t *testing.T, content []byte) image.Image {
+	t.Helper()
+
+	img, err := jpeg.Decode(bytes.NewReader(content))
+
+	if err != nil {
+		t.Fatalf("decoding the cleaned image: %v", err)
+	}
+
+	return img
+}
+
+// expectUpright fails the test if `img` is not the upright image of the fixtures, comparing the center of each
+// quadrant with some tolerance for the JPEG compression
+func expectUpright(t *testing.T, img image.Image) {
+	t.Helper()
+
+	bounds := img.Bounds()
+
+	if bounds.Dx() != 32 || bounds.Dy() != 16 {
+		t.Fatalf("got an image of %dx%d pixels, want 32x16", bounds.Dx(), bounds.Dy())
+	}
+
+	for q, want := range uprightQuadrants {
+		x := bounds.Min.X + 8 + 16*(q%2)
+		y := bounds.Min.Y + 4 + 8*(q/2)
+
+		got := color.RGBAModel.Convert(img.At(x, y)).(color.RGBA)
+
+		if !closeColor(got, want) {
+			t.Errorf("got the color %v in the quadrant %d, want %v", got, q, want)
+		}
+	}
+}
+
+func closeColor(a, b color.RGBA) bool {
+	near := func(x, y uint8) bool {
+		return int(x)-int(y) <= 32 && int(y)-int(x) <= 32
+	}
+
+	return near(a.R, b.R) && near(a.G, b.G) && near(a.B, b.B)
+}
+
+// segmentMarkers returns the markers of the segments of the JPEG image `content` preceding the scan
+func segmentMarkers(t *testing.T, content []byte) []byte {
+	t.Helper()
+
+	var markers []byte
+
+	for i := 2; i+4 <= len(content); {
+		marker := content[i+1]
+
+		if marker == markerSOS {
+			return markers
+		}
+
+		markers = append(markers, marker)
+		i += 2 + int(content[i+2])<<8 + int(content[i+3])
+	}
+
+	t.Fatal("the cleaned image has no scan")
+
+	return nil
+}
+
+func TestCleanJPEGOrientation(t *testing.T) {
+	tests := []struct {
+		name    string
+		fixture string
+	}{
+		{"upright", "orientation-1.jpg"},
+		{"flipped horizontally", "orientation-2.jpg"},
+		{"rotated by 180°", "orientation-3.jpg"},
+		{"flipped vertically", "orientation-4.jpg"},
+		{"flipped along the main diagonal", "orientation-5.jpg"},
+		{"rotated by 90° clockwise", "orientation-6.jpg"},
+		{"flipped along the anti-diagonal", "orientation-7.jpg"},
+		{"rotated by 90° counterclockwise", "orientation-8.jpg"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cleaned, err := CleanJPEG(readFixture(t, tt.fixture))
+
+			if err != nil {
+				t.Fatalf("cleaning the image: %v", err)
+			}
+
+			for _, marker := range segmentMarkers(t, cleaned) {
+				if marker == markerAPP1 {
+					t.Error("the cleaned image still has an APP1 segment")
+				}
+			}
+
+			expectUpright(t, decodeJPEG(t, cleaned))
+		})
+	}
+}
+
+func TestCleanJPEGMetadata(t *testing.T) {
+	content := readFixture(t, "metadata.jpg")
+
+	cleaned, err := CleanJPEG(content)
+
+	if err != nil {
+		t.Fatalf("cleaning the image: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		data string
+		kept bool
+	}{
+		{"EXIF", "41.8902 N", false},
+		{"XMP", "SecretCam", false},
+		{"IPTC", "by-lineAlice", false},
+		{"comment", "a private comment", false},
+		{"ICC profile", "ICC_PROFILE", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !bytes.Contains(content, []byte(tt.data)) {
+				t.Fatalf("the fixture lacks %q", tt.data)
+			}
+
+			if kept := bytes.Contains(cleaned, []byte(tt.data)); kept != tt.kept {
+				t.Errorf("got %q kept %t, want %t", tt.data, kept, tt.kept)
+			}
+		})
+	}
+
+	// the image data are not encoded again
+	scan := bytes.Index(content, []byte{0xff, markerSOS})
+
+	if !bytes.HasSuffix(cleaned, content[scan:]) {
+		t.Error("the scan of the cleaned image differs from the original one")
+	}
+
+	expectUpright(t, decodeJPEG(t, cleaned))
+}
+
+func TestCleanJPEGUntouched(t *testing.T) {
+	content := readFixture(t, "plain.jpg")
+
+	cleaned, err := CleanJPEG(content)
+
+	if err != nil {
+		t.Fatalf("cleaning the image: %v", err)
+	}
+
+	if !bytes.Equal(cleaned, content) {
+		t.Error("the image without metadata was changed")
+	}
+}
+
+func TestCleanJPEGInvalid(t *testing.T) {
+	content := readFixture(t, "metadata.jpg")
+
+	// the length of the first segment (the EXIF one) exceeds the image
+	overlong := append([]byte{}, content...)
+	overlong[4], overlong[5] = 0xff, 0xff
+
+	tests := []struct {
+		name    string
+		content []byte
+	}{
+		{"empty", nil},
+		{"not a JPEG", []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR")},
+		{"truncated segment", content[:20]},
+		{"truncated before the scan", content[:bytes.Index(content, []byte{0xff, markerSOS})]},
+		{"overlong segment", overlong},
+		{"garbage between segments", append(append([]byte{}, content[:2]...), append([]byte{0x00}, content[2:]...)...)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := CleanJPEG(tt.content)
+
+			if !errors.Is(err, ErrInvalidImage) {
+				t.Errorf("got the error %v, want %v", err, ErrInvalidImage)
+			}
+		})
+	}
+}
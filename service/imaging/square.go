@@ -0,0 +1,81 @@
+package imaging
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+)
+
+// Square returns the image `content` of type `contentType` cropped to the square at its center and scaled down to
+// `size` pixels per side (or left as it is if smaller), encoded as a JPEG image. Every pixel of the result is the
+// average of the pixels it covers, the transparent ones being painted over white. It returns ErrUnsupportedFormat for
+// the WebP images, which cannot be decoded.
+func Square(content []byte, contentType string, size int) ([]byte, error) {
+	img, err := decode(content, contentType)
+
+	if err != nil {
+		return nil, err
+	}
+
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+
+	// the side of the square and its corner in the image
+	side := w
+
+	if h < side {
+		side = h
+	}
+
+	left := bounds.Min.X + (w-side)/2
+	top := bounds.Min.Y + (h-side)/2
+
+	if size > side {
+		size = side
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+
+	for dy := 0; dy < size; dy++ {
+		y0, y1 := top+dy*side/size, top+(dy+1)*side/size
+
+		for dx := 0; dx < size; dx++ {
+			x0, x1 := left+dx*side/size, left+(dx+1)*side/size
+
+			// the colors are premultiplied by their alpha, so
+			// the missing alpha is the white showing through
+			var r, g, b, a, n uint64
+
+			for y := y0; y < y1; y++ {
+				for x := x0; x < x1; x++ {
+					pr, pg, pb, pa := img.At(x, y).RGBA()
+
+					r += uint64(pr)
+					g += uint64(pg)
+					b += uint64(pb)
+					a += uint64(pa)
+					n++
+				}
+			}
+
+			white := n*0xffff - a
+
+			i := dst.PixOffset(dx, dy)
+
+			dst.Pix[i+0] = uint8((r + white) / n >> 8)
+			dst.Pix[i+1] = uint8((g + white) / n >> 8)
+			dst.Pix[i+2] = uint8((b + white) / n >> 8)
+			dst.Pix[i+3] = 0xff
+		}
+	}
+
+	var buf bytes.Buffer
+
+	err = jpeg.Encode(&buf, dst, &jpeg.Options{Quality: JPEGQuality})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
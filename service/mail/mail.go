@@ -0,0 +1,39 @@
+/*
+Package mail sends the emails written to the users, like the digests of what they missed.
+
+Every backend implements the Mailer interface, so that the API does not depend on how the emails are delivered. To send
+them through an SMTP server, create a new instance with NewSMTP() passing the address of the server and the sender:
+
+	// Create the mailer
+	mailer, err := mail.NewSMTP(mail.SMTPConfig{
+		Host: cfg.Mail.SMTP.Host,
+		Port: cfg.Mail.SMTP.Port,
+		From: cfg.Mail.From,
+	})
+	if err != nil {
+		logger.WithError(err).Error("error creating the mailer")
+		return fmt.Errorf("creating the mailer: %w", err)
+	}
+
+See the `main.go` file inside the `cmd/webapi` for a full usage example.
+*/
+package mail
+
+import (
+	"context"
+)
+
+// Mailer is the interface of the backends delivering the emails.
+type Mailer interface {
+	// Send delivers the message to its recipient.
+	Send(ctx context.Context, msg Message) error
+}
+
+// Message is an email written to a single recipient, as plain text.
+type Message struct {
+	// To is the address of the recipient
+	To string
+
+	Subject string
+	Text    string
+}
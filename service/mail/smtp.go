@@ -0,0 +1,163 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"time"
+)
+
+// SMTPConfig holds the settings of the SMTP server relaying the emails.
+type SMTPConfig struct {
+	// Host and Port are the address of the server, which is asked to switch to TLS if it supports STARTTLS
+	Host string
+	Port int
+
+	// Username and Password authenticate the sender, if the username is not empty
+	Username string
+	Password string
+
+	// From is the address of the sender, optionally with a name (e.g., "WASAPhoto <noreply@example.com>")
+	From string
+}
+
+// DefaultSMTPPort is the submission port used when none is provided in SMTPConfig
+const DefaultSMTPPort = 587
+
+// SMTP is the Mailer sending each email through a new connection to an SMTP server.
+type SMTP struct {
+	cfg  SMTPConfig
+	from *mail.Address
+}
+
+// NewSMTP returns a SMTP sending the emails through the server described by `cfg`.
+func NewSMTP(cfg SMTPConfig) (*SMTP, error) {
+	if cfg.Host == "" {
+		return nil, errors.New("host is required")
+	}
+
+	from, err := mail.ParseAddress(cfg.From)
+
+	if err != nil {
+		return nil, fmt.Errorf("parsing the sender address: %w", err)
+	}
+
+	if cfg.Port == 0 {
+		cfg.Port = DefaultSMTPPort
+	}
+
+	return &SMTP{cfg: cfg, from: from}, nil
+}
+
+// Send sends the message as UTF-8 text, encoded as quoted-printable. The connection is abandoned when `ctx` is done.
+func (s *SMTP) Send(ctx context.Context, msg Message) error {
+	to, err := mail.ParseAddress(msg.To)
+
+	if err != nil {
+		return fmt.Errorf("parsing the recipient address: %w", err)
+	}
+
+	var dialer net.Dialer
+
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(s.cfg.Host, strconv.Itoa(s.cfg.Port)))
+
+	if err != nil {
+		return err
+	}
+
+	// the SMTP client does not take a context, hence
+	// the connection is given its deadline instead
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	stop := context.AfterFunc(ctx, func() {
+		_ = conn.SetDeadline(time.Now())
+	})
+	defer stop()
+
+	client, err := smtp.NewClient(conn, s.cfg.Host)
+
+	if err != nil {
+		_ = conn.Close()
+		return err
+	}
+
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		err = client.StartTLS(&tls.Config{ServerName: s.cfg.Host, MinVersion: tls.VersionTLS12})
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if s.cfg.Username != "" {
+		err = client.Auth(smtp.PlainAuth("", s.cfg.Username, s.cfg.Password, s.cfg.Host))
+
+		if err != nil {
+			return err
+		}
+	}
+
+	err = client.Mail(s.from.Address)
+
+	if err != nil {
+		return err
+	}
+
+	err = client.Rcpt(to.Address)
+
+	if err != nil {
+		return err
+	}
+
+	w, err := client.Data()
+
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(s.compose(to, msg))
+
+	if err != nil {
+		return err
+	}
+
+	err = w.Close()
+
+	if err != nil {
+		return err
+	}
+
+	return client.Quit()
+}
+
+// compose writes the headers and the body of the email
+func (s *SMTP) compose(to *mail.Address, msg Message) []byte {
+	var b bytes.Buffer
+
+	b.WriteString("From: " + s.from.String() + "\r\n")
+	b.WriteString("To: " + to.String() + "\r\n")
+	b.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", msg.Subject) + "\r\n")
+	b.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: quoted-printable\r\n")
+	b.WriteString("\r\n")
+
+	qp := quotedprintable.NewWriter(&b)
+	_, _ = qp.Write([]byte(msg.Text))
+	_ = qp.Close()
+
+	return b.Bytes()
+}
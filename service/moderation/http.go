@@ -0,0 +1,113 @@
+package moderation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// HTTPConfig holds the settings of an external classifier reached through HTTP.
+type HTTPConfig struct {
+	// Endpoint is the url the images are posted to
+	Endpoint string
+
+	// Token is sent as a bearer token in the Authorization header, if not empty
+	Token string
+
+	// Threshold is the lowest score of an unsafe image, between 0 and 1. If zero, DefaultThreshold is used.
+	Threshold float64
+}
+
+// DefaultThreshold is the lowest score of an unsafe image used when none is provided in HTTPConfig
+const DefaultThreshold = 0.8
+
+// maxResponseSize is the largest response of the classifier which is read
+const maxResponseSize = 64 * 1024
+
+// HTTP is the Classifier posting the images to an external service. The image is the body of the request, with its
+// Content-Type, and the service answers with a JSON document holding the probability that the image is unsafe and,
+// optionally, the categories it found in it:
+//
+//	{"score": 0.93, "labels": ["nudity"]}
+type HTTP struct {
+	cfg    HTTPConfig
+	client *http.Client
+}
+
+// NewHTTP returns a HTTP classifier posting the images to the service described by `cfg`, sending the requests
+// through `client` (or http.DefaultClient if nil).
+func NewHTTP(cfg HTTPConfig, client *http.Client) (*HTTP, error) {
+	if cfg.Endpoint == "" {
+		return nil, errors.New("endpoint is required")
+	}
+
+	if cfg.Threshold < 0 || cfg.Threshold > 1 {
+		return nil, fmt.Errorf("invalid threshold %v: it must be between 0 and 1", cfg.Threshold)
+	}
+
+	if cfg.Threshold == 0 {
+		cfg.Threshold = DefaultThreshold
+	}
+
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return &HTTP{
+		cfg:    cfg,
+		client: client,
+	}, nil
+}
+
+// Classify posts the image to the service, telling that it is unsafe if its score reaches the threshold. Any response
+// other than a successful one with a valid score is an error.
+func (h *HTTP) Classify(ctx context.Context, image []byte, contentType string) (Verdict, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.cfg.Endpoint, bytes.NewReader(image))
+
+	if err != nil {
+		return Verdict{}, err
+	}
+
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Accept", "application/json")
+
+	if h.cfg.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+h.cfg.Token)
+	}
+
+	resp, err := h.client.Do(req)
+
+	if err != nil {
+		return Verdict{}, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return Verdict{}, fmt.Errorf("the classifier answered with status %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Score  *float64 `json:"score"`
+		Labels []string `json:"labels"`
+	}
+
+	err = json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(&result)
+
+	if err != nil {
+		return Verdict{}, fmt.Errorf("parsing the response of the classifier: %w", err)
+	}
+
+	if result.Score == nil || *result.Score < 0 || *result.Score > 1 {
+		return Verdict{}, errors.New("the classifier answered without a valid score")
+	}
+
+	return Verdict{
+		Unsafe: *result.Score >= h.cfg.Threshold,
+		Labels: result.Labels,
+	}, nil
+}
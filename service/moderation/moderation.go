@@ -0,0 +1,37 @@
+/*
+Package moderation tells whether the images uploaded by the users are unsafe (eg. nudity, violence or gore) before they
+are shown to the others, so that they can be flagged for a review or rejected.
+
+Every classifier implements the Classifier interface, so that the API does not depend on the service checking the
+images. To check them through an external HTTP classifier, create a new instance with NewHTTP() passing its url:
+
+	// Create the classifier of the uploaded photos
+	classifier, err := moderation.NewHTTP(moderation.HTTPConfig{Endpoint: url}, &http.Client{Timeout: 30 * time.Second})
+	if err != nil {
+		logger.WithError(err).Error("error creating the classifier")
+		return fmt.Errorf("creating the classifier: %w", err)
+	}
+
+See the `main.go` file inside the `cmd/webapi` for a full usage example.
+*/
+package moderation
+
+import (
+	"context"
+)
+
+// Classifier is the interface of the services telling whether an image is unsafe.
+type Classifier interface {
+	// Classify checks the image, encoded as `contentType` (eg. "image/jpeg"), returning an error if the classifier
+	// could not tell.
+	Classify(ctx context.Context, image []byte, contentType string) (Verdict, error)
+}
+
+// Verdict is what a classifier tells about an image.
+type Verdict struct {
+	// Unsafe is set if the image should not be shown to the users without a review
+	Unsafe bool
+
+	// Labels are the categories the classifier found in the image, if it names them (eg. "nudity")
+	Labels []string
+}
@@ -0,0 +1,232 @@
+/*
+Package protowire encodes and decodes the messages of Protocol Buffers in their binary wire format, so that the gRPC
+service of the API is served without generated code. A message is encoded field by field, in the order of its fields
+numbers, leaving out the scalar fields holding their default value as proto3 does:
+
+	enc := protowire.NewEncoder()
+	enc.Uint(1, uint64(user.Id))
+	enc.String(2, user.Username)
+
+	payload := enc.Bytes()
+
+and it is decoded by walking through its fields, skipping the unknown ones:
+
+	dec := protowire.NewDecoder(payload)
+
+	for dec.More() {
+		field, typ, err := dec.Next()
+		...
+	}
+
+See the `grpc.go` file inside the `service/api` for a full usage example.
+*/
+package protowire
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+// Type is the wire type of a field, telling how its value is encoded
+type Type int
+
+// the wire types of the fields
+const (
+	Varint  Type = 0
+	Fixed64 Type = 1
+	Bytes   Type = 2
+	Fixed32 Type = 5
+)
+
+// ErrMalformed is returned when a message is truncated or holds a field which cannot be decoded
+var ErrMalformed = errors.New("malformed protobuf message")
+
+// maxField is the highest field number allowed by Protocol Buffers
+const maxField = 1<<29 - 1
+
+// Encoder builds the binary encoding of a message
+type Encoder struct {
+	buf []byte
+}
+
+// NewEncoder returns an Encoder of an empty message
+func NewEncoder() *Encoder {
+	return &Encoder{}
+}
+
+// Bytes returns the encoding of the message
+func (e *Encoder) Bytes() []byte {
+	return e.buf
+}
+
+func (e *Encoder) varint(v uint64) {
+	var b [binary.MaxVarintLen64]byte
+
+	n := binary.PutUvarint(b[:], v)
+
+	e.buf = append(e.buf, b[:n]...)
+}
+
+func (e *Encoder) tag(field int, typ Type) {
+	e.varint(uint64(field)<<3 | uint64(typ))
+}
+
+// Uint writes an unsigned integer field (uint32, uint64), unless it is 0
+func (e *Encoder) Uint(field int, v uint64) {
+	if v == 0 {
+		return
+	}
+
+	e.tag(field, Varint)
+	e.varint(v)
+}
+
+// Int writes a signed integer field (int32, int64), unless it is 0
+func (e *Encoder) Int(field int, v int64) {
+	e.Uint(field, uint64(v))
+}
+
+// Bool writes a boolean field, unless it is false
+func (e *Encoder) Bool(field int, v bool) {
+	if v {
+		e.Uint(field, 1)
+	}
+}
+
+// Double writes a double field, even if it is 0, since the double fields of the API are optional
+func (e *Encoder) Double(field int, v float64) {
+	var b [8]byte
+
+	binary.LittleEndian.PutUint64(b[:], math.Float64bits(v))
+
+	e.tag(field, Fixed64)
+	e.buf = append(e.buf, b[:]...)
+}
+
+// String writes a string field, unless it is empty
+func (e *Encoder) String(field int, v string) {
+	if v == "" {
+		return
+	}
+
+	e.tag(field, Bytes)
+	e.varint(uint64(len(v)))
+	e.buf = append(e.buf, v...)
+}
+
+// Message writes an embedded message field, encoded by `encode`; it is written even if empty, as the presence of the
+// embedded messages is told apart from their absence
+func (e *Encoder) Message(field int, encode func(*Encoder)) {
+	inner := NewEncoder()
+
+	encode(inner)
+
+	e.tag(field, Bytes)
+	e.varint(uint64(len(inner.buf)))
+	e.buf = append(e.buf, inner.buf...)
+}
+
+// Decoder walks through the fields of the binary encoding of a message
+type Decoder struct {
+	buf []byte
+}
+
+// NewDecoder returns a Decoder of the message encoded by `buf`
+func NewDecoder(buf []byte) *Decoder {
+	return &Decoder{buf: buf}
+}
+
+// More tells whether there are fields left to decode
+func (d *Decoder) More() bool {
+	return len(d.buf) > 0
+}
+
+func (d *Decoder) varint() (uint64, error) {
+	v, n := binary.Uvarint(d.buf)
+
+	if n <= 0 {
+		return 0, ErrMalformed
+	}
+
+	d.buf = d.buf[n:]
+
+	return v, nil
+}
+
+// Next decodes the tag of the next field, returning its number and its wire type; its value must then be decoded by
+// the method matching the wire type, or skipped with Skip
+func (d *Decoder) Next() (int, Type, error) {
+	tag, err := d.varint()
+
+	if err != nil {
+		return 0, 0, err
+	}
+
+	field := tag >> 3
+
+	if field == 0 || field > maxField {
+		return 0, 0, ErrMalformed
+	}
+
+	return int(field), Type(tag & 7), nil
+}
+
+// Uint decodes the value of a varint field
+func (d *Decoder) Uint() (uint64, error) {
+	return d.varint()
+}
+
+// Bytes decodes the value of a length-delimited field, such as a string or an embedded message
+func (d *Decoder) Bytes() ([]byte, error) {
+	length, err := d.varint()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if length > uint64(len(d.buf)) {
+		return nil, ErrMalformed
+	}
+
+	v := d.buf[:length]
+	d.buf = d.buf[length:]
+
+	return v, nil
+}
+
+// String decodes the value of a string field
+func (d *Decoder) String() (string, error) {
+	v, err := d.Bytes()
+
+	return string(v), err
+}
+
+// Skip skips the value of a field of the wire type, which is not known to the receiver
+func (d *Decoder) Skip(typ Type) error {
+	switch typ {
+	case Varint:
+		_, err := d.varint()
+		return err
+	case Fixed64, Fixed32:
+		size := 8
+
+		if typ == Fixed32 {
+			size = 4
+		}
+
+		if len(d.buf) < size {
+			return ErrMalformed
+		}
+
+		d.buf = d.buf[size:]
+
+		return nil
+	case Bytes:
+		_, err := d.Bytes()
+		return err
+	default:
+		// the groups are deprecated and never used by the API
+		return ErrMalformed
+	}
+}
@@ -0,0 +1,204 @@
+package push
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// APNsConfig holds the settings of an app receiving the messages through the Apple Push Notification service.
+type APNsConfig struct {
+	// Key is the signing key (the .p8 file) created in the Apple developer account, and KeyID is its id
+	Key   []byte
+	KeyID string
+
+	// TeamID is the id of the team of the developer account
+	TeamID string
+
+	// Topic is the bundle id of the app
+	Topic string
+
+	// Sandbox selects the development environment of APNs, for the builds of the app not coming from the App Store
+	Sandbox bool
+
+	// Endpoint is the url of APNs. If empty, DefaultAPNsEndpoint (or DefaultAPNsSandboxEndpoint if Sandbox is set) is
+	// used.
+	Endpoint string
+
+	// MaxAttempts is how many times a message is sent before its error is returned. If zero, DefaultMaxAttempts is
+	// used.
+	MaxAttempts int
+}
+
+// the urls of APNs used when none is provided in APNsConfig
+const (
+	DefaultAPNsEndpoint        = "https://api.push.apple.com"
+	DefaultAPNsSandboxEndpoint = "https://api.sandbox.push.apple.com"
+)
+
+// apnsTokenLifetime is how long a provider token is used: APNs rejects
+// the tokens older than one hour and the ones renewed too often
+const apnsTokenLifetime = 50 * time.Minute
+
+// APNs is the Pusher sending the messages through the HTTP/2 API of the Apple Push Notification service. The requests
+// are authorized by provider tokens signed with the key of the developer account.
+type APNs struct {
+	cfg    APNsConfig
+	client *http.Client
+	key    crypto.Signer
+
+	// mu guards the provider token and when it was signed
+	mu       sync.Mutex
+	token    string
+	issuedAt time.Time
+}
+
+// NewAPNs returns an APNs sending the messages of the app described by `cfg`, sending the requests through `client`
+// (or http.DefaultClient if nil). The client must speak HTTP/2, as the default transport does over TLS.
+func NewAPNs(cfg APNsConfig, client *http.Client) (*APNs, error) {
+	if cfg.KeyID == "" || cfg.TeamID == "" {
+		return nil, errors.New("key id and team id are required")
+	}
+	if cfg.Topic == "" {
+		return nil, errors.New("topic is required")
+	}
+
+	key, err := parsePrivateKey(cfg.Key)
+
+	if err != nil {
+		return nil, fmt.Errorf("parsing the signing key: %w", err)
+	}
+
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = DefaultAPNsEndpoint
+
+		if cfg.Sandbox {
+			cfg.Endpoint = DefaultAPNsSandboxEndpoint
+		}
+	}
+
+	cfg.Endpoint = strings.TrimSuffix(cfg.Endpoint, "/")
+
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = DefaultMaxAttempts
+	}
+
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return &APNs{cfg: cfg, client: client, key: key}, nil
+}
+
+// Push sends the message as an alert, with its data added to the payload. The tokens which are not valid or which are
+// no longer active for the app are reported as ErrInvalidToken.
+func (a *APNs) Push(ctx context.Context, token string, msg Message) error {
+	providerToken, err := a.providerToken()
+
+	if err != nil {
+		return err
+	}
+
+	payload := map[string]interface{}{
+		"aps": map[string]interface{}{
+			"alert": map[string]string{
+				"title": msg.Title,
+				"body":  msg.Body,
+			},
+			"sound": "default",
+		},
+	}
+
+	for name, value := range msg.Data {
+		payload[name] = value
+	}
+
+	body, err := json.Marshal(payload)
+
+	if err != nil {
+		return err
+	}
+
+	target := a.cfg.Endpoint + "/3/device/" + url.PathEscape(token)
+
+	resp, err := do(ctx, a.client, a.cfg.MaxAttempts, func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+
+		if err != nil {
+			return nil, err
+		}
+
+		req.Header.Set("Authorization", "bearer "+providerToken)
+		req.Header.Set("Apns-Topic", a.cfg.Topic)
+		req.Header.Set("Apns-Push-Type", "alert")
+		req.Header.Set("Content-Type", "application/json")
+
+		return req, nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 300 {
+		return nil
+	}
+
+	// APNs tells the reason of the failure in a small JSON document
+	var failure struct {
+		Reason string `json:"reason"`
+	}
+
+	_ = json.NewDecoder(io.LimitReader(resp.Body, 4096)).Decode(&failure)
+
+	switch {
+	case resp.StatusCode == http.StatusGone,
+		failure.Reason == "BadDeviceToken",
+		failure.Reason == "DeviceTokenNotForTopic":
+		return ErrInvalidToken
+	case failure.Reason == "ExpiredProviderToken":
+		// a new provider token is signed for the next message
+		a.mu.Lock()
+		a.token = ""
+		a.mu.Unlock()
+	}
+
+	return fmt.Errorf("APNs responded %s: %s", resp.Status, failure.Reason)
+}
+
+// providerToken returns the token authorizing the requests, signing a new one if there is none or if it is too old
+func (a *APNs) providerToken() (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := time.Now()
+
+	if a.token != "" && now.Before(a.issuedAt.Add(apnsTokenLifetime)) {
+		return a.token, nil
+	}
+
+	token, err := signJWT(map[string]string{"kid": a.cfg.KeyID}, map[string]interface{}{
+		"iss": a.cfg.TeamID,
+		"iat": now.Unix(),
+	}, a.key)
+
+	if err != nil {
+		return "", err
+	}
+
+	a.token = token
+	a.issuedAt = now
+
+	return a.token, nil
+}
@@ -0,0 +1,273 @@
+package push
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FCMConfig holds the settings of a Firebase project sending the messages through Firebase Cloud Messaging.
+type FCMConfig struct {
+	// Credentials is the JSON key of a service account of the project, as downloaded from the Firebase console
+	Credentials []byte
+
+	// ProjectID is the id of the Firebase project. If empty, the project of the service account is used.
+	ProjectID string
+
+	// Endpoint is the url of the FCM API. If empty, DefaultFCMEndpoint is used.
+	Endpoint string
+
+	// MaxAttempts is how many times a message is sent before its error is returned. If zero, DefaultMaxAttempts is
+	// used.
+	MaxAttempts int
+}
+
+// DefaultFCMEndpoint is the url of the FCM API used when none is provided in FCMConfig
+const DefaultFCMEndpoint = "https://fcm.googleapis.com"
+
+// fcmScope is the OAuth 2.0 scope needed to send the messages
+const fcmScope = "https://www.googleapis.com/auth/firebase.messaging"
+
+// fcmTokenLifetime is how long the access tokens are requested for, and
+// fcmTokenMargin is how long before they expire they are renewed
+const (
+	fcmTokenLifetime = time.Hour
+	fcmTokenMargin   = 5 * time.Minute
+)
+
+// FCM is the Pusher sending the messages through the HTTP v1 API of Firebase Cloud Messaging. The requests are
+// authorized by the OAuth 2.0 access tokens of the service account, which are renewed before they expire.
+type FCM struct {
+	cfg    FCMConfig
+	client *http.Client
+
+	// the service account signing the requests of the access tokens
+	email    string
+	tokenUrl string
+	key      crypto.Signer
+
+	// mu guards the access token and when it expires
+	mu          sync.Mutex
+	accessToken string
+	expiresAt   time.Time
+}
+
+// NewFCM returns a FCM sending the messages of the project described by `cfg`, sending the requests through `client`
+// (or http.DefaultClient if nil).
+func NewFCM(cfg FCMConfig, client *http.Client) (*FCM, error) {
+	var account struct {
+		ProjectID   string `json:"project_id"`
+		PrivateKey  string `json:"private_key"`
+		ClientEmail string `json:"client_email"`
+		TokenURI    string `json:"token_uri"`
+	}
+
+	err := json.Unmarshal(cfg.Credentials, &account)
+
+	if err != nil {
+		return nil, fmt.Errorf("parsing the credentials: %w", err)
+	}
+
+	if account.ClientEmail == "" || account.PrivateKey == "" || account.TokenURI == "" {
+		return nil, errors.New("the credentials are not the key of a service account")
+	}
+
+	key, err := parsePrivateKey([]byte(account.PrivateKey))
+
+	if err != nil {
+		return nil, fmt.Errorf("parsing the private key: %w", err)
+	}
+
+	if cfg.ProjectID == "" {
+		cfg.ProjectID = account.ProjectID
+	}
+
+	if cfg.ProjectID == "" {
+		return nil, errors.New("project id is required")
+	}
+
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = DefaultFCMEndpoint
+	}
+
+	cfg.Endpoint = strings.TrimSuffix(cfg.Endpoint, "/")
+
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = DefaultMaxAttempts
+	}
+
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return &FCM{
+		cfg:      cfg,
+		client:   client,
+		email:    account.ClientEmail,
+		tokenUrl: account.TokenURI,
+		key:      key,
+	}, nil
+}
+
+// Push sends the message as a notification, with its data attached. The tokens which were unregistered or which are
+// not valid registration tokens are reported as ErrInvalidToken.
+func (f *FCM) Push(ctx context.Context, token string, msg Message) error {
+	accessToken, err := f.token(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"message": map[string]interface{}{
+			"token": token,
+			"notification": map[string]string{
+				"title": msg.Title,
+				"body":  msg.Body,
+			},
+			"data": msg.Data,
+		},
+	})
+
+	if err != nil {
+		return err
+	}
+
+	target := f.cfg.Endpoint + "/v1/projects/" + url.PathEscape(f.cfg.ProjectID) + "/messages:send"
+
+	resp, err := do(ctx, f.client, f.cfg.MaxAttempts, func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+
+		if err != nil {
+			return nil, err
+		}
+
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+		req.Header.Set("Content-Type", "application/json")
+
+		return req, nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 300 {
+		return nil
+	}
+
+	// the API describes the error in a JSON document, telling
+	// whether the token was unregistered in its details
+	var failure struct {
+		Error struct {
+			Message string `json:"message"`
+			Status  string `json:"status"`
+			Details []struct {
+				ErrorCode string `json:"errorCode"`
+			} `json:"details"`
+		} `json:"error"`
+	}
+
+	_ = json.NewDecoder(io.LimitReader(resp.Body, 4096)).Decode(&failure)
+
+	for _, detail := range failure.Error.Details {
+		if detail.ErrorCode == "UNREGISTERED" {
+			return ErrInvalidToken
+		}
+	}
+
+	if resp.StatusCode == http.StatusNotFound ||
+		(failure.Error.Status == "INVALID_ARGUMENT" && strings.Contains(failure.Error.Message, "registration token")) {
+		return ErrInvalidToken
+	}
+
+	// an access token refused by the API is not used again
+	if resp.StatusCode == http.StatusUnauthorized {
+		f.mu.Lock()
+		f.accessToken = ""
+		f.mu.Unlock()
+	}
+
+	return fmt.Errorf("FCM responded %s: %s", resp.Status, failure.Error.Message)
+}
+
+// token returns the access token authorizing the requests, asking a new one for the service account if there is none
+// or if it is about to expire
+func (f *FCM) token(ctx context.Context) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := time.Now()
+
+	if f.accessToken != "" && now.Before(f.expiresAt.Add(-fcmTokenMargin)) {
+		return f.accessToken, nil
+	}
+
+	assertion, err := signJWT(map[string]string{"typ": "JWT"}, map[string]interface{}{
+		"iss":   f.email,
+		"scope": fcmScope,
+		"aud":   f.tokenUrl,
+		"iat":   now.Unix(),
+		"exp":   now.Add(fcmTokenLifetime).Unix(),
+	}, f.key)
+
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {assertion},
+	}.Encode()
+
+	resp, err := do(ctx, f.client, f.cfg.MaxAttempts, func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, f.tokenUrl, strings.NewReader(form))
+
+		if err != nil {
+			return nil, err
+		}
+
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		return req, nil
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	defer resp.Body.Close()
+
+	var grant struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+
+	if resp.StatusCode >= 300 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+
+		return "", fmt.Errorf("the authorization server responded %s: %s", resp.Status, bytes.TrimSpace(message))
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&grant)
+
+	if err != nil {
+		return "", fmt.Errorf("parsing the access token: %w", err)
+	}
+
+	f.accessToken = grant.AccessToken
+	f.expiresAt = now.Add(time.Duration(grant.ExpiresIn) * time.Second)
+
+	return f.accessToken, nil
+}
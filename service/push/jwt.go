@@ -0,0 +1,97 @@
+package push
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+)
+
+// signJWT returns the JSON Web Token made of the given header and claims, signed with `key`: RS256 is used for the RSA
+// keys and ES256 for the P-256 keys, the algorithm being added to the header.
+func signJWT(header map[string]string, claims map[string]interface{}, key crypto.Signer) (string, error) {
+	switch key.(type) {
+	case *rsa.PrivateKey:
+		header["alg"] = "RS256"
+	case *ecdsa.PrivateKey:
+		header["alg"] = "ES256"
+	default:
+		return "", errors.New("unsupported signing key")
+	}
+
+	encodedHeader, err := json.Marshal(header)
+
+	if err != nil {
+		return "", err
+	}
+
+	encodedClaims, err := json.Marshal(claims)
+
+	if err != nil {
+		return "", err
+	}
+
+	unsigned := base64.RawURLEncoding.EncodeToString(encodedHeader) + "." + base64.RawURLEncoding.EncodeToString(encodedClaims)
+	digest := sha256.Sum256([]byte(unsigned))
+
+	var signature []byte
+
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		signature, err = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	case *ecdsa.PrivateKey:
+		// ES256 signatures are the two integers of the
+		// signature, each one padded to 32 bytes
+		var r, s *big.Int
+
+		r, s, err = ecdsa.Sign(rand.Reader, key, digest[:])
+
+		if err == nil {
+			signature = make([]byte, 64)
+			r.FillBytes(signature[:32])
+			s.FillBytes(signature[32:])
+		}
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// parsePrivateKey reads the private key from the PEM block `key`, encoded with PKCS #8 (or PKCS #1 for the RSA keys)
+func parsePrivateKey(key []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(key)
+
+	if block == nil {
+		return nil, errors.New("the key is not PEM encoded")
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+
+	if err != nil {
+		rsaKey, rsaErr := x509.ParsePKCS1PrivateKey(block.Bytes)
+
+		if rsaErr != nil {
+			return nil, err
+		}
+
+		return rsaKey, nil
+	}
+
+	signer, ok := parsed.(crypto.Signer)
+
+	if !ok {
+		return nil, errors.New("unsupported signing key")
+	}
+
+	return signer, nil
+}
@@ -0,0 +1,99 @@
+/*
+Package push delivers messages to the devices of the users through the push services of their platforms: Firebase
+Cloud Messaging for Android and the web, and the Apple Push Notification service for iOS. The devices are identified by
+the tokens their push service gave them, which the clients register with the API.
+
+Every push service implements the Pusher interface, so that the API does not depend on the platform of each device. To
+push through Firebase Cloud Messaging, create a new instance with NewFCM() passing the key of a service account of the
+project:
+
+	// Create the pusher of the Android devices
+	fcm, err := push.NewFCM(push.FCMConfig{Credentials: key}, &http.Client{Timeout: 30 * time.Second})
+	if err != nil {
+		logger.WithError(err).Error("error creating the FCM pusher")
+		return fmt.Errorf("creating the FCM pusher: %w", err)
+	}
+
+See the `main.go` file inside the `cmd/webapi` for a full usage example.
+*/
+package push
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+// Pusher is the interface of the push services delivering the messages to the devices.
+type Pusher interface {
+	// Push sends the message to the device identified by `token`. ErrInvalidToken is returned if the push service
+	// tells that the token is no longer valid, so that the device can be forgotten.
+	Push(ctx context.Context, token string, msg Message) error
+}
+
+// Message is what is shown on a device, together with the data read by the app when it is opened.
+type Message struct {
+	Title string
+	Body  string
+
+	// Data holds the values passed to the app, like the id of what the message is about
+	Data map[string]string
+}
+
+// the platforms of the devices, each one having its own push service
+const (
+	PlatformFCM  = "fcm"
+	PlatformAPNs = "apns"
+)
+
+// DefaultMaxAttempts is the number of attempts of a push used when none is provided in the configuration
+const DefaultMaxAttempts = 3
+
+// pushBackoff is the longest wait before the second attempt of a
+// push, which doubles after every failed attempt
+const pushBackoff = 500 * time.Millisecond
+
+// ErrInvalidToken is returned when the token of a device is not valid anymore, eg. because the app was removed
+var ErrInvalidToken = errors.New("the device token is not valid")
+
+// do sends the request built by `newRequest` through `client`, trying again up to `maxAttempts` times on the network
+// errors and on the responses telling that the push service is unavailable or overloaded. The last response is
+// returned with its body open, whatever its status.
+func do(ctx context.Context, client *http.Client, maxAttempts int, newRequest func() (*http.Request, error)) (*http.Response, error) {
+	backoff := pushBackoff
+
+	for attempt := 1; ; attempt++ {
+		req, err := newRequest()
+
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := client.Do(req)
+
+		retry := err != nil || resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+
+		if !retry || attempt == maxAttempts || ctx.Err() != nil {
+			return resp, err
+		}
+
+		if resp != nil {
+			_ = resp.Body.Close()
+		}
+
+		// wait between half and the whole backoff
+		wait := backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+		timer := time.NewTimer(wait)
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+
+		backoff *= 2
+	}
+}
@@ -0,0 +1,222 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Disk is the BlobStorage keeping the blobs as files in a directory of the local filesystem.
+type Disk struct {
+	root    string
+	baseUrl string
+
+	// etags caches the entity tags of the blobs by name, since hashing a blob reads it whole
+	etags sync.Map
+}
+
+// diskContentTypes maps the extensions of the blobs the mime package may not know, as it only knows the images among
+// them unless the system has a table of the media types, to their media type
+var diskContentTypes = map[string]string{
+	".mp4":  "video/mp4",
+	".webm": "video/webm",
+}
+
+// diskETag is the entity tag of a blob, valid as long as the file keeps its size and modification time
+type diskETag struct {
+	size    int64
+	modTime time.Time
+	etag    string
+}
+
+// NewDisk returns a Disk saving the blobs in the directory `root`, which is created if it does not exist. The blobs
+// are downloaded from `baseUrl` followed by their name, where they must be served reading them with Get.
+func NewDisk(root string, baseUrl string) (*Disk, error) {
+	if root == "" {
+		return nil, errors.New("root directory is required")
+	}
+
+	err := os.MkdirAll(root, 0o750)
+
+	if err != nil {
+		return nil, fmt.Errorf("creating the root directory: %w", err)
+	}
+
+	return &Disk{root: root, baseUrl: baseUrl}, nil
+}
+
+// Put saves the blob into a temporary file which is then renamed, so that the blob is never read half written. The
+// content type is not stored, as Get takes it from the extension of the name.
+func (d *Disk) Put(ctx context.Context, name string, r io.Reader, contentType string) error {
+	path, err := d.path(name)
+
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(d.root, ".upload-*")
+
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(tmp, r)
+
+	if err == nil {
+		err = tmp.Sync()
+	}
+
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+
+	return nil
+}
+
+func (d *Disk) Get(ctx context.Context, name string) (*Blob, error) {
+	path, err := d.path(name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(path)
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := f.Stat()
+
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+
+	contentType, ok := diskContentTypes[strings.ToLower(filepath.Ext(name))]
+
+	if !ok {
+		contentType = mime.TypeByExtension(filepath.Ext(name))
+	}
+
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	etag, err := d.etag(name, f, info)
+
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+
+	return &Blob{
+		ReadCloser:  f,
+		ContentType: contentType,
+		Size:        info.Size(),
+		ModTime:     info.ModTime(),
+		ETag:        etag,
+	}, nil
+}
+
+// etag returns the entity tag of the blob `name` opened as `f`, the hash of its content, hashing it only if it changed
+// since the last time; `f` is read from the start afterwards
+func (d *Disk) etag(name string, f *os.File, info fs.FileInfo) (string, error) {
+	if cached, ok := d.etags.Load(name); ok {
+		cached := cached.(diskETag)
+
+		if cached.size == info.Size() && cached.modTime.Equal(info.ModTime()) {
+			return cached.etag, nil
+		}
+	}
+
+	hash := sha256.New()
+
+	_, err := io.Copy(hash, f)
+
+	if err != nil {
+		return "", err
+	}
+
+	_, err = f.Seek(0, io.SeekStart)
+
+	if err != nil {
+		return "", err
+	}
+
+	etag := `"` + hex.EncodeToString(hash.Sum(nil)[:16]) + `"`
+
+	d.etags.Store(name, diskETag{size: info.Size(), modTime: info.ModTime(), etag: etag})
+
+	return etag, nil
+}
+
+func (d *Disk) Delete(ctx context.Context, name string) error {
+	path, err := d.path(name)
+
+	if err != nil {
+		return err
+	}
+
+	d.etags.Delete(name)
+
+	err = os.Remove(path)
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+
+	return err
+}
+
+func (d *Disk) URL(name string) string {
+	return d.baseUrl + name
+}
+
+// Ping saves and removes an empty temporary file in the root directory, which fails if the directory was removed or
+// cannot be written (eg. a full or read-only disk).
+func (d *Disk) Ping(ctx context.Context) error {
+	f, err := os.CreateTemp(d.root, ".ping-*")
+
+	if err != nil {
+		return err
+	}
+
+	_ = f.Close()
+
+	return os.Remove(f.Name())
+}
+
+// path returns the path of the blob `name` inside the root directory, rejecting
+// the names which are not a plain file name (hidden ones included, since the
+// temporary files of Put are hidden)
+func (d *Disk) path(name string) (string, error) {
+	if name == "" || strings.HasPrefix(name, ".") || strings.ContainsAny(name, `/\`) {
+		return "", ErrInvalidName
+	}
+
+	return filepath.Join(d.root, name), nil
+}
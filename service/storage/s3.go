@@ -0,0 +1,474 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// S3Config holds the settings of a bucket of an S3 compatible object storage (e.g., Amazon S3, MinIO).
+type S3Config struct {
+	// Endpoint is the url of the object storage, like https://s3.eu-west-1.amazonaws.com or http://localhost:9000
+	Endpoint string
+
+	// Region is the region of the bucket, us-east-1 for MinIO unless configured otherwise
+	Region string
+
+	// Bucket is the name of the bucket, addressed in the path of the requests so that it works with every provider
+	Bucket string
+
+	// Prefix is prepended to the names of the blobs to get the keys of their objects (e.g., "photos/")
+	Prefix string
+
+	// AccessKey and SecretKey are the credentials signing the requests
+	AccessKey string
+	SecretKey string
+
+	// PublicURL is the url where the clients download the objects of the bucket, followed by their key. If empty, the
+	// blobs are downloaded from the base url given to NewS3, where the API must serve them reading them with Get.
+	PublicURL string
+
+	// MaxAttempts is how many times a request is sent before its error is returned. If zero, DefaultS3MaxAttempts is
+	// used.
+	MaxAttempts int
+}
+
+// DefaultS3MaxAttempts is the number of attempts of a request used when none is provided in S3Config
+const DefaultS3MaxAttempts = 3
+
+// s3Backoff is the longest wait before the second attempt of a
+// request, which doubles after every failed attempt
+const s3Backoff = 100 * time.Millisecond
+
+// emptyPayloadHash is the SHA-256 of an empty request body
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// S3 is the BlobStorage keeping the blobs as objects of a bucket of an S3 compatible object storage. The requests are
+// signed with AWS Signature Version 4.
+type S3 struct {
+	cfg     S3Config
+	baseUrl string
+	client  *http.Client
+}
+
+// NewS3 returns a S3 saving the blobs in the bucket described by `cfg`, sending the requests through `client` (or
+// http.DefaultClient if nil). If cfg.PublicURL is empty, the blobs are downloaded from `baseUrl` followed by their
+// name.
+func NewS3(cfg S3Config, baseUrl string, client *http.Client) (*S3, error) {
+	if cfg.Endpoint == "" {
+		return nil, errors.New("endpoint is required")
+	}
+	if cfg.Region == "" {
+		return nil, errors.New("region is required")
+	}
+	if cfg.Bucket == "" {
+		return nil, errors.New("bucket is required")
+	}
+	if cfg.AccessKey == "" || cfg.SecretKey == "" {
+		return nil, errors.New("credentials are required")
+	}
+
+	_, err := url.Parse(cfg.Endpoint)
+
+	if err != nil {
+		return nil, fmt.Errorf("parsing the endpoint: %w", err)
+	}
+
+	cfg.Endpoint = strings.TrimSuffix(cfg.Endpoint, "/")
+	cfg.PublicURL = strings.TrimSuffix(cfg.PublicURL, "/")
+
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = DefaultS3MaxAttempts
+	}
+
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return &S3{cfg: cfg, baseUrl: baseUrl, client: client}, nil
+}
+
+// Put reads the whole content in memory before uploading it, since the payload is signed and must be sent again if
+// the request is retried. The content type is stored with the object and returned by Get.
+func (s *S3) Put(ctx context.Context, name string, r io.Reader, contentType string) error {
+	key, err := s.key(name)
+
+	if err != nil {
+		return err
+	}
+
+	content, err := io.ReadAll(r)
+
+	if err != nil {
+		return err
+	}
+
+	header := http.Header{}
+
+	if contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+
+	resp, err := s.do(ctx, http.MethodPut, key, header, content)
+
+	if err != nil {
+		return err
+	}
+
+	_ = resp.Body.Close()
+
+	return nil
+}
+
+func (s *S3) Get(ctx context.Context, name string) (*Blob, error) {
+	key, err := s.key(name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.do(ctx, http.MethodGet, key, http.Header{}, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	// a missing or malformed date is left as the zero time
+	modTime, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+
+	// the entity tag of the object, the hash of its content, is
+	// kept only if strong, since the weak ones may not change with it
+	etag := resp.Header.Get("ETag")
+
+	if !strings.HasPrefix(etag, `"`) {
+		etag = ""
+	}
+
+	// the object is read from the body of the response, and
+	// requested again from another offset whenever the reader
+	// seeks elsewhere, so that it can be served in ranges
+	var content io.ReadCloser = resp.Body
+
+	if resp.ContentLength >= 0 {
+		content = &s3Object{s: s, ctx: ctx, key: key, size: resp.ContentLength, body: resp.Body}
+	}
+
+	return &Blob{
+		ReadCloser:  content,
+		ContentType: contentType,
+		Size:        resp.ContentLength,
+		ModTime:     modTime,
+		ETag:        etag,
+	}, nil
+}
+
+// Delete succeeds also for the objects which do not exist, as the object storage does.
+func (s *S3) Delete(ctx context.Context, name string) error {
+	key, err := s.key(name)
+
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.do(ctx, http.MethodDelete, key, http.Header{}, nil)
+
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	_ = resp.Body.Close()
+
+	return nil
+}
+
+func (s *S3) URL(name string) string {
+	if s.cfg.PublicURL == "" {
+		return s.baseUrl + name
+	}
+
+	return s.cfg.PublicURL + "/" + uriEncode(s.cfg.Prefix+name, true)
+}
+
+// Ping asks for the bucket with a single request, not retried, so that a probe fails as soon as the object storage
+// cannot be reached or the bucket is missing or forbidden.
+func (s *S3) Ping(ctx context.Context) error {
+	resp, err := s.send(ctx, http.MethodHead, "", http.Header{}, nil)
+
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode >= 300 {
+		return responseError(resp)
+	}
+
+	_ = resp.Body.Close()
+
+	return nil
+}
+
+// key returns the key of the object of the blob `name`
+func (s *S3) key(name string) (string, error) {
+	if name == "" || strings.HasPrefix(name, ".") || strings.ContainsAny(name, `/\`) {
+		return "", ErrInvalidName
+	}
+
+	return s.cfg.Prefix + name, nil
+}
+
+// do sends the request `method` for the object `key`, retrying it on the network errors and on the responses telling
+// that the object storage is unavailable or overloaded. A successful response is returned with its body open, the
+// other ones are turned into errors (ErrNotFound for a missing object).
+func (s *S3) do(ctx context.Context, method string, key string, header http.Header, body []byte) (*http.Response, error) {
+	backoff := s3Backoff
+
+	for attempt := 1; ; attempt++ {
+		resp, err := s.send(ctx, method, key, header, body)
+
+		retry := err != nil || resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+
+		if err == nil && !retry && resp.StatusCode < 300 {
+			return resp, nil
+		}
+
+		if err == nil {
+			err = responseError(resp)
+		}
+
+		if !retry || attempt == s.cfg.MaxAttempts || ctx.Err() != nil {
+			return nil, err
+		}
+
+		// wait between half and the whole backoff
+		wait := backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+		timer := time.NewTimer(wait)
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, err
+		case <-timer.C:
+		}
+
+		backoff *= 2
+	}
+}
+
+// send signs and sends a single request
+func (s *S3) send(ctx context.Context, method string, key string, header http.Header, body []byte) (*http.Response, error) {
+	target := s.cfg.Endpoint + "/" + uriEncode(s.cfg.Bucket, false) + "/" + uriEncode(key, true)
+
+	req, err := http.NewRequestWithContext(ctx, method, target, bytes.NewReader(body))
+
+	if err != nil {
+		return nil, err
+	}
+
+	for name, values := range header {
+		req.Header[name] = values
+	}
+
+	s.sign(req, body, time.Now().UTC())
+
+	return s.client.Do(req)
+}
+
+// sign adds to the request the headers of AWS Signature Version 4, computed at the time `now`
+func (s *S3) sign(req *http.Request, body []byte, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	scope := now.Format("20060102") + "/" + s.cfg.Region + "/s3/aws4_request"
+
+	payloadHash := emptyPayloadHash
+
+	if len(body) > 0 {
+		sum := sha256.Sum256(body)
+		payloadHash = hex.EncodeToString(sum[:])
+	}
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	// every header sent is signed, the host included
+	headers := map[string]string{"host": req.URL.Host}
+
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+
+	names := make([]string, 0, len(headers))
+
+	for name := range headers {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+s.cfg.SecretKey), now.Format("20060102"))
+	key = hmacSHA256(key, s.cfg.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+s.cfg.AccessKey+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	_, _ = h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// uriEncode escapes `s` as required by AWS Signature Version 4, leaving
+// only the unreserved characters (and the slashes if keepSlash is true)
+func uriEncode(s string, keepSlash bool) string {
+	var b strings.Builder
+
+	for _, c := range []byte(s) {
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && keepSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+
+	return b.String()
+}
+
+// responseError turns a failed response into an error, closing its body
+func responseError(resp *http.Response) error {
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrNotFound
+	}
+
+	// the object storage describes the error in a small XML document
+	message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+
+	return fmt.Errorf("object storage responded %s: %s", resp.Status, bytes.TrimSpace(message))
+}
+
+// s3Object reads an object from the body of a response holding it from `bodyOffset`, requesting the object again from
+// the offset it seeks to before reading elsewhere. Seeking does not send any request, hence seeking to the end to
+// learn the size of the object and back to the start reads the first response.
+type s3Object struct {
+	s   *S3
+	ctx context.Context
+	key string
+
+	// size is the length of the object in bytes, and offset where the next read starts
+	size   int64
+	offset int64
+
+	// body holds the object from bodyOffset, and is nil until it is requested
+	body       io.ReadCloser
+	bodyOffset int64
+}
+
+func (o *s3Object) Read(p []byte) (int, error) {
+	if o.body != nil && o.bodyOffset != o.offset {
+		_ = o.body.Close()
+		o.body = nil
+	}
+
+	if o.offset >= o.size {
+		return 0, io.EOF
+	}
+
+	if o.body == nil {
+		header := http.Header{}
+		header.Set("Range", fmt.Sprintf("bytes=%d-", o.offset))
+
+		resp, err := o.s.do(o.ctx, http.MethodGet, o.key, header, nil)
+
+		if err != nil {
+			return 0, err
+		}
+
+		if resp.StatusCode != http.StatusPartialContent && o.offset > 0 {
+			_ = resp.Body.Close()
+			return 0, fmt.Errorf("the range of the object was not honored (status %d)", resp.StatusCode)
+		}
+
+		o.body, o.bodyOffset = resp.Body, o.offset
+	}
+
+	n, err := o.body.Read(p)
+
+	o.offset += int64(n)
+	o.bodyOffset += int64(n)
+
+	return n, err
+}
+
+func (o *s3Object) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += o.offset
+	case io.SeekEnd:
+		offset += o.size
+	}
+
+	if offset < 0 {
+		return 0, errors.New("negative offset")
+	}
+
+	o.offset = offset
+
+	return offset, nil
+}
+
+func (o *s3Object) Close() error {
+	if o.body == nil {
+		return nil
+	}
+
+	return o.body.Close()
+}
@@ -0,0 +1,71 @@
+/*
+Package storage keeps the files uploaded by the users, like the photos, so that they can be served back later. The
+database only holds the urls of the files.
+
+Every backend implements the BlobStorage interface, so that the API handlers do not depend on where the files are kept.
+To use the local filesystem, create a new instance with NewDisk() passing the directory where the files are saved and
+the url under which the API serves them:
+
+	// Create the storage of the photos
+	photos, err := storage.NewDisk(cfg.Storage.Root, api.PhotoUrlPrefix)
+	if err != nil {
+		logger.WithError(err).Error("error creating the photo storage")
+		return fmt.Errorf("creating the photo storage: %w", err)
+	}
+
+See the `main.go` file inside the `cmd/webapi` for a full usage example.
+*/
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+// BlobStorage is the interface of the backends keeping the files, or blobs, identified by their name. The names are
+// plain file names, without any directory.
+type BlobStorage interface {
+	// Put saves the content read from `r` as the blob `name`, replacing it if it exists. `contentType` is the media
+	// type of the content, kept by the backends which store it together with the blob.
+	Put(ctx context.Context, name string, r io.Reader, contentType string) error
+
+	// Get opens the blob `name` for reading, returning ErrNotFound if it does not exist. The blob must be closed by
+	// the caller.
+	Get(ctx context.Context, name string) (*Blob, error)
+
+	// Delete removes the blob `name`. Removing a blob which does not exist is not an error.
+	Delete(ctx context.Context, name string) error
+
+	// URL returns the url where the clients can download the blob `name`.
+	URL(name string) string
+
+	// Ping checks that the backend can be reached and the blobs saved, for the readiness probes.
+	Ping(ctx context.Context) error
+}
+
+// Blob is a blob opened for reading, together with its metadata.
+type Blob struct {
+	// ReadCloser reads the content of the blob. If it also implements io.Seeker, the blob can be served in ranges.
+	io.ReadCloser
+
+	// ContentType is the media type of the content
+	ContentType string
+
+	// Size is the length of the content in bytes, or -1 if unknown
+	Size int64
+
+	// ModTime is when the blob was last saved
+	ModTime time.Time
+
+	// ETag is the strong entity tag of the content, quoted, which changes whenever the content does, or empty if
+	// unknown
+	ETag string
+}
+
+// ErrInvalidName is returned when the name of a file is empty or refers to a path outside the storage
+var ErrInvalidName = errors.New("invalid file name")
+
+// ErrNotFound is returned when the requested file does not exist
+var ErrNotFound = errors.New("file not found")
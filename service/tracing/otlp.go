@@ -0,0 +1,136 @@
+package tracing
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+)
+
+// The messages of the JSON protocol of OpenTelemetry (OTLP) exporting the traces. The ids are encoded in hex, and the
+// 64 bit integers as strings, as the protocol requires.
+
+type otlpTraces struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              Kind            `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+// otlpStatus is the status of a span: 0 if unset, 2 if it failed
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// encodeSpans encodes the ended spans of the service `serviceName` into the message exporting them
+func encodeSpans(serviceName string, spans []*Span) otlpTraces {
+	encoded := make([]otlpSpan, 0, len(spans))
+
+	for _, s := range spans {
+		s.mu.Lock()
+
+		span := otlpSpan{
+			TraceID:           hex.EncodeToString(s.traceID[:]),
+			SpanID:            hex.EncodeToString(s.spanID[:]),
+			Name:              s.name,
+			Kind:              s.kind,
+			StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+		}
+
+		if s.parentID != [8]byte{} {
+			span.ParentSpanID = hex.EncodeToString(s.parentID[:])
+		}
+
+		for _, a := range s.attributes {
+			span.Attributes = append(span.Attributes, encodeAttribute(a.key, a.value))
+		}
+
+		if s.err != "" {
+			span.Status = otlpStatus{Code: 2, Message: s.err}
+		}
+
+		s.mu.Unlock()
+
+		encoded = append(encoded, span)
+	}
+
+	return otlpTraces{
+		ResourceSpans: []otlpResourceSpans{{
+			Resource: otlpResource{
+				Attributes: []otlpAttribute{encodeAttribute("service.name", serviceName)},
+			},
+			ScopeSpans: []otlpScopeSpans{{
+				Scope: otlpScope{Name: "wasaphoto"},
+				Spans: encoded,
+			}},
+		}},
+	}
+}
+
+// encodeAttribute encodes the attribute, turning the values of the types not supported into strings
+func encodeAttribute(key string, value interface{}) otlpAttribute {
+	var v otlpValue
+
+	switch value := value.(type) {
+	case string:
+		v.StringValue = &value
+	case bool:
+		v.BoolValue = &value
+	case int:
+		i := strconv.FormatInt(int64(value), 10)
+		v.IntValue = &i
+	case int64:
+		i := strconv.FormatInt(value, 10)
+		v.IntValue = &i
+	case uint32:
+		i := strconv.FormatUint(uint64(value), 10)
+		v.IntValue = &i
+	case float64:
+		v.DoubleValue = &value
+	default:
+		s := fmt.Sprint(value)
+		v.StringValue = &s
+	}
+
+	return otlpAttribute{Key: key, Value: v}
+}
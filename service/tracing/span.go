@@ -0,0 +1,215 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"math"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Kind tells the role of the span in the trace, as in OpenTelemetry
+type Kind int
+
+const (
+	// Internal is an operation inside the server
+	Internal Kind = 1
+
+	// Server is a request served to a client
+	Server Kind = 2
+
+	// Client is a request sent to another service (eg. the database)
+	Client Kind = 3
+)
+
+// Span is an operation timed within a trace, with its attributes. A nil *Span is valid, and records nothing.
+type Span struct {
+	tracer   *Tracer
+	traceID  [16]byte
+	spanID   [8]byte
+	parentID [8]byte
+	name     string
+	kind     Kind
+	start    time.Time
+
+	mu         sync.Mutex
+	end        time.Time
+	attributes []attribute
+	err        string
+	ended      bool
+}
+
+// attribute is an attribute of a span, whose value is a string, a bool, an integer or a float
+type attribute struct {
+	key   string
+	value interface{}
+}
+
+// spanKey is the key of the span in the context
+type spanKey struct{}
+
+// Start starts the span `name` of kind `kind`, child of the span held by `ctx`, returning the context holding the new
+// span and the span itself. Without a span in `ctx`, the trace is not recorded, and the span is nil.
+func Start(ctx context.Context, name string, kind Kind) (context.Context, *Span) {
+	parent := FromContext(ctx)
+
+	if parent == nil {
+		return ctx, nil
+	}
+
+	span := &Span{
+		tracer:   parent.tracer,
+		traceID:  parent.traceID,
+		spanID:   newSpanID(),
+		parentID: parent.spanID,
+		name:     name,
+		kind:     kind,
+		start:    time.Now(),
+	}
+
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+// FromContext returns the span held by the context, or nil
+func FromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey{}).(*Span)
+
+	return span
+}
+
+// SetName renames the span, once it is known what it does (eg. the route matched by a request)
+func (s *Span) SetName(name string) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.name = name
+}
+
+// SetAttribute sets the attribute `key` of the span, whose value must be a string, a bool, an integer or a float
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.attributes {
+		if s.attributes[i].key == key {
+			s.attributes[i].value = value
+			return
+		}
+	}
+
+	s.attributes = append(s.attributes, attribute{key: key, value: value})
+}
+
+// SetError marks the span as failed with `err`, if not nil
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.err = err.Error()
+}
+
+// End ends the span, queueing it for the export; the span must not be changed afterwards
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+
+	s.ended = true
+	s.end = time.Now()
+
+	s.mu.Unlock()
+
+	s.tracer.record(s)
+}
+
+// TraceID returns the id of the trace of the span in hex, or "" for a nil span
+func (s *Span) TraceID() string {
+	if s == nil {
+		return ""
+	}
+
+	return hex.EncodeToString(s.traceID[:])
+}
+
+// parseTraceParent parses the `traceparent` header of W3C Trace Context, returning the id of the trace, the id of the
+// parent span and whether the client records the trace, or false if the header is missing or invalid
+func parseTraceParent(header string) ([16]byte, [8]byte, bool, bool) {
+	var traceID [16]byte
+	var parentID [8]byte
+
+	// eg. "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	parts := strings.Split(strings.TrimSpace(header), "-")
+
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return traceID, parentID, false, false
+	}
+
+	// the version 00 has exactly four parts, the later ones may add more
+	if parts[0] == "00" && len(parts) != 4 {
+		return traceID, parentID, false, false
+	}
+
+	flags, err := hex.DecodeString(parts[3])
+
+	if err != nil || strings.ToLower(parts[1]) != parts[1] || strings.ToLower(parts[2]) != parts[2] {
+		return traceID, parentID, false, false
+	}
+
+	_, err1 := hex.Decode(traceID[:], []byte(parts[1]))
+	_, err2 := hex.Decode(parentID[:], []byte(parts[2]))
+
+	// the ids made of zeros are invalid
+	if err1 != nil || err2 != nil || traceID == [16]byte{} || parentID == [8]byte{} {
+		return [16]byte{}, [8]byte{}, false, false
+	}
+
+	return traceID, parentID, flags[0]&1 == 1, true
+}
+
+// sampleTrace tells whether the new trace `traceID` is recorded, for `ratio` of the traces, deciding from the random
+// bits of the id so that the decision is the same for the same trace
+func sampleTrace(traceID [16]byte, ratio float64) bool {
+	if ratio >= 1 {
+		return true
+	}
+
+	return float64(binary.BigEndian.Uint64(traceID[8:])) < ratio*math.MaxUint64
+}
+
+func newTraceID() [16]byte {
+	var id [16]byte
+
+	_, _ = rand.Read(id[:])
+
+	return id
+}
+
+func newSpanID() [8]byte {
+	var id [8]byte
+
+	_, _ = rand.Read(id[:])
+
+	return id
+}
@@ -0,0 +1,277 @@
+/*
+Package tracing records the traces of the requests served by the API, made of the spans of the handlers and of the
+queries to the database, and exports them to an OpenTelemetry collector, so that it can be seen where the time of a
+request is spent.
+
+A Tracer sends the spans to the collector in batches, encoded in the JSON protocol of OpenTelemetry (OTLP over HTTP).
+The trace of a request continues the one of the client, if the request carries a `traceparent` header (W3C Trace
+Context); otherwise a new trace is started, and only a share of them is sampled:
+
+	// Create the tracer of the requests
+	tracer, err := tracing.New(tracing.Config{
+		Endpoint:    cfg.Tracing.Endpoint,
+		ServiceName: cfg.Tracing.ServiceName,
+		SampleRatio: cfg.Tracing.SampleRatio,
+		Logger:      logger,
+	})
+	if err != nil {
+		logger.WithError(err).Error("error creating the tracer")
+		return fmt.Errorf("creating the tracer: %w", err)
+	}
+	defer tracer.Close()
+
+The span of a request is started with Tracer.StartRequest, and travels in the context of the request; the spans
+started with Start from that context are its children. Without a span in the context, or if the trace is not sampled,
+Start returns a nil span, whose methods do nothing, so that the code need not check whether tracing is enabled.
+
+See the `main.go` file inside the `cmd/webapi` for a full usage example.
+*/
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultInterval is how often the spans are exported by default
+const DefaultInterval = 5 * time.Second
+
+// maxBatch is the maximum number of spans exported in a single request, and queueSize the number of spans waiting to
+// be exported beyond which the new ones are dropped, so that a collector which is down does not exhaust the memory
+const maxBatch = 512
+const queueSize = 4096
+
+// Config is the configuration of a Tracer
+type Config struct {
+	// Endpoint is the url of the collector receiving the traces (eg. http://localhost:4318/v1/traces)
+	Endpoint string
+
+	// Headers are sent with every request to the collector (eg. its credentials)
+	Headers map[string]string
+
+	// ServiceName names the service in the traces
+	ServiceName string
+
+	// SampleRatio is the share of the traces started by the server which are recorded, between 0 and 1; the traces
+	// continued from the clients are recorded if the clients recorded them
+	SampleRatio float64
+
+	// Interval is how often the spans are exported (DefaultInterval if zero)
+	Interval time.Duration
+
+	// Client sends the requests to the collector (a client with a timeout of 10 seconds if nil)
+	Client *http.Client
+
+	// Logger reports the spans which could not be exported
+	Logger logrus.FieldLogger
+}
+
+// Tracer records the spans and exports them in the background, until it is closed
+type Tracer struct {
+	// dropped counts the spans dropped since the last export, because the queue was full; it comes first, to be
+	// aligned for the atomic operations
+	dropped uint64
+
+	cfg Config
+
+	mu     sync.RWMutex
+	closed bool
+	spans  chan *Span
+	done   chan struct{}
+}
+
+// New returns a Tracer exporting the spans to the collector of the configuration
+func New(cfg Config) (*Tracer, error) {
+	if cfg.Endpoint == "" {
+		return nil, errors.New("endpoint is required")
+	}
+	if cfg.ServiceName == "" {
+		return nil, errors.New("service name is required")
+	}
+	if cfg.SampleRatio < 0 || cfg.SampleRatio > 1 {
+		return nil, errors.New("the sample ratio must be between 0 and 1")
+	}
+	if cfg.Logger == nil {
+		return nil, errors.New("logger is required")
+	}
+
+	_, err := url.Parse(cfg.Endpoint)
+
+	if err != nil {
+		return nil, fmt.Errorf("parsing the endpoint: %w", err)
+	}
+
+	if cfg.Interval <= 0 {
+		cfg.Interval = DefaultInterval
+	}
+
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	t := &Tracer{
+		cfg:   cfg,
+		spans: make(chan *Span, queueSize),
+		done:  make(chan struct{}),
+	}
+
+	go t.export()
+
+	return t, nil
+}
+
+// Close stops recording the spans, and exports the ones recorded so far
+func (t *Tracer) Close() error {
+	t.mu.Lock()
+
+	if !t.closed {
+		t.closed = true
+		close(t.spans)
+	}
+
+	t.mu.Unlock()
+
+	<-t.done
+
+	return nil
+}
+
+// StartRequest starts the span of the request `r` served by the server, named `name`, continuing the trace of the
+// `traceparent` header of the request if valid. It returns the context of the request holding the span, and the span,
+// which is nil if the trace is not sampled.
+func (t *Tracer) StartRequest(r *http.Request, name string) (context.Context, *Span) {
+	if t == nil {
+		return r.Context(), nil
+	}
+
+	traceID, parentID, sampled, ok := parseTraceParent(r.Header.Get("traceparent"))
+
+	if !ok {
+		traceID = newTraceID()
+		sampled = sampleTrace(traceID, t.cfg.SampleRatio)
+	}
+
+	if !sampled {
+		return r.Context(), nil
+	}
+
+	span := &Span{
+		tracer:   t,
+		traceID:  traceID,
+		spanID:   newSpanID(),
+		parentID: parentID,
+		name:     name,
+		kind:     Server,
+		start:    time.Now(),
+	}
+
+	return context.WithValue(r.Context(), spanKey{}, span), span
+}
+
+// record queues the ended span for the export, dropping it if the queue is full or the tracer closed
+func (t *Tracer) record(span *Span) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	if t.closed {
+		return
+	}
+
+	select {
+	case t.spans <- span:
+	default:
+		atomic.AddUint64(&t.dropped, 1)
+	}
+}
+
+// export sends the queued spans to the collector in batches, every interval or once a batch is full, until the
+// tracer is closed
+func (t *Tracer) export() {
+	defer close(t.done)
+
+	ticker := time.NewTicker(t.cfg.Interval)
+	defer ticker.Stop()
+
+	batch := make([]*Span, 0, maxBatch)
+
+	flush := func() {
+		if dropped := atomic.SwapUint64(&t.dropped, 0); dropped > 0 {
+			t.cfg.Logger.WithField("spans", dropped).Warn("spans dropped, the export queue is full")
+		}
+
+		if len(batch) == 0 {
+			return
+		}
+
+		err := t.send(batch)
+
+		if err != nil {
+			t.cfg.Logger.WithError(err).WithField("spans", len(batch)).Warn("cannot export the spans")
+		}
+
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case span, ok := <-t.spans:
+			if !ok {
+				flush()
+				return
+			}
+
+			batch = append(batch, span)
+
+			if len(batch) == maxBatch {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// send posts the spans to the collector
+func (t *Tracer) send(spans []*Span) error {
+	body, err := json.Marshal(encodeSpans(t.cfg.ServiceName, spans))
+
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, t.cfg.Endpoint, bytes.NewReader(body))
+
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	for name, value := range t.cfg.Headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := t.cfg.Client.Do(req)
+
+	if err != nil {
+		return err
+	}
+
+	_ = resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("collector responded %s", resp.Status)
+	}
+
+	return nil
+}
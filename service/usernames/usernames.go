@@ -0,0 +1,182 @@
+// Package usernames holds the policy the usernames chosen by the users must comply with, and the key telling when two
+// usernames name the same user.
+package usernames
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// the Unicode normalizations of the usernames
+const (
+	NormalizationNone = "none"
+	NormalizationNFC  = "NFC"
+	NormalizationNFKC = "NFKC"
+)
+
+// the default policy: letters, digits, underscores and dots (the characters a
+// mention is made of), between 3 and 16 characters, case-sensitive, in NFKC
+const (
+	DefaultPattern         = `^[\p{L}\p{N}_.]+$`
+	DefaultMinLength       = 3
+	DefaultMaxLength       = 16
+	DefaultCaseInsensitive = false
+	DefaultNormalization   = NormalizationNFKC
+)
+
+// Policy tells which usernames the users may choose and which usernames name the same user
+type Policy struct {
+	pattern   *regexp.Regexp
+	minLength int
+	maxLength int
+
+	// caseInsensitive makes the usernames differing only in their case name the same user
+	caseInsensitive bool
+
+	// form is the Unicode normalization of the usernames, nil if they are kept as they are
+	form *norm.Form
+}
+
+// New returns the Policy letting the users choose the usernames matching `pattern` (with the syntax of the regexp
+// package), from `minLength` to `maxLength` characters long once normalized with `normalization` (one of
+// NormalizationNone, NormalizationNFC and NormalizationNFKC). If `caseInsensitive`, the usernames differing only in
+// their case name the same user. An error is returned if the pattern does not compile, the lengths are not a valid
+// range or the normalization is unknown.
+func New(pattern string, minLength int, maxLength int, caseInsensitive bool, normalization string) (*Policy, error) {
+	re, err := regexp.Compile(pattern)
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid username pattern %q: %w", pattern, err)
+	}
+
+	if minLength < 1 || maxLength < minLength {
+		return nil, fmt.Errorf("invalid username lengths: from %d to %d characters", minLength, maxLength)
+	}
+
+	p := &Policy{
+		pattern:         re,
+		minLength:       minLength,
+		maxLength:       maxLength,
+		caseInsensitive: caseInsensitive,
+	}
+
+	switch normalization {
+	case NormalizationNone:
+	case NormalizationNFC:
+		form := norm.NFC
+		p.form = &form
+	case NormalizationNFKC:
+		form := norm.NFKC
+		p.form = &form
+	default:
+		return nil, fmt.Errorf("unknown username normalization %q", normalization)
+	}
+
+	return p, nil
+}
+
+// Default returns the default Policy
+func Default() *Policy {
+	p, _ := New(DefaultPattern, DefaultMinLength, DefaultMaxLength, DefaultCaseInsensitive, DefaultNormalization)
+
+	return p
+}
+
+// Normalize returns `username` in the Unicode normalization of the policy, as it is saved
+func (p *Policy) Normalize(username string) string {
+	if p.form == nil {
+		return username
+	}
+
+	return p.form.String(username)
+}
+
+// Key returns the key of `username`: two usernames name the same user if and only if their keys are equal
+func (p *Policy) Key(username string) string {
+	username = p.Normalize(username)
+
+	if p.caseInsensitive {
+		username = strings.ToLower(username)
+	}
+
+	return username
+}
+
+// Valid reports whether a user may choose `username`, once normalized
+func (p *Policy) Valid(username string) bool {
+	username = p.Normalize(username)
+	length := utf8.RuneCountInString(username)
+
+	return length >= p.minLength && length <= p.maxLength && p.pattern.MatchString(username)
+}
+
+// Pattern returns the regular expression the usernames must match
+func (p *Policy) Pattern() string {
+	return p.pattern.String()
+}
+
+// MinLength returns the minimum length of the usernames, in characters
+func (p *Policy) MinLength() int {
+	return p.minLength
+}
+
+// MaxLength returns the maximum length of the usernames, in characters
+func (p *Policy) MaxLength() int {
+	return p.maxLength
+}
+
+// Reservation holds the usernames no user may choose under a policy: the reserved names, matched as a whole, and the
+// blocked terms, matched wherever they are contained in a username. Both are matched once normalized and ignoring the
+// case, whether or not the policy is case-insensitive.
+type Reservation struct {
+	policy *Policy
+
+	names map[string]bool
+	terms []string
+}
+
+// Reserve returns the Reservation of the `names` and of the blocked `terms` under the policy
+func (p *Policy) Reserve(names []string, terms []string) *Reservation {
+	r := &Reservation{
+		policy: p,
+		names:  make(map[string]bool),
+	}
+
+	for _, name := range names {
+		r.names[r.fold(name)] = true
+	}
+
+	for _, term := range terms {
+		if term = r.fold(term); term != "" {
+			r.terms = append(r.terms, term)
+		}
+	}
+
+	return r
+}
+
+// Reserved reports whether `username` is reserved, returning the reserved name or the blocked term it matches
+func (r *Reservation) Reserved(username string) (string, bool) {
+	username = r.fold(username)
+
+	if r.names[username] {
+		return username, true
+	}
+
+	for _, term := range r.terms {
+		if strings.Contains(username, term) {
+			return term, true
+		}
+	}
+
+	return "", false
+}
+
+// fold returns the form of `s` the reservation is matched in
+func (r *Reservation) fold(s string) string {
+	return strings.ToLower(r.policy.Normalize(strings.TrimSpace(s)))
+}
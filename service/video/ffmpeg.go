@@ -0,0 +1,93 @@
+package video
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxFFmpegErrorLength is the longest part of the error output of ffmpeg kept in the errors
+const maxFFmpegErrorLength = 512
+
+// fileExtensions maps the formats of the videos to the extension of the temporary files passed to ffmpeg
+var fileExtensions = map[string]string{
+	MP4:  ".mp4",
+	WebM: ".webm",
+}
+
+// FFmpeg is the Framer running the ffmpeg executable. The video is written to a temporary file, since the MP4 videos
+// may keep the index of their frames after them and cannot be read from a pipe.
+type FFmpeg struct {
+	path string
+}
+
+// NewFFmpeg returns a FFmpeg running the executable at `path`, looked up in the directories of the PATH environment
+// variable if it holds no slash. An error is returned if the executable cannot be found.
+func NewFFmpeg(path string) (*FFmpeg, error) {
+	found, err := exec.LookPath(path)
+
+	if err != nil {
+		return nil, fmt.Errorf("looking up ffmpeg: %w", err)
+	}
+
+	return &FFmpeg{path: found}, nil
+}
+
+func (f *FFmpeg) Frame(ctx context.Context, content []byte, contentType string, at time.Duration) ([]byte, error) {
+	file, err := os.CreateTemp("", "video-*"+fileExtensions[contentType])
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer os.Remove(file.Name())
+
+	_, err = file.Write(content)
+
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	// seek to the frame before decoding, and encode it as a single JPEG image
+	cmd := exec.CommandContext(ctx, f.path,
+		"-nostdin", "-v", "error",
+		"-ss", strconv.FormatFloat(at.Seconds(), 'f', 3, 64),
+		"-i", file.Name(),
+		"-frames:v", "1",
+		"-f", "image2pipe", "-c:v", "mjpeg", "-q:v", "3",
+		"pipe:1",
+	)
+
+	var stdout, stderr bytes.Buffer
+
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err = cmd.Run()
+
+	if err != nil {
+		message := strings.TrimSpace(stderr.String())
+
+		if len(message) > maxFFmpegErrorLength {
+			message = message[:maxFFmpegErrorLength]
+		}
+
+		return nil, fmt.Errorf("running ffmpeg: %w: %s", err, message)
+	}
+
+	// a seek past the last frame decodes none
+	if stdout.Len() == 0 {
+		return nil, fmt.Errorf("running ffmpeg: no frame at %v", at)
+	}
+
+	return stdout.Bytes(), nil
+}
@@ -0,0 +1,230 @@
+package video
+
+import (
+	"encoding/binary"
+	"math"
+	"time"
+)
+
+// mp4Box is a box of a MP4 file: its four-character type and its payload, which may hold more boxes
+type mp4Box struct {
+	kind    string
+	payload []byte
+}
+
+// mp4Boxes splits `data` into the boxes it is made of, returning ErrInvalidVideo if a box does not fit in it
+func mp4Boxes(data []byte) ([]mp4Box, error) {
+	var boxes []mp4Box
+
+	for len(data) > 0 {
+		if len(data) < 8 {
+			return nil, ErrInvalidVideo
+		}
+
+		size := uint64(binary.BigEndian.Uint32(data[0:4]))
+		header := uint64(8)
+
+		switch size {
+		case 0:
+			// the last box lasts until the end of the file
+			size = uint64(len(data))
+		case 1:
+			// the size does not fit in 32 bits and follows the type
+			if len(data) < 16 {
+				return nil, ErrInvalidVideo
+			}
+
+			size = binary.BigEndian.Uint64(data[8:16])
+			header = 16
+		}
+
+		if size < header || size > uint64(len(data)) {
+			return nil, ErrInvalidVideo
+		}
+
+		boxes = append(boxes, mp4Box{kind: string(data[4:8]), payload: data[header:size]})
+		data = data[size:]
+	}
+
+	return boxes, nil
+}
+
+// mp4Child returns the payload of the first box of type `kind` among `boxes`, or false if there is none
+func mp4Child(boxes []mp4Box, kind string) ([]byte, bool) {
+	for _, box := range boxes {
+		if box.kind == kind {
+			return box.payload, true
+		}
+	}
+
+	return nil, false
+}
+
+// inspectMP4 reads the duration of the MP4 video `content` from the header of its movie (mvhd), or of its fragments
+// (mehd) if the movie has no duration, and its size from the header of its first video track (tkhd)
+func inspectMP4(content []byte) (Info, error) {
+	info := Info{ContentType: MP4}
+
+	top, err := mp4Boxes(content)
+
+	if err != nil {
+		return info, err
+	}
+
+	moov, ok := mp4Child(top, "moov")
+
+	if !ok {
+		return info, ErrInvalidVideo
+	}
+
+	movie, err := mp4Boxes(moov)
+
+	if err != nil {
+		return info, err
+	}
+
+	mvhd, ok := mp4Child(movie, "mvhd")
+
+	if !ok || len(mvhd) < 4 {
+		return info, ErrInvalidVideo
+	}
+
+	// the version tells whether the dates and the duration take 32 or 64 bits
+	var timescale, duration uint64
+
+	switch {
+	case mvhd[0] == 0 && len(mvhd) >= 20:
+		timescale = uint64(binary.BigEndian.Uint32(mvhd[12:16]))
+		duration = uint64(binary.BigEndian.Uint32(mvhd[16:20]))
+	case mvhd[0] == 1 && len(mvhd) >= 32:
+		timescale = uint64(binary.BigEndian.Uint32(mvhd[20:24]))
+		duration = binary.BigEndian.Uint64(mvhd[24:32])
+	default:
+		return info, ErrInvalidVideo
+	}
+
+	// a fragmented video may tell its duration in the header of the fragments only
+	if duration == 0 {
+		duration = mp4FragmentDuration(movie)
+	}
+
+	info.Duration, ok = scaleDuration(duration, timescale)
+
+	if !ok || info.Duration <= 0 {
+		return info, ErrInvalidVideo
+	}
+
+	for _, box := range movie {
+		if box.kind != "trak" {
+			continue
+		}
+
+		track, err := mp4Boxes(box.payload)
+
+		if err != nil {
+			return info, err
+		}
+
+		if !mp4VideoTrack(track) {
+			continue
+		}
+
+		info.Width, info.Height, ok = mp4TrackSize(track)
+
+		if !ok {
+			return info, ErrInvalidVideo
+		}
+
+		return info, nil
+	}
+
+	return info, ErrInvalidVideo
+}
+
+// mp4FragmentDuration returns the duration of the fragments of the movie, in the timescale of the movie, or zero if
+// it is not given
+func mp4FragmentDuration(movie []mp4Box) uint64 {
+	mvex, ok := mp4Child(movie, "mvex")
+
+	if !ok {
+		return 0
+	}
+
+	extends, err := mp4Boxes(mvex)
+
+	if err != nil {
+		return 0
+	}
+
+	mehd, ok := mp4Child(extends, "mehd")
+
+	switch {
+	case !ok || len(mehd) < 8:
+		return 0
+	case mehd[0] == 1 && len(mehd) >= 12:
+		return binary.BigEndian.Uint64(mehd[4:12])
+	default:
+		return uint64(binary.BigEndian.Uint32(mehd[4:8]))
+	}
+}
+
+// mp4VideoTrack tells whether the handler of the media of the track (hdlr) is the one of the videos
+func mp4VideoTrack(track []mp4Box) bool {
+	mdia, ok := mp4Child(track, "mdia")
+
+	if !ok {
+		return false
+	}
+
+	media, err := mp4Boxes(mdia)
+
+	if err != nil {
+		return false
+	}
+
+	hdlr, ok := mp4Child(media, "hdlr")
+
+	return ok && len(hdlr) >= 12 && string(hdlr[8:12]) == "vide"
+}
+
+// mp4TrackSize reads the size of the frames of the track from its header, where it is a 16.16 fixed-point number
+func mp4TrackSize(track []mp4Box) (int, int, bool) {
+	tkhd, ok := mp4Child(track, "tkhd")
+
+	if !ok || len(tkhd) < 1 {
+		return 0, 0, false
+	}
+
+	// the size follows the dates, the id, the duration, the
+	// layer, the volume and the matrix of the track
+	offset := 76
+
+	if tkhd[0] == 1 {
+		offset = 88
+	}
+
+	if len(tkhd) < offset+8 {
+		return 0, 0, false
+	}
+
+	width := int(binary.BigEndian.Uint32(tkhd[offset:offset+4]) >> 16)
+	height := int(binary.BigEndian.Uint32(tkhd[offset+4:offset+8]) >> 16)
+
+	return width, height, width > 0 && height > 0
+}
+
+// scaleDuration returns the duration of `value` units, `timescale` of them in a second, or false if the timescale is
+// zero or the duration does not fit in a time.Duration
+func scaleDuration(value uint64, timescale uint64) (time.Duration, bool) {
+	if timescale == 0 {
+		return 0, false
+	}
+
+	seconds, rest := value/timescale, value%timescale
+
+	if seconds >= uint64(math.MaxInt64/int64(time.Second)) {
+		return 0, false
+	}
+
+	return time.Duration(seconds)*time.Second + time.Duration(rest*uint64(time.Second)/timescale), true
+}
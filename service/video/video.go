@@ -0,0 +1,71 @@
+/*
+Package video reads the short videos uploaded by the users before they are saved: it tells their format, their
+duration and their size from their container, without decoding them, and extracts the frame shown as their poster
+until they are played.
+
+The frames are extracted by a Framer, so that the API does not depend on the tool decoding the videos. To extract them
+with ffmpeg, create a new instance with NewFFmpeg() passing the path of its executable:
+
+	// Create the extractor of the posters of the videos
+	framer, err := video.NewFFmpeg("ffmpeg")
+	if err != nil {
+		logger.WithError(err).Error("error creating the video framer")
+		return fmt.Errorf("creating the video framer: %w", err)
+	}
+
+See the `main.go` file inside the `cmd/webapi` for a full usage example.
+*/
+package video
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"time"
+)
+
+// the media types of the formats accepted for the videos
+const (
+	MP4  = "video/mp4"
+	WebM = "video/webm"
+)
+
+// ErrUnsupportedFormat is returned when a video is not a MP4 or WebM video
+var ErrUnsupportedFormat = errors.New("unsupported video format")
+
+// ErrInvalidVideo is returned when the container of a video is damaged, or holds no video track or no duration
+var ErrInvalidVideo = errors.New("invalid video")
+
+// Info describes a video without decoding it.
+type Info struct {
+	// ContentType is the media type of the format of the video (MP4 or WebM)
+	ContentType string
+
+	// Duration is how long the video lasts
+	Duration time.Duration
+
+	// Width and Height are the size of the frames of the video in pixels
+	Width  int
+	Height int
+}
+
+// Inspect detects the format of the video `content` from its first bytes, ignoring what the client declared, and
+// reads its duration and its size from its container. It returns ErrUnsupportedFormat if the video is not a MP4 or
+// WebM video, and ErrInvalidVideo if its container is damaged.
+func Inspect(content []byte) (Info, error) {
+	switch {
+	case len(content) >= 12 && string(content[4:8]) == "ftyp":
+		return inspectMP4(content)
+	case bytes.HasPrefix(content, []byte("\x1a\x45\xdf\xa3")):
+		return inspectWebM(content)
+	default:
+		return Info{}, ErrUnsupportedFormat
+	}
+}
+
+// Framer is the interface of the tools extracting a frame of a video, shown as its poster until it is played.
+type Framer interface {
+	// Frame returns the frame shown at `at` of the video `content`, encoded as `contentType` (eg. "video/mp4"), as a
+	// JPEG image.
+	Frame(ctx context.Context, content []byte, contentType string, at time.Duration) ([]byte, error)
+}
@@ -0,0 +1,458 @@
+package video
+
+import (
+	"encoding/binary"
+	"math"
+	"math/bits"
+	"time"
+)
+
+// the ids of the EBML elements of a WebM video which are read
+const (
+	ebmlHeader        = 0x1a45dfa3
+	ebmlDocType       = 0x4282
+	webmSegment       = 0x18538067
+	webmInfo          = 0x1549a966
+	webmTimecodeScale = 0x2ad7b1
+	webmDuration      = 0x4489
+	webmTracks        = 0x1654ae6b
+	webmTrackEntry    = 0xae
+	webmTrackType     = 0x83
+	webmVideo         = 0xe0
+	webmPixelWidth    = 0xb0
+	webmPixelHeight   = 0xba
+	webmCluster       = 0x1f43b675
+	webmTimecode      = 0xe7
+	webmSimpleBlock   = 0xa3
+	webmBlockGroup    = 0xa0
+	webmBlock         = 0xa1
+	webmBlockDuration = 0x9b
+)
+
+// webmClusterChildren are the ids of the elements a cluster may hold: a cluster whose size is unknown, as the ones
+// recorded by the browsers, ends at the first element which is not one of them
+var webmClusterChildren = map[uint64]bool{
+	webmTimecode:    true,
+	webmSimpleBlock: true,
+	webmBlockGroup:  true,
+	0xa7:            true, // Position
+	0xab:            true, // PrevSize
+	0xaf:            true, // EncryptedBlock
+	0x5854:          true, // SilentTracks
+	0xec:            true, // Void
+	0xbf:            true, // CRC-32
+}
+
+// webmVideoTrack is the type of the video tracks
+const webmVideoTrack = 1
+
+// webmDefaultTimecodeScale is the length of a unit of the timecodes, in nanoseconds, when the video does not tell it
+const webmDefaultTimecodeScale = 1000000
+
+// ebmlElement is an element of an EBML document: its id, with the marker of its length kept, and its payload. If the
+// size of the element is unknown, its payload lasts until the end of the data it was read from.
+type ebmlElement struct {
+	id      uint64
+	payload []byte
+	unknown bool
+}
+
+// ebmlVint reads the variable-length integer at the start of `data`, returning its value, with the marker of its
+// length kept if `marker` (as the ids are) or removed (as the sizes are), and its length in bytes
+func ebmlVint(data []byte, marker bool) (uint64, int, bool) {
+	if len(data) == 0 || data[0] == 0 {
+		return 0, 0, false
+	}
+
+	length := bits.LeadingZeros8(data[0]) + 1
+
+	if len(data) < length {
+		return 0, 0, false
+	}
+
+	value := uint64(data[0])
+
+	if !marker {
+		value &= 0xff >> length
+	}
+
+	for _, b := range data[1:length] {
+		value = value<<8 | uint64(b)
+	}
+
+	return value, length, true
+}
+
+// ebmlNext reads the element at the start of `data`, returning it and the data following it
+func ebmlNext(data []byte) (ebmlElement, []byte, error) {
+	id, idLength, ok := ebmlVint(data, true)
+
+	if !ok || idLength > 4 {
+		return ebmlElement{}, nil, ErrInvalidVideo
+	}
+
+	size, sizeLength, ok := ebmlVint(data[idLength:], false)
+
+	if !ok {
+		return ebmlElement{}, nil, ErrInvalidVideo
+	}
+
+	data = data[idLength+sizeLength:]
+
+	// a size made only of ones is unknown
+	if size == 1<<(7*sizeLength)-1 {
+		return ebmlElement{id: id, payload: data, unknown: true}, nil, nil
+	}
+
+	if size > uint64(len(data)) {
+		return ebmlElement{}, nil, ErrInvalidVideo
+	}
+
+	return ebmlElement{id: id, payload: data[:size]}, data[size:], nil
+}
+
+// ebmlChildren returns the elements `data` is made of, returning ErrInvalidVideo if one of them has an unknown size
+func ebmlChildren(data []byte) ([]ebmlElement, error) {
+	var elements []ebmlElement
+
+	for len(data) > 0 {
+		element, rest, err := ebmlNext(data)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if element.unknown {
+			return nil, ErrInvalidVideo
+		}
+
+		elements = append(elements, element)
+		data = rest
+	}
+
+	return elements, nil
+}
+
+// ebmlUint returns the value of an unsigned integer element
+func ebmlUint(payload []byte) (uint64, bool) {
+	if len(payload) > 8 {
+		return 0, false
+	}
+
+	var value uint64
+
+	for _, b := range payload {
+		value = value<<8 | uint64(b)
+	}
+
+	return value, true
+}
+
+// ebmlFloat returns the value of a float element, of 4 or 8 bytes
+func ebmlFloat(payload []byte) (float64, bool) {
+	switch len(payload) {
+	case 4:
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(payload))), true
+	case 8:
+		return math.Float64frombits(binary.BigEndian.Uint64(payload)), true
+	default:
+		return 0, false
+	}
+}
+
+// webmReader holds what was read of a WebM video while walking its segment
+type webmReader struct {
+	info Info
+
+	// timecodeScale is the length of a unit of the timecodes in nanoseconds
+	timecodeScale uint64
+
+	// duration is the duration of the segment in units of the timecodes, or -1 if it does not tell it
+	duration float64
+
+	// end is the latest timecode a block of the clusters ends at, the duration of the videos not telling it
+	end int64
+}
+
+// inspectWebM reads the duration of the WebM video `content` from the information of its segment, or from the
+// timecodes of its blocks if it does not tell it (as the videos recorded by the browsers), and its size from the first
+// video track
+func inspectWebM(content []byte) (Info, error) {
+	header, data, err := ebmlNext(content)
+
+	if err != nil || header.unknown {
+		return Info{}, ErrInvalidVideo
+	}
+
+	headerChildren, err := ebmlChildren(header.payload)
+
+	if err != nil {
+		return Info{}, err
+	}
+
+	// a Matroska file which is not a WebM one may hold any codec
+	docType := ""
+
+	for _, element := range headerChildren {
+		if element.id == ebmlDocType {
+			docType = string(element.payload)
+		}
+	}
+
+	if docType != "webm" {
+		return Info{}, ErrUnsupportedFormat
+	}
+
+	r := webmReader{
+		info:          Info{ContentType: WebM},
+		timecodeScale: webmDefaultTimecodeScale,
+		duration:      -1,
+	}
+
+	// skip the elements before the segment (eg. Void)
+	for {
+		if len(data) == 0 {
+			return r.info, ErrInvalidVideo
+		}
+
+		segment, rest, err := ebmlNext(data)
+
+		if err != nil {
+			return r.info, err
+		}
+
+		if segment.id == webmSegment {
+			err = r.segment(segment.payload)
+
+			if err != nil {
+				return r.info, err
+			}
+
+			break
+		}
+
+		data = rest
+	}
+
+	duration := r.duration
+
+	if duration < 0 {
+		duration = float64(r.end)
+	}
+
+	nanoseconds := duration * float64(r.timecodeScale)
+
+	if !(nanoseconds > 0 && nanoseconds < math.MaxInt64) || r.info.Width <= 0 || r.info.Height <= 0 {
+		return r.info, ErrInvalidVideo
+	}
+
+	r.info.Duration = time.Duration(nanoseconds)
+
+	return r.info, nil
+}
+
+// segment walks the elements of the segment, reading its information, its tracks and its clusters
+func (r *webmReader) segment(data []byte) error {
+	for len(data) > 0 {
+		element, rest, err := ebmlNext(data)
+
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case element.id == webmCluster && element.unknown:
+			rest, err = r.cluster(element.payload, true)
+		case element.unknown:
+			return ErrInvalidVideo
+		case element.id == webmInfo:
+			err = r.segmentInfo(element.payload)
+		case element.id == webmTracks:
+			err = r.tracks(element.payload)
+		case element.id == webmCluster:
+			_, err = r.cluster(element.payload, false)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		data = rest
+	}
+
+	return nil
+}
+
+// segmentInfo reads the scale of the timecodes and the duration of the segment
+func (r *webmReader) segmentInfo(data []byte) error {
+	elements, err := ebmlChildren(data)
+
+	if err != nil {
+		return err
+	}
+
+	for _, element := range elements {
+		var ok bool
+
+		switch element.id {
+		case webmTimecodeScale:
+			r.timecodeScale, ok = ebmlUint(element.payload)
+		case webmDuration:
+			r.duration, ok = ebmlFloat(element.payload)
+		default:
+			ok = true
+		}
+
+		if !ok {
+			return ErrInvalidVideo
+		}
+	}
+
+	return nil
+}
+
+// tracks reads the size of the frames of the first video track
+func (r *webmReader) tracks(data []byte) error {
+	entries, err := ebmlChildren(data)
+
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if entry.id != webmTrackEntry || r.info.Width > 0 {
+			continue
+		}
+
+		elements, err := ebmlChildren(entry.payload)
+
+		if err != nil {
+			return err
+		}
+
+		var trackType uint64
+		var settings []byte
+
+		for _, element := range elements {
+			switch element.id {
+			case webmTrackType:
+				trackType, _ = ebmlUint(element.payload)
+			case webmVideo:
+				settings = element.payload
+			}
+		}
+
+		if trackType != webmVideoTrack || settings == nil {
+			continue
+		}
+
+		elements, err = ebmlChildren(settings)
+
+		if err != nil {
+			return err
+		}
+
+		for _, element := range elements {
+			value, _ := ebmlUint(element.payload)
+
+			switch element.id {
+			case webmPixelWidth:
+				r.info.Width = int(value)
+			case webmPixelHeight:
+				r.info.Height = int(value)
+			}
+		}
+	}
+
+	return nil
+}
+
+// cluster reads the timecodes of the blocks of the cluster, keeping the latest one a block ends at. If `unknown`, the
+// size of the cluster is unknown and `data` lasts until the end of the segment: the cluster ends at the first element
+// which cannot be in a cluster, and the data following it is returned.
+func (r *webmReader) cluster(data []byte, unknown bool) ([]byte, error) {
+	var timecode int64
+
+	for len(data) > 0 {
+		element, rest, err := ebmlNext(data)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if unknown && !webmClusterChildren[element.id] {
+			return data, nil
+		}
+
+		if element.unknown {
+			return nil, ErrInvalidVideo
+		}
+
+		switch element.id {
+		case webmTimecode:
+			value, ok := ebmlUint(element.payload)
+
+			if !ok || value > math.MaxInt32 {
+				return nil, ErrInvalidVideo
+			}
+
+			timecode = int64(value)
+		case webmSimpleBlock:
+			err = r.block(timecode, element.payload, 0)
+		case webmBlockGroup:
+			err = r.blockGroup(timecode, element.payload)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		data = rest
+	}
+
+	return nil, nil
+}
+
+// blockGroup reads the timecode of the block of the group, ending after its duration
+func (r *webmReader) blockGroup(timecode int64, data []byte) error {
+	elements, err := ebmlChildren(data)
+
+	if err != nil {
+		return err
+	}
+
+	var block []byte
+	var duration uint64
+
+	for _, element := range elements {
+		switch element.id {
+		case webmBlock:
+			block = element.payload
+		case webmBlockDuration:
+			duration, _ = ebmlUint(element.payload)
+		}
+	}
+
+	if block == nil || duration > math.MaxInt32 {
+		return ErrInvalidVideo
+	}
+
+	return r.block(timecode, block, int64(duration))
+}
+
+// block reads the timecode of a block, relative to the `timecode` of its cluster, which ends after `duration`
+func (r *webmReader) block(timecode int64, data []byte, duration int64) error {
+	_, length, ok := ebmlVint(data, false)
+
+	if !ok || len(data) < length+2 {
+		return ErrInvalidVideo
+	}
+
+	end := timecode + int64(int16(binary.BigEndian.Uint16(data[length:length+2]))) + duration
+
+	if end > r.end {
+		r.end = end
+	}
+
+	return nil
+}
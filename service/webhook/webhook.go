@@ -0,0 +1,133 @@
+/*
+Package webhook delivers the events of the API to the URLs registered by the administrators. Every event is POSTed as
+a JSON payload with the headers
+
+	X-Webhook-Event: photo.created
+	X-Webhook-Delivery: 42
+	X-Webhook-Signature: sha256=<hex of the HMAC-SHA256 of the body, keyed by the secret of the webhook>
+
+so that the receivers can tell which event they got and that it comes from the API. To deliver the events, create a new
+instance with NewSender() passing how long a receiver can take to answer:
+
+	// Create the sender of the events
+	sender := webhook.NewSender(10 * time.Second)
+
+	status, err := sender.Send(ctx, webhook.Delivery{Id: 42, Event: webhook.EventPhotoCreated, Url: url, Secret: secret, Payload: payload})
+	if err != nil {
+		logger.WithError(err).WithField("status", status).Warn("the event was not delivered")
+	}
+
+See the `webhook.go` file inside the `service/api` for a full usage example.
+*/
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// the events a webhook can subscribe to
+const (
+	EventPhotoCreated   = "photo.created"
+	EventUserFollowed   = "user.followed"
+	EventCommentCreated = "comment.created"
+)
+
+// Events are all the events a webhook can subscribe to, sorted by name
+var Events = []string{EventCommentCreated, EventPhotoCreated, EventUserFollowed}
+
+// IsEvent returns whether a webhook can subscribe to the event
+func IsEvent(event string) bool {
+	for _, e := range Events {
+		if e == event {
+			return true
+		}
+	}
+
+	return false
+}
+
+// maxResponseBody is how much of the body of a response is read, so that the connection can be reused, before it is
+// closed
+const maxResponseBody = 64 * 1024
+
+// ErrRejected is returned when the receiver answers a delivery with a status other than 2xx
+var ErrRejected = errors.New("the receiver rejected the delivery")
+
+// Delivery is an event to be POSTed to the URL of a webhook.
+type Delivery struct {
+	// Id identifies the delivery, so that the receivers can tell the attempts of the same delivery apart from the
+	// deliveries of the same event to the other webhooks
+	Id      uint32
+	Event   string
+	Url     string
+	Secret  string
+	Payload []byte
+}
+
+// Sender POSTs the deliveries to the receivers. It does not follow the redirects, which are taken as a failure.
+type Sender struct {
+	client *http.Client
+}
+
+// NewSender returns a Sender giving up on the receivers not answering within `timeout`.
+func NewSender(timeout time.Duration) *Sender {
+	return &Sender{
+		client: &http.Client{
+			Timeout: timeout,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+}
+
+// Send POSTs the payload of the delivery to its URL, signed with its secret. It returns the status code of the
+// response, or 0 if there was none; an error wrapping ErrRejected is returned if the status is not 2xx.
+func (s *Sender) Send(ctx context.Context, d Delivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.Url, bytes.NewReader(d.Payload))
+
+	if err != nil {
+		return 0, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "WASAPhoto-Webhook")
+	req.Header.Set("X-Webhook-Event", d.Event)
+	req.Header.Set("X-Webhook-Delivery", strconv.FormatUint(uint64(d.Id), 10))
+	req.Header.Set("X-Webhook-Signature", Sign(d.Secret, d.Payload))
+
+	resp, err := s.client.Do(req)
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer resp.Body.Close()
+
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, maxResponseBody))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("%w: %s", ErrRejected, resp.Status)
+	}
+
+	return resp.StatusCode, nil
+}
+
+// Sign returns the signature of the payload sent in the X-Webhook-Signature header: the hex encoded HMAC-SHA256 of the
+// payload keyed by the secret, prefixed by "sha256=".
+func Sign(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	_, _ = mac.Write(payload)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
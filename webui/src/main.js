@@ -12,6 +12,8 @@ import './assets/main.css'
 
 const app = createApp(App)
 app.config.globalProperties.$axios = axios;
+// the uploaded photos are served by the API, under urls relative to its server
+app.config.globalProperties.$photoSrc = (url) => url.startsWith("/") ? __API_URL__ + url : url;
 app.component("ErrorMsg", ErrorMsg);
 app.component("LoadingSpinner", LoadingSpinner);
 app.component("CommentBox", CommentBox);
@@ -1,8 +1,59 @@
 import axios from "axios";
 
 const instance = axios.create({
-	baseURL: __API_URL__,
+	baseURL: __API_URL__ + "/v1",
 	timeout: 1000 * 5
 });
 
+// the views read the token when they are created, hence
+// the requests always take the latest one instead
+instance.interceptors.request.use((config) => {
+	const token = localStorage.getItem("token");
+
+	if (token && config.headers.Authorization) {
+		config.headers.Authorization = "Bearer " + token;
+	}
+
+	return config;
+});
+
+// refreshing is shared by the requests failing together,
+// since each refresh token can be exchanged only once
+let refreshing = null;
+
+function refresh() {
+	if (refreshing === null) {
+		refreshing = instance.post("/session/refresh", {
+			refresh_token: localStorage.getItem("refreshToken"),
+		}).then((response) => {
+			localStorage.setItem("token", response.data.token);
+			localStorage.setItem("refreshToken", response.data.refresh_token);
+		}).finally(() => {
+			refreshing = null;
+		});
+	}
+
+	return refreshing;
+}
+
+// once the access token expires, the tokens are refreshed
+// and the request is sent again with the new access token
+instance.interceptors.response.use(null, async (error) => {
+	const config = error.config;
+
+	if (error.response && error.response.status === 401 && config && config.headers.Authorization && !config._retried && localStorage.getItem("refreshToken")) {
+		config._retried = true;
+
+		try {
+			await refresh();
+		} catch (e) {
+			return Promise.reject(error);
+		}
+
+		return instance(config);
+	}
+
+	return Promise.reject(error);
+});
+
 export default instance;